@@ -10,13 +10,23 @@ import (
 	"github.com/babbage88/go-infra/internal/cors"
 	"github.com/babbage88/go-infra/internal/middleware"
 	"github.com/babbage88/go-infra/internal/swaggerui"
+	"github.com/babbage88/go-infra/services/api_tokens"
+	"github.com/babbage88/go-infra/services/audit_log"
 	"github.com/babbage88/go-infra/services/external_applications"
 	"github.com/babbage88/go-infra/services/host_servers"
 	"github.com/babbage88/go-infra/services/node_networking"
+	"github.com/babbage88/go-infra/services/oidc_auth"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/rbac_sync"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/babbage88/go-infra/services/ssh_connections"
 	"github.com/babbage88/go-infra/services/ssh_key_provider"
 	"github.com/babbage88/go-infra/services/user_crud_svc"
+	"github.com/babbage88/go-infra/services/user_groups"
+	"github.com/babbage88/go-infra/services/user_mfa"
 	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/babbage88/go-infra/services/user_verification"
+	"github.com/babbage88/go-infra/services/webauthn"
 	"github.com/babbage88/go-infra/webutils/cert_renew"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -27,13 +37,127 @@ func hostServerByIDHandler(provider host_servers.HostServerProvider, authService
 		switch r.Method {
 		case http.MethodGet:
 			// Read permission
-			authapi.AuthMiddlewareRequirePermission(authService, "ReadHostServers", host_servers.GetHostServerHandler(provider)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadHostServers", "ID", host_servers.GetHostServerHandler(provider)).ServeHTTP(w, r)
 		case http.MethodPut:
 			// Manage permission
-			authapi.AuthMiddlewareRequirePermission(authService, "ManageHostServers", host_servers.UpdateHostServerHandler(provider)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ManageHostServers", "ID", host_servers.UpdateHostServerHandler(provider)).ServeHTTP(w, r)
 		case http.MethodDelete:
 			// Manage permission
-			authapi.AuthMiddlewareRequirePermission(authService, "ManageHostServers", host_servers.DeleteHostServerHandler(provider)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ManageHostServers", "ID", host_servers.DeleteHostServerHandler(provider)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// rolePermissionScopesHandler handles GET and POST methods for /roles/{ID}/permission-scopes
+func rolePermissionScopesHandler(manager resource_policy.ScopeManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, "ReadRoles", resource_policy.GetRoleScopesHandler(manager)).ServeHTTP(w, r)
+		case http.MethodPost:
+			authapi.AuthMiddlewareRequirePermission(authService, "AlterRole", resource_policy.AddRoleScopeHandler(manager)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// hostServerTagsHandler handles GET and PUT methods for /host-servers/{ID}/tags
+func hostServerTagsHandler(manager resource_policy.ScopeManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadHostServers", "ID", resource_policy.GetHostServerTagsHandler(manager)).ServeHTTP(w, r)
+		case http.MethodPut:
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ManageHostServers", "ID", resource_policy.SetHostServerTagsHandler(manager)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// organizationsHandler handles GET and POST methods for /organizations
+func organizationsHandler(manager organizations.OrganizationManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, "ReadOrganizations", organizations.GetAllOrganizationsHandler(manager)).ServeHTTP(w, r)
+		case http.MethodPost:
+			authapi.AuthMiddlewareRequirePermission(authService, "ManageOrganizations", organizations.CreateOrganizationHandler(manager)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// organizationByIDHandler handles GET and DELETE methods for /organizations/{ID}
+func organizationByIDHandler(manager organizations.OrganizationManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, "ReadOrganizations", organizations.GetOrganizationHandler(manager)).ServeHTTP(w, r)
+		case http.MethodDelete:
+			authapi.AuthMiddlewareRequirePermission(authService, "ManageOrganizations", organizations.DeleteOrganizationHandler(manager)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// organizationMembersHandler handles GET and POST methods for /organizations/{ID}/members
+func organizationMembersHandler(manager organizations.OrganizationManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, "ReadOrganizations", organizations.GetMembersHandler(manager)).ServeHTTP(w, r)
+		case http.MethodPost:
+			authapi.AuthMiddlewareRequirePermission(authService, "ManageOrganizations", organizations.AddMemberHandler(manager)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// userGroupsHandler handles GET and POST methods for /user-groups
+func userGroupsHandler(manager user_groups.UserGroupManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, "ReadUserGroups", user_groups.GetAllUserGroupsHandler(manager)).ServeHTTP(w, r)
+		case http.MethodPost:
+			authapi.AuthMiddlewareRequirePermission(authService, "ManageUserGroups", user_groups.CreateUserGroupHandler(manager)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// userGroupByIDHandler handles GET, PUT and DELETE methods for /user-groups/{ID}
+func userGroupByIDHandler(manager user_groups.UserGroupManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, "ReadUserGroups", user_groups.GetUserGroupHandler(manager)).ServeHTTP(w, r)
+		case http.MethodPut:
+			authapi.AuthMiddlewareRequirePermission(authService, "ManageUserGroups", user_groups.UpdateUserGroupHandler(manager)).ServeHTTP(w, r)
+		case http.MethodDelete:
+			authapi.AuthMiddlewareRequirePermission(authService, "ManageUserGroups", user_groups.DeleteUserGroupHandler(manager)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// userGroupMembersHandler handles GET and POST methods for /user-groups/{ID}/members
+func userGroupMembersHandler(manager user_groups.UserGroupManager, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, "ReadUserGroups", user_groups.GetGroupMembersHandler(manager)).ServeHTTP(w, r)
+		case http.MethodPost:
+			authapi.AuthMiddlewareRequirePermission(authService, "ManageUserGroups", user_groups.AddGroupMemberHandler(manager)).ServeHTTP(w, r)
 		default:
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
@@ -42,15 +166,22 @@ func hostServerByIDHandler(provider host_servers.HostServerProvider, authService
 
 func AddApplicationRoutes(mux *http.ServeMux, healthCheckService *user_crud_svc.HealthCheckService, authService authapi.AuthService, userCRUDService *user_crud_svc.UserCRUDService,
 	userSecretStore user_secrets.UserSecretProvider, hostServerProvider host_servers.HostServerProvider, sshKeyProvider ssh_key_provider.SshKeySecretProvider, externalAppsService external_applications.ExternalApplications, swaggerSpec []byte, sshConnectionManager *ssh_connections.SSHConnectionManager) {
-	mux.Handle("/renew", cors.CORSWithPOST(authapi.AuthMiddleware(cert_renew.Renewcert_renew())))
+	// Renewals decrypt the ACME account secret they name, so they need the same permission
+	// as reading a secret's plaintext.
+	mux.Handle("/renew", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "ReadSecretPlaintext", cert_renew.Renewcert_renew(userSecretStore))))
 	mux.Handle("/login", cors.CORSWithPOST(authapi.LoginHandler(authService)))
 	mux.Handle("/dbhealth", cors.CORSWithGET(healthCheckService.DbReadHealthCheckHandler()))
 	mux.Handle("/token/verify", cors.CORSWithPOST(authapi.VerifyTokenHandler(authService)))
 	mux.Handle("/token/refresh", cors.CORSWithPOST(authapi.RefreshAccessTokensHandler(authService)))
+	mux.Handle("/token/revoke", cors.CORSWithPOST(authapi.RevokeRefreshTokenHandler(authService)))
+	mux.Handle("/login/mfa", cors.CORSWithPOST(authapi.LoginMfaHandler(authService)))
+	mux.Handle("/logout", cors.CORSWithPOST(authapi.LogoutHandler(authService)))
+	mux.Handle("/.well-known/jwks.json", cors.CORSWithGET(authapi.JwksHandler()))
 	mux.Handle("/create/user", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "CreateUser", userapi.CreateUserHandler(userCRUDService))))
 	mux.Handle("/update/userpass", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "AlterUser", userapi.UpdateUserPasswordHandler(userCRUDService))))
 	mux.Handle("/user/enable", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "AlterUser", userapi.EnableUserHandler(userCRUDService))))
 	mux.Handle("/user/disable", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "AlterUser", userapi.DisableUserHandler(userCRUDService))))
+	mux.Handle("/user/unlock", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "AlterUser", userapi.UnlockUserHandler(userCRUDService))))
 	mux.Handle("/user/delete", cors.CORSWithDELETE(authapi.AuthMiddlewareRequirePermission(authService, "DeleteUser", userapi.SoftDeleteUserHandler(userCRUDService))))
 	mux.Handle("/user/role", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "AlterUser", userapi.UpdateUserRoleMappingHandler(userCRUDService))))
 	mux.Handle("/user/role/remove", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "AlterUser", userapi.DisableUserRoleMappingHandler(userCRUDService))))
@@ -62,12 +193,7 @@ func AddApplicationRoutes(mux *http.ServeMux, healthCheckService *user_crud_svc.
 	mux.Handle("/permissions", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "ReadPermissions", userapi.GetAllAppPermissionsHandler(userCRUDService))))
 	mux.Handle("/users", cors.CORSWithGET(authapi.AuthMiddleware(userapi.GetAllUsersHandler(userCRUDService))))
 	mux.Handle("/healthCheck", cors.CORSWithGET(http.HandlerFunc(authapi.HealthCheckHandler)))
-	mux.Handle("/secrets/create", cors.CORSWithPOST(user_secrets.CreateSecretHandler(userSecretStore)))
-	mux.Handle("/secrets/{ID}", cors.CORSWithGET(user_secrets.GetSecretHandler(userSecretStore)))
-	mux.Handle("/user/secrets/{USERID}", cors.CORSWithGET(user_secrets.GetUserSecretEntriesByIdHandler(userSecretStore)))
-	mux.Handle("/user/{APPID}/secrets/{USERID}", cors.CORSWithGET(user_secrets.GetUserSecretEntriesByAppIdHandler(userSecretStore)))
-	mux.Handle("/user/secrets/by-name/{APPNAME}/{USERID}", cors.CORSWithGET(user_secrets.GetUserSecretEntriesByAppNameHandler(userSecretStore)))
-	mux.Handle("/secrets/delete/{ID}", cors.CORSWithDELETE(user_secrets.DeleteSecretHandler(userSecretStore)))
+	SetupSecretRoutes(mux, userSecretStore, authService)
 	mux.Handle("/authhealthCheck", cors.CORSWithGET(authapi.AuthMiddleware(http.HandlerFunc(authapi.HealthCheckHandler))))
 	mux.Handle("/metrics", promhttp.Handler())
 
@@ -77,7 +203,7 @@ func AddApplicationRoutes(mux *http.ServeMux, healthCheckService *user_crud_svc.
 		hostServerByIDHandler(hostServerProvider, authService),
 		http.MethodGet, http.MethodPut, http.MethodDelete,
 	))
-	mux.Handle("/host-servers", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "ReadHostServers", host_servers.GetAllHostServersHandler(hostServerProvider))))
+	mux.Handle("/host-servers", cors.CORSWithGET(authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadHostServers", "", host_servers.GetAllHostServersHandler(hostServerProvider))))
 
 	// Host server types and platform types routes
 	mux.Handle("/host-server-types", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "ReadHostServers", host_servers.GetAllHostServerTypesHandler(hostServerProvider))))
@@ -91,18 +217,18 @@ func AddApplicationRoutes(mux *http.ServeMux, healthCheckService *user_crud_svc.
 	mux.Handle("/ssh-keys/user/{userId}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "ReadSshKeys", ssh_key_provider.GetSshKeysByUserIdHandler(sshKeyProvider))))
 
 	// SSH key host mapping routes
-	mux.Handle("/ssh-key-host-mappings/create", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "ManageSshKeys", ssh_key_provider.CreateSshKeyHostMappingHandler(sshKeyProvider))))
+	mux.Handle("/ssh-key-host-mappings/create", cors.CORSWithPOST(authapi.AuthMiddlewareRequireResourcePermission(authService, "ManageSshKeys", "", ssh_key_provider.CreateSshKeyHostMappingHandler(sshKeyProvider))))
 	mux.Handle("/ssh-key-host-mappings/{id}", cors.CORSWithMethods(
 		ssh_key_provider.SshKeyHostMappingByIDHandler(sshKeyProvider, authService),
 		http.MethodGet, http.MethodPut, http.MethodDelete,
 	))
-	mux.Handle("/ssh-key-host-mappings/user/{userId}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "ReadSshKeys", ssh_key_provider.GetSshKeyHostMappingsByUserIdHandler(sshKeyProvider))))
-	mux.Handle("/ssh-key-host-mappings/host/{hostId}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "ReadSshKeys", ssh_key_provider.GetSshKeyHostMappingsByHostIdHandler(sshKeyProvider))))
-	mux.Handle("/ssh-key-host-mappings/key/{keyId}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "ReadSshKeys", ssh_key_provider.GetSshKeyHostMappingsByKeyIdHandler(sshKeyProvider))))
+	mux.Handle("/ssh-key-host-mappings/user/{userId}", cors.CORSWithGET(authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadSshKeys", "", ssh_key_provider.GetSshKeyHostMappingsByUserIdHandler(sshKeyProvider))))
+	mux.Handle("/ssh-key-host-mappings/host/{hostId}", cors.CORSWithGET(authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadSshKeys", "hostId", ssh_key_provider.GetSshKeyHostMappingsByHostIdHandler(sshKeyProvider))))
+	mux.Handle("/ssh-key-host-mappings/key/{keyId}", cors.CORSWithGET(authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadSshKeys", "", ssh_key_provider.GetSshKeyHostMappingsByKeyIdHandler(sshKeyProvider))))
 
 	// SSH connection routes
 	if sshConnectionManager != nil {
-		mux.Handle("POST /ssh/connect", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, "SshConnect", http.HandlerFunc(sshConnectionManager.CreateSSHConnectionHandler))))
+		mux.Handle("POST /ssh/connect", cors.CORSWithPOST(authapi.AuthMiddlewareRequireResourcePermission(authService, "SshConnect", "", http.HandlerFunc(sshConnectionManager.CreateSSHConnectionHandler))))
 		mux.Handle("DELETE /ssh/connect/{CONNID}", cors.CORSWithDELETE(authapi.AuthMiddlewareRequirePermission(authService, "SshConnect", http.HandlerFunc(sshConnectionManager.CloseSSHConnectionHandler))))
 		mux.Handle("GET /ssh/websocket/{CONNID}", http.HandlerFunc(sshConnectionManager.SSHWebSocketHandler))
 		mux.Handle("GET /ssh/sessions", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, "SshConnect", http.HandlerFunc(sshConnectionManager.ListActiveSessionsHandler))))
@@ -135,6 +261,36 @@ func AddApplicationRoutes(mux *http.ServeMux, healthCheckService *user_crud_svc.
 	SetupNetworkPingerRoutes(mux, hostServerProvider, authService)
 }
 
+// SetupSecretRoutes registers the secrets API. Every route that changes a secret, its
+// versions or its grants requires ManageSecrets.
+func SetupSecretRoutes(router *http.ServeMux, userSecretStore user_secrets.UserSecretProvider, authService authapi.AuthService) {
+	router.Handle("/secrets/create", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ManageSecretsPermission, user_secrets.CreateSecretHandler(userSecretStore))))
+	router.Handle("/secrets/expiring", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ReadSecretMetadataPermission, user_secrets.GetExpiringSecretsHandler(userSecretStore))))
+	router.Handle("/secrets/{ID}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ReadSecretPlaintextPermission, user_secrets.GetSecretHandler(userSecretStore))))
+	router.Handle("/user/secrets/{USERID}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ReadSecretMetadataPermission, user_secrets.GetUserSecretEntriesByIdHandler(userSecretStore))))
+	router.Handle("/user/{APPID}/secrets/{USERID}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ReadSecretMetadataPermission, user_secrets.GetUserSecretEntriesByAppIdHandler(userSecretStore))))
+	router.Handle("/user/secrets/by-name/{APPNAME}/{USERID}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ReadSecretMetadataPermission, user_secrets.GetUserSecretEntriesByAppNameHandler(userSecretStore))))
+	router.Handle("/secrets/delete/{ID}", cors.CORSWithDELETE(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ManageSecretsPermission, user_secrets.DeleteSecretHandler(userSecretStore))))
+	router.Handle("/secrets/versions/{ID}", cors.CORSWithMethods(
+		user_secrets.SecretVersionsHandler(userSecretStore, authService),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/secrets/versions/{ID}/{VERSION}", cors.CORSWithMethods(
+		user_secrets.SecretVersionByNumberHandler(userSecretStore, authService),
+		http.MethodGet, http.MethodDelete,
+	))
+	router.Handle("/secrets/rollback/{ID}", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ManageSecretsPermission, user_secrets.RollbackSecretHandler(userSecretStore))))
+	router.Handle("/secrets/grants/{ID}", cors.CORSWithMethods(
+		user_secrets.SecretGrantsHandler(userSecretStore, authService),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/secrets/grants/{ID}/{GRANTID}", cors.CORSWithDELETE(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ManageSecretsPermission, user_secrets.RevokeSecretGrantHandler(userSecretStore))))
+	router.Handle("/secrets/types", cors.CORSWithGET(user_secrets.GetSecretSchemasHandler()))
+	router.Handle("/secrets/typed/create", cors.CORSWithPOST(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ManageSecretsPermission, user_secrets.CreateTypedSecretHandler(userSecretStore))))
+	router.Handle("/secrets/typed/{ID}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ReadSecretPlaintextPermission, user_secrets.GetTypedSecretHandler(userSecretStore))))
+	router.Handle("/secrets/typed/{ID}/{FIELD}", cors.CORSWithGET(authapi.AuthMiddlewareRequirePermission(authService, user_secrets.ReadSecretPlaintextPermission, user_secrets.GetSecretFieldHandler(userSecretStore))))
+}
+
 // SetupNetworkPingerRoutes sets up all the network pinger routes
 func SetupNetworkPingerRoutes(
 	router *http.ServeMux,
@@ -171,6 +327,127 @@ func SetupNetworkPingerRoutes(
 		authapi.AuthMiddlewareRequirePermission(authService, "NetworkPing", node_networking.ProbeUDPGetHandler(pinger)))
 }
 
+// SetupMfaRoutes sets up the TOTP enrollment and recovery code routes
+func SetupMfaRoutes(router *http.ServeMux, mfaProvider user_mfa.MfaProvider) {
+	router.Handle("/mfa/totp/enroll", cors.CORSWithPOST(user_mfa.EnrollTotpHandler(mfaProvider)))
+	router.Handle("/mfa/totp/verify", cors.CORSWithPOST(user_mfa.ConfirmTotpHandler(mfaProvider)))
+	router.Handle("/mfa/totp/disable", cors.CORSWithPOST(user_mfa.DisableTotpHandler(mfaProvider)))
+	router.Handle("/mfa/recovery-codes", cors.CORSWithPOST(user_mfa.RegenerateRecoveryCodesHandler(mfaProvider)))
+	router.Handle("/mfa/status", cors.CORSWithGET(user_mfa.GetMfaStatusHandler(mfaProvider)))
+}
+
+// SetupWebAuthnRoutes sets up passkey registration and login routes
+func SetupWebAuthnRoutes(router *http.ServeMux, webAuthnProvider webauthn.WebAuthnProvider, authService authapi.AuthService) {
+	router.Handle("/webauthn/register/begin", cors.CORSWithPOST(webauthn.BeginRegistrationHandler(webAuthnProvider)))
+	router.Handle("/webauthn/register/finish", cors.CORSWithPOST(webauthn.FinishRegistrationHandler(webAuthnProvider)))
+	router.Handle("/webauthn/credentials", cors.CORSWithGET(webauthn.GetCredentialsHandler(webAuthnProvider)))
+	router.Handle("/webauthn/credentials/{ID}", cors.CORSWithDELETE(webauthn.DeleteCredentialHandler(webAuthnProvider)))
+	router.Handle("/login/webauthn/begin", cors.CORSWithPOST(webauthn.BeginLoginHandler(webAuthnProvider)))
+	router.Handle("/login/webauthn/finish", cors.CORSWithPOST(webauthn.FinishLoginHandler(webAuthnProvider, authService)))
+}
+
+// SetupOidcRoutes sets up the OIDC single sign-on routes
+func SetupOidcRoutes(router *http.ServeMux, oidcProvider oidc_auth.OidcLoginProvider, postLoginRedirect string) {
+	router.Handle("/auth/oidc/login", cors.CORSWithGET(oidc_auth.OidcLoginHandler(oidcProvider)))
+	router.Handle("/auth/oidc/callback", cors.CORSWithGET(oidc_auth.OidcCallbackHandler(oidcProvider, postLoginRedirect)))
+}
+
+// SetupApiTokenRoutes sets up the personal access token management routes
+func SetupApiTokenRoutes(router *http.ServeMux, apiTokenProvider api_tokens.ApiTokenProvider) {
+	router.Handle("/api-tokens", cors.CORSWithMethods(
+		api_tokens.ApiTokensHandler(apiTokenProvider),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/api-tokens/{ID}", cors.CORSWithDELETE(api_tokens.RevokeApiTokenHandler(apiTokenProvider)))
+}
+
+// SetupUserVerificationRoutes sets up the self-service password reset and email verification routes
+func SetupUserVerificationRoutes(router *http.ServeMux, provider user_verification.UserVerificationProvider, userService *user_crud_svc.UserCRUDService) {
+	router.Handle("/password/forgot", cors.CORSWithPOST(user_verification.ForgotPasswordHandler(provider)))
+	router.Handle("/password/reset", cors.CORSWithPOST(user_verification.ResetPasswordHandler(provider)))
+	router.Handle("/email/verify", cors.CORSWithPOST(user_verification.VerifyEmailHandler(provider)))
+	router.Handle("/email/verify/send", cors.CORSWithPOST(user_verification.SendEmailVerificationHandler(provider, userService)))
+	router.Handle("/email/verify/status", cors.CORSWithGET(user_verification.EmailVerificationStatusHandler(provider, userService)))
+}
+
+// SetupAuditLogRoutes sets up the audit log query and verification routes
+func SetupAuditLogRoutes(router *http.ServeMux, auditLog audit_log.AuditLogReader, authService authapi.AuthService) {
+	router.Handle("/audit", cors.CORSWithGET(
+		authapi.AuthMiddlewareRequirePermission(authService, "ReadAuditLog", audit_log.ListAuditLogHandler(auditLog))))
+	router.Handle("/audit/verify", cors.CORSWithGET(
+		authapi.AuthMiddlewareRequirePermission(authService, "ReadAuditLog", audit_log.VerifyAuditLogHandler(auditLog))))
+}
+
+// SetupResourcePolicyRoutes sets up the permission scope and host server tag routes
+func SetupResourcePolicyRoutes(router *http.ServeMux, manager resource_policy.ScopeManager, authService authapi.AuthService) {
+	router.Handle("/roles/{ID}/permission-scopes", cors.CORSWithMethods(
+		rolePermissionScopesHandler(manager, authService),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/roles/{ID}/permission-scopes/{scopeId}", cors.CORSWithDELETE(
+		authapi.AuthMiddlewareRequirePermission(authService, "AlterRole", resource_policy.RemoveRoleScopeHandler(manager))))
+	router.Handle("/host-servers/{ID}/tags", cors.CORSWithMethods(
+		hostServerTagsHandler(manager, authService),
+		http.MethodGet, http.MethodPut,
+	))
+}
+
+// SetupRbacSyncRoutes sets up the declarative role and permission sync route
+func SetupRbacSyncRoutes(router *http.ServeMux, syncer rbac_sync.RbacSyncer, authService authapi.AuthService) {
+	router.Handle("/rbac/sync", cors.CORSWithPOST(
+		authapi.AuthMiddlewareRequirePermission(authService, "SyncRbac", rbac_sync.SyncRbacHandler(syncer))))
+}
+
+// SetupOrganizationRoutes sets up organization management and the caller's organization switch routes
+func SetupOrganizationRoutes(router *http.ServeMux, manager organizations.OrganizationManager, authService authapi.AuthService) {
+	router.Handle("/organizations", cors.CORSWithMethods(
+		organizationsHandler(manager, authService),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/organizations/{ID}", cors.CORSWithMethods(
+		organizationByIDHandler(manager, authService),
+		http.MethodGet, http.MethodDelete,
+	))
+	router.Handle("/organizations/{ID}/members", cors.CORSWithMethods(
+		organizationMembersHandler(manager, authService),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/organizations/{ID}/members/{userId}", cors.CORSWithDELETE(
+		authapi.AuthMiddlewareRequirePermission(authService, "ManageOrganizations", organizations.RemoveMemberHandler(manager))))
+	router.Handle("/organizations/{ID}/members/{userId}/roles", cors.CORSWithPOST(
+		authapi.AuthMiddlewareRequirePermission(authService, "ManageOrganizations", organizations.AddMemberRoleHandler(manager))))
+	router.Handle("/organizations/{ID}/members/{userId}/roles/{roleId}", cors.CORSWithDELETE(
+		authapi.AuthMiddlewareRequirePermission(authService, "ManageOrganizations", organizations.RemoveMemberRoleHandler(manager))))
+	router.Handle("/auth/organizations", cors.CORSWithGET(authapi.MyOrganizationsHandler(manager)))
+	router.Handle("/auth/organizations/switch", cors.CORSWithPOST(authapi.SwitchOrganizationHandler(authService)))
+}
+
+// SetupUserGroupRoutes sets up user group management and effective permission routes
+func SetupUserGroupRoutes(router *http.ServeMux, manager user_groups.UserGroupManager, authService authapi.AuthService) {
+	router.Handle("/user-groups", cors.CORSWithMethods(
+		userGroupsHandler(manager, authService),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/user-groups/{ID}", cors.CORSWithMethods(
+		userGroupByIDHandler(manager, authService),
+		http.MethodGet, http.MethodPut, http.MethodDelete,
+	))
+	router.Handle("/user-groups/{ID}/members", cors.CORSWithMethods(
+		userGroupMembersHandler(manager, authService),
+		http.MethodGet, http.MethodPost,
+	))
+	router.Handle("/user-groups/{ID}/members/{userId}", cors.CORSWithDELETE(
+		authapi.AuthMiddlewareRequirePermission(authService, "ManageUserGroups", user_groups.RemoveGroupMemberHandler(manager))))
+	router.Handle("/user-groups/{ID}/roles", cors.CORSWithPOST(
+		authapi.AuthMiddlewareRequirePermission(authService, "ManageUserGroups", user_groups.AddGroupRoleHandler(manager))))
+	router.Handle("/user-groups/{ID}/roles/{roleId}", cors.CORSWithDELETE(
+		authapi.AuthMiddlewareRequirePermission(authService, "ManageUserGroups", user_groups.RemoveGroupRoleHandler(manager))))
+	router.Handle("/users/{ID}/groups", cors.CORSWithGET(
+		authapi.AuthMiddlewareRequirePermission(authService, "ReadUserGroups", user_groups.GetGroupsOfUserHandler(manager))))
+	router.Handle("/users/{ID}/effective-permissions", cors.CORSWithGET(
+		authapi.AuthMiddlewareRequirePermission(authService, "ReadUsers", user_groups.GetEffectivePermissionsHandler(manager))))
+}
+
 func (api *APIServer) StartAPIServices(srvadr *string) error {
 	mux := http.NewServeMux()
 	wsListenAddr := os.Getenv("WS_LISTEN_ADDR")
@@ -179,6 +456,36 @@ func (api *APIServer) StartAPIServices(srvadr *string) error {
 		wsListenAddr = ":8090"
 	}
 	AddApplicationRoutes(mux, api.HealthCheckService, api.AuthService, api.UserCRUDService, api.UserSecretsStoreService, api.HostServerProvider, api.SshKeyProvider, api.ExternalAppsService, api.SwaggerSpec, api.SSHConnectionManager)
+	if api.MfaProvider != nil {
+		SetupMfaRoutes(mux, api.MfaProvider)
+	}
+	if api.WebAuthnProvider != nil {
+		SetupWebAuthnRoutes(mux, api.WebAuthnProvider, api.AuthService)
+	}
+	if api.OidcProvider != nil {
+		SetupOidcRoutes(mux, api.OidcProvider, api.OidcPostLoginRedirect)
+	}
+	if api.ApiTokenProvider != nil {
+		SetupApiTokenRoutes(mux, api.ApiTokenProvider)
+	}
+	if api.UserVerification != nil {
+		SetupUserVerificationRoutes(mux, api.UserVerification, api.UserCRUDService)
+	}
+	if api.AuditLog != nil {
+		SetupAuditLogRoutes(mux, api.AuditLog, api.AuthService)
+	}
+	if api.ResourcePolicy != nil {
+		SetupResourcePolicyRoutes(mux, api.ResourcePolicy, api.AuthService)
+	}
+	if api.RbacSync != nil {
+		SetupRbacSyncRoutes(mux, api.RbacSync, api.AuthService)
+	}
+	if api.Organizations != nil {
+		SetupOrganizationRoutes(mux, api.Organizations, api.AuthService)
+	}
+	if api.UserGroups != nil {
+		SetupUserGroupRoutes(mux, api.UserGroups, api.AuthService)
+	}
 
 	// Start a dedicated WebSocket server on :8090 with no middleware for /ssh/websocket/{connectionId}
 	go func() {
@@ -195,7 +502,8 @@ func (api *APIServer) StartAPIServices(srvadr *string) error {
 		}
 	}()
 
-	handlerChain := middleware.RecoverMiddleware(requestLoggingMiddleware(cors.HandleCORSPreflightMiddleware(mux)))
+	auditMiddleware := audit_log.Middleware(authapi.ClientIP)
+	handlerChain := middleware.RecoverMiddleware(auditMiddleware(requestLoggingMiddleware(cors.HandleCORSPreflightMiddleware(mux))))
 
 	switch {
 	case api.UseSsl:
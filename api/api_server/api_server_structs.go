@@ -2,12 +2,22 @@ package api_server
 
 import (
 	authapi "github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/services/api_tokens"
+	"github.com/babbage88/go-infra/services/audit_log"
 	"github.com/babbage88/go-infra/services/external_applications"
 	"github.com/babbage88/go-infra/services/host_servers"
+	"github.com/babbage88/go-infra/services/oidc_auth"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/rbac_sync"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/babbage88/go-infra/services/ssh_connections"
 	"github.com/babbage88/go-infra/services/ssh_key_provider"
 	"github.com/babbage88/go-infra/services/user_crud_svc"
+	"github.com/babbage88/go-infra/services/user_groups"
+	"github.com/babbage88/go-infra/services/user_mfa"
 	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/babbage88/go-infra/services/user_verification"
+	"github.com/babbage88/go-infra/services/webauthn"
 )
 
 // APIServer represents the API server configuration
@@ -20,6 +30,17 @@ type APIServer struct {
 	SshKeyProvider          ssh_key_provider.SshKeySecretProvider
 	ExternalAppsService     external_applications.ExternalApplications
 	SSHConnectionManager    *ssh_connections.SSHConnectionManager
+	MfaProvider             user_mfa.MfaProvider
+	WebAuthnProvider        webauthn.WebAuthnProvider
+	OidcProvider            oidc_auth.OidcLoginProvider
+	OidcPostLoginRedirect   string
+	ApiTokenProvider        api_tokens.ApiTokenProvider
+	UserVerification        user_verification.UserVerificationProvider
+	AuditLog                audit_log.AuditLogReader
+	ResourcePolicy          resource_policy.ScopeManager
+	RbacSync                rbac_sync.RbacSyncer
+	Organizations           organizations.OrganizationManager
+	UserGroups              user_groups.UserGroupManager
 	UseSsl                  bool
 	Certificate             string
 	CertKey                 string
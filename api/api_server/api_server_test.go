@@ -0,0 +1,78 @@
+package api_server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	authapi "github.com/babbage88/go-infra/api/authapi"
+	"github.com/google/uuid"
+)
+
+// denyAllRoles refuses every permission so only the route wrapping decides the outcome.
+type denyAllRoles struct {
+	authapi.AuthService
+}
+
+func (denyAllRoles) VerifyUserRolesForPermission(roleIds uuid.UUIDs, permissionName string) (bool, error) {
+	return false, nil
+}
+
+func TestSecretWritesRequireManageSecrets(t *testing.T) {
+	authapi.SetKeyRing(nil)
+
+	token, err := authapi.NewAccessTokenWithExp(uuid.New(), uuid.UUIDs{uuid.New()}, "user@example.com", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	SetupSecretRoutes(mux, nil, denyAllRoles{})
+
+	secretId := uuid.New().String()
+	writes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/secrets/create"},
+		{http.MethodDelete, "/secrets/delete/" + secretId},
+		{http.MethodPost, "/secrets/typed/create"},
+		{http.MethodPost, "/secrets/rollback/" + secretId},
+		{http.MethodPost, "/secrets/versions/" + secretId},
+		{http.MethodDelete, "/secrets/versions/" + secretId + "/1"},
+		{http.MethodPost, "/secrets/grants/" + secretId},
+		{http.MethodDelete, "/secrets/grants/" + secretId + "/" + uuid.New().String()},
+	}
+	for _, write := range writes {
+		req := httptest.NewRequest(write.method, write.path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		// a valid token must reach the permission check, not fail authentication
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Permission Denied") {
+			t.Errorf("%s %s: expected 401 without ManageSecrets, got %d %s", write.method, write.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRenewRequiresReadSecretPlaintext(t *testing.T) {
+	authapi.SetKeyRing(nil)
+
+	token, err := authapi.NewAccessTokenWithExp(uuid.New(), uuid.UUIDs{uuid.New()}, "user@example.com", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	AddApplicationRoutes(mux, nil, denyAllRoles{}, nil, nil, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/renew", strings.NewReader(`{"domainName":["example.com"]}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Permission Denied") {
+		t.Errorf("expected 401 without ReadSecretPlaintext, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/babbage88/go-infra/services/audit_log"
 )
 
 // statusRecorder wraps http.ResponseWriter to capture the status code
@@ -37,6 +39,7 @@ func requestLoggingMiddleware(next http.Handler) http.Handler {
 			slog.Warn("no route matched",
 				slog.String("path", r.URL.Path),
 				slog.String("method", r.Method),
+				slog.String("requestId", audit_log.RequestIdFromContext(r.Context())),
 				slog.Int("status", recorder.status),
 				slog.Any("duration", duration),
 			)
@@ -44,6 +47,7 @@ func requestLoggingMiddleware(next http.Handler) http.Handler {
 			slog.Info("handled request",
 				slog.String("path", r.URL.Path),
 				slog.String("method", r.Method),
+				slog.String("requestId", audit_log.RequestIdFromContext(r.Context())),
 				slog.Int("status", recorder.status),
 				slog.Any("duration", duration),
 			)
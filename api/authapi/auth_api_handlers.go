@@ -2,10 +2,16 @@ package authapi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/services/token_denylist"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -20,6 +26,7 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 //	200: LocalLoginResponse
 //	400: description:Bad Request
 //	401: description:Unauthorized
+//	429: description:Too Many Requests
 //	500: description:Insernal Server Error
 
 func LoginHandleFunc(auth_svc AuthService) func(w http.ResponseWriter, r *http.Request) {
@@ -29,14 +36,67 @@ func LoginHandleFunc(auth_svc AuthService) func(w http.ResponseWriter, r *http.R
 		// in:body
 		var loginReq *UserLoginRequest
 		json.NewDecoder(r.Body).Decode(&loginReq)
+		if loginReq == nil {
+			http.Error(w, "error parsing request body", http.StatusBadRequest)
+			return
+		}
+
+		clientIp := ClientIP(r)
+		if retryAfter := auth_svc.CheckLoginThrottle(loginReq.UserName, clientIp); retryAfter > 0 {
+			slog.Warn("Login throttled", slog.String("User", loginReq.UserName), slog.String("ClientIp", clientIp))
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second)/time.Second)))
+			http.Error(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+
 		LoginResult := auth_svc.Login(loginReq)
+		// the username counter is only reset once the whole login, including MFA, succeeded
+		if !LoginResult.Result.Success {
+			auth_svc.RecordLoginResult(loginReq.UserName, clientIp, false)
+		}
 
 		if LoginResult.Result.Success {
+			passkeyRequired, err := auth_svc.IsPasskeyRequired(LoginResult.UserInfo.Id, LoginResult.UserInfo.RoleIds)
+			if err != nil {
+				slog.Error("Error checking passkey requirement", slog.String("Error", err.Error()))
+				http.Error(w, "error checking passkey requirement", http.StatusInternalServerError)
+				return
+			}
+			if passkeyRequired {
+				slog.Warn("Password login refused, passkey required", slog.String("User", LoginResult.UserInfo.UserName))
+				http.Error(w, "passkey login is required for this account", http.StatusForbidden)
+				return
+			}
+
+			mfaRequired, err := auth_svc.IsMfaRequired(LoginResult.UserInfo.Id)
+			if err != nil {
+				slog.Error("Error checking mfa status", slog.String("Error", err.Error()))
+				http.Error(w, "error checking mfa status", http.StatusInternalServerError)
+				return
+			}
+			if mfaRequired {
+				challenge, err := auth_svc.CreateMfaChallenge(LoginResult.UserInfo.Id, loginReq.UserName)
+				if err != nil {
+					slog.Error("Error creating mfa challenge", slog.String("Error", err.Error()))
+					http.Error(w, "error creating mfa challenge", http.StatusInternalServerError)
+					return
+				}
+				response := LocalLoginResponse{UserID: LoginResult.UserInfo.Id,
+					Username: LoginResult.UserInfo.UserName, Email: LoginResult.UserInfo.Email,
+					MfaRequired: true, MfaToken: challenge}
+				jsonResponse, _ := json.Marshal(response)
+				w.WriteHeader(http.StatusOK)
+				w.Write(jsonResponse)
+				return
+			}
+
 			token, err := auth_svc.CreateAuthTokenOnLogin(LoginResult.UserInfo.Id, LoginResult.UserInfo.RoleIds, LoginResult.UserInfo.Email)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				slog.Error("Error verifying password", slog.String("Error", err.Error()))
+				return
 			}
+			auth_svc.RecordLoginResult(loginReq.UserName, clientIp, true)
 			response := LocalLoginResponse{UserID: LoginResult.UserInfo.Id,
 				Username: LoginResult.UserInfo.UserName, Email: LoginResult.UserInfo.Email,
 				Token: token.Token, RefreshToken: token.RefreshToken, Expiration: token.Expiration}
@@ -55,6 +115,59 @@ func LoginHandler(auth_svc AuthService) http.Handler {
 	return http.HandlerFunc(LoginHandleFunc(auth_svc))
 }
 
+// swagger:route POST /login/mfa Authentication LoginMfa
+// Complete a login that requires MFA by exchanging the mfaToken returned by /login and a TOTP or recovery code for access tokens.
+// responses:
+//
+//	200: LocalLoginResponse
+//	400: description:Bad Request
+//	401: description:Unauthorized
+//	429: description:Too Many Requests
+func LoginMfaHandleFunc(auth_svc AuthService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mfaReq MfaLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&mfaReq); err != nil {
+			slog.Error("Error parsing mfa login request", slog.String("Error", err.Error()))
+			http.Error(w, "error parsing request body", http.StatusBadRequest)
+			return
+		}
+
+		// failed codes count against the same username and IP as failed passwords
+		username := MfaChallengeUsername(mfaReq.MfaToken)
+		clientIp := ClientIP(r)
+		if retryAfter := auth_svc.CheckLoginThrottle(username, clientIp); retryAfter > 0 {
+			slog.Warn("Mfa login throttled", slog.String("User", username), slog.String("ClientIp", clientIp))
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second)/time.Second)))
+			http.Error(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		token, err := auth_svc.CompleteMfaLogin(mfaReq.MfaToken, mfaReq.Code)
+		auth_svc.RecordLoginResult(username, clientIp, err == nil)
+		if err != nil {
+			slog.Error("Error completing mfa login", slog.String("Error", err.Error()))
+			if errors.Is(err, ErrMfaTooManyAttempts) {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+			http.Error(w, "Invalid mfa code or challenge", http.StatusUnauthorized)
+			return
+		}
+
+		response := LocalLoginResponse{UserID: token.UserID,
+			Username: token.Username, Email: token.Email,
+			Token: token.Token, RefreshToken: token.RefreshToken, Expiration: token.Expiration}
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(response)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonResponse)
+	}
+}
+
+func LoginMfaHandler(auth_svc AuthService) http.Handler {
+	return http.HandlerFunc(LoginMfaHandleFunc(auth_svc))
+}
+
 // swagger:route POST /token/refresh Authentication RefreshAccessToken
 // Refresh accessTokens and return to client.
 // responses:
@@ -70,6 +183,7 @@ func RefreshAccessTokensHandleFunc(ua AuthService) http.HandlerFunc {
 		if err != nil {
 			slog.Error("Error parsing refresh token from request body", slog.String("Error", err.Error()))
 			http.Error(w, "error parsing refresh token from request body", http.StatusBadRequest)
+			return
 		}
 
 		newtokens, err := ua.RefreshAccessToken(refreshReq.RefreshToken)
@@ -77,9 +191,10 @@ func RefreshAccessTokensHandleFunc(ua AuthService) http.HandlerFunc {
 			slog.Error("Error refreshing auth tokens", slog.String("Error", err.Error()))
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write([]byte("Unauthorized, please login."))
+			return
 		}
 		resp := AccessTokenRefreshResponse{AccessToken: newtokens.Token,
-			RefreshToken: refreshReq.RefreshToken,
+			RefreshToken: newtokens.RefreshToken,
 			UserID:       newtokens.UserID,
 			Username:     newtokens.Username,
 			Email:        newtokens.Email,
@@ -88,6 +203,7 @@ func RefreshAccessTokensHandleFunc(ua AuthService) http.HandlerFunc {
 		jsonResponse, err := json.Marshal(resp)
 		if err != nil {
 			http.Error(w, "error marshaling response", http.StatusInternalServerError)
+			return
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -99,6 +215,83 @@ func RefreshAccessTokensHandler(ua AuthService) http.Handler {
 	return http.HandlerFunc(RefreshAccessTokensHandleFunc(ua))
 }
 
+// swagger:route POST /token/revoke Authentication RevokeRefreshToken
+// Revoke a refresh token and every token rotated from the same login.
+// responses:
+//
+//	200: description:Token revoked
+//	400: description:Bad Request
+//	401: description:Unauthorized
+func RevokeRefreshTokenHandleFunc(ua AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var revokeReq TokenRefreshReq
+		if err := json.NewDecoder(r.Body).Decode(&revokeReq); err != nil || revokeReq.RefreshToken == "" {
+			http.Error(w, `{"error":"refreshToken is required"}`, http.StatusBadRequest)
+			return
+		}
+
+		if err := ua.RevokeRefreshToken(revokeReq.RefreshToken); err != nil {
+			slog.Warn("Error revoking refresh token", slog.String("error", err.Error()))
+			http.Error(w, `{"error":"Invalid refresh token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "token revoked"})
+	}
+}
+
+func RevokeRefreshTokenHandler(ua AuthService) http.Handler {
+	return http.HandlerFunc(RevokeRefreshTokenHandleFunc(ua))
+}
+
+// swagger:route POST /logout Authentication Logout
+// End the current session, or every session of the user when allSessions is set.
+// responses:
+//
+//	200: description:Logged out
+//	400: description:Bad Request
+//	401: description:Unauthorized
+func LogoutHandleFunc(ua AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userId, err := GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		var logoutReq LogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&logoutReq); err != nil {
+			http.Error(w, `{"error":"error parsing logout request body"}`, http.StatusBadRequest)
+			return
+		}
+		if !logoutReq.AllSessions && logoutReq.RefreshToken == "" {
+			http.Error(w, `{"error":"refreshToken is required unless allSessions is set"}`, http.StatusBadRequest)
+			return
+		}
+
+		if err := ua.Logout(userId, logoutReq.RefreshToken, logoutReq.AllSessions); err != nil {
+			slog.Warn("Error logging out user", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+			http.Error(w, `{"error":"Invalid refresh token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		// the access token used for this request must stop working as well
+		if claims, ok := r.Context().Value(ClaimsContextKey).(jwt.MapClaims); ok {
+			if err := RevokeAccessTokenFromClaims(r.Context(), claims, token_denylist.ReasonLogout); err != nil {
+				slog.Error("Error revoking access token on logout", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "logged out"})
+	}
+}
+
+func LogoutHandler(ua AuthService) http.Handler {
+	return AuthMiddleware(http.HandlerFunc(LogoutHandleFunc(ua)))
+}
+
 // swagger:route POST /token/verify Authentication VerifyToken
 // Verify a JWT access token's validity.
 // responses:
@@ -135,3 +328,17 @@ func VerifyTokenHandler(auth_svc AuthService) http.Handler {
 		json.NewEncoder(w).Encode(map[string]string{"status": "token valid"})
 	})
 }
+
+// swagger:route GET /.well-known/jwks.json Authentication GetJwks
+// Public keys used to verify go-infra access tokens.
+// responses:
+//
+//	200: JwksResponse
+
+func JwksHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(GetKeyRing().JWKS())
+	})
+}
@@ -2,12 +2,15 @@ package authapi
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -20,10 +23,16 @@ const userIDContextKey = ContextKey("userID")
 
 // AuthMiddleware extracts and validates the JWT and stores claims in context
 func AuthMiddleware(next http.Handler) http.Handler {
+	return authMiddleware(next, false)
+}
+
+// authMiddleware validates the bearer token. Personal access tokens are only accepted
+// when allowPersonalAccessTokens is set, since they are limited to permission scopes.
+func authMiddleware(next http.Handler, allowPersonalAccessTokens bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		claims, err := parseAndValidateToken(r)
+		claims, err := parseAndValidateToken(r, allowPersonalAccessTokens)
 		if err != nil {
 			slog.Error("Unauthorized request", slog.String("error", err.Error()))
 			http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusUnauthorized)
@@ -31,14 +40,22 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
+		if userId, err := GetUserIDFromContext(ctx); err == nil {
+			audit_log.SetActor(ctx, userId)
+		}
+		if organizations.Default() != nil {
+			// tokens without an org_id claim act in no organization and see only shared resources
+			ctx = organizations.WithActiveOrg(ctx, GetActiveOrgFromClaims(claims))
+		}
 		slog.Info("Token has been verified.", slog.String("Path", r.URL.Path))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// AuthMiddlewareRequirePermission adds permission check on top of AuthMiddleware
+// AuthMiddlewareRequirePermission adds permission check on top of AuthMiddleware. It also
+// accepts personal access tokens, which must include permissionName in their scopes.
 func AuthMiddlewareRequirePermission(ua AuthService, permissionName string, next http.Handler) http.Handler {
-	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		claimsVal := r.Context().Value(ClaimsContextKey)
@@ -86,40 +103,77 @@ func AuthMiddlewareRequirePermission(ua AuthService, permissionName string, next
 			return
 		}
 
+		if !scopeAllows(claims, permissionName) {
+			slog.Warn("Permission not in token scopes", slog.String("permission", permissionName))
+			http.Error(w, `{"error": "Permission Denied"}`, http.StatusUnauthorized)
+			return
+		}
+
 		slog.Info("Permission granted", slog.String("permission", permissionName))
+		audit_log.SetPermission(r.Context(), permissionName)
 		next.ServeHTTP(w, r)
+	}), true)
+}
+
+// AuthMiddlewareRequireResourcePermission checks permissionName like
+// AuthMiddlewareRequirePermission, then narrows it with the resource scopes on the caller's
+// roles. When hostServerParam is set, the host server named by that path value must be in
+// scope or the request is denied with 403. The resolved grant is stored in the request
+// context so list handlers can filter what they return.
+func AuthMiddlewareRequireResourcePermission(ua AuthService, permissionName string, hostServerParam string, next http.Handler) http.Handler {
+	return AuthMiddlewareRequirePermission(ua, permissionName, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := resource_policy.Default()
+		if policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		grant, err := policy.GrantFor(ctx, GetRoleIDsFromContext(ctx), permissionName)
+		if err != nil {
+			http.Error(w, `{"error": "Internal Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+
+		if hostServerParam != "" && !grant.Unrestricted {
+			hostServerId, err := uuid.Parse(r.PathValue(hostServerParam))
+			if err != nil {
+				http.Error(w, `{"error": "Invalid host server ID"}`, http.StatusBadRequest)
+				return
+			}
+			resource, err := policy.HostServer(ctx, hostServerId)
+			if err != nil && !errors.Is(err, resource_policy.ErrResourceNotFound) {
+				http.Error(w, `{"error": "Internal Server Error"}`, http.StatusInternalServerError)
+				return
+			}
+			// Unknown ids are denied too, so scoped callers cannot probe for host servers.
+			if err != nil || !grant.Allows(resource) {
+				slog.Warn("Host server outside permission scope",
+					slog.String("permission", permissionName),
+					slog.String("hostServerId", hostServerId.String()))
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(resource_policy.WithGrant(ctx, grant)))
 	}))
 }
 
 // parseAndValidateToken extracts the token from the request and returns the claims if valid
-func parseAndValidateToken(r *http.Request) (jwt.MapClaims, error) {
+func parseAndValidateToken(r *http.Request, allowPersonalAccessTokens bool) (jwt.MapClaims, error) {
 	authHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authHeader, "Bearer ") {
 		return nil, fmt.Errorf("missing or malformed Authorization header")
 	}
 	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
 
-	secret := os.Getenv("JWT_KEY")
-	if secret == "" {
-		return nil, fmt.Errorf("JWT_KEY environment variable is not set")
-	}
-
-	token, err := jwt.Parse(jwtToken, func(token *jwt.Token) (interface{}, error) {
-		// Only HMAC signing methods are supported
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	if IsPersonalAccessToken(jwtToken) {
+		if !allowPersonalAccessTokens {
+			return nil, ErrPersonalAccessTokenNotAllowed
 		}
-		return []byte(secret), nil
-	})
-
-	if err != nil || !token.Valid {
-		return nil, fmt.Errorf("invalid token: %v", err)
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
+		return validatePersonalAccessToken(r.Context(), jwtToken)
 	}
 
-	return claims, nil
+	return ValidateAccessToken(jwtToken)
 }
@@ -3,6 +3,7 @@ package authapi
 import (
 	"time"
 
+	"github.com/babbage88/go-infra/services/organizations"
 	"github.com/babbage88/go-infra/services/user_crud_svc"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -33,6 +34,57 @@ type TokenRefreshReq struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
+// swagger:parameters RevokeRefreshToken
+type RevokeRefreshTokenRequestWrapper struct {
+	// in: body
+	Body TokenRefreshReq `json:"body"`
+}
+
+// swagger:parameters Logout
+type LogoutRequestWrapper struct {
+	// in: body
+	Body LogoutRequest `json:"body"`
+}
+
+// swagger:model LogoutRequest
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+	AllSessions  bool   `json:"allSessions"`
+}
+
+// swagger:parameters SwitchOrganization
+type SwitchOrganizationRequestWrapper struct {
+	// in: body
+	Body SwitchOrganizationRequest `json:"body"`
+}
+
+// swagger:model SwitchOrganizationRequest
+type SwitchOrganizationRequest struct {
+	OrganizationId uuid.UUID `json:"organizationId"`
+	// Refresh token of the session being left, optional
+	RefreshToken string `json:"refreshToken"`
+}
+
+// swagger:response SwitchOrganizationResponse
+type SwitchOrganizationResponseWrapper struct {
+	// in: body
+	Body AuthToken `json:"body"`
+}
+
+// MyOrganizations lists the organizations of the caller.
+//
+// swagger:model MyOrganizations
+type MyOrganizations struct {
+	ActiveOrganizationId uuid.UUID                    `json:"activeOrganizationId"`
+	Organizations        []organizations.Organization `json:"organizations"`
+}
+
+// swagger:response MyOrganizationsResponse
+type MyOrganizationsResponseWrapper struct {
+	// in: body
+	Body MyOrganizations `json:"body"`
+}
+
 // swagger:response RefreshAccessTokenResponse
 type TokenRefreshResponseWrapper struct {
 	// in: body
@@ -73,6 +125,20 @@ type LocalLoginResponse struct {
 	Token        string    `json:"accessToken"`
 	RefreshToken string    `json:"refreshToken"`
 	Expiration   time.Time `json:"expiration"`
+	MfaRequired  bool      `json:"mfaRequired,omitempty"`
+	MfaToken     string    `json:"mfaToken,omitempty"`
+}
+
+// swagger:parameters LoginMfa
+type MfaLoginRequestWrapper struct {
+	// in: body
+	Body MfaLoginRequest `json:"body"`
+}
+
+// swagger:model MfaLoginRequest
+type MfaLoginRequest struct {
+	MfaToken string `json:"mfaToken"`
+	Code     string `json:"code"`
 }
 
 type UserLoginResponse struct {
@@ -95,9 +161,17 @@ type AuthToken struct {
 	Token        string    `json:"accessToken"`
 	RefreshToken string    `json:"refreshToken"`
 	Expiration   time.Time `json:"expiration"`
+	// Active organization of the session, the nil uuid when the user belongs to none
+	OrganizationId uuid.UUID `json:"organizationId"`
 }
 
 type UserPermission struct {
 	Id   uuid.UUID `json:"id"`
 	Name string    `json:"name"`
 }
+
+// swagger:response JwksResponse
+type JwksResponseWrapper struct {
+	// in: body
+	Body JSONWebKeySet `json:"body"`
+}
@@ -1,17 +1,15 @@
 package authapi
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"github.com/babbage88/go-infra/internal/hashing"
 )
 
-// HashPassword generates a bcrypt hash for the given password.
+// HashPassword generates an Argon2id hash for the given password.
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	return hashing.HashPassword(password)
 }
 
-// VerifyPassword verifies if the given password matches the stored hash.
+// VerifyPassword verifies if the given password matches the stored Argon2id or bcrypt hash.
 func VerifyPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return hashing.VerifyPassword(password, hash)
 }
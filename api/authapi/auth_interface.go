@@ -1,6 +1,8 @@
 package authapi
 
 import (
+	"time"
+
 	"github.com/babbage88/go-infra/services/user_crud_svc"
 	"github.com/google/uuid"
 )
@@ -14,5 +16,14 @@ type AuthService interface {
 	VerifyUserRolesForPermission(roleIds uuid.UUIDs, permissionName string) (bool, error)
 	VerifyUserPermissionByRole(roleId uuid.UUID, permissionName string) (bool, error)
 	RefreshAccessToken(refreshToken string) (AuthToken, error)
+	SwitchOrganization(userId uuid.UUID, orgId uuid.UUID) (AuthToken, error)
+	RevokeRefreshToken(refreshToken string) error
+	Logout(userId uuid.UUID, refreshToken string, allSessions bool) error
 	GetUserById(id uuid.UUID) (*user_crud_svc.UserDao, error)
+	IsMfaRequired(userId uuid.UUID) (bool, error)
+	CreateMfaChallenge(userId uuid.UUID, username string) (string, error)
+	CompleteMfaLogin(challengeToken string, code string) (AuthToken, error)
+	IsPasskeyRequired(userId uuid.UUID, roleIds uuid.UUIDs) (bool, error)
+	CheckLoginThrottle(username string, clientIp string) time.Duration
+	RecordLoginResult(username string, clientIp string, success bool)
 }
@@ -11,48 +11,72 @@ import (
 
 	"github.com/babbage88/go-infra/database/infra_db_pg"
 	"github.com/babbage88/go-infra/internal/type_helper"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/token_denylist"
 	"github.com/babbage88/go-infra/services/user_crud_svc"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func NewAccessTokenWithExp(id uuid.UUID, roleIds uuid.UUIDs, email string, signingMethod jwt.SigningMethod, expTime time.Time) (string, error) {
-	// Create token
-	token := jwt.New(signingMethod)
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserDisabled = errors.New("user is disabled or deleted")
+)
+
+// NewAccessTokenWithExp signs an access token that does not act in an organization.
+func NewAccessTokenWithExp(id uuid.UUID, roleIds uuid.UUIDs, email string, expTime time.Time) (string, error) {
+	return NewOrgAccessTokenWithExp(id, roleIds, email, uuid.Nil, expTime)
+}
 
-	claims := token.Claims.(jwt.MapClaims)
+// NewOrgAccessTokenWithExp signs an access token with a unique jti. A non nil orgId is the
+// active organization, sent in the org_id claim. When a token denylist is configured the
+// jti is recorded so the token can be revoked before it expires.
+func NewOrgAccessTokenWithExp(id uuid.UUID, roleIds uuid.UUIDs, email string, orgId uuid.UUID, expTime time.Time) (string, error) {
+	jti := uuid.New()
+	claims := jwt.MapClaims{}
 	claims["sub"] = id
+	claims["jti"] = jti
 	claims["name"] = email
 	claims["role_ids"] = roleIds
+	if orgId != uuid.Nil {
+		claims[orgIdClaim] = orgId
+	}
+	claims["iat"] = time.Now().Unix()
 	claims["exp"] = expTime.Unix()
 
-	t, err := token.SignedString([]byte(os.Getenv("JWT_KEY")))
+	t, err := GetKeyRing().Sign(claims)
 	if err != nil {
 		return "", err
 	}
 
-	return t, err
-}
+	if denylist := token_denylist.Default(); denylist != nil {
+		if err := denylist.RecordIssued(context.Background(), jti, id, expTime); err != nil {
+			return "", err
+		}
+	}
 
-func NewRefreshTokenWithExp(id uuid.UUID, signingMethod jwt.SigningMethod, expTime time.Time) (string, error) {
-	refreshToken := jwt.New(signingMethod)
+	return t, nil
+}
 
-	rtClaims := refreshToken.Claims.(jwt.MapClaims)
+// NewRefreshTokenWithExp signs a refresh token. tokenId is the jti of the stored refresh token
+// record and familyId links every token rotated from the same login.
+func NewRefreshTokenWithExp(id uuid.UUID, familyId uuid.UUID, tokenId uuid.UUID, expTime time.Time) (string, error) {
+	rtClaims := jwt.MapClaims{}
 	rtClaims["sub"] = id
+	rtClaims["jti"] = tokenId
+	rtClaims["fam"] = familyId
+	rtClaims["typ"] = refreshTokenType
 	rtClaims["exp"] = expTime.Unix()
 
-	rt, err := refreshToken.SignedString([]byte(os.Getenv("JWT_KEY")))
-	if err != nil {
-		return "", err
-	}
+	return GetKeyRing().Sign(rtClaims)
+}
 
-	return rt, err
+func NewAccessToken(id uuid.UUID, roleIds uuid.UUIDs, email string) (string, error) {
+	return NewAccessTokenWithExp(id, roleIds, email, accessTokenExpiration())
 }
 
-func NewAccessToken(id uuid.UUID, roleIds uuid.UUIDs, email string, signingMethod jwt.SigningMethod) (string, error) {
-	// Create token
+func accessTokenExpiration() time.Time {
 	var expireMinutes int64
-	token := jwt.New(signingMethod)
 	envExp := os.Getenv("EXPIRATION_MINUTES")
 	expireMinutesInt, err := type_helper.ParseIntegerFromString[int64](envExp)
 	if err != nil {
@@ -61,53 +85,109 @@ func NewAccessToken(id uuid.UUID, roleIds uuid.UUIDs, email string, signingMetho
 	}
 	expireMinutes = expireMinutesInt
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["sub"] = id
-	claims["name"] = email
-	claims["role_ids"] = roleIds
-	claims["exp"] = time.Now().Add(time.Minute * time.Duration(expireMinutes)).Unix()
-
-	t, err := token.SignedString([]byte(os.Getenv("JWT_KEY")))
-	if err != nil {
-		return "", err
-	}
-
-	return t, err
+	return time.Now().Add(time.Minute * time.Duration(expireMinutes))
 }
 
-func NewRefreshToken(id uuid.UUID, signingMethod jwt.SigningMethod) (string, error) {
-	refreshToken := jwt.New(signingMethod)
+// refreshTokenLifetime is the longest lifetime of any token we sign, retired signing keys
+// keep verifying for at least this long.
+func refreshTokenLifetime() time.Duration {
 	refrshLengthEnv := os.Getenv("REFRESH_TOKEN_EXPIRIRATION_MINUTES")
 	expireMinutesInt, err := type_helper.ParseIntegerFromString[int64](refrshLengthEnv)
 	if err != nil {
 		slog.Error("Error parsing JWT Expiration minutes from env var EXPIRATION_MINUTS")
 		expireMinutesInt = int64(2880)
 	}
+	return time.Hour * time.Duration(expireMinutesInt)
+}
 
-	rtClaims := refreshToken.Claims.(jwt.MapClaims)
-	rtClaims["sub"] = id
-	rtClaims["exp"] = time.Now().Add(time.Hour * time.Duration(expireMinutesInt)).Unix()
+// ValidateAccessToken verifies the signature and expiry of a token against the keyring
+// and returns its claims.
+func ValidateAccessToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := GetKeyRing().Parse(tokenString, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	// access tokens carry no typ, refresh and mfa challenge tokens do
+	if typ, ok := claims["typ"]; ok && typ != "" {
+		return nil, fmt.Errorf("%v tokens cannot be used as access tokens", typ)
+	}
+	if err := checkTokenDenylist(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
 
-	rt, err := refreshToken.SignedString([]byte(os.Getenv("JWT_KEY")))
+// checkTokenDenylist rejects tokens whose jti was revoked. Lookup errors fail closed.
+func checkTokenDenylist(claims jwt.MapClaims) error {
+	denylist := token_denylist.Default()
+	if denylist == nil {
+		return nil
+	}
+
+	jti, err := getJtiFromClaims(claims)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	revoked, err := denylist.IsRevoked(context.Background(), jti)
+	if err != nil {
+		return fmt.Errorf("unable to verify token revocation status")
+	}
+	if revoked {
+		return fmt.Errorf("token has been revoked")
+	}
+	return nil
+}
+
+func getJtiFromClaims(claims jwt.MapClaims) (uuid.UUID, error) {
+	jtiStr, ok := claims["jti"].(string)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("token has no jti claim")
+	}
+	jti, err := uuid.Parse(jtiStr)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid jti claim: %w", err)
+	}
+	return jti, nil
+}
+
+// RevokeAccessTokenFromClaims adds the token described by claims to the denylist.
+func RevokeAccessTokenFromClaims(ctx context.Context, claims jwt.MapClaims, reason string) error {
+	denylist := token_denylist.Default()
+	if denylist == nil {
+		return nil
+	}
+
+	jti, err := getJtiFromClaims(claims)
+	if err != nil {
+		return err
+	}
+	sub, _ := claims["sub"].(string)
+	userId, err := uuid.Parse(sub)
+	if err != nil {
+		return fmt.Errorf("invalid sub claim: %w", err)
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return fmt.Errorf("invalid exp claim")
 	}
 
-	return rt, err
+	return denylist.Revoke(ctx, jti, userId, exp.Time, reason)
 }
 
 func ParseAccessToken(accessToken string) *InfraJWTClaim {
-	parsedAccessToken, _ := jwt.ParseWithClaims(accessToken, &InfraJWTClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_KEY")), nil
-	})
+	parsedAccessToken, _ := GetKeyRing().Parse(accessToken, &InfraJWTClaim{})
 
 	return parsedAccessToken.Claims.(*InfraJWTClaim)
 }
 
 func ParseRefreshToken(refreshToken string) *jwt.RegisteredClaims {
-	parsedRefreshToken, _ := jwt.ParseWithClaims(refreshToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_KEY")), nil
-	})
+	parsedRefreshToken, _ := GetKeyRing().Parse(refreshToken, &jwt.RegisteredClaims{})
 
 	return parsedRefreshToken.Claims.(*jwt.RegisteredClaims)
 }
@@ -119,7 +199,7 @@ func (a *LocalAuthService) GetUserById(id uuid.UUID) (*user_crud_svc.UserDao, er
 	user, err := qry.GetUserById(context.Background(), id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("no user found with id: %s", id.String())
+			return nil, fmt.Errorf("no user found with id: %s: %w", id.String(), ErrUserNotFound)
 		}
 		slog.Error("Error geting user from db", slog.String("error", err.Error()))
 		return usrInfo, fmt.Errorf("error retrieving user info from db id: %s error: %w", id.String(), err)
@@ -128,52 +208,59 @@ func (a *LocalAuthService) GetUserById(id uuid.UUID) (*user_crud_svc.UserDao, er
 	usrInfo.ParseUserWithRoleFromDb(user)
 
 	if !user.Enabled || user.IsDeleted {
-		return usrInfo, fmt.Errorf("id: %s username: %s is disabled or deleted", user.ID, user.Username.String)
+		return usrInfo, fmt.Errorf("id: %s username: %s: %w", user.ID, user.Username.String, ErrUserDisabled)
 	}
 
 	return usrInfo, nil
 }
 
+// RefreshAccessToken rotates the refresh token and returns a new access token together with
+// the replacement refresh token. The presented refresh token can not be used again. The
+// access token is built before the rotation commits, so a failure leaves the presented
+// refresh token usable for a retry.
 func (a *LocalAuthService) RefreshAccessToken(refreshToken string) (AuthToken, error) {
 	var tokenPair AuthToken
-	// Parse the refresh token and validate
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+	ctx := context.Background()
 
-		return []byte(os.Getenv("JWT_KEY")), nil
-	})
+	stored, newRefreshToken, err := a.rotateRefreshToken(ctx, refreshToken, func(stored infra_db_pg.RefreshToken) error {
+		// Get the user record from database so disabled or deleted users can not refresh
+		usrInfo, err := a.GetUserById(stored.UserID)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return tokenPair, fmt.Errorf("refresh token validation error %w", err)
-	}
+		// The session stays in its organization unless the user has since left it
+		session, err := resolveOrgSession(ctx, usrInfo.Id, uuid.UUID(stored.OrgID.Bytes))
+		if errors.Is(err, organizations.ErrNotMember) {
+			session, err = resolveOrgSession(ctx, usrInfo.Id, uuid.Nil)
+		}
+		if err != nil {
+			return err
+		}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		uid, err := uuid.Parse(claims["sub"].(string))
+		roleIds, err := withGroupRoles(ctx, usrInfo.Id, usrInfo.RoleIds)
 		if err != nil {
-			return tokenPair, fmt.Errorf("error parsing uuid from string id: %s error: %w", claims["sub"].(string), err)
+			return err
 		}
 
-		tokenPair.UserID = uid
-
-		usrInfo, err := a.GetUserById(uid)
-		// Get the user record from database or
-		// run through your business logic to verify if the user can log in
-		if err == nil {
-			signingMethod := getJwtSigningMenthodFromEnv()
-			tokenPair.Token, err = NewAccessToken(usrInfo.Id, usrInfo.RoleIds, usrInfo.Email, signingMethod)
-			if err != nil {
-				return tokenPair, fmt.Errorf("error creating NewAccessToken %w", err)
-			}
-			tokenPair.Email = usrInfo.Email
-			tokenPair.Username = usrInfo.UserName
-			return tokenPair, nil
-
-		} else {
-			return tokenPair, err
+		tokenPair.Expiration = accessTokenExpiration()
+		tokenPair.Token, err = NewOrgAccessTokenWithExp(usrInfo.Id, mergeRoleIds(roleIds, session.RoleIds), usrInfo.Email, session.OrgId, tokenPair.Expiration)
+		if err != nil {
+			return fmt.Errorf("error creating NewAccessToken %w", err)
 		}
+		tokenPair.OrganizationId = session.OrgId
+		tokenPair.Email = usrInfo.Email
+		tokenPair.Username = usrInfo.UserName
+		return nil
+	})
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrUserDisabled) {
+		a.revokeRefreshTokenFamily(ctx, stored)
+		return AuthToken{UserID: stored.UserID}, err
+	}
+	if err != nil {
+		return AuthToken{}, fmt.Errorf("refresh token validation error %w", err)
 	}
-	return tokenPair, err
+	tokenPair.UserID = stored.UserID
+	tokenPair.RefreshToken = newRefreshToken
+	return tokenPair, nil
 }
@@ -0,0 +1,77 @@
+package authapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/babbage88/go-infra/services/token_denylist"
+	"github.com/google/uuid"
+)
+
+type fakeDenylist struct {
+	issued  map[uuid.UUID]uuid.UUID
+	revoked map[uuid.UUID]bool
+}
+
+func newFakeDenylist() *fakeDenylist {
+	return &fakeDenylist{issued: make(map[uuid.UUID]uuid.UUID), revoked: make(map[uuid.UUID]bool)}
+}
+
+func (f *fakeDenylist) RecordIssued(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time) error {
+	f.issued[jti] = userId
+	return nil
+}
+
+func (f *fakeDenylist) IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	return f.revoked[jti], nil
+}
+
+func (f *fakeDenylist) Revoke(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time, reason string) error {
+	f.revoked[jti] = true
+	return nil
+}
+
+func (f *fakeDenylist) RevokeUserTokens(ctx context.Context, userId uuid.UUID, reason string) error {
+	for jti, owner := range f.issued {
+		if owner == userId {
+			f.revoked[jti] = true
+		}
+	}
+	return nil
+}
+
+func TestRevokedUserTokensAreRejected(t *testing.T) {
+	SetKeyRing(nil)
+	denylist := newFakeDenylist()
+	token_denylist.SetDefault(denylist)
+	defer token_denylist.SetDefault(nil)
+
+	userId := uuid.New()
+	otherUserId := uuid.New()
+	userToken, err := NewAccessTokenWithExp(userId, uuid.UUIDs{uuid.New()}, "user@example.com", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+	otherToken, err := NewAccessTokenWithExp(otherUserId, uuid.UUIDs{uuid.New()}, "other@example.com", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+
+	claims, err := ValidateAccessToken(userToken)
+	if err != nil {
+		t.Fatalf("expected token to validate before revocation, got: %v", err)
+	}
+	if _, ok := claims["jti"].(string); !ok {
+		t.Fatal("expected jti claim on access token")
+	}
+
+	denylist.RevokeUserTokens(context.Background(), userId, token_denylist.ReasonRoleChanged)
+
+	if _, err := ValidateAccessToken(userToken); err == nil {
+		t.Fatal("expected revoked token to be rejected")
+	}
+	if _, err := ValidateAccessToken(otherToken); err != nil {
+		t.Fatalf("expected other user's token to stay valid, got: %v", err)
+	}
+}
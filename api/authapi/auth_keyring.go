@@ -0,0 +1,621 @@
+package authapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/babbage88/go-infra/internal/type_helper"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNoActiveSigningKey = errors.New("no active jwt signing key in keyring")
+	ErrUnknownSigningKey  = errors.New("token was signed with an unknown key id")
+	ErrLegacyHmacExpired  = errors.New("legacy hmac tokens are no longer accepted")
+)
+
+// unknownKidReloadInterval limits how often tokens with an unknown kid reload the keyring,
+// so forged kids can not be used to hammer the key store.
+const unknownKidReloadInterval = 10 * time.Second
+
+// SigningKey is a single entry in the JWT keyring. The active key signs new tokens,
+// retired keys are kept for verification only until ExpiresAt.
+type SigningKey struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+	RetiredAt  time.Time
+	ExpiresAt  time.Time
+}
+
+func (k *SigningKey) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+func (k *SigningKey) IsRetired() bool {
+	return !k.RetiredAt.IsZero()
+}
+
+func (k *SigningKey) IsExpired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+// GenerateSigningKey creates a new private key for the given JWT algorithm.
+// Supported algorithms are RS256, ES256 and EdDSA.
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported jwt signing algorithm for keyring: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating %s signing key: %w", algorithm, err)
+	}
+
+	kid, err := keyIdForPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		Kid:        kid,
+		Algorithm:  algorithm,
+		PrivateKey: signer,
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// keyIdForPublicKey derives a stable kid from the SHA-256 of the DER encoded public key.
+func keyIdForPublicKey(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:16]), nil
+}
+
+// KeyRing holds every key that may verify go-infra tokens and signs new tokens with the
+// newest active key. When the ring is configured with an HMAC algorithm it behaves like the
+// original single JWT_KEY setup.
+type KeyRing struct {
+	mu         sync.RWMutex
+	algorithm  string
+	keys       map[string]*SigningKey
+	activeKid  string
+	hmacSecret []byte
+	// legacyHmacUntil ends the acceptance of HMAC tokens by an asymmetric ring.
+	legacyHmacUntil time.Time
+	store           SigningKeyStore
+	rotateEvery     time.Duration
+	verifyGrace     time.Duration
+	reloadMu        sync.Mutex
+	lastReload      time.Time
+}
+
+// NewKeyRing creates a keyring for the given algorithm. rotateEvery is how long a key stays
+// active before a new one is generated, verifyGrace is how long a retired key keeps verifying
+// and should be at least the longest token lifetime.
+func NewKeyRing(algorithm string, store SigningKeyStore, rotateEvery time.Duration, verifyGrace time.Duration) *KeyRing {
+	return &KeyRing{
+		algorithm:   algorithm,
+		keys:        make(map[string]*SigningKey),
+		store:       store,
+		rotateEvery: rotateEvery,
+		verifyGrace: verifyGrace,
+	}
+}
+
+// NewHmacKeyRing creates a keyring that signs and verifies with a single shared secret.
+func NewHmacKeyRing(algorithm string, secret []byte) *KeyRing {
+	return &KeyRing{
+		algorithm:  algorithm,
+		keys:       make(map[string]*SigningKey),
+		hmacSecret: secret,
+	}
+}
+
+// WithLegacyHmacSecret keeps accepting HMAC tokens without a kid header until acceptUntil,
+// so tokens issued before switching to asymmetric signing stay valid until they expire.
+// acceptUntil should be the last HMAC issue time plus the refresh token lifetime.
+func (kr *KeyRing) WithLegacyHmacSecret(secret []byte, acceptUntil time.Time) *KeyRing {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.hmacSecret = secret
+	kr.legacyHmacUntil = acceptUntil
+	return kr
+}
+
+// acceptsLegacyHmac reports whether HMAC tokens without a kid still verify. Callers hold
+// kr.mu.
+func (kr *KeyRing) acceptsLegacyHmac(now time.Time) bool {
+	if len(kr.hmacSecret) == 0 {
+		return false
+	}
+	return kr.isHmac() || now.Before(kr.legacyHmacUntil)
+}
+
+func (kr *KeyRing) Algorithm() string {
+	return kr.algorithm
+}
+
+func (kr *KeyRing) isHmac() bool {
+	_, ok := jwt.GetSigningMethod(kr.algorithm).(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// Load reads every unexpired key from the store and generates a first key if none is active.
+func (kr *KeyRing) Load(ctx context.Context) error {
+	if kr.isHmac() {
+		return nil
+	}
+	if err := kr.reload(ctx); err != nil {
+		return err
+	}
+
+	kr.mu.RLock()
+	hasActive := kr.activeKid != ""
+	kr.mu.RUnlock()
+	if hasActive {
+		return nil
+	}
+
+	slog.Info("No active jwt signing key found, generating one", slog.String("algorithm", kr.algorithm))
+	return kr.rotate(ctx, time.Now().Add(-kr.rotateEvery))
+}
+
+func (kr *KeyRing) reload(ctx context.Context) error {
+	keys, err := kr.store.LoadSigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading jwt signing keys: %w", err)
+	}
+
+	now := time.Now()
+	loaded := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		if key.IsExpired(now) {
+			continue
+		}
+		loaded[key.Kid] = key
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.keys = loaded
+	kr.activeKid = selectActiveKid(loaded, kr.algorithm)
+	kr.lastReload = now
+	return nil
+}
+
+// reloadForKid reloads the keyring when a token names a kid it does not hold, which happens
+// right after another replica rotated. Reloads are limited to one per
+// unknownKidReloadInterval.
+func (kr *KeyRing) reloadForKid(kid string) (*SigningKey, bool) {
+	if kr.store == nil {
+		return nil, false
+	}
+	kr.reloadMu.Lock()
+	defer kr.reloadMu.Unlock()
+
+	kr.mu.RLock()
+	key, ok := kr.keys[kid]
+	lastReload := kr.lastReload
+	kr.mu.RUnlock()
+	if ok || time.Since(lastReload) < unknownKidReloadInterval {
+		return key, ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := kr.reload(ctx); err != nil {
+		slog.Error("Error reloading jwt signing keys for unknown kid", slog.String("kid", kid), slog.String("error", err.Error()))
+		return nil, false
+	}
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	key, ok = kr.keys[kid]
+	return key, ok
+}
+
+// selectActiveKid returns the newest non retired key using the configured algorithm.
+func selectActiveKid(keys map[string]*SigningKey, algorithm string) string {
+	candidates := make([]*SigningKey, 0, len(keys))
+	for _, key := range keys {
+		if !key.IsRetired() && key.Algorithm == algorithm {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+	return candidates[0].Kid
+}
+
+// Rotate generates and stores a new active key and retires every other active key. Retired
+// keys keep verifying for verifyGrace.
+func (kr *KeyRing) Rotate(ctx context.Context) error {
+	return kr.rotate(ctx, time.Now())
+}
+
+// rotate activates a new key unless the store already holds an active key created after
+// staleBefore, then reloads so keys written by other replicas are picked up either way.
+func (kr *KeyRing) rotate(ctx context.Context, staleBefore time.Time) error {
+	newKey, err := GenerateSigningKey(kr.algorithm)
+	if err != nil {
+		return err
+	}
+	rotated, err := kr.store.RotateSigningKey(ctx, newKey, staleBefore, time.Now().UTC().Add(kr.verifyGrace))
+	if err != nil {
+		return fmt.Errorf("error saving new jwt signing key: %w", err)
+	}
+	if err := kr.reload(ctx); err != nil {
+		return err
+	}
+
+	if rotated {
+		slog.Info("Rotated jwt signing key", slog.String("kid", newKey.Kid), slog.String("algorithm", newKey.Algorithm))
+	} else {
+		slog.Info("Jwt signing key was already rotated by another instance", slog.String("algorithm", newKey.Algorithm))
+	}
+	return nil
+}
+
+// StartRotation checks the active key on every tick, rotates it once it is older than
+// rotateEvery and prunes expired keys. Keys added by other replicas are picked up on reload,
+// and only one replica activates a new key per rotation.
+func (kr *KeyRing) StartRotation(ctx context.Context, checkInterval time.Duration) {
+	if kr.isHmac() || kr.rotateEvery <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				kr.rotateIfDue(ctx)
+			}
+		}
+	}()
+}
+
+func (kr *KeyRing) rotateIfDue(ctx context.Context) {
+	if err := kr.store.DeleteExpiredSigningKeys(ctx); err != nil {
+		slog.Error("Error pruning expired jwt signing keys", slog.String("error", err.Error()))
+	}
+	if err := kr.reload(ctx); err != nil {
+		slog.Error("Error reloading jwt signing keys", slog.String("error", err.Error()))
+		return
+	}
+
+	kr.mu.RLock()
+	active := kr.keys[kr.activeKid]
+	kr.mu.RUnlock()
+
+	if active != nil && time.Since(active.CreatedAt) < kr.rotateEvery {
+		return
+	}
+	if err := kr.rotate(ctx, time.Now().Add(-kr.rotateEvery)); err != nil {
+		slog.Error("Error rotating jwt signing key", slog.String("error", err.Error()))
+	}
+}
+
+// Sign signs the claims with the active key and sets the kid header.
+func (kr *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	if kr.isHmac() {
+		if len(kr.hmacSecret) == 0 {
+			return "", fmt.Errorf("JWT_KEY environment variable is not set")
+		}
+		return jwt.NewWithClaims(jwt.GetSigningMethod(kr.algorithm), claims).SignedString(kr.hmacSecret)
+	}
+
+	kr.mu.RLock()
+	active, ok := kr.keys[kr.activeKid]
+	kr.mu.RUnlock()
+	if !ok {
+		return "", ErrNoActiveSigningKey
+	}
+
+	token := jwt.NewWithClaims(active.Method(), claims)
+	token.Header["kid"] = active.Kid
+	return token.SignedString(active.PrivateKey)
+}
+
+// Keyfunc resolves the verification key for a parsed token from its kid header and checks
+// that the token algorithm matches the key it claims to be signed with.
+func (kr *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if kid == "" {
+		kr.mu.RLock()
+		secret := kr.hmacSecret
+		accepted := kr.acceptsLegacyHmac(time.Now())
+		kr.mu.RUnlock()
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && len(secret) > 0 {
+			if !accepted {
+				return nil, ErrLegacyHmacExpired
+			}
+			return secret, nil
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kr.mu.RLock()
+	key, ok := kr.keys[kid]
+	kr.mu.RUnlock()
+	if !ok {
+		key, ok = kr.reloadForKid(kid)
+	}
+	if !ok || key.IsExpired(time.Now()) {
+		return nil, ErrUnknownSigningKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.PublicKey(), nil
+}
+
+// ValidMethods lists the algorithms the parser should accept.
+func (kr *KeyRing) ValidMethods() []string {
+	methods := []string{kr.algorithm}
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if !kr.isHmac() && kr.acceptsLegacyHmac(time.Now()) {
+		methods = append(methods, jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg())
+	}
+	for _, key := range kr.keys {
+		if key.Algorithm != kr.algorithm {
+			methods = append(methods, key.Algorithm)
+		}
+	}
+	return methods
+}
+
+// Parse parses and verifies a token against the keyring.
+func (kr *KeyRing) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, kr.Keyfunc, jwt.WithValidMethods(kr.ValidMethods()))
+}
+
+// JSONWebKey is the public half of a keyring entry as described in RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// swagger:model JSONWebKeySet
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns every unexpired asymmetric public key. HMAC secrets are never published.
+func (kr *KeyRing) JWKS() JSONWebKeySet {
+	jwks := JSONWebKeySet{Keys: make([]JSONWebKey, 0)}
+
+	kr.mu.RLock()
+	keys := make([]*SigningKey, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		keys = append(keys, key)
+	}
+	kr.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	now := time.Now()
+	for _, key := range keys {
+		if key.IsExpired(now) {
+			continue
+		}
+		jwk, err := publicKeyToJWK(key)
+		if err != nil {
+			slog.Error("Error converting signing key to jwk", slog.String("kid", key.Kid), slog.String("error", err.Error()))
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func publicKeyToJWK(key *SigningKey) (JSONWebKey, error) {
+	jwk := JSONWebKey{Kid: key.Kid, Use: "sig", Alg: key.Algorithm}
+
+	switch pub := key.PublicKey().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdhKey, err := pub.ECDH()
+		if err != nil {
+			return jwk, err
+		}
+		// uncompressed point: 0x04 || X || Y
+		point := ecdhKey.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(point[1 : 1+size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return jwk, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return jwk, nil
+}
+
+var (
+	defaultKeyRingMu sync.RWMutex
+	defaultKeyRing   *KeyRing
+)
+
+// SetKeyRing sets the keyring used to sign and verify go-infra tokens.
+func SetKeyRing(kr *KeyRing) {
+	defaultKeyRingMu.Lock()
+	defer defaultKeyRingMu.Unlock()
+	defaultKeyRing = kr
+}
+
+// GetKeyRing returns the configured keyring. When none has been set it falls back to a
+// keyring built from JWT_ALGORITHM, see newFallbackKeyRing.
+func GetKeyRing() *KeyRing {
+	defaultKeyRingMu.RLock()
+	kr := defaultKeyRing
+	defaultKeyRingMu.RUnlock()
+	if kr != nil {
+		return kr
+	}
+
+	defaultKeyRingMu.Lock()
+	defer defaultKeyRingMu.Unlock()
+	if defaultKeyRing == nil {
+		defaultKeyRing = newFallbackKeyRing()
+	}
+	return defaultKeyRing
+}
+
+// newFallbackKeyRing signs with JWT_KEY only when JWT_ALGORITHM names an HMAC algorithm.
+// Otherwise it signs with a key held in memory that does not survive a restart.
+func newFallbackKeyRing() *KeyRing {
+	signingMethod := getJwtSigningMenthodFromEnv()
+	if _, ok := signingMethod.(*jwt.SigningMethodHMAC); ok {
+		return NewHmacKeyRing(signingMethod.Alg(), []byte(os.Getenv("JWT_KEY")))
+	}
+	if signingMethod == nil {
+		signingMethod = defaultSigningMethod
+	}
+
+	kr := NewKeyRing(signingMethod.Alg(), NewMemorySigningKeyStore(), 0, refreshTokenLifetime())
+	if err := kr.Load(context.Background()); err != nil {
+		slog.Error("Error loading fallback jwt keyring", slog.String("error", err.Error()))
+	}
+	return kr
+}
+
+// InitKeyRingFromEnv builds the keyring from JWT_ALGORITHM, JWT_KEY_STORE, JWT_KEY_DIR and
+// JWT_KEY_ROTATION_HOURS, loads it and sets it as the default keyring.
+func InitKeyRingFromEnv(ctx context.Context, db *pgxpool.Pool) (*KeyRing, error) {
+	signingMethod := getJwtSigningMenthodFromEnv()
+	if signingMethod == nil {
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM: %s", os.Getenv("JWT_ALGORITHM"))
+	}
+
+	jwtKey := os.Getenv("JWT_KEY")
+	if _, ok := signingMethod.(*jwt.SigningMethodHMAC); ok {
+		slog.Warn("JWT_ALGORITHM is an HMAC algorithm, every verifier needs the signing secret", slog.String("algorithm", signingMethod.Alg()))
+		kr := NewHmacKeyRing(signingMethod.Alg(), []byte(jwtKey))
+		SetKeyRing(kr)
+		return kr, nil
+	}
+
+	var store SigningKeyStore
+	storeType := os.Getenv("JWT_KEY_STORE")
+	switch storeType {
+	case "file":
+		keyDir := os.Getenv("JWT_KEY_DIR")
+		if keyDir == "" {
+			keyDir = "jwt-keys"
+		}
+		store = NewFileSigningKeyStore(keyDir)
+	case "memory":
+		store = NewMemorySigningKeyStore()
+	case "", "postgres":
+		sealingSecret := os.Getenv("JWT_KEY_SEALING_SECRET")
+		if sealingSecret == "" {
+			sealingSecret = jwtKey
+		}
+		if sealingSecret == "" {
+			return nil, fmt.Errorf("JWT_KEY_SEALING_SECRET or JWT_KEY must be set to store signing keys in postgres")
+		}
+		store = NewPgSigningKeyStore(db, sealingSecret)
+	default:
+		return nil, fmt.Errorf("unsupported JWT_KEY_STORE: %s", storeType)
+	}
+
+	rotationHours, err := type_helper.ParseIntegerFromString[int64](os.Getenv("JWT_KEY_ROTATION_HOURS"))
+	if err != nil {
+		slog.Info("No valid JWT_KEY_ROTATION_HOURS set, defaulting to 720")
+		rotationHours = 720
+	}
+
+	kr := NewKeyRing(signingMethod.Alg(), store, time.Duration(rotationHours)*time.Hour, refreshTokenLifetime())
+	if jwtKey != "" {
+		acceptUntil, err := legacyHmacCutoffFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		if acceptUntil.After(time.Now()) {
+			slog.Info("Accepting legacy hmac tokens", slog.Time("until", acceptUntil))
+			kr.WithLegacyHmacSecret([]byte(jwtKey), acceptUntil)
+		}
+	}
+	if err := kr.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	SetKeyRing(kr)
+	return kr, nil
+}
+
+// legacyHmacCutoffFromEnv reads JWT_LEGACY_HMAC_ACCEPT_UNTIL, an RFC 3339 time after which
+// HMAC tokens issued before the switch to asymmetric signing are refused. Unset means they
+// are refused already.
+func legacyHmacCutoffFromEnv() (time.Time, error) {
+	value := os.Getenv("JWT_LEGACY_HMAC_ACCEPT_UNTIL")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	acceptUntil, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid JWT_LEGACY_HMAC_ACCEPT_UNTIL: %w", err)
+	}
+	return acceptUntil, nil
+}
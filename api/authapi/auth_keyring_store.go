@@ -0,0 +1,432 @@
+package authapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SigningKeyStore persists keyring entries so every replica signs with the same key and
+// tokens survive restarts.
+//
+// RotateSigningKey saves key as the only active key and retires every other active key with
+// expiresAt, as one atomic step. When an active key of the same algorithm created after
+// staleBefore already exists another replica has rotated first, nothing is written and
+// false is returned.
+type SigningKeyStore interface {
+	LoadSigningKeys(ctx context.Context) ([]*SigningKey, error)
+	RotateSigningKey(ctx context.Context, key *SigningKey, staleBefore time.Time, expiresAt time.Time) (bool, error)
+	DeleteExpiredSigningKeys(ctx context.Context) error
+}
+
+// hasFreshKey reports whether keys hold an active key of algorithm created after staleBefore.
+func hasFreshKey(keys []*SigningKey, algorithm string, staleBefore time.Time) bool {
+	for _, key := range keys {
+		if !key.IsRetired() && key.Algorithm == algorithm && key.CreatedAt.After(staleBefore) {
+			return true
+		}
+	}
+	return false
+}
+
+func marshalPrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling private key: %w", err)
+	}
+	return der, nil
+}
+
+func unmarshalPrivateKey(der []byte) (crypto.Signer, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return signer, nil
+}
+
+// MemorySigningKeyStore keeps keys in process memory. Keys are lost on restart, so it is
+// only suitable for tests and single instance development setups.
+type MemorySigningKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]*SigningKey
+}
+
+func NewMemorySigningKeyStore() *MemorySigningKeyStore {
+	return &MemorySigningKeyStore{keys: make(map[string]*SigningKey)}
+}
+
+func (m *MemorySigningKeyStore) LoadSigningKeys(ctx context.Context) ([]*SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]*SigningKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
+
+func (m *MemorySigningKeyStore) RotateSigningKey(ctx context.Context, key *SigningKey, staleBefore time.Time, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing := make([]*SigningKey, 0, len(m.keys))
+	for _, stored := range m.keys {
+		existing = append(existing, stored)
+	}
+	if hasFreshKey(existing, key.Algorithm, staleBefore) {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	for _, stored := range existing {
+		if !stored.IsRetired() {
+			stored.RetiredAt = now
+			stored.ExpiresAt = expiresAt
+		}
+	}
+	copied := *key
+	m.keys[key.Kid] = &copied
+	return true, nil
+}
+
+func (m *MemorySigningKeyStore) DeleteExpiredSigningKeys(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for kid, key := range m.keys {
+		if key.IsExpired(now) {
+			delete(m.keys, kid)
+		}
+	}
+	return nil
+}
+
+// PgSigningKeyStore stores keys in the jwt_signing_keys table. Private keys are sealed with
+// AES-GCM before they are written, the sealing key is derived from the supplied secret.
+type PgSigningKeyStore struct {
+	DbConn     *pgxpool.Pool
+	sealingKey []byte
+}
+
+func NewPgSigningKeyStore(db *pgxpool.Pool, sealingSecret string) *PgSigningKeyStore {
+	sum := sha256.Sum256([]byte(sealingSecret))
+	return &PgSigningKeyStore{DbConn: db, sealingKey: sum[:]}
+}
+
+func (p *PgSigningKeyStore) seal(plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(p.sealingKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (p *PgSigningKeyStore) open(ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(p.sealingKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("sealed signing key is too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func (p *PgSigningKeyStore) LoadSigningKeys(ctx context.Context) ([]*SigningKey, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetJwtSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*SigningKey, 0, len(rows))
+	for _, row := range rows {
+		der, err := p.open(row.PrivateKey)
+		if err != nil {
+			slog.Error("Error unsealing jwt signing key, skipping", slog.String("kid", row.Kid), slog.String("error", err.Error()))
+			continue
+		}
+		signer, err := unmarshalPrivateKey(der)
+		if err != nil {
+			slog.Error("Error parsing jwt signing key, skipping", slog.String("kid", row.Kid), slog.String("error", err.Error()))
+			continue
+		}
+		keys = append(keys, &SigningKey{
+			Kid:        row.Kid,
+			Algorithm:  row.Algorithm,
+			PrivateKey: signer,
+			CreatedAt:  row.CreatedAt.Time,
+			RetiredAt:  row.RetiredAt.Time,
+			ExpiresAt:  row.ExpiresAt.Time,
+		})
+	}
+	return keys, nil
+}
+
+// RotateSigningKey holds an advisory lock for the transaction, so concurrent rotations on
+// other replicas wait and then find the fresh key instead of adding a second one.
+func (p *PgSigningKeyStore) RotateSigningKey(ctx context.Context, key *SigningKey, staleBefore time.Time, expiresAt time.Time) (bool, error) {
+	der, err := marshalPrivateKey(key.PrivateKey)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := p.seal(der)
+	if err != nil {
+		return false, fmt.Errorf("error sealing private key: %w", err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(key.PublicKey())
+	if err != nil {
+		return false, fmt.Errorf("error marshaling public key: %w", err)
+	}
+
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	qry := infra_db_pg.New(tx)
+	if err := qry.LockJwtSigningKeys(ctx); err != nil {
+		return false, fmt.Errorf("error locking jwt signing keys: %w", err)
+	}
+	fresh, err := qry.HasFreshJwtSigningKey(ctx, infra_db_pg.HasFreshJwtSigningKeyParams{
+		Algorithm:    key.Algorithm,
+		CreatedAfter: pgtype.Timestamptz{Time: staleBefore, Valid: true},
+	})
+	if err != nil {
+		return false, err
+	}
+	if fresh {
+		return false, nil
+	}
+
+	err = qry.InsertJwtSigningKey(ctx, infra_db_pg.InsertJwtSigningKeyParams{
+		Kid:        key.Kid,
+		Algorithm:  key.Algorithm,
+		PrivateKey: sealed,
+		PublicKey:  pubDer,
+		CreatedAt:  pgtype.Timestamptz{Time: key.CreatedAt, Valid: true},
+		RetiredAt:  pgtype.Timestamptz{Time: key.RetiredAt, Valid: !key.RetiredAt.IsZero()},
+		ExpiresAt:  pgtype.Timestamptz{Time: key.ExpiresAt, Valid: !key.ExpiresAt.IsZero()},
+	})
+	if err != nil {
+		return false, err
+	}
+	err = qry.RetireOtherJwtSigningKeys(ctx, infra_db_pg.RetireOtherJwtSigningKeysParams{
+		RetiredAt: pgtype.Timestamptz{Time: time.Now().UTC(), Valid: true},
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		Kid:       key.Kid,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (p *PgSigningKeyStore) DeleteExpiredSigningKeys(ctx context.Context) error {
+	qry := infra_db_pg.New(p.DbConn)
+	return qry.DeleteExpiredJwtSigningKeys(ctx)
+}
+
+// FileSigningKeyStore keeps one PEM encoded PKCS8 key per file in a directory, with the
+// keyring metadata in a JSON sidecar. Useful when keys are mounted from a kubernetes secret.
+// Rotations are only serialized within the process, replicas sharing a writable directory
+// should use the postgres store instead.
+type FileSigningKeyStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+type fileSigningKeyMeta struct {
+	Kid       string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	CreatedAt time.Time `json:"createdAt"`
+	RetiredAt time.Time `json:"retiredAt,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+func NewFileSigningKeyStore(dir string) *FileSigningKeyStore {
+	return &FileSigningKeyStore{Dir: dir}
+}
+
+func (f *FileSigningKeyStore) keyPath(kid string) string {
+	return filepath.Join(f.Dir, kid+".pem")
+}
+
+func (f *FileSigningKeyStore) metaPath(kid string) string {
+	return filepath.Join(f.Dir, kid+".json")
+}
+
+func (f *FileSigningKeyStore) readMeta(kid string) (fileSigningKeyMeta, error) {
+	var meta fileSigningKeyMeta
+	data, err := os.ReadFile(f.metaPath(kid))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+func (f *FileSigningKeyStore) writeMeta(meta fileSigningKeyMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.metaPath(meta.Kid), data, 0o600)
+}
+
+func (f *FileSigningKeyStore) LoadSigningKeys(ctx context.Context) ([]*SigningKey, error) {
+	entries, err := os.ReadDir(f.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	keys := make([]*SigningKey, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+		kid := strings.TrimSuffix(entry.Name(), ".pem")
+		meta, err := f.readMeta(kid)
+		if err != nil {
+			slog.Error("Error reading jwt signing key metadata, skipping", slog.String("kid", kid), slog.String("error", err.Error()))
+			continue
+		}
+		pemBytes, err := os.ReadFile(f.keyPath(kid))
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(pemBytes)
+		if block == nil {
+			slog.Error("No PEM block found in jwt signing key file, skipping", slog.String("kid", kid))
+			continue
+		}
+		signer, err := unmarshalPrivateKey(block.Bytes)
+		if err != nil {
+			slog.Error("Error parsing jwt signing key, skipping", slog.String("kid", kid), slog.String("error", err.Error()))
+			continue
+		}
+		keys = append(keys, &SigningKey{
+			Kid:        meta.Kid,
+			Algorithm:  meta.Algorithm,
+			PrivateKey: signer,
+			CreatedAt:  meta.CreatedAt,
+			RetiredAt:  meta.RetiredAt,
+			ExpiresAt:  meta.ExpiresAt,
+		})
+	}
+	return keys, nil
+}
+
+func (f *FileSigningKeyStore) RotateSigningKey(ctx context.Context, key *SigningKey, staleBefore time.Time, expiresAt time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, err := f.LoadSigningKeys(ctx)
+	if err != nil {
+		return false, err
+	}
+	if hasFreshKey(existing, key.Algorithm, staleBefore) {
+		return false, nil
+	}
+
+	if err := f.saveSigningKey(key); err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	for _, stored := range existing {
+		if stored.IsRetired() {
+			continue
+		}
+		if err := f.retireSigningKey(stored.Kid, now, expiresAt); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func (f *FileSigningKeyStore) saveSigningKey(key *SigningKey) error {
+	if err := os.MkdirAll(f.Dir, 0o700); err != nil {
+		return err
+	}
+	der, err := marshalPrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(f.keyPath(key.Kid), pemBytes, 0o600); err != nil {
+		return err
+	}
+	return f.writeMeta(fileSigningKeyMeta{
+		Kid:       key.Kid,
+		Algorithm: key.Algorithm,
+		CreatedAt: key.CreatedAt,
+		RetiredAt: key.RetiredAt,
+		ExpiresAt: key.ExpiresAt,
+	})
+}
+
+func (f *FileSigningKeyStore) retireSigningKey(kid string, retiredAt time.Time, expiresAt time.Time) error {
+	meta, err := f.readMeta(kid)
+	if err != nil {
+		return err
+	}
+	meta.RetiredAt = retiredAt
+	meta.ExpiresAt = expiresAt
+	return f.writeMeta(meta)
+}
+
+func (f *FileSigningKeyStore) DeleteExpiredSigningKeys(ctx context.Context) error {
+	keys, err := f.LoadSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, key := range keys {
+		if !key.IsExpired(now) {
+			continue
+		}
+		os.Remove(f.keyPath(key.Kid))
+		os.Remove(f.metaPath(key.Kid))
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package authapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKeyRing(t *testing.T, algorithm string) *KeyRing {
+	t.Helper()
+	kr := NewKeyRing(algorithm, NewMemorySigningKeyStore(), time.Hour, time.Hour)
+	if err := kr.Load(context.Background()); err != nil {
+		t.Fatalf("error loading keyring: %v", err)
+	}
+	return kr
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": uuid.New().String(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func TestKeyRingSignAndVerify(t *testing.T) {
+	for _, alg := range []string{"RS256", "ES256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			kr := newTestKeyRing(t, alg)
+
+			signed, err := kr.Sign(testClaims())
+			if err != nil {
+				t.Fatalf("error signing token: %v", err)
+			}
+
+			token, err := kr.Parse(signed, jwt.MapClaims{})
+			if err != nil || !token.Valid {
+				t.Fatalf("expected token to verify, got: %v", err)
+			}
+			if token.Header["kid"] == "" {
+				t.Fatal("expected kid header to be set")
+			}
+		})
+	}
+}
+
+func TestKeyRingRotationKeepsRetiredKeyVerifying(t *testing.T) {
+	kr := newTestKeyRing(t, "ES256")
+
+	oldToken, err := kr.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	if err := kr.Rotate(context.Background()); err != nil {
+		t.Fatalf("error rotating keyring: %v", err)
+	}
+
+	newToken, err := kr.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	for name, signed := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := kr.Parse(signed, jwt.MapClaims{}); err != nil {
+			t.Fatalf("expected %s token to verify after rotation, got: %v", name, err)
+		}
+	}
+
+	if len(kr.JWKS().Keys) != 2 {
+		t.Fatalf("expected retired and active key in jwks, got %d", len(kr.JWKS().Keys))
+	}
+}
+
+func TestKeyRingRejectsExpiredAndForeignKeys(t *testing.T) {
+	kr := NewKeyRing("ES256", NewMemorySigningKeyStore(), time.Hour, -time.Second)
+	if err := kr.Load(context.Background()); err != nil {
+		t.Fatalf("error loading keyring: %v", err)
+	}
+
+	oldToken, _ := kr.Sign(testClaims())
+	if err := kr.Rotate(context.Background()); err != nil {
+		t.Fatalf("error rotating keyring: %v", err)
+	}
+	if _, err := kr.Parse(oldToken, jwt.MapClaims{}); err == nil {
+		t.Fatal("expected token signed by an expired key to be rejected")
+	}
+
+	foreign := newTestKeyRing(t, "ES256")
+	foreignToken, _ := foreign.Sign(testClaims())
+	if _, err := kr.Parse(foreignToken, jwt.MapClaims{}); err == nil {
+		t.Fatal("expected token signed by an unknown key to be rejected")
+	}
+}
+
+func TestKeyRingLegacyHmacTokens(t *testing.T) {
+	secret := []byte("legacy-secret")
+	legacy, err := NewHmacKeyRing("HS256", secret).Sign(testClaims())
+	if err != nil {
+		t.Fatalf("error signing legacy token: %v", err)
+	}
+
+	kr := newTestKeyRing(t, "RS256").WithLegacyHmacSecret(secret, time.Now().Add(time.Hour))
+	if _, err := kr.Parse(legacy, jwt.MapClaims{}); err != nil {
+		t.Fatalf("expected legacy hmac token to verify, got: %v", err)
+	}
+
+	expired := newTestKeyRing(t, "RS256").WithLegacyHmacSecret(secret, time.Now().Add(-time.Second))
+	if _, err := expired.Parse(legacy, jwt.MapClaims{}); err == nil {
+		t.Fatal("expected legacy hmac token to be rejected after the cutoff")
+	}
+	if _, err := newTestKeyRing(t, "RS256").Parse(legacy, jwt.MapClaims{}); err == nil {
+		t.Fatal("expected legacy hmac token to be rejected without a legacy secret")
+	}
+
+	// an HMAC token must never be accepted under an asymmetric kid
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = kr.JWKS().Keys[0].Kid
+	forgedSigned, _ := forged.SignedString(secret)
+	if _, err := kr.Parse(forgedSigned, jwt.MapClaims{}); err == nil {
+		t.Fatal("expected hmac token with asymmetric kid to be rejected")
+	}
+}
+
+func TestKeyRingJWKS(t *testing.T) {
+	expected := map[string]string{"RS256": "RSA", "ES256": "EC", "EdDSA": "OKP"}
+	for alg, kty := range expected {
+		jwks := newTestKeyRing(t, alg).JWKS()
+		if len(jwks.Keys) != 1 {
+			t.Fatalf("%s: expected 1 key, got %d", alg, len(jwks.Keys))
+		}
+		if jwks.Keys[0].Kty != kty || jwks.Keys[0].Alg != alg {
+			t.Fatalf("%s: unexpected jwk %+v", alg, jwks.Keys[0])
+		}
+	}
+
+	if len(NewHmacKeyRing("HS256", []byte("secret")).JWKS().Keys) != 0 {
+		t.Fatal("hmac secrets must not be published")
+	}
+}
+
+func TestFileSigningKeyStore(t *testing.T) {
+	store := NewFileSigningKeyStore(t.TempDir())
+	kr := NewKeyRing("EdDSA", store, time.Hour, time.Hour)
+	if err := kr.Load(context.Background()); err != nil {
+		t.Fatalf("error loading keyring: %v", err)
+	}
+	signed, _ := kr.Sign(testClaims())
+
+	reloaded := NewKeyRing("EdDSA", store, time.Hour, time.Hour)
+	if err := reloaded.Load(context.Background()); err != nil {
+		t.Fatalf("error reloading keyring: %v", err)
+	}
+	if _, err := reloaded.Parse(signed, jwt.MapClaims{}); err != nil {
+		t.Fatalf("expected token to verify after reload, got: %v", err)
+	}
+}
+
+func TestKeyRingReloadsOnKeyRotatedByAnotherReplica(t *testing.T) {
+	store := NewMemorySigningKeyStore()
+	first := NewKeyRing("ES256", store, time.Hour, time.Hour)
+	second := NewKeyRing("ES256", store, time.Hour, time.Hour)
+	for _, kr := range []*KeyRing{first, second} {
+		if err := kr.Load(context.Background()); err != nil {
+			t.Fatalf("error loading keyring: %v", err)
+		}
+	}
+
+	if err := first.Rotate(context.Background()); err != nil {
+		t.Fatalf("error rotating keyring: %v", err)
+	}
+	signed, _ := first.Sign(testClaims())
+
+	second.mu.Lock()
+	second.lastReload = time.Time{}
+	second.mu.Unlock()
+	if _, err := second.Parse(signed, jwt.MapClaims{}); err != nil {
+		t.Fatalf("expected token from the rotated key to verify on another replica, got: %v", err)
+	}
+}
+
+func TestKeyRingConcurrentRotationKeepsOneActiveKey(t *testing.T) {
+	store := NewMemorySigningKeyStore()
+	rings := []*KeyRing{
+		NewKeyRing("ES256", store, time.Hour, time.Hour),
+		NewKeyRing("ES256", store, time.Hour, time.Hour),
+	}
+	for _, kr := range rings {
+		if err := kr.Load(context.Background()); err != nil {
+			t.Fatalf("error loading keyring: %v", err)
+		}
+	}
+
+	// one replica rotates, the other finds the key due right after and must adopt the new
+	// key instead of activating a second one
+	for _, pair := range [][2]*KeyRing{{rings[0], rings[1]}, {rings[1], rings[0]}} {
+		if err := pair[0].Rotate(context.Background()); err != nil {
+			t.Fatalf("error rotating keyring: %v", err)
+		}
+		if err := pair[1].rotate(context.Background(), time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("error rotating keyring: %v", err)
+		}
+		if pair[0].activeKid != pair[1].activeKid {
+			t.Fatal("expected both replicas to sign with the same key")
+		}
+	}
+
+	keys, _ := store.LoadSigningKeys(context.Background())
+	active := 0
+	for _, key := range keys {
+		if !key.IsRetired() {
+			active++
+		}
+	}
+	if active != 1 {
+		t.Fatalf("expected exactly one active key, got %d", active)
+	}
+}
+
+func TestFallbackKeyRingDefaultsToAsymmetric(t *testing.T) {
+	t.Setenv("JWT_ALGORITHM", "")
+	t.Setenv("JWT_KEY", "fallback-secret")
+	SetKeyRing(nil)
+	t.Cleanup(func() { SetKeyRing(nil) })
+
+	kr := GetKeyRing()
+	if kr.Algorithm() != jwt.SigningMethodES256.Alg() {
+		t.Fatalf("expected the fallback keyring to default to ES256, got %s", kr.Algorithm())
+	}
+	if GetKeyRing() != kr {
+		t.Fatal("expected the fallback keyring to be reused")
+	}
+
+	signed, err := kr.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("error signing with fallback keyring: %v", err)
+	}
+	if _, err := kr.Parse(signed, jwt.MapClaims{}); err != nil {
+		t.Fatalf("expected token to verify, got: %v", err)
+	}
+	hmacSigned, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("fallback-secret"))
+	if _, err := kr.Parse(hmacSigned, jwt.MapClaims{}); err == nil {
+		t.Fatal("expected hmac token signed with JWT_KEY to be rejected")
+	}
+}
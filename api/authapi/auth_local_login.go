@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/internal/hashing"
 	"github.com/babbage88/go-infra/internal/type_helper"
+	"github.com/babbage88/go-infra/services/permission_cache"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -17,7 +19,16 @@ import (
 )
 
 type LocalAuthService struct {
-	DbConn *pgxpool.Pool `json:"dbConn"`
+	DbConn   *pgxpool.Pool   `json:"dbConn"`
+	Mfa      MfaVerifier     `json:"-"`
+	Passkeys PasskeyVerifier `json:"-"`
+	Throttle LoginThrottler  `json:"-"`
+	// Shared attempt and single use state of MFA challenges, process local when nil
+	MfaChallenges MfaChallengeStore `json:"-"`
+	// Password login is refused until the user confirmed their email address
+	RequireVerifiedEmail bool `json:"requireVerifiedEmail"`
+	// Password login is refused for users with a passkey holding any of these permissions
+	PasskeyRequiredPermissions []string `json:"passkeyRequiredPermissions"`
 }
 
 func NewLoginRequest(username string, password string, isHashed bool) *UserLoginRequest {
@@ -63,6 +74,13 @@ func (us *LocalAuthService) VerifyUserPermissionByRole(roleId uuid.UUID, permiss
 }
 
 func (a *LocalAuthService) CreateAuthTokenOnLogin(id uuid.UUID, roleIds uuid.UUIDs, email string) (AuthToken, error) {
+	return a.createSessionTokens(context.Background(), id, roleIds, email, uuid.Nil)
+}
+
+// createSessionTokens starts a new session in orgId, or in the user's first organization
+// when orgId is nil. The access token carries the roles the user holds there on top of
+// roleIds.
+func (a *LocalAuthService) createSessionTokens(ctx context.Context, id uuid.UUID, roleIds uuid.UUIDs, email string, orgId uuid.UUID) (AuthToken, error) {
 	tokens := AuthToken{UserID: id}
 	var expireMinutes int
 	envExp := os.Getenv("EXPIRATION_MINUTES")
@@ -72,19 +90,29 @@ func (a *LocalAuthService) CreateAuthTokenOnLogin(id uuid.UUID, roleIds uuid.UUI
 		expireMinutes = int(15)
 	}
 	expireMinutes = expireMinutesInt
-	signingMethod := getJwtSigningMenthodFromEnv()
 	expTime := time.Now().Add(time.Minute * time.Duration(expireMinutes))
 	tokens.Expiration = expTime
 
+	session, err := resolveOrgSession(ctx, id, orgId)
+	if err != nil {
+		return tokens, err
+	}
+	tokens.OrganizationId = session.OrgId
+
+	roleIds, err = withGroupRoles(ctx, id, roleIds)
+	if err != nil {
+		return tokens, err
+	}
+
 	// Create access accessToken
-	accessToken, err := NewAccessTokenWithExp(id, roleIds, email, signingMethod, expTime)
+	accessToken, err := NewOrgAccessTokenWithExp(id, mergeRoleIds(roleIds, session.RoleIds), email, session.OrgId, expTime)
 
 	if err != nil {
 		return tokens, err
 	}
 	tokens.Token = accessToken
 
-	refreshToken, err := NewRefreshToken(id, signingMethod)
+	_, refreshToken, err := a.issueRefreshToken(ctx, id, uuid.New(), session.OrgId)
 
 	if err != nil {
 		return tokens, err
@@ -124,6 +152,22 @@ func (a *LocalAuthService) Login(loginReq *UserLoginRequest) UserLoginResponse {
 		response.Result = result
 		return response
 	}
+	if a.RequireVerifiedEmail {
+		verified, err := queries.IsUserEmailVerified(context.Background(), qry.ID)
+		if err != nil || !verified {
+			slog.Error("User email is not verified", slog.String("User", loginReq.UserName))
+			result.Success = false
+			result.UserEnabled = qry.Enabled
+			result.Error = errors.New("email is not verified")
+			response.Result = result
+			return response
+		}
+	}
+
+	if hashing.NeedsRehash(qry.Password.String) {
+		a.rehashPassword(qry.ID, loginReq.Password)
+	}
+
 	slog.Info("Login was Successful")
 	result.Success = true
 	result.Error = nil
@@ -135,33 +179,40 @@ func (a *LocalAuthService) Login(loginReq *UserLoginRequest) UserLoginResponse {
 	return response
 }
 
-func (a *LocalAuthService) VerifyToken(tokenString string) error {
-	jwtKey := []byte(os.Getenv("JWT_KEY"))
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
+// rehashPassword upgrades bcrypt or outdated Argon2id hashes with the current parameters.
+// Failures are only logged since the login itself succeeded.
+func (a *LocalAuthService) rehashPassword(userId uuid.UUID, password string) {
+	hashed, err := hashing.HashPassword(password)
 	if err != nil {
-		return err
+		slog.Error("Error rehashing password", slog.String("error", err.Error()))
+		return
 	}
-
-	if !token.Valid {
-		return fmt.Errorf("invalid token")
+	queries := infra_db_pg.New(a.DbConn)
+	err = queries.UpdateUserPasswordById(context.Background(), infra_db_pg.UpdateUserPasswordByIdParams{
+		ID:       userId,
+		Password: pgtype.Text{String: hashed, Valid: true},
+	})
+	if err != nil {
+		slog.Error("Error storing rehashed password", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return
 	}
+	slog.Info("Upgraded password hash", slog.String("userId", userId.String()))
+}
 
-	return nil
+func (a *LocalAuthService) VerifyToken(tokenString string) error {
+	_, err := ValidateAccessToken(tokenString)
+	return err
 }
 
 func (ua *LocalAuthService) ParseAccessToken(accessToken string) *InfraJWTClaim {
-	jwtKey := os.Getenv("JWT_KEY")
-	parsedAccessToken, _ := jwt.ParseWithClaims(accessToken, &InfraJWTClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jwtKey), nil
-	})
-
-	return parsedAccessToken.Claims.(*InfraJWTClaim)
+	return ParseAccessToken(accessToken)
 }
 
 func (ua *LocalAuthService) VerifyUserRolesForPermission(roleIds uuid.UUIDs, permissionName string) (bool, error) {
+	if cache := permission_cache.Default(); cache != nil {
+		return cache.HasPermission(context.Background(), roleIds, permissionName)
+	}
+
 	var lastError error // Store any encountered errors for logging or debugging
 
 	for _, roleId := range roleIds {
@@ -185,11 +236,14 @@ func (ua *LocalAuthService) VerifyUserRolesForPermission(roleIds uuid.UUIDs, per
 	return false, lastError
 }
 
+// defaultSigningMethod signs tokens when JWT_ALGORITHM is not set.
+var defaultSigningMethod jwt.SigningMethod = jwt.SigningMethodES256
+
 func getJwtSigningMenthodFromEnv() jwt.SigningMethod {
 	jwt_algo := os.Getenv("JWT_ALGORITHM")
 	if len(jwt_algo) < 1 {
-		slog.Info("No JWT_ALGORITHM set, defaulting to HS256")
-		return jwt.SigningMethodHS256
+		slog.Info("No JWT_ALGORITHM set, using the default", slog.String("algorithm", defaultSigningMethod.Alg()))
+		return defaultSigningMethod
 	}
 
 	signingMethod := jwt.GetSigningMethod(jwt_algo)
@@ -0,0 +1,67 @@
+package authapi
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// LoginThrottler tracks failed logins per username and client IP. It is an interface so
+// the counters can live in Postgres or Valkey and be shared between replicas.
+type LoginThrottler interface {
+	// CheckLogin returns how long the caller must wait before trying again, zero if allowed.
+	CheckLogin(ctx context.Context, username string, clientIp string) (time.Duration, error)
+	RecordLoginFailure(ctx context.Context, username string, clientIp string) error
+	RecordLoginSuccess(ctx context.Context, username string, clientIp string) error
+}
+
+// CheckLoginThrottle fails open when the throttle backend errors so an outage of the
+// counter store does not lock everybody out.
+func (a *LocalAuthService) CheckLoginThrottle(username string, clientIp string) time.Duration {
+	if a.Throttle == nil {
+		return 0
+	}
+	retryAfter, err := a.Throttle.CheckLogin(context.Background(), username, clientIp)
+	if err != nil {
+		slog.Error("Error checking login throttle", slog.String("error", err.Error()))
+		return 0
+	}
+	return retryAfter
+}
+
+func (a *LocalAuthService) RecordLoginResult(username string, clientIp string, success bool) {
+	if a.Throttle == nil {
+		return
+	}
+	var err error
+	if success {
+		err = a.Throttle.RecordLoginSuccess(context.Background(), username, clientIp)
+	} else {
+		err = a.Throttle.RecordLoginFailure(context.Background(), username, clientIp)
+	}
+	if err != nil {
+		slog.Error("Error recording login attempt", slog.String("error", err.Error()))
+	}
+}
+
+// ClientIP returns the address of the caller. Forwarding headers are only honored when
+// LOGIN_TRUST_PROXY_HEADERS is true, otherwise clients could pick their own throttle key.
+func ClientIP(r *http.Request) string {
+	if strings.EqualFold(os.Getenv("LOGIN_TRUST_PROXY_HEADERS"), "true") {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,223 @@
+package authapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	mfaChallengeTokenType   = "mfa_challenge"
+	mfaChallengeLifetime    = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+)
+
+var (
+	ErrMfaNotConfigured    = errors.New("mfa is not configured")
+	ErrMfaChallengeInvalid = errors.New("invalid or expired mfa challenge")
+	ErrMfaTooManyAttempts  = errors.New("too many mfa attempts, please login again")
+	ErrMfaCodeInvalid      = errors.New("invalid mfa code")
+)
+
+// MfaVerifier is implemented by the MFA provider. It is an interface so authapi does not
+// depend on the secret storage the provider uses.
+type MfaVerifier interface {
+	IsMfaEnabled(userId uuid.UUID) (bool, error)
+	VerifyMfaCode(userId uuid.UUID, code string) (bool, error)
+}
+
+// MfaChallengeStore limits guesses per challenge and makes each challenge single use. It
+// must be shared between replicas, user_mfa provides Postgres and Valkey implementations.
+type MfaChallengeStore interface {
+	// RecordAttempt counts a code submitted for the challenge and returns the attempts so
+	// far, including this one, and whether the challenge was already completed.
+	RecordAttempt(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (int64, bool, error)
+	// Complete marks the challenge used and reports false when it was used before.
+	Complete(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (bool, error)
+}
+
+type mfaAttempt struct {
+	attempts  int64
+	completed bool
+	expires   time.Time
+}
+
+// memoryMfaChallengeStore keeps challenge state in process memory. It is only used when no
+// shared store is configured, for tests and single instance setups.
+type memoryMfaChallengeStore struct {
+	mu       sync.Mutex
+	attempts map[uuid.UUID]*mfaAttempt
+}
+
+var localMfaChallenges = &memoryMfaChallengeStore{attempts: make(map[uuid.UUID]*mfaAttempt)}
+
+func (t *memoryMfaChallengeStore) get(jti uuid.UUID, expires time.Time) *mfaAttempt {
+	now := time.Now()
+	for id, a := range t.attempts {
+		if now.After(a.expires) {
+			delete(t.attempts, id)
+		}
+	}
+	a, ok := t.attempts[jti]
+	if !ok {
+		a = &mfaAttempt{expires: expires}
+		t.attempts[jti] = a
+	}
+	return a
+}
+
+func (t *memoryMfaChallengeStore) RecordAttempt(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (int64, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a := t.get(jti, expiresAt)
+	a.attempts++
+	return a.attempts, a.completed, nil
+}
+
+func (t *memoryMfaChallengeStore) Complete(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a := t.get(jti, expiresAt)
+	if a.completed {
+		return false, nil
+	}
+	a.completed = true
+	return true, nil
+}
+
+func (a *LocalAuthService) mfaChallengeStore() MfaChallengeStore {
+	if a.MfaChallenges != nil {
+		return a.MfaChallenges
+	}
+	return localMfaChallenges
+}
+
+func (a *LocalAuthService) IsMfaRequired(userId uuid.UUID) (bool, error) {
+	if a.Mfa == nil {
+		return false, nil
+	}
+	return a.Mfa.IsMfaEnabled(userId)
+}
+
+// CreateMfaChallenge signs a short lived token proving the password step succeeded. The
+// username is carried so failed codes count against the same login throttle key.
+func (a *LocalAuthService) CreateMfaChallenge(userId uuid.UUID, username string) (string, error) {
+	claims := jwt.MapClaims{}
+	claims["sub"] = userId
+	claims["username"] = username
+	claims["jti"] = uuid.New()
+	claims["typ"] = mfaChallengeTokenType
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(mfaChallengeLifetime).Unix()
+
+	return GetKeyRing().Sign(claims)
+}
+
+func parseMfaChallenge(challengeToken string) (uuid.UUID, uuid.UUID, time.Time, error) {
+	token, err := GetKeyRing().Parse(challengeToken, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return uuid.Nil, uuid.Nil, time.Time{}, ErrMfaChallengeInvalid
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != mfaChallengeTokenType {
+		return uuid.Nil, uuid.Nil, time.Time{}, ErrMfaChallengeInvalid
+	}
+
+	jti, err := getJtiFromClaims(claims)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, ErrMfaChallengeInvalid
+	}
+	sub, err := claims.GetSubject()
+	if err != nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, ErrMfaChallengeInvalid
+	}
+	userId, err := uuid.Parse(sub)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, ErrMfaChallengeInvalid
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, ErrMfaChallengeInvalid
+	}
+	return userId, jti, exp.Time, nil
+}
+
+// MfaChallengeUsername returns the username a valid challenge was issued for, or an empty
+// string so only the client IP is throttled.
+func MfaChallengeUsername(challengeToken string) string {
+	token, err := GetKeyRing().Parse(challengeToken, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != mfaChallengeTokenType {
+		return ""
+	}
+	username, _ := claims["username"].(string)
+	return username
+}
+
+// CompleteMfaLogin exchanges a challenge token and a TOTP or recovery code for the same
+// tokens CreateAuthTokenOnLogin returns.
+func (a *LocalAuthService) CompleteMfaLogin(challengeToken string, code string) (AuthToken, error) {
+	var tokens AuthToken
+	if a.Mfa == nil {
+		return tokens, ErrMfaNotConfigured
+	}
+
+	userId, jti, expires, err := parseMfaChallenge(challengeToken)
+	if err != nil {
+		return tokens, err
+	}
+	ctx := context.Background()
+	challenges := a.mfaChallengeStore()
+	// the attempt is counted before the code is checked so parallel guesses can not
+	// exceed the cap, store errors fail closed
+	attempts, completed, err := challenges.RecordAttempt(ctx, jti, expires)
+	if err != nil {
+		slog.Error("Error recording mfa challenge attempt", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return tokens, ErrMfaChallengeInvalid
+	}
+	if completed {
+		return tokens, ErrMfaChallengeInvalid
+	}
+	if attempts > mfaChallengeMaxAttempts {
+		return tokens, ErrMfaTooManyAttempts
+	}
+
+	valid, err := a.Mfa.VerifyMfaCode(userId, code)
+	if err != nil {
+		slog.Error("Error verifying mfa code", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return tokens, ErrMfaCodeInvalid
+	}
+	if !valid {
+		slog.Warn("Invalid mfa code supplied", slog.String("userId", userId.String()))
+		return tokens, ErrMfaCodeInvalid
+	}
+	if ok, err := challenges.Complete(ctx, jti, expires); err != nil || !ok {
+		return tokens, ErrMfaChallengeInvalid
+	}
+
+	// Get the user record again so a user disabled during the challenge can not log in
+	usrInfo, err := a.GetUserById(userId)
+	if err != nil {
+		return tokens, err
+	}
+	if !usrInfo.Enabled {
+		return tokens, fmt.Errorf("user is disabled")
+	}
+
+	tokens, err = a.CreateAuthTokenOnLogin(usrInfo.Id, usrInfo.RoleIds, usrInfo.Email)
+	if err != nil {
+		return tokens, err
+	}
+	tokens.Username = usrInfo.UserName
+	tokens.Email = usrInfo.Email
+	return tokens, nil
+}
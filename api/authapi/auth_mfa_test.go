@@ -0,0 +1,153 @@
+package authapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeMfaVerifier struct {
+	calls int
+}
+
+func (f *fakeMfaVerifier) IsMfaEnabled(userId uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeMfaVerifier) VerifyMfaCode(userId uuid.UUID, code string) (bool, error) {
+	f.calls++
+	return false, nil
+}
+
+func TestMfaChallengeIsNotAnAccessToken(t *testing.T) {
+	SetKeyRing(nil)
+
+	auth := &LocalAuthService{Mfa: &fakeMfaVerifier{}}
+	challenge, err := auth.CreateMfaChallenge(uuid.New(), "mfa-user")
+	if err != nil {
+		t.Fatalf("error creating mfa challenge: %v", err)
+	}
+	if _, err := ValidateAccessToken(challenge); err == nil {
+		t.Fatal("expected mfa challenge to be rejected as an access token")
+	}
+
+	accessToken, err := NewAccessToken(uuid.New(), uuid.UUIDs{uuid.New()}, "user@example.com")
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+	if _, err := auth.CompleteMfaLogin(accessToken, "123456"); !errors.Is(err, ErrMfaChallengeInvalid) {
+		t.Fatalf("expected access token to be rejected as an mfa challenge, got: %v", err)
+	}
+}
+
+func TestMfaChallengeAttemptLimit(t *testing.T) {
+	SetKeyRing(nil)
+
+	verifier := &fakeMfaVerifier{}
+	auth := &LocalAuthService{Mfa: verifier}
+	challenge, err := auth.CreateMfaChallenge(uuid.New(), "mfa-user")
+	if err != nil {
+		t.Fatalf("error creating mfa challenge: %v", err)
+	}
+
+	for i := 0; i < mfaChallengeMaxAttempts; i++ {
+		if _, err := auth.CompleteMfaLogin(challenge, "000000"); !errors.Is(err, ErrMfaCodeInvalid) {
+			t.Fatalf("attempt %d: expected invalid code error, got: %v", i, err)
+		}
+	}
+	if _, err := auth.CompleteMfaLogin(challenge, "000000"); !errors.Is(err, ErrMfaTooManyAttempts) {
+		t.Fatalf("expected too many attempts error, got: %v", err)
+	}
+	if verifier.calls != mfaChallengeMaxAttempts {
+		t.Fatalf("expected verifier to stop being called after %d attempts, got %d calls", mfaChallengeMaxAttempts, verifier.calls)
+	}
+}
+
+func TestMfaChallengeAttemptLimitIsSharedBetweenReplicas(t *testing.T) {
+	SetKeyRing(nil)
+
+	shared := &memoryMfaChallengeStore{attempts: make(map[uuid.UUID]*mfaAttempt)}
+	replicas := []*LocalAuthService{
+		{Mfa: &fakeMfaVerifier{}, MfaChallenges: shared},
+		{Mfa: &fakeMfaVerifier{}, MfaChallenges: shared},
+	}
+	challenge, err := replicas[0].CreateMfaChallenge(uuid.New(), "mfa-user")
+	if err != nil {
+		t.Fatalf("error creating mfa challenge: %v", err)
+	}
+
+	for i := 0; i < mfaChallengeMaxAttempts; i++ {
+		if _, err := replicas[i%2].CompleteMfaLogin(challenge, "000000"); !errors.Is(err, ErrMfaCodeInvalid) {
+			t.Fatalf("attempt %d: expected invalid code error, got: %v", i, err)
+		}
+	}
+	for _, replica := range replicas {
+		if _, err := replica.CompleteMfaLogin(challenge, "000000"); !errors.Is(err, ErrMfaTooManyAttempts) {
+			t.Fatalf("expected too many attempts error on every replica, got: %v", err)
+		}
+	}
+}
+
+type fakeLoginThrottler struct {
+	failures  []string
+	successes []string
+	lockout   time.Duration
+}
+
+func (f *fakeLoginThrottler) CheckLogin(ctx context.Context, username string, clientIp string) (time.Duration, error) {
+	return f.lockout, nil
+}
+
+func (f *fakeLoginThrottler) RecordLoginFailure(ctx context.Context, username string, clientIp string) error {
+	f.failures = append(f.failures, username+"@"+clientIp)
+	return nil
+}
+
+func (f *fakeLoginThrottler) RecordLoginSuccess(ctx context.Context, username string, clientIp string) error {
+	f.successes = append(f.successes, username+"@"+clientIp)
+	return nil
+}
+
+func TestMfaFailuresCountAgainstLoginThrottle(t *testing.T) {
+	SetKeyRing(nil)
+
+	throttle := &fakeLoginThrottler{}
+	auth := &LocalAuthService{Mfa: &fakeMfaVerifier{}, Throttle: throttle}
+	challenge, err := auth.CreateMfaChallenge(uuid.New(), "mfa-user")
+	if err != nil {
+		t.Fatalf("error creating mfa challenge: %v", err)
+	}
+
+	submit := func() *httptest.ResponseRecorder {
+		body := `{"mfaToken":"` + challenge + `","code":"000000"}`
+		req := httptest.NewRequest(http.MethodPost, "/login/mfa", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.10:4242"
+		rec := httptest.NewRecorder()
+		LoginMfaHandleFunc(auth)(rec, req)
+		return rec
+	}
+
+	if rec := submit(); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected invalid code to be rejected with 401, got %d", rec.Code)
+	}
+	if len(throttle.failures) != 1 || throttle.failures[0] != "mfa-user@192.0.2.10" {
+		t.Fatalf("expected the failed code to be recorded for the username and IP, got %v", throttle.failures)
+	}
+	if len(throttle.successes) != 0 {
+		t.Fatalf("expected no throttle reset after a failed code, got %v", throttle.successes)
+	}
+
+	throttle.lockout = time.Minute
+	if rec := submit(); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected locked out login to be rejected with 429, got %d", rec.Code)
+	}
+	if len(throttle.failures) != 1 {
+		t.Fatalf("expected the code not to be checked while locked out, got %v", throttle.failures)
+	}
+}
@@ -0,0 +1,152 @@
+package authapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// orgIdClaim holds the active organization of an access token.
+const orgIdClaim = "org_id"
+
+var ErrOrganizationsNotEnabled = errors.New("organizations are not enabled")
+
+// resolveOrgSession returns the organization session of a new token. Without a configured
+// tenancy tokens act in no organization and carry only the global roles.
+func resolveOrgSession(ctx context.Context, userId uuid.UUID, orgId uuid.UUID) (organizations.Session, error) {
+	tenancy := organizations.Default()
+	if tenancy == nil {
+		return organizations.Session{}, nil
+	}
+	return tenancy.ResolveSession(ctx, userId, orgId)
+}
+
+// mergeRoleIds appends the group and organization roles that are not already global roles.
+func mergeRoleIds(roleIds uuid.UUIDs, extra ...uuid.UUIDs) uuid.UUIDs {
+	merged := slices.Clone(roleIds)
+	for _, ids := range extra {
+		for _, roleId := range ids {
+			if !slices.Contains(merged, roleId) {
+				merged = append(merged, roleId)
+			}
+		}
+	}
+	return merged
+}
+
+// GetActiveOrgFromClaims returns the org_id claim, uuid.Nil when the token acts in no
+// organization.
+func GetActiveOrgFromClaims(claims jwt.MapClaims) uuid.UUID {
+	raw, ok := claims[orgIdClaim].(string)
+	if !ok {
+		return uuid.Nil
+	}
+	orgId, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil
+	}
+	return orgId
+}
+
+// SwitchOrganization starts a new session for the user in orgId, which the user must be a
+// member of.
+func (a *LocalAuthService) SwitchOrganization(userId uuid.UUID, orgId uuid.UUID) (AuthToken, error) {
+	if organizations.Default() == nil {
+		return AuthToken{UserID: userId}, ErrOrganizationsNotEnabled
+	}
+	usrInfo, err := a.GetUserById(userId)
+	if err != nil {
+		return AuthToken{UserID: userId}, err
+	}
+
+	tokens, err := a.createSessionTokens(context.Background(), usrInfo.Id, usrInfo.RoleIds, usrInfo.Email, orgId)
+	if err != nil {
+		return tokens, err
+	}
+	tokens.Email = usrInfo.Email
+	tokens.Username = usrInfo.UserName
+	return tokens, nil
+}
+
+// swagger:route POST /auth/organizations/switch Authentication SwitchOrganization
+// Get a new token pair acting in another organization of the caller. When refreshToken is
+// set the session it belongs to is ended.
+// responses:
+//
+//	200: SwitchOrganizationResponse
+//	400: description:Bad Request
+//	401: description:Unauthorized
+//	403: description:Not a member of the organization
+func SwitchOrganizationHandler(ua AuthService) http.Handler {
+	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userId, err := GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		var req SwitchOrganizationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrganizationId == uuid.Nil {
+			http.Error(w, `{"error":"organizationId is required"}`, http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := ua.SwitchOrganization(userId, req.OrganizationId)
+		switch {
+		case errors.Is(err, organizations.ErrNotMember):
+			http.Error(w, `{"error":"not a member of the organization"}`, http.StatusForbidden)
+			return
+		case errors.Is(err, ErrOrganizationsNotEnabled):
+			http.Error(w, `{"error":"organizations are not enabled"}`, http.StatusBadRequest)
+			return
+		case err != nil:
+			slog.Error("Error switching organization", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+			http.Error(w, `{"error":"Internal Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+
+		if req.RefreshToken != "" {
+			if err := ua.Logout(userId, req.RefreshToken, false); err != nil {
+				slog.Warn("Error ending previous session on organization switch", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+			}
+		}
+
+		resp := SwitchOrganizationResponseWrapper{Body: tokens}
+		json.NewEncoder(w).Encode(resp.Body)
+	}))
+}
+
+// swagger:route GET /auth/organizations Authentication GetMyOrganizations
+// List the organizations the caller can switch into and the one the token acts in.
+// responses:
+//
+//	200: MyOrganizationsResponse
+//	401: description:Unauthorized
+func MyOrganizationsHandler(manager organizations.OrganizationManager) http.Handler {
+	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userId, err := GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		orgs, err := manager.GetUserOrganizations(r.Context(), userId)
+		if err != nil {
+			http.Error(w, `{"error":"Internal Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+
+		resp := MyOrganizationsResponseWrapper{Body: MyOrganizations{Organizations: orgs}}
+		resp.Body.ActiveOrganizationId, _ = organizations.ActiveOrgFromContext(r.Context())
+		json.NewEncoder(w).Encode(resp.Body)
+	}))
+}
@@ -0,0 +1,54 @@
+package authapi
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestOrgAccessTokenCarriesActiveOrg(t *testing.T) {
+	SetKeyRing(nil)
+
+	orgId := uuid.New()
+	token, err := NewOrgAccessTokenWithExp(uuid.New(), uuid.UUIDs{uuid.New()}, "user@example.com", orgId, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+	claims, err := ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("error validating access token: %v", err)
+	}
+	if got := GetActiveOrgFromClaims(claims); got != orgId {
+		t.Errorf("expected org %s, got %s", orgId, got)
+	}
+
+	token, err = NewAccessTokenWithExp(uuid.New(), uuid.UUIDs{uuid.New()}, "user@example.com", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+	claims, err = ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("error validating access token: %v", err)
+	}
+	if _, ok := claims[orgIdClaim]; ok {
+		t.Error("expected no org_id claim on a token without an organization")
+	}
+	if got := GetActiveOrgFromClaims(claims); got != uuid.Nil {
+		t.Errorf("expected nil org, got %s", got)
+	}
+}
+
+func TestMergeRoleIdsKeepsGlobalRolesFirst(t *testing.T) {
+	global, shared, orgOnly := uuid.New(), uuid.New(), uuid.New()
+	roleIds := uuid.UUIDs{global, shared}
+
+	merged := mergeRoleIds(roleIds, uuid.UUIDs{shared, orgOnly})
+	if !slices.Equal(merged, uuid.UUIDs{global, shared, orgOnly}) {
+		t.Errorf("unexpected merged roles %v", merged)
+	}
+	if len(roleIds) != 2 {
+		t.Errorf("expected global roles to be left unchanged, got %v", roleIds)
+	}
+}
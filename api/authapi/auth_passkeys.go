@@ -0,0 +1,44 @@
+package authapi
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// PasskeyVerifier is implemented by the WebAuthn provider.
+type PasskeyVerifier interface {
+	HasPasskeys(userId uuid.UUID) (bool, error)
+}
+
+// IsPasskeyRequired reports whether password login must be refused because the user
+// holds one of PasskeyRequiredPermissions and has a registered passkey. Users without a
+// passkey can still log in with a password so they are able to register one.
+func (a *LocalAuthService) IsPasskeyRequired(userId uuid.UUID, roleIds uuid.UUIDs) (bool, error) {
+	if a.Passkeys == nil || len(a.PasskeyRequiredPermissions) == 0 {
+		return false, nil
+	}
+
+	roleIds, err := withGroupRoles(context.Background(), userId, roleIds)
+	if err != nil {
+		return false, err
+	}
+
+	privileged := false
+	for _, permission := range a.PasskeyRequiredPermissions {
+		hasPermission, err := a.VerifyUserRolesForPermission(roleIds, permission)
+		if err != nil {
+			slog.Error("Error verifying permission for passkey requirement", slog.String("permission", permission), slog.String("error", err.Error()))
+		}
+		if hasPermission {
+			privileged = true
+			break
+		}
+	}
+	if !privileged {
+		return false, nil
+	}
+
+	return a.Passkeys.HasPasskeys(userId)
+}
@@ -0,0 +1,56 @@
+package authapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type fakePatValidator struct {
+	info *PersonalAccessTokenInfo
+}
+
+func (f *fakePatValidator) ValidatePersonalAccessToken(ctx context.Context, token string) (*PersonalAccessTokenInfo, error) {
+	return f.info, nil
+}
+
+// allowAllRoles grants every permission so only the token scopes decide.
+type allowAllRoles struct {
+	AuthService
+}
+
+func (allowAllRoles) VerifyUserRolesForPermission(roleIds uuid.UUIDs, permissionName string) (bool, error) {
+	return true, nil
+}
+
+func TestPersonalAccessTokenScopesIntersectPermissions(t *testing.T) {
+	SetPersonalAccessTokenValidator(&fakePatValidator{info: &PersonalAccessTokenInfo{
+		TokenId: uuid.New(),
+		UserId:  uuid.New(),
+		RoleIds: uuid.UUIDs{uuid.New()},
+		Scopes:  []string{"ReadHostServers"},
+	}})
+	t.Cleanup(func() { SetPersonalAccessTokenValidator(nil) })
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(h http.Handler) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+PersonalAccessTokenPrefix+"test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(AuthMiddlewareRequirePermission(allowAllRoles{}, "ReadHostServers", ok)); code != http.StatusOK {
+		t.Fatalf("expected in-scope permission to be granted, got %d", code)
+	}
+	if code := serve(AuthMiddlewareRequirePermission(allowAllRoles{}, "CreateUser", ok)); code != http.StatusUnauthorized {
+		t.Fatalf("expected out-of-scope permission to be denied, got %d", code)
+	}
+	if code := serve(AuthMiddleware(ok)); code != http.StatusUnauthorized {
+		t.Fatalf("expected personal access token to be rejected by AuthMiddleware, got %d", code)
+	}
+}
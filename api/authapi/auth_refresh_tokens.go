@@ -0,0 +1,230 @@
+package authapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/token_denylist"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const refreshTokenType = "refresh"
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenRevoked  = errors.New("refresh token has been revoked")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected, token family revoked")
+	ErrRefreshTokenExpired  = errors.New("refresh token has expired")
+)
+
+// hashRefreshToken returns the hex encoded SHA-256 of a refresh token. Only the hash is
+// stored so a database leak does not leak usable tokens.
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRefreshToken signs a new refresh token in the given family and stores its hash
+// together with the active organization of the session.
+func (a *LocalAuthService) issueRefreshToken(ctx context.Context, userId uuid.UUID, familyId uuid.UUID, orgId uuid.UUID) (uuid.UUID, string, error) {
+	tokenId := uuid.New()
+	refreshToken, err := storeRefreshToken(ctx, infra_db_pg.New(a.DbConn), tokenId, userId, familyId, orgId)
+	return tokenId, refreshToken, err
+}
+
+// storeRefreshToken signs the refresh token tokenId and inserts its hash through qry, which
+// may be bound to a transaction.
+func storeRefreshToken(ctx context.Context, qry *infra_db_pg.Queries, tokenId uuid.UUID, userId uuid.UUID, familyId uuid.UUID, orgId uuid.UUID) (string, error) {
+	expTime := time.Now().Add(refreshTokenLifetime())
+
+	refreshToken, err := NewRefreshTokenWithExp(userId, familyId, tokenId, expTime)
+	if err != nil {
+		return "", err
+	}
+
+	err = qry.InsertRefreshToken(ctx, infra_db_pg.InsertRefreshTokenParams{
+		ID:        tokenId,
+		UserID:    userId,
+		FamilyID:  familyId,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: pgtype.Timestamptz{Time: expTime, Valid: true},
+		OrgID:     pgtype.UUID{Bytes: orgId, Valid: orgId != uuid.Nil},
+	})
+	if err != nil {
+		slog.Error("Error storing refresh token", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return "", fmt.Errorf("error storing refresh token: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+// lookupRefreshToken verifies the refresh token signature and returns its stored record.
+func (a *LocalAuthService) lookupRefreshToken(ctx context.Context, refreshToken string) (infra_db_pg.RefreshToken, error) {
+	token, err := GetKeyRing().Parse(refreshToken, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return infra_db_pg.RefreshToken{}, fmt.Errorf("refresh token validation error %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != refreshTokenType {
+		return infra_db_pg.RefreshToken{}, fmt.Errorf("token is not a refresh token")
+	}
+
+	qry := infra_db_pg.New(a.DbConn)
+	stored, err := qry.GetRefreshTokenByHash(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return stored, ErrRefreshTokenNotFound
+		}
+		return stored, fmt.Errorf("error retrieving refresh token: %w", err)
+	}
+	return stored, nil
+}
+
+// rotateRefreshToken marks the presented token as used and issues its replacement in the
+// same family. Presenting a token that was already rotated revokes the whole family, since
+// either the client or an attacker is holding a stolen copy. The old token is claimed before
+// the replacement is stored and both happen in one transaction, so a request that loses a
+// race never leaves a live token behind. issue runs after the claim and before the commit;
+// when it fails nothing is committed and the presented token stays valid.
+func (a *LocalAuthService) rotateRefreshToken(ctx context.Context, refreshToken string, issue func(stored infra_db_pg.RefreshToken) error) (infra_db_pg.RefreshToken, string, error) {
+	stored, err := a.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return stored, "", err
+	}
+
+	if stored.RevokedAt.Valid {
+		return stored, "", ErrRefreshTokenRevoked
+	}
+	if stored.RotatedAt.Valid {
+		a.revokeRefreshTokenFamily(ctx, stored)
+		return stored, "", ErrRefreshTokenReused
+	}
+	if time.Now().After(stored.ExpiresAt.Time) {
+		return stored, "", ErrRefreshTokenExpired
+	}
+
+	tx, err := a.DbConn.Begin(ctx)
+	if err != nil {
+		return stored, "", fmt.Errorf("error rotating refresh token: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	newTokenId := uuid.New()
+	qry := infra_db_pg.New(tx)
+	rows, err := qry.RotateRefreshToken(ctx, infra_db_pg.RotateRefreshTokenParams{
+		ID:         stored.ID,
+		ReplacedBy: pgtype.UUID{Bytes: newTokenId, Valid: true},
+	})
+	if err != nil {
+		return stored, "", fmt.Errorf("error rotating refresh token: %w", err)
+	}
+	if rows == 0 {
+		// another request rotated this token between our read and update
+		tx.Rollback(ctx)
+		a.revokeRefreshTokenFamily(ctx, stored)
+		return stored, "", ErrRefreshTokenReused
+	}
+
+	if err := issue(stored); err != nil {
+		return stored, "", err
+	}
+
+	newRefreshToken, err := storeRefreshToken(ctx, qry, newTokenId, stored.UserID, stored.FamilyID, uuid.UUID(stored.OrgID.Bytes))
+	if err != nil {
+		return stored, "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return stored, "", fmt.Errorf("error rotating refresh token: %w", err)
+	}
+
+	return stored, newRefreshToken, nil
+}
+
+func (a *LocalAuthService) revokeRefreshTokenFamily(ctx context.Context, stored infra_db_pg.RefreshToken) {
+	slog.Warn("Revoking refresh token family",
+		slog.String("userId", stored.UserID.String()),
+		slog.String("familyId", stored.FamilyID.String()))
+
+	qry := infra_db_pg.New(a.DbConn)
+	if err := qry.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+		slog.Error("Error revoking refresh token family", slog.String("familyId", stored.FamilyID.String()), slog.String("error", err.Error()))
+	}
+}
+
+// RevokeRefreshToken revokes the family the refresh token belongs to, ending that session.
+func (a *LocalAuthService) RevokeRefreshToken(refreshToken string) error {
+	ctx := context.Background()
+	stored, err := a.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	qry := infra_db_pg.New(a.DbConn)
+	if err := qry.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+		slog.Error("Error revoking refresh token family", slog.String("familyId", stored.FamilyID.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error revoking refresh token: %w", err)
+	}
+	return nil
+}
+
+// Logout revokes the session of the refresh token, which must belong to userId. When
+// allSessions is true every refresh token of the user is revoked.
+func (a *LocalAuthService) Logout(userId uuid.UUID, refreshToken string, allSessions bool) error {
+	ctx := context.Background()
+	qry := infra_db_pg.New(a.DbConn)
+
+	if allSessions {
+		if err := qry.RevokeRefreshTokensByUserId(ctx, userId); err != nil {
+			slog.Error("Error revoking user refresh tokens", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+			return fmt.Errorf("error revoking refresh tokens: %w", err)
+		}
+		if denylist := token_denylist.Default(); denylist != nil {
+			return denylist.RevokeUserTokens(ctx, userId, token_denylist.ReasonLogout)
+		}
+		return nil
+	}
+
+	stored, err := a.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if stored.UserID != userId {
+		return fmt.Errorf("refresh token does not belong to user %s", userId.String())
+	}
+
+	if err := qry.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+		slog.Error("Error revoking refresh token family", slog.String("familyId", stored.FamilyID.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error revoking refresh token: %w", err)
+	}
+	return nil
+}
+
+// StartRefreshTokenCleanup periodically deletes expired refresh token records.
+func (a *LocalAuthService) StartRefreshTokenCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				qry := infra_db_pg.New(a.DbConn)
+				if err := qry.DeleteExpiredRefreshTokens(ctx); err != nil {
+					slog.Error("Error deleting expired refresh tokens", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
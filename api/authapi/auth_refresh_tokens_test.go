@@ -0,0 +1,37 @@
+package authapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRefreshTokenIsNotAnAccessToken(t *testing.T) {
+	SetKeyRing(nil)
+
+	refreshToken, err := NewRefreshTokenWithExp(uuid.New(), uuid.New(), uuid.New(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating refresh token: %v", err)
+	}
+	if _, err := ValidateAccessToken(refreshToken); err == nil {
+		t.Fatal("expected refresh token to be rejected as an access token")
+	}
+
+	accessToken, err := NewAccessTokenWithExp(uuid.New(), uuid.UUIDs{uuid.New()}, "test@example.com", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+	if _, err := ValidateAccessToken(accessToken); err != nil {
+		t.Fatalf("expected access token to validate, got: %v", err)
+	}
+}
+
+func TestHashRefreshTokenIsStable(t *testing.T) {
+	if hashRefreshToken("token-a") != hashRefreshToken("token-a") {
+		t.Fatal("expected hash to be deterministic")
+	}
+	if hashRefreshToken("token-a") == hashRefreshToken("token-b") {
+		t.Fatal("expected different tokens to hash differently")
+	}
+}
@@ -0,0 +1,76 @@
+package authapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/babbage88/go-infra/services/resource_policy"
+	"github.com/google/uuid"
+)
+
+type tagScopedPolicy struct {
+	tag       string
+	resources map[uuid.UUID]resource_policy.Resource
+}
+
+func (p tagScopedPolicy) GrantFor(ctx context.Context, roleIds uuid.UUIDs, permissionName string) (resource_policy.Grant, error) {
+	return resource_policy.Grant{Scopes: []resource_policy.Scope{{Type: resource_policy.ScopeTag, Value: p.tag}}}, nil
+}
+
+func (p tagScopedPolicy) HostServer(ctx context.Context, id uuid.UUID) (resource_policy.Resource, error) {
+	resource, ok := p.resources[id]
+	if !ok {
+		return resource, resource_policy.ErrResourceNotFound
+	}
+	return resource, nil
+}
+
+func (p tagScopedPolicy) HostServers(ctx context.Context) (map[uuid.UUID]resource_policy.Resource, error) {
+	return p.resources, nil
+}
+
+func TestResourcePermissionChecksPathHostServer(t *testing.T) {
+	SetPersonalAccessTokenValidator(&fakePatValidator{info: &PersonalAccessTokenInfo{
+		TokenId: uuid.New(),
+		UserId:  uuid.New(),
+		RoleIds: uuid.UUIDs{uuid.New()},
+		Scopes:  []string{"ReadHostServers"},
+	}})
+	t.Cleanup(func() { SetPersonalAccessTokenValidator(nil) })
+
+	prod, dev := uuid.New(), uuid.New()
+	resource_policy.SetDefault(tagScopedPolicy{tag: "dev", resources: map[uuid.UUID]resource_policy.Resource{
+		prod: {Id: prod, Tags: []string{"prod"}},
+		dev:  {Id: dev, Tags: []string{"dev"}},
+	}})
+	t.Cleanup(func() { resource_policy.SetDefault(nil) })
+
+	var granted bool
+	mux := http.NewServeMux()
+	mux.Handle("/host-servers/{ID}", AuthMiddlewareRequireResourcePermission(allowAllRoles{}, "ReadHostServers", "ID",
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, granted = resource_policy.GrantFromContext(r.Context())
+		})))
+	serve := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+PersonalAccessTokenPrefix+"test")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve("/host-servers/" + dev.String()); code != http.StatusOK || !granted {
+		t.Fatalf("expected in-scope host server to be granted with a grant in context, got %d", code)
+	}
+	if code := serve("/host-servers/" + prod.String()); code != http.StatusForbidden {
+		t.Fatalf("expected out-of-scope host server to be forbidden, got %d", code)
+	}
+	if code := serve("/host-servers/" + uuid.NewString()); code != http.StatusForbidden {
+		t.Fatalf("expected unknown host server to be forbidden for a scoped grant, got %d", code)
+	}
+	if code := serve("/host-servers/web-01"); code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid id to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,18 @@
+package authapi
+
+import (
+	"context"
+
+	"github.com/babbage88/go-infra/services/user_groups"
+	"github.com/google/uuid"
+)
+
+// withGroupRoles adds the roles userId holds through group membership to the roles mapped
+// to the user directly.
+func withGroupRoles(ctx context.Context, userId uuid.UUID, roleIds uuid.UUIDs) (uuid.UUIDs, error) {
+	groupRoleIds, err := user_groups.GroupRoleIds(ctx, userId)
+	if err != nil {
+		return roleIds, err
+	}
+	return mergeRoleIds(roleIds, groupRoleIds), nil
+}
@@ -0,0 +1,30 @@
+package authapi
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/babbage88/go-infra/services/user_groups"
+	"github.com/google/uuid"
+)
+
+type fakeGroupRoles map[uuid.UUID]uuid.UUIDs
+
+func (f fakeGroupRoles) GroupRoleIds(ctx context.Context, userId uuid.UUID) (uuid.UUIDs, error) {
+	return f[userId], nil
+}
+
+func TestWithGroupRolesMergesGroupRoles(t *testing.T) {
+	t.Cleanup(func() { user_groups.SetDefault(nil) })
+	userId, direct, groupOnly := uuid.New(), uuid.New(), uuid.New()
+	user_groups.SetDefault(fakeGroupRoles{userId: {direct, groupOnly}})
+
+	roleIds, err := withGroupRoles(context.Background(), userId, uuid.UUIDs{direct})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(roleIds, uuid.UUIDs{direct, groupOnly}) {
+		t.Errorf("unexpected effective roles %v", roleIds)
+	}
+}
@@ -2,10 +2,13 @@ package userapi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/internal/password_policy"
 	"github.com/babbage88/go-infra/services/user_crud_svc"
 	"github.com/google/uuid"
 )
@@ -17,6 +20,7 @@ import (
 // - bearer:
 // responses:
 // 200: CreateUserResponse
+// 400: description:Password does not meet policy
 // 401: description:Unauthorized
 // 403: description:Forbidden
 // 404: description:Not Found
@@ -41,13 +45,19 @@ func CreateUserHandleFunc(uc_service *user_crud_svc.UserCRUDService) func(w http
 			return
 		}
 
-		newUser, err := uc_service.NewUser(
+		newUser, err := uc_service.NewUser(r.Context(),
 			newUserReq.NewUsername,
 			newUserReq.NewUserPassword,
 			newUserReq.NewUserEmail)
 		if err != nil {
 			slog.Error("Error creating new user", slog.String("Error", err.Error()))
+			var violation *password_policy.PolicyViolationError
+			if errors.As(err, &violation) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			http.Error(w, "Error createing new user "+err.Error(), http.StatusInternalServerError)
+			return
 		}
 		response := CreateUserResponseWrapper{
 			Body: newUser,
@@ -78,6 +88,7 @@ func CreateUserHandler(uc_service *user_crud_svc.UserCRUDService) http.Handler {
 // responses:
 //
 // 200: UserPasswordUpdateResponse
+// 400: description:Password does not meet policy or was used recently
 // 401: description:Unauthorized
 // 403: description:Forbidden
 // 404: description:Not Found
@@ -100,10 +111,15 @@ func UpdateUserPasswordHandleFunc(uc_service *user_crud_svc.UserCRUDService) fun
 				TargetUserId: request.TargetUserId,
 			},
 		}
-		response.Body.Error = uc_service.UpdateUserPasswordById(request.TargetUserId, request.NewPassword)
+		response.Body.Error = uc_service.UpdateUserPasswordById(r.Context(), request.TargetUserId, request.NewPassword)
 		if response.Body.Error != nil {
 			response.Body.Success = false
-			http.Error(w, "error updating user password "+err.Error(), http.StatusUnauthorized)
+			var violation *password_policy.PolicyViolationError
+			if errors.As(response.Body.Error, &violation) {
+				http.Error(w, response.Body.Error.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "error updating user password "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
 		}
 		response.Body.Success = true
@@ -324,7 +340,7 @@ func EnableUserHandleFunc(uc_service *user_crud_svc.UserCRUDService) func(w http
 			},
 		}
 
-		response.Body.ModifiedUserInfo, response.Body.Error = uc_service.EnableUserById(request.TargetUserId)
+		response.Body.ModifiedUserInfo, response.Body.Error = uc_service.EnableUserById(r.Context(), request.TargetUserId)
 		if response.Body.Error != nil {
 			http.Error(w, "error enabling user password "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
@@ -346,6 +362,61 @@ func EnableUserHandler(uc_service *user_crud_svc.UserCRUDService) http.Handler {
 	return http.HandlerFunc(EnableUserHandleFunc(uc_service))
 }
 
+// swagger:route POST /user/unlock UserCRUD UnlockUser
+// Clear the login lockout of the specified target User Id.
+//
+// security:
+// - bearer:
+// responses:
+//
+// 200: EnableDisableUserResponse
+// 401: description:Unauthorized
+// 404: description:Not Found
+// 501: description:Login throttling not configured
+func UnlockUserHandleFunc(uc_service *user_crud_svc.UserCRUDService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var request UnlockUserRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			slog.Error("Failed to decode request body", slog.String("Error", err.Error()))
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		execUserId, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		response := EnableDisableUserResponseWrapper{}
+		response.Body.ModifiedUserInfo, response.Body.Error = uc_service.UnlockUserById(execUserId, request.TargetUserId)
+		if response.Body.Error != nil {
+			if errors.Is(response.Body.Error, user_crud_svc.ErrLockoutsNotConfigured) {
+				http.Error(w, response.Body.Error.Error(), http.StatusNotImplemented)
+				return
+			}
+			http.Error(w, "error unlocking user "+response.Body.Error.Error(), http.StatusNotFound)
+			return
+		}
+
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			slog.Error("Failed to marshal JSON response", slog.String("Error", err.Error()))
+			http.Error(w, "Failed to marshal JSON response: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonResponse)
+	}
+}
+
+func UnlockUserHandler(uc_service *user_crud_svc.UserCRUDService) http.Handler {
+	return http.HandlerFunc(UnlockUserHandleFunc(uc_service))
+}
+
 // swagger:route POST /user/disable UserCRUD DisableUser
 // Disable specified target User Id.
 //
@@ -378,7 +449,7 @@ func DisableUserHandleFunc(uc_service *user_crud_svc.UserCRUDService) func(w htt
 			},
 		}
 
-		response.Body.ModifiedUserInfo, response.Body.Error = uc_service.DisableUserById(request.TargetUserId)
+		response.Body.ModifiedUserInfo, response.Body.Error = uc_service.DisableUserById(r.Context(), request.TargetUserId)
 		if response.Body.Error != nil {
 			http.Error(w, "error enabling user password "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
@@ -433,7 +504,7 @@ func UpdateUserRoleMappingHandleFunc(uc_service *user_crud_svc.UserCRUDService)
 		}
 
 		slog.Info("Updating user role mapping", slog.String("targetUserID", fmt.Sprint(request.TargetUserId)), slog.String("roleID", fmt.Sprint(request.RoleId)))
-		response.Body.Error = uc_service.UpdateUserRoleMapping(request.TargetUserId, request.RoleId)
+		response.Body.Error = uc_service.UpdateUserRoleMapping(r.Context(), request.TargetUserId, request.RoleId)
 		if response.Body.Error != nil {
 			http.Error(w, "error updating user role "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
@@ -489,7 +560,7 @@ func DisableUserRoleMappingHandleFunc(uc_service *user_crud_svc.UserCRUDService)
 		}
 
 		slog.Info("Updating user role mapping", slog.String("targetUserID", fmt.Sprint(request.TargetUserId)), slog.String("roleID", fmt.Sprint(request.RoleId)))
-		response.Body.Error = uc_service.DisableUserRoleMapping(request.TargetUserId, request.RoleId)
+		response.Body.Error = uc_service.DisableUserRoleMapping(r.Context(), request.TargetUserId, request.RoleId)
 		if response.Body.Error != nil {
 			http.Error(w, "error updating user role "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
@@ -546,7 +617,7 @@ func CreateUserRoleHandleFunc(uc_service *user_crud_svc.UserCRUDService) func(w
 		}
 
 		slog.Info("CreateorUpdate user role", slog.String("RoleName", request.RoleName))
-		response.Body.NewUserRoleInfo, response.Body.Error = uc_service.CreateOrUpdateUserRole(request.RoleName, request.RoleDescription)
+		response.Body.NewUserRoleInfo, response.Body.Error = uc_service.CreateOrUpdateUserRole(r.Context(), request.RoleName, request.RoleDescription)
 		if response.Body.Error != nil {
 			http.Error(w, "error creating role "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
@@ -654,7 +725,7 @@ func CreateRolePermissionMappingHandleFunc(uc_service *user_crud_svc.UserCRUDSer
 			},
 		}
 
-		response.Body.NewMappingInfo, response.Body.Error = uc_service.CreateOrUpdateRolePermisssionMapping(request.RoleId, request.PermissionId)
+		response.Body.NewMappingInfo, response.Body.Error = uc_service.CreateOrUpdateRolePermisssionMapping(r.Context(), request.RoleId, request.PermissionId)
 		if response.Body.Error != nil {
 			http.Error(w, "error creating role permission mapping "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
@@ -708,7 +779,7 @@ func SoftDeleteUserHandleFunc(uc_service *user_crud_svc.UserCRUDService) func(w
 			},
 		}
 
-		response.Body.DeletedUserInfo, response.Body.Error = uc_service.SoftDeleteUserById(request.TargetUserId)
+		response.Body.DeletedUserInfo, response.Body.Error = uc_service.SoftDeleteUserById(r.Context(), request.TargetUserId)
 		if response.Body.Error != nil {
 			http.Error(w, "error deleting user "+response.Body.Error.Error(), http.StatusUnauthorized)
 			return
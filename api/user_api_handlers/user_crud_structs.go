@@ -111,6 +111,16 @@ type EnableUserRequest struct {
 	TargetUserId uuid.UUID `json:"targetUserId"`
 }
 
+// swagger:parameters UnlockUser
+type UnlockUserRequestWrapper struct {
+	//in:body
+	Body UnlockUserRequest `json:"body"`
+}
+
+type UnlockUserRequest struct {
+	TargetUserId uuid.UUID `json:"targetUserId"`
+}
+
 // swagger:response EnableDisableUserResponse
 type EnableDisableUserResponseWrapper struct {
 	// in: body
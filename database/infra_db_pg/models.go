@@ -17,6 +17,26 @@ type AppPermission struct {
 	PermissionDescription pgtype.Text
 }
 
+// Append-only record of mutating API calls and secret reads. Each row hashes the previous row's hash, so editing or removing a row breaks the chain.
+type AuditLog struct {
+	Seq          int64
+	ID           uuid.UUID
+	OccurredAt   pgtype.Timestamptz
+	ActorUserID  pgtype.UUID
+	Permission   pgtype.Text
+	Action       string
+	ResourceType string
+	ResourceID   pgtype.Text
+	Method       pgtype.Text
+	Path         pgtype.Text
+	StatusCode   pgtype.Int4
+	ClientIp     pgtype.Text
+	RequestID    pgtype.Text
+	Diff         []byte
+	PrevHash     []byte
+	Hash         []byte
+}
+
 type DnsRecord struct {
 	ID           int32
 	DnsRecordID  string
@@ -42,6 +62,38 @@ type ExternalAuthToken struct {
 	LastModified  pgtype.Timestamptz
 }
 
+// One row per secret recording the expiration the owner was last warned about, so a renewed secret is warned about again before its new expiration.
+type ExternalAuthTokenExpiryNotice struct {
+	SecretID   uuid.UUID
+	Expiration pgtype.Timestamptz
+	NotifiedAt pgtype.Timestamptz
+}
+
+// Grants share a secret with a user or with every member of a role. read returns the plaintext to the grantee, use only lets server-side features decrypt it on their behalf.
+type ExternalAuthTokenGrant struct {
+	ID            uuid.UUID
+	SecretID      uuid.UUID
+	GranteeUserID pgtype.UUID
+	GranteeRoleID pgtype.UUID
+	AccessLevel   string
+	GrantedBy     pgtype.UUID
+	ExpiresAt     pgtype.Timestamptz
+	CreatedAt     pgtype.Timestamptz
+	RevokedAt     pgtype.Timestamptz
+}
+
+type ExternalAuthTokenVersion struct {
+	ID          uuid.UUID
+	SecretID    uuid.UUID
+	Version     int32
+	Token       []byte
+	Expiration  pgtype.Timestamptz
+	IsCurrent   bool
+	CreatedBy   pgtype.UUID
+	CreatedAt   pgtype.Timestamptz
+	DestroyedAt pgtype.Timestamptz
+}
+
 type ExternalIntegrationApp struct {
 	ID             uuid.UUID
 	Name           string
@@ -78,6 +130,13 @@ type HostServerSshMapping struct {
 	HostserverUsername  string
 }
 
+// Free-form labels on host servers that permission scopes can match.
+type HostServerTag struct {
+	HostServerID uuid.UUID
+	Tag          string
+	CreatedAt    pgtype.Timestamptz
+}
+
 type HostServerType struct {
 	HostServerTypeID uuid.UUID
 	Name             string
@@ -98,6 +157,111 @@ type HostedDbPlatform struct {
 	DefaultListenPort pgtype.Int4
 }
 
+type IssuedAccessToken struct {
+	Jti       uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
+type JwtSigningKey struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey []byte
+	PublicKey  []byte
+	CreatedAt  pgtype.Timestamptz
+	RetiredAt  pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+}
+
+type LoginAttempt struct {
+	Scope         string
+	LockKey       string
+	Failures      int32
+	LastFailureAt pgtype.Timestamptz
+	LockedUntil   pgtype.Timestamptz
+}
+
+type LoginLockoutEvent struct {
+	ID          uuid.UUID
+	Scope       string
+	LockKey     string
+	EventType   string
+	Failures    int32
+	LockedUntil pgtype.Timestamptz
+	ActorUserID pgtype.UUID
+	CreatedAt   pgtype.Timestamptz
+}
+
+// Codes submitted per MFA login challenge and whether it was used, shared by every replica.
+type MfaChallenge struct {
+	Jti         uuid.UUID
+	Attempts    int32
+	CompletedAt pgtype.Timestamptz
+	ExpiresAt   pgtype.Timestamptz
+}
+
+type OidcLoginState struct {
+	State         string
+	Nonce         string
+	CodeVerifier  string
+	RedirectAfter string
+	ExpiresAt     pgtype.Timestamptz
+}
+
+// Tenants. Users act within one active organization at a time and only see resources it owns.
+type Organization struct {
+	ID           uuid.UUID
+	Name         string
+	Description  pgtype.Text
+	CreatedAt    pgtype.Timestamptz
+	LastModified pgtype.Timestamptz
+	IsDeleted    bool
+}
+
+// Users that may switch into an organization.
+type OrganizationMember struct {
+	OrgID     uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+// Roles a member holds only while the organization is active, in addition to their global roles.
+type OrganizationMemberRole struct {
+	OrgID     uuid.UUID
+	UserID    uuid.UUID
+	RoleID    uuid.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+// The organization owning a host server, ssh key, external application or secret. External applications without a row are shared by every organization.
+type OrganizationResource struct {
+	ResourceType string
+	ResourceID   uuid.UUID
+	OrgID        uuid.UUID
+	CreatedAt    pgtype.Timestamptz
+}
+
+type PasswordHistory struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	PasswordHash string
+	CreatedAt    pgtype.Timestamptz
+}
+
+type PersonalAccessToken struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Name        string
+	TokenHash   string
+	TokenPrefix string
+	Scopes      []string
+	ExpiresAt   pgtype.Timestamptz
+	CreatedAt   pgtype.Timestamptz
+	LastUsedAt  pgtype.Timestamptz
+	RevokedAt   pgtype.Timestamptz
+}
+
 type PlatformType struct {
 	PlatformTypeID uuid.UUID
 	Name           string
@@ -113,6 +277,28 @@ type PlatformTypeMapping struct {
 	LastModified     pgtype.Timestamptz
 }
 
+type RefreshToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	TokenHash  string
+	ExpiresAt  pgtype.Timestamptz
+	CreatedAt  pgtype.Timestamptz
+	RotatedAt  pgtype.Timestamptz
+	ReplacedBy pgtype.UUID
+	RevokedAt  pgtype.Timestamptz
+	// Active organization of the session, kept across rotations.
+	OrgID pgtype.UUID
+}
+
+type RevokedAccessToken struct {
+	Jti       uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt pgtype.Timestamptz
+	RevokedAt pgtype.Timestamptz
+	Reason    string
+}
+
 type RolePermissionMapping struct {
 	ID           uuid.UUID
 	RoleID       uuid.UUID
@@ -122,6 +308,16 @@ type RolePermissionMapping struct {
 	LastModified pgtype.Timestamptz
 }
 
+// Restricts a role permission mapping to matching resources. A mapping without scopes applies to every resource.
+type RolePermissionScope struct {
+	ID           uuid.UUID
+	RoleID       uuid.UUID
+	PermissionID uuid.UUID
+	ScopeType    string
+	ScopeValue   string
+	CreatedAt    pgtype.Timestamptz
+}
+
 type RolePermissionsView struct {
 	RoleId       uuid.UUID
 	Role         string
@@ -188,6 +384,16 @@ type User struct {
 	IsDeleted    bool
 }
 
+type UserActionToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	ExpiresAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
 type UserAuthAppMapping struct {
 	UserID          uuid.UUID
 	Username        pgtype.Text
@@ -200,6 +406,35 @@ type UserAuthAppMapping struct {
 	Expiration      pgtype.Timestamptz
 }
 
+type UserEmailVerification struct {
+	UserID     uuid.UUID
+	Email      string
+	VerifiedAt pgtype.Timestamptz
+}
+
+// Named sets of users, such as platform-oncall, that hold roles on behalf of their members.
+type UserGroup struct {
+	ID           uuid.UUID
+	Name         string
+	Description  pgtype.Text
+	CreatedAt    pgtype.Timestamptz
+	LastModified pgtype.Timestamptz
+}
+
+// Users belonging to a group. A user can belong to any number of groups.
+type UserGroupMember struct {
+	GroupID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+// Roles every member of the group holds in addition to the roles mapped to them directly.
+type UserGroupRole struct {
+	GroupID   uuid.UUID
+	RoleID    uuid.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
 type UserHostedDb struct {
 	ID                   int32
 	PriceTierCodeID      int32
@@ -234,6 +469,24 @@ type UserHostedK8 struct {
 	LastModified         pgtype.Timestamptz
 }
 
+type UserIdentity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Issuer      string
+	Subject     string
+	Email       string
+	CreatedAt   pgtype.Timestamptz
+	LastLoginAt pgtype.Timestamptz
+}
+
+type UserMfaRecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
+}
+
 type UserPermissionsView struct {
 	UserId       pgtype.UUID
 	Username     pgtype.Text
@@ -289,6 +542,17 @@ type UserSshKeyMapping struct {
 	LastModified        pgtype.Timestamptz
 }
 
+// TOTP enrollments. The seed is sealed like a user secret but is only reachable through the MFA endpoints.
+type UserTotpCredential struct {
+	UserID       uuid.UUID
+	SeedID       uuid.UUID
+	Enabled      bool
+	LastUsedStep int64
+	CreatedAt    pgtype.Timestamptz
+	ConfirmedAt  pgtype.Timestamptz
+	Seed         []byte
+}
+
 type UsersAudit struct {
 	AuditID   int32
 	UserID    pgtype.UUID
@@ -310,3 +574,25 @@ type UsersWithRole struct {
 	Enabled      bool
 	IsDeleted    bool
 }
+
+type WebauthnCredential struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	CredentialID []byte
+	PublicKey    []byte
+	Alg          int64
+	SignCount    int64
+	Aaguid       []byte
+	Transports   []string
+	Name         string
+	CreatedAt    pgtype.Timestamptz
+	LastUsedAt   pgtype.Timestamptz
+}
+
+type WebauthnSession struct {
+	ID        uuid.UUID
+	UserID    pgtype.UUID
+	Ceremony  string
+	Challenge []byte
+	ExpiresAt pgtype.Timestamptz
+}
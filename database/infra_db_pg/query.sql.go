@@ -13,6 +13,189 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addOrganizationMember = `-- name: AddOrganizationMember :exec
+INSERT INTO public.organization_members (org_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (org_id, user_id) DO NOTHING
+`
+
+type AddOrganizationMemberParams struct {
+	OrgID  uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) AddOrganizationMember(ctx context.Context, arg AddOrganizationMemberParams) error {
+	_, err := q.db.Exec(ctx, addOrganizationMember, arg.OrgID, arg.UserID)
+	return err
+}
+
+const addOrganizationMemberRole = `-- name: AddOrganizationMemberRole :exec
+INSERT INTO public.organization_member_roles (org_id, user_id, role_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (org_id, user_id, role_id) DO NOTHING
+`
+
+type AddOrganizationMemberRoleParams struct {
+	OrgID  uuid.UUID
+	UserID uuid.UUID
+	RoleID uuid.UUID
+}
+
+func (q *Queries) AddOrganizationMemberRole(ctx context.Context, arg AddOrganizationMemberRoleParams) error {
+	_, err := q.db.Exec(ctx, addOrganizationMemberRole, arg.OrgID, arg.UserID, arg.RoleID)
+	return err
+}
+
+const addUserGroupMember = `-- name: AddUserGroupMember :exec
+INSERT INTO public.user_group_members (group_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (group_id, user_id) DO NOTHING
+`
+
+type AddUserGroupMemberParams struct {
+	GroupID uuid.UUID
+	UserID  uuid.UUID
+}
+
+func (q *Queries) AddUserGroupMember(ctx context.Context, arg AddUserGroupMemberParams) error {
+	_, err := q.db.Exec(ctx, addUserGroupMember, arg.GroupID, arg.UserID)
+	return err
+}
+
+const addUserGroupRole = `-- name: AddUserGroupRole :exec
+INSERT INTO public.user_group_roles (group_id, role_id)
+VALUES ($1, $2)
+ON CONFLICT (group_id, role_id) DO NOTHING
+`
+
+type AddUserGroupRoleParams struct {
+	GroupID uuid.UUID
+	RoleID  uuid.UUID
+}
+
+func (q *Queries) AddUserGroupRole(ctx context.Context, arg AddUserGroupRoleParams) error {
+	_, err := q.db.Exec(ctx, addUserGroupRole, arg.GroupID, arg.RoleID)
+	return err
+}
+
+const assignOrganizationResource = `-- name: AssignOrganizationResource :exec
+INSERT INTO public.organization_resources (resource_type, resource_id, org_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (resource_type, resource_id) DO NOTHING
+`
+
+type AssignOrganizationResourceParams struct {
+	ResourceType string
+	ResourceID   uuid.UUID
+	OrgID        uuid.UUID
+}
+
+func (q *Queries) AssignOrganizationResource(ctx context.Context, arg AssignOrganizationResourceParams) error {
+	_, err := q.db.Exec(ctx, assignOrganizationResource, arg.ResourceType, arg.ResourceID, arg.OrgID)
+	return err
+}
+
+const clearCurrentExternalAuthTokenVersion = `-- name: ClearCurrentExternalAuthTokenVersion :exec
+UPDATE public.external_auth_token_versions
+SET is_current = false
+WHERE secret_id = $1 AND is_current
+`
+
+func (q *Queries) ClearCurrentExternalAuthTokenVersion(ctx context.Context, secretID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, clearCurrentExternalAuthTokenVersion, secretID)
+	return err
+}
+
+const completeMfaChallenge = `-- name: CompleteMfaChallenge :execrows
+UPDATE public.mfa_challenges
+SET completed_at = CURRENT_TIMESTAMP
+WHERE jti = $1 AND completed_at IS NULL
+`
+
+func (q *Queries) CompleteMfaChallenge(ctx context.Context, jti uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, completeMfaChallenge, jti)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const consumeOidcLoginState = `-- name: ConsumeOidcLoginState :one
+DELETE FROM public.oidc_login_states
+WHERE state = $1
+RETURNING state, nonce, code_verifier, redirect_after, expires_at
+`
+
+func (q *Queries) ConsumeOidcLoginState(ctx context.Context, state string) (OidcLoginState, error) {
+	row := q.db.QueryRow(ctx, consumeOidcLoginState, state)
+	var i OidcLoginState
+	err := row.Scan(
+		&i.State,
+		&i.Nonce,
+		&i.CodeVerifier,
+		&i.RedirectAfter,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const consumeUserActionToken = `-- name: ConsumeUserActionToken :execrows
+UPDATE public.user_action_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+`
+
+func (q *Queries) ConsumeUserActionToken(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, consumeUserActionToken, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const consumeWebauthnSession = `-- name: ConsumeWebauthnSession :one
+DELETE FROM public.webauthn_sessions
+WHERE id = $1
+RETURNING id, user_id, ceremony, challenge, expires_at
+`
+
+func (q *Queries) ConsumeWebauthnSession(ctx context.Context, id uuid.UUID) (WebauthnSession, error) {
+	row := q.db.QueryRow(ctx, consumeWebauthnSession, id)
+	var i WebauthnSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Ceremony,
+		&i.Challenge,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const countUnusedMfaRecoveryCodes = `-- name: CountUnusedMfaRecoveryCodes :one
+SELECT COUNT(*) FROM public.user_mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) CountUnusedMfaRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countUnusedMfaRecoveryCodes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countWebauthnCredentialsByUserId = `-- name: CountWebauthnCredentialsByUserId :one
+SELECT COUNT(*) FROM public.webauthn_credentials
+WHERE user_id = $1
+`
+
+func (q *Queries) CountWebauthnCredentialsByUserId(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countWebauthnCredentialsByUserId, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createExternalApplication = `-- name: CreateExternalApplication :one
 INSERT INTO public.external_integration_apps (id, "name", endpoint_url, app_description) 
 VALUES ($1, $2, $3, $4)
@@ -116,6 +299,31 @@ func (q *Queries) CreateHostServerTypeMapping(ctx context.Context, arg CreateHos
 	return i, err
 }
 
+const createOrganization = `-- name: CreateOrganization :one
+INSERT INTO public.organizations (name, description)
+VALUES ($1, $2)
+RETURNING id, name, description, created_at, last_modified, is_deleted
+`
+
+type CreateOrganizationParams struct {
+	Name        string
+	Description pgtype.Text
+}
+
+func (q *Queries) CreateOrganization(ctx context.Context, arg CreateOrganizationParams) (Organization, error) {
+	row := q.db.QueryRow(ctx, createOrganization, arg.Name, arg.Description)
+	var i Organization
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+		&i.LastModified,
+		&i.IsDeleted,
+	)
+	return i, err
+}
+
 const createPlatformType = `-- name: CreatePlatformType :one
 INSERT INTO public.platform_types (name) VALUES ($1)
 ON CONFLICT (name) DO UPDATE SET last_modified = CURRENT_TIMESTAMP
@@ -369,6 +577,30 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 	return i, err
 }
 
+const createUserGroup = `-- name: CreateUserGroup :one
+INSERT INTO public.user_groups (name, description)
+VALUES ($1, $2)
+RETURNING id, name, description, created_at, last_modified
+`
+
+type CreateUserGroupParams struct {
+	Name        string
+	Description pgtype.Text
+}
+
+func (q *Queries) CreateUserGroup(ctx context.Context, arg CreateUserGroupParams) (UserGroup, error) {
+	row := q.db.QueryRow(ctx, createUserGroup, arg.Name, arg.Description)
+	var i UserGroup
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+		&i.LastModified,
+	)
+	return i, err
+}
+
 const dbHealthCheckRead = `-- name: DbHealthCheckRead :one
 SELECT id, status, check_type
 FROM public.health_check WHERE check_type = 'Read'
@@ -398,6 +630,86 @@ func (q *Queries) DeleteExpiredAuthTokens(ctx context.Context) error {
 	return err
 }
 
+const deleteExpiredIssuedAccessTokens = `-- name: DeleteExpiredIssuedAccessTokens :exec
+DELETE FROM public.issued_access_tokens
+WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredIssuedAccessTokens(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredIssuedAccessTokens)
+	return err
+}
+
+const deleteExpiredJwtSigningKeys = `-- name: DeleteExpiredJwtSigningKeys :exec
+DELETE FROM public.jwt_signing_keys
+WHERE expires_at IS NOT NULL AND expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredJwtSigningKeys(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredJwtSigningKeys)
+	return err
+}
+
+const deleteExpiredMfaChallenges = `-- name: DeleteExpiredMfaChallenges :exec
+DELETE FROM public.mfa_challenges
+WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredMfaChallenges(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredMfaChallenges)
+	return err
+}
+
+const deleteExpiredOidcLoginStates = `-- name: DeleteExpiredOidcLoginStates :exec
+DELETE FROM public.oidc_login_states
+WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredOidcLoginStates(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredOidcLoginStates)
+	return err
+}
+
+const deleteExpiredRefreshTokens = `-- name: DeleteExpiredRefreshTokens :exec
+DELETE FROM public.refresh_tokens
+WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredRefreshTokens(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredRefreshTokens)
+	return err
+}
+
+const deleteExpiredRevokedAccessTokens = `-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM public.revoked_access_tokens
+WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredRevokedAccessTokens(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredRevokedAccessTokens)
+	return err
+}
+
+const deleteExpiredUserActionTokens = `-- name: DeleteExpiredUserActionTokens :exec
+DELETE FROM public.user_action_tokens
+WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredUserActionTokens(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredUserActionTokens)
+	return err
+}
+
+const deleteExpiredWebauthnSessions = `-- name: DeleteExpiredWebauthnSessions :exec
+DELETE FROM public.webauthn_sessions
+WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredWebauthnSessions(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredWebauthnSessions)
+	return err
+}
+
 const deleteExternalApplicationById = `-- name: DeleteExternalApplicationById :exec
 DELETE FROM external_integration_apps
 WHERE id = $1
@@ -438,6 +750,16 @@ func (q *Queries) DeleteHostServer(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteHostServerTags = `-- name: DeleteHostServerTags :exec
+DELETE FROM public.host_server_tags
+WHERE host_server_id = $1
+`
+
+func (q *Queries) DeleteHostServerTags(ctx context.Context, hostServerID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteHostServerTags, hostServerID)
+	return err
+}
+
 const deleteHostServerType = `-- name: DeleteHostServerType :exec
 DELETE FROM public.host_server_types
 WHERE host_server_type_id = $1
@@ -468,6 +790,16 @@ func (q *Queries) DeleteHostServerTypeMappingsByHostId(ctx context.Context, host
 	return err
 }
 
+const deleteMfaRecoveryCodesByUserId = `-- name: DeleteMfaRecoveryCodesByUserId :exec
+DELETE FROM public.user_mfa_recovery_codes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteMfaRecoveryCodesByUserId(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteMfaRecoveryCodesByUserId, userID)
+	return err
+}
+
 const deletePlatformType = `-- name: DeletePlatformType :exec
 DELETE FROM public.platform_types
 WHERE platform_type_id = $1
@@ -498,6 +830,24 @@ func (q *Queries) DeletePlatformTypeMappingsByHostId(ctx context.Context, hostSe
 	return err
 }
 
+const deleteRolePermissionScope = `-- name: DeleteRolePermissionScope :execrows
+DELETE FROM public.role_permission_scopes
+WHERE id = $1 AND role_id = $2
+`
+
+type DeleteRolePermissionScopeParams struct {
+	ID     uuid.UUID
+	RoleID uuid.UUID
+}
+
+func (q *Queries) DeleteRolePermissionScope(ctx context.Context, arg DeleteRolePermissionScopeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteRolePermissionScope, arg.ID, arg.RoleID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteSSHKey = `-- name: DeleteSSHKey :exec
 DELETE FROM ssh_keys
 WHERE id = $1
@@ -538,6 +888,27 @@ func (q *Queries) DeleteSSHKeyType(ctx context.Context, name string) error {
 	return err
 }
 
+const deleteStaleLoginAttempts = `-- name: DeleteStaleLoginAttempts :exec
+DELETE FROM public.login_attempts
+WHERE last_failure_at < $1
+  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+`
+
+func (q *Queries) DeleteStaleLoginAttempts(ctx context.Context, lastFailureAt pgtype.Timestamptz) error {
+	_, err := q.db.Exec(ctx, deleteStaleLoginAttempts, lastFailureAt)
+	return err
+}
+
+const deleteTotpCredential = `-- name: DeleteTotpCredential :exec
+DELETE FROM public.user_totp_credentials
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteTotpCredential(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteTotpCredential, userID)
+	return err
+}
+
 const deleteUserById = `-- name: DeleteUserById :exec
 DELETE FROM users
 WHERE id = $1
@@ -548,6 +919,72 @@ func (q *Queries) DeleteUserById(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteUserGroup = `-- name: DeleteUserGroup :execrows
+DELETE FROM public.user_groups
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUserGroup(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserGroup, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteWebauthnCredential = `-- name: DeleteWebauthnCredential :execrows
+DELETE FROM public.webauthn_credentials
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebauthnCredentialParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteWebauthnCredential(ctx context.Context, arg DeleteWebauthnCredentialParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebauthnCredential, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const destroyExternalAuthTokenVersion = `-- name: DestroyExternalAuthTokenVersion :execrows
+UPDATE public.external_auth_token_versions
+SET token = NULL, destroyed_at = CURRENT_TIMESTAMP
+WHERE secret_id = $1 AND version = $2 AND NOT is_current AND destroyed_at IS NULL
+`
+
+type DestroyExternalAuthTokenVersionParams struct {
+	SecretID uuid.UUID
+	Version  int32
+}
+
+func (q *Queries) DestroyExternalAuthTokenVersion(ctx context.Context, arg DestroyExternalAuthTokenVersionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, destroyExternalAuthTokenVersion, arg.SecretID, arg.Version)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const disableRolePermissionMapping = `-- name: DisableRolePermissionMapping :exec
+UPDATE public.role_permission_mapping
+SET "enabled" = FALSE, last_modified = CURRENT_TIMESTAMP
+WHERE role_id = $1 AND permission_id = $2
+`
+
+type DisableRolePermissionMappingParams struct {
+	RoleID       uuid.UUID
+	PermissionID uuid.UUID
+}
+
+func (q *Queries) DisableRolePermissionMapping(ctx context.Context, arg DisableRolePermissionMappingParams) error {
+	_, err := q.db.Exec(ctx, disableRolePermissionMapping, arg.RoleID, arg.PermissionID)
+	return err
+}
+
 const disableUserById = `-- name: DisableUserById :one
 UPDATE users
   set "enabled" = $2
@@ -614,6 +1051,22 @@ func (q *Queries) DisableUserRoleMappingById(ctx context.Context, arg DisableUse
 	return i, err
 }
 
+const enableTotpCredential = `-- name: EnableTotpCredential :exec
+UPDATE public.user_totp_credentials
+SET enabled = TRUE, confirmed_at = CURRENT_TIMESTAMP, last_used_step = $2
+WHERE user_id = $1
+`
+
+type EnableTotpCredentialParams struct {
+	UserID       uuid.UUID
+	LastUsedStep int64
+}
+
+func (q *Queries) EnableTotpCredential(ctx context.Context, arg EnableTotpCredentialParams) error {
+	_, err := q.db.Exec(ctx, enableTotpCredential, arg.UserID, arg.LastUsedStep)
+	return err
+}
+
 const enableUserById = `-- name: EnableUserById :one
 UPDATE users
   set "enabled" = $2
@@ -652,6 +1105,65 @@ func (q *Queries) EnableUserRoleById(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const getActiveExternalAuthTokenGrantLevel = `-- name: GetActiveExternalAuthTokenGrantLevel :one
+SELECT g.access_level
+FROM public.external_auth_token_grants g
+WHERE g.secret_id = $1
+  AND g.revoked_at IS NULL
+  AND (g.expires_at IS NULL OR g.expires_at > CURRENT_TIMESTAMP)
+  AND (
+    g.grantee_user_id = $2
+    OR g.grantee_role_id IN (
+      SELECT m.role_id
+      FROM public.user_role_mapping m
+      JOIN public.user_roles r ON r.id = m.role_id
+      WHERE m.user_id = $2 AND m.enabled AND r.enabled AND NOT r.is_deleted
+      UNION
+      SELECT gr.role_id
+      FROM public.user_group_members gm
+      JOIN public.user_group_roles gr ON gr.group_id = gm.group_id
+      JOIN public.user_roles r ON r.id = gr.role_id
+      WHERE gm.user_id = $2 AND r.enabled AND NOT r.is_deleted
+    )
+  )
+ORDER BY g.access_level = 'read' DESC
+LIMIT 1
+`
+
+type GetActiveExternalAuthTokenGrantLevelParams struct {
+	SecretID uuid.UUID
+	UserID   uuid.UUID
+}
+
+// Returns the strongest active grant the user holds directly or through an enabled role,
+// mapped to them or to one of their groups.
+func (q *Queries) GetActiveExternalAuthTokenGrantLevel(ctx context.Context, arg GetActiveExternalAuthTokenGrantLevelParams) (string, error) {
+	row := q.db.QueryRow(ctx, getActiveExternalAuthTokenGrantLevel, arg.SecretID, arg.UserID)
+	var access_level string
+	err := row.Scan(&access_level)
+	return access_level, err
+}
+
+const getActiveUserByEmail = `-- name: GetActiveUserByEmail :one
+SELECT id, username, email
+FROM public.users
+WHERE lower(email) = lower($1::text) AND "enabled" = TRUE AND is_deleted = FALSE
+LIMIT 1
+`
+
+type GetActiveUserByEmailRow struct {
+	ID       uuid.UUID
+	Username pgtype.Text
+	Email    pgtype.Text
+}
+
+func (q *Queries) GetActiveUserByEmail(ctx context.Context, email string) (GetActiveUserByEmailRow, error) {
+	row := q.db.QueryRow(ctx, getActiveUserByEmail, email)
+	var i GetActiveUserByEmailRow
+	err := row.Scan(&i.ID, &i.Username, &i.Email)
+	return i, err
+}
+
 const getAllActiveUsers = `-- name: GetAllActiveUsers :many
 SELECT
     "id",
@@ -814,7 +1326,40 @@ func (q *Queries) GetAllHostServers(ctx context.Context) ([]HostServer, error) {
 	return items, nil
 }
 
-const getAllPlatformTypes = `-- name: GetAllPlatformTypes :many
+const getAllOrganizations = `-- name: GetAllOrganizations :many
+SELECT id, name, description, created_at, last_modified, is_deleted FROM public.organizations
+WHERE is_deleted = false
+ORDER BY name
+`
+
+func (q *Queries) GetAllOrganizations(ctx context.Context) ([]Organization, error) {
+	rows, err := q.db.Query(ctx, getAllOrganizations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Organization
+	for rows.Next() {
+		var i Organization
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CreatedAt,
+			&i.LastModified,
+			&i.IsDeleted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllPlatformTypes = `-- name: GetAllPlatformTypes :many
 SELECT platform_type_id, name, last_modified
 FROM public.platform_types
 ORDER BY name
@@ -840,6 +1385,37 @@ func (q *Queries) GetAllPlatformTypes(ctx context.Context) ([]PlatformType, erro
 	return items, nil
 }
 
+const getAllRolePermissionMappings = `-- name: GetAllRolePermissionMappings :many
+SELECT id, role_id, permission_id, enabled, created_at, last_modified FROM public.role_permission_mapping
+`
+
+func (q *Queries) GetAllRolePermissionMappings(ctx context.Context) ([]RolePermissionMapping, error) {
+	rows, err := q.db.Query(ctx, getAllRolePermissionMappings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RolePermissionMapping
+	for rows.Next() {
+		var i RolePermissionMapping
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoleID,
+			&i.PermissionID,
+			&i.Enabled,
+			&i.CreatedAt,
+			&i.LastModified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllSSHKeyTypes = `-- name: GetAllSSHKeyTypes :many
 SELECT 
     id,
@@ -877,6 +1453,58 @@ func (q *Queries) GetAllSSHKeyTypes(ctx context.Context) ([]SshKeyType, error) {
 	return items, nil
 }
 
+const getAllUserGroups = `-- name: GetAllUserGroups :many
+SELECT
+  g.id,
+  g.name,
+  g.description,
+  g.created_at,
+  g.last_modified,
+  ARRAY(
+    SELECT gr.role_id FROM public.user_group_roles gr
+    WHERE gr.group_id = g.id
+    ORDER BY gr.role_id
+  )::uuid[] AS role_ids
+FROM public.user_groups g
+ORDER BY g.name
+`
+
+type GetAllUserGroupsRow struct {
+	ID           uuid.UUID
+	Name         string
+	Description  pgtype.Text
+	CreatedAt    pgtype.Timestamptz
+	LastModified pgtype.Timestamptz
+	RoleIds      []uuid.UUID
+}
+
+func (q *Queries) GetAllUserGroups(ctx context.Context) ([]GetAllUserGroupsRow, error) {
+	rows, err := q.db.Query(ctx, getAllUserGroups)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllUserGroupsRow
+	for rows.Next() {
+		var i GetAllUserGroupsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CreatedAt,
+			&i.LastModified,
+			&i.RoleIds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllUserPermissions = `-- name: GetAllUserPermissions :many
 SELECT
   "UserId",
@@ -950,6 +1578,162 @@ func (q *Queries) GetAllUserRoles(ctx context.Context) ([]UserRolesActive, error
 	return items, nil
 }
 
+const getAllUserRolesIncludingInactive = `-- name: GetAllUserRolesIncludingInactive :many
+SELECT id, role_name, role_description, created_at, last_modified, enabled, is_deleted FROM public.user_roles
+ORDER BY role_name
+`
+
+func (q *Queries) GetAllUserRolesIncludingInactive(ctx context.Context) ([]UserRole, error) {
+	rows, err := q.db.Query(ctx, getAllUserRolesIncludingInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserRole
+	for rows.Next() {
+		var i UserRole
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoleName,
+			&i.RoleDescription,
+			&i.CreatedAt,
+			&i.LastModified,
+			&i.Enabled,
+			&i.IsDeleted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAuditLogEntriesAfter = `-- name: GetAuditLogEntriesAfter :many
+SELECT seq, id, occurred_at, actor_user_id, permission, action, resource_type, resource_id, method, path, status_code, client_ip, request_id, diff, prev_hash, hash FROM public.audit_log
+WHERE seq > $1
+ORDER BY seq
+LIMIT $2
+`
+
+type GetAuditLogEntriesAfterParams struct {
+	AfterSeq int64
+	RowLimit int32
+}
+
+func (q *Queries) GetAuditLogEntriesAfter(ctx context.Context, arg GetAuditLogEntriesAfterParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, getAuditLogEntriesAfter, arg.AfterSeq, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.Seq,
+			&i.ID,
+			&i.OccurredAt,
+			&i.ActorUserID,
+			&i.Permission,
+			&i.Action,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Method,
+			&i.Path,
+			&i.StatusCode,
+			&i.ClientIp,
+			&i.RequestID,
+			&i.Diff,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAuditLogHead = `-- name: GetAuditLogHead :one
+SELECT seq, hash FROM public.audit_log
+ORDER BY seq DESC
+LIMIT 1
+`
+
+type GetAuditLogHeadRow struct {
+	Seq  int64
+	Hash []byte
+}
+
+func (q *Queries) GetAuditLogHead(ctx context.Context) (GetAuditLogHeadRow, error) {
+	row := q.db.QueryRow(ctx, getAuditLogHead)
+	var i GetAuditLogHeadRow
+	err := row.Scan(&i.Seq, &i.Hash)
+	return i, err
+}
+
+const getEffectiveUserRoles = `-- name: GetEffectiveUserRoles :many
+SELECT
+  r.id AS role_id,
+  r.role_name,
+  COALESCE(bool_or(src.group_id IS NULL), false) AS direct,
+  COALESCE(array_agg(src.group_id ORDER BY src.group_id) FILTER (WHERE src.group_id IS NOT NULL), '{}')::uuid[] AS group_ids
+FROM (
+  SELECT rm.role_id, NULL::uuid AS group_id
+  FROM public.user_role_mapping rm
+  WHERE rm.user_id = $1 AND rm.enabled = true
+  UNION ALL
+  SELECT gr.role_id, gr.group_id
+  FROM public.user_group_members m
+  JOIN public.user_group_roles gr ON gr.group_id = m.group_id
+  WHERE m.user_id = $1
+) src
+JOIN public.user_roles r ON r.id = src.role_id
+WHERE r.enabled = true AND r.is_deleted = false
+GROUP BY r.id, r.role_name
+ORDER BY r.role_name
+`
+
+type GetEffectiveUserRolesRow struct {
+	RoleID   uuid.UUID
+	RoleName string
+	Direct   bool
+	GroupIds []uuid.UUID
+}
+
+// Every enabled role of the user with where it comes from: direct is set for roles mapped
+// to the user, group_ids lists the groups that grant it.
+func (q *Queries) GetEffectiveUserRoles(ctx context.Context, userID uuid.UUID) ([]GetEffectiveUserRolesRow, error) {
+	rows, err := q.db.Query(ctx, getEffectiveUserRoles, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetEffectiveUserRolesRow
+	for rows.Next() {
+		var i GetEffectiveUserRolesRow
+		if err := rows.Scan(
+			&i.RoleID,
+			&i.RoleName,
+			&i.Direct,
+			&i.GroupIds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getExternalAppIdByName = `-- name: GetExternalAppIdByName :one
 SELECT id FROM external_integration_apps WHERE "name" = $1
 `
@@ -1034,31 +1818,94 @@ func (q *Queries) GetExternalAuthTokenById(ctx context.Context, id uuid.UUID) (E
 	return i, err
 }
 
-const getExternalAuthTokensByUserId = `-- name: GetExternalAuthTokensByUserId :many
-SELECT
-		id, user_id, external_app_id, token, expiration, created_at, last_modified
- FROM
-  	public.external_auth_tokens 
-WHERE user_id = $1
+const getExternalAuthTokenGrants = `-- name: GetExternalAuthTokenGrants :many
+SELECT id, secret_id, grantee_user_id, grantee_role_id, access_level, granted_by, expires_at, created_at, revoked_at FROM public.external_auth_token_grants
+WHERE secret_id = $1 AND revoked_at IS NULL
+ORDER BY created_at
 `
 
-func (q *Queries) GetExternalAuthTokensByUserId(ctx context.Context, userID uuid.UUID) ([]ExternalAuthToken, error) {
-	rows, err := q.db.Query(ctx, getExternalAuthTokensByUserId, userID)
+func (q *Queries) GetExternalAuthTokenGrants(ctx context.Context, secretID uuid.UUID) ([]ExternalAuthTokenGrant, error) {
+	rows, err := q.db.Query(ctx, getExternalAuthTokenGrants, secretID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ExternalAuthToken
+	var items []ExternalAuthTokenGrant
 	for rows.Next() {
-		var i ExternalAuthToken
+		var i ExternalAuthTokenGrant
 		if err := rows.Scan(
 			&i.ID,
-			&i.UserID,
-			&i.ExternalAppID,
+			&i.SecretID,
+			&i.GranteeUserID,
+			&i.GranteeRoleID,
+			&i.AccessLevel,
+			&i.GrantedBy,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExternalAuthTokenVersion = `-- name: GetExternalAuthTokenVersion :one
+SELECT id, secret_id, version, token, expiration, is_current, created_by, created_at, destroyed_at FROM public.external_auth_token_versions
+WHERE secret_id = $1 AND version = $2
+`
+
+type GetExternalAuthTokenVersionParams struct {
+	SecretID uuid.UUID
+	Version  int32
+}
+
+func (q *Queries) GetExternalAuthTokenVersion(ctx context.Context, arg GetExternalAuthTokenVersionParams) (ExternalAuthTokenVersion, error) {
+	row := q.db.QueryRow(ctx, getExternalAuthTokenVersion, arg.SecretID, arg.Version)
+	var i ExternalAuthTokenVersion
+	err := row.Scan(
+		&i.ID,
+		&i.SecretID,
+		&i.Version,
+		&i.Token,
+		&i.Expiration,
+		&i.IsCurrent,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.DestroyedAt,
+	)
+	return i, err
+}
+
+const getExternalAuthTokenVersions = `-- name: GetExternalAuthTokenVersions :many
+SELECT id, secret_id, version, token, expiration, is_current, created_by, created_at, destroyed_at FROM public.external_auth_token_versions
+WHERE secret_id = $1
+ORDER BY version DESC
+`
+
+func (q *Queries) GetExternalAuthTokenVersions(ctx context.Context, secretID uuid.UUID) ([]ExternalAuthTokenVersion, error) {
+	rows, err := q.db.Query(ctx, getExternalAuthTokenVersions, secretID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExternalAuthTokenVersion
+	for rows.Next() {
+		var i ExternalAuthTokenVersion
+		if err := rows.Scan(
+			&i.ID,
+			&i.SecretID,
+			&i.Version,
 			&i.Token,
 			&i.Expiration,
+			&i.IsCurrent,
+			&i.CreatedBy,
 			&i.CreatedAt,
-			&i.LastModified,
+			&i.DestroyedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1070,36 +1917,43 @@ func (q *Queries) GetExternalAuthTokensByUserId(ctx context.Context, userID uuid
 	return items, nil
 }
 
-const getExternalAuthTokensByUserIdAndAppId = `-- name: GetExternalAuthTokensByUserIdAndAppId :many
-SELECT
-		id, user_id, external_app_id, token, expiration, created_at, last_modified
- FROM
-  	public.external_auth_tokens 
-WHERE user_id = $1 AND external_app_id = $2
+const getExternalAuthTokenVersionsAfterId = `-- name: GetExternalAuthTokenVersionsAfterId :many
+SELECT v.id, v.secret_id, t.user_id, t.external_app_id, v.token
+FROM public.external_auth_token_versions v
+JOIN public.external_auth_tokens t ON t.id = v.secret_id
+WHERE v.id > $1 AND v.token IS NOT NULL
+ORDER BY v.id
+LIMIT $2
 `
 
-type GetExternalAuthTokensByUserIdAndAppIdParams struct {
+type GetExternalAuthTokenVersionsAfterIdParams struct {
+	ID    uuid.UUID
+	Limit int32
+}
+
+type GetExternalAuthTokenVersionsAfterIdRow struct {
+	ID            uuid.UUID
+	SecretID      uuid.UUID
 	UserID        uuid.UUID
 	ExternalAppID uuid.UUID
+	Token         []byte
 }
 
-func (q *Queries) GetExternalAuthTokensByUserIdAndAppId(ctx context.Context, arg GetExternalAuthTokensByUserIdAndAppIdParams) ([]ExternalAuthToken, error) {
-	rows, err := q.db.Query(ctx, getExternalAuthTokensByUserIdAndAppId, arg.UserID, arg.ExternalAppID)
+func (q *Queries) GetExternalAuthTokenVersionsAfterId(ctx context.Context, arg GetExternalAuthTokenVersionsAfterIdParams) ([]GetExternalAuthTokenVersionsAfterIdRow, error) {
+	rows, err := q.db.Query(ctx, getExternalAuthTokenVersionsAfterId, arg.ID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ExternalAuthToken
+	var items []GetExternalAuthTokenVersionsAfterIdRow
 	for rows.Next() {
-		var i ExternalAuthToken
+		var i GetExternalAuthTokenVersionsAfterIdRow
 		if err := rows.Scan(
 			&i.ID,
+			&i.SecretID,
 			&i.UserID,
 			&i.ExternalAppID,
 			&i.Token,
-			&i.Expiration,
-			&i.CreatedAt,
-			&i.LastModified,
 		); err != nil {
 			return nil, err
 		}
@@ -1111,36 +1965,261 @@ func (q *Queries) GetExternalAuthTokensByUserIdAndAppId(ctx context.Context, arg
 	return items, nil
 }
 
-const getHostServerByHostname = `-- name: GetHostServerByHostname :one
-SELECT 
-    id,
-    hostname,
-    ip_address,
-    created_at,
-    last_modified
-FROM public.host_servers
-WHERE hostname = $1
+const getExternalAuthTokensAfterId = `-- name: GetExternalAuthTokensAfterId :many
+SELECT id, user_id, external_app_id, token
+FROM public.external_auth_tokens
+WHERE id > $1
+ORDER BY id
+LIMIT $2
 `
 
-func (q *Queries) GetHostServerByHostname(ctx context.Context, hostname string) (HostServer, error) {
-	row := q.db.QueryRow(ctx, getHostServerByHostname, hostname)
-	var i HostServer
-	err := row.Scan(
-		&i.ID,
-		&i.Hostname,
-		&i.IpAddress,
-		&i.CreatedAt,
-		&i.LastModified,
-	)
-	return i, err
+type GetExternalAuthTokensAfterIdParams struct {
+	ID    uuid.UUID
+	Limit int32
 }
 
-const getHostServerByIP = `-- name: GetHostServerByIP :one
-SELECT 
-    id,
-    hostname,
-    ip_address,
-    created_at,
+type GetExternalAuthTokensAfterIdRow struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	ExternalAppID uuid.UUID
+	Token         []byte
+}
+
+func (q *Queries) GetExternalAuthTokensAfterId(ctx context.Context, arg GetExternalAuthTokensAfterIdParams) ([]GetExternalAuthTokensAfterIdRow, error) {
+	rows, err := q.db.Query(ctx, getExternalAuthTokensAfterId, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetExternalAuthTokensAfterIdRow
+	for rows.Next() {
+		var i GetExternalAuthTokensAfterIdRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ExternalAppID,
+			&i.Token,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExternalAuthTokensByUserId = `-- name: GetExternalAuthTokensByUserId :many
+SELECT
+		id, user_id, external_app_id, token, expiration, created_at, last_modified
+ FROM
+  	public.external_auth_tokens 
+WHERE user_id = $1
+`
+
+func (q *Queries) GetExternalAuthTokensByUserId(ctx context.Context, userID uuid.UUID) ([]ExternalAuthToken, error) {
+	rows, err := q.db.Query(ctx, getExternalAuthTokensByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExternalAuthToken
+	for rows.Next() {
+		var i ExternalAuthToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ExternalAppID,
+			&i.Token,
+			&i.Expiration,
+			&i.CreatedAt,
+			&i.LastModified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExternalAuthTokensByUserIdAndAppId = `-- name: GetExternalAuthTokensByUserIdAndAppId :many
+SELECT
+		id, user_id, external_app_id, token, expiration, created_at, last_modified
+ FROM
+  	public.external_auth_tokens 
+WHERE user_id = $1 AND external_app_id = $2
+`
+
+type GetExternalAuthTokensByUserIdAndAppIdParams struct {
+	UserID        uuid.UUID
+	ExternalAppID uuid.UUID
+}
+
+func (q *Queries) GetExternalAuthTokensByUserIdAndAppId(ctx context.Context, arg GetExternalAuthTokensByUserIdAndAppIdParams) ([]ExternalAuthToken, error) {
+	rows, err := q.db.Query(ctx, getExternalAuthTokensByUserIdAndAppId, arg.UserID, arg.ExternalAppID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExternalAuthToken
+	for rows.Next() {
+		var i ExternalAuthToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ExternalAppID,
+			&i.Token,
+			&i.Expiration,
+			&i.CreatedAt,
+			&i.LastModified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExternalAuthTokensExpiringBefore = `-- name: GetExternalAuthTokensExpiringBefore :many
+SELECT t.id, t.user_id, t.external_app_id, a.name AS application_name, u.email, t.expiration
+FROM public.external_auth_tokens t
+JOIN public.external_integration_apps a ON a.id = t.external_app_id
+JOIN public.users u ON u.id = t.user_id
+LEFT JOIN public.external_auth_token_expiry_notices n ON n.secret_id = t.id AND n.expiration = t.expiration
+WHERE t.expiration > CURRENT_TIMESTAMP
+  AND t.expiration <= $1
+  AND n.secret_id IS NULL
+ORDER BY t.expiration
+LIMIT $2::int
+`
+
+type GetExternalAuthTokensExpiringBeforeParams struct {
+	WarnBefore pgtype.Timestamptz
+	RowLimit   int32
+}
+
+type GetExternalAuthTokensExpiringBeforeRow struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	ExternalAppID   uuid.UUID
+	ApplicationName string
+	Email           pgtype.Text
+	Expiration      pgtype.Timestamptz
+}
+
+func (q *Queries) GetExternalAuthTokensExpiringBefore(ctx context.Context, arg GetExternalAuthTokensExpiringBeforeParams) ([]GetExternalAuthTokensExpiringBeforeRow, error) {
+	rows, err := q.db.Query(ctx, getExternalAuthTokensExpiringBefore, arg.WarnBefore, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetExternalAuthTokensExpiringBeforeRow
+	for rows.Next() {
+		var i GetExternalAuthTokensExpiringBeforeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ExternalAppID,
+			&i.ApplicationName,
+			&i.Email,
+			&i.Expiration,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFirstOrganizationIdForUser = `-- name: GetFirstOrganizationIdForUser :one
+SELECT m.org_id
+FROM public.organization_members m
+JOIN public.organizations o ON o.id = m.org_id
+WHERE m.user_id = $1 AND o.is_deleted = false
+ORDER BY m.created_at, o.name
+LIMIT 1
+`
+
+// The organization a session starts in when none was requested, the one joined first.
+func (q *Queries) GetFirstOrganizationIdForUser(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getFirstOrganizationIdForUser, userID)
+	var org_id uuid.UUID
+	err := row.Scan(&org_id)
+	return org_id, err
+}
+
+const getGroupRoleIdsForUser = `-- name: GetGroupRoleIdsForUser :many
+SELECT DISTINCT gr.role_id
+FROM public.user_group_members m
+JOIN public.user_group_roles gr ON gr.group_id = m.group_id
+JOIN public.user_roles r ON r.id = gr.role_id
+WHERE m.user_id = $1
+  AND r.enabled = true AND r.is_deleted = false
+ORDER BY gr.role_id
+`
+
+// Roles the user holds through any of their groups. Disabled roles are left out, matching
+// how directly mapped roles are resolved.
+func (q *Queries) GetGroupRoleIdsForUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getGroupRoleIdsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var role_id uuid.UUID
+		if err := rows.Scan(&role_id); err != nil {
+			return nil, err
+		}
+		items = append(items, role_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getHostServerByHostname = `-- name: GetHostServerByHostname :one
+SELECT 
+    id,
+    hostname,
+    ip_address,
+    created_at,
+    last_modified
+FROM public.host_servers
+WHERE hostname = $1
+`
+
+func (q *Queries) GetHostServerByHostname(ctx context.Context, hostname string) (HostServer, error) {
+	row := q.db.QueryRow(ctx, getHostServerByHostname, hostname)
+	var i HostServer
+	err := row.Scan(
+		&i.ID,
+		&i.Hostname,
+		&i.IpAddress,
+		&i.CreatedAt,
+		&i.LastModified,
+	)
+	return i, err
+}
+
+const getHostServerByIP = `-- name: GetHostServerByIP :one
+SELECT 
+    id,
+    hostname,
+    ip_address,
+    created_at,
     last_modified
 FROM public.host_servers
 WHERE ip_address = $1
@@ -1184,6 +2263,74 @@ func (q *Queries) GetHostServerById(ctx context.Context, id uuid.UUID) (HostServ
 	return i, err
 }
 
+const getHostServerScopeAttributes = `-- name: GetHostServerScopeAttributes :many
+SELECT
+  h.id,
+  ARRAY(
+    SELECT m.host_server_type_id FROM public.host_server_type_mappings m
+    WHERE m.host_server_id = h.id
+  )::uuid[] AS host_server_type_ids,
+  ARRAY(
+    SELECT t.tag FROM public.host_server_tags t
+    WHERE t.host_server_id = h.id ORDER BY t.tag
+  )::text[] AS tags
+FROM public.host_servers h
+WHERE $1::uuid IS NULL OR h.id = $1
+`
+
+type GetHostServerScopeAttributesRow struct {
+	ID                uuid.UUID
+	HostServerTypeIds []uuid.UUID
+	Tags              []string
+}
+
+// Returns the attributes permission scopes match on, for one host server or all of them.
+func (q *Queries) GetHostServerScopeAttributes(ctx context.Context, hostServerID pgtype.UUID) ([]GetHostServerScopeAttributesRow, error) {
+	rows, err := q.db.Query(ctx, getHostServerScopeAttributes, hostServerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetHostServerScopeAttributesRow
+	for rows.Next() {
+		var i GetHostServerScopeAttributesRow
+		if err := rows.Scan(&i.ID, &i.HostServerTypeIds, &i.Tags); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getHostServerTags = `-- name: GetHostServerTags :many
+SELECT tag FROM public.host_server_tags
+WHERE host_server_id = $1
+ORDER BY tag
+`
+
+func (q *Queries) GetHostServerTags(ctx context.Context, hostServerID uuid.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, getHostServerTags, hostServerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		items = append(items, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getHostServerTypeById = `-- name: GetHostServerTypeById :one
 SELECT host_server_type_id, name, last_modified
 FROM public.host_server_types
@@ -1311,6 +2458,41 @@ func (q *Queries) GetHostServerTypeMappingsByTypeId(ctx context.Context, hostSer
 	return items, nil
 }
 
+const getJwtSigningKeys = `-- name: GetJwtSigningKeys :many
+SELECT kid, algorithm, private_key, public_key, created_at, retired_at, expires_at
+FROM public.jwt_signing_keys
+WHERE expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetJwtSigningKeys(ctx context.Context) ([]JwtSigningKey, error) {
+	rows, err := q.db.Query(ctx, getJwtSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []JwtSigningKey
+	for rows.Next() {
+		var i JwtSigningKey
+		if err := rows.Scan(
+			&i.Kid,
+			&i.Algorithm,
+			&i.PrivateKey,
+			&i.PublicKey,
+			&i.CreatedAt,
+			&i.RetiredAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLatestExternalAuthToken = `-- name: GetLatestExternalAuthToken :one
 SELECT id, user_id, external_app_id, token, expiration, created_at, last_modified FROM external_auth_tokens
 WHERE user_id = $1 AND external_app_id = $2
@@ -1371,21 +2553,431 @@ func (q *Queries) GetLatestExternalAuthTokenByAppName(ctx context.Context, arg G
 	return i, err
 }
 
-const getPlatformTypeById = `-- name: GetPlatformTypeById :one
-SELECT platform_type_id, name, last_modified
-FROM public.platform_types
-WHERE platform_type_id = $1
+const getLoginLockout = `-- name: GetLoginLockout :one
+SELECT locked_until
+FROM public.login_attempts
+WHERE scope = $1 AND lock_key = $2
 `
 
-func (q *Queries) GetPlatformTypeById(ctx context.Context, platformTypeID uuid.UUID) (PlatformType, error) {
-	row := q.db.QueryRow(ctx, getPlatformTypeById, platformTypeID)
-	var i PlatformType
-	err := row.Scan(&i.PlatformTypeID, &i.Name, &i.LastModified)
-	return i, err
+type GetLoginLockoutParams struct {
+	Scope   string
+	LockKey string
 }
 
-const getPlatformTypeByName = `-- name: GetPlatformTypeByName :one
-SELECT platform_type_id, name, last_modified
+func (q *Queries) GetLoginLockout(ctx context.Context, arg GetLoginLockoutParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, getLoginLockout, arg.Scope, arg.LockKey)
+	var locked_until pgtype.Timestamptz
+	err := row.Scan(&locked_until)
+	return locked_until, err
+}
+
+const getNextExternalAuthTokenVersion = `-- name: GetNextExternalAuthTokenVersion :one
+SELECT (COALESCE(MAX(version), 0) + 1)::int AS next_version
+FROM public.external_auth_token_versions
+WHERE secret_id = $1
+`
+
+func (q *Queries) GetNextExternalAuthTokenVersion(ctx context.Context, secretID uuid.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, getNextExternalAuthTokenVersion, secretID)
+	var next_version int32
+	err := row.Scan(&next_version)
+	return next_version, err
+}
+
+const getOrganizationById = `-- name: GetOrganizationById :one
+SELECT id, name, description, created_at, last_modified, is_deleted FROM public.organizations
+WHERE id = $1 AND is_deleted = false
+`
+
+func (q *Queries) GetOrganizationById(ctx context.Context, id uuid.UUID) (Organization, error) {
+	row := q.db.QueryRow(ctx, getOrganizationById, id)
+	var i Organization
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+		&i.LastModified,
+		&i.IsDeleted,
+	)
+	return i, err
+}
+
+const getOrganizationIdByName = `-- name: GetOrganizationIdByName :one
+SELECT id FROM public.organizations
+WHERE name = $1 AND is_deleted = false
+`
+
+func (q *Queries) GetOrganizationIdByName(ctx context.Context, name string) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getOrganizationIdByName, name)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getOrganizationMemberRoleIds = `-- name: GetOrganizationMemberRoleIds :many
+SELECT r.role_id
+FROM public.organization_member_roles r
+JOIN public.user_roles ur ON ur.id = r.role_id
+WHERE r.org_id = $1 AND r.user_id = $2
+  AND ur.enabled = true AND ur.is_deleted = false
+ORDER BY r.role_id
+`
+
+type GetOrganizationMemberRoleIdsParams struct {
+	OrgID  uuid.UUID
+	UserID uuid.UUID
+}
+
+// Only roles that are still enabled are returned, matching how global roles are resolved.
+func (q *Queries) GetOrganizationMemberRoleIds(ctx context.Context, arg GetOrganizationMemberRoleIdsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getOrganizationMemberRoleIds, arg.OrgID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var role_id uuid.UUID
+		if err := rows.Scan(&role_id); err != nil {
+			return nil, err
+		}
+		items = append(items, role_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrganizationMembers = `-- name: GetOrganizationMembers :many
+SELECT
+  m.user_id,
+  u.username,
+  u.email,
+  m.created_at,
+  ARRAY(
+    SELECT r.role_id FROM public.organization_member_roles r
+    WHERE r.org_id = m.org_id AND r.user_id = m.user_id
+    ORDER BY r.role_id
+  )::uuid[] AS role_ids
+FROM public.organization_members m
+JOIN public.users u ON u.id = m.user_id
+WHERE m.org_id = $1
+ORDER BY u.username
+`
+
+type GetOrganizationMembersRow struct {
+	UserID    uuid.UUID
+	Username  pgtype.Text
+	Email     pgtype.Text
+	CreatedAt pgtype.Timestamptz
+	RoleIds   []uuid.UUID
+}
+
+func (q *Queries) GetOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]GetOrganizationMembersRow, error) {
+	rows, err := q.db.Query(ctx, getOrganizationMembers, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrganizationMembersRow
+	for rows.Next() {
+		var i GetOrganizationMembersRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Username,
+			&i.Email,
+			&i.CreatedAt,
+			&i.RoleIds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrganizationResourceOwners = `-- name: GetOrganizationResourceOwners :many
+SELECT resource_id, org_id
+FROM public.organization_resources
+WHERE resource_type = $1
+  AND resource_id = ANY($2::uuid[])
+`
+
+type GetOrganizationResourceOwnersParams struct {
+	ResourceType string
+	ResourceIds  []uuid.UUID
+}
+
+type GetOrganizationResourceOwnersRow struct {
+	ResourceID uuid.UUID
+	OrgID      uuid.UUID
+}
+
+func (q *Queries) GetOrganizationResourceOwners(ctx context.Context, arg GetOrganizationResourceOwnersParams) ([]GetOrganizationResourceOwnersRow, error) {
+	rows, err := q.db.Query(ctx, getOrganizationResourceOwners, arg.ResourceType, arg.ResourceIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrganizationResourceOwnersRow
+	for rows.Next() {
+		var i GetOrganizationResourceOwnersRow
+		if err := rows.Scan(&i.ResourceID, &i.OrgID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrganizationsByUserId = `-- name: GetOrganizationsByUserId :many
+SELECT id, name, description, created_at, last_modified, is_deleted FROM public.organizations
+WHERE is_deleted = false
+  AND id IN (SELECT m.org_id FROM public.organization_members m WHERE m.user_id = $1)
+ORDER BY name
+`
+
+func (q *Queries) GetOrganizationsByUserId(ctx context.Context, userID uuid.UUID) ([]Organization, error) {
+	rows, err := q.db.Query(ctx, getOrganizationsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Organization
+	for rows.Next() {
+		var i Organization
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CreatedAt,
+			&i.LastModified,
+			&i.IsDeleted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPasswordHistoryByUserId = `-- name: GetPasswordHistoryByUserId :many
+SELECT password_hash
+FROM public.password_history
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2::int
+`
+
+type GetPasswordHistoryByUserIdParams struct {
+	UserID       uuid.UUID
+	HistoryLimit int32
+}
+
+func (q *Queries) GetPasswordHistoryByUserId(ctx context.Context, arg GetPasswordHistoryByUserIdParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, getPasswordHistoryByUserId, arg.UserID, arg.HistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var password_hash string
+		if err := rows.Scan(&password_hash); err != nil {
+			return nil, err
+		}
+		items = append(items, password_hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPermissionNamesByRoleIds = `-- name: GetPermissionNamesByRoleIds :many
+SELECT "RoleId", "Permission"
+FROM public.role_permissions_view
+WHERE "RoleId" = ANY($1::uuid[])
+`
+
+type GetPermissionNamesByRoleIdsRow struct {
+	RoleId     uuid.UUID
+	Permission pgtype.Text
+}
+
+func (q *Queries) GetPermissionNamesByRoleIds(ctx context.Context, roleIds []uuid.UUID) ([]GetPermissionNamesByRoleIdsRow, error) {
+	rows, err := q.db.Query(ctx, getPermissionNamesByRoleIds, roleIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPermissionNamesByRoleIdsRow
+	for rows.Next() {
+		var i GetPermissionNamesByRoleIdsRow
+		if err := rows.Scan(&i.RoleId, &i.Permission); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPermissionScopesForRoles = `-- name: GetPermissionScopesForRoles :many
+SELECT rpv."RoleId", s.scope_type, s.scope_value
+FROM public.role_permissions_view rpv
+LEFT JOIN public.role_permission_scopes s
+  ON s.role_id = rpv."RoleId" AND s.permission_id = rpv."PermissionId"
+WHERE rpv."RoleId" = ANY($1::uuid[])
+  AND rpv."Permission" = $2::text
+`
+
+type GetPermissionScopesForRolesParams struct {
+	RoleIds        []uuid.UUID
+	PermissionName string
+}
+
+type GetPermissionScopesForRolesRow struct {
+	RoleId     uuid.UUID
+	ScopeType  pgtype.Text
+	ScopeValue pgtype.Text
+}
+
+// Returns one row per role granting the permission and scope on that grant. A NULL
+// scope_type means the role holds the permission for every resource.
+func (q *Queries) GetPermissionScopesForRoles(ctx context.Context, arg GetPermissionScopesForRolesParams) ([]GetPermissionScopesForRolesRow, error) {
+	rows, err := q.db.Query(ctx, getPermissionScopesForRoles, arg.RoleIds, arg.PermissionName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPermissionScopesForRolesRow
+	for rows.Next() {
+		var i GetPermissionScopesForRolesRow
+		if err := rows.Scan(&i.RoleId, &i.ScopeType, &i.ScopeValue); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPersonalAccessTokenByHash = `-- name: GetPersonalAccessTokenByHash :one
+SELECT pat.id, pat.user_id, pat.scopes, pat.expires_at, pat.revoked_at, uwr.email, uwr.enabled, uwr.is_deleted, uwr.role_ids
+FROM public.personal_access_tokens pat
+JOIN public.users_with_roles uwr ON uwr.id = pat.user_id
+WHERE pat.token_hash = $1
+`
+
+type GetPersonalAccessTokenByHashRow struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Scopes    []string
+	ExpiresAt pgtype.Timestamptz
+	RevokedAt pgtype.Timestamptz
+	Email     pgtype.Text
+	Enabled   bool
+	IsDeleted bool
+	RoleIds   uuid.UUIDs
+}
+
+func (q *Queries) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (GetPersonalAccessTokenByHashRow, error) {
+	row := q.db.QueryRow(ctx, getPersonalAccessTokenByHash, tokenHash)
+	var i GetPersonalAccessTokenByHashRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.Email,
+		&i.Enabled,
+		&i.IsDeleted,
+		&i.RoleIds,
+	)
+	return i, err
+}
+
+const getPersonalAccessTokensByUserId = `-- name: GetPersonalAccessTokensByUserId :many
+SELECT id, user_id, "name", token_prefix, scopes, expires_at, created_at, last_used_at, revoked_at
+FROM public.personal_access_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+type GetPersonalAccessTokensByUserIdRow struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Name        string
+	TokenPrefix string
+	Scopes      []string
+	ExpiresAt   pgtype.Timestamptz
+	CreatedAt   pgtype.Timestamptz
+	LastUsedAt  pgtype.Timestamptz
+	RevokedAt   pgtype.Timestamptz
+}
+
+func (q *Queries) GetPersonalAccessTokensByUserId(ctx context.Context, userID uuid.UUID) ([]GetPersonalAccessTokensByUserIdRow, error) {
+	rows, err := q.db.Query(ctx, getPersonalAccessTokensByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPersonalAccessTokensByUserIdRow
+	for rows.Next() {
+		var i GetPersonalAccessTokensByUserIdRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.TokenPrefix,
+			&i.Scopes,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPlatformTypeById = `-- name: GetPlatformTypeById :one
+SELECT platform_type_id, name, last_modified
+FROM public.platform_types
+WHERE platform_type_id = $1
+`
+
+func (q *Queries) GetPlatformTypeById(ctx context.Context, platformTypeID uuid.UUID) (PlatformType, error) {
+	row := q.db.QueryRow(ctx, getPlatformTypeById, platformTypeID)
+	var i PlatformType
+	err := row.Scan(&i.PlatformTypeID, &i.Name, &i.LastModified)
+	return i, err
+}
+
+const getPlatformTypeByName = `-- name: GetPlatformTypeByName :one
+SELECT platform_type_id, name, last_modified
 FROM public.platform_types
 WHERE name = $1
 `
@@ -1571,6 +3163,30 @@ func (q *Queries) GetPlatformTypeMappingsByPlatformId(ctx context.Context, platf
 	return items, nil
 }
 
+const getRefreshTokenByHash = `-- name: GetRefreshTokenByHash :one
+SELECT id, user_id, family_id, token_hash, expires_at, created_at, rotated_at, replaced_by, revoked_at, org_id
+FROM public.refresh_tokens
+WHERE token_hash = $1
+`
+
+func (q *Queries) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, getRefreshTokenByHash, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FamilyID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.RotatedAt,
+		&i.ReplacedBy,
+		&i.RevokedAt,
+		&i.OrgID,
+	)
+	return i, err
+}
+
 const getRoleIdByName = `-- name: GetRoleIdByName :one
 SELECT
   "id" AS "RoleId"
@@ -1586,11 +3202,81 @@ func (q *Queries) GetRoleIdByName(ctx context.Context, roleName string) (uuid.UU
 	return RoleId, err
 }
 
-const getSSHKeyById = `-- name: GetSSHKeyById :one
-SELECT
-    sk.id,
-    sk.name,
-    sk.description,
+const getRolePermissionMapping = `-- name: GetRolePermissionMapping :one
+SELECT id, role_id, permission_id, enabled, created_at, last_modified FROM public.role_permission_mapping
+WHERE role_id = $1 AND permission_id = $2
+`
+
+type GetRolePermissionMappingParams struct {
+	RoleID       uuid.UUID
+	PermissionID uuid.UUID
+}
+
+func (q *Queries) GetRolePermissionMapping(ctx context.Context, arg GetRolePermissionMappingParams) (RolePermissionMapping, error) {
+	row := q.db.QueryRow(ctx, getRolePermissionMapping, arg.RoleID, arg.PermissionID)
+	var i RolePermissionMapping
+	err := row.Scan(
+		&i.ID,
+		&i.RoleID,
+		&i.PermissionID,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.LastModified,
+	)
+	return i, err
+}
+
+const getRolePermissionScopesByRoleId = `-- name: GetRolePermissionScopesByRoleId :many
+SELECT s.id, s.role_id, s.permission_id, p.permission_name, s.scope_type, s.scope_value, s.created_at
+FROM public.role_permission_scopes s
+JOIN public.app_permissions p ON p.id = s.permission_id
+WHERE s.role_id = $1
+ORDER BY p.permission_name, s.scope_type, s.scope_value
+`
+
+type GetRolePermissionScopesByRoleIdRow struct {
+	ID             uuid.UUID
+	RoleID         uuid.UUID
+	PermissionID   uuid.UUID
+	PermissionName string
+	ScopeType      string
+	ScopeValue     string
+	CreatedAt      pgtype.Timestamptz
+}
+
+func (q *Queries) GetRolePermissionScopesByRoleId(ctx context.Context, roleID uuid.UUID) ([]GetRolePermissionScopesByRoleIdRow, error) {
+	rows, err := q.db.Query(ctx, getRolePermissionScopesByRoleId, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRolePermissionScopesByRoleIdRow
+	for rows.Next() {
+		var i GetRolePermissionScopesByRoleIdRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoleID,
+			&i.PermissionID,
+			&i.PermissionName,
+			&i.ScopeType,
+			&i.ScopeValue,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSSHKeyById = `-- name: GetSSHKeyById :one
+SELECT
+    sk.id,
+    sk.name,
+    sk.description,
     sk.public_key,
     skt.name as key_type,
     sk.owner_user_id,
@@ -1947,6 +3633,103 @@ func (q *Queries) GetSSHSessionById(ctx context.Context, id uuid.UUID) (GetSSHSe
 	return i, err
 }
 
+const getTotpCredentialByUserId = `-- name: GetTotpCredentialByUserId :one
+SELECT user_id, seed_id, enabled, last_used_step, created_at, confirmed_at, seed
+FROM public.user_totp_credentials
+WHERE user_id = $1
+`
+
+func (q *Queries) GetTotpCredentialByUserId(ctx context.Context, userID uuid.UUID) (UserTotpCredential, error) {
+	row := q.db.QueryRow(ctx, getTotpCredentialByUserId, userID)
+	var i UserTotpCredential
+	err := row.Scan(
+		&i.UserID,
+		&i.SeedID,
+		&i.Enabled,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.ConfirmedAt,
+		&i.Seed,
+	)
+	return i, err
+}
+
+const getTotpSeedsAfterUserId = `-- name: GetTotpSeedsAfterUserId :many
+SELECT c.user_id, c.seed_id, a.id AS external_app_id, c.seed
+FROM public.user_totp_credentials c
+CROSS JOIN public.external_integration_apps a
+WHERE a."name" = 'totp_mfa' AND c.user_id > $1
+ORDER BY c.user_id
+LIMIT $2
+`
+
+type GetTotpSeedsAfterUserIdParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+type GetTotpSeedsAfterUserIdRow struct {
+	UserID        uuid.UUID
+	SeedID        uuid.UUID
+	ExternalAppID uuid.UUID
+	Seed          []byte
+}
+
+// Pages through TOTP seeds for the KEK re-wrap job, with the app id their ciphertext is bound to.
+func (q *Queries) GetTotpSeedsAfterUserId(ctx context.Context, arg GetTotpSeedsAfterUserIdParams) ([]GetTotpSeedsAfterUserIdRow, error) {
+	rows, err := q.db.Query(ctx, getTotpSeedsAfterUserId, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTotpSeedsAfterUserIdRow
+	for rows.Next() {
+		var i GetTotpSeedsAfterUserIdRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SeedID,
+			&i.ExternalAppID,
+			&i.Seed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserActionToken = `-- name: GetUserActionToken :one
+SELECT id, user_id, purpose, email, expires_at, used_at
+FROM public.user_action_tokens
+WHERE id = $1
+`
+
+type GetUserActionTokenRow struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	ExpiresAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
+}
+
+func (q *Queries) GetUserActionToken(ctx context.Context, id uuid.UUID) (GetUserActionTokenRow, error) {
+	row := q.db.QueryRow(ctx, getUserActionToken, id)
+	var i GetUserActionTokenRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Purpose,
+		&i.Email,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
 const getUserById = `-- name: GetUserById :one
 SELECT
     "id",
@@ -2015,6 +3798,169 @@ func (q *Queries) GetUserByName(ctx context.Context, username pgtype.Text) (User
 	return i, err
 }
 
+const getUserGroupById = `-- name: GetUserGroupById :one
+SELECT
+  g.id,
+  g.name,
+  g.description,
+  g.created_at,
+  g.last_modified,
+  ARRAY(
+    SELECT gr.role_id FROM public.user_group_roles gr
+    WHERE gr.group_id = g.id
+    ORDER BY gr.role_id
+  )::uuid[] AS role_ids
+FROM public.user_groups g
+WHERE g.id = $1
+`
+
+type GetUserGroupByIdRow struct {
+	ID           uuid.UUID
+	Name         string
+	Description  pgtype.Text
+	CreatedAt    pgtype.Timestamptz
+	LastModified pgtype.Timestamptz
+	RoleIds      []uuid.UUID
+}
+
+func (q *Queries) GetUserGroupById(ctx context.Context, id uuid.UUID) (GetUserGroupByIdRow, error) {
+	row := q.db.QueryRow(ctx, getUserGroupById, id)
+	var i GetUserGroupByIdRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+		&i.LastModified,
+		&i.RoleIds,
+	)
+	return i, err
+}
+
+const getUserGroupMemberIds = `-- name: GetUserGroupMemberIds :many
+SELECT user_id
+FROM public.user_group_members
+WHERE group_id = $1
+`
+
+func (q *Queries) GetUserGroupMemberIds(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getUserGroupMemberIds, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserGroupMembers = `-- name: GetUserGroupMembers :many
+SELECT
+  m.user_id,
+  u.username,
+  u.email,
+  m.created_at
+FROM public.user_group_members m
+JOIN public.users u ON u.id = m.user_id
+WHERE m.group_id = $1
+ORDER BY u.username
+`
+
+type GetUserGroupMembersRow struct {
+	UserID    uuid.UUID
+	Username  pgtype.Text
+	Email     pgtype.Text
+	CreatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) GetUserGroupMembers(ctx context.Context, groupID uuid.UUID) ([]GetUserGroupMembersRow, error) {
+	rows, err := q.db.Query(ctx, getUserGroupMembers, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserGroupMembersRow
+	for rows.Next() {
+		var i GetUserGroupMembersRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Username,
+			&i.Email,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserGroupsByUserId = `-- name: GetUserGroupsByUserId :many
+SELECT
+  g.id,
+  g.name,
+  g.description,
+  g.created_at,
+  g.last_modified,
+  ARRAY(
+    SELECT gr.role_id FROM public.user_group_roles gr
+    WHERE gr.group_id = g.id
+    ORDER BY gr.role_id
+  )::uuid[] AS role_ids
+FROM public.user_groups g
+JOIN public.user_group_members m ON m.group_id = g.id
+WHERE m.user_id = $1
+ORDER BY g.name
+`
+
+type GetUserGroupsByUserIdRow struct {
+	ID           uuid.UUID
+	Name         string
+	Description  pgtype.Text
+	CreatedAt    pgtype.Timestamptz
+	LastModified pgtype.Timestamptz
+	RoleIds      []uuid.UUID
+}
+
+func (q *Queries) GetUserGroupsByUserId(ctx context.Context, userID uuid.UUID) ([]GetUserGroupsByUserIdRow, error) {
+	rows, err := q.db.Query(ctx, getUserGroupsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserGroupsByUserIdRow
+	for rows.Next() {
+		var i GetUserGroupsByUserIdRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CreatedAt,
+			&i.LastModified,
+			&i.RoleIds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserIdByName = `-- name: GetUserIdByName :one
 SELECT
 	id
@@ -2029,6 +3975,67 @@ func (q *Queries) GetUserIdByName(ctx context.Context, username pgtype.Text) (uu
 	return id, err
 }
 
+const getUserIdentitiesByUserId = `-- name: GetUserIdentitiesByUserId :many
+SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+FROM public.user_identities
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetUserIdentitiesByUserId(ctx context.Context, userID uuid.UUID) ([]UserIdentity, error) {
+	rows, err := q.db.Query(ctx, getUserIdentitiesByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserIdentity
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Issuer,
+			&i.Subject,
+			&i.Email,
+			&i.CreatedAt,
+			&i.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserIdentityByIssuerSubject = `-- name: GetUserIdentityByIssuerSubject :one
+SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+FROM public.user_identities
+WHERE issuer = $1 AND subject = $2
+`
+
+type GetUserIdentityByIssuerSubjectParams struct {
+	Issuer  string
+	Subject string
+}
+
+func (q *Queries) GetUserIdentityByIssuerSubject(ctx context.Context, arg GetUserIdentityByIssuerSubjectParams) (UserIdentity, error) {
+	row := q.db.QueryRow(ctx, getUserIdentityByIssuerSubject, arg.Issuer, arg.Subject)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Issuer,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	)
+	return i, err
+}
+
 const getUserLogin = `-- name: GetUserLogin :one
 SELECT id, username, "password" , email, "enabled", "roles", "role_ids" FROM public.users_with_roles uwr
 WHERE username = $1 OR email = $1
@@ -2074,6 +4081,19 @@ func (q *Queries) GetUserNameById(ctx context.Context, id uuid.UUID) (pgtype.Tex
 	return username, err
 }
 
+const getUserPasswordHashById = `-- name: GetUserPasswordHashById :one
+SELECT password
+FROM public.users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserPasswordHashById(ctx context.Context, id uuid.UUID) (pgtype.Text, error) {
+	row := q.db.QueryRow(ctx, getUserPasswordHashById, id)
+	var password pgtype.Text
+	err := row.Scan(&password)
+	return password, err
+}
+
 const getUserPermissionsById = `-- name: GetUserPermissionsById :many
 SELECT
   "UserId",
@@ -2114,24 +4134,88 @@ func (q *Queries) GetUserPermissionsById(ctx context.Context, userid pgtype.UUID
 	return items, nil
 }
 
-const getUserSecretsByAppId = `-- name: GetUserSecretsByAppId :many
-SELECT
-  auth_token_id,
-  user_id,
-  application_id,
-  username,
-  endpoint_url,
-  email,
-  application_name,
-  token_created_at,
-  expiration
-FROM public.user_auth_app_mappings
-WHERE user_id = $1 AND application_id = $2
+const getUserRoleById = `-- name: GetUserRoleById :one
+SELECT id, role_name, role_description, created_at, last_modified, enabled, is_deleted FROM public.user_roles
+WHERE id = $1
 `
 
-type GetUserSecretsByAppIdParams struct {
-	UserID        uuid.UUID
-	ApplicationID uuid.UUID
+func (q *Queries) GetUserRoleById(ctx context.Context, id uuid.UUID) (UserRole, error) {
+	row := q.db.QueryRow(ctx, getUserRoleById, id)
+	var i UserRole
+	err := row.Scan(
+		&i.ID,
+		&i.RoleName,
+		&i.RoleDescription,
+		&i.CreatedAt,
+		&i.LastModified,
+		&i.Enabled,
+		&i.IsDeleted,
+	)
+	return i, err
+}
+
+const getUserRoleByName = `-- name: GetUserRoleByName :one
+SELECT id, role_name, role_description, created_at, last_modified, enabled, is_deleted FROM public.user_roles
+WHERE role_name = $1
+`
+
+func (q *Queries) GetUserRoleByName(ctx context.Context, roleName string) (UserRole, error) {
+	row := q.db.QueryRow(ctx, getUserRoleByName, roleName)
+	var i UserRole
+	err := row.Scan(
+		&i.ID,
+		&i.RoleName,
+		&i.RoleDescription,
+		&i.CreatedAt,
+		&i.LastModified,
+		&i.Enabled,
+		&i.IsDeleted,
+	)
+	return i, err
+}
+
+const getUserRoleMapping = `-- name: GetUserRoleMapping :one
+SELECT id, user_id, role_id, enabled, created_at, last_modified FROM public.user_role_mapping
+WHERE user_id = $1 AND role_id = $2
+`
+
+type GetUserRoleMappingParams struct {
+	UserID uuid.UUID
+	RoleID uuid.UUID
+}
+
+func (q *Queries) GetUserRoleMapping(ctx context.Context, arg GetUserRoleMappingParams) (UserRoleMapping, error) {
+	row := q.db.QueryRow(ctx, getUserRoleMapping, arg.UserID, arg.RoleID)
+	var i UserRoleMapping
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RoleID,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.LastModified,
+	)
+	return i, err
+}
+
+const getUserSecretsByAppId = `-- name: GetUserSecretsByAppId :many
+SELECT
+  auth_token_id,
+  user_id,
+  application_id,
+  username,
+  endpoint_url,
+  email,
+  application_name,
+  token_created_at,
+  expiration
+FROM public.user_auth_app_mappings
+WHERE user_id = $1 AND application_id = $2
+`
+
+type GetUserSecretsByAppIdParams struct {
+	UserID        uuid.UUID
+	ApplicationID uuid.UUID
 }
 
 type GetUserSecretsByAppIdRow struct {
@@ -2295,6 +4379,193 @@ func (q *Queries) GetUserSecretsByUserId(ctx context.Context, userID uuid.UUID)
 	return items, nil
 }
 
+const getUserSecretsExpiringBefore = `-- name: GetUserSecretsExpiringBefore :many
+SELECT m.auth_token_id, m.application_id, m.application_name, m.expiration, n.notified_at
+FROM public.user_auth_app_mappings m
+LEFT JOIN public.external_auth_token_expiry_notices n ON n.secret_id = m.auth_token_id
+WHERE m.user_id = $1 AND m.expiration <= $2
+ORDER BY m.expiration
+`
+
+type GetUserSecretsExpiringBeforeParams struct {
+	UserID         uuid.UUID
+	ExpiringBefore pgtype.Timestamptz
+}
+
+type GetUserSecretsExpiringBeforeRow struct {
+	AuthTokenID     uuid.UUID
+	ApplicationID   uuid.UUID
+	ApplicationName string
+	Expiration      pgtype.Timestamptz
+	NotifiedAt      pgtype.Timestamptz
+}
+
+func (q *Queries) GetUserSecretsExpiringBefore(ctx context.Context, arg GetUserSecretsExpiringBeforeParams) ([]GetUserSecretsExpiringBeforeRow, error) {
+	rows, err := q.db.Query(ctx, getUserSecretsExpiringBefore, arg.UserID, arg.ExpiringBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSecretsExpiringBeforeRow
+	for rows.Next() {
+		var i GetUserSecretsExpiringBeforeRow
+		if err := rows.Scan(
+			&i.AuthTokenID,
+			&i.ApplicationID,
+			&i.ApplicationName,
+			&i.Expiration,
+			&i.NotifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserSecretsSharedWithUser = `-- name: GetUserSecretsSharedWithUser :many
+SELECT DISTINCT ON (m.auth_token_id)
+  m.auth_token_id,
+  m.user_id,
+  m.application_id,
+  m.endpoint_url,
+  m.application_name,
+  m.token_created_at,
+  m.expiration,
+  g.access_level,
+  g.expires_at AS grant_expires_at
+FROM public.user_auth_app_mappings m
+JOIN public.external_auth_token_grants g ON g.secret_id = m.auth_token_id
+WHERE g.revoked_at IS NULL
+  AND (g.expires_at IS NULL OR g.expires_at > CURRENT_TIMESTAMP)
+  AND m.user_id <> $1
+  AND (
+    g.grantee_user_id = $1
+    OR g.grantee_role_id IN (
+      SELECT rm.role_id
+      FROM public.user_role_mapping rm
+      JOIN public.user_roles r ON r.id = rm.role_id
+      WHERE rm.user_id = $1 AND rm.enabled AND r.enabled AND NOT r.is_deleted
+      UNION
+      SELECT gr.role_id
+      FROM public.user_group_members gm
+      JOIN public.user_group_roles gr ON gr.group_id = gm.group_id
+      JOIN public.user_roles r ON r.id = gr.role_id
+      WHERE gm.user_id = $1 AND r.enabled AND NOT r.is_deleted
+    )
+  )
+ORDER BY m.auth_token_id, g.access_level = 'read' DESC
+`
+
+type GetUserSecretsSharedWithUserRow struct {
+	AuthTokenID     uuid.UUID
+	UserID          uuid.UUID
+	ApplicationID   uuid.UUID
+	EndpointUrl     pgtype.Text
+	ApplicationName string
+	TokenCreatedAt  pgtype.Timestamptz
+	Expiration      pgtype.Timestamptz
+	AccessLevel     string
+	GrantExpiresAt  pgtype.Timestamptz
+}
+
+func (q *Queries) GetUserSecretsSharedWithUser(ctx context.Context, userID uuid.UUID) ([]GetUserSecretsSharedWithUserRow, error) {
+	rows, err := q.db.Query(ctx, getUserSecretsSharedWithUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSecretsSharedWithUserRow
+	for rows.Next() {
+		var i GetUserSecretsSharedWithUserRow
+		if err := rows.Scan(
+			&i.AuthTokenID,
+			&i.UserID,
+			&i.ApplicationID,
+			&i.EndpointUrl,
+			&i.ApplicationName,
+			&i.TokenCreatedAt,
+			&i.Expiration,
+			&i.AccessLevel,
+			&i.GrantExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebauthnCredentialByCredentialId = `-- name: GetWebauthnCredentialByCredentialId :one
+SELECT id, user_id, credential_id, public_key, alg, sign_count, aaguid, transports, "name", created_at, last_used_at
+FROM public.webauthn_credentials
+WHERE credential_id = $1
+`
+
+func (q *Queries) GetWebauthnCredentialByCredentialId(ctx context.Context, credentialID []byte) (WebauthnCredential, error) {
+	row := q.db.QueryRow(ctx, getWebauthnCredentialByCredentialId, credentialID)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CredentialID,
+		&i.PublicKey,
+		&i.Alg,
+		&i.SignCount,
+		&i.Aaguid,
+		&i.Transports,
+		&i.Name,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const getWebauthnCredentialsByUserId = `-- name: GetWebauthnCredentialsByUserId :many
+SELECT id, user_id, credential_id, public_key, alg, sign_count, aaguid, transports, "name", created_at, last_used_at
+FROM public.webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetWebauthnCredentialsByUserId(ctx context.Context, userID uuid.UUID) ([]WebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, getWebauthnCredentialsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CredentialID,
+			&i.PublicKey,
+			&i.Alg,
+			&i.SignCount,
+			&i.Aaguid,
+			&i.Transports,
+			&i.Name,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const hardDeleteUserRoleById = `-- name: HardDeleteUserRoleById :exec
 DELETE FROM user_roles
 WHERE id = $1
@@ -2305,6 +4576,101 @@ func (q *Queries) HardDeleteUserRoleById(ctx context.Context, id uuid.UUID) erro
 	return err
 }
 
+const hasFreshJwtSigningKey = `-- name: HasFreshJwtSigningKey :one
+SELECT EXISTS (
+    SELECT 1 FROM public.jwt_signing_keys
+    WHERE retired_at IS NULL
+      AND algorithm = $1
+      AND created_at > $2
+)
+`
+
+type HasFreshJwtSigningKeyParams struct {
+	Algorithm    string
+	CreatedAfter pgtype.Timestamptz
+}
+
+func (q *Queries) HasFreshJwtSigningKey(ctx context.Context, arg HasFreshJwtSigningKeyParams) (bool, error) {
+	row := q.db.QueryRow(ctx, hasFreshJwtSigningKey, arg.Algorithm, arg.CreatedAfter)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const incrementLoginFailures = `-- name: IncrementLoginFailures :one
+INSERT INTO public.login_attempts (scope, lock_key, failures, last_failure_at)
+VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+ON CONFLICT (scope, lock_key) DO UPDATE
+SET failures = CASE
+        WHEN public.login_attempts.last_failure_at < CURRENT_TIMESTAMP - ($3::bigint * INTERVAL '1 second') THEN 1
+        ELSE public.login_attempts.failures + 1
+    END,
+    last_failure_at = CURRENT_TIMESTAMP
+RETURNING failures
+`
+
+type IncrementLoginFailuresParams struct {
+	Scope         string
+	LockKey       string
+	WindowSeconds int64
+}
+
+func (q *Queries) IncrementLoginFailures(ctx context.Context, arg IncrementLoginFailuresParams) (int32, error) {
+	row := q.db.QueryRow(ctx, incrementLoginFailures, arg.Scope, arg.LockKey, arg.WindowSeconds)
+	var failures int32
+	err := row.Scan(&failures)
+	return failures, err
+}
+
+const insertAuditLogEntry = `-- name: InsertAuditLogEntry :exec
+INSERT INTO public.audit_log (
+  seq, id, occurred_at, actor_user_id, permission, action, resource_type, resource_id,
+  method, path, status_code, client_ip, request_id, diff, prev_hash, hash
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+`
+
+type InsertAuditLogEntryParams struct {
+	Seq          int64
+	ID           uuid.UUID
+	OccurredAt   pgtype.Timestamptz
+	ActorUserID  pgtype.UUID
+	Permission   pgtype.Text
+	Action       string
+	ResourceType string
+	ResourceID   pgtype.Text
+	Method       pgtype.Text
+	Path         pgtype.Text
+	StatusCode   pgtype.Int4
+	ClientIp     pgtype.Text
+	RequestID    pgtype.Text
+	Diff         []byte
+	PrevHash     []byte
+	Hash         []byte
+}
+
+func (q *Queries) InsertAuditLogEntry(ctx context.Context, arg InsertAuditLogEntryParams) error {
+	_, err := q.db.Exec(ctx, insertAuditLogEntry,
+		arg.Seq,
+		arg.ID,
+		arg.OccurredAt,
+		arg.ActorUserID,
+		arg.Permission,
+		arg.Action,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.Method,
+		arg.Path,
+		arg.StatusCode,
+		arg.ClientIp,
+		arg.RequestID,
+		arg.Diff,
+		arg.PrevHash,
+		arg.Hash,
+	)
+	return err
+}
+
 const insertExternalAppIntegrationByName = `-- name: InsertExternalAppIntegrationByName :one
 INSERT INTO public.external_integration_apps (id, "name") 
 VALUES ($1, $2)
@@ -2331,20 +4697,26 @@ func (q *Queries) InsertExternalAppIntegrationByName(ctx context.Context, arg In
 }
 
 const insertExternalAuthToken = `-- name: InsertExternalAuthToken :one
-INSERT INTO public.external_auth_tokens (
-    id,
-    user_id,
-    external_app_id,
-    token,
-    expiration
-)
-VALUES (
-  gen_random_uuid(),  $1, $2, $3, $4
+WITH inserted AS (
+  INSERT INTO public.external_auth_tokens (
+      id,
+      user_id,
+      external_app_id,
+      token,
+      expiration
+  )
+  VALUES (
+    $1, $2, $3, $4, $5
+  )
+  RETURNING id, user_id, token, expiration
 )
-RETURNING id
+INSERT INTO public.external_auth_token_versions (secret_id, version, token, expiration, is_current, created_by)
+SELECT id, 1, token, expiration, true, user_id FROM inserted
+RETURNING secret_id
 `
 
 type InsertExternalAuthTokenParams struct {
+	ID            uuid.UUID
 	UserID        uuid.UUID
 	ExternalAppID uuid.UUID
 	Token         []byte
@@ -2353,74 +4725,276 @@ type InsertExternalAuthTokenParams struct {
 
 func (q *Queries) InsertExternalAuthToken(ctx context.Context, arg InsertExternalAuthTokenParams) (uuid.UUID, error) {
 	row := q.db.QueryRow(ctx, insertExternalAuthToken,
+		arg.ID,
 		arg.UserID,
 		arg.ExternalAppID,
 		arg.Token,
 		arg.Expiration,
 	)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+	var secret_id uuid.UUID
+	err := row.Scan(&secret_id)
+	return secret_id, err
 }
 
-const insertOrUpdateAppPermission = `-- name: InsertOrUpdateAppPermission :one
-INSERT INTO app_permissions(id, permission_name, permission_description)
-VALUES(gen_random_uuid(), $1, $2)
-ON CONFLICT (permission_name)
-DO UPDATE SET
-	permission_description = EXCLUDED.permission_description
-RETURNING id, permission_name, permission_description
+const insertExternalAuthTokenGrant = `-- name: InsertExternalAuthTokenGrant :one
+INSERT INTO public.external_auth_token_grants (secret_id, grantee_user_id, grantee_role_id, access_level, granted_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, secret_id, grantee_user_id, grantee_role_id, access_level, granted_by, expires_at, created_at, revoked_at
 `
 
-type InsertOrUpdateAppPermissionParams struct {
-	PermissionName        string
-	PermissionDescription pgtype.Text
-}
-
-func (q *Queries) InsertOrUpdateAppPermission(ctx context.Context, arg InsertOrUpdateAppPermissionParams) (AppPermission, error) {
-	row := q.db.QueryRow(ctx, insertOrUpdateAppPermission, arg.PermissionName, arg.PermissionDescription)
-	var i AppPermission
-	err := row.Scan(&i.ID, &i.PermissionName, &i.PermissionDescription)
+type InsertExternalAuthTokenGrantParams struct {
+	SecretID      uuid.UUID
+	GranteeUserID pgtype.UUID
+	GranteeRoleID pgtype.UUID
+	AccessLevel   string
+	GrantedBy     pgtype.UUID
+	ExpiresAt     pgtype.Timestamptz
+}
+
+func (q *Queries) InsertExternalAuthTokenGrant(ctx context.Context, arg InsertExternalAuthTokenGrantParams) (ExternalAuthTokenGrant, error) {
+	row := q.db.QueryRow(ctx, insertExternalAuthTokenGrant,
+		arg.SecretID,
+		arg.GranteeUserID,
+		arg.GranteeRoleID,
+		arg.AccessLevel,
+		arg.GrantedBy,
+		arg.ExpiresAt,
+	)
+	var i ExternalAuthTokenGrant
+	err := row.Scan(
+		&i.ID,
+		&i.SecretID,
+		&i.GranteeUserID,
+		&i.GranteeRoleID,
+		&i.AccessLevel,
+		&i.GrantedBy,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
 	return i, err
 }
 
-const insertOrUpdateRolePermissionMapping = `-- name: InsertOrUpdateRolePermissionMapping :one
-INSERT INTO role_permission_mapping(id, role_id, permission_id, "enabled", created_at, last_modified)
-VALUES(gen_random_uuid(), $1, $2, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-ON CONFLICT(role_id, permission_id)
-DO UPDATE SET
-  role_id = EXCLUDED.role_id,
-  permission_id = EXCLUDED.permission_id,
-  "enabled" = true,
-  created_at = CURRENT_TIMESTAMP,
-  last_modified = CURRENT_TIMESTAMP
-RETURNING id, role_id, permission_id, enabled, created_at, last_modified
+const insertExternalAuthTokenVersion = `-- name: InsertExternalAuthTokenVersion :one
+INSERT INTO public.external_auth_token_versions (secret_id, version, token, expiration, is_current, created_by)
+VALUES ($1, $2, $3, $4, true, $5)
+RETURNING id, secret_id, version, token, expiration, is_current, created_by, created_at, destroyed_at
 `
 
-type InsertOrUpdateRolePermissionMappingParams struct {
-	RoleID       uuid.UUID
-	PermissionID uuid.UUID
+type InsertExternalAuthTokenVersionParams struct {
+	SecretID   uuid.UUID
+	Version    int32
+	Token      []byte
+	Expiration pgtype.Timestamptz
+	CreatedBy  pgtype.UUID
 }
 
-func (q *Queries) InsertOrUpdateRolePermissionMapping(ctx context.Context, arg InsertOrUpdateRolePermissionMappingParams) (RolePermissionMapping, error) {
-	row := q.db.QueryRow(ctx, insertOrUpdateRolePermissionMapping, arg.RoleID, arg.PermissionID)
-	var i RolePermissionMapping
+func (q *Queries) InsertExternalAuthTokenVersion(ctx context.Context, arg InsertExternalAuthTokenVersionParams) (ExternalAuthTokenVersion, error) {
+	row := q.db.QueryRow(ctx, insertExternalAuthTokenVersion,
+		arg.SecretID,
+		arg.Version,
+		arg.Token,
+		arg.Expiration,
+		arg.CreatedBy,
+	)
+	var i ExternalAuthTokenVersion
 	err := row.Scan(
 		&i.ID,
-		&i.RoleID,
-		&i.PermissionID,
-		&i.Enabled,
+		&i.SecretID,
+		&i.Version,
+		&i.Token,
+		&i.Expiration,
+		&i.IsCurrent,
+		&i.CreatedBy,
 		&i.CreatedAt,
-		&i.LastModified,
+		&i.DestroyedAt,
 	)
 	return i, err
 }
 
-const insertOrUpdateUserRole = `-- name: InsertOrUpdateUserRole :one
-INSERT INTO user_roles (id, role_name, role_description, created_at, last_modified, "enabled", "is_deleted")
-VALUES(gen_random_uuid(), $1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, TRUE, false)
-ON CONFLICT (role_name)
-DO UPDATE SET
+const insertHostServerTags = `-- name: InsertHostServerTags :exec
+INSERT INTO public.host_server_tags (host_server_id, tag)
+SELECT $1::uuid, unnest($2::text[])
+ON CONFLICT (host_server_id, tag) DO NOTHING
+`
+
+type InsertHostServerTagsParams struct {
+	HostServerID uuid.UUID
+	Tags         []string
+}
+
+func (q *Queries) InsertHostServerTags(ctx context.Context, arg InsertHostServerTagsParams) error {
+	_, err := q.db.Exec(ctx, insertHostServerTags, arg.HostServerID, arg.Tags)
+	return err
+}
+
+const insertIssuedAccessToken = `-- name: InsertIssuedAccessToken :exec
+INSERT INTO public.issued_access_tokens (jti, user_id, expires_at)
+VALUES ($1, $2, $3)
+`
+
+type InsertIssuedAccessTokenParams struct {
+	Jti       uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) InsertIssuedAccessToken(ctx context.Context, arg InsertIssuedAccessTokenParams) error {
+	_, err := q.db.Exec(ctx, insertIssuedAccessToken, arg.Jti, arg.UserID, arg.ExpiresAt)
+	return err
+}
+
+const insertJwtSigningKey = `-- name: InsertJwtSigningKey :exec
+INSERT INTO public.jwt_signing_keys (kid, algorithm, private_key, public_key, created_at, retired_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type InsertJwtSigningKeyParams struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey []byte
+	PublicKey  []byte
+	CreatedAt  pgtype.Timestamptz
+	RetiredAt  pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+}
+
+func (q *Queries) InsertJwtSigningKey(ctx context.Context, arg InsertJwtSigningKeyParams) error {
+	_, err := q.db.Exec(ctx, insertJwtSigningKey,
+		arg.Kid,
+		arg.Algorithm,
+		arg.PrivateKey,
+		arg.PublicKey,
+		arg.CreatedAt,
+		arg.RetiredAt,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const insertLoginLockoutEvent = `-- name: InsertLoginLockoutEvent :exec
+INSERT INTO public.login_lockout_events (scope, lock_key, event_type, failures, locked_until, actor_user_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type InsertLoginLockoutEventParams struct {
+	Scope       string
+	LockKey     string
+	EventType   string
+	Failures    int32
+	LockedUntil pgtype.Timestamptz
+	ActorUserID pgtype.UUID
+}
+
+func (q *Queries) InsertLoginLockoutEvent(ctx context.Context, arg InsertLoginLockoutEventParams) error {
+	_, err := q.db.Exec(ctx, insertLoginLockoutEvent,
+		arg.Scope,
+		arg.LockKey,
+		arg.EventType,
+		arg.Failures,
+		arg.LockedUntil,
+		arg.ActorUserID,
+	)
+	return err
+}
+
+const insertMfaRecoveryCode = `-- name: InsertMfaRecoveryCode :exec
+INSERT INTO public.user_mfa_recovery_codes (user_id, code_hash)
+VALUES ($1, $2)
+`
+
+type InsertMfaRecoveryCodeParams struct {
+	UserID   uuid.UUID
+	CodeHash string
+}
+
+func (q *Queries) InsertMfaRecoveryCode(ctx context.Context, arg InsertMfaRecoveryCodeParams) error {
+	_, err := q.db.Exec(ctx, insertMfaRecoveryCode, arg.UserID, arg.CodeHash)
+	return err
+}
+
+const insertOidcLoginState = `-- name: InsertOidcLoginState :exec
+INSERT INTO public.oidc_login_states (state, nonce, code_verifier, redirect_after, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type InsertOidcLoginStateParams struct {
+	State         string
+	Nonce         string
+	CodeVerifier  string
+	RedirectAfter string
+	ExpiresAt     pgtype.Timestamptz
+}
+
+func (q *Queries) InsertOidcLoginState(ctx context.Context, arg InsertOidcLoginStateParams) error {
+	_, err := q.db.Exec(ctx, insertOidcLoginState,
+		arg.State,
+		arg.Nonce,
+		arg.CodeVerifier,
+		arg.RedirectAfter,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const insertOrUpdateAppPermission = `-- name: InsertOrUpdateAppPermission :one
+INSERT INTO app_permissions(id, permission_name, permission_description)
+VALUES(gen_random_uuid(), $1, $2)
+ON CONFLICT (permission_name)
+DO UPDATE SET
+	permission_description = EXCLUDED.permission_description
+RETURNING id, permission_name, permission_description
+`
+
+type InsertOrUpdateAppPermissionParams struct {
+	PermissionName        string
+	PermissionDescription pgtype.Text
+}
+
+func (q *Queries) InsertOrUpdateAppPermission(ctx context.Context, arg InsertOrUpdateAppPermissionParams) (AppPermission, error) {
+	row := q.db.QueryRow(ctx, insertOrUpdateAppPermission, arg.PermissionName, arg.PermissionDescription)
+	var i AppPermission
+	err := row.Scan(&i.ID, &i.PermissionName, &i.PermissionDescription)
+	return i, err
+}
+
+const insertOrUpdateRolePermissionMapping = `-- name: InsertOrUpdateRolePermissionMapping :one
+INSERT INTO role_permission_mapping(id, role_id, permission_id, "enabled", created_at, last_modified)
+VALUES(gen_random_uuid(), $1, $2, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+ON CONFLICT(role_id, permission_id)
+DO UPDATE SET
+  role_id = EXCLUDED.role_id,
+  permission_id = EXCLUDED.permission_id,
+  "enabled" = true,
+  created_at = CURRENT_TIMESTAMP,
+  last_modified = CURRENT_TIMESTAMP
+RETURNING id, role_id, permission_id, enabled, created_at, last_modified
+`
+
+type InsertOrUpdateRolePermissionMappingParams struct {
+	RoleID       uuid.UUID
+	PermissionID uuid.UUID
+}
+
+func (q *Queries) InsertOrUpdateRolePermissionMapping(ctx context.Context, arg InsertOrUpdateRolePermissionMappingParams) (RolePermissionMapping, error) {
+	row := q.db.QueryRow(ctx, insertOrUpdateRolePermissionMapping, arg.RoleID, arg.PermissionID)
+	var i RolePermissionMapping
+	err := row.Scan(
+		&i.ID,
+		&i.RoleID,
+		&i.PermissionID,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.LastModified,
+	)
+	return i, err
+}
+
+const insertOrUpdateUserRole = `-- name: InsertOrUpdateUserRole :one
+INSERT INTO user_roles (id, role_name, role_description, created_at, last_modified, "enabled", "is_deleted")
+VALUES(gen_random_uuid(), $1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, TRUE, false)
+ON CONFLICT (role_name)
+DO UPDATE SET
 	role_description = EXCLUDED.role_description,
 	last_modified = CURRENT_TIMESTAMP,
 	"enabled" = TRUE,
@@ -2475,6 +5049,156 @@ func (q *Queries) InsertOrUpdateUserRoleMappingById(ctx context.Context, arg Ins
 	return i, err
 }
 
+const insertPasswordHistory = `-- name: InsertPasswordHistory :exec
+INSERT INTO public.password_history (user_id, password_hash)
+VALUES ($1, $2)
+`
+
+type InsertPasswordHistoryParams struct {
+	UserID       uuid.UUID
+	PasswordHash string
+}
+
+func (q *Queries) InsertPasswordHistory(ctx context.Context, arg InsertPasswordHistoryParams) error {
+	_, err := q.db.Exec(ctx, insertPasswordHistory, arg.UserID, arg.PasswordHash)
+	return err
+}
+
+const insertPersonalAccessToken = `-- name: InsertPersonalAccessToken :one
+INSERT INTO public.personal_access_tokens (user_id, "name", token_hash, token_prefix, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at
+`
+
+type InsertPersonalAccessTokenParams struct {
+	UserID      uuid.UUID
+	Name        string
+	TokenHash   string
+	TokenPrefix string
+	Scopes      []string
+	ExpiresAt   pgtype.Timestamptz
+}
+
+type InsertPersonalAccessTokenRow struct {
+	ID        uuid.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) InsertPersonalAccessToken(ctx context.Context, arg InsertPersonalAccessTokenParams) (InsertPersonalAccessTokenRow, error) {
+	row := q.db.QueryRow(ctx, insertPersonalAccessToken,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		arg.TokenPrefix,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	var i InsertPersonalAccessTokenRow
+	err := row.Scan(&i.ID, &i.CreatedAt)
+	return i, err
+}
+
+const insertRefreshToken = `-- name: InsertRefreshToken :exec
+INSERT INTO public.refresh_tokens (id, user_id, family_id, token_hash, expires_at, org_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type InsertRefreshTokenParams struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	ExpiresAt pgtype.Timestamptz
+	OrgID     pgtype.UUID
+}
+
+func (q *Queries) InsertRefreshToken(ctx context.Context, arg InsertRefreshTokenParams) error {
+	_, err := q.db.Exec(ctx, insertRefreshToken,
+		arg.ID,
+		arg.UserID,
+		arg.FamilyID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.OrgID,
+	)
+	return err
+}
+
+const insertRolePermissionScope = `-- name: InsertRolePermissionScope :one
+INSERT INTO public.role_permission_scopes (role_id, permission_id, scope_type, scope_value)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (role_id, permission_id, scope_type, scope_value)
+DO UPDATE SET scope_value = EXCLUDED.scope_value
+RETURNING id, role_id, permission_id, scope_type, scope_value, created_at
+`
+
+type InsertRolePermissionScopeParams struct {
+	RoleID       uuid.UUID
+	PermissionID uuid.UUID
+	ScopeType    string
+	ScopeValue   string
+}
+
+func (q *Queries) InsertRolePermissionScope(ctx context.Context, arg InsertRolePermissionScopeParams) (RolePermissionScope, error) {
+	row := q.db.QueryRow(ctx, insertRolePermissionScope,
+		arg.RoleID,
+		arg.PermissionID,
+		arg.ScopeType,
+		arg.ScopeValue,
+	)
+	var i RolePermissionScope
+	err := row.Scan(
+		&i.ID,
+		&i.RoleID,
+		&i.PermissionID,
+		&i.ScopeType,
+		&i.ScopeValue,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const insertTotpCredential = `-- name: InsertTotpCredential :exec
+INSERT INTO public.user_totp_credentials (user_id, seed_id, seed)
+VALUES ($1, $2, $3)
+`
+
+type InsertTotpCredentialParams struct {
+	UserID uuid.UUID
+	SeedID uuid.UUID
+	Seed   []byte
+}
+
+func (q *Queries) InsertTotpCredential(ctx context.Context, arg InsertTotpCredentialParams) error {
+	_, err := q.db.Exec(ctx, insertTotpCredential, arg.UserID, arg.SeedID, arg.Seed)
+	return err
+}
+
+const insertUserActionToken = `-- name: InsertUserActionToken :one
+INSERT INTO public.user_action_tokens (user_id, purpose, email, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id
+`
+
+type InsertUserActionTokenParams struct {
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) InsertUserActionToken(ctx context.Context, arg InsertUserActionTokenParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertUserActionToken,
+		arg.UserID,
+		arg.Purpose,
+		arg.Email,
+		arg.ExpiresAt,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
 const insertUserHostedDb = `-- name: InsertUserHostedDb :one
 INSERT INTO public.user_hosted_db (
   price_tier_code_id,
@@ -2493,78 +5217,630 @@ VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $7, $8, CURRENT_TIMESTAMP, CURRENT_TIMES
 RETURNING id, price_tier_code_id, user_id, current_host_server_id, current_kube_cluster_id, user_application_ids, db_platform_id, fqdn, pub_ip_address, listen_port, private_ip_address, created_at, last_modified
 `
 
-type InsertUserHostedDbParams struct {
-	PriceTierCodeID      int32
-	UserID               int32
-	CurrentHostServerID  int32
-	CurrentKubeClusterID pgtype.Int4
-	UserApplicationIds   []int32
-	DbPlatformID         int32
-	PubIpAddress         netip.Addr
-	PrivateIpAddress     *netip.Addr
+type InsertUserHostedDbParams struct {
+	PriceTierCodeID      int32
+	UserID               int32
+	CurrentHostServerID  int32
+	CurrentKubeClusterID pgtype.Int4
+	UserApplicationIds   []int32
+	DbPlatformID         int32
+	PubIpAddress         netip.Addr
+	PrivateIpAddress     *netip.Addr
+}
+
+func (q *Queries) InsertUserHostedDb(ctx context.Context, arg InsertUserHostedDbParams) (UserHostedDb, error) {
+	row := q.db.QueryRow(ctx, insertUserHostedDb,
+		arg.PriceTierCodeID,
+		arg.UserID,
+		arg.CurrentHostServerID,
+		arg.CurrentKubeClusterID,
+		arg.UserApplicationIds,
+		arg.DbPlatformID,
+		arg.PubIpAddress,
+		arg.PrivateIpAddress,
+	)
+	var i UserHostedDb
+	err := row.Scan(
+		&i.ID,
+		&i.PriceTierCodeID,
+		&i.UserID,
+		&i.CurrentHostServerID,
+		&i.CurrentKubeClusterID,
+		&i.UserApplicationIds,
+		&i.DbPlatformID,
+		&i.Fqdn,
+		&i.PubIpAddress,
+		&i.ListenPort,
+		&i.PrivateIpAddress,
+		&i.CreatedAt,
+		&i.LastModified,
+	)
+	return i, err
+}
+
+const insertUserIdentity = `-- name: InsertUserIdentity :one
+INSERT INTO public.user_identities (user_id, issuer, subject, email, last_login_at)
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+RETURNING id
+`
+
+type InsertUserIdentityParams struct {
+	UserID  uuid.UUID
+	Issuer  string
+	Subject string
+	Email   string
+}
+
+func (q *Queries) InsertUserIdentity(ctx context.Context, arg InsertUserIdentityParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertUserIdentity,
+		arg.UserID,
+		arg.Issuer,
+		arg.Subject,
+		arg.Email,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertWebauthnCredential = `-- name: InsertWebauthnCredential :one
+INSERT INTO public.webauthn_credentials (user_id, credential_id, public_key, alg, sign_count, aaguid, transports, "name")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id
+`
+
+type InsertWebauthnCredentialParams struct {
+	UserID       uuid.UUID
+	CredentialID []byte
+	PublicKey    []byte
+	Alg          int64
+	SignCount    int64
+	Aaguid       []byte
+	Transports   []string
+	Name         string
+}
+
+func (q *Queries) InsertWebauthnCredential(ctx context.Context, arg InsertWebauthnCredentialParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertWebauthnCredential,
+		arg.UserID,
+		arg.CredentialID,
+		arg.PublicKey,
+		arg.Alg,
+		arg.SignCount,
+		arg.Aaguid,
+		arg.Transports,
+		arg.Name,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertWebauthnSession = `-- name: InsertWebauthnSession :exec
+INSERT INTO public.webauthn_sessions (id, user_id, ceremony, challenge, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type InsertWebauthnSessionParams struct {
+	ID        uuid.UUID
+	UserID    pgtype.UUID
+	Ceremony  string
+	Challenge []byte
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) InsertWebauthnSession(ctx context.Context, arg InsertWebauthnSessionParams) error {
+	_, err := q.db.Exec(ctx, insertWebauthnSession,
+		arg.ID,
+		arg.UserID,
+		arg.Ceremony,
+		arg.Challenge,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const invalidateUserActionTokens = `-- name: InvalidateUserActionTokens :exec
+UPDATE public.user_action_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+`
+
+type InvalidateUserActionTokensParams struct {
+	UserID  uuid.UUID
+	Purpose string
+}
+
+func (q *Queries) InvalidateUserActionTokens(ctx context.Context, arg InvalidateUserActionTokensParams) error {
+	_, err := q.db.Exec(ctx, invalidateUserActionTokens, arg.UserID, arg.Purpose)
+	return err
+}
+
+const isAccessTokenRevoked = `-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+  SELECT 1 FROM public.revoked_access_tokens
+  WHERE jti = $1
+) AS revoked
+`
+
+func (q *Queries) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isAccessTokenRevoked, jti)
+	var revoked bool
+	err := row.Scan(&revoked)
+	return revoked, err
+}
+
+const isOrganizationMember = `-- name: IsOrganizationMember :one
+SELECT EXISTS (
+  SELECT 1
+  FROM public.organization_members m
+  JOIN public.organizations o ON o.id = m.org_id
+  WHERE m.org_id = $1 AND m.user_id = $2 AND o.is_deleted = false
+) AS is_member
+`
+
+type IsOrganizationMemberParams struct {
+	OrgID  uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) IsOrganizationMember(ctx context.Context, arg IsOrganizationMemberParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isOrganizationMember, arg.OrgID, arg.UserID)
+	var is_member bool
+	err := row.Scan(&is_member)
+	return is_member, err
+}
+
+const isRoleHeldInOrganization = `-- name: IsRoleHeldInOrganization :one
+SELECT EXISTS (
+  SELECT 1
+  FROM public.organization_members m
+  JOIN public.organizations o ON o.id = m.org_id
+  JOIN public.user_roles ur ON ur.id = $1
+  WHERE m.org_id = $2 AND o.is_deleted = false
+    AND ur.enabled = true AND ur.is_deleted = false
+    AND (
+      EXISTS (
+        SELECT 1 FROM public.organization_member_roles r
+        WHERE r.org_id = m.org_id AND r.user_id = m.user_id AND r.role_id = ur.id
+      )
+      OR EXISTS (
+        SELECT 1 FROM public.user_role_mapping urm
+        WHERE urm.user_id = m.user_id AND urm.role_id = ur.id AND urm.enabled
+      )
+      OR EXISTS (
+        SELECT 1 FROM public.user_group_members gm
+        JOIN public.user_group_roles gr ON gr.group_id = gm.group_id
+        WHERE gm.user_id = m.user_id AND gr.role_id = ur.id
+      )
+    )
+) AS is_held
+`
+
+type IsRoleHeldInOrganizationParams struct {
+	RoleID uuid.UUID
+	OrgID  uuid.UUID
+}
+
+// A role is held in an organization when one of its members has it there, directly or
+// through one of their groups.
+func (q *Queries) IsRoleHeldInOrganization(ctx context.Context, arg IsRoleHeldInOrganizationParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isRoleHeldInOrganization, arg.RoleID, arg.OrgID)
+	var is_held bool
+	err := row.Scan(&is_held)
+	return is_held, err
+}
+
+const isUserEmailVerified = `-- name: IsUserEmailVerified :one
+SELECT EXISTS (
+    SELECT 1
+    FROM public.user_email_verifications v
+    JOIN public.users u ON u.id = v.user_id
+    WHERE v.user_id = $1 AND lower(v.email) = lower(u.email)
+)
+`
+
+func (q *Queries) IsUserEmailVerified(ctx context.Context, userID uuid.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isUserEmailVerified, userID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listActiveSSHSessions = `-- name: ListActiveSSHSessions :many
+SELECT id, user_id, host_server_id, username, created_at, last_activity
+FROM ssh_sessions WHERE is_active = true
+`
+
+type ListActiveSSHSessionsRow struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	HostServerID uuid.UUID
+	Username     string
+	CreatedAt    pgtype.Timestamptz
+	LastActivity pgtype.Timestamptz
+}
+
+func (q *Queries) ListActiveSSHSessions(ctx context.Context) ([]ListActiveSSHSessionsRow, error) {
+	rows, err := q.db.Query(ctx, listActiveSSHSessions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListActiveSSHSessionsRow
+	for rows.Next() {
+		var i ListActiveSSHSessionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.HostServerID,
+			&i.Username,
+			&i.CreatedAt,
+			&i.LastActivity,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditLogEntries = `-- name: ListAuditLogEntries :many
+SELECT seq, id, occurred_at, actor_user_id, permission, action, resource_type, resource_id, method, path, status_code, client_ip, request_id, diff, prev_hash, hash FROM public.audit_log
+WHERE ($1::uuid IS NULL OR actor_user_id = $1)
+  AND ($2::text IS NULL OR resource_type = $2)
+  AND ($3::text IS NULL OR resource_id = $3)
+  AND ($4::text IS NULL OR action = $4)
+  AND ($5::timestamptz IS NULL OR occurred_at >= $5)
+  AND ($6::timestamptz IS NULL OR occurred_at < $6)
+  AND ($7::bigint IS NULL OR seq < $7)
+ORDER BY seq DESC
+LIMIT $8
+`
+
+type ListAuditLogEntriesParams struct {
+	ActorUserID  pgtype.UUID
+	ResourceType pgtype.Text
+	ResourceID   pgtype.Text
+	Action       pgtype.Text
+	OccurredFrom pgtype.Timestamptz
+	OccurredTo   pgtype.Timestamptz
+	BeforeSeq    pgtype.Int8
+	RowLimit     int32
+}
+
+func (q *Queries) ListAuditLogEntries(ctx context.Context, arg ListAuditLogEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditLogEntries,
+		arg.ActorUserID,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.Action,
+		arg.OccurredFrom,
+		arg.OccurredTo,
+		arg.BeforeSeq,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.Seq,
+			&i.ID,
+			&i.OccurredAt,
+			&i.ActorUserID,
+			&i.Permission,
+			&i.Action,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Method,
+			&i.Path,
+			&i.StatusCode,
+			&i.ClientIp,
+			&i.RequestID,
+			&i.Diff,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAuditLog = `-- name: LockAuditLog :exec
+SELECT pg_advisory_xact_lock(hashtext('public.audit_log'))
+`
+
+// Serializes appends so every row chains onto the previous head.
+func (q *Queries) LockAuditLog(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockAuditLog)
+	return err
+}
+
+const lockExternalAuthToken = `-- name: LockExternalAuthToken :one
+SELECT id FROM public.external_auth_tokens
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) LockExternalAuthToken(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, lockExternalAuthToken, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const lockJwtSigningKeys = `-- name: LockJwtSigningKeys :exec
+SELECT pg_advisory_xact_lock(hashtext('public.jwt_signing_keys'))
+`
+
+// Serializes rotations so replicas never activate two keys at once.
+func (q *Queries) LockJwtSigningKeys(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockJwtSigningKeys)
+	return err
+}
+
+const lockRbacSync = `-- name: LockRbacSync :exec
+SELECT pg_advisory_xact_lock(hashtext('public.rbac_sync'))
+`
+
+// Serializes declarative syncs so two plans are never applied over each other.
+func (q *Queries) LockRbacSync(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockRbacSync)
+	return err
+}
+
+const markSSHSessionInactive = `-- name: MarkSSHSessionInactive :exec
+UPDATE ssh_sessions SET is_active = false WHERE id = $1
+`
+
+func (q *Queries) MarkSSHSessionInactive(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, markSSHSessionInactive, id)
+	return err
+}
+
+const prunePasswordHistory = `-- name: PrunePasswordHistory :exec
+DELETE FROM public.password_history
+WHERE user_id = $1
+  AND id NOT IN (
+    SELECT ph.id
+    FROM public.password_history ph
+    WHERE ph.user_id = $1
+    ORDER BY ph.created_at DESC
+    LIMIT $2::int
+  )
+`
+
+type PrunePasswordHistoryParams struct {
+	UserID       uuid.UUID
+	HistoryLimit int32
+}
+
+func (q *Queries) PrunePasswordHistory(ctx context.Context, arg PrunePasswordHistoryParams) error {
+	_, err := q.db.Exec(ctx, prunePasswordHistory, arg.UserID, arg.HistoryLimit)
+	return err
+}
+
+const purgeExpiredAuthTokens = `-- name: PurgeExpiredAuthTokens :execrows
+DELETE FROM public.external_auth_tokens t
+WHERE t.expiration < $1
+  AND NOT EXISTS (
+    SELECT 1 FROM public.ssh_keys k
+    WHERE k.priv_secret_id = t.id OR k.passphrase_id = t.id
+  )
+`
+
+// Secrets still referenced by ssh_keys are kept so the key record is not orphaned.
+func (q *Queries) PurgeExpiredAuthTokens(ctx context.Context, purgeBefore pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeExpiredAuthTokens, purgeBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordMfaChallengeAttempt = `-- name: RecordMfaChallengeAttempt :one
+INSERT INTO public.mfa_challenges (jti, attempts, expires_at)
+VALUES ($1, 1, $2)
+ON CONFLICT (jti) DO UPDATE SET attempts = public.mfa_challenges.attempts + 1
+RETURNING attempts, completed_at IS NOT NULL AS completed
+`
+
+type RecordMfaChallengeAttemptParams struct {
+	Jti       uuid.UUID
+	ExpiresAt pgtype.Timestamptz
+}
+
+type RecordMfaChallengeAttemptRow struct {
+	Attempts  int32
+	Completed bool
+}
+
+// Counts a code submitted for the challenge, creating its row on the first attempt.
+func (q *Queries) RecordMfaChallengeAttempt(ctx context.Context, arg RecordMfaChallengeAttemptParams) (RecordMfaChallengeAttemptRow, error) {
+	row := q.db.QueryRow(ctx, recordMfaChallengeAttempt, arg.Jti, arg.ExpiresAt)
+	var i RecordMfaChallengeAttemptRow
+	err := row.Scan(&i.Attempts, &i.Completed)
+	return i, err
+}
+
+const removeOrganizationMember = `-- name: RemoveOrganizationMember :execrows
+DELETE FROM public.organization_members
+WHERE org_id = $1 AND user_id = $2
+`
+
+type RemoveOrganizationMemberParams struct {
+	OrgID  uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RemoveOrganizationMember(ctx context.Context, arg RemoveOrganizationMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeOrganizationMember, arg.OrgID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeOrganizationMemberRole = `-- name: RemoveOrganizationMemberRole :execrows
+DELETE FROM public.organization_member_roles
+WHERE org_id = $1 AND user_id = $2 AND role_id = $3
+`
+
+type RemoveOrganizationMemberRoleParams struct {
+	OrgID  uuid.UUID
+	UserID uuid.UUID
+	RoleID uuid.UUID
+}
+
+func (q *Queries) RemoveOrganizationMemberRole(ctx context.Context, arg RemoveOrganizationMemberRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeOrganizationMemberRole, arg.OrgID, arg.UserID, arg.RoleID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeSSHSession = `-- name: RemoveSSHSession :exec
+UPDATE ssh_sessions SET is_active = false WHERE id = $1
+`
+
+func (q *Queries) RemoveSSHSession(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, removeSSHSession, id)
+	return err
+}
+
+const removeUserGroupMember = `-- name: RemoveUserGroupMember :execrows
+DELETE FROM public.user_group_members
+WHERE group_id = $1 AND user_id = $2
+`
+
+type RemoveUserGroupMemberParams struct {
+	GroupID uuid.UUID
+	UserID  uuid.UUID
+}
+
+func (q *Queries) RemoveUserGroupMember(ctx context.Context, arg RemoveUserGroupMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeUserGroupMember, arg.GroupID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeUserGroupRole = `-- name: RemoveUserGroupRole :execrows
+DELETE FROM public.user_group_roles
+WHERE group_id = $1 AND role_id = $2
+`
+
+type RemoveUserGroupRoleParams struct {
+	GroupID uuid.UUID
+	RoleID  uuid.UUID
+}
+
+func (q *Queries) RemoveUserGroupRole(ctx context.Context, arg RemoveUserGroupRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeUserGroupRole, arg.GroupID, arg.RoleID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const resetLoginAttempts = `-- name: ResetLoginAttempts :exec
+DELETE FROM public.login_attempts
+WHERE scope = $1 AND lock_key = $2
+`
+
+type ResetLoginAttemptsParams struct {
+	Scope   string
+	LockKey string
+}
+
+func (q *Queries) ResetLoginAttempts(ctx context.Context, arg ResetLoginAttemptsParams) error {
+	_, err := q.db.Exec(ctx, resetLoginAttempts, arg.Scope, arg.LockKey)
+	return err
+}
+
+const retireOtherJwtSigningKeys = `-- name: RetireOtherJwtSigningKeys :exec
+UPDATE public.jwt_signing_keys
+SET retired_at = $1, expires_at = $2
+WHERE retired_at IS NULL AND kid <> $3
+`
+
+type RetireOtherJwtSigningKeysParams struct {
+	RetiredAt pgtype.Timestamptz
+	ExpiresAt pgtype.Timestamptz
+	Kid       string
+}
+
+// Retires every active key except the newly activated one.
+func (q *Queries) RetireOtherJwtSigningKeys(ctx context.Context, arg RetireOtherJwtSigningKeysParams) error {
+	_, err := q.db.Exec(ctx, retireOtherJwtSigningKeys, arg.RetiredAt, arg.ExpiresAt, arg.Kid)
+	return err
+}
+
+const revokeAccessToken = `-- name: RevokeAccessToken :exec
+INSERT INTO public.revoked_access_tokens (jti, user_id, expires_at, reason)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type RevokeAccessTokenParams struct {
+	Jti       uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt pgtype.Timestamptz
+	Reason    string
 }
 
-func (q *Queries) InsertUserHostedDb(ctx context.Context, arg InsertUserHostedDbParams) (UserHostedDb, error) {
-	row := q.db.QueryRow(ctx, insertUserHostedDb,
-		arg.PriceTierCodeID,
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error {
+	_, err := q.db.Exec(ctx, revokeAccessToken,
+		arg.Jti,
 		arg.UserID,
-		arg.CurrentHostServerID,
-		arg.CurrentKubeClusterID,
-		arg.UserApplicationIds,
-		arg.DbPlatformID,
-		arg.PubIpAddress,
-		arg.PrivateIpAddress,
-	)
-	var i UserHostedDb
-	err := row.Scan(
-		&i.ID,
-		&i.PriceTierCodeID,
-		&i.UserID,
-		&i.CurrentHostServerID,
-		&i.CurrentKubeClusterID,
-		&i.UserApplicationIds,
-		&i.DbPlatformID,
-		&i.Fqdn,
-		&i.PubIpAddress,
-		&i.ListenPort,
-		&i.PrivateIpAddress,
-		&i.CreatedAt,
-		&i.LastModified,
+		arg.ExpiresAt,
+		arg.Reason,
 	)
-	return i, err
+	return err
 }
 
-const listActiveSSHSessions = `-- name: ListActiveSSHSessions :many
-SELECT id, user_id, host_server_id, username, created_at, last_activity
-FROM ssh_sessions WHERE is_active = true
+const revokeAccessTokensByUserId = `-- name: RevokeAccessTokensByUserId :many
+INSERT INTO public.revoked_access_tokens (jti, user_id, expires_at, reason)
+SELECT iat.jti, iat.user_id, iat.expires_at, $2
+FROM public.issued_access_tokens iat
+WHERE iat.user_id = $1 AND iat.expires_at > CURRENT_TIMESTAMP
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at
 `
 
-type ListActiveSSHSessionsRow struct {
-	ID           uuid.UUID
-	UserID       uuid.UUID
-	HostServerID uuid.UUID
-	Username     string
-	CreatedAt    pgtype.Timestamptz
-	LastActivity pgtype.Timestamptz
+type RevokeAccessTokensByUserIdParams struct {
+	UserID uuid.UUID
+	Reason string
 }
 
-func (q *Queries) ListActiveSSHSessions(ctx context.Context) ([]ListActiveSSHSessionsRow, error) {
-	rows, err := q.db.Query(ctx, listActiveSSHSessions)
+type RevokeAccessTokensByUserIdRow struct {
+	Jti       uuid.UUID
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) RevokeAccessTokensByUserId(ctx context.Context, arg RevokeAccessTokensByUserIdParams) ([]RevokeAccessTokensByUserIdRow, error) {
+	rows, err := q.db.Query(ctx, revokeAccessTokensByUserId, arg.UserID, arg.Reason)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ListActiveSSHSessionsRow
+	var items []RevokeAccessTokensByUserIdRow
 	for rows.Next() {
-		var i ListActiveSSHSessionsRow
-		if err := rows.Scan(
-			&i.ID,
-			&i.UserID,
-			&i.HostServerID,
-			&i.Username,
-			&i.CreatedAt,
-			&i.LastActivity,
-		); err != nil {
+		var i RevokeAccessTokensByUserIdRow
+		if err := rows.Scan(&i.Jti, &i.ExpiresAt); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -2575,24 +5851,184 @@ func (q *Queries) ListActiveSSHSessions(ctx context.Context) ([]ListActiveSSHSes
 	return items, nil
 }
 
-const markSSHSessionInactive = `-- name: MarkSSHSessionInactive :exec
-UPDATE ssh_sessions SET is_active = false WHERE id = $1
+const revokeActiveExternalAuthTokenGrantsForGrantee = `-- name: RevokeActiveExternalAuthTokenGrantsForGrantee :exec
+UPDATE public.external_auth_token_grants
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE secret_id = $1
+  AND grantee_user_id IS NOT DISTINCT FROM $2::uuid
+  AND grantee_role_id IS NOT DISTINCT FROM $3::uuid
+  AND revoked_at IS NULL
 `
 
-func (q *Queries) MarkSSHSessionInactive(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.Exec(ctx, markSSHSessionInactive, id)
+type RevokeActiveExternalAuthTokenGrantsForGranteeParams struct {
+	SecretID      uuid.UUID
+	GranteeUserID pgtype.UUID
+	GranteeRoleID pgtype.UUID
+}
+
+func (q *Queries) RevokeActiveExternalAuthTokenGrantsForGrantee(ctx context.Context, arg RevokeActiveExternalAuthTokenGrantsForGranteeParams) error {
+	_, err := q.db.Exec(ctx, revokeActiveExternalAuthTokenGrantsForGrantee, arg.SecretID, arg.GranteeUserID, arg.GranteeRoleID)
 	return err
 }
 
-const removeSSHSession = `-- name: RemoveSSHSession :exec
-UPDATE ssh_sessions SET is_active = false WHERE id = $1
+const revokeExternalAuthTokenGrant = `-- name: RevokeExternalAuthTokenGrant :execrows
+UPDATE public.external_auth_token_grants
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND secret_id = $2 AND revoked_at IS NULL
 `
 
-func (q *Queries) RemoveSSHSession(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.Exec(ctx, removeSSHSession, id)
+type RevokeExternalAuthTokenGrantParams struct {
+	ID       uuid.UUID
+	SecretID uuid.UUID
+}
+
+func (q *Queries) RevokeExternalAuthTokenGrant(ctx context.Context, arg RevokeExternalAuthTokenGrantParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeExternalAuthTokenGrant, arg.ID, arg.SecretID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokePersonalAccessToken = `-- name: RevokePersonalAccessToken :execrows
+UPDATE public.personal_access_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokePersonalAccessTokenParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokePersonalAccessToken(ctx context.Context, arg RevokePersonalAccessTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokePersonalAccessToken, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE public.refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeRefreshTokensByUserId = `-- name: RevokeRefreshTokensByUserId :exec
+UPDATE public.refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokensByUserId(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, revokeRefreshTokensByUserId, userID)
+	return err
+}
+
+const roleHoldsPermission = `-- name: RoleHoldsPermission :one
+SELECT EXISTS (
+  SELECT 1 FROM public.role_permissions_view
+  WHERE "RoleId" = $1::uuid AND "PermissionId" = $2::uuid
+) AS holds_permission
+`
+
+type RoleHoldsPermissionParams struct {
+	RoleID       uuid.UUID
+	PermissionID uuid.UUID
+}
+
+func (q *Queries) RoleHoldsPermission(ctx context.Context, arg RoleHoldsPermissionParams) (bool, error) {
+	row := q.db.QueryRow(ctx, roleHoldsPermission, arg.RoleID, arg.PermissionID)
+	var holds_permission bool
+	err := row.Scan(&holds_permission)
+	return holds_permission, err
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+UPDATE public.refresh_tokens
+SET rotated_at = CURRENT_TIMESTAMP, replaced_by = $2
+WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+`
+
+type RotateRefreshTokenParams struct {
+	ID         uuid.UUID
+	ReplacedBy pgtype.UUID
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rotateRefreshToken, arg.ID, arg.ReplacedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setCurrentExternalAuthTokenVersion = `-- name: SetCurrentExternalAuthTokenVersion :one
+UPDATE public.external_auth_token_versions
+SET is_current = true
+WHERE secret_id = $1 AND version = $2 AND destroyed_at IS NULL
+RETURNING id, secret_id, version, token, expiration, is_current, created_by, created_at, destroyed_at
+`
+
+type SetCurrentExternalAuthTokenVersionParams struct {
+	SecretID uuid.UUID
+	Version  int32
+}
+
+func (q *Queries) SetCurrentExternalAuthTokenVersion(ctx context.Context, arg SetCurrentExternalAuthTokenVersionParams) (ExternalAuthTokenVersion, error) {
+	row := q.db.QueryRow(ctx, setCurrentExternalAuthTokenVersion, arg.SecretID, arg.Version)
+	var i ExternalAuthTokenVersion
+	err := row.Scan(
+		&i.ID,
+		&i.SecretID,
+		&i.Version,
+		&i.Token,
+		&i.Expiration,
+		&i.IsCurrent,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.DestroyedAt,
+	)
+	return i, err
+}
+
+const setLoginLockout = `-- name: SetLoginLockout :exec
+UPDATE public.login_attempts
+SET locked_until = $3
+WHERE scope = $1 AND lock_key = $2
+`
+
+type SetLoginLockoutParams struct {
+	Scope       string
+	LockKey     string
+	LockedUntil pgtype.Timestamptz
+}
+
+func (q *Queries) SetLoginLockout(ctx context.Context, arg SetLoginLockoutParams) error {
+	_, err := q.db.Exec(ctx, setLoginLockout, arg.Scope, arg.LockKey, arg.LockedUntil)
 	return err
 }
 
+const softDeleteOrganization = `-- name: SoftDeleteOrganization :execrows
+UPDATE public.organizations
+SET is_deleted = true, last_modified = CURRENT_TIMESTAMP
+WHERE id = $1 AND is_deleted = false
+`
+
+func (q *Queries) SoftDeleteOrganization(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, softDeleteOrganization, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const softDeleteUserById = `-- name: SoftDeleteUserById :one
 UPDATE users
   set is_deleted = TRUE,
@@ -2630,6 +6066,29 @@ func (q *Queries) SoftDeleteUserRoleById(ctx context.Context, id uuid.UUID) erro
 	return err
 }
 
+const touchPersonalAccessToken = `-- name: TouchPersonalAccessToken :exec
+UPDATE public.personal_access_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+`
+
+func (q *Queries) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, touchPersonalAccessToken, id)
+	return err
+}
+
+const tryLockSecretExpiryRun = `-- name: TryLockSecretExpiryRun :one
+SELECT pg_try_advisory_xact_lock(hashtext('public.external_auth_token_expiry_notices'))
+`
+
+// Lets a single replica warn and purge per run, the others skip it.
+func (q *Queries) TryLockSecretExpiryRun(ctx context.Context) (bool, error) {
+	row := q.db.QueryRow(ctx, tryLockSecretExpiryRun)
+	var pg_try_advisory_xact_lock bool
+	err := row.Scan(&pg_try_advisory_xact_lock)
+	return pg_try_advisory_xact_lock, err
+}
+
 const updateExternalApplication = `-- name: UpdateExternalApplication :one
 UPDATE public.external_integration_apps
 SET 
@@ -2667,6 +6126,63 @@ func (q *Queries) UpdateExternalApplication(ctx context.Context, arg UpdateExter
 	return i, err
 }
 
+const updateExternalAuthTokenCiphertext = `-- name: UpdateExternalAuthTokenCiphertext :execrows
+UPDATE public.external_auth_tokens
+SET token = $1, last_modified = CURRENT_TIMESTAMP
+WHERE id = $2 AND token = $3
+`
+
+type UpdateExternalAuthTokenCiphertextParams struct {
+	Token         []byte
+	ID            uuid.UUID
+	PreviousToken []byte
+}
+
+func (q *Queries) UpdateExternalAuthTokenCiphertext(ctx context.Context, arg UpdateExternalAuthTokenCiphertextParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateExternalAuthTokenCiphertext, arg.Token, arg.ID, arg.PreviousToken)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateExternalAuthTokenCurrentValue = `-- name: UpdateExternalAuthTokenCurrentValue :exec
+UPDATE public.external_auth_tokens
+SET token = $2, expiration = $3, last_modified = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateExternalAuthTokenCurrentValueParams struct {
+	ID         uuid.UUID
+	Token      []byte
+	Expiration pgtype.Timestamptz
+}
+
+func (q *Queries) UpdateExternalAuthTokenCurrentValue(ctx context.Context, arg UpdateExternalAuthTokenCurrentValueParams) error {
+	_, err := q.db.Exec(ctx, updateExternalAuthTokenCurrentValue, arg.ID, arg.Token, arg.Expiration)
+	return err
+}
+
+const updateExternalAuthTokenVersionCiphertext = `-- name: UpdateExternalAuthTokenVersionCiphertext :execrows
+UPDATE public.external_auth_token_versions
+SET token = $1
+WHERE id = $2 AND token = $3
+`
+
+type UpdateExternalAuthTokenVersionCiphertextParams struct {
+	Token         []byte
+	ID            uuid.UUID
+	PreviousToken []byte
+}
+
+func (q *Queries) UpdateExternalAuthTokenVersionCiphertext(ctx context.Context, arg UpdateExternalAuthTokenVersionCiphertextParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateExternalAuthTokenVersionCiphertext, arg.Token, arg.ID, arg.PreviousToken)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateHostServer = `-- name: UpdateHostServer :one
 UPDATE public.host_servers
 SET 
@@ -2871,6 +6387,45 @@ func (q *Queries) UpdateSSHSessionActivity(ctx context.Context, arg UpdateSSHSes
 	return err
 }
 
+const updateTotpLastUsedStep = `-- name: UpdateTotpLastUsedStep :execrows
+UPDATE public.user_totp_credentials
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2
+`
+
+type UpdateTotpLastUsedStepParams struct {
+	UserID       uuid.UUID
+	LastUsedStep int64
+}
+
+func (q *Queries) UpdateTotpLastUsedStep(ctx context.Context, arg UpdateTotpLastUsedStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateTotpLastUsedStep, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateTotpSeedCiphertext = `-- name: UpdateTotpSeedCiphertext :execrows
+UPDATE public.user_totp_credentials
+SET seed = $1
+WHERE user_id = $2 AND seed = $3
+`
+
+type UpdateTotpSeedCiphertextParams struct {
+	Seed         []byte
+	UserID       uuid.UUID
+	PreviousSeed []byte
+}
+
+func (q *Queries) UpdateTotpSeedCiphertext(ctx context.Context, arg UpdateTotpSeedCiphertextParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateTotpSeedCiphertext, arg.Seed, arg.UserID, arg.PreviousSeed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateUserEmailById = `-- name: UpdateUserEmailById :one
 UPDATE users
   set email = $2
@@ -2899,6 +6454,42 @@ func (q *Queries) UpdateUserEmailById(ctx context.Context, arg UpdateUserEmailBy
 	return i, err
 }
 
+const updateUserGroup = `-- name: UpdateUserGroup :execrows
+UPDATE public.user_groups
+SET name = $2, description = $3, last_modified = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateUserGroupParams struct {
+	ID          uuid.UUID
+	Name        string
+	Description pgtype.Text
+}
+
+func (q *Queries) UpdateUserGroup(ctx context.Context, arg UpdateUserGroupParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserGroup, arg.ID, arg.Name, arg.Description)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserIdentityLogin = `-- name: UpdateUserIdentityLogin :exec
+UPDATE public.user_identities
+SET email = $2, last_login_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateUserIdentityLoginParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) UpdateUserIdentityLogin(ctx context.Context, arg UpdateUserIdentityLoginParams) error {
+	_, err := q.db.Exec(ctx, updateUserIdentityLogin, arg.ID, arg.Email)
+	return err
+}
+
 const updateUserPasswordById = `-- name: UpdateUserPasswordById :exec
 UPDATE users
   set password = $2
@@ -2915,6 +6506,75 @@ func (q *Queries) UpdateUserPasswordById(ctx context.Context, arg UpdateUserPass
 	return err
 }
 
+const updateWebauthnCredentialSignCount = `-- name: UpdateWebauthnCredentialSignCount :exec
+UPDATE public.webauthn_credentials
+SET sign_count = $2, last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateWebauthnCredentialSignCountParams struct {
+	ID        uuid.UUID
+	SignCount int64
+}
+
+func (q *Queries) UpdateWebauthnCredentialSignCount(ctx context.Context, arg UpdateWebauthnCredentialSignCountParams) error {
+	_, err := q.db.Exec(ctx, updateWebauthnCredentialSignCount, arg.ID, arg.SignCount)
+	return err
+}
+
+const upsertExternalAuthTokenExpiryNotice = `-- name: UpsertExternalAuthTokenExpiryNotice :exec
+INSERT INTO public.external_auth_token_expiry_notices (secret_id, expiration, notified_at)
+VALUES ($1, $2, CURRENT_TIMESTAMP)
+ON CONFLICT (secret_id) DO UPDATE
+SET expiration = EXCLUDED.expiration, notified_at = EXCLUDED.notified_at
+`
+
+type UpsertExternalAuthTokenExpiryNoticeParams struct {
+	SecretID   uuid.UUID
+	Expiration pgtype.Timestamptz
+}
+
+func (q *Queries) UpsertExternalAuthTokenExpiryNotice(ctx context.Context, arg UpsertExternalAuthTokenExpiryNoticeParams) error {
+	_, err := q.db.Exec(ctx, upsertExternalAuthTokenExpiryNotice, arg.SecretID, arg.Expiration)
+	return err
+}
+
+const upsertUserEmailVerification = `-- name: UpsertUserEmailVerification :exec
+INSERT INTO public.user_email_verifications (user_id, email, verified_at)
+VALUES ($1, $2, CURRENT_TIMESTAMP)
+ON CONFLICT (user_id) DO UPDATE
+SET email = EXCLUDED.email, verified_at = EXCLUDED.verified_at
+`
+
+type UpsertUserEmailVerificationParams struct {
+	UserID uuid.UUID
+	Email  string
+}
+
+func (q *Queries) UpsertUserEmailVerification(ctx context.Context, arg UpsertUserEmailVerificationParams) error {
+	_, err := q.db.Exec(ctx, upsertUserEmailVerification, arg.UserID, arg.Email)
+	return err
+}
+
+const useMfaRecoveryCode = `-- name: UseMfaRecoveryCode :execrows
+UPDATE public.user_mfa_recovery_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+`
+
+type UseMfaRecoveryCodeParams struct {
+	UserID   uuid.UUID
+	CodeHash string
+}
+
+func (q *Queries) UseMfaRecoveryCode(ctx context.Context, arg UseMfaRecoveryCodeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useMfaRecoveryCode, arg.UserID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const verifyUserPermissionById = `-- name: VerifyUserPermissionById :one
 SELECT EXISTS (
   SELECT
@@ -2927,7 +6587,15 @@ SELECT EXISTS (
   FROM
       public.user_permissions_view upv
   WHERE "UserId" = $1 and "Permission" = $2
-)
+) OR EXISTS (
+  SELECT 1
+  FROM public.user_group_members m
+  JOIN public.user_group_roles gr ON gr.group_id = m.group_id
+  JOIN public.user_roles r ON r.id = gr.role_id
+  JOIN public.role_permissions_view rpv ON rpv."RoleId" = gr.role_id
+  WHERE m.user_id = $1 and rpv."Permission" = $2
+    AND r.enabled = true AND r.is_deleted = false
+) AS has_permission
 `
 
 type VerifyUserPermissionByIdParams struct {
@@ -2935,11 +6603,12 @@ type VerifyUserPermissionByIdParams struct {
 	Permission pgtype.Text
 }
 
+// Checks the roles mapped to the user and the enabled roles of their groups.
 func (q *Queries) VerifyUserPermissionById(ctx context.Context, arg VerifyUserPermissionByIdParams) (bool, error) {
 	row := q.db.QueryRow(ctx, verifyUserPermissionById, arg.UserId, arg.Permission)
-	var exists bool
-	err := row.Scan(&exists)
-	return exists, err
+	var has_permission bool
+	err := row.Scan(&has_permission)
+	return has_permission, err
 }
 
 const verifyUserPermissionByRoleId = `-- name: VerifyUserPermissionByRoleId :one
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.jwt_signing_keys (
+    kid text PRIMARY KEY,
+    algorithm text NOT NULL,
+    private_key bytea NOT NULL,
+    public_key bytea NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    retired_at timestamptz NULL,
+    expires_at timestamptz NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_jwt_signing_keys_expires_at ON public.jwt_signing_keys (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.jwt_signing_keys;
+-- +goose StatementEnd
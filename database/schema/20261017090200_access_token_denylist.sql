@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.issued_access_tokens (
+    jti uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_issued_access_tokens_user_id ON public.issued_access_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_issued_access_tokens_expires_at ON public.issued_access_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS public.revoked_access_tokens (
+    jti uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reason text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_expires_at ON public.revoked_access_tokens (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.revoked_access_tokens;
+DROP TABLE IF EXISTS public.issued_access_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO public.external_integration_apps (id, "name", endpoint_url, app_description)
+SELECT gen_random_uuid(), 'totp_mfa', NULL, 'TOTP seeds for go-infra multi-factor authentication'
+WHERE NOT EXISTS (SELECT 1 FROM public.external_integration_apps WHERE "name" = 'totp_mfa');
+
+CREATE TABLE IF NOT EXISTS public.user_totp_credentials (
+    user_id uuid PRIMARY KEY REFERENCES public.users(id) ON DELETE CASCADE,
+    secret_id uuid NOT NULL REFERENCES public.external_auth_tokens(id) ON DELETE CASCADE,
+    enabled boolean NOT NULL DEFAULT false,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    confirmed_at timestamptz NULL
+);
+
+CREATE TABLE IF NOT EXISTS public.user_mfa_recovery_codes (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    code_hash text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used_at timestamptz NULL,
+    UNIQUE (user_id, code_hash)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.user_mfa_recovery_codes;
+DROP TABLE IF EXISTS public.user_totp_credentials;
+DELETE FROM public.external_integration_apps WHERE "name" = 'totp_mfa';
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.webauthn_credentials (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    credential_id bytea NOT NULL UNIQUE,
+    public_key bytea NOT NULL,
+    alg bigint NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    aaguid bytea NOT NULL,
+    transports text[] NOT NULL DEFAULT '{}',
+    "name" text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at timestamptz NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON public.webauthn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS public.webauthn_sessions (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    ceremony text NOT NULL,
+    challenge bytea NOT NULL,
+    expires_at timestamptz NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.webauthn_sessions;
+DROP TABLE IF EXISTS public.webauthn_credentials;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.user_identities (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    email text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at timestamptz NULL,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON public.user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS public.oidc_login_states (
+    state text PRIMARY KEY,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    redirect_after text NOT NULL DEFAULT '',
+    expires_at timestamptz NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.oidc_login_states;
+DROP TABLE IF EXISTS public.user_identities;
+-- +goose StatementEnd
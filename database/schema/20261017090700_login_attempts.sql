@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.login_attempts (
+    scope text NOT NULL,
+    lock_key text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until timestamptz NULL,
+    PRIMARY KEY (scope, lock_key)
+);
+
+CREATE TABLE IF NOT EXISTS public.login_lockout_events (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    scope text NOT NULL,
+    lock_key text NOT NULL,
+    event_type text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    locked_until timestamptz NULL,
+    actor_user_id uuid NULL REFERENCES public.users(id) ON DELETE SET NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_lockout_events_lock_key ON public.login_lockout_events (scope, lock_key, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.login_lockout_events;
+DROP TABLE IF EXISTS public.login_attempts;
+-- +goose StatementEnd
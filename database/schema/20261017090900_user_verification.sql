@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.user_action_tokens (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    purpose text NOT NULL,
+    email text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_action_tokens_user_purpose ON public.user_action_tokens (user_id, purpose);
+
+-- A user's email is verified while a row exists for their current address.
+CREATE TABLE IF NOT EXISTS public.user_email_verifications (
+    user_id uuid PRIMARY KEY REFERENCES public.users(id) ON DELETE CASCADE,
+    email text NOT NULL,
+    verified_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Existing users predate verification and are treated as verified.
+INSERT INTO public.user_email_verifications (user_id, email)
+SELECT id, email FROM public.users
+WHERE email IS NOT NULL AND email <> ''
+ON CONFLICT (user_id) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.user_email_verifications;
+DROP TABLE IF EXISTS public.user_action_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO public.app_permissions (id, permission_name, permission_description)
+VALUES
+    (gen_random_uuid(), 'ReadSecretMetadata', 'List metadata for the caller''s own secrets'),
+    (gen_random_uuid(), 'ReadSecretPlaintext', 'Retrieve decrypted values of the caller''s own secrets'),
+    (gen_random_uuid(), 'AccessAllUserSecrets', 'Read and delete secrets owned by other users')
+ON CONFLICT (permission_name) DO NOTHING;
+
+-- Existing roles keep access to their own secrets; delegated access must be granted explicitly.
+INSERT INTO public.role_permission_mapping (id, role_id, permission_id, "enabled", created_at, last_modified)
+SELECT gen_random_uuid(), r.id, p.id, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM public.user_roles r
+CROSS JOIN public.app_permissions p
+WHERE r.is_deleted = false
+  AND p.permission_name IN ('ReadSecretMetadata', 'ReadSecretPlaintext')
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM public.role_permission_mapping
+WHERE permission_id IN (
+    SELECT id FROM public.app_permissions
+    WHERE permission_name IN ('ReadSecretMetadata', 'ReadSecretPlaintext', 'AccessAllUserSecrets')
+);
+
+DELETE FROM public.app_permissions
+WHERE permission_name IN ('ReadSecretMetadata', 'ReadSecretPlaintext', 'AccessAllUserSecrets');
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.external_auth_token_versions (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    secret_id uuid NOT NULL REFERENCES public.external_auth_tokens(id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    token bytea NULL,
+    expiration timestamptz NULL,
+    is_current boolean NOT NULL DEFAULT false,
+    created_by uuid NULL REFERENCES public.users(id) ON DELETE SET NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    destroyed_at timestamptz NULL,
+    UNIQUE (secret_id, version)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_external_auth_token_versions_current
+    ON public.external_auth_token_versions (secret_id) WHERE is_current;
+
+-- Every existing secret becomes version 1 of itself.
+INSERT INTO public.external_auth_token_versions (secret_id, version, token, expiration, is_current, created_by, created_at)
+SELECT t.id, 1, t.token, t.expiration, true, t.user_id, COALESCE(t.created_at, CURRENT_TIMESTAMP)
+FROM public.external_auth_tokens t
+ON CONFLICT (secret_id, version) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.external_auth_token_versions;
+-- +goose StatementEnd
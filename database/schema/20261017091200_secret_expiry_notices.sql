@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- One row per secret recording the expiration the owner was last warned about, so a
+-- renewed secret is warned about again before its new expiration.
+CREATE TABLE IF NOT EXISTS public.external_auth_token_expiry_notices (
+    secret_id uuid PRIMARY KEY REFERENCES public.external_auth_tokens(id) ON DELETE CASCADE,
+    expiration timestamptz NOT NULL,
+    notified_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_auth_tokens_expiration
+    ON public.external_auth_tokens (expiration);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.idx_external_auth_tokens_expiration;
+DROP TABLE IF EXISTS public.external_auth_token_expiry_notices;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.external_auth_token_grants (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    secret_id uuid NOT NULL REFERENCES public.external_auth_tokens(id) ON DELETE CASCADE,
+    grantee_user_id uuid NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    grantee_role_id uuid NULL REFERENCES public.user_roles(id) ON DELETE CASCADE,
+    access_level text NOT NULL CHECK (access_level IN ('read', 'use')),
+    granted_by uuid NULL REFERENCES public.users(id) ON DELETE SET NULL,
+    expires_at timestamptz NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at timestamptz NULL,
+    CHECK ((grantee_user_id IS NULL) <> (grantee_role_id IS NULL))
+);
+
+COMMENT ON TABLE public.external_auth_token_grants IS 'Grants share a secret with a user or with every member of a role. read returns the plaintext to the grantee, use only lets server-side features decrypt it on their behalf.';
+
+CREATE INDEX IF NOT EXISTS idx_external_auth_token_grants_secret
+    ON public.external_auth_token_grants (secret_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_external_auth_token_grants_user
+    ON public.external_auth_token_grants (grantee_user_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_external_auth_token_grants_role
+    ON public.external_auth_token_grants (grantee_role_id) WHERE revoked_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.external_auth_token_grants;
+-- +goose StatementEnd
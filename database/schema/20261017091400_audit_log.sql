@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.audit_log (
+    seq bigint PRIMARY KEY,
+    id uuid NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    occurred_at timestamptz NOT NULL,
+    actor_user_id uuid NULL,
+    permission text NULL,
+    action text NOT NULL,
+    resource_type text NOT NULL,
+    resource_id text NULL,
+    method text NULL,
+    path text NULL,
+    status_code int NULL,
+    client_ip text NULL,
+    request_id text NULL,
+    diff json NULL,
+    prev_hash bytea NOT NULL,
+    hash bytea NOT NULL
+);
+
+COMMENT ON TABLE public.audit_log IS 'Append-only record of mutating API calls and secret reads. Each row hashes the previous row''s hash, so editing or removing a row breaks the chain.';
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON public.audit_log (actor_user_id, seq DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON public.audit_log (resource_type, resource_id, seq DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_occurred_at ON public.audit_log (occurred_at);
+
+CREATE OR REPLACE FUNCTION public.audit_log_append_only()
+RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update_or_delete
+    BEFORE UPDATE OR DELETE ON public.audit_log
+    FOR EACH ROW EXECUTE FUNCTION public.audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON public.audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION public.audit_log_append_only();
+
+INSERT INTO public.app_permissions (id, permission_name, permission_description)
+VALUES (gen_random_uuid(), 'ReadAuditLog', 'Query and verify the audit log')
+ON CONFLICT (permission_name) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM public.role_permission_mapping
+WHERE permission_id IN (SELECT id FROM public.app_permissions WHERE permission_name = 'ReadAuditLog');
+
+DELETE FROM public.app_permissions WHERE permission_name = 'ReadAuditLog';
+
+DROP TABLE IF EXISTS public.audit_log;
+DROP FUNCTION IF EXISTS public.audit_log_append_only();
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.host_server_tags (
+    host_server_id uuid NOT NULL REFERENCES public.host_servers(id) ON DELETE CASCADE,
+    tag text NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT host_server_tags_pkey PRIMARY KEY (host_server_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_server_tags_tag ON public.host_server_tags (tag);
+
+COMMENT ON TABLE public.host_server_tags IS 'Free-form labels on host servers that permission scopes can match.';
+
+CREATE TABLE IF NOT EXISTS public.role_permission_scopes (
+    id uuid DEFAULT gen_random_uuid() NOT NULL,
+    role_id uuid NOT NULL REFERENCES public.user_roles(id) ON DELETE CASCADE,
+    permission_id uuid NOT NULL REFERENCES public.app_permissions(id) ON DELETE CASCADE,
+    scope_type text NOT NULL,
+    scope_value text NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT role_permission_scopes_pkey PRIMARY KEY (id),
+    CONSTRAINT role_permission_scopes_unique UNIQUE (role_id, permission_id, scope_type, scope_value),
+    CONSTRAINT role_permission_scopes_type_check CHECK (scope_type IN ('host_server', 'host_server_type', 'tag'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_permission_scopes_role_permission ON public.role_permission_scopes (role_id, permission_id);
+
+COMMENT ON TABLE public.role_permission_scopes IS 'Restricts a role permission mapping to matching resources. A mapping without scopes applies to every resource.';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.role_permission_scopes;
+DROP TABLE IF EXISTS public.host_server_tags;
+-- +goose StatementEnd
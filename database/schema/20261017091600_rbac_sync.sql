@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO public.app_permissions (id, permission_name, permission_description)
+VALUES (gen_random_uuid(), 'SyncRbac', 'Plan and apply declarative role and permission documents')
+ON CONFLICT (permission_name) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM public.role_permission_mapping
+WHERE permission_id IN (SELECT id FROM public.app_permissions WHERE permission_name = 'SyncRbac');
+
+DELETE FROM public.app_permissions WHERE permission_name = 'SyncRbac';
+-- +goose StatementEnd
@@ -0,0 +1,132 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.organizations (
+    id uuid DEFAULT gen_random_uuid() NOT NULL,
+    name text NOT NULL,
+    description text,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    last_modified timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    is_deleted boolean DEFAULT false NOT NULL,
+    CONSTRAINT organizations_pkey PRIMARY KEY (id),
+    CONSTRAINT organizations_name_unique UNIQUE (name)
+);
+
+COMMENT ON TABLE public.organizations IS 'Tenants. Users act within one active organization at a time and only see resources it owns.';
+
+CREATE TABLE IF NOT EXISTS public.organization_members (
+    org_id uuid NOT NULL REFERENCES public.organizations(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT organization_members_pkey PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON public.organization_members (user_id);
+
+COMMENT ON TABLE public.organization_members IS 'Users that may switch into an organization.';
+
+CREATE TABLE IF NOT EXISTS public.organization_member_roles (
+    org_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    role_id uuid NOT NULL REFERENCES public.user_roles(id) ON DELETE CASCADE,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT organization_member_roles_pkey PRIMARY KEY (org_id, user_id, role_id),
+    CONSTRAINT organization_member_roles_member_fkey FOREIGN KEY (org_id, user_id)
+        REFERENCES public.organization_members(org_id, user_id) ON DELETE CASCADE
+);
+
+COMMENT ON TABLE public.organization_member_roles IS 'Roles a member holds only while the organization is active, in addition to their global roles.';
+
+CREATE TABLE IF NOT EXISTS public.organization_resources (
+    resource_type text NOT NULL,
+    resource_id uuid NOT NULL,
+    org_id uuid NOT NULL REFERENCES public.organizations(id) ON DELETE CASCADE,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT organization_resources_pkey PRIMARY KEY (resource_type, resource_id),
+    CONSTRAINT organization_resources_type_check CHECK (resource_type IN ('host_server', 'ssh_key', 'external_app', 'secret'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_resources_org ON public.organization_resources (org_id, resource_type);
+
+COMMENT ON TABLE public.organization_resources IS 'The organization owning a host server, ssh key, external application or secret. External applications without a row are shared by every organization.';
+
+-- Ownership rows are keyed by the resource id alone, the trigger removes them with the resource.
+CREATE OR REPLACE FUNCTION public.organization_resources_cleanup()
+RETURNS trigger AS $$
+BEGIN
+    DELETE FROM public.organization_resources
+    WHERE resource_type = TG_ARGV[0] AND resource_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER host_servers_organization_cleanup
+AFTER DELETE ON public.host_servers
+FOR EACH ROW EXECUTE FUNCTION public.organization_resources_cleanup('host_server');
+
+CREATE TRIGGER ssh_keys_organization_cleanup
+AFTER DELETE ON public.ssh_keys
+FOR EACH ROW EXECUTE FUNCTION public.organization_resources_cleanup('ssh_key');
+
+CREATE TRIGGER external_integration_apps_organization_cleanup
+AFTER DELETE ON public.external_integration_apps
+FOR EACH ROW EXECUTE FUNCTION public.organization_resources_cleanup('external_app');
+
+CREATE TRIGGER external_auth_tokens_organization_cleanup
+AFTER DELETE ON public.external_auth_tokens
+FOR EACH ROW EXECUTE FUNCTION public.organization_resources_cleanup('secret');
+
+-- Everything that existed before organizations moves into the Default organization.
+INSERT INTO public.organizations (id, name, description)
+VALUES ('00000000-0000-0000-0000-000000000001', 'Default', 'Users and resources created before organizations were introduced')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO public.organization_members (org_id, user_id)
+SELECT o.id, u.id
+FROM public.organizations o
+CROSS JOIN public.users u
+WHERE o.name = 'Default'
+ON CONFLICT (org_id, user_id) DO NOTHING;
+
+INSERT INTO public.organization_resources (resource_type, resource_id, org_id)
+SELECT 'host_server', h.id, o.id FROM public.host_servers h, public.organizations o WHERE o.name = 'Default'
+UNION ALL
+SELECT 'ssh_key', k.id, o.id FROM public.ssh_keys k, public.organizations o WHERE o.name = 'Default'
+UNION ALL
+SELECT 'secret', t.id, o.id FROM public.external_auth_tokens t, public.organizations o WHERE o.name = 'Default'
+ON CONFLICT (resource_type, resource_id) DO NOTHING;
+
+ALTER TABLE public.refresh_tokens ADD COLUMN IF NOT EXISTS org_id uuid REFERENCES public.organizations(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN public.refresh_tokens.org_id IS 'Active organization of the session, kept across rotations.';
+
+INSERT INTO public.app_permissions (id, permission_name, permission_description)
+VALUES
+    (gen_random_uuid(), 'ReadOrganizations', 'List organizations and their members'),
+    (gen_random_uuid(), 'ManageOrganizations', 'Create and delete organizations and manage their members and member roles')
+ON CONFLICT (permission_name) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM public.role_permission_mapping
+WHERE permission_id IN (
+    SELECT id FROM public.app_permissions
+    WHERE permission_name IN ('ReadOrganizations', 'ManageOrganizations')
+);
+
+DELETE FROM public.app_permissions
+WHERE permission_name IN ('ReadOrganizations', 'ManageOrganizations');
+
+ALTER TABLE public.refresh_tokens DROP COLUMN IF EXISTS org_id;
+
+DROP TRIGGER IF EXISTS external_auth_tokens_organization_cleanup ON public.external_auth_tokens;
+DROP TRIGGER IF EXISTS external_integration_apps_organization_cleanup ON public.external_integration_apps;
+DROP TRIGGER IF EXISTS ssh_keys_organization_cleanup ON public.ssh_keys;
+DROP TRIGGER IF EXISTS host_servers_organization_cleanup ON public.host_servers;
+DROP FUNCTION IF EXISTS public.organization_resources_cleanup();
+
+DROP TABLE IF EXISTS public.organization_resources;
+DROP TABLE IF EXISTS public.organization_member_roles;
+DROP TABLE IF EXISTS public.organization_members;
+DROP TABLE IF EXISTS public.organizations;
+-- +goose StatementEnd
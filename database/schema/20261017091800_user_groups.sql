@@ -0,0 +1,56 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.user_groups (
+    id uuid DEFAULT gen_random_uuid() NOT NULL,
+    name text NOT NULL,
+    description text,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    last_modified timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT user_groups_pkey PRIMARY KEY (id),
+    CONSTRAINT user_groups_name_unique UNIQUE (name)
+);
+
+COMMENT ON TABLE public.user_groups IS 'Named sets of users, such as platform-oncall, that hold roles on behalf of their members.';
+
+CREATE TABLE IF NOT EXISTS public.user_group_members (
+    group_id uuid NOT NULL REFERENCES public.user_groups(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT user_group_members_pkey PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_group_members_user_id ON public.user_group_members (user_id);
+
+COMMENT ON TABLE public.user_group_members IS 'Users belonging to a group. A user can belong to any number of groups.';
+
+CREATE TABLE IF NOT EXISTS public.user_group_roles (
+    group_id uuid NOT NULL REFERENCES public.user_groups(id) ON DELETE CASCADE,
+    role_id uuid NOT NULL REFERENCES public.user_roles(id) ON DELETE CASCADE,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT user_group_roles_pkey PRIMARY KEY (group_id, role_id)
+);
+
+COMMENT ON TABLE public.user_group_roles IS 'Roles every member of the group holds in addition to the roles mapped to them directly.';
+
+INSERT INTO public.app_permissions (id, permission_name, permission_description)
+VALUES
+    (gen_random_uuid(), 'ReadUserGroups', 'List user groups, their members and roles'),
+    (gen_random_uuid(), 'ManageUserGroups', 'Create, update and delete user groups and manage their members and roles')
+ON CONFLICT (permission_name) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM public.role_permission_mapping
+WHERE permission_id IN (
+    SELECT id FROM public.app_permissions
+    WHERE permission_name IN ('ReadUserGroups', 'ManageUserGroups')
+);
+
+DELETE FROM public.app_permissions
+WHERE permission_name IN ('ReadUserGroups', 'ManageUserGroups');
+
+DROP TABLE IF EXISTS public.user_group_roles;
+DROP TABLE IF EXISTS public.user_group_members;
+DROP TABLE IF EXISTS public.user_groups;
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+-- TOTP seeds move out of external_auth_tokens so the secrets APIs can no longer read,
+-- delete, destroy or purge them. The ciphertext is copied unchanged and stays bound to
+-- (user_id, totp_mfa app id, seed_id), where seed_id is the former secret id.
+ALTER TABLE public.user_totp_credentials ADD COLUMN IF NOT EXISTS seed bytea NULL;
+
+UPDATE public.user_totp_credentials c
+SET seed = t.token
+FROM public.external_auth_tokens t
+WHERE t.id = c.secret_id;
+
+-- An enabled enrollment without its seed would silently drop the user to password only
+-- logins, so stop and let an operator reset those users. Unconfirmed enrollments protect
+-- nothing yet and are dropped.
+DO $$
+DECLARE
+    missing text;
+BEGIN
+    SELECT string_agg(user_id::text, ', ') INTO missing
+    FROM public.user_totp_credentials
+    WHERE seed IS NULL AND enabled = true;
+    IF missing IS NOT NULL THEN
+        RAISE EXCEPTION 'enabled TOTP enrollments have no seed secret for users: %. Reset MFA for these users before migrating.', missing;
+    END IF;
+END $$;
+
+DELETE FROM public.user_totp_credentials WHERE seed IS NULL AND enabled = false;
+
+ALTER TABLE public.user_totp_credentials DROP CONSTRAINT IF EXISTS user_totp_credentials_secret_id_fkey;
+ALTER TABLE public.user_totp_credentials RENAME COLUMN secret_id TO seed_id;
+ALTER TABLE public.user_totp_credentials ALTER COLUMN seed SET NOT NULL;
+
+DELETE FROM public.external_auth_tokens
+WHERE external_app_id = (SELECT id FROM public.external_integration_apps WHERE "name" = 'totp_mfa');
+
+COMMENT ON TABLE public.user_totp_credentials IS 'TOTP enrollments. The seed is sealed like a user secret but is only reachable through the MFA endpoints.';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+INSERT INTO public.external_auth_tokens (id, user_id, external_app_id, token, expiration)
+SELECT c.seed_id, c.user_id, a.id, c.seed, CURRENT_TIMESTAMP + INTERVAL '100 years'
+FROM public.user_totp_credentials c
+CROSS JOIN public.external_integration_apps a
+WHERE a."name" = 'totp_mfa';
+
+COMMENT ON TABLE public.user_totp_credentials IS NULL;
+ALTER TABLE public.user_totp_credentials RENAME COLUMN seed_id TO secret_id;
+ALTER TABLE public.user_totp_credentials
+    ADD CONSTRAINT user_totp_credentials_secret_id_fkey
+    FOREIGN KEY (secret_id) REFERENCES public.external_auth_tokens(id) ON DELETE CASCADE;
+ALTER TABLE public.user_totp_credentials DROP COLUMN IF EXISTS seed;
+-- +goose StatementEnd
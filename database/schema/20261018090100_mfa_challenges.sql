@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.mfa_challenges (
+    jti uuid PRIMARY KEY,
+    attempts integer NOT NULL DEFAULT 0,
+    completed_at timestamptz NULL,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_challenges_expires_at ON public.mfa_challenges (expires_at);
+
+COMMENT ON TABLE public.mfa_challenges IS 'Codes submitted per MFA login challenge and whether it was used, shared by every replica.';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.mfa_challenges;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO public.app_permissions (id, permission_name, permission_description)
+VALUES (gen_random_uuid(), 'ManageSecrets', 'Create, change, share and delete the caller''s own secrets')
+ON CONFLICT (permission_name) DO NOTHING;
+
+-- Roles that may read their own secrets may also manage them. Ownership is still checked
+-- per secret, reaching other users' secrets needs AccessAllUserSecrets, which is not granted.
+INSERT INTO public.role_permission_mapping (id, role_id, permission_id, "enabled", created_at, last_modified)
+SELECT gen_random_uuid(), m.role_id, p.id, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM public.role_permission_mapping m
+JOIN public.app_permissions rp ON rp.id = m.permission_id
+JOIN public.user_roles r ON r.id = m.role_id
+CROSS JOIN public.app_permissions p
+WHERE rp.permission_name = 'ReadSecretPlaintext'
+  AND m."enabled" = true
+  AND r.is_deleted = false
+  AND p.permission_name = 'ManageSecrets'
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM public.role_permission_mapping
+WHERE permission_id IN (SELECT id FROM public.app_permissions WHERE permission_name = 'ManageSecrets');
+
+DELETE FROM public.app_permissions WHERE permission_name = 'ManageSecrets';
+-- +goose StatementEnd
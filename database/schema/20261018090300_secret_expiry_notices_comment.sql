@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+COMMENT ON TABLE public.external_auth_token_expiry_notices IS 'One row per secret recording the expiration the owner was last warned about, so a renewed secret is warned about again before its new expiration.';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+COMMENT ON TABLE public.external_auth_token_expiry_notices IS NULL;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- SSH keys created without an expiration used to get one of a year from creation. Expired
+-- secrets are now refused, so clear those defaults; NULL means the key never expires.
+-- Expirations the owner chose explicitly are kept.
+WITH ssh_key_secrets AS (
+    SELECT priv_secret_id AS secret_id FROM public.ssh_keys
+    UNION
+    SELECT passphrase_id FROM public.ssh_keys WHERE passphrase_id IS NOT NULL
+), defaulted AS (
+    SELECT t.id
+    FROM public.external_auth_tokens t
+    JOIN ssh_key_secrets s ON s.secret_id = t.id
+    WHERE t.expiration BETWEEN t.created_at + INTERVAL '1 year' - INTERVAL '1 minute'
+                           AND t.created_at + INTERVAL '1 year' + INTERVAL '1 minute'
+), cleared_versions AS (
+    UPDATE public.external_auth_token_versions v
+    SET expiration = NULL
+    FROM defaulted d
+    WHERE v.secret_id = d.id
+)
+UPDATE public.external_auth_tokens t
+SET expiration = NULL, last_modified = CURRENT_TIMESTAMP
+FROM defaulted d
+WHERE t.id = d.id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+WITH ssh_key_secrets AS (
+    SELECT priv_secret_id AS secret_id FROM public.ssh_keys
+    UNION
+    SELECT passphrase_id FROM public.ssh_keys WHERE passphrase_id IS NOT NULL
+), restored_versions AS (
+    UPDATE public.external_auth_token_versions v
+    SET expiration = v.created_at + INTERVAL '1 year'
+    FROM ssh_key_secrets s
+    WHERE v.secret_id = s.secret_id AND v.expiration IS NULL
+)
+UPDATE public.external_auth_tokens t
+SET expiration = t.created_at + INTERVAL '1 year'
+FROM ssh_key_secrets s
+WHERE t.id = s.secret_id AND t.expiration IS NULL;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Users created after organizations were introduced did not join any organization, so
+-- their tokens carried no org_id and every scoped resource was hidden from them. New users
+-- now join the default organization; move the ones left without a membership there too.
+INSERT INTO public.organization_members (org_id, user_id)
+SELECT o.id, u.id
+FROM public.organizations o
+CROSS JOIN public.users u
+WHERE o.name = 'Default' AND o.is_deleted = false
+  AND NOT EXISTS (
+    SELECT 1
+    FROM public.organization_members m
+    JOIN public.organizations mo ON mo.id = m.org_id
+    WHERE m.user_id = u.id AND mo.is_deleted = false
+  )
+ON CONFLICT (org_id, user_id) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- The added memberships cannot be told apart from ones granted later, so they are kept.
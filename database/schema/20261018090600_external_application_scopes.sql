@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- External application permissions can be scoped to single applications.
+ALTER TABLE public.role_permission_scopes DROP CONSTRAINT IF EXISTS role_permission_scopes_type_check;
+ALTER TABLE public.role_permission_scopes ADD CONSTRAINT role_permission_scopes_type_check
+    CHECK (scope_type IN ('host_server', 'host_server_type', 'tag', 'external_application'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Dropping the only scope of a mapping would make it unrestricted, disable those mappings
+-- instead so reverting never widens access.
+UPDATE public.role_permission_mapping m
+SET "enabled" = false, last_modified = CURRENT_TIMESTAMP
+FROM public.role_permission_scopes s
+WHERE s.role_id = m.role_id AND s.permission_id = m.permission_id
+  AND s.scope_type = 'external_application';
+DELETE FROM public.role_permission_scopes WHERE scope_type = 'external_application';
+ALTER TABLE public.role_permission_scopes DROP CONSTRAINT IF EXISTS role_permission_scopes_type_check;
+ALTER TABLE public.role_permission_scopes ADD CONSTRAINT role_permission_scopes_type_check
+    CHECK (scope_type IN ('host_server', 'host_server_type', 'tag'));
+-- +goose StatementEnd
@@ -1,17 +1,130 @@
 package hashing
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword generates a bcrypt hash for the given password.
+const argon2idPrefix = "$argon2id$"
+
+var ErrUnsupportedHash = errors.New("unsupported password hash format")
+
+// Argon2Params are encoded into every hash so they can be raised later without
+// invalidating existing passwords.
+type Argon2Params struct {
+	MemoryKiB   uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for Argon2id.
+var DefaultArgon2Params = Argon2Params{
+	MemoryKiB:   64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var (
+	paramsMu      sync.RWMutex
+	currentParams = DefaultArgon2Params
+)
+
+// SetArgon2Params changes the parameters used for new hashes.
+func SetArgon2Params(p Argon2Params) {
+	paramsMu.Lock()
+	defer paramsMu.Unlock()
+	currentParams = p
+}
+
+func GetArgon2Params() Argon2Params {
+	paramsMu.RLock()
+	defer paramsMu.RUnlock()
+	return currentParams
+}
+
+// HashPassword generates an Argon2id hash in the PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	p := GetArgon2Params()
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKiB, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.MemoryKiB, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
 }
 
-// VerifyPassword verifies if the given password matches the stored hash.
+// VerifyPassword verifies if the given password matches the stored Argon2id or legacy
+// bcrypt hash.
 func VerifyPassword(password, hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		p, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		candidate := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKiB, p.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(candidate, key) == 1
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// NeedsRehash reports whether the hash is bcrypt or uses weaker Argon2id parameters than
+// the current ones, so it should be replaced after a successful login.
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	want := GetArgon2Params()
+	return p.MemoryKiB < want.MemoryKiB ||
+		p.Iterations < want.Iterations ||
+		p.Parallelism < want.Parallelism ||
+		uint32(len(salt)) < want.SaltLength ||
+		uint32(len(key)) < want.KeyLength
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnsupportedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.MemoryKiB, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnsupportedHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,51 @@
+package hashing
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	SetArgon2Params(Argon2Params{MemoryKiB: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	t.Cleanup(func() { SetArgon2Params(DefaultArgon2Params) })
+
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash encoding %q", hash)
+	}
+	if !VerifyPassword("correct horse battery staple", hash) {
+		t.Fatal("expected password to verify")
+	}
+	if VerifyPassword("wrong", hash) {
+		t.Fatal("expected wrong password to be rejected")
+	}
+	if NeedsRehash(hash) {
+		t.Fatal("hash with current params should not need a rehash")
+	}
+
+	SetArgon2Params(Argon2Params{MemoryKiB: 2048, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if !NeedsRehash(hash) {
+		t.Fatal("hash with weaker params should need a rehash")
+	}
+	if !VerifyPassword("correct horse battery staple", hash) {
+		t.Fatal("old params must still verify after raising costs")
+	}
+}
+
+func TestLegacyBcryptVerifiesAndNeedsRehash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("legacy-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("error creating bcrypt hash: %v", err)
+	}
+	if !VerifyPassword("legacy-password", string(legacy)) {
+		t.Fatal("expected bcrypt hash to verify")
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Fatal("expected bcrypt hash to need a rehash")
+	}
+}
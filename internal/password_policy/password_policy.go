@@ -0,0 +1,166 @@
+package password_policy
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PolicyViolationError lists every rule a password failed so clients can show them at once.
+type PolicyViolationError struct {
+	Violations []string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, "; ")
+}
+
+// ErrPasswordReused is returned by the user service when a password matches one of the
+// user's recent passwords.
+var ErrPasswordReused = &PolicyViolationError{Violations: []string{"password was used recently"}}
+
+type Policy struct {
+	MinLength int
+	// bounds hashing work for very long inputs
+	MaxLength int
+	// number of distinct classes out of lower, upper, digit and symbol
+	MinCharClasses int
+	// number of previous passwords that may not be reused
+	HistoryCount int
+	breached     map[string]struct{}
+}
+
+var DefaultPolicy = Policy{
+	MinLength:      12,
+	MaxLength:      256,
+	MinCharClasses: 3,
+	HistoryCount:   5,
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultPolicy = &DefaultPolicy
+)
+
+func SetDefault(p *Policy) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultPolicy = p
+}
+
+func Default() *Policy {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultPolicy
+}
+
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(v)
+	if err != nil || parsed < 0 {
+		slog.Warn("Invalid password policy setting, using default", slog.String("name", name), slog.String("value", v))
+		return def
+	}
+	return parsed
+}
+
+// NewPolicyFromEnv reads PASSWORD_* settings and loads the breached password list from
+// PASSWORD_BREACHED_LIST_FILE when set.
+func NewPolicyFromEnv() (*Policy, error) {
+	p := &Policy{
+		MinLength:      envInt("PASSWORD_MIN_LENGTH", DefaultPolicy.MinLength),
+		MaxLength:      envInt("PASSWORD_MAX_LENGTH", DefaultPolicy.MaxLength),
+		MinCharClasses: envInt("PASSWORD_MIN_CHAR_CLASSES", DefaultPolicy.MinCharClasses),
+		HistoryCount:   envInt("PASSWORD_HISTORY_COUNT", DefaultPolicy.HistoryCount),
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_LIST_FILE"); path != "" {
+		if err := p.LoadBreachedList(path); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// LoadBreachedList reads one password per line. Blank lines and lines starting with #
+// are skipped, matching is case insensitive.
+func (p *Policy) LoadBreachedList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening breached password list: %w", err)
+	}
+	defer f.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading breached password list: %w", err)
+	}
+	p.AddBreached(breached)
+	slog.Info("Loaded breached password list", slog.String("path", path), slog.Int("count", len(breached)))
+	return nil
+}
+
+func (p *Policy) AddBreached(passwords map[string]struct{}) {
+	if p.breached == nil {
+		p.breached = make(map[string]struct{}, len(passwords))
+	}
+	for pw := range passwords {
+		p.breached[strings.ToLower(pw)] = struct{}{}
+	}
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// Validate checks length, character classes and the breached list. Reuse is checked by
+// the user service, which has the password history.
+func (p *Policy) Validate(password string) error {
+	var violations []string
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+	if classes := charClasses(password); classes < p.MinCharClasses {
+		violations = append(violations, fmt.Sprintf("must contain at least %d of lowercase, uppercase, digits and symbols", p.MinCharClasses))
+	}
+	if _, found := p.breached[strings.ToLower(password)]; found {
+		violations = append(violations, "appears in a list of breached passwords")
+	}
+	if len(violations) > 0 {
+		return &PolicyViolationError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package password_policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "breached.txt")
+	if err := os.WriteFile(list, []byte("# top passwords\nPassword123!\n\nletmein\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Policy{MinLength: 10, MaxLength: 64, MinCharClasses: 3}
+	if err := p.LoadBreachedList(list); err != nil {
+		t.Fatalf("error loading breached list: %v", err)
+	}
+
+	cases := map[string]bool{
+		"Sh0rt!":              false,
+		"alllowercaseletters": false,
+		"password123!":        false, // breached, case insensitive
+		"Tr1cky-Horse-Stable": true,
+	}
+	for pw, ok := range cases {
+		err := p.Validate(pw)
+		if ok && err != nil {
+			t.Errorf("expected %q to pass, got %v", pw, err)
+		}
+		var violation *PolicyViolationError
+		if !ok && !errors.As(err, &violation) {
+			t.Errorf("expected %q to fail with a policy violation, got %v", pw, err)
+		}
+	}
+}
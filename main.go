@@ -27,18 +27,22 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/babbage88/go-infra/api/api_server"
 	"github.com/babbage88/go-infra/api/authapi"
 	"github.com/babbage88/go-infra/database/infra_db_pg"
 	"github.com/babbage88/go-infra/services/external_applications"
 	"github.com/babbage88/go-infra/services/host_servers"
+	"github.com/babbage88/go-infra/services/rbac_sync"
 	"github.com/babbage88/go-infra/services/ssh_key_provider"
 	"github.com/babbage88/go-infra/services/user_crud_svc"
-	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/babbage88/go-infra/services/user_mfa"
 	"github.com/google/uuid"
 )
 
@@ -64,10 +68,45 @@ func main() {
 	configureStartupOptions()
 
 	connPool := initPgConnPool()
+	initializePasswordPolicy()
+	initializeJwtKeyRing(connPool)
+	initializeTokenDenylist(connPool)
+	initializePermissionCache(connPool)
+	auditLog := initializeAuditLog(connPool)
+	resourcePolicy := initializeResourcePolicy(connPool)
+	orgs := initializeOrganizations(connPool)
+	userGroups := initializeUserGroups(connPool)
+	if auditLog != nil {
+		initializeAuditSinks(auditLog)
+	}
+	if syncRbacFile != "" {
+		syncRbacPolicy(connPool)
+	}
 	userService := &user_crud_svc.UserCRUDService{DbConn: connPool}
-	authService := &authapi.LocalAuthService{DbConn: connPool}
+	if orgs != nil {
+		userService.DefaultOrganizationId = initializeDefaultOrganization(orgs)
+	}
+	mfaProvider := user_mfa.NewPgMfaProvider(connPool)
+	webAuthnProvider := initializeWebAuthn(connPool)
+	authService := &authapi.LocalAuthService{
+		DbConn:                     connPool,
+		Mfa:                        mfaProvider,
+		Passkeys:                   webAuthnProvider,
+		PasskeyRequiredPermissions: passkeyRequiredPermissionsFromEnv(),
+		RequireVerifiedEmail:       strings.EqualFold(os.Getenv("EMAIL_VERIFICATION_REQUIRED"), "true"),
+		MfaChallenges:              initializeMfaChallenges(connPool),
+	}
+	authService.StartRefreshTokenCleanup(context.Background(), time.Hour)
+	if loginThrottle := initializeLoginThrottle(connPool); loginThrottle != nil {
+		authService.Throttle = loginThrottle
+		userService.Lockouts = loginThrottle
+	}
+	oidcService, oidcPostLoginRedirect := initializeOidc(connPool, userService, authService)
+	apiTokenProvider := initializeApiTokens(connPool)
+	userVerification := initializeUserVerification(connPool, userService)
 	healthCheckService := &user_crud_svc.HealthCheckService{DbConn: connPool}
-	secretProvider := user_secrets.NewPgUserSecretStore(connPool)
+	secretProvider := initializeUserSecrets(connPool)
+	initializeSecretExpiry(connPool)
 	hostServerProvider := host_servers.NewHostServerProvider(infra_db_pg.New(connPool), secretProvider)
 	sshKeyProvider := ssh_key_provider.NewPgSshKeySecretStore(connPool)
 	externalAppsService := &external_applications.ExternalApplicationsService{DbConn: connPool}
@@ -82,15 +121,32 @@ func main() {
 		SshKeyProvider:          sshKeyProvider,
 		ExternalAppsService:     externalAppsService,
 		SSHConnectionManager:    sshConnectionManager,
+		MfaProvider:             mfaProvider,
+		WebAuthnProvider:        webAuthnProvider,
+		ApiTokenProvider:        apiTokenProvider,
+		UserVerification:        userVerification,
+		ResourcePolicy:          resourcePolicy,
+		RbacSync:                rbac_sync.NewPgRbacSync(connPool),
+		UserGroups:              userGroups,
 		UseSsl:                  userHttps,
 		Certificate:             certFile,
 		CertKey:                 certKey,
 		SwaggerSpec:             swaggerSpec,
 	}
+	if auditLog != nil {
+		apiServer.AuditLog = auditLog
+	}
+	if orgs != nil {
+		apiServer.Organizations = orgs
+	}
+	if oidcService != nil {
+		apiServer.OidcProvider = oidcService
+		apiServer.OidcPostLoginRedirect = oidcPostLoginRedirect
+	}
 
 	switch {
 	case initDevUser:
-		userService.UpdateUserPasswordById(uuid.Must(uuid.Parse(os.Getenv("DEV_USER_UUID"))), os.Getenv("DEV_APP_PASS"))
+		userService.UpdateUserPasswordById(context.Background(), uuid.Must(uuid.Parse(os.Getenv("DEV_USER_UUID"))), os.Getenv("DEV_APP_PASS"))
 	}
 
 	apiServer.StartAPIServices(&srvport)
@@ -2,14 +2,39 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/babbage88/go-infra/api/authapi"
 	infra_db "github.com/babbage88/go-infra/database/infra_db"
 	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/internal/hashing"
+	"github.com/babbage88/go-infra/internal/password_policy"
+	"github.com/babbage88/go-infra/internal/type_helper"
+	"github.com/babbage88/go-infra/services/api_tokens"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/login_throttle"
+	"github.com/babbage88/go-infra/services/mailer"
+	"github.com/babbage88/go-infra/services/oidc_auth"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/permission_cache"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/babbage88/go-infra/services/ssh_connections"
+	"github.com/babbage88/go-infra/services/token_denylist"
+	"github.com/babbage88/go-infra/services/user_crud_svc"
+	"github.com/babbage88/go-infra/services/user_groups"
+	"github.com/babbage88/go-infra/services/user_mfa"
 	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/babbage88/go-infra/services/user_verification"
+	"github.com/babbage88/go-infra/services/webauthn"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/valkey-io/valkey-go"
 )
@@ -19,6 +44,425 @@ func initPgConnPool() *pgxpool.Pool {
 	return connPool
 }
 
+var (
+	valkeyClientOnce sync.Once
+	valkeyClient     valkey.Client
+)
+
+// initValkeyClient connects to Valkey once and shares the client between every feature
+// configured to use it.
+func initValkeyClient() valkey.Client {
+	valkeyClientOnce.Do(func() {
+		valkeyClient = newValkeyClient()
+	})
+	return valkeyClient
+}
+
+func newValkeyClient() valkey.Client {
+	valkeyAddr := os.Getenv("VALKEY_ADDR")
+	if valkeyAddr == "" {
+		valkeyAddr = "127.0.0.1:6379"
+	}
+	slog.Info("Connecting to Valkey", slog.String("address", valkeyAddr))
+	valkeyClient, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{valkeyAddr},
+		AuthCredentialsFn: func(acc valkey.AuthCredentialsContext) (valkey.AuthCredentials, error) {
+			return valkey.AuthCredentials{
+				Username: os.Getenv("VALKEY_USER"),
+				Password: os.Getenv("VALKEY_PASSWORD"),
+			}, nil
+		}})
+	if err != nil {
+		slog.Error("Failed to initialize Valkey client", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	// Test connection with PING command using the proper Valkey client pattern
+	if err := valkeyClient.Do(context.Background(), valkeyClient.B().Ping().Build()).Error(); err != nil {
+		slog.Error("Failed to ping Valkey server", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	slog.Info("Successfully pinged Valkey server")
+	return valkeyClient
+}
+
+func initializeTokenDenylist(connPool *pgxpool.Pool) {
+	pgDenylist := token_denylist.NewPgTokenDenylist(connPool)
+	pgDenylist.StartCleanup(context.Background(), time.Hour)
+
+	negativeTtlSec, err := type_helper.ParseIntegerFromString[int64](os.Getenv("TOKEN_DENYLIST_NEGATIVE_TTL_SECONDS"))
+	if err != nil {
+		negativeTtlSec = 10
+	}
+
+	var cache token_denylist.RevocationCache
+	switch os.Getenv("TOKEN_DENYLIST_CACHE") {
+	case "valkey":
+		cache = token_denylist.NewValkeyRevocationCache(initValkeyClient())
+		slog.Info("Using Valkey token denylist cache")
+	case "none":
+		token_denylist.SetDefault(pgDenylist)
+		slog.Info("Using Postgres token denylist without cache")
+		return
+	default:
+		cache = token_denylist.NewMemoryRevocationCache()
+		slog.Info("Using in-memory token denylist cache")
+	}
+
+	token_denylist.SetDefault(token_denylist.NewCachedTokenDenylist(pgDenylist, cache, time.Duration(negativeTtlSec)*time.Second))
+}
+
+// initializePermissionCache caches the permission set of each role. PERMISSION_CACHE=valkey
+// also shares invalidations between replicas over Valkey pub/sub, none disables the cache.
+func initializePermissionCache(connPool *pgxpool.Pool) {
+	ttlSec, err := type_helper.ParseIntegerFromString[int64](os.Getenv("PERMISSION_CACHE_TTL_SECONDS"))
+	if err != nil || ttlSec <= 0 {
+		ttlSec = int64(permission_cache.DefaultTtl / time.Second)
+	}
+
+	var bus permission_cache.InvalidationBus
+	switch os.Getenv("PERMISSION_CACHE") {
+	case "none":
+		slog.Info("Permission cache is disabled")
+		return
+	case "valkey":
+		bus = permission_cache.NewValkeyInvalidationBus(initValkeyClient())
+		slog.Info("Using in-memory permission cache with Valkey invalidation")
+	default:
+		slog.Info("Using in-memory permission cache")
+	}
+
+	cache := permission_cache.NewPermissionCache(permission_cache.NewPgRolePermissionLoader(connPool), bus, time.Duration(ttlSec)*time.Second)
+	cache.Start(context.Background())
+	permission_cache.SetDefault(cache)
+}
+
+// initializeResourcePolicy enables resource scopes on role permissions. Roles without
+// scopes keep access to every resource.
+func initializeResourcePolicy(connPool *pgxpool.Pool) *resource_policy.PgResourcePolicy {
+	policy := resource_policy.NewPgResourcePolicy(connPool)
+	resource_policy.SetDefault(policy)
+	return policy
+}
+
+// initializeOrganizations scopes resources to the active organization of each token.
+// ORGANIZATIONS=none turns tenancy off, every caller then sees every resource.
+func initializeOrganizations(connPool *pgxpool.Pool) *organizations.PgOrganizations {
+	if os.Getenv("ORGANIZATIONS") == "none" {
+		slog.Warn("Organizations are disabled, resources are not scoped")
+		return nil
+	}
+	orgs := organizations.NewPgOrganizations(connPool)
+	organizations.SetDefault(orgs)
+	return orgs
+}
+
+// initializeDefaultOrganization returns the organization new users join, named by
+// ORGANIZATIONS_DEFAULT ("Default" when unset). Without it new users could not sign in
+// to any organization, so a missing one stops startup.
+func initializeDefaultOrganization(orgs *organizations.PgOrganizations) uuid.UUID {
+	name := os.Getenv("ORGANIZATIONS_DEFAULT")
+	if name == "" {
+		name = "Default"
+	}
+	orgId, err := orgs.GetOrganizationIdByName(context.Background(), name)
+	if err != nil {
+		slog.Error("Default organization for new users not found", slog.String("name", name), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	return orgId
+}
+
+// initializeUserGroups adds the roles users hold through group membership to their tokens.
+func initializeUserGroups(connPool *pgxpool.Pool) *user_groups.PgUserGroups {
+	groups := user_groups.NewPgUserGroups(connPool)
+	user_groups.SetDefault(groups)
+	return groups
+}
+
+// initializeAuditLog returns nil when AUDIT_LOG=none, which disables auditing and the
+// /audit routes.
+func initializeAuditLog(connPool *pgxpool.Pool) *audit_log.PgAuditLog {
+	if os.Getenv("AUDIT_LOG") == "none" {
+		slog.Warn("Audit log is disabled")
+		return nil
+	}
+	auditLog := audit_log.NewPgAuditLog(connPool)
+	audit_log.SetDefault(auditLog)
+	slog.Info("Recording audit log to Postgres")
+	return auditLog
+}
+
+// initializeAuditSinks exports audit entries to the comma separated AUDIT_SINKS, each
+// through its own disk-backed buffer under AUDIT_SINK_BUFFER_DIR.
+func initializeAuditSinks(auditLog *audit_log.PgAuditLog) {
+	kinds := os.Getenv("AUDIT_SINKS")
+	if kinds == "" || kinds == "none" {
+		return
+	}
+	bufferDir := os.Getenv("AUDIT_SINK_BUFFER_DIR")
+	if bufferDir == "" {
+		bufferDir = "audit-buffer"
+	}
+	flushSec, err := strconv.Atoi(os.Getenv("AUDIT_SINK_FLUSH_SECONDS"))
+	if err != nil || flushSec <= 0 {
+		flushSec = 5
+	}
+
+	for _, kind := range strings.Split(kinds, ",") {
+		var sink audit_log.AuditSink
+		var err error
+		switch strings.TrimSpace(kind) {
+		case "syslog":
+			var tlsConfig *tls.Config
+			network := os.Getenv("AUDIT_SYSLOG_NETWORK")
+			if network == "tls" {
+				tlsConfig, err = audit_log.SyslogTLSConfig(os.Getenv("AUDIT_SYSLOG_TLS_CA_FILE"))
+			}
+			if err == nil {
+				sink, err = audit_log.NewSyslogSink(network, os.Getenv("AUDIT_SYSLOG_ADDR"), tlsConfig)
+			}
+		case "file":
+			maxMb, convErr := strconv.ParseInt(os.Getenv("AUDIT_FILE_MAX_MB"), 10, 64)
+			if convErr != nil || maxMb <= 0 {
+				maxMb = 100
+			}
+			maxBackups, convErr := strconv.Atoi(os.Getenv("AUDIT_FILE_MAX_BACKUPS"))
+			if convErr != nil || maxBackups < 0 {
+				maxBackups = 10
+			}
+			sink, err = audit_log.NewRotatingFileSink(os.Getenv("AUDIT_FILE_PATH"), maxMb<<20, maxBackups)
+		case "webhook":
+			sink, err = audit_log.NewWebhookSink(os.Getenv("AUDIT_WEBHOOK_URL"), []byte(os.Getenv("AUDIT_WEBHOOK_SECRET")))
+		default:
+			err = fmt.Errorf("unknown AUDIT_SINKS entry %q", kind)
+		}
+		if err != nil {
+			slog.Error("Invalid audit sink configuration", slog.String("sink", kind), slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+
+		buffered, err := audit_log.NewBufferedSink(sink, bufferDir)
+		if err != nil {
+			slog.Error("Failed to create audit sink buffer", slog.String("sink", kind), slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if batchSize, err := strconv.Atoi(os.Getenv("AUDIT_SINK_BATCH_SIZE")); err == nil && batchSize > 0 {
+			buffered.BatchSize = batchSize
+		}
+		buffered.Start(context.Background(), time.Duration(flushSec)*time.Second)
+		auditLog.AddSinks(buffered)
+		slog.Info("Exporting audit log", slog.String("sink", sink.Name()), slog.String("bufferDir", bufferDir))
+	}
+}
+
+func initializeWebAuthn(connPool *pgxpool.Pool) *webauthn.PgWebAuthnProvider {
+	rp := webauthn.NewRelyingPartyFromEnv()
+	provider := webauthn.NewPgWebAuthnProvider(connPool, rp)
+	provider.StartSessionCleanup(context.Background(), 15*time.Minute)
+	slog.Info("Initialized webauthn relying party", slog.String("rpId", rp.ID), slog.Any("origins", rp.Origins))
+	return provider
+}
+
+// passkeyRequiredPermissionsFromEnv parses the comma separated WEBAUTHN_REQUIRED_PERMISSIONS.
+func passkeyRequiredPermissionsFromEnv() []string {
+	var permissions []string
+	for _, permission := range strings.Split(os.Getenv("WEBAUTHN_REQUIRED_PERMISSIONS"), ",") {
+		if permission = strings.TrimSpace(permission); permission != "" {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// initializeOidc returns nil when OIDC_ISSUER_URL is not set.
+func initializeOidc(connPool *pgxpool.Pool, userService *user_crud_svc.UserCRUDService, authService authapi.AuthService) (*oidc_auth.OidcLoginService, string) {
+	cfg, err := oidc_auth.NewOidcConfigFromEnv()
+	if err != nil {
+		slog.Error("Invalid oidc configuration", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if cfg == nil {
+		slog.Info("OIDC_ISSUER_URL is not set, oidc login is disabled")
+		return nil, ""
+	}
+
+	oidcService := oidc_auth.NewOidcLoginService(connPool, oidc_auth.NewOidcClient(cfg), userService, authService)
+	oidcService.StartStateCleanup(context.Background(), 15*time.Minute)
+	slog.Info("Initialized oidc login", slog.String("issuer", cfg.IssuerUrl), slog.Bool("autoProvision", cfg.AutoProvision))
+	return oidcService, cfg.PostLoginRedirect
+}
+
+// initializeLoginThrottle returns nil when LOGIN_THROTTLE_STORE is none. Counters are kept
+// in Postgres by default or in Valkey, both are shared between replicas.
+func initializeLoginThrottle(connPool *pgxpool.Pool) *login_throttle.LoginThrottle {
+	var store login_throttle.AttemptStore
+	switch os.Getenv("LOGIN_THROTTLE_STORE") {
+	case "none":
+		slog.Warn("LOGIN_THROTTLE_STORE is none, login throttling is disabled")
+		return nil
+	case "valkey":
+		store = login_throttle.NewValkeyAttemptStore(initValkeyClient())
+		slog.Info("Using Valkey login throttle store")
+	default:
+		pgStore := login_throttle.NewPgAttemptStore(connPool)
+		pgStore.StartCleanup(context.Background(), time.Hour, 24*time.Hour)
+		store = pgStore
+		slog.Info("Using Postgres login throttle store")
+	}
+
+	userPolicy, ipPolicy := login_throttle.PoliciesFromEnv()
+	slog.Info("Initialized login throttle",
+		slog.Int64("maxFailuresPerUser", userPolicy.MaxFailures),
+		slog.Int64("maxFailuresPerIp", ipPolicy.MaxFailures),
+		slog.Duration("window", userPolicy.Window))
+	return login_throttle.NewLoginThrottle(store, login_throttle.NewPgLockoutAuditor(connPool), userPolicy, ipPolicy)
+}
+
+// initializeMfaChallenges keeps MFA challenge attempts in the same backend as the login
+// throttle, Valkey when LOGIN_THROTTLE_STORE=valkey and Postgres otherwise. The cap on
+// guesses per challenge is enforced even when login throttling is turned off.
+func initializeMfaChallenges(connPool *pgxpool.Pool) authapi.MfaChallengeStore {
+	if os.Getenv("LOGIN_THROTTLE_STORE") == "valkey" {
+		return user_mfa.NewValkeyChallengeStore(initValkeyClient())
+	}
+	store := user_mfa.NewPgChallengeStore(connPool)
+	store.StartCleanup(context.Background(), time.Hour)
+	return store
+}
+
+// initializePasswordPolicy sets the Argon2id parameters for new hashes and the password
+// policy used when creating users and changing passwords.
+func initializePasswordPolicy() {
+	params := hashing.DefaultArgon2Params
+	if v, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_MEMORY_KIB"), 10, 32); err == nil && v > 0 {
+		params.MemoryKiB = uint32(v)
+	}
+	if v, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_ITERATIONS"), 10, 32); err == nil && v > 0 {
+		params.Iterations = uint32(v)
+	}
+	if v, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_PARALLELISM"), 10, 8); err == nil && v > 0 {
+		params.Parallelism = uint8(v)
+	}
+	hashing.SetArgon2Params(params)
+
+	policy, err := password_policy.NewPolicyFromEnv()
+	if err != nil {
+		slog.Error("Failed to initialize password policy", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	password_policy.SetDefault(policy)
+	slog.Info("Initialized password policy",
+		slog.Int("minLength", policy.MinLength),
+		slog.Int("minCharClasses", policy.MinCharClasses),
+		slog.Int("historyCount", policy.HistoryCount),
+		slog.Uint64("argon2MemoryKiB", uint64(params.MemoryKiB)))
+}
+
+// initializeUserVerification wires password reset and email verification mails. Tokens
+// are signed with ACCOUNT_TOKEN_SECRET, which must be shared by all replicas.
+func initializeUserVerification(connPool *pgxpool.Pool, userService *user_crud_svc.UserCRUDService) *user_verification.PgUserVerificationService {
+	secret := []byte(os.Getenv("ACCOUNT_TOKEN_SECRET"))
+	if len(secret) < 32 {
+		slog.Warn("ACCOUNT_TOKEN_SECRET is unset or shorter than 32 bytes, using a random secret valid until restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			slog.Error("Failed to generate account token secret", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	m, err := mailer.NewMailerFromEnv()
+	if err != nil {
+		slog.Error("Failed to initialize mailer", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	service := user_verification.NewPgUserVerificationService(connPool, user_verification.NewTokenSigner(secret), m, userService)
+	service.StartTokenCleanup(context.Background(), time.Hour)
+	userService.Verification = service
+	slog.Info("Initialized user verification", slog.Duration("resetTtl", service.ResetTtl), slog.Duration("verifyTtl", service.VerifyTtl))
+	return service
+}
+
+// initializeApiTokens registers the personal access token validator with the auth middleware.
+func initializeApiTokens(connPool *pgxpool.Pool) *api_tokens.PgApiTokenProvider {
+	provider := api_tokens.NewPgApiTokenProvider(connPool)
+	authapi.SetPersonalAccessTokenValidator(provider)
+	slog.Info("Initialized personal access tokens", slog.Int("maxLifetimeDays", provider.MaxLifetimeDays))
+	return provider
+}
+
+// initializeUserSecrets selects the key-encryption key provider for user secrets and, when
+// USER_SEC_REWRAP_INTERVAL_MINUTES is set, re-wraps secrets onto the active KEK in the background.
+func initializeUserSecrets(connPool *pgxpool.Pool) *user_secrets.PgUserSecretStore {
+	provider := initializeSecretKeyProvider()
+
+	store := user_secrets.NewPgUserSecretStore(connPool)
+	if minutes, err := strconv.Atoi(os.Getenv("USER_SEC_REWRAP_INTERVAL_MINUTES")); err == nil && minutes > 0 {
+		store.StartSecretRewrap(context.Background(), time.Duration(minutes)*time.Minute, rewrapBatchSizeFromEnv())
+	}
+	slog.Info("Initialized user secret store", slog.String("keyProvider", provider.Name()))
+	return store
+}
+
+// initializeSecretExpiry starts the expiry scheduler when USER_SEC_EXPIRY_INTERVAL_MINUTES is
+// set. It warns owners USER_SEC_EXPIRY_WARN_DAYS ahead through the USER_SEC_EXPIRY_NOTIFY
+// notifiers and purges secrets USER_SEC_EXPIRY_GRACE_DAYS after they expire.
+func initializeSecretExpiry(connPool *pgxpool.Pool) {
+	minutes, err := strconv.Atoi(os.Getenv("USER_SEC_EXPIRY_INTERVAL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		return
+	}
+
+	m, err := mailer.NewMailerFromEnv()
+	if err != nil {
+		slog.Error("Failed to initialize mailer", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	notifiers, err := user_secrets.ExpiryNotifiersFromEnv(m)
+	if err != nil {
+		slog.Error("Failed to initialize secret expiry notifiers", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	scheduler := user_secrets.NewSecretExpiryScheduler(connPool, notifiers...)
+	scheduler.ConfigureFromEnv()
+	scheduler.Start(context.Background(), time.Duration(minutes)*time.Minute)
+	slog.Info("Started user secret expiry scheduler", slog.Duration("warnWindow", scheduler.WarnWindow), slog.Duration("gracePeriod", scheduler.GracePeriod), slog.Int("notifiers", len(notifiers)))
+}
+
+func initializeSecretKeyProvider() user_secrets.KeyProvider {
+	provider, err := user_secrets.NewKeyProviderFromEnv()
+	if err != nil {
+		slog.Error("Failed to initialize user secret key provider", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	activeVersion, err := provider.ActiveVersion()
+	if err != nil {
+		slog.Error("Failed to read active key encryption key version", slog.String("provider", provider.Name()), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	user_secrets.SetKeyProvider(provider)
+	slog.Info("Initialized user secret key provider", slog.String("provider", provider.Name()), slog.Int("activeKekVersion", activeVersion))
+	return provider
+}
+
+func rewrapBatchSizeFromEnv() int32 {
+	if v, err := strconv.ParseInt(os.Getenv("USER_SEC_REWRAP_BATCH_SIZE"), 10, 32); err == nil && v > 0 {
+		return int32(v)
+	}
+	return user_secrets.DefaultRewrapBatchSize
+}
+
+func initializeJwtKeyRing(connPool *pgxpool.Pool) {
+	keyRing, err := authapi.InitKeyRingFromEnv(context.Background(), connPool)
+	if err != nil {
+		slog.Error("Failed to initialize jwt signing keyring", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	slog.Info("Initialized jwt signing keyring", slog.String("algorithm", keyRing.Algorithm()))
+	keyRing.StartRotation(context.Background(), time.Hour)
+}
+
 func initializeSshConnMgr(connPool *pgxpool.Pool, secretProvider user_secrets.UserSecretProvider, timeoutSec int, maxSessions int, rateLimit int) *ssh_connections.SSHConnectionManager {
 
 	// Initialize SSH session store based on environment variable
@@ -27,30 +471,8 @@ func initializeSshConnMgr(connPool *pgxpool.Pool, secretProvider user_secrets.Us
 	dbQueries := infra_db_pg.New(connPool)
 	if storeType == "valkey" {
 		// Use Valkey-backed session store
-		valkeyAddr := os.Getenv("VALKEY_ADDR")
-		if valkeyAddr == "" {
-			valkeyAddr = "127.0.0.1:6379"
-		}
-		slog.Info("Using Valkey session store", slog.String("address", valkeyAddr))
-		valkeyClient, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{valkeyAddr},
-			AuthCredentialsFn: func(acc valkey.AuthCredentialsContext) (valkey.AuthCredentials, error) {
-				return valkey.AuthCredentials{
-					Username: os.Getenv("VALKEY_USER"),
-					Password: os.Getenv("VALKEY_PASSWORD"),
-				}, nil
-			}})
-		if err != nil {
-			slog.Error("Failed to initialize Valkey client", slog.String("error", err.Error()))
-			os.Exit(1)
-		}
-		// Test connection with PING command using the proper Valkey client pattern
-		if err := valkeyClient.Do(context.Background(), valkeyClient.B().Ping().Build()).Error(); err != nil {
-			slog.Error("Failed to ping Valkey server", slog.String("error", err.Error()))
-			os.Exit(1)
-		}
-		slog.Info("Successfully pinged Valkey server")
-		sessionStore = ssh_connections.NewValkeySessionStore(valkeyClient)
-		slog.Info("Using Valkey session store", slog.String("address", valkeyAddr))
+		sessionStore = ssh_connections.NewValkeySessionStore(initValkeyClient())
+		slog.Info("Using Valkey session store")
 	} else {
 		// Default to Postgres-backed session store
 		sessionStore = ssh_connections.NewDBSessionStore(dbQueries)
@@ -145,6 +145,7 @@ FROM
 WHERE "UserId" = $1;
 
 -- name: VerifyUserPermissionById :one
+-- Checks the roles mapped to the user and the enabled roles of their groups.
 SELECT EXISTS (
   SELECT
     "UserId",
@@ -156,7 +157,15 @@ SELECT EXISTS (
   FROM
       public.user_permissions_view upv
   WHERE "UserId" = $1 and "Permission" = $2
-);
+) OR EXISTS (
+  SELECT 1
+  FROM public.user_group_members m
+  JOIN public.user_group_roles gr ON gr.group_id = m.group_id
+  JOIN public.user_roles r ON r.id = gr.role_id
+  JOIN public.role_permissions_view rpv ON rpv."RoleId" = gr.role_id
+  WHERE m.user_id = $1 and rpv."Permission" = $2
+    AND r.enabled = true AND r.is_deleted = false
+) AS has_permission;
 
 -- name: VerifyUserPermissionByRoleId :one
 SELECT EXISTS (
@@ -193,6 +202,22 @@ FROM
   public. public.user_roles
 WHERE "role_name" = $1;
 
+-- name: GetUserRoleById :one
+SELECT * FROM public.user_roles
+WHERE id = $1;
+
+-- name: GetUserRoleByName :one
+SELECT * FROM public.user_roles
+WHERE role_name = $1;
+
+-- name: GetUserRoleMapping :one
+SELECT * FROM public.user_role_mapping
+WHERE user_id = $1 AND role_id = $2;
+
+-- name: GetRolePermissionMapping :one
+SELECT * FROM public.role_permission_mapping
+WHERE role_id = $1 AND permission_id = $2;
+
 -- name: InsertOrUpdateUserRole :one
 INSERT INTO user_roles (id, role_name, role_description, created_at, last_modified, "enabled", "is_deleted")
 VALUES(gen_random_uuid(), $1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, TRUE, false)
@@ -258,17 +283,22 @@ LIMIT 1;
 
 
 -- name: InsertExternalAuthToken :one
-INSERT INTO public.external_auth_tokens (
-    id,
-    user_id,
-    external_app_id,
-    token,
-    expiration
-)
-VALUES (
-  gen_random_uuid(),  $1, $2, $3, $4
+WITH inserted AS (
+  INSERT INTO public.external_auth_tokens (
+      id,
+      user_id,
+      external_app_id,
+      token,
+      expiration
+  )
+  VALUES (
+    $1, $2, $3, $4, $5
+  )
+  RETURNING id, user_id, token, expiration
 )
-RETURNING id;
+INSERT INTO public.external_auth_token_versions (secret_id, version, token, expiration, is_current, created_by)
+SELECT id, 1, token, expiration, true, user_id FROM inserted
+RETURNING secret_id;
 
 -- name: GetExternalAuthTokenById :one
 SELECT
@@ -854,3 +884,936 @@ WHERE id = $1;
 -- name: DeletePlatformTypeMappingsByHostId :exec
 DELETE FROM public.platform_type_mappings
 WHERE host_server_id = $1;
+
+-- name: InsertJwtSigningKey :exec
+INSERT INTO public.jwt_signing_keys (kid, algorithm, private_key, public_key, created_at, retired_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: GetJwtSigningKeys :many
+SELECT kid, algorithm, private_key, public_key, created_at, retired_at, expires_at
+FROM public.jwt_signing_keys
+WHERE expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP
+ORDER BY created_at DESC;
+
+-- name: LockJwtSigningKeys :exec
+-- Serializes rotations so replicas never activate two keys at once.
+SELECT pg_advisory_xact_lock(hashtext('public.jwt_signing_keys'));
+
+-- name: HasFreshJwtSigningKey :one
+SELECT EXISTS (
+    SELECT 1 FROM public.jwt_signing_keys
+    WHERE retired_at IS NULL
+      AND algorithm = sqlc.arg(algorithm)
+      AND created_at > sqlc.arg(created_after)
+);
+
+-- name: RetireOtherJwtSigningKeys :exec
+-- Retires every active key except the newly activated one.
+UPDATE public.jwt_signing_keys
+SET retired_at = sqlc.arg(retired_at), expires_at = sqlc.arg(expires_at)
+WHERE retired_at IS NULL AND kid <> sqlc.arg(kid);
+
+-- name: DeleteExpiredJwtSigningKeys :exec
+DELETE FROM public.jwt_signing_keys
+WHERE expires_at IS NOT NULL AND expires_at < CURRENT_TIMESTAMP;
+
+-- name: InsertRefreshToken :exec
+INSERT INTO public.refresh_tokens (id, user_id, family_id, token_hash, expires_at, org_id)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetRefreshTokenByHash :one
+SELECT id, user_id, family_id, token_hash, expires_at, created_at, rotated_at, replaced_by, revoked_at, org_id
+FROM public.refresh_tokens
+WHERE token_hash = $1;
+
+-- name: RotateRefreshToken :execrows
+UPDATE public.refresh_tokens
+SET rotated_at = CURRENT_TIMESTAMP, replaced_by = $2
+WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE public.refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokensByUserId :exec
+UPDATE public.refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: DeleteExpiredRefreshTokens :exec
+DELETE FROM public.refresh_tokens
+WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: InsertIssuedAccessToken :exec
+INSERT INTO public.issued_access_tokens (jti, user_id, expires_at)
+VALUES ($1, $2, $3);
+
+-- name: RevokeAccessToken :exec
+INSERT INTO public.revoked_access_tokens (jti, user_id, expires_at, reason)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: RevokeAccessTokensByUserId :many
+INSERT INTO public.revoked_access_tokens (jti, user_id, expires_at, reason)
+SELECT iat.jti, iat.user_id, iat.expires_at, $2
+FROM public.issued_access_tokens iat
+WHERE iat.user_id = $1 AND iat.expires_at > CURRENT_TIMESTAMP
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+  SELECT 1 FROM public.revoked_access_tokens
+  WHERE jti = $1
+) AS revoked;
+
+-- name: DeleteExpiredIssuedAccessTokens :exec
+DELETE FROM public.issued_access_tokens
+WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM public.revoked_access_tokens
+WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: GetTotpCredentialByUserId :one
+SELECT user_id, seed_id, enabled, last_used_step, created_at, confirmed_at, seed
+FROM public.user_totp_credentials
+WHERE user_id = $1;
+
+-- name: InsertTotpCredential :exec
+INSERT INTO public.user_totp_credentials (user_id, seed_id, seed)
+VALUES ($1, $2, $3);
+
+-- name: GetTotpSeedsAfterUserId :many
+-- Pages through TOTP seeds for the KEK re-wrap job, with the app id their ciphertext is bound to.
+SELECT c.user_id, c.seed_id, a.id AS external_app_id, c.seed
+FROM public.user_totp_credentials c
+CROSS JOIN public.external_integration_apps a
+WHERE a."name" = 'totp_mfa' AND c.user_id > $1
+ORDER BY c.user_id
+LIMIT $2;
+
+-- name: UpdateTotpSeedCiphertext :execrows
+UPDATE public.user_totp_credentials
+SET seed = @seed
+WHERE user_id = @user_id AND seed = @previous_seed;
+
+-- name: EnableTotpCredential :exec
+UPDATE public.user_totp_credentials
+SET enabled = TRUE, confirmed_at = CURRENT_TIMESTAMP, last_used_step = $2
+WHERE user_id = $1;
+
+-- name: UpdateTotpLastUsedStep :execrows
+UPDATE public.user_totp_credentials
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteTotpCredential :exec
+DELETE FROM public.user_totp_credentials
+WHERE user_id = $1;
+
+-- name: RecordMfaChallengeAttempt :one
+-- Counts a code submitted for the challenge, creating its row on the first attempt.
+INSERT INTO public.mfa_challenges (jti, attempts, expires_at)
+VALUES ($1, 1, $2)
+ON CONFLICT (jti) DO UPDATE SET attempts = public.mfa_challenges.attempts + 1
+RETURNING attempts, completed_at IS NOT NULL AS completed;
+
+-- name: CompleteMfaChallenge :execrows
+UPDATE public.mfa_challenges
+SET completed_at = CURRENT_TIMESTAMP
+WHERE jti = $1 AND completed_at IS NULL;
+
+-- name: DeleteExpiredMfaChallenges :exec
+DELETE FROM public.mfa_challenges
+WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: InsertMfaRecoveryCode :exec
+INSERT INTO public.user_mfa_recovery_codes (user_id, code_hash)
+VALUES ($1, $2);
+
+-- name: UseMfaRecoveryCode :execrows
+UPDATE public.user_mfa_recovery_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedMfaRecoveryCodes :one
+SELECT COUNT(*) FROM public.user_mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteMfaRecoveryCodesByUserId :exec
+DELETE FROM public.user_mfa_recovery_codes
+WHERE user_id = $1;
+
+-- name: InsertWebauthnCredential :one
+INSERT INTO public.webauthn_credentials (user_id, credential_id, public_key, alg, sign_count, aaguid, transports, "name")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id;
+
+-- name: GetWebauthnCredentialByCredentialId :one
+SELECT id, user_id, credential_id, public_key, alg, sign_count, aaguid, transports, "name", created_at, last_used_at
+FROM public.webauthn_credentials
+WHERE credential_id = $1;
+
+-- name: GetWebauthnCredentialsByUserId :many
+SELECT id, user_id, credential_id, public_key, alg, sign_count, aaguid, transports, "name", created_at, last_used_at
+FROM public.webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: UpdateWebauthnCredentialSignCount :exec
+UPDATE public.webauthn_credentials
+SET sign_count = $2, last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: DeleteWebauthnCredential :execrows
+DELETE FROM public.webauthn_credentials
+WHERE id = $1 AND user_id = $2;
+
+-- name: CountWebauthnCredentialsByUserId :one
+SELECT COUNT(*) FROM public.webauthn_credentials
+WHERE user_id = $1;
+
+-- name: InsertWebauthnSession :exec
+INSERT INTO public.webauthn_sessions (id, user_id, ceremony, challenge, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeWebauthnSession :one
+DELETE FROM public.webauthn_sessions
+WHERE id = $1
+RETURNING id, user_id, ceremony, challenge, expires_at;
+
+-- name: DeleteExpiredWebauthnSessions :exec
+DELETE FROM public.webauthn_sessions
+WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: GetUserIdentityByIssuerSubject :one
+SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+FROM public.user_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: GetUserIdentitiesByUserId :many
+SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+FROM public.user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: InsertUserIdentity :one
+INSERT INTO public.user_identities (user_id, issuer, subject, email, last_login_at)
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+RETURNING id;
+
+-- name: UpdateUserIdentityLogin :exec
+UPDATE public.user_identities
+SET email = $2, last_login_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: InsertOidcLoginState :exec
+INSERT INTO public.oidc_login_states (state, nonce, code_verifier, redirect_after, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeOidcLoginState :one
+DELETE FROM public.oidc_login_states
+WHERE state = $1
+RETURNING state, nonce, code_verifier, redirect_after, expires_at;
+
+-- name: DeleteExpiredOidcLoginStates :exec
+DELETE FROM public.oidc_login_states
+WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: InsertPersonalAccessToken :one
+INSERT INTO public.personal_access_tokens (user_id, "name", token_hash, token_prefix, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT pat.id, pat.user_id, pat.scopes, pat.expires_at, pat.revoked_at, uwr.email, uwr.enabled, uwr.is_deleted, uwr.role_ids
+FROM public.personal_access_tokens pat
+JOIN public.users_with_roles uwr ON uwr.id = pat.user_id
+WHERE pat.token_hash = $1;
+
+-- name: GetPersonalAccessTokensByUserId :many
+SELECT id, user_id, "name", token_prefix, scopes, expires_at, created_at, last_used_at, revoked_at
+FROM public.personal_access_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE public.personal_access_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute');
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE public.personal_access_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: GetLoginLockout :one
+SELECT locked_until
+FROM public.login_attempts
+WHERE scope = $1 AND lock_key = $2;
+
+-- name: IncrementLoginFailures :one
+INSERT INTO public.login_attempts (scope, lock_key, failures, last_failure_at)
+VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+ON CONFLICT (scope, lock_key) DO UPDATE
+SET failures = CASE
+        WHEN public.login_attempts.last_failure_at < CURRENT_TIMESTAMP - (@window_seconds::bigint * INTERVAL '1 second') THEN 1
+        ELSE public.login_attempts.failures + 1
+    END,
+    last_failure_at = CURRENT_TIMESTAMP
+RETURNING failures;
+
+-- name: SetLoginLockout :exec
+UPDATE public.login_attempts
+SET locked_until = $3
+WHERE scope = $1 AND lock_key = $2;
+
+-- name: ResetLoginAttempts :exec
+DELETE FROM public.login_attempts
+WHERE scope = $1 AND lock_key = $2;
+
+-- name: DeleteStaleLoginAttempts :exec
+DELETE FROM public.login_attempts
+WHERE last_failure_at < $1
+  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP);
+
+-- name: InsertLoginLockoutEvent :exec
+INSERT INTO public.login_lockout_events (scope, lock_key, event_type, failures, locked_until, actor_user_id)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetUserPasswordHashById :one
+SELECT password
+FROM public.users
+WHERE id = $1;
+
+-- name: InsertPasswordHistory :exec
+INSERT INTO public.password_history (user_id, password_hash)
+VALUES ($1, $2);
+
+-- name: GetPasswordHistoryByUserId :many
+SELECT password_hash
+FROM public.password_history
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT @history_limit::int;
+
+-- name: PrunePasswordHistory :exec
+DELETE FROM public.password_history
+WHERE user_id = $1
+  AND id NOT IN (
+    SELECT ph.id
+    FROM public.password_history ph
+    WHERE ph.user_id = $1
+    ORDER BY ph.created_at DESC
+    LIMIT @history_limit::int
+  );
+
+-- name: GetActiveUserByEmail :one
+SELECT id, username, email
+FROM public.users
+WHERE lower(email) = lower(@email::text) AND "enabled" = TRUE AND is_deleted = FALSE
+LIMIT 1;
+
+-- name: InsertUserActionToken :one
+INSERT INTO public.user_action_tokens (user_id, purpose, email, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id;
+
+-- name: GetUserActionToken :one
+SELECT id, user_id, purpose, email, expires_at, used_at
+FROM public.user_action_tokens
+WHERE id = $1;
+
+-- name: ConsumeUserActionToken :execrows
+UPDATE public.user_action_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP;
+
+-- name: InvalidateUserActionTokens :exec
+UPDATE public.user_action_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
+
+-- name: DeleteExpiredUserActionTokens :exec
+DELETE FROM public.user_action_tokens
+WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: UpsertUserEmailVerification :exec
+INSERT INTO public.user_email_verifications (user_id, email, verified_at)
+VALUES ($1, $2, CURRENT_TIMESTAMP)
+ON CONFLICT (user_id) DO UPDATE
+SET email = EXCLUDED.email, verified_at = EXCLUDED.verified_at;
+
+-- name: IsUserEmailVerified :one
+SELECT EXISTS (
+    SELECT 1
+    FROM public.user_email_verifications v
+    JOIN public.users u ON u.id = v.user_id
+    WHERE v.user_id = $1 AND lower(v.email) = lower(u.email)
+);
+
+-- name: GetExternalAuthTokensAfterId :many
+SELECT id, user_id, external_app_id, token
+FROM public.external_auth_tokens
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateExternalAuthTokenCiphertext :execrows
+UPDATE public.external_auth_tokens
+SET token = @token, last_modified = CURRENT_TIMESTAMP
+WHERE id = @id AND token = @previous_token;
+
+-- name: LockExternalAuthToken :one
+SELECT id FROM public.external_auth_tokens
+WHERE id = $1
+FOR UPDATE;
+
+-- name: GetNextExternalAuthTokenVersion :one
+SELECT (COALESCE(MAX(version), 0) + 1)::int AS next_version
+FROM public.external_auth_token_versions
+WHERE secret_id = $1;
+
+-- name: ClearCurrentExternalAuthTokenVersion :exec
+UPDATE public.external_auth_token_versions
+SET is_current = false
+WHERE secret_id = $1 AND is_current;
+
+-- name: InsertExternalAuthTokenVersion :one
+INSERT INTO public.external_auth_token_versions (secret_id, version, token, expiration, is_current, created_by)
+VALUES ($1, $2, $3, $4, true, $5)
+RETURNING *;
+
+-- name: SetCurrentExternalAuthTokenVersion :one
+UPDATE public.external_auth_token_versions
+SET is_current = true
+WHERE secret_id = $1 AND version = $2 AND destroyed_at IS NULL
+RETURNING *;
+
+-- name: UpdateExternalAuthTokenCurrentValue :exec
+UPDATE public.external_auth_tokens
+SET token = $2, expiration = $3, last_modified = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: GetExternalAuthTokenVersion :one
+SELECT * FROM public.external_auth_token_versions
+WHERE secret_id = $1 AND version = $2;
+
+-- name: GetExternalAuthTokenVersions :many
+SELECT * FROM public.external_auth_token_versions
+WHERE secret_id = $1
+ORDER BY version DESC;
+
+-- name: DestroyExternalAuthTokenVersion :execrows
+UPDATE public.external_auth_token_versions
+SET token = NULL, destroyed_at = CURRENT_TIMESTAMP
+WHERE secret_id = $1 AND version = $2 AND NOT is_current AND destroyed_at IS NULL;
+
+-- name: GetExternalAuthTokenVersionsAfterId :many
+SELECT v.id, v.secret_id, t.user_id, t.external_app_id, v.token
+FROM public.external_auth_token_versions v
+JOIN public.external_auth_tokens t ON t.id = v.secret_id
+WHERE v.id > $1 AND v.token IS NOT NULL
+ORDER BY v.id
+LIMIT $2;
+
+-- name: UpdateExternalAuthTokenVersionCiphertext :execrows
+UPDATE public.external_auth_token_versions
+SET token = @token
+WHERE id = @id AND token = @previous_token;
+
+-- name: TryLockSecretExpiryRun :one
+-- Lets a single replica warn and purge per run, the others skip it.
+SELECT pg_try_advisory_xact_lock(hashtext('public.external_auth_token_expiry_notices'));
+
+-- name: GetExternalAuthTokensExpiringBefore :many
+SELECT t.id, t.user_id, t.external_app_id, a.name AS application_name, u.email, t.expiration
+FROM public.external_auth_tokens t
+JOIN public.external_integration_apps a ON a.id = t.external_app_id
+JOIN public.users u ON u.id = t.user_id
+LEFT JOIN public.external_auth_token_expiry_notices n ON n.secret_id = t.id AND n.expiration = t.expiration
+WHERE t.expiration > CURRENT_TIMESTAMP
+  AND t.expiration <= sqlc.arg(warn_before)
+  AND n.secret_id IS NULL
+ORDER BY t.expiration
+LIMIT sqlc.arg(row_limit)::int;
+
+-- name: UpsertExternalAuthTokenExpiryNotice :exec
+INSERT INTO public.external_auth_token_expiry_notices (secret_id, expiration, notified_at)
+VALUES ($1, $2, CURRENT_TIMESTAMP)
+ON CONFLICT (secret_id) DO UPDATE
+SET expiration = EXCLUDED.expiration, notified_at = EXCLUDED.notified_at;
+
+-- name: PurgeExpiredAuthTokens :execrows
+-- Secrets still referenced by ssh_keys are kept so the key record is not orphaned.
+DELETE FROM public.external_auth_tokens t
+WHERE t.expiration < sqlc.arg(purge_before)
+  AND NOT EXISTS (
+    SELECT 1 FROM public.ssh_keys k
+    WHERE k.priv_secret_id = t.id OR k.passphrase_id = t.id
+  );
+
+-- name: GetUserSecretsExpiringBefore :many
+SELECT m.auth_token_id, m.application_id, m.application_name, m.expiration, n.notified_at
+FROM public.user_auth_app_mappings m
+LEFT JOIN public.external_auth_token_expiry_notices n ON n.secret_id = m.auth_token_id
+WHERE m.user_id = $1 AND m.expiration <= sqlc.arg(expiring_before)
+ORDER BY m.expiration;
+
+-- name: InsertExternalAuthTokenGrant :one
+INSERT INTO public.external_auth_token_grants (secret_id, grantee_user_id, grantee_role_id, access_level, granted_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: RevokeActiveExternalAuthTokenGrantsForGrantee :exec
+UPDATE public.external_auth_token_grants
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE secret_id = $1
+  AND grantee_user_id IS NOT DISTINCT FROM sqlc.narg(grantee_user_id)::uuid
+  AND grantee_role_id IS NOT DISTINCT FROM sqlc.narg(grantee_role_id)::uuid
+  AND revoked_at IS NULL;
+
+-- name: RevokeExternalAuthTokenGrant :execrows
+UPDATE public.external_auth_token_grants
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND secret_id = $2 AND revoked_at IS NULL;
+
+-- name: GetExternalAuthTokenGrants :many
+SELECT * FROM public.external_auth_token_grants
+WHERE secret_id = $1 AND revoked_at IS NULL
+ORDER BY created_at;
+
+-- name: GetActiveExternalAuthTokenGrantLevel :one
+-- Returns the strongest active grant the user holds directly or through an enabled role,
+-- mapped to them or to one of their groups.
+SELECT g.access_level
+FROM public.external_auth_token_grants g
+WHERE g.secret_id = $1
+  AND g.revoked_at IS NULL
+  AND (g.expires_at IS NULL OR g.expires_at > CURRENT_TIMESTAMP)
+  AND (
+    g.grantee_user_id = sqlc.arg(user_id)
+    OR g.grantee_role_id IN (
+      SELECT m.role_id
+      FROM public.user_role_mapping m
+      JOIN public.user_roles r ON r.id = m.role_id
+      WHERE m.user_id = sqlc.arg(user_id) AND m.enabled AND r.enabled AND NOT r.is_deleted
+      UNION
+      SELECT gr.role_id
+      FROM public.user_group_members gm
+      JOIN public.user_group_roles gr ON gr.group_id = gm.group_id
+      JOIN public.user_roles r ON r.id = gr.role_id
+      WHERE gm.user_id = sqlc.arg(user_id) AND r.enabled AND NOT r.is_deleted
+    )
+  )
+ORDER BY g.access_level = 'read' DESC
+LIMIT 1;
+
+-- name: GetUserSecretsSharedWithUser :many
+SELECT DISTINCT ON (m.auth_token_id)
+  m.auth_token_id,
+  m.user_id,
+  m.application_id,
+  m.endpoint_url,
+  m.application_name,
+  m.token_created_at,
+  m.expiration,
+  g.access_level,
+  g.expires_at AS grant_expires_at
+FROM public.user_auth_app_mappings m
+JOIN public.external_auth_token_grants g ON g.secret_id = m.auth_token_id
+WHERE g.revoked_at IS NULL
+  AND (g.expires_at IS NULL OR g.expires_at > CURRENT_TIMESTAMP)
+  AND m.user_id <> sqlc.arg(user_id)
+  AND (
+    g.grantee_user_id = sqlc.arg(user_id)
+    OR g.grantee_role_id IN (
+      SELECT rm.role_id
+      FROM public.user_role_mapping rm
+      JOIN public.user_roles r ON r.id = rm.role_id
+      WHERE rm.user_id = sqlc.arg(user_id) AND rm.enabled AND r.enabled AND NOT r.is_deleted
+      UNION
+      SELECT gr.role_id
+      FROM public.user_group_members gm
+      JOIN public.user_group_roles gr ON gr.group_id = gm.group_id
+      JOIN public.user_roles r ON r.id = gr.role_id
+      WHERE gm.user_id = sqlc.arg(user_id) AND r.enabled AND NOT r.is_deleted
+    )
+  )
+ORDER BY m.auth_token_id, g.access_level = 'read' DESC;
+
+-- name: LockAuditLog :exec
+-- Serializes appends so every row chains onto the previous head.
+SELECT pg_advisory_xact_lock(hashtext('public.audit_log'));
+
+-- name: GetAuditLogHead :one
+SELECT seq, hash FROM public.audit_log
+ORDER BY seq DESC
+LIMIT 1;
+
+-- name: InsertAuditLogEntry :exec
+INSERT INTO public.audit_log (
+  seq, id, occurred_at, actor_user_id, permission, action, resource_type, resource_id,
+  method, path, status_code, client_ip, request_id, diff, prev_hash, hash
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16);
+
+-- name: ListAuditLogEntries :many
+SELECT * FROM public.audit_log
+WHERE (sqlc.narg(actor_user_id)::uuid IS NULL OR actor_user_id = sqlc.narg(actor_user_id))
+  AND (sqlc.narg(resource_type)::text IS NULL OR resource_type = sqlc.narg(resource_type))
+  AND (sqlc.narg(resource_id)::text IS NULL OR resource_id = sqlc.narg(resource_id))
+  AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+  AND (sqlc.narg(occurred_from)::timestamptz IS NULL OR occurred_at >= sqlc.narg(occurred_from))
+  AND (sqlc.narg(occurred_to)::timestamptz IS NULL OR occurred_at < sqlc.narg(occurred_to))
+  AND (sqlc.narg(before_seq)::bigint IS NULL OR seq < sqlc.narg(before_seq))
+ORDER BY seq DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetAuditLogEntriesAfter :many
+SELECT * FROM public.audit_log
+WHERE seq > sqlc.arg(after_seq)
+ORDER BY seq
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetPermissionScopesForRoles :many
+-- Returns one row per role granting the permission and scope on that grant. A NULL
+-- scope_type means the role holds the permission for every resource.
+SELECT rpv."RoleId", s.scope_type, s.scope_value
+FROM public.role_permissions_view rpv
+LEFT JOIN public.role_permission_scopes s
+  ON s.role_id = rpv."RoleId" AND s.permission_id = rpv."PermissionId"
+WHERE rpv."RoleId" = ANY(sqlc.arg(role_ids)::uuid[])
+  AND rpv."Permission" = sqlc.arg(permission_name)::text;
+
+-- name: RoleHoldsPermission :one
+SELECT EXISTS (
+  SELECT 1 FROM public.role_permissions_view
+  WHERE "RoleId" = sqlc.arg(role_id)::uuid AND "PermissionId" = sqlc.arg(permission_id)::uuid
+) AS holds_permission;
+
+-- name: GetHostServerScopeAttributes :many
+-- Returns the attributes permission scopes match on, for one host server or all of them.
+SELECT
+  h.id,
+  ARRAY(
+    SELECT m.host_server_type_id FROM public.host_server_type_mappings m
+    WHERE m.host_server_id = h.id
+  )::uuid[] AS host_server_type_ids,
+  ARRAY(
+    SELECT t.tag FROM public.host_server_tags t
+    WHERE t.host_server_id = h.id ORDER BY t.tag
+  )::text[] AS tags
+FROM public.host_servers h
+WHERE sqlc.narg(host_server_id)::uuid IS NULL OR h.id = sqlc.narg(host_server_id);
+
+-- name: GetHostServerTags :many
+SELECT tag FROM public.host_server_tags
+WHERE host_server_id = $1
+ORDER BY tag;
+
+-- name: DeleteHostServerTags :exec
+DELETE FROM public.host_server_tags
+WHERE host_server_id = $1;
+
+-- name: InsertHostServerTags :exec
+INSERT INTO public.host_server_tags (host_server_id, tag)
+SELECT sqlc.arg(host_server_id)::uuid, unnest(sqlc.arg(tags)::text[])
+ON CONFLICT (host_server_id, tag) DO NOTHING;
+
+-- name: InsertRolePermissionScope :one
+INSERT INTO public.role_permission_scopes (role_id, permission_id, scope_type, scope_value)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (role_id, permission_id, scope_type, scope_value)
+DO UPDATE SET scope_value = EXCLUDED.scope_value
+RETURNING *;
+
+-- name: GetRolePermissionScopesByRoleId :many
+SELECT s.id, s.role_id, s.permission_id, p.permission_name, s.scope_type, s.scope_value, s.created_at
+FROM public.role_permission_scopes s
+JOIN public.app_permissions p ON p.id = s.permission_id
+WHERE s.role_id = $1
+ORDER BY p.permission_name, s.scope_type, s.scope_value;
+
+-- name: DeleteRolePermissionScope :execrows
+DELETE FROM public.role_permission_scopes
+WHERE id = $1 AND role_id = $2;
+
+-- name: GetPermissionNamesByRoleIds :many
+SELECT "RoleId", "Permission"
+FROM public.role_permissions_view
+WHERE "RoleId" = ANY(sqlc.arg(role_ids)::uuid[]);
+
+-- name: LockRbacSync :exec
+-- Serializes declarative syncs so two plans are never applied over each other.
+SELECT pg_advisory_xact_lock(hashtext('public.rbac_sync'));
+
+-- name: GetAllUserRolesIncludingInactive :many
+SELECT * FROM public.user_roles
+ORDER BY role_name;
+
+-- name: GetAllRolePermissionMappings :many
+SELECT * FROM public.role_permission_mapping;
+
+-- name: DisableRolePermissionMapping :exec
+UPDATE public.role_permission_mapping
+SET "enabled" = FALSE, last_modified = CURRENT_TIMESTAMP
+WHERE role_id = $1 AND permission_id = $2;
+
+-- name: CreateOrganization :one
+INSERT INTO public.organizations (name, description)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetOrganizationById :one
+SELECT * FROM public.organizations
+WHERE id = $1 AND is_deleted = false;
+
+-- name: GetOrganizationIdByName :one
+SELECT id FROM public.organizations
+WHERE name = $1 AND is_deleted = false;
+
+-- name: GetAllOrganizations :many
+SELECT * FROM public.organizations
+WHERE is_deleted = false
+ORDER BY name;
+
+-- name: GetOrganizationsByUserId :many
+SELECT * FROM public.organizations
+WHERE is_deleted = false
+  AND id IN (SELECT m.org_id FROM public.organization_members m WHERE m.user_id = $1)
+ORDER BY name;
+
+-- name: SoftDeleteOrganization :execrows
+UPDATE public.organizations
+SET is_deleted = true, last_modified = CURRENT_TIMESTAMP
+WHERE id = $1 AND is_deleted = false;
+
+-- name: GetFirstOrganizationIdForUser :one
+-- The organization a session starts in when none was requested, the one joined first.
+SELECT m.org_id
+FROM public.organization_members m
+JOIN public.organizations o ON o.id = m.org_id
+WHERE m.user_id = $1 AND o.is_deleted = false
+ORDER BY m.created_at, o.name
+LIMIT 1;
+
+-- name: IsOrganizationMember :one
+SELECT EXISTS (
+  SELECT 1
+  FROM public.organization_members m
+  JOIN public.organizations o ON o.id = m.org_id
+  WHERE m.org_id = $1 AND m.user_id = $2 AND o.is_deleted = false
+) AS is_member;
+
+-- name: IsRoleHeldInOrganization :one
+-- A role is held in an organization when one of its members has it there, directly or
+-- through one of their groups.
+SELECT EXISTS (
+  SELECT 1
+  FROM public.organization_members m
+  JOIN public.organizations o ON o.id = m.org_id
+  JOIN public.user_roles ur ON ur.id = sqlc.arg(role_id)
+  WHERE m.org_id = sqlc.arg(org_id) AND o.is_deleted = false
+    AND ur.enabled = true AND ur.is_deleted = false
+    AND (
+      EXISTS (
+        SELECT 1 FROM public.organization_member_roles r
+        WHERE r.org_id = m.org_id AND r.user_id = m.user_id AND r.role_id = ur.id
+      )
+      OR EXISTS (
+        SELECT 1 FROM public.user_role_mapping urm
+        WHERE urm.user_id = m.user_id AND urm.role_id = ur.id AND urm.enabled
+      )
+      OR EXISTS (
+        SELECT 1 FROM public.user_group_members gm
+        JOIN public.user_group_roles gr ON gr.group_id = gm.group_id
+        WHERE gm.user_id = m.user_id AND gr.role_id = ur.id
+      )
+    )
+) AS is_held;
+
+-- name: AddOrganizationMember :exec
+INSERT INTO public.organization_members (org_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (org_id, user_id) DO NOTHING;
+
+-- name: RemoveOrganizationMember :execrows
+DELETE FROM public.organization_members
+WHERE org_id = $1 AND user_id = $2;
+
+-- name: GetOrganizationMembers :many
+SELECT
+  m.user_id,
+  u.username,
+  u.email,
+  m.created_at,
+  ARRAY(
+    SELECT r.role_id FROM public.organization_member_roles r
+    WHERE r.org_id = m.org_id AND r.user_id = m.user_id
+    ORDER BY r.role_id
+  )::uuid[] AS role_ids
+FROM public.organization_members m
+JOIN public.users u ON u.id = m.user_id
+WHERE m.org_id = $1
+ORDER BY u.username;
+
+-- name: AddOrganizationMemberRole :exec
+INSERT INTO public.organization_member_roles (org_id, user_id, role_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (org_id, user_id, role_id) DO NOTHING;
+
+-- name: RemoveOrganizationMemberRole :execrows
+DELETE FROM public.organization_member_roles
+WHERE org_id = $1 AND user_id = $2 AND role_id = $3;
+
+-- name: GetOrganizationMemberRoleIds :many
+-- Only roles that are still enabled are returned, matching how global roles are resolved.
+SELECT r.role_id
+FROM public.organization_member_roles r
+JOIN public.user_roles ur ON ur.id = r.role_id
+WHERE r.org_id = $1 AND r.user_id = $2
+  AND ur.enabled = true AND ur.is_deleted = false
+ORDER BY r.role_id;
+
+-- name: AssignOrganizationResource :exec
+INSERT INTO public.organization_resources (resource_type, resource_id, org_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (resource_type, resource_id) DO NOTHING;
+
+-- name: GetOrganizationResourceOwners :many
+SELECT resource_id, org_id
+FROM public.organization_resources
+WHERE resource_type = sqlc.arg(resource_type)
+  AND resource_id = ANY(sqlc.arg(resource_ids)::uuid[]);
+
+-- name: CreateUserGroup :one
+INSERT INTO public.user_groups (name, description)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetUserGroupById :one
+SELECT
+  g.id,
+  g.name,
+  g.description,
+  g.created_at,
+  g.last_modified,
+  ARRAY(
+    SELECT gr.role_id FROM public.user_group_roles gr
+    WHERE gr.group_id = g.id
+    ORDER BY gr.role_id
+  )::uuid[] AS role_ids
+FROM public.user_groups g
+WHERE g.id = $1;
+
+-- name: GetAllUserGroups :many
+SELECT
+  g.id,
+  g.name,
+  g.description,
+  g.created_at,
+  g.last_modified,
+  ARRAY(
+    SELECT gr.role_id FROM public.user_group_roles gr
+    WHERE gr.group_id = g.id
+    ORDER BY gr.role_id
+  )::uuid[] AS role_ids
+FROM public.user_groups g
+ORDER BY g.name;
+
+-- name: GetUserGroupsByUserId :many
+SELECT
+  g.id,
+  g.name,
+  g.description,
+  g.created_at,
+  g.last_modified,
+  ARRAY(
+    SELECT gr.role_id FROM public.user_group_roles gr
+    WHERE gr.group_id = g.id
+    ORDER BY gr.role_id
+  )::uuid[] AS role_ids
+FROM public.user_groups g
+JOIN public.user_group_members m ON m.group_id = g.id
+WHERE m.user_id = $1
+ORDER BY g.name;
+
+-- name: UpdateUserGroup :execrows
+UPDATE public.user_groups
+SET name = $2, description = $3, last_modified = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: DeleteUserGroup :execrows
+DELETE FROM public.user_groups
+WHERE id = $1;
+
+-- name: AddUserGroupMember :exec
+INSERT INTO public.user_group_members (group_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (group_id, user_id) DO NOTHING;
+
+-- name: RemoveUserGroupMember :execrows
+DELETE FROM public.user_group_members
+WHERE group_id = $1 AND user_id = $2;
+
+-- name: GetUserGroupMembers :many
+SELECT
+  m.user_id,
+  u.username,
+  u.email,
+  m.created_at
+FROM public.user_group_members m
+JOIN public.users u ON u.id = m.user_id
+WHERE m.group_id = $1
+ORDER BY u.username;
+
+-- name: GetUserGroupMemberIds :many
+SELECT user_id
+FROM public.user_group_members
+WHERE group_id = $1;
+
+-- name: AddUserGroupRole :exec
+INSERT INTO public.user_group_roles (group_id, role_id)
+VALUES ($1, $2)
+ON CONFLICT (group_id, role_id) DO NOTHING;
+
+-- name: RemoveUserGroupRole :execrows
+DELETE FROM public.user_group_roles
+WHERE group_id = $1 AND role_id = $2;
+
+-- name: GetGroupRoleIdsForUser :many
+-- Roles the user holds through any of their groups. Disabled roles are left out, matching
+-- how directly mapped roles are resolved.
+SELECT DISTINCT gr.role_id
+FROM public.user_group_members m
+JOIN public.user_group_roles gr ON gr.group_id = m.group_id
+JOIN public.user_roles r ON r.id = gr.role_id
+WHERE m.user_id = $1
+  AND r.enabled = true AND r.is_deleted = false
+ORDER BY gr.role_id;
+
+-- name: GetEffectiveUserRoles :many
+-- Every enabled role of the user with where it comes from: direct is set for roles mapped
+-- to the user, group_ids lists the groups that grant it.
+SELECT
+  r.id AS role_id,
+  r.role_name,
+  COALESCE(bool_or(src.group_id IS NULL), false) AS direct,
+  COALESCE(array_agg(src.group_id ORDER BY src.group_id) FILTER (WHERE src.group_id IS NOT NULL), '{}')::uuid[] AS group_ids
+FROM (
+  SELECT rm.role_id, NULL::uuid AS group_id
+  FROM public.user_role_mapping rm
+  WHERE rm.user_id = $1 AND rm.enabled = true
+  UNION ALL
+  SELECT gr.role_id, gr.group_id
+  FROM public.user_group_members m
+  JOIN public.user_group_roles gr ON gr.group_id = m.group_id
+  WHERE m.user_id = $1
+) src
+JOIN public.user_roles r ON r.id = src.role_id
+WHERE r.enabled = true AND r.is_deleted = false
+GROUP BY r.id, r.role_name
+ORDER BY r.role_name;
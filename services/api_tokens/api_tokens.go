@@ -0,0 +1,227 @@
+package api_tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultTokenLifetimeDays = 90
+	defaultMaxLifetimeDays   = 365
+	// displayed prefix length, enough to tell tokens apart in listings
+	tokenPrefixLength = len(authapi.PersonalAccessTokenPrefix) + 6
+)
+
+var (
+	ErrApiTokenNotFound      = errors.New("api token not found")
+	ErrApiTokenInvalid       = errors.New("invalid api token")
+	ErrApiTokenNameRequired  = errors.New("api token name is required")
+	ErrApiTokenNoScopes      = errors.New("api token requires at least one scope")
+	ErrApiTokenScopeDenied   = errors.New("api token scope is not granted to the user")
+	ErrApiTokenLifetimeLimit = errors.New("api token lifetime exceeds the allowed maximum")
+)
+
+type PgApiTokenProvider struct {
+	DbConn          *pgxpool.Pool
+	MaxLifetimeDays int
+}
+
+// NewPgApiTokenProvider reads the maximum token lifetime from API_TOKEN_MAX_LIFETIME_DAYS.
+func NewPgApiTokenProvider(dbConn *pgxpool.Pool) *PgApiTokenProvider {
+	maxDays := defaultMaxLifetimeDays
+	if v := os.Getenv("API_TOKEN_MAX_LIFETIME_DAYS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			maxDays = parsed
+		} else {
+			slog.Warn("Invalid API_TOKEN_MAX_LIFETIME_DAYS, using default", slog.String("value", v))
+		}
+	}
+	return &PgApiTokenProvider{DbConn: dbConn, MaxLifetimeDays: maxDays}
+}
+
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateApiToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating api token: %w", err)
+	}
+	return authapi.PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func optionalTime(ts pgtype.Timestamptz) *time.Time {
+	if !ts.Valid {
+		return nil
+	}
+	t := ts.Time
+	return &t
+}
+
+// CreateApiToken issues a new token limited to scopes the user currently holds. The
+// plaintext token is returned once, only its hash is stored.
+func (p *PgApiTokenProvider) CreateApiToken(userId uuid.UUID, req CreateApiTokenRequest) (*CreatedApiToken, error) {
+	ctx := context.Background()
+	qry := infra_db_pg.New(p.DbConn)
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrApiTokenNameRequired
+	}
+	if len(req.Scopes) == 0 {
+		return nil, ErrApiTokenNoScopes
+	}
+
+	days := req.ExpiresInDays
+	if days <= 0 {
+		days = defaultTokenLifetimeDays
+	}
+	if days > p.MaxLifetimeDays {
+		return nil, ErrApiTokenLifetimeLimit
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		granted, err := qry.VerifyUserPermissionById(ctx, infra_db_pg.VerifyUserPermissionByIdParams{
+			UserId:     pgtype.UUID{Bytes: userId, Valid: true},
+			Permission: pgtype.Text{String: scope, Valid: true},
+		})
+		if err != nil {
+			slog.Error("Error verifying api token scope", slog.String("scope", scope), slog.String("error", err.Error()))
+			return nil, fmt.Errorf("error verifying api token scope: %w", err)
+		}
+		if !granted {
+			return nil, fmt.Errorf("%w: %s", ErrApiTokenScopeDenied, scope)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	token, err := generateApiToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	row, err := qry.InsertPersonalAccessToken(ctx, infra_db_pg.InsertPersonalAccessTokenParams{
+		UserID:      userId,
+		Name:        name,
+		TokenHash:   hashApiToken(token),
+		TokenPrefix: token[:tokenPrefixLength],
+		Scopes:      scopes,
+		ExpiresAt:   pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		slog.Error("Error inserting api token", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error inserting api token: %w", err)
+	}
+
+	slog.Info("Created api token", slog.String("userId", userId.String()), slog.String("tokenId", row.ID.String()))
+	return &CreatedApiToken{
+		ApiTokenInfo: ApiTokenInfo{
+			Id:          row.ID,
+			Name:        name,
+			TokenPrefix: token[:tokenPrefixLength],
+			Scopes:      scopes,
+			ExpiresAt:   expiresAt,
+			CreatedAt:   row.CreatedAt.Time,
+		},
+		Token: token,
+	}, nil
+}
+
+func (p *PgApiTokenProvider) GetApiTokensByUserId(userId uuid.UUID) ([]ApiTokenInfo, error) {
+	ctx := context.Background()
+	qry := infra_db_pg.New(p.DbConn)
+
+	rows, err := qry.GetPersonalAccessTokensByUserId(ctx, userId)
+	if err != nil {
+		slog.Error("Error fetching api tokens", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error fetching api tokens: %w", err)
+	}
+
+	tokens := make([]ApiTokenInfo, 0, len(rows))
+	for _, row := range rows {
+		tokens = append(tokens, ApiTokenInfo{
+			Id:          row.ID,
+			Name:        row.Name,
+			TokenPrefix: row.TokenPrefix,
+			Scopes:      row.Scopes,
+			ExpiresAt:   row.ExpiresAt.Time,
+			CreatedAt:   row.CreatedAt.Time,
+			LastUsedAt:  optionalTime(row.LastUsedAt),
+			RevokedAt:   optionalTime(row.RevokedAt),
+		})
+	}
+	return tokens, nil
+}
+
+func (p *PgApiTokenProvider) RevokeApiToken(userId uuid.UUID, tokenId uuid.UUID) error {
+	ctx := context.Background()
+	qry := infra_db_pg.New(p.DbConn)
+
+	n, err := qry.RevokePersonalAccessToken(ctx, infra_db_pg.RevokePersonalAccessTokenParams{ID: tokenId, UserID: userId})
+	if err != nil {
+		slog.Error("Error revoking api token", slog.String("error", err.Error()))
+		return fmt.Errorf("error revoking api token: %w", err)
+	}
+	if n == 0 {
+		return ErrApiTokenNotFound
+	}
+	slog.Info("Revoked api token", slog.String("userId", userId.String()), slog.String("tokenId", tokenId.String()))
+	return nil
+}
+
+// ValidatePersonalAccessToken implements authapi.PersonalAccessTokenValidator. The owner's
+// current roles are returned so a token never outlives a removed role.
+func (p *PgApiTokenProvider) ValidatePersonalAccessToken(ctx context.Context, token string) (*authapi.PersonalAccessTokenInfo, error) {
+	qry := infra_db_pg.New(p.DbConn)
+
+	row, err := qry.GetPersonalAccessTokenByHash(ctx, hashApiToken(token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrApiTokenInvalid
+		}
+		return nil, fmt.Errorf("error fetching api token: %w", err)
+	}
+
+	switch {
+	case row.RevokedAt.Valid:
+		return nil, fmt.Errorf("%w: revoked", ErrApiTokenInvalid)
+	case !row.ExpiresAt.Time.After(time.Now()):
+		return nil, fmt.Errorf("%w: expired", ErrApiTokenInvalid)
+	case !row.Enabled || row.IsDeleted:
+		return nil, fmt.Errorf("%w: user disabled", ErrApiTokenInvalid)
+	}
+
+	if err := qry.TouchPersonalAccessToken(ctx, row.ID); err != nil {
+		slog.Warn("Failed to update api token last used", slog.String("tokenId", row.ID.String()), slog.String("error", err.Error()))
+	}
+
+	return &authapi.PersonalAccessTokenInfo{
+		TokenId: row.ID,
+		UserId:  row.UserID,
+		Email:   row.Email.String,
+		RoleIds: row.RoleIds,
+		Scopes:  row.Scopes,
+	}, nil
+}
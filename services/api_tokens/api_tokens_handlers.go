@@ -0,0 +1,126 @@
+package api_tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/google/uuid"
+)
+
+// ApiTokensHandler handles GET and POST requests for the current user's api tokens.
+// Token management needs a JWT session, so personal access tokens cannot mint new tokens.
+func ApiTokensHandler(provider ApiTokenProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetApiTokensHandler(provider).ServeHTTP(w, r)
+		case http.MethodPost:
+			CreateApiTokenHandler(provider).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// swagger:route POST /api-tokens apiTokens createApiToken
+// Create a personal access token limited to the given permission scopes. The token is only returned once.
+// responses:
+//
+//	200: CreatedApiTokenResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Scope not granted to the user
+func CreateApiTokenHandler(provider ApiTokenProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CreateApiTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := provider.CreateApiToken(userID, req)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrApiTokenScopeDenied):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, ErrApiTokenNameRequired), errors.Is(err, ErrApiTokenNoScopes), errors.Is(err, ErrApiTokenLifetimeLimit):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, "Failed to create api token", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(token)
+	}))
+}
+
+// swagger:route GET /api-tokens apiTokens getApiTokens
+// List the personal access tokens of the current user.
+// responses:
+//
+//	200: ApiTokenListResponse
+//	401: description:Unauthorized
+func GetApiTokensHandler(provider ApiTokenProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tokens, err := provider.GetApiTokensByUserId(userID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve api tokens", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+	}))
+}
+
+// swagger:route DELETE /api-tokens/{ID} apiTokens revokeApiToken
+// Revoke a personal access token of the current user.
+// responses:
+//
+//	204: description:Token revoked
+//	401: description:Unauthorized
+//	404: description:Not Found
+func RevokeApiTokenHandler(provider ApiTokenProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := provider.RevokeApiToken(userID, id); err != nil {
+			if errors.Is(err, ErrApiTokenNotFound) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("Failed to revoke api token", slog.String("error", err.Error()))
+			http.Error(w, "Failed to revoke api token", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
@@ -0,0 +1,15 @@
+package api_tokens
+
+import (
+	"context"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/google/uuid"
+)
+
+type ApiTokenProvider interface {
+	CreateApiToken(userId uuid.UUID, req CreateApiTokenRequest) (*CreatedApiToken, error)
+	GetApiTokensByUserId(userId uuid.UUID) ([]ApiTokenInfo, error)
+	RevokeApiToken(userId uuid.UUID, tokenId uuid.UUID) error
+	ValidatePersonalAccessToken(ctx context.Context, token string) (*authapi.PersonalAccessTokenInfo, error)
+}
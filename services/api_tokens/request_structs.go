@@ -0,0 +1,60 @@
+package api_tokens
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// swagger:model CreateApiTokenRequest
+type CreateApiTokenRequest struct {
+	Name string `json:"name"`
+	// Permission names the token may use. Each must be granted to the user.
+	Scopes []string `json:"scopes"`
+	// Token lifetime in days. Defaults to 90.
+	ExpiresInDays int `json:"expiresInDays,omitempty"`
+}
+
+// swagger:parameters createApiToken
+type CreateApiTokenRequestWrapper struct {
+	// in: body
+	Body CreateApiTokenRequest `json:"body"`
+}
+
+// swagger:model ApiTokenInfo
+type ApiTokenInfo struct {
+	Id          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"tokenPrefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+}
+
+// swagger:model CreatedApiToken
+type CreatedApiToken struct {
+	ApiTokenInfo
+	// The plaintext token. It is only returned once.
+	Token string `json:"token"`
+}
+
+// swagger:response CreatedApiTokenResponse
+type CreatedApiTokenResponse struct {
+	// in: body
+	Body CreatedApiToken
+}
+
+// swagger:response ApiTokenListResponse
+type ApiTokenListResponse struct {
+	// in: body
+	Body []ApiTokenInfo
+}
+
+// swagger:parameters revokeApiToken
+type RevokeApiTokenRequestWrapper struct {
+	// in: path
+	// required: true
+	ID string `json:"ID"`
+}
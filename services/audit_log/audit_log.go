@@ -0,0 +1,319 @@
+package audit_log
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionRead   = "read"
+	// ActionUse is a server-side decryption of a secret on behalf of a user, such as an SSH
+	// connection. The plaintext is never returned to the caller.
+	ActionUse = "use"
+)
+
+const (
+	ResourceSecret                = "secrets"
+	ResourceSecretVersion         = "secrets/versions"
+	ResourceSecretGrant           = "secrets/grants"
+	ResourceHostServer            = "host-servers"
+	ResourceUser                  = "users"
+	ResourceRole                  = "roles"
+	ResourceUserRoleMapping       = "user-role-mappings"
+	ResourceRolePermissionMapping = "role-permission-mappings"
+	ResourceSshKey                = "ssh-keys"
+	ResourceSshKeyHostMapping     = "ssh-key-host-mappings"
+	ResourceExternalApplication   = "external-applications"
+)
+
+// Redacted replaces the value of sensitive fields in diffs.
+const Redacted = "[REDACTED]"
+
+var (
+	defaultRecorderMu sync.RWMutex
+	defaultRecorder   AuditRecorder
+)
+
+// SetDefault sets the recorder used by the middleware and service hooks.
+func SetDefault(r AuditRecorder) {
+	defaultRecorderMu.Lock()
+	defer defaultRecorderMu.Unlock()
+	defaultRecorder = r
+}
+
+// Default returns the configured recorder or nil when auditing is disabled.
+func Default() AuditRecorder {
+	defaultRecorderMu.RLock()
+	defer defaultRecorderMu.RUnlock()
+	return defaultRecorder
+}
+
+// Event is one auditable action. Fields left empty are filled from the request the event
+// was recorded in.
+type Event struct {
+	ActorUserId  *uuid.UUID
+	Permission   string
+	Action       string
+	ResourceType string
+	ResourceId   string
+	Method       string
+	Path         string
+	StatusCode   int
+	ClientIp     string
+	RequestId    string
+	// Before and After are the resource state around the change. Either may be nil for
+	// creates and deletes; both are nil for reads.
+	Before     any
+	After      any
+	OccurredAt time.Time
+}
+
+// Record appends an event with the default recorder. Failures are logged rather than
+// returned so auditing never changes the outcome of the audited call.
+func Record(ctx context.Context, event Event) {
+	if info := requestInfoFromContext(ctx); info != nil {
+		info.fill(&event)
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	recorder := Default()
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Record(context.WithoutCancel(ctx), event); err != nil {
+		slog.Error("Error recording audit event",
+			slog.String("action", event.Action),
+			slog.String("resourceType", event.ResourceType),
+			slog.String("resourceId", event.ResourceId),
+			slog.String("error", err.Error()))
+	}
+}
+
+// FieldChange is the before and after value of one top level field.
+type FieldChange struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+var sensitiveKeyPattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|passphrase|private|credential|api_?key|otp|recovery)`)
+
+// isSensitiveKey reports whether a field holds a secret value. References such as
+// sudoPasswordSecretId are kept so the audit trail shows which secret was used.
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	if strings.HasSuffix(lower, "id") || strings.HasSuffix(lower, "ids") {
+		return false
+	}
+	return sensitiveKeyPattern.MatchString(key)
+}
+
+func redact(key string, value any) any {
+	if value == nil {
+		return nil
+	}
+	if isSensitiveKey(key) {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for k, nested := range v {
+			redacted[k] = redact(k, nested)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, nested := range v {
+			redacted[i] = redact(key, nested)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// asFields converts a value to its top level JSON fields. Values that are not JSON
+// objects are reported under a single "value" field.
+func asFields(value any) (map[string]any, error) {
+	if value == nil {
+		return map[string]any{}, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	if fields, ok := decoded.(map[string]any); ok {
+		return fields, nil
+	}
+	return map[string]any{"value": decoded}, nil
+}
+
+// Diff returns the fields that differ between before and after with sensitive values
+// redacted. A changed secret shows up as a change without revealing either value.
+func Diff(before, after any) (map[string]FieldChange, error) {
+	beforeFields, err := asFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := asFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]FieldChange)
+	for key, beforeValue := range beforeFields {
+		afterValue, ok := afterFields[key]
+		if ok && reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		changes[key] = FieldChange{Before: redact(key, beforeValue), After: redact(key, afterValue)}
+	}
+	for key, afterValue := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			changes[key] = FieldChange{After: redact(key, afterValue)}
+		}
+	}
+	return changes, nil
+}
+
+// diffJson encodes the event diff. Maps are encoded with sorted keys, so the stored text
+// is stable and can be hashed.
+func (e Event) diffJson() ([]byte, error) {
+	if e.Before == nil && e.After == nil {
+		return nil, nil
+	}
+	changes, err := Diff(e.Before, e.After)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(changes)
+}
+
+// genesisHash is the previous hash of the first entry.
+var genesisHash = make([]byte, sha256.Size)
+
+// chainedFields is the canonical form of an entry that is hashed. Field order is fixed by
+// the struct, and the diff is hashed exactly as stored in its json column.
+type chainedFields struct {
+	Seq          int64           `json:"seq"`
+	Id           string          `json:"id"`
+	OccurredAt   string          `json:"occurredAt"`
+	ActorUserId  string          `json:"actorUserId"`
+	Permission   string          `json:"permission"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resourceType"`
+	ResourceId   string          `json:"resourceId"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	StatusCode   int32           `json:"statusCode"`
+	ClientIp     string          `json:"clientIp"`
+	RequestId    string          `json:"requestId"`
+	Diff         json.RawMessage `json:"diff"`
+}
+
+// chainHash is sha256(prevHash || canonical entry).
+func chainHash(entry infra_db_pg.AuditLog) ([]byte, error) {
+	fields := chainedFields{
+		Seq:          entry.Seq,
+		Id:           entry.ID.String(),
+		OccurredAt:   entry.OccurredAt.Time.UTC().Format(time.RFC3339Nano),
+		Permission:   entry.Permission.String,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceId:   entry.ResourceID.String,
+		Method:       entry.Method.String,
+		Path:         entry.Path.String,
+		StatusCode:   entry.StatusCode.Int32,
+		ClientIp:     entry.ClientIp.String,
+		RequestId:    entry.RequestID.String,
+		Diff:         entry.Diff,
+	}
+	if entry.ActorUserID.Valid {
+		fields.ActorUserId = uuid.UUID(entry.ActorUserID.Bytes).String()
+	}
+	canonical, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(entry.PrevHash)
+	h.Write(canonical)
+	return h.Sum(nil), nil
+}
+
+// newChainedEntry builds the row for event that follows the entry with prevHash.
+func newChainedEntry(event Event, seq int64, prevHash []byte) (infra_db_pg.AuditLog, error) {
+	diff, err := event.diffJson()
+	if err != nil {
+		return infra_db_pg.AuditLog{}, err
+	}
+	entry := infra_db_pg.AuditLog{
+		Seq: seq,
+		ID:  uuid.New(),
+		// Postgres keeps microseconds, truncating first keeps the hashed time identical.
+		OccurredAt:   pgtype.Timestamptz{Time: event.OccurredAt.UTC().Truncate(time.Microsecond), Valid: true},
+		Permission:   textOrNull(event.Permission),
+		Action:       event.Action,
+		ResourceType: event.ResourceType,
+		ResourceID:   textOrNull(event.ResourceId),
+		Method:       textOrNull(event.Method),
+		Path:         textOrNull(event.Path),
+		ClientIp:     textOrNull(event.ClientIp),
+		RequestID:    textOrNull(event.RequestId),
+		Diff:         diff,
+		PrevHash:     prevHash,
+	}
+	if event.ActorUserId != nil {
+		entry.ActorUserID = pgtype.UUID{Bytes: *event.ActorUserId, Valid: true}
+	}
+	if event.StatusCode != 0 {
+		entry.StatusCode = pgtype.Int4{Int32: int32(event.StatusCode), Valid: true}
+	}
+	entry.Hash, err = chainHash(entry)
+	return entry, err
+}
+
+// verifyEntries checks consecutive entries that follow prevHash, starting at nextSeq.
+// It returns the seq of the first entry that breaks the chain, or 0 when all are intact.
+func verifyEntries(prevHash []byte, nextSeq int64, entries []infra_db_pg.AuditLog) (int64, string) {
+	for _, entry := range entries {
+		if entry.Seq != nextSeq {
+			return nextSeq, "entry is missing"
+		}
+		if !bytes.Equal(entry.PrevHash, prevHash) {
+			return entry.Seq, "previous hash does not match the preceding entry"
+		}
+		hash, err := chainHash(entry)
+		if err != nil || !bytes.Equal(hash, entry.Hash) {
+			return entry.Seq, "entry hash does not match its contents"
+		}
+		prevHash = entry.Hash
+		nextSeq++
+	}
+	return 0, ""
+}
+
+func textOrNull(s string) pgtype.Text {
+	return pgtype.Text{String: s, Valid: s != ""}
+}
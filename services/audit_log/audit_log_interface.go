@@ -0,0 +1,23 @@
+package audit_log
+
+import "context"
+
+// AuditRecorder appends events to the audit log. Implementations must never update or
+// remove entries that were already written.
+type AuditRecorder interface {
+	Record(ctx context.Context, event Event) error
+}
+
+// AuditLogReader queries the audit log and checks that its hash chain is intact.
+type AuditLogReader interface {
+	ListEntries(ctx context.Context, filter AuditLogFilter) (AuditLogPage, error)
+	VerifyChain(ctx context.Context) (ChainVerification, error)
+}
+
+// AuditSink ships committed audit entries off-box. Send receives entries in seq order and
+// may receive an entry again after a failure, receivers can deduplicate on seq.
+type AuditSink interface {
+	Name() string
+	Send(ctx context.Context, entries []AuditLogEntry) error
+	Close() error
+}
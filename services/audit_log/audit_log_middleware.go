@@ -0,0 +1,177 @@
+package audit_log
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// RequestIdHeader carries the request id. A well formed id sent by the client or a proxy is
+// kept so entries can be correlated across services, otherwise a new one is generated.
+const RequestIdHeader = "X-Request-ID"
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey string
+
+const requestInfoContextKey contextKey = "auditRequestInfo"
+
+// requestInfo collects what the audit middleware and the auth middleware learn about a
+// request. It is shared by pointer because the auth middleware runs in a nested handler.
+type requestInfo struct {
+	mu         sync.Mutex
+	actor      *uuid.UUID
+	permission string
+	clientIp   string
+	requestId  string
+	method     string
+	path       string
+	recorded   bool
+}
+
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
+
+func (i *requestInfo) fill(event *Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.recorded = true
+	if event.ActorUserId == nil && i.actor != nil {
+		actor := *i.actor
+		event.ActorUserId = &actor
+	}
+	if event.Permission == "" {
+		event.Permission = i.permission
+	}
+	if event.ClientIp == "" {
+		event.ClientIp = i.clientIp
+	}
+	if event.RequestId == "" {
+		event.RequestId = i.requestId
+	}
+	if event.Method == "" {
+		event.Method = i.method
+	}
+	if event.Path == "" {
+		event.Path = i.path
+	}
+}
+
+func (i *requestInfo) wasRecorded() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.recorded
+}
+
+// SetActor records the authenticated user of the request.
+func SetActor(ctx context.Context, userId uuid.UUID) {
+	if info := requestInfoFromContext(ctx); info != nil {
+		info.mu.Lock()
+		info.actor = &userId
+		info.mu.Unlock()
+	}
+}
+
+// SetPermission records the permission that authorized the request.
+func SetPermission(ctx context.Context, permission string) {
+	if info := requestInfoFromContext(ctx); info != nil {
+		info.mu.Lock()
+		info.permission = permission
+		info.mu.Unlock()
+	}
+}
+
+// RequestIdFromContext returns the id assigned by Middleware, or an empty string.
+func RequestIdFromContext(ctx context.Context) string {
+	if info := requestInfoFromContext(ctx); info != nil {
+		return info.requestId
+	}
+	return ""
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func actionForMethod(method string) string {
+	switch method {
+	case http.MethodPost:
+		return ActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return ActionUpdate
+	case http.MethodDelete:
+		return ActionDelete
+	default:
+		return ""
+	}
+}
+
+// resourceFromPath derives the resource from the path segments before the first id, for
+// example /secrets/versions/{ID}/{VERSION} is resource secrets/versions with the secret id.
+func resourceFromPath(path string) (string, string) {
+	var resource []string
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if _, err := uuid.Parse(segment); err == nil {
+			return strings.Join(resource, "/"), segment
+		}
+		resource = append(resource, segment)
+	}
+	return strings.Join(resource, "/"), ""
+}
+
+// Middleware assigns a request id and records every create, update and delete, including
+// rejected ones. Requests whose handlers recorded a more specific event through a service
+// hook are not recorded a second time.
+func Middleware(clientIp func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestId := r.Header.Get(RequestIdHeader)
+			if !requestIdPattern.MatchString(requestId) {
+				requestId = uuid.NewString()
+			}
+			w.Header().Set(RequestIdHeader, requestId)
+
+			info := &requestInfo{
+				clientIp:  clientIp(r),
+				requestId: requestId,
+				method:    r.Method,
+				path:      r.URL.Path,
+			}
+			ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			action := actionForMethod(r.Method)
+			if action == "" || info.wasRecorded() {
+				return
+			}
+			resourceType, resourceId := resourceFromPath(r.URL.Path)
+			Record(ctx, Event{
+				Action:       action,
+				ResourceType: resourceType,
+				ResourceId:   resourceId,
+				StatusCode:   recorder.status,
+			})
+		})
+	}
+}
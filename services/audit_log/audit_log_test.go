@@ -0,0 +1,130 @@
+package audit_log
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+)
+
+type fakeRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (f *fakeRecorder) Record(ctx context.Context, event Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	before := map[string]any{"hostname": "a", "sudoPassword": "hunter2", "sudoPasswordSecretId": "x", "port": 22}
+	after := map[string]any{"hostname": "b", "sudoPassword": "hunter3", "sudoPasswordSecretId": "x", "port": 22, "apiKey": "k"}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected hostname, sudoPassword and apiKey to change, got %v", changes)
+	}
+	if changes["hostname"].Before != "a" || changes["hostname"].After != "b" {
+		t.Fatalf("unexpected hostname change %v", changes["hostname"])
+	}
+	if changes["sudoPassword"].Before != Redacted || changes["sudoPassword"].After != Redacted {
+		t.Fatalf("expected sudoPassword to be redacted, got %v", changes["sudoPassword"])
+	}
+	if changes["apiKey"].Before != nil || changes["apiKey"].After != Redacted {
+		t.Fatalf("expected added apiKey to be redacted, got %v", changes["apiKey"])
+	}
+}
+
+func TestHashChainDetectsTampering(t *testing.T) {
+	actor := uuid.New()
+	var entries []infra_db_pg.AuditLog
+	prevHash := genesisHash
+	for i := int64(1); i <= 3; i++ {
+		entry, err := newChainedEntry(Event{
+			ActorUserId:  &actor,
+			Action:       ActionUpdate,
+			ResourceType: ResourceHostServer,
+			ResourceId:   uuid.NewString(),
+			Before:       map[string]string{"hostname": "a"},
+			After:        map[string]string{"hostname": "b"},
+			OccurredAt:   time.Now(),
+		}, i, prevHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+		prevHash = entry.Hash
+	}
+
+	if brokenAt, reason := verifyEntries(genesisHash, 1, entries); brokenAt != 0 {
+		t.Fatalf("expected intact chain, broken at %d: %s", brokenAt, reason)
+	}
+
+	tampered := append([]infra_db_pg.AuditLog(nil), entries...)
+	tampered[1].Diff = json.RawMessage(`{"hostname":{"before":"a","after":"c"}}`)
+	if brokenAt, _ := verifyEntries(genesisHash, 1, tampered); brokenAt != 2 {
+		t.Fatalf("expected edited entry 2 to break the chain, got %d", brokenAt)
+	}
+
+	removed := []infra_db_pg.AuditLog{entries[0], entries[2]}
+	if brokenAt, _ := verifyEntries(genesisHash, 1, removed); brokenAt != 2 {
+		t.Fatalf("expected removed entry 2 to break the chain, got %d", brokenAt)
+	}
+}
+
+func TestMiddlewareRecordsMutations(t *testing.T) {
+	recorder := &fakeRecorder{}
+	SetDefault(recorder)
+	defer SetDefault(nil)
+
+	actor := uuid.New()
+	secretId := uuid.New()
+	handler := Middleware(func(r *http.Request) string { return "203.0.113.7" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetActor(r.Context(), actor)
+		SetPermission(r.Context(), "ReadSecretPlaintext")
+		if r.URL.Path == "/secrets/typed/"+secretId.String() {
+			Record(r.Context(), Event{Action: ActionRead, ResourceType: ResourceSecret, ResourceId: secretId.String()})
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodDelete, "/secrets/versions/"+secretId.String()+"/2", nil)
+	req.Header.Set(RequestIdHeader, "req-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get(RequestIdHeader) != "req-123" {
+		t.Fatalf("expected request id to be propagated, got %q", rec.Header().Get(RequestIdHeader))
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/secrets/types", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/secrets/typed/"+secretId.String(), nil))
+
+	if len(recorder.events) != 2 {
+		t.Fatalf("expected the delete and the secret read to be recorded, got %d events", len(recorder.events))
+	}
+	deleted := recorder.events[0]
+	if deleted.Action != ActionDelete || deleted.ResourceType != "secrets/versions" || deleted.ResourceId != secretId.String() {
+		t.Fatalf("unexpected resource for delete %+v", deleted)
+	}
+	if deleted.ActorUserId == nil || *deleted.ActorUserId != actor || deleted.Permission != "ReadSecretPlaintext" {
+		t.Fatalf("expected actor and permission from the auth middleware, got %+v", deleted)
+	}
+	if deleted.ClientIp != "203.0.113.7" || deleted.RequestId != "req-123" || deleted.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected request details %+v", deleted)
+	}
+	if read := recorder.events[1]; read.Action != ActionRead || read.RequestId == "" || read.Method != http.MethodGet {
+		t.Fatalf("expected a single read event from the service hook, got %+v", read)
+	}
+}
@@ -0,0 +1,227 @@
+package audit_log
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSinkBatchSize      = 100
+	DefaultSinkBufferMaxBytes = 256 << 20
+	maxSinkRetryBackoff       = 5 * time.Minute
+)
+
+var (
+	ErrAuditBufferFull = errors.New("audit sink buffer is full")
+	// ErrAuditSinkRejected marks a batch the receiver will never accept, such as a 4xx
+	// response. The batch is dropped instead of blocking every later entry.
+	ErrAuditSinkRejected = errors.New("audit sink rejected the batch")
+)
+
+// BufferedSink spools entries to a JSON lines file before sending them, so entries written
+// while a sink is unreachable, or before a restart, are delivered once it is back. The
+// spool file is only read from the persisted offset and is truncated once fully sent.
+type BufferedSink struct {
+	sink       AuditSink
+	spoolPath  string
+	offsetPath string
+	MaxBytes   int64
+	BatchSize  int
+
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+func NewBufferedSink(sink AuditSink, dir string) (*BufferedSink, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating audit sink buffer directory: %w", err)
+	}
+	return &BufferedSink{
+		sink:       sink,
+		spoolPath:  filepath.Join(dir, sink.Name()+".jsonl"),
+		offsetPath: filepath.Join(dir, sink.Name()+".offset"),
+		MaxBytes:   DefaultSinkBufferMaxBytes,
+		BatchSize:  DefaultSinkBatchSize,
+		wake:       make(chan struct{}, 1),
+	}, nil
+}
+
+func (b *BufferedSink) Name() string {
+	return b.sink.Name()
+}
+
+// Enqueue durably appends an entry to the spool and wakes the sender.
+func (b *BufferedSink) Enqueue(entry AuditLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, err := os.OpenFile(b.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && b.MaxBytes > 0 && info.Size()+int64(len(line)) > b.MaxBytes {
+		return ErrAuditBufferFull
+	}
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Flush sends spooled entries in batches until the spool is empty or a send fails.
+func (b *BufferedSink) Flush(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		entries, next, consumed, err := b.readBatch()
+		if err != nil || !consumed {
+			return sent, err
+		}
+		if len(entries) > 0 {
+			err = b.sink.Send(ctx, entries)
+		}
+		switch {
+		case err == nil:
+			sent += len(entries)
+		case errors.Is(err, ErrAuditSinkRejected):
+			slog.Error("Dropping audit batch rejected by sink",
+				slog.String("sink", b.Name()),
+				slog.Int64("firstSeq", entries[0].Seq),
+				slog.Int("entries", len(entries)),
+				slog.String("error", err.Error()))
+		default:
+			return sent, err
+		}
+		if err := b.advance(next); err != nil {
+			return sent, err
+		}
+	}
+}
+
+// Start flushes whenever entries are enqueued and at least every interval. Failed sends are
+// retried with exponential backoff, entries stay in the spool in the meantime.
+func (b *BufferedSink) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		backoff := interval
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if err := b.sink.Close(); err != nil {
+					slog.Error("Error closing audit sink", slog.String("sink", b.Name()), slog.String("error", err.Error()))
+				}
+				return
+			case <-timer.C:
+			case <-b.wake:
+				timer.Stop()
+			}
+
+			wait := interval
+			if _, err := b.Flush(ctx); err != nil {
+				slog.Error("Error sending audit entries, will retry", slog.String("sink", b.Name()), slog.Any("retryIn", backoff), slog.String("error", err.Error()))
+				wait = backoff
+				backoff = min(backoff*2, maxSinkRetryBackoff)
+			} else {
+				backoff = interval
+			}
+			timer.Reset(wait)
+		}
+	}()
+}
+
+func (b *BufferedSink) readOffset() (int64, error) {
+	data, err := os.ReadFile(b.offsetPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readBatch returns up to BatchSize entries after the persisted offset, the offset just
+// past them and whether any complete line was consumed.
+func (b *BufferedSink) readBatch() ([]AuditLogEntry, int64, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offset, err := b.readOffset()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	f, err := os.Open(b.spoolPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, offset, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, false, err
+	}
+
+	entries := make([]AuditLogEntry, 0, b.BatchSize)
+	reader := bufio.NewReader(f)
+	next := offset
+	for len(entries) < b.BatchSize {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A partial trailing line is an append in progress or a torn write, it is
+			// picked up or skipped by the next read.
+			break
+		}
+		next += int64(len(line))
+		var entry AuditLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			slog.Error("Skipping unreadable audit buffer line", slog.String("sink", b.Name()), slog.Int64("offset", next-int64(len(line))))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, next > offset, nil
+}
+
+// advance persists the new offset, truncating the spool once everything was sent.
+func (b *BufferedSink) advance(offset int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if info, err := os.Stat(b.spoolPath); err == nil && info.Size() <= offset {
+		if err := os.Truncate(b.spoolPath, 0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	tmp := b.offsetPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.offsetPath)
+}
@@ -0,0 +1,160 @@
+package audit_log
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type flakySink struct {
+	down bool
+	got  []int64
+}
+
+func (f *flakySink) Name() string { return "flaky" }
+func (f *flakySink) Close() error { return nil }
+
+func (f *flakySink) Send(ctx context.Context, entries []AuditLogEntry) error {
+	if f.down {
+		return errors.New("unreachable")
+	}
+	for _, entry := range entries {
+		f.got = append(f.got, entry.Seq)
+	}
+	return nil
+}
+
+func TestBufferedSinkKeepsEntriesUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	sink := &flakySink{down: true}
+	buffered, err := NewBufferedSink(sink, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffered.BatchSize = 2
+	for seq := int64(1); seq <= 3; seq++ {
+		if err := buffered.Enqueue(AuditLogEntry{Seq: seq, Action: ActionCreate}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buffered.Flush(ctx); err == nil {
+		t.Fatal("expected flush to fail while the sink is down")
+	}
+
+	// A restarted process picks up the spool where the previous one stopped.
+	sink.down = false
+	restarted, err := NewBufferedSink(sink, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.BatchSize = 2
+	sent, err := restarted.Flush(ctx)
+	if err != nil || sent != 3 {
+		t.Fatalf("expected 3 entries to be sent, got %d: %v", sent, err)
+	}
+	if len(sink.got) != 3 || sink.got[0] != 1 || sink.got[2] != 3 {
+		t.Fatalf("expected entries in seq order, got %v", sink.got)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "flaky.jsonl")); err != nil || info.Size() != 0 {
+		t.Fatalf("expected the spool to be truncated once delivered: %v", err)
+	}
+}
+
+func TestRotatingFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewRotatingFileSink(path, 200, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for seq := int64(1); seq <= 6; seq++ {
+		if err := sink.Send(context.Background(), []AuditLogEntry{{Seq: seq, Id: uuid.New(), Action: ActionDelete}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Fatal("expected at most 2 backups")
+	}
+}
+
+func TestSyslogFormat(t *testing.T) {
+	sink, err := NewSyslogSink("udp", "127.0.0.1:514", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Hostname = "infra host"
+	msg, err := sink.Format(AuditLogEntry{
+		Seq:          7,
+		OccurredAt:   time.Date(2026, 10, 17, 9, 30, 0, 123456000, time.UTC),
+		Action:       ActionUpdate,
+		ResourceType: ResourceHostServer,
+		ResourceId:   `x"]`,
+		StatusCode:   http.StatusForbidden,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<108>1 2026-10-17T09:30:00.123456Z infrahost go-infra `
+	if !strings.HasPrefix(msg, want) {
+		t.Fatalf("unexpected header %q", msg)
+	}
+	if !strings.Contains(msg, ` update [audit@32473 seq="7"`) || !strings.Contains(msg, `resourceId="x\"\]"`) {
+		t.Fatalf("unexpected structured data %q", msg)
+	}
+}
+
+func TestWebhookSinkSignsAndRetries(t *testing.T) {
+	key := []byte("audit-key")
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		if r.Header.Get("X-Signature-256") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(server.URL, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.RetryBackoff = time.Millisecond
+	if err := sink.Send(context.Background(), []AuditLogEntry{{Seq: 1}, {Seq: 2}}); err != nil {
+		t.Fatalf("expected the retry to succeed: %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts.Load())
+	}
+
+	sink.SigningKey = []byte("wrong")
+	if err := sink.Send(context.Background(), []AuditLogEntry{{Seq: 3}}); !errors.Is(err, ErrAuditSinkRejected) {
+		t.Fatalf("expected a 4xx to reject the batch, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package audit_log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFileSink appends entries as JSON lines. Once the file would exceed MaxBytes it is
+// renamed to path.1, older files shift to path.2 and so on, keeping MaxBackups of them.
+type RotatingFileSink struct {
+	Path       string
+	MaxBytes   int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewRotatingFileSink(path string, maxBytes int64, maxBackups int) (*RotatingFileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("an audit file path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("error creating audit file directory: %w", err)
+	}
+	return &RotatingFileSink{Path: path, MaxBytes: maxBytes, MaxBackups: maxBackups}, nil
+}
+
+func (f *RotatingFileSink) Name() string {
+	return "file"
+}
+
+func (f *RotatingFileSink) Send(ctx context.Context, entries []AuditLogEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if f.MaxBytes > 0 && f.size > 0 && f.size+int64(len(line)) > f.MaxBytes {
+			if err := f.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := f.file.Write(line)
+		f.size += int64(n)
+		if err != nil {
+			return fmt.Errorf("error writing audit file: %w", err)
+		}
+	}
+	return f.file.Sync()
+}
+
+func (f *RotatingFileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFileSink) open() error {
+	if f.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("error opening audit file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFileSink) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.MaxBackups <= 0 {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		for i := f.MaxBackups - 1; i >= 1; i-- {
+			older := fmt.Sprintf("%s.%d", f.Path, i)
+			if err := os.Rename(older, fmt.Sprintf("%s.%d", f.Path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.Path, f.Path+".1"); err != nil {
+			return err
+		}
+	}
+	return f.open()
+}
@@ -0,0 +1,264 @@
+package audit_log
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+	verifyBatchSize = 1000
+)
+
+// AuditLogEntry is one entry of the audit log.
+//
+// swagger:model AuditLogEntry
+type AuditLogEntry struct {
+	Seq          int64           `json:"seq"`
+	Id           uuid.UUID       `json:"id"`
+	OccurredAt   time.Time       `json:"occurredAt"`
+	ActorUserId  *uuid.UUID      `json:"actorUserId,omitempty"`
+	Permission   string          `json:"permission,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resourceType"`
+	ResourceId   string          `json:"resourceId,omitempty"`
+	Method       string          `json:"method,omitempty"`
+	Path         string          `json:"path,omitempty"`
+	StatusCode   int32           `json:"statusCode,omitempty"`
+	ClientIp     string          `json:"clientIp,omitempty"`
+	RequestId    string          `json:"requestId,omitempty"`
+	Diff         json.RawMessage `json:"diff,omitempty"`
+	PrevHash     string          `json:"prevHash"`
+	Hash         string          `json:"hash"`
+}
+
+func (e *AuditLogEntry) ParseAuditLogEntryFromDb(entry infra_db_pg.AuditLog) {
+	e.Seq = entry.Seq
+	e.Id = entry.ID
+	e.OccurredAt = entry.OccurredAt.Time
+	e.Permission = entry.Permission.String
+	e.Action = entry.Action
+	e.ResourceType = entry.ResourceType
+	e.ResourceId = entry.ResourceID.String
+	e.Method = entry.Method.String
+	e.Path = entry.Path.String
+	e.StatusCode = entry.StatusCode.Int32
+	e.ClientIp = entry.ClientIp.String
+	e.RequestId = entry.RequestID.String
+	e.Diff = entry.Diff
+	e.PrevHash = hex.EncodeToString(entry.PrevHash)
+	e.Hash = hex.EncodeToString(entry.Hash)
+	if entry.ActorUserID.Valid {
+		actor := uuid.UUID(entry.ActorUserID.Bytes)
+		e.ActorUserId = &actor
+	}
+}
+
+// AuditLogFilter narrows a listing. Zero values match everything.
+type AuditLogFilter struct {
+	ActorUserId  *uuid.UUID
+	ResourceType string
+	ResourceId   string
+	Action       string
+	From         *time.Time
+	To           *time.Time
+	// BeforeSeq is the cursor returned as NextCursor by the previous page.
+	BeforeSeq *int64
+	Limit     int
+}
+
+// AuditLogPage is one page of entries, newest first.
+//
+// swagger:model AuditLogPage
+type AuditLogPage struct {
+	Entries []AuditLogEntry `json:"entries"`
+	// Pass as before to fetch the next page, absent on the last page.
+	NextCursor *int64 `json:"nextCursor,omitempty"`
+}
+
+// ChainVerification is the result of re-hashing the whole audit log.
+//
+// swagger:model ChainVerification
+type ChainVerification struct {
+	Valid       bool   `json:"valid"`
+	Checked     int64  `json:"checked"`
+	BrokenAtSeq *int64 `json:"brokenAtSeq,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type PgAuditLog struct {
+	DbConn *pgxpool.Pool
+	sinks  []*BufferedSink
+}
+
+func NewPgAuditLog(db *pgxpool.Pool) *PgAuditLog {
+	return &PgAuditLog{DbConn: db}
+}
+
+// AddSinks exports every committed entry to the sinks. It must be called before the audit
+// log starts recording.
+func (p *PgAuditLog) AddSinks(sinks ...*BufferedSink) {
+	p.sinks = append(p.sinks, sinks...)
+}
+
+// Record appends an event. Appends are serialized with a transaction scoped advisory lock
+// so every entry chains onto the current head, even across replicas.
+func (p *PgAuditLog) Record(ctx context.Context, event Event) error {
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting audit log transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qry := infra_db_pg.New(tx)
+	if err := qry.LockAuditLog(ctx); err != nil {
+		return fmt.Errorf("error locking audit log: %w", err)
+	}
+
+	seq, prevHash := int64(1), genesisHash
+	head, err := qry.GetAuditLogHead(ctx)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("error reading audit log head: %w", err)
+	default:
+		seq, prevHash = head.Seq+1, head.Hash
+	}
+
+	entry, err := newChainedEntry(event, seq, prevHash)
+	if err != nil {
+		return fmt.Errorf("error building audit log entry: %w", err)
+	}
+	err = qry.InsertAuditLogEntry(ctx, infra_db_pg.InsertAuditLogEntryParams{
+		Seq:          entry.Seq,
+		ID:           entry.ID,
+		OccurredAt:   entry.OccurredAt,
+		ActorUserID:  entry.ActorUserID,
+		Permission:   entry.Permission,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		Method:       entry.Method,
+		Path:         entry.Path,
+		StatusCode:   entry.StatusCode,
+		ClientIp:     entry.ClientIp,
+		RequestID:    entry.RequestID,
+		Diff:         entry.Diff,
+		PrevHash:     entry.PrevHash,
+		Hash:         entry.Hash,
+	})
+	if err != nil {
+		return fmt.Errorf("error inserting audit log entry: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	p.export(entry)
+	return nil
+}
+
+// export spools a committed entry to every sink. A full or failing spool only loses the
+// export, the entry itself is already in Postgres.
+func (p *PgAuditLog) export(entry infra_db_pg.AuditLog) {
+	if len(p.sinks) == 0 {
+		return
+	}
+	var exported AuditLogEntry
+	exported.ParseAuditLogEntryFromDb(entry)
+	for _, sink := range p.sinks {
+		if err := sink.Enqueue(exported); err != nil {
+			slog.Error("Error buffering audit entry for sink", slog.String("sink", sink.Name()), slog.Int64("seq", entry.Seq), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (p *PgAuditLog) ListEntries(ctx context.Context, filter AuditLogFilter) (AuditLogPage, error) {
+	page := AuditLogPage{Entries: make([]AuditLogEntry, 0)}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	params := infra_db_pg.ListAuditLogEntriesParams{
+		ResourceType: textOrNull(filter.ResourceType),
+		ResourceID:   textOrNull(filter.ResourceId),
+		Action:       textOrNull(filter.Action),
+		RowLimit:     int32(limit),
+	}
+	if filter.ActorUserId != nil {
+		params.ActorUserID = pgtype.UUID{Bytes: *filter.ActorUserId, Valid: true}
+	}
+	if filter.From != nil {
+		params.OccurredFrom = pgtype.Timestamptz{Time: *filter.From, Valid: true}
+	}
+	if filter.To != nil {
+		params.OccurredTo = pgtype.Timestamptz{Time: *filter.To, Valid: true}
+	}
+	if filter.BeforeSeq != nil {
+		params.BeforeSeq = pgtype.Int8{Int64: *filter.BeforeSeq, Valid: true}
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.ListAuditLogEntries(ctx, params)
+	if err != nil {
+		slog.Error("Error listing audit log entries", slog.String("error", err.Error()))
+		return page, fmt.Errorf("error listing audit log entries: %w", err)
+	}
+	for _, row := range rows {
+		var entry AuditLogEntry
+		entry.ParseAuditLogEntryFromDb(row)
+		page.Entries = append(page.Entries, entry)
+	}
+	if len(rows) == limit {
+		next := rows[len(rows)-1].Seq
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+// VerifyChain re-hashes every entry in order. Any edited, removed or reordered entry is
+// reported as the first seq where the chain breaks.
+func (p *PgAuditLog) VerifyChain(ctx context.Context) (ChainVerification, error) {
+	result := ChainVerification{Valid: true}
+	qry := infra_db_pg.New(p.DbConn)
+	prevHash, nextSeq := genesisHash, int64(1)
+	for {
+		rows, err := qry.GetAuditLogEntriesAfter(ctx, infra_db_pg.GetAuditLogEntriesAfterParams{
+			AfterSeq: nextSeq - 1,
+			RowLimit: verifyBatchSize,
+		})
+		if err != nil {
+			slog.Error("Error reading audit log for verification", slog.String("error", err.Error()))
+			return result, fmt.Errorf("error reading audit log: %w", err)
+		}
+		if brokenAt, reason := verifyEntries(prevHash, nextSeq, rows); brokenAt != 0 {
+			result.Valid = false
+			result.BrokenAtSeq = &brokenAt
+			result.Reason = reason
+			result.Checked += brokenAt - nextSeq
+			slog.Warn("Audit log hash chain is broken", slog.Int64("seq", brokenAt), slog.String("reason", reason))
+			return result, nil
+		}
+		result.Checked += int64(len(rows))
+		if len(rows) < verifyBatchSize {
+			return result, nil
+		}
+		last := rows[len(rows)-1]
+		prevHash, nextSeq = last.Hash, last.Seq+1
+	}
+}
@@ -0,0 +1,47 @@
+package audit_log
+
+// swagger:parameters listAuditLog
+type ListAuditLogRequestWrapper struct {
+	// Only entries recorded for this user
+	//
+	// In: query
+	ActorId string `json:"actorId"`
+	// Resource type such as secrets or host-servers
+	//
+	// In: query
+	ResourceType string `json:"resourceType"`
+	// In: query
+	ResourceId string `json:"resourceId"`
+	// One of create, update, delete, read or use
+	//
+	// In: query
+	Action string `json:"action"`
+	// RFC3339 time, inclusive
+	//
+	// In: query
+	From string `json:"from"`
+	// RFC3339 time, exclusive
+	//
+	// In: query
+	To string `json:"to"`
+	// Cursor from the previous page
+	//
+	// In: query
+	Before int64 `json:"before"`
+	// Page size, defaults to 50 and is at most 500
+	//
+	// In: query
+	Limit int `json:"limit"`
+}
+
+// swagger:response AuditLogPageResponse
+type AuditLogPageResponse struct {
+	// in: body
+	Body AuditLogPage `json:"auditLog"`
+}
+
+// swagger:response ChainVerificationResponse
+type ChainVerificationResponse struct {
+	// in: body
+	Body ChainVerification `json:"verification"`
+}
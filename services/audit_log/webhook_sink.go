@@ -0,0 +1,101 @@
+package audit_log
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSink posts batches of entries as JSON. The body is signed with HMAC-SHA256 in the
+// X-Signature-256 header when a signing key is set. Network errors, 429 and 5xx responses
+// are retried with backoff, other 4xx responses reject the batch.
+type WebhookSink struct {
+	Url          string
+	SigningKey   []byte
+	Client       *http.Client
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+func NewWebhookSink(url string, signingKey []byte) (*WebhookSink, error) {
+	if url == "" {
+		return nil, fmt.Errorf("an audit webhook url is required")
+	}
+	return &WebhookSink{
+		Url:          url,
+		SigningKey:   signingKey,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts:  3,
+		RetryBackoff: time.Second,
+	}, nil
+}
+
+func (wh *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (wh *WebhookSink) Send(ctx context.Context, entries []AuditLogEntry) error {
+	payload, err := json.Marshal(struct {
+		Event   string          `json:"event"`
+		Entries []AuditLogEntry `json:"entries"`
+	}{Event: "audit.entries", Entries: entries})
+	if err != nil {
+		return err
+	}
+
+	backoff := wh.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := wh.post(ctx, payload)
+		if err == nil || !retry || attempt >= wh.MaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (wh *WebhookSink) Close() error {
+	return nil
+}
+
+// post sends one attempt and reports whether a failure is worth retrying.
+func (wh *WebhookSink) post(ctx context.Context, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.Url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(wh.SigningKey) > 0 {
+		mac := hmac.New(sha256.New, wh.SigningKey)
+		mac.Write(payload)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("error posting audit webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("audit webhook returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("%w: audit webhook returned %s", ErrAuditSinkRejected, resp.Status)
+	}
+}
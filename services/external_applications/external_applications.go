@@ -2,35 +2,48 @@ package external_applications
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 
 	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrExternalApplicationNotFound is returned when an application does not exist
+// or belongs to another organization than the caller's active one.
+var ErrExternalApplicationNotFound = errors.New("external application not found")
+
 type ExternalApplicationsService struct {
 	DbConn *pgxpool.Pool
 }
 
 type ExternalApplications interface {
-	CreateExternalApplication(req CreateExternalApplicationRequest) (*ExternalApplicationDao, error)
-	GetExternalApplicationById(id uuid.UUID) (*ExternalApplicationDao, error)
-	GetExternalApplicationByName(name string) (*ExternalApplicationDao, error)
-	GetAllExternalApplications() ([]ExternalApplicationDao, error)
-	UpdateExternalApplication(id uuid.UUID, req UpdateExternalApplicationRequest) (*ExternalApplicationDao, error)
-	DeleteExternalApplicationById(id uuid.UUID) error
-	DeleteExternalApplicationByName(name string) error
-	GetExternalApplicationIdByName(name string) (uuid.UUID, error)
-	GetExternalApplicationNameById(id uuid.UUID) (string, error)
+	CreateExternalApplication(ctx context.Context, req CreateExternalApplicationRequest) (*ExternalApplicationDao, error)
+	GetExternalApplicationById(ctx context.Context, id uuid.UUID) (*ExternalApplicationDao, error)
+	GetExternalApplicationByName(ctx context.Context, name string) (*ExternalApplicationDao, error)
+	GetAllExternalApplications(ctx context.Context) ([]ExternalApplicationDao, error)
+	UpdateExternalApplication(ctx context.Context, id uuid.UUID, req UpdateExternalApplicationRequest) (*ExternalApplicationDao, error)
+	DeleteExternalApplicationById(ctx context.Context, id uuid.UUID) error
+	DeleteExternalApplicationByName(ctx context.Context, name string) error
+	GetExternalApplicationIdByName(ctx context.Context, name string) (uuid.UUID, error)
+	GetExternalApplicationNameById(ctx context.Context, id uuid.UUID) (string, error)
 }
 
 // CreateExternalApplication creates a new external application
-func (eas *ExternalApplicationsService) CreateExternalApplication(req CreateExternalApplicationRequest) (*ExternalApplicationDao, error) {
+func (eas *ExternalApplicationsService) CreateExternalApplication(ctx context.Context, req CreateExternalApplicationRequest) (*ExternalApplicationDao, error) {
 	slog.Info("Creating external application", slog.String("name", req.Name))
 
+	if err := organizations.RequireActiveOrg(ctx); err != nil {
+		return nil, err
+	}
+
 	// Generate a new UUID for the application
 	appId := uuid.New()
 
@@ -49,34 +62,47 @@ func (eas *ExternalApplicationsService) CreateExternalApplication(req CreateExte
 	}
 
 	queries := infra_db_pg.New(eas.DbConn)
-	dbApp, err := queries.CreateExternalApplication(context.Background(), params)
+	dbApp, err := queries.CreateExternalApplication(ctx, params)
 	if err != nil {
 		slog.Error("Error creating external application",
 			slog.String("name", req.Name),
 			slog.String("error", err.Error()))
 		return nil, fmt.Errorf("failed to create external application: %w", err)
 	}
+	if err := organizations.AssignToActiveOrg(ctx, organizations.ResourceExternalApp, dbApp.ID); err != nil {
+		slog.Error("Error assigning external application to organization",
+			slog.String("name", req.Name),
+			slog.String("error", err.Error()))
+		if delErr := queries.DeleteExternalApplicationById(ctx, dbApp.ID); delErr != nil {
+			slog.Error("Error removing unassigned external application", slog.String("error", delErr.Error()))
+		}
+		return nil, fmt.Errorf("failed to create external application: %w", err)
+	}
 
 	// Parse the database result to DAO
 	var appDao ExternalApplicationDao
 	appDao.ParseExternalApplicationFromDb(dbApp)
+	recordExternalApplicationChange(ctx, audit_log.ActionCreate, appDao.Id, nil, &appDao)
 
 	return &appDao, nil
 }
 
 // GetExternalApplicationById retrieves an external application by its ID
-func (eas *ExternalApplicationsService) GetExternalApplicationById(id uuid.UUID) (*ExternalApplicationDao, error) {
+func (eas *ExternalApplicationsService) GetExternalApplicationById(ctx context.Context, id uuid.UUID) (*ExternalApplicationDao, error) {
 	slog.Info("Getting external application by ID", slog.String("id", id.String()))
 
 	queries := infra_db_pg.New(eas.DbConn)
 
-	dbApp, err := queries.GetExternalApplicationById(context.Background(), id)
+	dbApp, err := queries.GetExternalApplicationById(ctx, id)
 	if err != nil {
 		slog.Error("Error getting external application by ID",
 			slog.String("id", id.String()),
 			slog.String("error", err.Error()))
 		return nil, fmt.Errorf("external application not found with ID %s: %w", id.String(), err)
 	}
+	if err := allowApplication(ctx, dbApp.ID); err != nil {
+		return nil, err
+	}
 
 	// Parse the database result to DAO
 	var appDao ExternalApplicationDao
@@ -86,18 +112,21 @@ func (eas *ExternalApplicationsService) GetExternalApplicationById(id uuid.UUID)
 }
 
 // GetExternalApplicationByName retrieves an external application by its name
-func (eas *ExternalApplicationsService) GetExternalApplicationByName(name string) (*ExternalApplicationDao, error) {
+func (eas *ExternalApplicationsService) GetExternalApplicationByName(ctx context.Context, name string) (*ExternalApplicationDao, error) {
 	slog.Info("Getting external application by name", slog.String("name", name))
 
 	queries := infra_db_pg.New(eas.DbConn)
 
-	dbApp, err := queries.GetExternalApplicationByName(context.Background(), name)
+	dbApp, err := queries.GetExternalApplicationByName(ctx, name)
 	if err != nil {
 		slog.Error("Error getting external application by name",
 			slog.String("name", name),
 			slog.String("error", err.Error()))
 		return nil, fmt.Errorf("external application not found with name %s: %w", name, err)
 	}
+	if err := allowApplication(ctx, dbApp.ID); err != nil {
+		return nil, err
+	}
 
 	// Parse the database result to DAO
 	var appDao ExternalApplicationDao
@@ -107,30 +136,50 @@ func (eas *ExternalApplicationsService) GetExternalApplicationByName(name string
 }
 
 // GetAllExternalApplications retrieves all external applications
-func (eas *ExternalApplicationsService) GetAllExternalApplications() ([]ExternalApplicationDao, error) {
+func (eas *ExternalApplicationsService) GetAllExternalApplications(ctx context.Context) ([]ExternalApplicationDao, error) {
 	slog.Info("Getting all external applications")
 
 	queries := infra_db_pg.New(eas.DbConn)
-	rows, err := queries.GetAllExternalApps(context.Background())
+	rows, err := queries.GetAllExternalApps(ctx)
 	if err != nil {
 		slog.Error("Error getting all external applications", slog.String("error", err.Error()))
 		return nil, fmt.Errorf("failed to get external applications: %w", err)
 	}
 
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	allowed, err := organizations.FilterIds(ctx, organizations.ResourceExternalApp, ids)
+	if err != nil {
+		slog.Error("Error filtering external applications by organization", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("failed to get external applications: %w", err)
+	}
+
 	// Map rows to ExternalApplicationDao
-	appDaos := make([]ExternalApplicationDao, len(rows))
-	for i, row := range rows {
-		appDaos[i].ParseExternalApplicationFromGetAllRow(row)
+	appDaos := make([]ExternalApplicationDao, 0, len(rows))
+	for _, row := range rows {
+		if !slices.Contains(allowed, row.ID) || !resource_policy.AllowsExternalApplication(ctx, row.ID) {
+			continue
+		}
+		var appDao ExternalApplicationDao
+		appDao.ParseExternalApplicationFromGetAllRow(row)
+		appDaos = append(appDaos, appDao)
 	}
 
 	return appDaos, nil
 }
 
 // UpdateExternalApplication updates an existing external application
-func (eas *ExternalApplicationsService) UpdateExternalApplication(id uuid.UUID, req UpdateExternalApplicationRequest) (*ExternalApplicationDao, error) {
+func (eas *ExternalApplicationsService) UpdateExternalApplication(ctx context.Context, id uuid.UUID, req UpdateExternalApplicationRequest) (*ExternalApplicationDao, error) {
 	slog.Info("Updating external application", slog.String("id", id.String()))
 
+	if err := allowApplication(ctx, id); err != nil {
+		return nil, err
+	}
+
 	queries := infra_db_pg.New(eas.DbConn)
+	before := currentApplication(ctx, queries, id)
 
 	// Set up parameters for the update
 	params := infra_db_pg.UpdateExternalApplicationParams{
@@ -148,7 +197,7 @@ func (eas *ExternalApplicationsService) UpdateExternalApplication(id uuid.UUID,
 		params.AppDescription = pgtype.Text{String: req.AppDescription, Valid: true}
 	}
 
-	dbApp, err := queries.UpdateExternalApplication(context.Background(), params)
+	dbApp, err := queries.UpdateExternalApplication(ctx, params)
 	if err != nil {
 		slog.Error("Error updating external application",
 			slog.String("id", id.String()),
@@ -159,64 +208,87 @@ func (eas *ExternalApplicationsService) UpdateExternalApplication(id uuid.UUID,
 	// Parse the database result to DAO
 	var appDao ExternalApplicationDao
 	appDao.ParseExternalApplicationFromDb(dbApp)
+	recordExternalApplicationChange(ctx, audit_log.ActionUpdate, id, before, &appDao)
 
 	return &appDao, nil
 }
 
 // DeleteExternalApplicationById deletes an external application by its ID
-func (eas *ExternalApplicationsService) DeleteExternalApplicationById(id uuid.UUID) error {
+func (eas *ExternalApplicationsService) DeleteExternalApplicationById(ctx context.Context, id uuid.UUID) error {
 	slog.Info("Deleting external application by ID", slog.String("id", id.String()))
 
+	if err := allowApplication(ctx, id); err != nil {
+		return err
+	}
+
 	queries := infra_db_pg.New(eas.DbConn)
-	err := queries.DeleteExternalApplicationById(context.Background(), id)
+	before := currentApplication(ctx, queries, id)
+	err := queries.DeleteExternalApplicationById(ctx, id)
 	if err != nil {
 		slog.Error("Error deleting external application by ID",
 			slog.String("id", id.String()),
 			slog.String("error", err.Error()))
 		return fmt.Errorf("failed to delete external application: %w", err)
 	}
+	recordExternalApplicationChange(ctx, audit_log.ActionDelete, id, before, nil)
 
 	return nil
 }
 
 // DeleteExternalApplicationByName deletes an external application by its name
-func (eas *ExternalApplicationsService) DeleteExternalApplicationByName(name string) error {
+func (eas *ExternalApplicationsService) DeleteExternalApplicationByName(ctx context.Context, name string) error {
 	slog.Info("Deleting external application by name", slog.String("name", name))
 
 	queries := infra_db_pg.New(eas.DbConn)
-	err := queries.DeleteExternalApplicationByName(context.Background(), name)
+	id, err := queries.GetExternalAppIdByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%w with name %s: %v", ErrExternalApplicationNotFound, name, err)
+	}
+	if err := allowApplication(ctx, id); err != nil {
+		return err
+	}
+	before := currentApplication(ctx, queries, id)
+	err = queries.DeleteExternalApplicationByName(ctx, name)
 	if err != nil {
 		slog.Error("Error deleting external application by name",
 			slog.String("name", name),
 			slog.String("error", err.Error()))
 		return fmt.Errorf("failed to delete external application: %w", err)
 	}
+	recordExternalApplicationChange(ctx, audit_log.ActionDelete, id, before, nil)
 
 	return nil
 }
 
 // GetExternalApplicationIdByName retrieves the ID of an external application by its name
-func (eas *ExternalApplicationsService) GetExternalApplicationIdByName(name string) (uuid.UUID, error) {
+func (eas *ExternalApplicationsService) GetExternalApplicationIdByName(ctx context.Context, name string) (uuid.UUID, error) {
 	slog.Info("Getting external application ID by name", slog.String("name", name))
 
 	queries := infra_db_pg.New(eas.DbConn)
-	id, err := queries.GetExternalAppIdByName(context.Background(), name)
+	id, err := queries.GetExternalAppIdByName(ctx, name)
 	if err != nil {
 		slog.Error("Error getting external application ID by name",
 			slog.String("name", name),
 			slog.String("error", err.Error()))
 		return uuid.Nil, fmt.Errorf("external application not found with name %s: %w", name, err)
 	}
+	if err := allowApplication(ctx, id); err != nil {
+		return uuid.Nil, err
+	}
 
 	return id, nil
 }
 
 // GetExternalApplicationNameById retrieves the name of an external application by its ID
-func (eas *ExternalApplicationsService) GetExternalApplicationNameById(id uuid.UUID) (string, error) {
+func (eas *ExternalApplicationsService) GetExternalApplicationNameById(ctx context.Context, id uuid.UUID) (string, error) {
 	slog.Info("Getting external application name by ID", slog.String("id", id.String()))
 
+	if err := allowApplication(ctx, id); err != nil {
+		return "", err
+	}
+
 	queries := infra_db_pg.New(eas.DbConn)
-	name, err := queries.GetExternalAppNameById(context.Background(), id)
+	name, err := queries.GetExternalAppNameById(ctx, id)
 	if err != nil {
 		slog.Error("Error getting external application name by ID",
 			slog.String("id", id.String()),
@@ -226,3 +298,46 @@ func (eas *ExternalApplicationsService) GetExternalApplicationNameById(id uuid.U
 
 	return name, nil
 }
+
+// allowApplication reports ErrExternalApplicationNotFound for applications owned by an
+// organization other than the caller's active one, and resource_policy.ErrOutOfScope for
+// applications the caller's permission scopes do not reach.
+func allowApplication(ctx context.Context, id uuid.UUID) error {
+	ok, err := organizations.AllowsResource(ctx, organizations.ResourceExternalApp, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrExternalApplicationNotFound
+	}
+	if !resource_policy.AllowsExternalApplication(ctx, id) {
+		return resource_policy.ErrOutOfScope
+	}
+	return nil
+}
+
+// currentApplication loads the state of an application for an audit diff, nil when it
+// cannot be read.
+func currentApplication(ctx context.Context, queries *infra_db_pg.Queries, id uuid.UUID) *ExternalApplicationDao {
+	dbApp, err := queries.GetExternalApplicationById(ctx, id)
+	if err != nil {
+		return nil
+	}
+	var appDao ExternalApplicationDao
+	appDao.ParseExternalApplicationFromDb(dbApp)
+	return &appDao
+}
+
+// recordExternalApplicationChange audits an external application change with the before
+// and after state.
+func recordExternalApplicationChange(ctx context.Context, action string, id uuid.UUID, before, after *ExternalApplicationDao) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceExternalApplication, ResourceId: id.String()}
+	// Assign only non-nil pointers so a missing side stays a nil interface.
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
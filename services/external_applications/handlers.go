@@ -2,11 +2,14 @@ package external_applications
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 
 	authapi "github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/google/uuid"
 )
 
@@ -153,11 +156,15 @@ func CreateExternalApplicationHandler(service ExternalApplications) http.Handler
 			return
 		}
 
-		app, err := service.CreateExternalApplication(req)
+		app, err := service.CreateExternalApplication(r.Context(), req)
 		if err != nil {
 			slog.Error("Error creating external application",
 				slog.String("name", req.Name),
 				slog.String("error", err.Error()))
+			if errors.Is(err, organizations.ErrNoActiveOrganization) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
 			http.Error(w, fmt.Sprintf("Failed to create external application: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -177,6 +184,7 @@ func CreateExternalApplicationHandler(service ExternalApplications) http.Handler
 // responses:
 // 200: GetExternalApplicationByIdResponse
 // 400: description:Bad request - invalid UUID format
+// 403: description:Forbidden - outside the caller's permission scopes
 // 404: description:External application not found
 // 500: description:Internal server error
 func GetExternalApplicationByIdHandler(service ExternalApplications) http.HandlerFunc {
@@ -190,11 +198,15 @@ func GetExternalApplicationByIdHandler(service ExternalApplications) http.Handle
 			return
 		}
 
-		app, err := service.GetExternalApplicationById(id)
+		app, err := service.GetExternalApplicationById(r.Context(), id)
 		if err != nil {
 			slog.Error("Error getting external application by ID",
 				slog.String("id", id.String()),
 				slog.String("error", err.Error()))
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
 			http.Error(w, fmt.Sprintf("External application not found: %v", err), http.StatusNotFound)
 			return
 		}
@@ -212,6 +224,7 @@ func GetExternalApplicationByIdHandler(service ExternalApplications) http.Handle
 // - bearer:
 // responses:
 // 200: GetExternalApplicationByNameResponse
+// 403: description:Forbidden - outside the caller's permission scopes
 // 404: description:External application not found
 // 500: description:Internal server error
 func GetExternalApplicationByNameHandler(service ExternalApplications) http.HandlerFunc {
@@ -223,11 +236,15 @@ func GetExternalApplicationByNameHandler(service ExternalApplications) http.Hand
 			return
 		}
 
-		app, err := service.GetExternalApplicationByName(name)
+		app, err := service.GetExternalApplicationByName(r.Context(), name)
 		if err != nil {
 			slog.Error("Error getting external application by name",
 				slog.String("name", name),
 				slog.String("error", err.Error()))
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
 			http.Error(w, fmt.Sprintf("External application not found: %v", err), http.StatusNotFound)
 			return
 		}
@@ -248,7 +265,7 @@ func GetExternalApplicationByNameHandler(service ExternalApplications) http.Hand
 // 500: description:Internal server error
 func GetAllExternalApplicationsHandler(service ExternalApplications) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		apps, err := service.GetAllExternalApplications()
+		apps, err := service.GetAllExternalApplications(r.Context())
 		if err != nil {
 			slog.Error("Error getting all external applications", slog.String("error", err.Error()))
 			http.Error(w, fmt.Sprintf("Failed to get external applications: %v", err), http.StatusInternalServerError)
@@ -269,6 +286,7 @@ func GetAllExternalApplicationsHandler(service ExternalApplications) http.Handle
 // responses:
 // 200: UpdateExternalApplicationResponse
 // 400: description:Bad request - invalid UUID format or request body
+// 403: description:Forbidden - outside the caller's permission scopes
 // 404: description:External application not found
 // 500: description:Internal server error
 func UpdateExternalApplicationHandler(service ExternalApplications) http.HandlerFunc {
@@ -289,11 +307,19 @@ func UpdateExternalApplicationHandler(service ExternalApplications) http.Handler
 			return
 		}
 
-		app, err := service.UpdateExternalApplication(id, req)
+		app, err := service.UpdateExternalApplication(r.Context(), id, req)
 		if err != nil {
 			slog.Error("Error updating external application",
 				slog.String("id", id.String()),
 				slog.String("error", err.Error()))
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, ErrExternalApplicationNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			http.Error(w, fmt.Sprintf("Failed to update external application: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -312,6 +338,7 @@ func UpdateExternalApplicationHandler(service ExternalApplications) http.Handler
 // responses:
 // 204: description:External application deleted successfully
 // 400: description:Bad request - invalid UUID format
+// 403: description:Forbidden - outside the caller's permission scopes
 // 404: description:External application not found
 // 500: description:Internal server error
 func DeleteExternalApplicationByIdHandler(service ExternalApplications) http.HandlerFunc {
@@ -325,11 +352,19 @@ func DeleteExternalApplicationByIdHandler(service ExternalApplications) http.Han
 			return
 		}
 
-		err = service.DeleteExternalApplicationById(id)
+		err = service.DeleteExternalApplicationById(r.Context(), id)
 		if err != nil {
 			slog.Error("Error deleting external application by ID",
 				slog.String("id", id.String()),
 				slog.String("error", err.Error()))
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, ErrExternalApplicationNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			http.Error(w, fmt.Sprintf("Failed to delete external application: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -346,6 +381,7 @@ func DeleteExternalApplicationByIdHandler(service ExternalApplications) http.Han
 // - bearer:
 // responses:
 // 204: description:External application deleted successfully
+// 403: description:Forbidden - outside the caller's permission scopes
 // 404: description:External application not found
 // 500: description:Internal server error
 func DeleteExternalApplicationByNameHandler(service ExternalApplications) http.HandlerFunc {
@@ -357,11 +393,19 @@ func DeleteExternalApplicationByNameHandler(service ExternalApplications) http.H
 			return
 		}
 
-		err := service.DeleteExternalApplicationByName(name)
+		err := service.DeleteExternalApplicationByName(r.Context(), name)
 		if err != nil {
 			slog.Error("Error deleting external application by name",
 				slog.String("name", name),
 				slog.String("error", err.Error()))
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, ErrExternalApplicationNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			http.Error(w, fmt.Sprintf("Failed to delete external application: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -389,11 +433,15 @@ func GetExternalApplicationIdByNameHandler(service ExternalApplications) http.Ha
 			return
 		}
 
-		id, err := service.GetExternalApplicationIdByName(name)
+		id, err := service.GetExternalApplicationIdByName(r.Context(), name)
 		if err != nil {
 			slog.Error("Error getting external application ID by name",
 				slog.String("name", name),
 				slog.String("error", err.Error()))
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
 			http.Error(w, fmt.Sprintf("External application not found: %v", err), http.StatusNotFound)
 			return
 		}
@@ -425,11 +473,15 @@ func GetExternalApplicationNameByIdHandler(service ExternalApplications) http.Ha
 			return
 		}
 
-		name, err := service.GetExternalApplicationNameById(id)
+		name, err := service.GetExternalApplicationNameById(r.Context(), id)
 		if err != nil {
 			slog.Error("Error getting external application name by ID",
 				slog.String("id", id.String()),
 				slog.String("error", err.Error()))
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
 			http.Error(w, fmt.Sprintf("External application not found: %v", err), http.StatusNotFound)
 			return
 		}
@@ -445,7 +497,7 @@ func ExternalApplicationsHandler(service ExternalApplications, authService autha
 		switch r.Method {
 		case http.MethodGet:
 			// Require permission for reading external applications
-			authapi.AuthMiddlewareRequirePermission(authService, "ReadExternalApplications", GetAllExternalApplicationsHandler(service)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadExternalApplications", "", GetAllExternalApplicationsHandler(service)).ServeHTTP(w, r)
 		case http.MethodPost:
 			// Require permission for creating external applications
 			authapi.AuthMiddlewareRequirePermission(authService, "CreateExternalApplication", CreateExternalApplicationHandler(service)).ServeHTTP(w, r)
@@ -461,13 +513,13 @@ func ExternalApplicationByIDHandler(service ExternalApplications, authService au
 		switch r.Method {
 		case http.MethodGet:
 			// Require permission for reading external applications
-			authapi.AuthMiddlewareRequirePermission(authService, "ReadExternalApplications", GetExternalApplicationByIdHandler(service)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadExternalApplications", "", GetExternalApplicationByIdHandler(service)).ServeHTTP(w, r)
 		case http.MethodPut:
 			// Require permission for updating external applications
-			authapi.AuthMiddlewareRequirePermission(authService, "UpdateExternalApplication", UpdateExternalApplicationHandler(service)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "UpdateExternalApplication", "", UpdateExternalApplicationHandler(service)).ServeHTTP(w, r)
 		case http.MethodDelete:
 			// Require permission for deleting external applications
-			authapi.AuthMiddlewareRequirePermission(authService, "DeleteExternalApplication", DeleteExternalApplicationByIdHandler(service)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "DeleteExternalApplication", "", DeleteExternalApplicationByIdHandler(service)).ServeHTTP(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
@@ -480,10 +532,10 @@ func ExternalApplicationByNameHandler(service ExternalApplications, authService
 		switch r.Method {
 		case http.MethodGet:
 			// Require permission for reading external applications
-			authapi.AuthMiddlewareRequirePermission(authService, "ReadExternalApplications", GetExternalApplicationByNameHandler(service)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "ReadExternalApplications", "", GetExternalApplicationByNameHandler(service)).ServeHTTP(w, r)
 		case http.MethodDelete:
 			// Require permission for deleting external applications
-			authapi.AuthMiddlewareRequirePermission(authService, "DeleteExternalApplication", DeleteExternalApplicationByNameHandler(service)).ServeHTTP(w, r)
+			authapi.AuthMiddlewareRequireResourcePermission(authService, "DeleteExternalApplication", "", DeleteExternalApplicationByNameHandler(service)).ServeHTTP(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
@@ -2,9 +2,11 @@ package host_servers
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 
+	"github.com/babbage88/go-infra/services/organizations"
 	"github.com/google/uuid"
 )
 
@@ -32,6 +34,10 @@ func CreateHostServerHandler(provider HostServerProvider) http.HandlerFunc {
 		}
 
 		server, err := provider.CreateHostServer(r.Context(), req)
+		if errors.Is(err, organizations.ErrNoActiveOrganization) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			slog.Error("Failed to create host server", slog.String("error", err.Error()))
 			http.Error(w, "Failed to create host server", http.StatusInternalServerError)
@@ -234,6 +240,10 @@ func DeleteHostServerHandler(provider HostServerProvider) http.HandlerFunc {
 		}
 
 		err = provider.DeleteHostServer(r.Context(), id)
+		if errors.Is(err, ErrHostServerNotFound) {
+			http.Error(w, "Host server not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			slog.Error("Failed to delete host server", slog.String("error", err.Error()))
 			http.Error(w, "Failed to delete host server", http.StatusInternalServerError)
@@ -332,6 +342,10 @@ func CreateHostServerTypeMappingHandler(provider HostServerProvider) http.Handle
 			return
 		}
 		if err := provider.CreateHostServerTypeMapping(r.Context(), req.HostServerId, req.HostServerTypeId); err != nil {
+			if errors.Is(err, ErrHostServerNotFound) {
+				http.Error(w, "Host server not found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to create mapping: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -362,6 +376,10 @@ func CreatePlatformTypeMappingHandler(provider HostServerProvider) http.HandlerF
 			return
 		}
 		if err := provider.CreatePlatformTypeMapping(r.Context(), req.HostServerId, req.PlatformTypeId, req.HostServerTypeId); err != nil {
+			if errors.Is(err, ErrHostServerNotFound) {
+				http.Error(w, "Host server not found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to create mapping: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -2,17 +2,25 @@ package host_servers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/netip"
 	"time"
 
 	"github.com/babbage88/go-infra/api/authapi"
 	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/babbage88/go-infra/services/user_secrets"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// ErrHostServerNotFound is returned for host servers that do not exist or belong to another
+// organization.
+var ErrHostServerNotFound = errors.New("host server not found")
+
 // HostServerProviderImpl implements the HostServerProvider interface using PostgreSQL
 type HostServerProviderImpl struct {
 	db             *infra_db_pg.Queries
@@ -32,12 +40,25 @@ func (p *HostServerProviderImpl) CreateHostServer(ctx context.Context, req Creat
 		if err != nil {
 			return nil, fmt.Errorf("failed to get user ID from context: %w", err)
 		}
-		secret, err := p.secretProvider.RetrieveSecret(*req.SudoPasswordTokenID)
-		if err != nil || secret.ExternalAuthToken.UserID != userId {
+		// The caller must own the sudo password or hold a grant to use it.
+		if _, err := p.secretProvider.RetrieveSecretForUse(ctx, userId, *req.SudoPasswordTokenID); err != nil {
 			return nil, fmt.Errorf("invalid sudo secret_id provided")
 		}
 	}
 
+	if err := organizations.RequireActiveOrg(ctx); err != nil {
+		return nil, err
+	}
+	if req.SSHKeyID != nil {
+		allowed, err := organizations.AllowsResource(ctx, organizations.ResourceSshKey, *req.SSHKeyID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("invalid ssh_key_id provided")
+		}
+	}
+
 	params := infra_db_pg.CreateHostServerParams{
 		Hostname:  req.Hostname,
 		IpAddress: req.IPAddress,
@@ -47,6 +68,10 @@ func (p *HostServerProviderImpl) CreateHostServer(ctx context.Context, req Creat
 	if err != nil {
 		return nil, fmt.Errorf("failed to create host server: %w", err)
 	}
+	if err := organizations.AssignToActiveOrg(ctx, organizations.ResourceHostServer, server.ID); err != nil {
+		_ = p.db.DeleteHostServer(ctx, server.ID)
+		return nil, err
+	}
 
 	userId, err := authapi.GetUserIDFromContext(ctx)
 	if err != nil {
@@ -132,7 +157,7 @@ func (p *HostServerProviderImpl) CreateHostServer(ctx context.Context, req Creat
 		return nil, fmt.Errorf("failed to get host server types and platforms: %w", err)
 	}
 
-	return &HostServer{
+	created := &HostServer{
 		ID:                   server.ID,
 		Hostname:             server.Hostname,
 		IPAddress:            server.IpAddress,
@@ -143,11 +168,17 @@ func (p *HostServerProviderImpl) CreateHostServer(ctx context.Context, req Creat
 		PlatformTypes:        platformTypes,
 		CreatedAt:            server.CreatedAt.Time,
 		LastModified:         server.LastModified.Time,
-	}, nil
+	}
+	recordHostServerChange(ctx, audit_log.ActionCreate, server.ID, nil, created)
+	return created, nil
 }
 
-// GetHostServer retrieves a host server by ID
+// GetHostServer retrieves a host server by ID. Host servers of another organization are
+// returned as nil, like a missing one.
 func (p *HostServerProviderImpl) GetHostServer(ctx context.Context, id uuid.UUID) (*HostServer, error) {
+	if allowed, err := organizations.AllowsResource(ctx, organizations.ResourceHostServer, id); err != nil || !allowed {
+		return nil, err
+	}
 	server, err := p.db.GetHostServerById(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get host server: %w", err)
@@ -193,6 +224,9 @@ func (p *HostServerProviderImpl) GetHostServerByHostname(ctx context.Context, ho
 	if err != nil {
 		return nil, fmt.Errorf("failed to get host server by hostname: %w", err)
 	}
+	if allowed, err := organizations.AllowsResource(ctx, organizations.ResourceHostServer, server.ID); err != nil || !allowed {
+		return nil, err
+	}
 
 	// Get SSH key mapping if exists
 	var username *string
@@ -226,6 +260,9 @@ func (p *HostServerProviderImpl) GetHostServerByIP(ctx context.Context, ip netip
 	if err != nil {
 		return nil, fmt.Errorf("failed to get host server by IP: %w", err)
 	}
+	if allowed, err := organizations.AllowsResource(ctx, organizations.ResourceHostServer, server.ID); err != nil || !allowed {
+		return nil, err
+	}
 
 	// Get SSH key mapping if exists
 	var username *string
@@ -253,15 +290,37 @@ func (p *HostServerProviderImpl) GetHostServerByIP(ctx context.Context, ip netip
 	}, nil
 }
 
-// GetAllHostServers retrieves all host servers
+// GetAllHostServers retrieves the host servers of the caller's active organization, limited
+// to those within the resource scopes of the caller's permission when the request carries
+// a grant.
 func (p *HostServerProviderImpl) GetAllHostServers(ctx context.Context) ([]HostServer, error) {
 	servers, err := p.db.GetAllHostServers(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all host servers: %w", err)
 	}
 
-	result := make([]HostServer, 0, len(servers))
+	ids := make([]uuid.UUID, len(servers))
+	for i, server := range servers {
+		ids[i] = server.ID
+	}
+	ids, err = organizations.FilterIds(ctx, organizations.ResourceHostServer, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply organization: %w", err)
+	}
+	allowedIds, err := resource_policy.FilterHostServerIds(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply permission scopes: %w", err)
+	}
+	allowed := make(map[uuid.UUID]bool, len(allowedIds))
+	for _, id := range allowedIds {
+		allowed[id] = true
+	}
+
+	result := make([]HostServer, 0, len(allowedIds))
 	for _, server := range servers {
+		if !allowed[server.ID] {
+			continue
+		}
 		// Get SSH key mapping if exists
 		var username *string
 		var sshKeyID *uuid.UUID
@@ -306,15 +365,15 @@ func (p *HostServerProviderImpl) UpdateHostServer(ctx context.Context, id uuid.U
 		if err != nil {
 			return nil, fmt.Errorf("failed to get user ID from context: %w", err)
 		}
-		secret, err := p.secretProvider.RetrieveSecret(*req.SudoPasswordTokenID)
-		if err != nil || secret.ExternalAuthToken.UserID != userId {
+		// The caller must own the sudo password or hold a grant to use it.
+		if _, err := p.secretProvider.RetrieveSecretForUse(ctx, userId, *req.SudoPasswordTokenID); err != nil {
 			return nil, fmt.Errorf("invalid sudo secret_id provided")
 		}
 	}
 
 	// Get current server to merge with updates
 	current, err := p.GetHostServer(ctx, id)
-	if err != nil {
+	if err != nil || current == nil {
 		return nil, err
 	}
 
@@ -400,26 +459,58 @@ func (p *HostServerProviderImpl) UpdateHostServer(ctx context.Context, id uuid.U
 		}
 
 		// Create new token
-		_, err = p.secretProvider.StoreSecret(uuid.New().String(), userId, id, time.Now().Add(24*time.Hour))
+		_, err = p.secretProvider.StoreSecret(ctx, uuid.New().String(), userId, id, time.Now().Add(24*time.Hour))
 		if err != nil {
 			return nil, fmt.Errorf("failed to update sudo password token: %w", err)
 		}
 	}
 
-	return p.GetHostServer(ctx, id)
+	updated, err := p.GetHostServer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	recordHostServerChange(ctx, audit_log.ActionUpdate, id, current, updated)
+	return updated, nil
 }
 
 // DeleteHostServer deletes a host server
 func (p *HostServerProviderImpl) DeleteHostServer(ctx context.Context, id uuid.UUID) error {
-	err := p.db.DeleteHostServer(ctx, id)
+	before, err := p.GetHostServer(ctx, id)
+	if err == nil && before == nil {
+		return ErrHostServerNotFound
+	}
+	err = p.db.DeleteHostServer(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete host server: %w", err)
 	}
+	recordHostServerChange(ctx, audit_log.ActionDelete, id, before, nil)
 	return nil
 }
 
+// recordHostServerChange audits a host server change with the before and after state.
+func recordHostServerChange(ctx context.Context, action string, id uuid.UUID, before, after *HostServer) {
+	event := audit_log.Event{
+		Action:       action,
+		ResourceType: audit_log.ResourceHostServer,
+		ResourceId:   id.String(),
+	}
+	// Assign only non-nil pointers so a missing side stays a nil interface.
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
+
 // CreateHostServerTypeMapping creates a mapping between a host server and a host server type
 func (p *HostServerProviderImpl) CreateHostServerTypeMapping(ctx context.Context, hostServerID, hostServerTypeID uuid.UUID) error {
+	if allowed, err := organizations.AllowsResource(ctx, organizations.ResourceHostServer, hostServerID); err != nil {
+		return err
+	} else if !allowed {
+		return ErrHostServerNotFound
+	}
 	_, err := p.db.CreateHostServerTypeMapping(ctx, infra_db_pg.CreateHostServerTypeMappingParams{
 		HostServerID:     hostServerID,
 		HostServerTypeID: hostServerTypeID,
@@ -429,6 +520,11 @@ func (p *HostServerProviderImpl) CreateHostServerTypeMapping(ctx context.Context
 
 // CreatePlatformTypeMapping creates a mapping between a host server, platform type, and host server type
 func (p *HostServerProviderImpl) CreatePlatformTypeMapping(ctx context.Context, hostServerID, platformTypeID, hostServerTypeID uuid.UUID) error {
+	if allowed, err := organizations.AllowsResource(ctx, organizations.ResourceHostServer, hostServerID); err != nil {
+		return err
+	} else if !allowed {
+		return ErrHostServerNotFound
+	}
 	_, err := p.db.CreatePlatformTypeMapping(ctx, infra_db_pg.CreatePlatformTypeMappingParams{
 		HostServerID:     hostServerID,
 		PlatformTypeID:   platformTypeID,
@@ -74,7 +74,7 @@ type HostServerProvider interface {
 	// GetHostServerByIP retrieves a host server by IP address
 	GetHostServerByIP(ctx context.Context, ip netip.Addr) (*HostServer, error)
 
-	// GetAllHostServers retrieves all host servers
+	// GetAllHostServers retrieves all host servers the caller's permission scopes allow
 	GetAllHostServers(ctx context.Context) ([]HostServer, error)
 
 	// UpdateHostServer updates an existing host server
@@ -0,0 +1,197 @@
+package login_throttle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeUsername = "username"
+	ScopeClientIp = "ip"
+
+	EventLocked   = "locked"
+	EventUnlocked = "unlocked"
+
+	// caps the backoff exponent so the shift cannot overflow
+	maxBackoffDoublings = 20
+)
+
+// Policy controls when a key is locked. Once MaxFailures is reached within Window every
+// further failure doubles the lockout, starting at BaseLockout and capped at MaxLockout.
+type Policy struct {
+	MaxFailures int64
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+type LockoutEvent struct {
+	Scope       string
+	Key         string
+	EventType   string
+	Failures    int64
+	LockedUntil time.Time
+	ActorUserId uuid.UUID
+}
+
+// LoginThrottle implements authapi.LoginThrottler with separate policies for usernames
+// and client IPs.
+type LoginThrottle struct {
+	Store      AttemptStore
+	Auditor    LockoutAuditor
+	UserPolicy Policy
+	IpPolicy   Policy
+}
+
+func NewLoginThrottle(store AttemptStore, auditor LockoutAuditor, userPolicy Policy, ipPolicy Policy) *LoginThrottle {
+	return &LoginThrottle{Store: store, Auditor: auditor, UserPolicy: userPolicy, IpPolicy: ipPolicy}
+}
+
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(v)
+	if err != nil || parsed <= 0 {
+		slog.Warn("Invalid login throttle setting, using default", slog.String("name", name), slog.String("value", v))
+		return def
+	}
+	return parsed
+}
+
+// PoliciesFromEnv reads the username and client IP policies. Both share the window and
+// lockout durations, the IP limit is higher since many users can sit behind one NAT.
+func PoliciesFromEnv() (userPolicy Policy, ipPolicy Policy) {
+	window := time.Duration(envInt("LOGIN_FAILURE_WINDOW_SEC", 900)) * time.Second
+	base := time.Duration(envInt("LOGIN_LOCKOUT_BASE_SEC", 60)) * time.Second
+	maxLockout := time.Duration(envInt("LOGIN_LOCKOUT_MAX_SEC", 3600)) * time.Second
+
+	userPolicy = Policy{
+		MaxFailures: int64(envInt("LOGIN_MAX_FAILURES_PER_USER", 5)),
+		Window:      window,
+		BaseLockout: base,
+		MaxLockout:  maxLockout,
+	}
+	ipPolicy = Policy{
+		MaxFailures: int64(envInt("LOGIN_MAX_FAILURES_PER_IP", 20)),
+		Window:      window,
+		BaseLockout: base,
+		MaxLockout:  maxLockout,
+	}
+	return userPolicy, ipPolicy
+}
+
+// LockoutDuration returns how long to lock after the given number of failures, zero
+// while below the threshold.
+func (p Policy) LockoutDuration(failures int64) time.Duration {
+	if p.MaxFailures <= 0 || failures < p.MaxFailures {
+		return 0
+	}
+	doublings := failures - p.MaxFailures
+	if doublings > maxBackoffDoublings {
+		doublings = maxBackoffDoublings
+	}
+	lockout := p.BaseLockout << doublings
+	if p.MaxLockout > 0 && (lockout > p.MaxLockout || lockout <= 0) {
+		lockout = p.MaxLockout
+	}
+	return lockout
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+type scopedKey struct {
+	scope  string
+	key    string
+	policy Policy
+}
+
+func (t *LoginThrottle) keys(username string, clientIp string) []scopedKey {
+	var keys []scopedKey
+	if u := normalizeUsername(username); u != "" {
+		keys = append(keys, scopedKey{scope: ScopeUsername, key: u, policy: t.UserPolicy})
+	}
+	if clientIp != "" {
+		keys = append(keys, scopedKey{scope: ScopeClientIp, key: clientIp, policy: t.IpPolicy})
+	}
+	return keys
+}
+
+func (t *LoginThrottle) CheckLogin(ctx context.Context, username string, clientIp string) (time.Duration, error) {
+	var retryAfter time.Duration
+	now := time.Now()
+	for _, k := range t.keys(username, clientIp) {
+		until, err := t.Store.GetLockout(ctx, k.scope, k.key)
+		if err != nil {
+			return 0, fmt.Errorf("error reading %s lockout: %w", k.scope, err)
+		}
+		if wait := until.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	return retryAfter, nil
+}
+
+func (t *LoginThrottle) RecordLoginFailure(ctx context.Context, username string, clientIp string) error {
+	for _, k := range t.keys(username, clientIp) {
+		failures, err := t.Store.IncrementFailures(ctx, k.scope, k.key, k.policy.Window)
+		if err != nil {
+			return fmt.Errorf("error recording %s login failure: %w", k.scope, err)
+		}
+
+		lockout := k.policy.LockoutDuration(failures)
+		if lockout == 0 {
+			continue
+		}
+
+		until := time.Now().Add(lockout)
+		if err := t.Store.SetLockout(ctx, k.scope, k.key, until); err != nil {
+			return fmt.Errorf("error setting %s lockout: %w", k.scope, err)
+		}
+		slog.Warn("Login locked after repeated failures",
+			slog.String("scope", k.scope), slog.String("key", k.key),
+			slog.Int64("failures", failures), slog.Time("lockedUntil", until))
+		t.audit(ctx, LockoutEvent{Scope: k.scope, Key: k.key, EventType: EventLocked, Failures: failures, LockedUntil: until})
+	}
+	return nil
+}
+
+// RecordLoginSuccess clears the username counter. The IP counter is left to expire so a
+// single valid account cannot be used to reset guessing against others.
+func (t *LoginThrottle) RecordLoginSuccess(ctx context.Context, username string, clientIp string) error {
+	u := normalizeUsername(username)
+	if u == "" {
+		return nil
+	}
+	return t.Store.Reset(ctx, ScopeUsername, u)
+}
+
+// UnlockUser clears the lockout and failure counter of a username.
+func (t *LoginThrottle) UnlockUser(ctx context.Context, username string, actorUserId uuid.UUID) error {
+	u := normalizeUsername(username)
+	if err := t.Store.Reset(ctx, ScopeUsername, u); err != nil {
+		return fmt.Errorf("error unlocking user: %w", err)
+	}
+	slog.Info("Login lockout cleared", slog.String("username", u), slog.String("actorUserId", actorUserId.String()))
+	t.audit(ctx, LockoutEvent{Scope: ScopeUsername, Key: u, EventType: EventUnlocked, ActorUserId: actorUserId})
+	return nil
+}
+
+func (t *LoginThrottle) audit(ctx context.Context, event LockoutEvent) {
+	if t.Auditor == nil {
+		return
+	}
+	if err := t.Auditor.RecordLockoutEvent(ctx, event); err != nil {
+		slog.Error("Error recording lockout audit event", slog.String("error", err.Error()))
+	}
+}
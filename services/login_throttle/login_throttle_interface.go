@@ -0,0 +1,20 @@
+package login_throttle
+
+import (
+	"context"
+	"time"
+)
+
+// AttemptStore holds failure counters and lockouts. Implementations must be safe to
+// share between replicas.
+type AttemptStore interface {
+	GetLockout(ctx context.Context, scope string, key string) (time.Time, error)
+	IncrementFailures(ctx context.Context, scope string, key string, window time.Duration) (int64, error)
+	SetLockout(ctx context.Context, scope string, key string, until time.Time) error
+	Reset(ctx context.Context, scope string, key string) error
+}
+
+// LockoutAuditor records lockouts and admin unlocks.
+type LockoutAuditor interface {
+	RecordLockoutEvent(ctx context.Context, event LockoutEvent) error
+}
@@ -0,0 +1,104 @@
+package login_throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memoryAttemptStore struct {
+	failures map[string]int64
+	lockouts map[string]time.Time
+}
+
+func newMemoryAttemptStore() *memoryAttemptStore {
+	return &memoryAttemptStore{failures: map[string]int64{}, lockouts: map[string]time.Time{}}
+}
+
+func (m *memoryAttemptStore) GetLockout(ctx context.Context, scope string, key string) (time.Time, error) {
+	return m.lockouts[scope+":"+key], nil
+}
+
+func (m *memoryAttemptStore) IncrementFailures(ctx context.Context, scope string, key string, window time.Duration) (int64, error) {
+	m.failures[scope+":"+key]++
+	return m.failures[scope+":"+key], nil
+}
+
+func (m *memoryAttemptStore) SetLockout(ctx context.Context, scope string, key string, until time.Time) error {
+	m.lockouts[scope+":"+key] = until
+	return nil
+}
+
+func (m *memoryAttemptStore) Reset(ctx context.Context, scope string, key string) error {
+	delete(m.failures, scope+":"+key)
+	delete(m.lockouts, scope+":"+key)
+	return nil
+}
+
+type recordingAuditor struct {
+	events []LockoutEvent
+}
+
+func (r *recordingAuditor) RecordLockoutEvent(ctx context.Context, event LockoutEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestLockoutDurationBacksOffExponentially(t *testing.T) {
+	p := Policy{MaxFailures: 3, BaseLockout: time.Minute, MaxLockout: 10 * time.Minute}
+	cases := map[int64]time.Duration{
+		2:   0,
+		3:   time.Minute,
+		4:   2 * time.Minute,
+		5:   4 * time.Minute,
+		6:   8 * time.Minute,
+		7:   10 * time.Minute,
+		500: 10 * time.Minute,
+	}
+	for failures, want := range cases {
+		if got := p.LockoutDuration(failures); got != want {
+			t.Errorf("LockoutDuration(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestLoginThrottleLocksAndUnlocksUser(t *testing.T) {
+	ctx := context.Background()
+	auditor := &recordingAuditor{}
+	policy := Policy{MaxFailures: 3, Window: time.Hour, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	throttle := NewLoginThrottle(newMemoryAttemptStore(), auditor, policy, Policy{MaxFailures: 100, Window: time.Hour, BaseLockout: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if err := throttle.RecordLoginFailure(ctx, "Alice", "10.0.0.1"); err != nil {
+			t.Fatalf("error recording failure: %v", err)
+		}
+	}
+	if wait, _ := throttle.CheckLogin(ctx, "alice", "10.0.0.2"); wait != 0 {
+		t.Fatalf("expected login to be allowed below the threshold, got wait %s", wait)
+	}
+
+	throttle.RecordLoginFailure(ctx, "alice", "10.0.0.1")
+	wait, err := throttle.CheckLogin(ctx, "ALICE", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("error checking login: %v", err)
+	}
+	if wait <= 0 || wait > time.Minute {
+		t.Fatalf("expected a lockout of up to one minute from any address, got %s", wait)
+	}
+	if len(auditor.events) != 1 || auditor.events[0].EventType != EventLocked {
+		t.Fatalf("expected one locked audit event, got %+v", auditor.events)
+	}
+
+	actor := uuid.New()
+	if err := throttle.UnlockUser(ctx, "alice", actor); err != nil {
+		t.Fatalf("error unlocking user: %v", err)
+	}
+	if wait, _ := throttle.CheckLogin(ctx, "alice", "10.0.0.2"); wait != 0 {
+		t.Fatalf("expected unlocked user to be allowed, got wait %s", wait)
+	}
+	if last := auditor.events[len(auditor.events)-1]; last.EventType != EventUnlocked || last.ActorUserId != actor {
+		t.Fatalf("expected unlocked audit event by actor, got %+v", last)
+	}
+}
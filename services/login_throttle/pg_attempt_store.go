@@ -0,0 +1,100 @@
+package login_throttle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PgAttemptStore struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgAttemptStore(dbConn *pgxpool.Pool) *PgAttemptStore {
+	return &PgAttemptStore{DbConn: dbConn}
+}
+
+func (p *PgAttemptStore) GetLockout(ctx context.Context, scope string, key string) (time.Time, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	lockedUntil, err := qry.GetLoginLockout(ctx, infra_db_pg.GetLoginLockoutParams{Scope: scope, LockKey: key})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+func (p *PgAttemptStore) IncrementFailures(ctx context.Context, scope string, key string, window time.Duration) (int64, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	failures, err := qry.IncrementLoginFailures(ctx, infra_db_pg.IncrementLoginFailuresParams{
+		Scope:         scope,
+		LockKey:       key,
+		WindowSeconds: int64(window / time.Second),
+	})
+	return int64(failures), err
+}
+
+func (p *PgAttemptStore) SetLockout(ctx context.Context, scope string, key string, until time.Time) error {
+	qry := infra_db_pg.New(p.DbConn)
+	return qry.SetLoginLockout(ctx, infra_db_pg.SetLoginLockoutParams{
+		Scope:       scope,
+		LockKey:     key,
+		LockedUntil: pgtype.Timestamptz{Time: until, Valid: true},
+	})
+}
+
+func (p *PgAttemptStore) Reset(ctx context.Context, scope string, key string) error {
+	qry := infra_db_pg.New(p.DbConn)
+	return qry.ResetLoginAttempts(ctx, infra_db_pg.ResetLoginAttemptsParams{Scope: scope, LockKey: key})
+}
+
+// StartCleanup removes counters whose last failure is older than retention and whose
+// lockout has passed.
+func (p *PgAttemptStore) StartCleanup(ctx context.Context, interval time.Duration, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				qry := infra_db_pg.New(p.DbConn)
+				cutoff := pgtype.Timestamptz{Time: time.Now().Add(-retention), Valid: true}
+				if err := qry.DeleteStaleLoginAttempts(ctx, cutoff); err != nil {
+					slog.Error("Error deleting stale login attempts", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// PgLockoutAuditor writes lockout events to login_lockout_events.
+type PgLockoutAuditor struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgLockoutAuditor(dbConn *pgxpool.Pool) *PgLockoutAuditor {
+	return &PgLockoutAuditor{DbConn: dbConn}
+}
+
+func (p *PgLockoutAuditor) RecordLockoutEvent(ctx context.Context, event LockoutEvent) error {
+	qry := infra_db_pg.New(p.DbConn)
+	return qry.InsertLoginLockoutEvent(ctx, infra_db_pg.InsertLoginLockoutEventParams{
+		Scope:       event.Scope,
+		LockKey:     event.Key,
+		EventType:   event.EventType,
+		Failures:    int32(event.Failures),
+		LockedUntil: pgtype.Timestamptz{Time: event.LockedUntil, Valid: !event.LockedUntil.IsZero()},
+		ActorUserID: pgtype.UUID{Bytes: event.ActorUserId, Valid: event.ActorUserId != uuid.Nil},
+	})
+}
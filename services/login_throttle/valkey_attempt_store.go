@@ -0,0 +1,70 @@
+package login_throttle
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	valkey "github.com/valkey-io/valkey-go"
+)
+
+// ValkeyAttemptStore keeps counters in Valkey. Failure counters expire after the policy
+// window, lockouts when they end, so no cleanup job is needed.
+type ValkeyAttemptStore struct {
+	client valkey.Client
+}
+
+func NewValkeyAttemptStore(client valkey.Client) *ValkeyAttemptStore {
+	return &ValkeyAttemptStore{client: client}
+}
+
+func (v *ValkeyAttemptStore) failuresKey(scope string, key string) string {
+	return fmt.Sprintf("login_throttle:failures:%s:%s", scope, key)
+}
+
+func (v *ValkeyAttemptStore) lockoutKey(scope string, key string) string {
+	return fmt.Sprintf("login_throttle:lockout:%s:%s", scope, key)
+}
+
+func (v *ValkeyAttemptStore) GetLockout(ctx context.Context, scope string, key string) (time.Time, error) {
+	val, err := v.client.Do(ctx, v.client.B().Get().Key(v.lockoutKey(scope, key)).Build()).ToString()
+	if err != nil {
+		if valkey.IsValkeyNil(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid lockout value: %w", err)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (v *ValkeyAttemptStore) IncrementFailures(ctx context.Context, scope string, key string, window time.Duration) (int64, error) {
+	k := v.failuresKey(scope, key)
+	results := v.client.DoMulti(ctx,
+		v.client.B().Incr().Key(k).Build(),
+		v.client.B().Pexpire().Key(k).Milliseconds(window.Milliseconds()).Build(),
+	)
+	for _, res := range results[1:] {
+		if err := res.Error(); err != nil {
+			return 0, err
+		}
+	}
+	return results[0].AsInt64()
+}
+
+func (v *ValkeyAttemptStore) SetLockout(ctx context.Context, scope string, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return v.client.Do(ctx, v.client.B().Set().Key(v.lockoutKey(scope, key)).
+		Value(strconv.FormatInt(until.UnixMilli(), 10)).Px(ttl).Build()).Error()
+}
+
+func (v *ValkeyAttemptStore) Reset(ctx context.Context, scope string, key string) error {
+	return v.client.Do(ctx, v.client.B().Del().Key(v.failuresKey(scope, key), v.lockoutKey(scope, key)).Build()).Error()
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer sends plain text mail. SmtpMailer is used in production, FileMailer and
+// LogMailer for development and tests.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func (m Message) validate() error {
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	if m.To == "" {
+		return errors.New("mail recipient is required")
+	}
+	return nil
+}
+
+// NewMailerFromEnv selects the implementation with MAILER: smtp, file or log (default).
+func NewMailerFromEnv() (Mailer, error) {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return NewSmtpMailerFromEnv()
+	case "file":
+		path := os.Getenv("MAILER_FILE_PATH")
+		if path == "" {
+			return nil, errors.New("MAILER_FILE_PATH is required for the file mailer")
+		}
+		return NewFileMailer(path), nil
+	case "", "log":
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", os.Getenv("MAILER"))
+	}
+}
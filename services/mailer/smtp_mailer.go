@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// SmtpMailer sends mail through an SMTP relay. STARTTLS is used when the server offers
+// it, ImplicitTls connects with TLS from the start as on port 465.
+type SmtpMailer struct {
+	Host        string
+	Port        string
+	Username    string
+	Password    string
+	From        string
+	ImplicitTls bool
+}
+
+func NewSmtpMailerFromEnv() (*SmtpMailer, error) {
+	m := &SmtpMailer{
+		Host:        os.Getenv("SMTP_HOST"),
+		Port:        os.Getenv("SMTP_PORT"),
+		Username:    os.Getenv("SMTP_USERNAME"),
+		Password:    os.Getenv("SMTP_PASSWORD"),
+		From:        os.Getenv("SMTP_FROM"),
+		ImplicitTls: strings.EqualFold(os.Getenv("SMTP_IMPLICIT_TLS"), "true"),
+	}
+	if m.Port == "" {
+		m.Port = "587"
+	}
+	if m.Host == "" || m.From == "" {
+		return nil, errors.New("SMTP_HOST and SMTP_FROM are required for the smtp mailer")
+	}
+	return m, nil
+}
+
+func (m *SmtpMailer) buildMessage(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func (m *SmtpMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(m.Host, m.Port)
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	if !m.ImplicitTls {
+		if err := smtp.SendMail(addr, auth, m.From, []string{msg.To}, m.buildMessage(msg)); err != nil {
+			return fmt.Errorf("error sending mail: %w", err)
+		}
+		return nil
+	}
+
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: m.Host, MinVersion: tls.VersionTLS12}}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to smtp server: %w", err)
+	}
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error creating smtp client: %w", err)
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("error authenticating to smtp server: %w", err)
+		}
+	}
+	if err := client.Mail(m.From); err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	if _, err := w.Write(m.buildMessage(msg)); err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	return client.Quit()
+}
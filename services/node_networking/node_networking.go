@@ -65,9 +65,12 @@ func (n *NetworkPingerImpl) Ping(target string) PingResult {
 }
 
 // PingHostServerNode pings a managed HostServer by its ID
-func (n *NetworkPingerImpl) PingHostServerNode(hostServerNodeID uuid.UUID) PingResult {
+func (n *NetworkPingerImpl) PingHostServerNode(ctx context.Context, hostServerNodeID uuid.UUID) PingResult {
 	// Get the host server information
-	hostServer, err := n.hostServerProvider.GetHostServer(context.Background(), hostServerNodeID)
+	hostServer, err := n.hostServerProvider.GetHostServer(ctx, hostServerNodeID)
+	if err == nil && hostServer == nil {
+		err = host_servers.ErrHostServerNotFound
+	}
 	if err != nil {
 		return PingResult{
 			TargetHostId:   hostServerNodeID,
@@ -91,9 +94,12 @@ func (n *NetworkPingerImpl) PingHostServerNode(hostServerNodeID uuid.UUID) PingR
 }
 
 // ProbeTCPPortByHostId probes a TCP port on a managed HostServer by its ID
-func (n *NetworkPingerImpl) ProbeTCPPortByHostId(targetHostId uuid.UUID, port uint16) NetworkProbeResult {
+func (n *NetworkPingerImpl) ProbeTCPPortByHostId(ctx context.Context, targetHostId uuid.UUID, port uint16) NetworkProbeResult {
 	// Get the host server information
-	hostServer, err := n.hostServerProvider.GetHostServer(context.Background(), targetHostId)
+	hostServer, err := n.hostServerProvider.GetHostServer(ctx, targetHostId)
+	if err == nil && hostServer == nil {
+		err = host_servers.ErrHostServerNotFound
+	}
 	if err != nil {
 		return NetworkProbeResult{
 			TargetHostId:   targetHostId,
@@ -118,9 +124,12 @@ func (n *NetworkPingerImpl) ProbeTCPPortByHostId(targetHostId uuid.UUID, port ui
 }
 
 // ProbeUDPPortByHostId probes a UDP port on a managed HostServer by its ID
-func (n *NetworkPingerImpl) ProbeUDPPortByHostId(targetHostId uuid.UUID, port uint16) NetworkProbeResult {
+func (n *NetworkPingerImpl) ProbeUDPPortByHostId(ctx context.Context, targetHostId uuid.UUID, port uint16) NetworkProbeResult {
 	// Get the host server information
-	hostServer, err := n.hostServerProvider.GetHostServer(context.Background(), targetHostId)
+	hostServer, err := n.hostServerProvider.GetHostServer(ctx, targetHostId)
+	if err == nil && hostServer == nil {
+		err = host_servers.ErrHostServerNotFound
+	}
 	if err != nil {
 		return NetworkProbeResult{
 			TargetHostId:   targetHostId,
@@ -2,11 +2,13 @@ package node_networking
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"log/slog"
 
+	"github.com/babbage88/go-infra/services/host_servers"
 	"github.com/google/uuid"
 )
 
@@ -88,7 +90,11 @@ func PingHostServerHandler(pinger NetworkPinger) http.HandlerFunc {
 		}
 
 		// Perform the ping
-		result := pinger.PingHostServerNode(req.HostServerID)
+		result := pinger.PingHostServerNode(r.Context(), req.HostServerID)
+		if errors.Is(result.Error, host_servers.ErrHostServerNotFound) {
+			http.Error(w, "Host server not found", http.StatusNotFound)
+			return
+		}
 
 		// Prepare response
 		resp := PingResponse{
@@ -260,7 +266,11 @@ func ProbeTCPByHostIdHandler(pinger NetworkPinger) http.HandlerFunc {
 		}
 
 		// Perform the TCP probe
-		result := pinger.ProbeTCPPortByHostId(req.TargetHostId, req.Port)
+		result := pinger.ProbeTCPPortByHostId(r.Context(), req.TargetHostId, req.Port)
+		if errors.Is(result.Error, host_servers.ErrHostServerNotFound) {
+			http.Error(w, "Host server not found", http.StatusNotFound)
+			return
+		}
 
 		// Prepare response
 		resp := NetworkProbeResponse{
@@ -319,7 +329,11 @@ func ProbeUDPByHostIdHandler(pinger NetworkPinger) http.HandlerFunc {
 		}
 
 		// Perform the UDP probe
-		result := pinger.ProbeUDPPortByHostId(req.TargetHostId, req.Port)
+		result := pinger.ProbeUDPPortByHostId(r.Context(), req.TargetHostId, req.Port)
+		if errors.Is(result.Error, host_servers.ErrHostServerNotFound) {
+			http.Error(w, "Host server not found", http.StatusNotFound)
+			return
+		}
 
 		// Prepare response
 		resp := NetworkProbeResponse{
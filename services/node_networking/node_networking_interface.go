@@ -1,6 +1,7 @@
 package node_networking
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,9 +26,9 @@ type PingResult struct {
 
 type NetworkPinger interface {
 	Ping(target string) PingResult
-	PingHostServerNode(hostServerNodeID uuid.UUID) PingResult
-	ProbeTCPPortByHostId(targetHostId uuid.UUID, port uint16) NetworkProbeResult
-	ProbeUDPPortByHostId(targetHostId uuid.UUID, port uint16) NetworkProbeResult
+	PingHostServerNode(ctx context.Context, hostServerNodeID uuid.UUID) PingResult
+	ProbeTCPPortByHostId(ctx context.Context, targetHostId uuid.UUID, port uint16) NetworkProbeResult
+	ProbeUDPPortByHostId(ctx context.Context, targetHostId uuid.UUID, port uint16) NetworkProbeResult
 	ProbeTCPPortByHostName(targetHostName string, port uint16) NetworkProbeResult
 	ProbeUDPPortByHostName(targetHostName string, port uint16) NetworkProbeResult
 }
@@ -0,0 +1,374 @@
+package oidc_auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const jwksRefreshInterval = time.Minute
+
+// ProviderMetadata is the subset of the OpenID discovery document the client uses.
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// IdentityClaims are the verified ID token claims used to find or provision a user.
+type IdentityClaims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	Groups            []string
+}
+
+// OidcClient implements the authorization code flow with PKCE against one issuer.
+type OidcClient struct {
+	Config     *OidcConfig
+	HttpClient *http.Client
+
+	mu          sync.Mutex
+	metadata    *ProviderMetadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func NewOidcClient(cfg *OidcConfig) *OidcClient {
+	return &OidcClient{Config: cfg, HttpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// RandomUrlToken returns 32 random bytes as unpadded base64url, used for state, nonce
+// and the PKCE code verifier.
+func RandomUrlToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallengeS256 derives the PKCE S256 code challenge from a code verifier.
+func CodeChallengeS256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (c *OidcClient) getJson(ctx context.Context, endpoint string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// Discover fetches and caches the issuer's discovery document.
+func (c *OidcClient) Discover(ctx context.Context) (*ProviderMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	var metadata ProviderMetadata
+	if err := c.getJson(ctx, c.Config.IssuerUrl+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("error fetching oidc discovery document: %w", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != c.Config.IssuerUrl {
+		return nil, fmt.Errorf("oidc discovery issuer %q does not match %q", metadata.Issuer, c.Config.IssuerUrl)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return nil, errors.New("oidc discovery document is missing endpoints")
+	}
+	c.metadata = &metadata
+	return c.metadata, nil
+}
+
+// AuthCodeUrl builds the authorization request URL for the given state, nonce and verifier.
+func (c *OidcClient) AuthCodeUrl(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.Config.ClientId)
+	params.Set("redirect_uri", c.Config.RedirectUrl)
+	params.Set("scope", strings.Join(c.Config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallengeS256(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return metadata.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code at the token endpoint.
+func (c *OidcClient) Exchange(ctx context.Context, code string, codeVerifier string) (*TokenResponse, error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.Config.RedirectUrl)
+	form.Set("code_verifier", codeVerifier)
+	if c.Config.ClientSecret == "" {
+		form.Set("client_id", c.Config.ClientId)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.Config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.Config.ClientId), url.QueryEscape(c.Config.ClientSecret))
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling oidc token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("oidc token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokens TokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("error decoding oidc token response: %w", err)
+	}
+	if tokens.IdToken == "" {
+		return nil, errors.New("oidc token response has no id_token")
+	}
+	return &tokens, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeJwkInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJwkInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJwkInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported jwk curve %s", k.Crv)
+		}
+		x, err := decodeJwkInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJwkInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("jwk point is not on the curve")
+		}
+		return pub, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 jwk")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported jwk type %s", k.Kty)
+	}
+}
+
+func (c *OidcClient) refreshKeys(ctx context.Context, metadata *ProviderMetadata) error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.getJson(ctx, metadata.JwksUri, &jwks); err != nil {
+		return fmt.Errorf("error fetching oidc jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+	c.keys = keys
+	c.keysFetched = time.Now()
+	return nil
+}
+
+// signingKey returns the key for kid, refetching the JWKS when the IdP rotated keys.
+func (c *OidcClient) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(c.keysFetched) < jwksRefreshInterval && c.keys != nil {
+		return nil, fmt.Errorf("unknown id token signing key %q", kid)
+	}
+	if err := c.refreshKeys(ctx, metadata); err != nil {
+		return nil, err
+	}
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	// IdPs with a single key may omit kid
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown id token signing key %q", kid)
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func groupsClaim(claims jwt.MapClaims, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		groups := make([]string, 0, len(value))
+		for _, item := range value {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// VerifyIdToken checks the ID token signature, issuer, audience, expiry and nonce.
+func (c *OidcClient) VerifyIdToken(ctx context.Context, rawIdToken string, nonce string) (*IdentityClaims, error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIdToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(c.Config.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if stringClaim(claims, "nonce") != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 && stringClaim(claims, "azp") != c.Config.ClientId {
+		return nil, errors.New("id token authorized party does not match")
+	}
+
+	identity := &IdentityClaims{
+		Issuer:            c.Config.IssuerUrl,
+		Subject:           stringClaim(claims, "sub"),
+		Email:             stringClaim(claims, "email"),
+		PreferredUsername: stringClaim(claims, "preferred_username"),
+		Name:              stringClaim(claims, "name"),
+		Groups:            groupsClaim(claims, c.Config.GroupsClaim),
+	}
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	if identity.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return identity, nil
+}
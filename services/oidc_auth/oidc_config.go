@@ -0,0 +1,112 @@
+package oidc_auth
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+)
+
+// OidcConfig configures the OIDC relying party. GroupRoles maps IdP group names to
+// user_roles names, a group may map to several roles.
+type OidcConfig struct {
+	IssuerUrl         string
+	ClientId          string
+	ClientSecret      string
+	RedirectUrl       string
+	Scopes            []string
+	GroupsClaim       string
+	GroupRoles        map[string][]string
+	DefaultRoles      []string
+	AutoProvision     bool
+	PostLoginRedirect string
+}
+
+func splitEnvList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseGroupRoleMap parses "group=Role,group=OtherRole" pairs.
+func ParseGroupRoleMap(value string) (map[string][]string, error) {
+	groupRoles := make(map[string][]string)
+	for _, pair := range splitEnvList(value) {
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, errors.New("invalid group role mapping " + pair)
+		}
+		groupRoles[group] = append(groupRoles[group], role)
+	}
+	return groupRoles, nil
+}
+
+// NewOidcConfigFromEnv reads the OIDC_* environment variables. It returns nil when
+// OIDC_ISSUER_URL is not set, which disables OIDC login.
+func NewOidcConfigFromEnv() (*OidcConfig, error) {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	groupRoles, err := ParseGroupRoleMap(os.Getenv("OIDC_GROUP_ROLE_MAP"))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &OidcConfig{
+		IssuerUrl:         strings.TrimSuffix(issuer, "/"),
+		ClientId:          os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:      os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectUrl:       os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:            splitEnvList(os.Getenv("OIDC_SCOPES")),
+		GroupsClaim:       os.Getenv("OIDC_GROUPS_CLAIM"),
+		GroupRoles:        groupRoles,
+		DefaultRoles:      splitEnvList(os.Getenv("OIDC_DEFAULT_ROLES")),
+		AutoProvision:     os.Getenv("OIDC_AUTO_PROVISION") != "false",
+		PostLoginRedirect: os.Getenv("OIDC_POST_LOGIN_REDIRECT"),
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return cfg, cfg.Validate()
+}
+
+func (c *OidcConfig) Validate() error {
+	if c.IssuerUrl == "" || c.ClientId == "" || c.RedirectUrl == "" {
+		return errors.New("OIDC_ISSUER_URL, OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required")
+	}
+	if !slices.Contains(c.Scopes, "openid") {
+		return errors.New("OIDC_SCOPES must include openid")
+	}
+	return nil
+}
+
+// ManagedRoles returns every role name OIDC login assigns. Only these roles are removed
+// again when the user leaves a group, locally assigned roles are left alone.
+func (c *OidcConfig) ManagedRoles() []string {
+	roles := slices.Clone(c.DefaultRoles)
+	for _, mapped := range c.GroupRoles {
+		roles = append(roles, mapped...)
+	}
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
+
+// RolesForGroups returns the role names granted by the given IdP groups.
+func (c *OidcConfig) RolesForGroups(groups []string) []string {
+	roles := slices.Clone(c.DefaultRoles)
+	for _, group := range groups {
+		roles = append(roles, c.GroupRoles[group]...)
+	}
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
@@ -0,0 +1,108 @@
+package oidc_auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/api/authapi"
+)
+
+const stateCookieName = "go_infra_oidc_state"
+
+// safeReturnTo only allows local absolute paths so the parameter can not be used as an
+// open redirect.
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return ""
+	}
+	return returnTo
+}
+
+// swagger:route GET /auth/oidc/login Authentication oidcLogin
+// Redirect the browser to the OIDC identity provider. The optional returnTo query
+// parameter is handed back to the frontend after login.
+// responses:
+//
+//	302: description:Redirect to the identity provider
+//	500: description:Internal Server Error
+func OidcLoginHandler(provider OidcLoginProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authUrl, state, err := provider.BeginLogin(r.Context(), safeReturnTo(r.URL.Query().Get("returnTo")))
+		if err != nil {
+			slog.Error("Error starting oidc login", slog.String("error", err.Error()))
+			http.Error(w, "Failed to start single sign-on", http.StatusInternalServerError)
+			return
+		}
+
+		// binds the state to this browser so a callback can not be replayed in another one
+		http.SetCookie(w, &http.Cookie{
+			Name:     stateCookieName,
+			Value:    state,
+			Path:     "/auth/oidc",
+			MaxAge:   int(loginStateLifetime.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authUrl, http.StatusFound)
+	})
+}
+
+// swagger:route GET /auth/oidc/callback Authentication oidcCallback
+// Complete the OIDC login. When OIDC_POST_LOGIN_REDIRECT is set the browser is redirected
+// there with the tokens in the URL fragment, otherwise the tokens are returned as JSON.
+// responses:
+//
+//	200: LocalLoginResponse
+//	302: description:Redirect to the frontend
+//	400: description:Bad Request
+//	401: description:Unauthorized
+func OidcCallbackHandler(provider OidcLoginProvider, postLoginRedirect string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if idpErr := query.Get("error"); idpErr != "" {
+			slog.Error("Identity provider returned an error", slog.String("error", idpErr), slog.String("description", query.Get("error_description")))
+			http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+			return
+		}
+
+		state := query.Get("state")
+		code := query.Get("code")
+		cookie, err := r.Cookie(stateCookieName)
+		if state == "" || code == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+			http.Error(w, "Invalid single sign-on state", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: stateCookieName, Value: "", Path: "/auth/oidc", MaxAge: -1, HttpOnly: true, Secure: true})
+
+		token, returnTo, err := provider.CompleteLogin(r.Context(), state, code)
+		if err != nil {
+			slog.Error("Error completing oidc login", slog.String("error", err.Error()))
+			http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+			return
+		}
+
+		if postLoginRedirect != "" {
+			fragment := url.Values{}
+			fragment.Set("accessToken", token.Token)
+			fragment.Set("refreshToken", token.RefreshToken)
+			fragment.Set("expiration", token.Expiration.UTC().Format(time.RFC3339))
+			if returnTo != "" {
+				fragment.Set("returnTo", returnTo)
+			}
+			http.Redirect(w, r, postLoginRedirect+"#"+fragment.Encode(), http.StatusFound)
+			return
+		}
+
+		response := authapi.LocalLoginResponse{UserID: token.UserID,
+			Username: token.Username, Email: token.Email,
+			Token: token.Token, RefreshToken: token.RefreshToken, Expiration: token.Expiration}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
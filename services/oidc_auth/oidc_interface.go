@@ -0,0 +1,12 @@
+package oidc_auth
+
+import (
+	"context"
+
+	"github.com/babbage88/go-infra/api/authapi"
+)
+
+type OidcLoginProvider interface {
+	BeginLogin(ctx context.Context, returnTo string) (string, string, error)
+	CompleteLogin(ctx context.Context, state string, code string) (authapi.AuthToken, string, error)
+}
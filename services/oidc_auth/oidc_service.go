@@ -0,0 +1,279 @@
+package oidc_auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/user_crud_svc"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const loginStateLifetime = 10 * time.Minute
+
+var (
+	ErrLoginStateInvalid   = errors.New("oidc login state is invalid or expired")
+	ErrUserNotProvisioned  = errors.New("no user is linked to this identity and auto provisioning is disabled")
+	ErrLinkedUserDisabled  = errors.New("the user linked to this identity is disabled")
+	ErrIdentityUserMissing = errors.New("the user linked to this identity no longer exists")
+)
+
+// OidcLoginService links IdP identities to local users and issues the same tokens as a
+// local login.
+type OidcLoginService struct {
+	DbConn      *pgxpool.Pool
+	Client      *OidcClient
+	UserService *user_crud_svc.UserCRUDService
+	AuthService authapi.AuthService
+}
+
+func NewOidcLoginService(dbConn *pgxpool.Pool, client *OidcClient, userService *user_crud_svc.UserCRUDService, authService authapi.AuthService) *OidcLoginService {
+	return &OidcLoginService{DbConn: dbConn, Client: client, UserService: userService, AuthService: authService}
+}
+
+// BeginLogin stores a new state, nonce and PKCE verifier and returns the IdP URL to
+// redirect the browser to along with the state.
+func (s *OidcLoginService) BeginLogin(ctx context.Context, returnTo string) (string, string, error) {
+	state, err := RandomUrlToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := RandomUrlToken()
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := RandomUrlToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	authUrl, err := s.Client.AuthCodeUrl(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	qry := infra_db_pg.New(s.DbConn)
+	err = qry.InsertOidcLoginState(ctx, infra_db_pg.InsertOidcLoginStateParams{
+		State:         state,
+		Nonce:         nonce,
+		CodeVerifier:  codeVerifier,
+		RedirectAfter: returnTo,
+		ExpiresAt:     pgtype.Timestamptz{Time: time.Now().Add(loginStateLifetime), Valid: true},
+	})
+	if err != nil {
+		slog.Error("Error storing oidc login state", slog.String("error", err.Error()))
+		return "", "", fmt.Errorf("error storing oidc login state: %w", err)
+	}
+	return authUrl, state, nil
+}
+
+// CompleteLogin redeems the authorization code, resolves the local user and returns its
+// tokens and the returnTo path given to BeginLogin.
+func (s *OidcLoginService) CompleteLogin(ctx context.Context, state string, code string) (authapi.AuthToken, string, error) {
+	var tokens authapi.AuthToken
+	qry := infra_db_pg.New(s.DbConn)
+
+	loginState, err := qry.ConsumeOidcLoginState(ctx, state)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return tokens, "", ErrLoginStateInvalid
+		}
+		return tokens, "", fmt.Errorf("error retrieving oidc login state: %w", err)
+	}
+	if time.Now().After(loginState.ExpiresAt.Time) {
+		return tokens, "", ErrLoginStateInvalid
+	}
+
+	tokenResp, err := s.Client.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return tokens, "", err
+	}
+	identity, err := s.Client.VerifyIdToken(ctx, tokenResp.IdToken, loginState.Nonce)
+	if err != nil {
+		return tokens, "", err
+	}
+
+	userId, err := s.resolveUser(ctx, identity)
+	if err != nil {
+		return tokens, "", err
+	}
+	if err := s.syncRoles(ctx, userId, identity.Groups); err != nil {
+		return tokens, "", err
+	}
+
+	// Get the user again so the token carries the synced roles
+	user, err := s.AuthService.GetUserById(userId)
+	if err != nil {
+		return tokens, "", ErrIdentityUserMissing
+	}
+	if !user.Enabled {
+		return tokens, "", ErrLinkedUserDisabled
+	}
+
+	tokens, err = s.AuthService.CreateAuthTokenOnLogin(user.Id, user.RoleIds, user.Email)
+	if err != nil {
+		return tokens, "", err
+	}
+	tokens.Username = user.UserName
+	tokens.Email = user.Email
+
+	slog.Info("Oidc login was successful", slog.String("userId", user.Id.String()), slog.String("issuer", identity.Issuer))
+	return tokens, loginState.RedirectAfter, nil
+}
+
+// resolveUser returns the user linked to the IdP subject, provisioning one when allowed.
+// Existing local users are never linked by email, since the IdP email is not proof of
+// owning the local account.
+func (s *OidcLoginService) resolveUser(ctx context.Context, identity *IdentityClaims) (uuid.UUID, error) {
+	qry := infra_db_pg.New(s.DbConn)
+	linked, err := qry.GetUserIdentityByIssuerSubject(ctx, infra_db_pg.GetUserIdentityByIssuerSubjectParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		err = qry.UpdateUserIdentityLogin(ctx, infra_db_pg.UpdateUserIdentityLoginParams{ID: linked.ID, Email: identity.Email})
+		if err != nil {
+			slog.Error("Error updating user identity", slog.String("error", err.Error()))
+		}
+		return linked.UserID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("error retrieving user identity: %w", err)
+	}
+
+	if !s.Client.Config.AutoProvision {
+		return uuid.Nil, ErrUserNotProvisioned
+	}
+	return s.provisionUser(ctx, identity)
+}
+
+func (s *OidcLoginService) provisionUser(ctx context.Context, identity *IdentityClaims) (uuid.UUID, error) {
+	qry := infra_db_pg.New(s.DbConn)
+
+	username := usernameForIdentity(identity)
+	if _, err := qry.GetUserIdByName(ctx, pgtype.Text{String: username, Valid: true}); err == nil {
+		username = username + "-" + identitySuffix(identity)
+	}
+
+	// OIDC users never log in with a password
+	user, err := s.UserService.NewExternalUser(ctx, username, identity.Email)
+	if err != nil {
+		slog.Error("Error provisioning oidc user", slog.String("username", username), slog.String("error", err.Error()))
+		return uuid.Nil, fmt.Errorf("error provisioning user: %w", err)
+	}
+
+	_, err = qry.InsertUserIdentity(ctx, infra_db_pg.InsertUserIdentityParams{
+		UserID:  user.Id,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		// a concurrent login linked the subject first, drop the duplicate user
+		slog.Error("Error linking oidc identity", slog.String("userId", user.Id.String()), slog.String("error", err.Error()))
+		if _, delErr := s.UserService.SoftDeleteUserById(ctx, user.Id); delErr != nil {
+			slog.Error("Error removing unlinked oidc user", slog.String("userId", user.Id.String()), slog.String("error", delErr.Error()))
+		}
+		return uuid.Nil, fmt.Errorf("error linking identity: %w", err)
+	}
+
+	slog.Info("Provisioned oidc user", slog.String("userId", user.Id.String()), slog.String("username", username))
+	return user.Id, nil
+}
+
+func usernameForIdentity(identity *IdentityClaims) string {
+	switch {
+	case identity.PreferredUsername != "":
+		return identity.PreferredUsername
+	case identity.Email != "":
+		local, _, _ := strings.Cut(identity.Email, "@")
+		return local
+	default:
+		return "oidc-" + identitySuffix(identity)
+	}
+}
+
+func identitySuffix(identity *IdentityClaims) string {
+	sum := sha256.Sum256([]byte(identity.Issuer + "|" + identity.Subject))
+	return hex.EncodeToString(sum[:4])
+}
+
+// syncRoles grants the roles mapped from the user's groups and removes managed roles
+// the user no longer qualifies for.
+func (s *OidcLoginService) syncRoles(ctx context.Context, userId uuid.UUID, groups []string) error {
+	cfg := s.Client.Config
+	managed := cfg.ManagedRoles()
+	if len(managed) == 0 {
+		return nil
+	}
+	desired := cfg.RolesForGroups(groups)
+
+	roles, err := s.UserService.GetAllActiveRoles()
+	if err != nil {
+		return fmt.Errorf("error retrieving roles: %w", err)
+	}
+	roleIds := make(map[string]uuid.UUID, len(roles))
+	for _, role := range roles {
+		if role.Enabled {
+			roleIds[role.RoleName] = role.Id
+		}
+	}
+
+	user, err := s.UserService.GetUserById(userId)
+	if err != nil {
+		return fmt.Errorf("error retrieving user: %w", err)
+	}
+
+	for _, roleName := range managed {
+		roleId, ok := roleIds[roleName]
+		if !ok {
+			slog.Warn("Oidc role mapping references unknown role", slog.String("role", roleName))
+			continue
+		}
+		hasRole := slices.Contains(user.RoleIds, roleId)
+		wantsRole := slices.Contains(desired, roleName)
+
+		switch {
+		case wantsRole && !hasRole:
+			if err := s.UserService.UpdateUserRoleMapping(ctx, userId, roleId); err != nil {
+				return fmt.Errorf("error granting role %s: %w", roleName, err)
+			}
+		case !wantsRole && hasRole:
+			if err := s.UserService.DisableUserRoleMapping(ctx, userId, roleId); err != nil {
+				return fmt.Errorf("error removing role %s: %w", roleName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// StartStateCleanup periodically deletes abandoned login states.
+func (s *OidcLoginService) StartStateCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				qry := infra_db_pg.New(s.DbConn)
+				if err := qry.DeleteExpiredOidcLoginStates(ctx); err != nil {
+					slog.Error("Error deleting expired oidc login states", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,228 @@
+package oidc_auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// stubIdp is a minimal OIDC provider issuing RS256 ID tokens for one pending authorization.
+type stubIdp struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	codeChallenge string
+	nonce         string
+	audience      string
+	groups        []string
+}
+
+func newStubIdp(t *testing.T) *stubIdp {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating idp key: %v", err)
+	}
+	idp := &stubIdp{key: key, audience: "go-infra", groups: []string{"infra-admins", "unmapped"}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProviderMetadata{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JwksUri:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "stub-code" || CodeChallengeS256(r.Form.Get("code_verifier")) != idp.codeChallenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                idp.server.URL,
+			"sub":                "stub-subject",
+			"aud":                idp.audience,
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              idp.nonce,
+			"email":              "jane@example.com",
+			"email_verified":     true,
+			"preferred_username": "jane",
+			"groups":             idp.groups,
+		})
+		idToken.Header["kid"] = "stub-key"
+		signed, _ := idToken.SignedString(key)
+		json.NewEncoder(w).Encode(TokenResponse{AccessToken: "idp-access", TokenType: "Bearer", IdToken: signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize records what the browser would send to the authorization endpoint.
+func (idp *stubIdp) authorize(t *testing.T, authUrl string) {
+	t.Helper()
+	parsed, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatalf("error parsing auth url: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request %s", parsed.RawQuery)
+	}
+	idp.codeChallenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+}
+
+func newTestClient(idp *stubIdp) *OidcClient {
+	groupRoles, _ := ParseGroupRoleMap("infra-admins=Admin,infra-admins=Operator,infra-ops=ReadOnly")
+	return NewOidcClient(&OidcConfig{
+		IssuerUrl:   idp.server.URL,
+		ClientId:    "go-infra",
+		RedirectUrl: "https://infra.example.com/auth/oidc/callback",
+		Scopes:      []string{"openid", "email", "groups"},
+		GroupsClaim: "groups",
+		GroupRoles:  groupRoles,
+	})
+}
+
+func TestAuthorizationCodeFlowWithPkce(t *testing.T) {
+	idp := newStubIdp(t)
+	client := newTestClient(idp)
+	ctx := context.Background()
+
+	nonce, _ := RandomUrlToken()
+	verifier, _ := RandomUrlToken()
+	authUrl, err := client.AuthCodeUrl(ctx, "state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("error building auth url: %v", err)
+	}
+	idp.authorize(t, authUrl)
+
+	if _, err := client.Exchange(ctx, "stub-code", "wrong-verifier"); err == nil {
+		t.Fatal("expected exchange with the wrong code verifier to fail")
+	}
+
+	tokens, err := client.Exchange(ctx, "stub-code", verifier)
+	if err != nil {
+		t.Fatalf("error exchanging code: %v", err)
+	}
+	identity, err := client.VerifyIdToken(ctx, tokens.IdToken, nonce)
+	if err != nil {
+		t.Fatalf("error verifying id token: %v", err)
+	}
+	if identity.Subject != "stub-subject" || identity.PreferredUsername != "jane" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	roles := client.Config.RolesForGroups(identity.Groups)
+	if !slices.Equal(roles, []string{"Admin", "Operator"}) {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+	if !slices.Equal(client.Config.ManagedRoles(), []string{"Admin", "Operator", "ReadOnly"}) {
+		t.Fatalf("unexpected managed roles %v", client.Config.ManagedRoles())
+	}
+
+	if _, err := client.VerifyIdToken(ctx, tokens.IdToken, "other-nonce"); err == nil {
+		t.Fatal("expected id token with a different nonce to be rejected")
+	}
+}
+
+func TestIdTokenAudienceAndSignatureChecks(t *testing.T) {
+	idp := newStubIdp(t)
+	client := newTestClient(idp)
+	ctx := context.Background()
+
+	verifier, _ := RandomUrlToken()
+	authUrl, _ := client.AuthCodeUrl(ctx, "state", "nonce", verifier)
+	idp.authorize(t, authUrl)
+
+	idp.audience = "another-client"
+	tokens, err := client.Exchange(ctx, "stub-code", verifier)
+	if err != nil {
+		t.Fatalf("error exchanging code: %v", err)
+	}
+	if _, err := client.VerifyIdToken(ctx, tokens.IdToken, "nonce"); err == nil {
+		t.Fatal("expected id token for another audience to be rejected")
+	}
+
+	forgedKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": idp.server.URL, "sub": "attacker", "aud": "go-infra", "nonce": "nonce",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	forged.Header["kid"] = "stub-key"
+	forgedSigned, _ := forged.SignedString(forgedKey)
+	if _, err := client.VerifyIdToken(ctx, forgedSigned, "nonce"); err == nil {
+		t.Fatal("expected id token signed by an unknown key to be rejected")
+	}
+}
+
+type fakeLoginProvider struct {
+	state string
+}
+
+func (f *fakeLoginProvider) BeginLogin(ctx context.Context, returnTo string) (string, string, error) {
+	return "https://idp.example.com/authorize?state=" + f.state, f.state, nil
+}
+
+func (f *fakeLoginProvider) CompleteLogin(ctx context.Context, state string, code string) (authapi.AuthToken, string, error) {
+	return authapi.AuthToken{UserID: uuid.New(), Token: "access", RefreshToken: "refresh", Expiration: time.Now()}, "/hosts", nil
+}
+
+func TestOidcHandlersBindStateToBrowser(t *testing.T) {
+	provider := &fakeLoginProvider{state: "abc"}
+
+	rec := httptest.NewRecorder()
+	OidcLoginHandler(provider).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?returnTo=//evil.example.com", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "abc" || !cookies[0].HttpOnly {
+		t.Fatalf("expected http only state cookie, got %+v", cookies)
+	}
+
+	rec = httptest.NewRecorder()
+	OidcCallbackHandler(provider, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?state=abc&code=xyz", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected callback without state cookie to be rejected, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?state=abc&code=xyz", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	OidcCallbackHandler(provider, "https://app.example.com/sso").ServeHTTP(rec, req)
+	location := rec.Header().Get("Location")
+	if rec.Code != http.StatusFound || !strings.HasPrefix(location, "https://app.example.com/sso#") || !strings.Contains(location, "accessToken=access") {
+		t.Fatalf("expected redirect with tokens in fragment, got %d %s", rec.Code, location)
+	}
+
+	if safeReturnTo("/hosts") != "/hosts" || safeReturnTo("https://evil.example.com") != "" || safeReturnTo("/\\evil") != "" {
+		t.Fatal("unexpected returnTo sanitization")
+	}
+}
@@ -0,0 +1,283 @@
+package organizations
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// writeOrganizationError maps manager errors to responses.
+func writeOrganizationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidOrganization):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrOrganizationNotFound), errors.Is(err, ErrMemberNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// parseMemberPath reads the organization and user ids of /organizations/{ID}/members/{userId}.
+func parseMemberPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	orgId, err := uuid.Parse(r.PathValue("ID"))
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return orgId, userId, true
+}
+
+// swagger:route GET /organizations organizations getAllOrganizations
+// List every organization.
+// responses:
+//
+//	200: OrganizationsResponse
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func GetAllOrganizationsHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgs, err := manager.GetAllOrganizations(r.Context())
+		if err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+
+		resp := OrganizationsResponse{Body: orgs}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route POST /organizations organizations createOrganization
+// Create an organization. It starts without members.
+// responses:
+//
+//	201: OrganizationResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func CreateOrganizationHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CreateOrganizationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		org, err := manager.CreateOrganization(r.Context(), req)
+		if err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+
+		resp := OrganizationResponse{Body: org}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route GET /organizations/{ID} organizations getOrganization
+// Get an organization by ID.
+// responses:
+//
+//	200: OrganizationResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func GetOrganizationHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+			return
+		}
+
+		org, err := manager.GetOrganization(r.Context(), orgId)
+		if err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+
+		resp := OrganizationResponse{Body: org}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route DELETE /organizations/{ID} organizations deleteOrganization
+// Delete an organization. Sessions in it can no longer be refreshed into it.
+// responses:
+//
+//	204: description:Organization deleted
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func DeleteOrganizationHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.DeleteOrganization(r.Context(), orgId); err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route GET /organizations/{ID}/members organizations getOrganizationMembers
+// List the members of an organization and the roles they hold in it.
+// responses:
+//
+//	200: OrganizationMembersResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func GetMembersHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+			return
+		}
+
+		members, err := manager.GetMembers(r.Context(), orgId)
+		if err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+
+		resp := OrganizationMembersResponse{Body: members}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route POST /organizations/{ID}/members organizations addOrganizationMember
+// Add a user to an organization.
+// responses:
+//
+//	204: description:Member added
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func AddMemberHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AddMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserId == uuid.Nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.AddMember(r.Context(), orgId, req.UserId); err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route DELETE /organizations/{ID}/members/{userId} organizations removeOrganizationMember
+// Remove a user and the roles they held from an organization.
+// responses:
+//
+//	204: description:Member removed
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func RemoveMemberHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, userId, ok := parseMemberPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := manager.RemoveMember(r.Context(), orgId, userId); err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route POST /organizations/{ID}/members/{userId}/roles organizations addOrganizationMemberRole
+// Give a member a role that applies only while the organization is active.
+// responses:
+//
+//	204: description:Role added
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func AddMemberRoleHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, userId, ok := parseMemberPath(w, r)
+		if !ok {
+			return
+		}
+
+		var req AddMemberRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RoleId == uuid.Nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.AddMemberRole(r.Context(), orgId, userId, req.RoleId); err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route DELETE /organizations/{ID}/members/{userId}/roles/{roleId} organizations removeOrganizationMemberRole
+// Remove an organization role from a member.
+// responses:
+//
+//	204: description:Role removed
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func RemoveMemberRoleHandler(manager OrganizationManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, userId, ok := parseMemberPath(w, r)
+		if !ok {
+			return
+		}
+		roleId, err := uuid.Parse(r.PathValue("roleId"))
+		if err != nil {
+			http.Error(w, "Invalid role ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.RemoveMemberRole(r.Context(), orgId, userId, roleId); err != nil {
+			writeOrganizationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
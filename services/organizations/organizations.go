@@ -0,0 +1,165 @@
+package organizations
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ResourceHostServer  = "host_server"
+	ResourceSshKey      = "ssh_key"
+	ResourceExternalApp = "external_app"
+	ResourceSecret      = "secret"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrMemberNotFound       = errors.New("organization member not found")
+	ErrNotMember            = errors.New("user is not a member of the organization")
+	ErrNoActiveOrganization = errors.New("no active organization, switch into an organization first")
+	ErrInvalidOrganization  = errors.New("invalid organization")
+)
+
+var (
+	defaultTenancyMu sync.RWMutex
+	defaultTenancy   Tenancy
+)
+
+// SetDefault sets the tenancy used for tokens and resource checks.
+func SetDefault(t Tenancy) {
+	defaultTenancyMu.Lock()
+	defer defaultTenancyMu.Unlock()
+	defaultTenancy = t
+}
+
+// Default returns the configured tenancy or nil, in which case resources are not scoped to
+// organizations.
+func Default() Tenancy {
+	defaultTenancyMu.RLock()
+	defer defaultTenancyMu.RUnlock()
+	return defaultTenancy
+}
+
+// Session is the organization a token acts in and the roles the user holds there on top of
+// their global roles. OrgId is uuid.Nil for users that belong to no organization.
+type Session struct {
+	OrgId   uuid.UUID
+	RoleIds uuid.UUIDs
+}
+
+type activeOrgContextKey struct{}
+
+// WithActiveOrg stores the organization of the authenticated request. uuid.Nil marks a
+// caller without an organization, who sees only shared resources.
+func WithActiveOrg(ctx context.Context, orgId uuid.UUID) context.Context {
+	return context.WithValue(ctx, activeOrgContextKey{}, orgId)
+}
+
+// ActiveOrgFromContext returns the organization of the request. Background work and
+// requests that were not authenticated have none and are not scoped.
+func ActiveOrgFromContext(ctx context.Context) (uuid.UUID, bool) {
+	orgId, ok := ctx.Value(activeOrgContextKey{}).(uuid.UUID)
+	return orgId, ok
+}
+
+// enforced returns the active organization when ctx must be scoped to it.
+func enforced(ctx context.Context) (Tenancy, uuid.UUID, bool) {
+	tenancy := Default()
+	orgId, ok := ActiveOrgFromContext(ctx)
+	if tenancy == nil || !ok {
+		return nil, uuid.Nil, false
+	}
+	return tenancy, orgId, true
+}
+
+// visible reports whether a resource owned by owner can be seen from orgId. External
+// applications without an owner are a catalog shared by every organization.
+func visible(resourceType string, orgId uuid.UUID, owner uuid.UUID, owned bool) bool {
+	if !owned {
+		return resourceType == ResourceExternalApp
+	}
+	return orgId != uuid.Nil && owner == orgId
+}
+
+// AllowsResource reports whether the resource belongs to the active organization in ctx.
+func AllowsResource(ctx context.Context, resourceType string, resourceId uuid.UUID) (bool, error) {
+	tenancy, orgId, ok := enforced(ctx)
+	if !ok {
+		return true, nil
+	}
+	owners, err := tenancy.ResourceOwners(ctx, resourceType, []uuid.UUID{resourceId})
+	if err != nil {
+		return false, err
+	}
+	owner, owned := owners[resourceId]
+	return visible(resourceType, orgId, owner, owned), nil
+}
+
+// FilterIds returns the ids owned by the active organization in ctx, in their original order.
+func FilterIds(ctx context.Context, resourceType string, ids []uuid.UUID) ([]uuid.UUID, error) {
+	tenancy, orgId, ok := enforced(ctx)
+	if !ok || len(ids) == 0 {
+		return ids, nil
+	}
+	owners, err := tenancy.ResourceOwners(ctx, resourceType, ids)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		owner, owned := owners[id]
+		if visible(resourceType, orgId, owner, owned) {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+// AllowsGrantee reports whether a user or role may be given access to a resource. Grantees
+// must belong to the organization that owns the resource, resources without an owner and
+// deployments without tenancy accept anyone.
+func AllowsGrantee(ctx context.Context, resourceType string, resourceId uuid.UUID, userId, roleId *uuid.UUID) (bool, error) {
+	tenancy := Default()
+	if tenancy == nil {
+		return true, nil
+	}
+	owners, err := tenancy.ResourceOwners(ctx, resourceType, []uuid.UUID{resourceId})
+	if err != nil {
+		return false, err
+	}
+	owner, owned := owners[resourceId]
+	if !owned {
+		return true, nil
+	}
+	if userId != nil {
+		return tenancy.IsMember(ctx, owner, *userId)
+	}
+	if roleId != nil {
+		return tenancy.IsRoleHeld(ctx, owner, *roleId)
+	}
+	return false, nil
+}
+
+// RequireActiveOrg fails with ErrNoActiveOrganization when resources created from ctx would
+// have no organization to belong to.
+func RequireActiveOrg(ctx context.Context) error {
+	if _, orgId, ok := enforced(ctx); ok && orgId == uuid.Nil {
+		return ErrNoActiveOrganization
+	}
+	return nil
+}
+
+// AssignToActiveOrg records the active organization in ctx as the owner of a new resource.
+func AssignToActiveOrg(ctx context.Context, resourceType string, resourceId uuid.UUID) error {
+	tenancy, orgId, ok := enforced(ctx)
+	if !ok {
+		return nil
+	}
+	if orgId == uuid.Nil {
+		return ErrNoActiveOrganization
+	}
+	return tenancy.AssignResource(ctx, resourceType, resourceId, orgId)
+}
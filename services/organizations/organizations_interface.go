@@ -0,0 +1,31 @@
+package organizations
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Tenancy resolves the active organization of a session and which organization owns a
+// resource.
+type Tenancy interface {
+	ResolveSession(ctx context.Context, userId uuid.UUID, requestedOrgId uuid.UUID) (Session, error)
+	AssignResource(ctx context.Context, resourceType string, resourceId uuid.UUID, orgId uuid.UUID) error
+	ResourceOwners(ctx context.Context, resourceType string, resourceIds []uuid.UUID) (map[uuid.UUID]uuid.UUID, error)
+	IsMember(ctx context.Context, orgId uuid.UUID, userId uuid.UUID) (bool, error)
+	IsRoleHeld(ctx context.Context, orgId uuid.UUID, roleId uuid.UUID) (bool, error)
+}
+
+// OrganizationManager edits organizations, their members and the roles members hold in them.
+type OrganizationManager interface {
+	CreateOrganization(ctx context.Context, req CreateOrganizationRequest) (Organization, error)
+	GetOrganization(ctx context.Context, orgId uuid.UUID) (Organization, error)
+	GetAllOrganizations(ctx context.Context) ([]Organization, error)
+	GetUserOrganizations(ctx context.Context, userId uuid.UUID) ([]Organization, error)
+	DeleteOrganization(ctx context.Context, orgId uuid.UUID) error
+	GetMembers(ctx context.Context, orgId uuid.UUID) ([]Member, error)
+	AddMember(ctx context.Context, orgId, userId uuid.UUID) error
+	RemoveMember(ctx context.Context, orgId, userId uuid.UUID) error
+	AddMemberRole(ctx context.Context, orgId, userId, roleId uuid.UUID) error
+	RemoveMemberRole(ctx context.Context, orgId, userId, roleId uuid.UUID) error
+}
@@ -0,0 +1,234 @@
+package organizations
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/babbage88/go-infra/services/token_denylist"
+	"github.com/google/uuid"
+)
+
+type fakeTenancy struct {
+	owners   map[string]map[uuid.UUID]uuid.UUID
+	assigned map[uuid.UUID]uuid.UUID
+	members  map[uuid.UUID][]uuid.UUID
+	roles    map[uuid.UUID][]uuid.UUID
+}
+
+func newFakeTenancy() *fakeTenancy {
+	return &fakeTenancy{
+		owners:   map[string]map[uuid.UUID]uuid.UUID{},
+		assigned: map[uuid.UUID]uuid.UUID{},
+		members:  map[uuid.UUID][]uuid.UUID{},
+		roles:    map[uuid.UUID][]uuid.UUID{},
+	}
+}
+
+func (f *fakeTenancy) own(resourceType string, resourceId, orgId uuid.UUID) {
+	if f.owners[resourceType] == nil {
+		f.owners[resourceType] = map[uuid.UUID]uuid.UUID{}
+	}
+	f.owners[resourceType][resourceId] = orgId
+}
+
+func (f *fakeTenancy) ResolveSession(ctx context.Context, userId uuid.UUID, requestedOrgId uuid.UUID) (Session, error) {
+	return Session{OrgId: requestedOrgId}, nil
+}
+
+func (f *fakeTenancy) AssignResource(ctx context.Context, resourceType string, resourceId uuid.UUID, orgId uuid.UUID) error {
+	f.assigned[resourceId] = orgId
+	return nil
+}
+
+func (f *fakeTenancy) ResourceOwners(ctx context.Context, resourceType string, resourceIds []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	owners := map[uuid.UUID]uuid.UUID{}
+	for _, id := range resourceIds {
+		if owner, ok := f.owners[resourceType][id]; ok {
+			owners[id] = owner
+		}
+	}
+	return owners, nil
+}
+
+func (f *fakeTenancy) IsMember(ctx context.Context, orgId uuid.UUID, userId uuid.UUID) (bool, error) {
+	return slices.Contains(f.members[orgId], userId), nil
+}
+
+func (f *fakeTenancy) IsRoleHeld(ctx context.Context, orgId uuid.UUID, roleId uuid.UUID) (bool, error) {
+	return slices.Contains(f.roles[orgId], roleId), nil
+}
+
+func withTenancy(t *testing.T, tenancy Tenancy) {
+	t.Helper()
+	SetDefault(tenancy)
+	t.Cleanup(func() { SetDefault(nil) })
+}
+
+func TestResourcesAreScopedToActiveOrg(t *testing.T) {
+	tenancy := newFakeTenancy()
+	withTenancy(t, tenancy)
+	orgA, orgB := uuid.New(), uuid.New()
+	serverA, serverB, unowned := uuid.New(), uuid.New(), uuid.New()
+	tenancy.own(ResourceHostServer, serverA, orgA)
+	tenancy.own(ResourceHostServer, serverB, orgB)
+	ctx := WithActiveOrg(context.Background(), orgA)
+
+	cases := []struct {
+		name string
+		id   uuid.UUID
+		want bool
+	}{
+		{"own org", serverA, true},
+		{"other org", serverB, false},
+		{"unowned", unowned, false},
+	}
+	for _, tc := range cases {
+		got, err := AllowsResource(ctx, ResourceHostServer, tc.id)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+
+	ids, err := FilterIds(ctx, ResourceHostServer, []uuid.UUID{serverB, serverA, unowned})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(ids, []uuid.UUID{serverA}) {
+		t.Errorf("expected only %s, got %v", serverA, ids)
+	}
+}
+
+func TestUnownedExternalAppsAreShared(t *testing.T) {
+	tenancy := newFakeTenancy()
+	withTenancy(t, tenancy)
+	orgA, orgB := uuid.New(), uuid.New()
+	shared, private := uuid.New(), uuid.New()
+	tenancy.own(ResourceExternalApp, private, orgB)
+
+	for _, orgId := range []uuid.UUID{orgA, uuid.Nil} {
+		ids, err := FilterIds(WithActiveOrg(context.Background(), orgId), ResourceExternalApp, []uuid.UUID{shared, private})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(ids, []uuid.UUID{shared}) {
+			t.Errorf("org %s: expected only the shared app, got %v", orgId, ids)
+		}
+	}
+}
+
+func TestWithoutTenancyNothingIsScoped(t *testing.T) {
+	withTenancy(t, nil)
+	ctx := WithActiveOrg(context.Background(), uuid.New())
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+
+	if allowed, err := AllowsResource(ctx, ResourceSecret, ids[0]); err != nil || !allowed {
+		t.Errorf("expected access without tenancy, got %v, %v", allowed, err)
+	}
+	if got, err := FilterIds(ctx, ResourceSecret, ids); err != nil || !slices.Equal(got, ids) {
+		t.Errorf("expected ids unchanged without tenancy, got %v, %v", got, err)
+	}
+	if err := AssignToActiveOrg(ctx, ResourceSecret, ids[0]); err != nil {
+		t.Errorf("expected assign to be a no-op without tenancy, got %v", err)
+	}
+}
+
+func TestGranteesMustBelongToResourceOrg(t *testing.T) {
+	tenancy := newFakeTenancy()
+	withTenancy(t, tenancy)
+	orgA, orgB := uuid.New(), uuid.New()
+	secret, unowned := uuid.New(), uuid.New()
+	member, outsider := uuid.New(), uuid.New()
+	heldRole, foreignRole := uuid.New(), uuid.New()
+	tenancy.own(ResourceSecret, secret, orgA)
+	tenancy.members[orgA] = []uuid.UUID{member}
+	tenancy.members[orgB] = []uuid.UUID{outsider}
+	tenancy.roles[orgA] = []uuid.UUID{heldRole}
+	tenancy.roles[orgB] = []uuid.UUID{foreignRole}
+
+	cases := []struct {
+		name     string
+		resource uuid.UUID
+		userId   *uuid.UUID
+		roleId   *uuid.UUID
+		want     bool
+	}{
+		{"member", secret, &member, nil, true},
+		{"user of other org", secret, &outsider, nil, false},
+		{"role held in org", secret, nil, &heldRole, true},
+		{"role held only elsewhere", secret, nil, &foreignRole, false},
+		{"unowned resource", unowned, &outsider, nil, true},
+	}
+	for _, tc := range cases {
+		got, err := AllowsGrantee(context.Background(), ResourceSecret, tc.resource, tc.userId, tc.roleId)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestCreateRequiresActiveOrg(t *testing.T) {
+	tenancy := newFakeTenancy()
+	withTenancy(t, tenancy)
+	orgId, secretId := uuid.New(), uuid.New()
+
+	noOrg := WithActiveOrg(context.Background(), uuid.Nil)
+	if err := RequireActiveOrg(noOrg); !errors.Is(err, ErrNoActiveOrganization) {
+		t.Errorf("expected ErrNoActiveOrganization, got %v", err)
+	}
+	if err := AssignToActiveOrg(noOrg, ResourceSecret, secretId); !errors.Is(err, ErrNoActiveOrganization) {
+		t.Errorf("expected ErrNoActiveOrganization, got %v", err)
+	}
+	if err := RequireActiveOrg(context.Background()); err != nil {
+		t.Errorf("expected unauthenticated context to be unscoped, got %v", err)
+	}
+
+	if err := AssignToActiveOrg(WithActiveOrg(context.Background(), orgId), ResourceSecret, secretId); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tenancy.assigned[secretId] != orgId {
+		t.Errorf("expected secret assigned to %s, got %s", orgId, tenancy.assigned[secretId])
+	}
+}
+
+type fakeDenylist struct {
+	revoked map[uuid.UUID]string
+}
+
+func (f *fakeDenylist) RecordIssued(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time) error {
+	return nil
+}
+
+func (f *fakeDenylist) IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeDenylist) Revoke(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time, reason string) error {
+	return nil
+}
+
+func (f *fakeDenylist) RevokeUserTokens(ctx context.Context, userId uuid.UUID, reason string) error {
+	f.revoked[userId] = reason
+	return nil
+}
+
+func TestRemovalRevokesMemberAccessTokens(t *testing.T) {
+	denylist := &fakeDenylist{revoked: map[uuid.UUID]string{}}
+	token_denylist.SetDefault(denylist)
+	t.Cleanup(func() { token_denylist.SetDefault(nil) })
+
+	userId := uuid.New()
+	(&PgOrganizations{}).revokeAccessTokens(context.Background(), userId)
+
+	if reason, ok := denylist.revoked[userId]; !ok || reason != token_denylist.ReasonRoleChanged {
+		t.Fatalf("expected tokens of the removed member to be revoked as role_changed, got %v", denylist.revoked)
+	}
+}
@@ -0,0 +1,344 @@
+package organizations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/token_denylist"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Organization is a tenant that owns host servers, ssh keys, external applications and secrets.
+//
+// swagger:model Organization
+type Organization struct {
+	Id           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Member is a user of an organization and the roles they hold only within it.
+//
+// swagger:model OrganizationMember
+type Member struct {
+	UserId   uuid.UUID   `json:"userId"`
+	Username string      `json:"username"`
+	Email    string      `json:"email"`
+	RoleIds  []uuid.UUID `json:"roleIds"`
+	JoinedAt time.Time   `json:"joinedAt"`
+}
+
+// CreateOrganizationRequest names a new organization.
+//
+// swagger:model CreateOrganizationRequest
+type CreateOrganizationRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type PgOrganizations struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgOrganizations(db *pgxpool.Pool) *PgOrganizations {
+	return &PgOrganizations{DbConn: db}
+}
+
+func organizationFromDb(row infra_db_pg.Organization) Organization {
+	return Organization{
+		Id:           row.ID,
+		Name:         row.Name,
+		Description:  row.Description.String,
+		CreatedAt:    row.CreatedAt.Time,
+		LastModified: row.LastModified.Time,
+	}
+}
+
+// ResolveSession returns the organization a token for userId acts in. A requested
+// organization must be one the user belongs to, without one the organization the user
+// joined first is used.
+func (p *PgOrganizations) ResolveSession(ctx context.Context, userId uuid.UUID, requestedOrgId uuid.UUID) (Session, error) {
+	var session Session
+	qry := infra_db_pg.New(p.DbConn)
+
+	orgId := requestedOrgId
+	if orgId == uuid.Nil {
+		first, err := qry.GetFirstOrganizationIdForUser(ctx, userId)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return session, nil
+		}
+		if err != nil {
+			slog.Error("Error reading user organizations", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+			return session, fmt.Errorf("error reading user organizations: %w", err)
+		}
+		orgId = first
+	} else {
+		isMember, err := qry.IsOrganizationMember(ctx, infra_db_pg.IsOrganizationMemberParams{OrgID: orgId, UserID: userId})
+		if err != nil {
+			slog.Error("Error checking organization membership", slog.String("orgId", orgId.String()), slog.String("error", err.Error()))
+			return session, fmt.Errorf("error checking organization membership: %w", err)
+		}
+		if !isMember {
+			return session, ErrNotMember
+		}
+	}
+
+	roleIds, err := qry.GetOrganizationMemberRoleIds(ctx, infra_db_pg.GetOrganizationMemberRoleIdsParams{OrgID: orgId, UserID: userId})
+	if err != nil {
+		slog.Error("Error reading organization member roles", slog.String("orgId", orgId.String()), slog.String("error", err.Error()))
+		return session, fmt.Errorf("error reading organization member roles: %w", err)
+	}
+	session.OrgId = orgId
+	session.RoleIds = roleIds
+	return session, nil
+}
+
+func (p *PgOrganizations) AssignResource(ctx context.Context, resourceType string, resourceId uuid.UUID, orgId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	err := qry.AssignOrganizationResource(ctx, infra_db_pg.AssignOrganizationResourceParams{
+		ResourceType: resourceType,
+		ResourceID:   resourceId,
+		OrgID:        orgId,
+	})
+	if err != nil {
+		slog.Error("Error assigning resource to organization", slog.String("resourceType", resourceType), slog.String("resourceId", resourceId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error assigning resource to organization: %w", err)
+	}
+	return nil
+}
+
+// ResourceOwners maps each owned resource id to its organization. Ids without an owner are
+// left out.
+func (p *PgOrganizations) ResourceOwners(ctx context.Context, resourceType string, resourceIds []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetOrganizationResourceOwners(ctx, infra_db_pg.GetOrganizationResourceOwnersParams{
+		ResourceType: resourceType,
+		ResourceIds:  resourceIds,
+	})
+	if err != nil {
+		slog.Error("Error reading resource organizations", slog.String("resourceType", resourceType), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error reading resource organizations: %w", err)
+	}
+	owners := make(map[uuid.UUID]uuid.UUID, len(rows))
+	for _, row := range rows {
+		owners[row.ResourceID] = row.OrgID
+	}
+	return owners, nil
+}
+
+func (p *PgOrganizations) IsMember(ctx context.Context, orgId uuid.UUID, userId uuid.UUID) (bool, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	isMember, err := qry.IsOrganizationMember(ctx, infra_db_pg.IsOrganizationMemberParams{OrgID: orgId, UserID: userId})
+	if err != nil {
+		slog.Error("Error checking organization membership", slog.String("orgId", orgId.String()), slog.String("error", err.Error()))
+		return false, fmt.Errorf("error checking organization membership: %w", err)
+	}
+	return isMember, nil
+}
+
+// IsRoleHeld reports whether a member of the organization holds the role, globally, through
+// a group or as a role within the organization.
+func (p *PgOrganizations) IsRoleHeld(ctx context.Context, orgId uuid.UUID, roleId uuid.UUID) (bool, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	held, err := qry.IsRoleHeldInOrganization(ctx, infra_db_pg.IsRoleHeldInOrganizationParams{OrgID: orgId, RoleID: roleId})
+	if err != nil {
+		slog.Error("Error checking organization role", slog.String("orgId", orgId.String()), slog.String("roleId", roleId.String()), slog.String("error", err.Error()))
+		return false, fmt.Errorf("error checking organization role: %w", err)
+	}
+	return held, nil
+}
+
+func (p *PgOrganizations) CreateOrganization(ctx context.Context, req CreateOrganizationRequest) (Organization, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return Organization{}, fmt.Errorf("%w: name is required", ErrInvalidOrganization)
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	row, err := qry.CreateOrganization(ctx, infra_db_pg.CreateOrganizationParams{
+		Name:        name,
+		Description: pgtype.Text{String: req.Description, Valid: req.Description != ""},
+	})
+	if err != nil {
+		slog.Error("Error creating organization", slog.String("name", name), slog.String("error", err.Error()))
+		return Organization{}, fmt.Errorf("error creating organization: %w", err)
+	}
+	return organizationFromDb(row), nil
+}
+
+func (p *PgOrganizations) GetOrganization(ctx context.Context, orgId uuid.UUID) (Organization, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	row, err := qry.GetOrganizationById(ctx, orgId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Organization{}, ErrOrganizationNotFound
+	}
+	if err != nil {
+		slog.Error("Error reading organization", slog.String("orgId", orgId.String()), slog.String("error", err.Error()))
+		return Organization{}, fmt.Errorf("error reading organization: %w", err)
+	}
+	return organizationFromDb(row), nil
+}
+
+// GetOrganizationIdByName returns ErrOrganizationNotFound for unknown or deleted names.
+func (p *PgOrganizations) GetOrganizationIdByName(ctx context.Context, name string) (uuid.UUID, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	id, err := qry.GetOrganizationIdByName(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrOrganizationNotFound
+	}
+	if err != nil {
+		slog.Error("Error getting organization by name", slog.String("name", name), slog.String("error", err.Error()))
+		return uuid.Nil, fmt.Errorf("error getting organization: %w", err)
+	}
+	return id, nil
+}
+
+func (p *PgOrganizations) GetAllOrganizations(ctx context.Context) ([]Organization, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetAllOrganizations(ctx)
+	if err != nil {
+		slog.Error("Error listing organizations", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error listing organizations: %w", err)
+	}
+	orgs := make([]Organization, 0, len(rows))
+	for _, row := range rows {
+		orgs = append(orgs, organizationFromDb(row))
+	}
+	return orgs, nil
+}
+
+func (p *PgOrganizations) GetUserOrganizations(ctx context.Context, userId uuid.UUID) ([]Organization, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetOrganizationsByUserId(ctx, userId)
+	if err != nil {
+		slog.Error("Error listing user organizations", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error listing user organizations: %w", err)
+	}
+	orgs := make([]Organization, 0, len(rows))
+	for _, row := range rows {
+		orgs = append(orgs, organizationFromDb(row))
+	}
+	return orgs, nil
+}
+
+// DeleteOrganization soft deletes the organization. Its resources stay owned by it and
+// become unreachable until they are reassigned.
+func (p *PgOrganizations) DeleteOrganization(ctx context.Context, orgId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	deleted, err := qry.SoftDeleteOrganization(ctx, orgId)
+	if err != nil {
+		slog.Error("Error deleting organization", slog.String("orgId", orgId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error deleting organization: %w", err)
+	}
+	if deleted == 0 {
+		return ErrOrganizationNotFound
+	}
+	return nil
+}
+
+func (p *PgOrganizations) GetMembers(ctx context.Context, orgId uuid.UUID) ([]Member, error) {
+	if _, err := p.GetOrganization(ctx, orgId); err != nil {
+		return nil, err
+	}
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetOrganizationMembers(ctx, orgId)
+	if err != nil {
+		slog.Error("Error listing organization members", slog.String("orgId", orgId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error listing organization members: %w", err)
+	}
+	members := make([]Member, 0, len(rows))
+	for _, row := range rows {
+		roleIds := row.RoleIds
+		if roleIds == nil {
+			roleIds = make([]uuid.UUID, 0)
+		}
+		members = append(members, Member{
+			UserId:   row.UserID,
+			Username: row.Username.String,
+			Email:    row.Email.String,
+			RoleIds:  roleIds,
+			JoinedAt: row.CreatedAt.Time,
+		})
+	}
+	return members, nil
+}
+
+func (p *PgOrganizations) AddMember(ctx context.Context, orgId, userId uuid.UUID) error {
+	if _, err := p.GetOrganization(ctx, orgId); err != nil {
+		return err
+	}
+	qry := infra_db_pg.New(p.DbConn)
+	if err := qry.AddOrganizationMember(ctx, infra_db_pg.AddOrganizationMemberParams{OrgID: orgId, UserID: userId}); err != nil {
+		slog.Error("Error adding organization member", slog.String("orgId", orgId.String()), slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error adding organization member: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember removes the user and the roles they held in the organization.
+func (p *PgOrganizations) RemoveMember(ctx context.Context, orgId, userId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	removed, err := qry.RemoveOrganizationMember(ctx, infra_db_pg.RemoveOrganizationMemberParams{OrgID: orgId, UserID: userId})
+	if err != nil {
+		slog.Error("Error removing organization member", slog.String("orgId", orgId.String()), slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error removing organization member: %w", err)
+	}
+	if removed == 0 {
+		return ErrMemberNotFound
+	}
+	p.revokeAccessTokens(ctx, userId)
+	return nil
+}
+
+func (p *PgOrganizations) AddMemberRole(ctx context.Context, orgId, userId, roleId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	isMember, err := qry.IsOrganizationMember(ctx, infra_db_pg.IsOrganizationMemberParams{OrgID: orgId, UserID: userId})
+	if err != nil {
+		return fmt.Errorf("error checking organization membership: %w", err)
+	}
+	if !isMember {
+		return ErrMemberNotFound
+	}
+	err = qry.AddOrganizationMemberRole(ctx, infra_db_pg.AddOrganizationMemberRoleParams{OrgID: orgId, UserID: userId, RoleID: roleId})
+	if err != nil {
+		slog.Error("Error adding organization member role", slog.String("orgId", orgId.String()), slog.String("roleId", roleId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error adding organization member role: %w", err)
+	}
+	return nil
+}
+
+func (p *PgOrganizations) RemoveMemberRole(ctx context.Context, orgId, userId, roleId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	removed, err := qry.RemoveOrganizationMemberRole(ctx, infra_db_pg.RemoveOrganizationMemberRoleParams{OrgID: orgId, UserID: userId, RoleID: roleId})
+	if err != nil {
+		slog.Error("Error removing organization member role", slog.String("orgId", orgId.String()), slog.String("roleId", roleId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error removing organization member role: %w", err)
+	}
+	if removed == 0 {
+		return ErrMemberNotFound
+	}
+	p.revokeAccessTokens(ctx, userId)
+	return nil
+}
+
+// revokeAccessTokens ends the outstanding access tokens of a user who lost a membership or
+// role so the org_id claim and roles are checked again on the next refresh.
+func (p *PgOrganizations) revokeAccessTokens(ctx context.Context, userId uuid.UUID) {
+	denylist := token_denylist.Default()
+	if denylist == nil {
+		denylist = token_denylist.NewPgTokenDenylist(p.DbConn)
+	}
+	if err := denylist.RevokeUserTokens(ctx, userId, token_denylist.ReasonRoleChanged); err != nil {
+		slog.Error("Error revoking access tokens after organization change", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,53 @@
+package organizations
+
+import "github.com/google/uuid"
+
+// AddMemberRequest names the user to add to an organization.
+//
+// swagger:model AddOrganizationMemberRequest
+type AddMemberRequest struct {
+	UserId uuid.UUID `json:"userId"`
+}
+
+// AddMemberRoleRequest names the role to give a member within the organization.
+//
+// swagger:model AddOrganizationMemberRoleRequest
+type AddMemberRoleRequest struct {
+	RoleId uuid.UUID `json:"roleId"`
+}
+
+// swagger:parameters createOrganization
+type CreateOrganizationRequestWrapper struct {
+	// in: body
+	Body CreateOrganizationRequest `json:"body"`
+}
+
+// swagger:parameters addOrganizationMember
+type AddMemberRequestWrapper struct {
+	// in: body
+	Body AddMemberRequest `json:"body"`
+}
+
+// swagger:parameters addOrganizationMemberRole
+type AddMemberRoleRequestWrapper struct {
+	// in: body
+	Body AddMemberRoleRequest `json:"body"`
+}
+
+// swagger:response OrganizationsResponse
+type OrganizationsResponse struct {
+	// in: body
+	Body []Organization `json:"organizations"`
+}
+
+// swagger:response OrganizationResponse
+type OrganizationResponse struct {
+	// in: body
+	Body Organization `json:"organization"`
+}
+
+// swagger:response OrganizationMembersResponse
+type OrganizationMembersResponse struct {
+	// in: body
+	Body []Member `json:"members"`
+}
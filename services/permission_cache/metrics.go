@@ -0,0 +1,18 @@
+package permission_cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	lookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "permission_cache_lookups_total",
+		Help: "Role permission lookups, by whether the role was cached (hit) or loaded from Postgres (miss).",
+	}, []string{"result"})
+
+	invalidationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "permission_cache_invalidations_total",
+		Help: "Permission cache invalidations, by whether they were made here (local) or on another replica (remote).",
+	}, []string{"source"})
+)
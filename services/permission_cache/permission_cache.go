@@ -0,0 +1,164 @@
+package permission_cache
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultTtl = 5 * time.Minute
+
+var (
+	defaultCacheMu sync.RWMutex
+	defaultCache   *PermissionCache
+)
+
+// SetDefault sets the cache used for permission checks and invalidated by role changes.
+func SetDefault(c *PermissionCache) {
+	defaultCacheMu.Lock()
+	defer defaultCacheMu.Unlock()
+	defaultCache = c
+}
+
+// Default returns the configured cache or nil, in which case every check queries Postgres.
+func Default() *PermissionCache {
+	defaultCacheMu.RLock()
+	defer defaultCacheMu.RUnlock()
+	return defaultCache
+}
+
+// Invalidate drops the cached permissions of roleIds, or of every role when none are
+// given, on this and every other replica.
+func Invalidate(ctx context.Context, roleIds ...uuid.UUID) {
+	if cache := Default(); cache != nil {
+		cache.Invalidate(ctx, roleIds...)
+	}
+}
+
+type cachedRole struct {
+	permissions map[string]struct{}
+	expiresAt   time.Time
+}
+
+// PermissionCache keeps the permission set of each role in process. Entries are dropped
+// when a role or its permissions change, the ttl only bounds staleness when an
+// invalidation from another replica is lost.
+type PermissionCache struct {
+	loader RolePermissionLoader
+	bus    InvalidationBus
+	ttl    time.Duration
+
+	mu    sync.RWMutex
+	roles map[uuid.UUID]cachedRole
+	// generation increases on every invalidation so loads that started before it are not
+	// stored.
+	generation uint64
+}
+
+// NewPermissionCache creates a cache. bus may be nil when only one replica runs.
+func NewPermissionCache(loader RolePermissionLoader, bus InvalidationBus, ttl time.Duration) *PermissionCache {
+	if ttl <= 0 {
+		ttl = DefaultTtl
+	}
+	return &PermissionCache{
+		loader: loader,
+		bus:    bus,
+		ttl:    ttl,
+		roles:  make(map[uuid.UUID]cachedRole),
+	}
+}
+
+// Start listens for invalidations from other replicas until ctx is done.
+func (c *PermissionCache) Start(ctx context.Context) {
+	if c.bus == nil {
+		return
+	}
+	go c.bus.Subscribe(ctx, func(roleIds uuid.UUIDs) {
+		invalidationsTotal.WithLabelValues("remote").Inc()
+		c.invalidateLocal(roleIds)
+	})
+}
+
+// HasPermission reports whether any of roleIds grants permissionName. Only roles missing
+// from the cache are loaded.
+func (c *PermissionCache) HasPermission(ctx context.Context, roleIds uuid.UUIDs, permissionName string) (bool, error) {
+	var missing uuid.UUIDs
+	now := time.Now()
+
+	c.mu.RLock()
+	generation := c.generation
+	for _, roleId := range roleIds {
+		role, ok := c.roles[roleId]
+		if !ok || now.After(role.expiresAt) {
+			missing = append(missing, roleId)
+			continue
+		}
+		lookupsTotal.WithLabelValues("hit").Inc()
+		if _, granted := role.permissions[permissionName]; granted {
+			c.mu.RUnlock()
+			return true, nil
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return false, nil
+	}
+	lookupsTotal.WithLabelValues("miss").Add(float64(len(missing)))
+
+	loaded, err := c.loader.LoadRolePermissions(ctx, missing)
+	if err != nil {
+		return false, err
+	}
+
+	granted := false
+	entries := make(map[uuid.UUID]cachedRole, len(missing))
+	for _, roleId := range missing {
+		role := cachedRole{permissions: make(map[string]struct{}), expiresAt: now.Add(c.ttl)}
+		for _, name := range loaded[roleId] {
+			role.permissions[name] = struct{}{}
+			if name == permissionName {
+				granted = true
+			}
+		}
+		entries[roleId] = role
+	}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		for roleId, role := range entries {
+			c.roles[roleId] = role
+		}
+	}
+	c.mu.Unlock()
+	return granted, nil
+}
+
+// Invalidate drops roleIds, or every role when none are given, and tells the other
+// replicas to do the same.
+func (c *PermissionCache) Invalidate(ctx context.Context, roleIds ...uuid.UUID) {
+	invalidationsTotal.WithLabelValues("local").Inc()
+	c.invalidateLocal(roleIds)
+	if c.bus == nil {
+		return
+	}
+	if err := c.bus.Publish(ctx, roleIds); err != nil {
+		slog.Error("Error publishing permission cache invalidation", slog.String("error", err.Error()))
+	}
+}
+
+func (c *PermissionCache) invalidateLocal(roleIds uuid.UUIDs) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if len(roleIds) == 0 {
+		clear(c.roles)
+		return
+	}
+	for _, roleId := range roleIds {
+		delete(c.roles, roleId)
+	}
+}
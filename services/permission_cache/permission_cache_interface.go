@@ -0,0 +1,21 @@
+package permission_cache
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// RolePermissionLoader reads the permission names granted to each role. Roles that grant
+// nothing may be left out of the result.
+type RolePermissionLoader interface {
+	LoadRolePermissions(ctx context.Context, roleIds uuid.UUIDs) (map[uuid.UUID][]string, error)
+}
+
+// InvalidationBus carries invalidations between replicas. An empty roleIds means every
+// role.
+type InvalidationBus interface {
+	Publish(ctx context.Context, roleIds uuid.UUIDs) error
+	// Subscribe calls fn for every invalidation published by any replica until ctx is done.
+	Subscribe(ctx context.Context, fn func(roleIds uuid.UUIDs))
+}
@@ -0,0 +1,85 @@
+package permission_cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type countingLoader struct {
+	permissions map[uuid.UUID][]string
+	loads       int
+}
+
+func (l *countingLoader) LoadRolePermissions(ctx context.Context, roleIds uuid.UUIDs) (map[uuid.UUID][]string, error) {
+	l.loads++
+	return l.permissions, nil
+}
+
+func TestPermissionCacheLoadsOnceUntilInvalidated(t *testing.T) {
+	ctx := context.Background()
+	admin, viewer := uuid.New(), uuid.New()
+	loader := &countingLoader{permissions: map[uuid.UUID][]string{admin: {"CreateUser", "ReadHostServers"}}}
+	cache := NewPermissionCache(loader, nil, 0)
+	hits := testutil.ToFloat64(lookupsTotal.WithLabelValues("hit"))
+
+	for range 3 {
+		granted, err := cache.HasPermission(ctx, uuid.UUIDs{viewer, admin}, "CreateUser")
+		if err != nil || !granted {
+			t.Fatalf("expected CreateUser to be granted: %v", err)
+		}
+	}
+	if granted, _ := cache.HasPermission(ctx, uuid.UUIDs{viewer}, "CreateUser"); granted {
+		t.Fatal("expected a role without permissions to be denied")
+	}
+	if loader.loads != 1 {
+		t.Fatalf("expected one load, got %d", loader.loads)
+	}
+	if got := testutil.ToFloat64(lookupsTotal.WithLabelValues("hit")) - hits; got != 5 {
+		t.Fatalf("expected 5 cache hits, got %v", got)
+	}
+
+	loader.permissions = map[uuid.UUID][]string{admin: {"ReadHostServers"}}
+	cache.Invalidate(ctx, admin)
+	if granted, _ := cache.HasPermission(ctx, uuid.UUIDs{admin}, "CreateUser"); granted {
+		t.Fatal("expected the revoked permission to be denied after invalidation")
+	}
+	if loader.loads != 2 {
+		t.Fatalf("expected the invalidated role to be reloaded, got %d loads", loader.loads)
+	}
+}
+
+type recordingBus struct {
+	published []uuid.UUIDs
+}
+
+func (b *recordingBus) Publish(ctx context.Context, roleIds uuid.UUIDs) error {
+	b.published = append(b.published, roleIds)
+	return nil
+}
+
+func (b *recordingBus) Subscribe(ctx context.Context, fn func(roleIds uuid.UUIDs)) {}
+
+func TestInvalidatePublishesToOtherReplicas(t *testing.T) {
+	bus := &recordingBus{}
+	cache := NewPermissionCache(&countingLoader{}, bus, 0)
+	roleId := uuid.New()
+	cache.Invalidate(context.Background(), roleId)
+	cache.Invalidate(context.Background())
+	if len(bus.published) != 2 || bus.published[0][0] != roleId || bus.published[1] != nil {
+		t.Fatalf("unexpected invalidations %v", bus.published)
+	}
+}
+
+func TestRoleIdEncoding(t *testing.T) {
+	roleIds := uuid.UUIDs{uuid.New(), uuid.New()}
+	decoded := decodeRoleIds(encodeRoleIds(roleIds))
+	if len(decoded) != 2 || decoded[0] != roleIds[0] || decoded[1] != roleIds[1] {
+		t.Fatalf("unexpected round trip %v", decoded)
+	}
+	if decodeRoleIds(encodeRoleIds(nil)) != nil || decodeRoleIds("garbage") != nil {
+		t.Fatal("expected * and unparsable messages to invalidate every role")
+	}
+}
@@ -0,0 +1,36 @@
+package permission_cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgRolePermissionLoader loads permissions from the same view the uncached checks use.
+type PgRolePermissionLoader struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgRolePermissionLoader(db *pgxpool.Pool) *PgRolePermissionLoader {
+	return &PgRolePermissionLoader{DbConn: db}
+}
+
+func (p *PgRolePermissionLoader) LoadRolePermissions(ctx context.Context, roleIds uuid.UUIDs) (map[uuid.UUID][]string, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetPermissionNamesByRoleIds(ctx, roleIds)
+	if err != nil {
+		slog.Error("Error loading role permissions", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error loading role permissions: %w", err)
+	}
+	permissions := make(map[uuid.UUID][]string, len(roleIds))
+	for _, row := range rows {
+		if row.Permission.Valid {
+			permissions[row.RoleId] = append(permissions[row.RoleId], row.Permission.String)
+		}
+	}
+	return permissions, nil
+}
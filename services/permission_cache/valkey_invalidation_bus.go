@@ -0,0 +1,82 @@
+package permission_cache
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	valkey "github.com/valkey-io/valkey-go"
+)
+
+const (
+	DefaultInvalidationChannel = "permission_cache:invalidate"
+	invalidateAllMessage       = "*"
+)
+
+// ValkeyInvalidationBus publishes invalidations as comma separated role ids, or * for
+// every role.
+type ValkeyInvalidationBus struct {
+	client         valkey.Client
+	channel        string
+	reconnectDelay time.Duration
+}
+
+func NewValkeyInvalidationBus(client valkey.Client) *ValkeyInvalidationBus {
+	return &ValkeyInvalidationBus{
+		client:         client,
+		channel:        DefaultInvalidationChannel,
+		reconnectDelay: 5 * time.Second,
+	}
+}
+
+func (v *ValkeyInvalidationBus) Publish(ctx context.Context, roleIds uuid.UUIDs) error {
+	return v.client.Do(ctx, v.client.B().Publish().Channel(v.channel).Message(encodeRoleIds(roleIds)).Build()).Error()
+}
+
+// Subscribe resubscribes after the connection drops. Invalidations published while it was
+// down are lost, so every role is dropped on reconnect.
+func (v *ValkeyInvalidationBus) Subscribe(ctx context.Context, fn func(roleIds uuid.UUIDs)) {
+	for {
+		err := v.client.Receive(ctx, v.client.B().Subscribe().Channel(v.channel).Build(), func(msg valkey.PubSubMessage) {
+			fn(decodeRoleIds(msg.Message))
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("Permission cache invalidation subscription dropped", slog.String("error", err.Error()))
+		}
+		fn(nil)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(v.reconnectDelay):
+		}
+	}
+}
+
+func encodeRoleIds(roleIds uuid.UUIDs) string {
+	if len(roleIds) == 0 {
+		return invalidateAllMessage
+	}
+	return strings.Join(roleIds.Strings(), ",")
+}
+
+// decodeRoleIds returns nil, meaning every role, for * and for messages it cannot parse.
+func decodeRoleIds(msg string) uuid.UUIDs {
+	if msg == invalidateAllMessage {
+		return nil
+	}
+	var roleIds uuid.UUIDs
+	for _, part := range strings.Split(msg, ",") {
+		roleId, err := uuid.Parse(part)
+		if err != nil {
+			slog.Warn("Invalid permission cache invalidation, dropping every role", slog.String("message", msg))
+			return nil
+		}
+		roleIds = append(roleIds, roleId)
+	}
+	return roleIds
+}
@@ -0,0 +1,163 @@
+package rbac_sync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/permission_cache"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const ResourceRbac = "rbac"
+
+type PgRbacSync struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgRbacSync(db *pgxpool.Pool) *PgRbacSync {
+	return &PgRbacSync{DbConn: db}
+}
+
+// Sync plans the document against the database and, unless opts.DryRun is set, applies
+// the plan in one transaction. The plan is built inside the transaction after taking the
+// sync lock, so it is exactly what gets applied.
+func (p *PgRbacSync) Sync(ctx context.Context, doc Document, opts SyncOptions) (Plan, error) {
+	if err := doc.Validate(); err != nil {
+		return Plan{}, err
+	}
+
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		return Plan{}, fmt.Errorf("error starting rbac sync transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qry := infra_db_pg.New(tx)
+	if err := qry.LockRbacSync(ctx); err != nil {
+		return Plan{}, fmt.Errorf("error locking rbac sync: %w", err)
+	}
+	state, err := loadState(ctx, qry)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan, err := BuildPlan(doc, state, opts.Prune)
+	if err != nil {
+		return plan, err
+	}
+	plan.DryRun = opts.DryRun
+	if opts.DryRun || len(plan.Changes) == 0 {
+		return plan, nil
+	}
+
+	if err := applyPlan(ctx, qry, state, plan); err != nil {
+		slog.Error("Error applying rbac plan", slog.String("error", err.Error()))
+		return plan, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return plan, fmt.Errorf("error committing rbac sync: %w", err)
+	}
+	plan.Applied = true
+	slog.Info("Applied rbac plan", slog.Int("changes", len(plan.Changes)), slog.Bool("prune", opts.Prune))
+
+	permission_cache.Invalidate(ctx)
+	audit_log.Record(ctx, audit_log.Event{
+		Action:       audit_log.ActionUpdate,
+		ResourceType: ResourceRbac,
+		After:        plan,
+	})
+	return plan, nil
+}
+
+func loadState(ctx context.Context, qry *infra_db_pg.Queries) (State, error) {
+	var state State
+	permissions, err := qry.GetAllAppPermissions(ctx)
+	if err != nil {
+		return state, fmt.Errorf("error reading permissions: %w", err)
+	}
+	for _, permission := range permissions {
+		state.Permissions = append(state.Permissions, PermissionState{
+			Id:          permission.ID,
+			Name:        permission.PermissionName,
+			Description: permission.PermissionDescription.String,
+		})
+	}
+
+	roles, err := qry.GetAllUserRolesIncludingInactive(ctx)
+	if err != nil {
+		return state, fmt.Errorf("error reading roles: %w", err)
+	}
+	for _, role := range roles {
+		state.Roles = append(state.Roles, RoleState{
+			Id:          role.ID,
+			Name:        role.RoleName,
+			Description: role.RoleDescription.String,
+			Enabled:     role.Enabled,
+			IsDeleted:   role.IsDeleted,
+		})
+	}
+
+	mappings, err := qry.GetAllRolePermissionMappings(ctx)
+	if err != nil {
+		return state, fmt.Errorf("error reading role permission mappings: %w", err)
+	}
+	for _, mapping := range mappings {
+		state.Mappings = append(state.Mappings, MappingState{
+			RoleId:       mapping.RoleID,
+			PermissionId: mapping.PermissionID,
+			Enabled:      mapping.Enabled,
+		})
+	}
+	return state, nil
+}
+
+func applyPlan(ctx context.Context, qry *infra_db_pg.Queries, state State, plan Plan) error {
+	permissionIds := make(map[string]uuid.UUID, len(state.Permissions))
+	for _, permission := range state.Permissions {
+		permissionIds[permission.Name] = permission.Id
+	}
+	roleIds := make(map[string]uuid.UUID, len(state.Roles))
+	for _, role := range state.Roles {
+		roleIds[role.Name] = role.Id
+	}
+
+	for _, change := range plan.Changes {
+		var err error
+		switch {
+		case change.Kind == KindPermission:
+			var row infra_db_pg.AppPermission
+			row, err = qry.InsertOrUpdateAppPermission(ctx, infra_db_pg.InsertOrUpdateAppPermissionParams{
+				PermissionName:        change.Permission,
+				PermissionDescription: pgtype.Text{String: change.Description, Valid: change.Description != ""},
+			})
+			permissionIds[change.Permission] = row.ID
+		case change.Kind == KindRole && change.Action == ActionDisable:
+			err = qry.DisableUserRoleById(ctx, roleIds[change.Role])
+		case change.Kind == KindRole:
+			var row infra_db_pg.UserRole
+			row, err = qry.InsertOrUpdateUserRole(ctx, infra_db_pg.InsertOrUpdateUserRoleParams{
+				RoleName:        change.Role,
+				RoleDescription: pgtype.Text{String: change.Description, Valid: change.Description != ""},
+			})
+			roleIds[change.Role] = row.ID
+		case change.Kind == KindMapping && change.Action == ActionDisable:
+			err = qry.DisableRolePermissionMapping(ctx, infra_db_pg.DisableRolePermissionMappingParams{
+				RoleID:       roleIds[change.Role],
+				PermissionID: permissionIds[change.Permission],
+			})
+		case change.Kind == KindMapping:
+			_, err = qry.InsertOrUpdateRolePermissionMapping(ctx, infra_db_pg.InsertOrUpdateRolePermissionMappingParams{
+				RoleID:       roleIds[change.Role],
+				PermissionID: permissionIds[change.Permission],
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("error applying %s: %w", change, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package rbac_sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+var ErrInvalidDocument = errors.New("invalid rbac document")
+
+// Document is the desired set of permissions and roles. JSON documents are accepted
+// wherever YAML is, since JSON is valid YAML.
+//
+// swagger:model RbacDocument
+type Document struct {
+	Permissions []PermissionSpec `json:"permissions"`
+	Roles       []RoleSpec       `json:"roles"`
+}
+
+// PermissionSpec declares a permission. An empty description keeps the current one.
+type PermissionSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// RoleSpec declares a role and every permission it should hold. Permissions may be
+// declared in the same document or already exist.
+type RoleSpec struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// ParseDocument decodes a YAML or JSON document. Unknown fields are rejected so a typo
+// cannot silently drop part of the policy.
+func ParseDocument(data []byte) (Document, error) {
+	var doc Document
+	if err := yaml.UnmarshalWithOptions(data, &doc, yaml.DisallowUnknownField()); err != nil {
+		return doc, fmt.Errorf("%w: %s", ErrInvalidDocument, err.Error())
+	}
+	return doc, doc.Validate()
+}
+
+func ReadDocumentFile(path string) (Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Document{}, fmt.Errorf("error reading rbac document: %w", err)
+	}
+	return ParseDocument(data)
+}
+
+// Validate checks names are present and declared once. References to permissions outside
+// the document are checked against the database when planning.
+func (d Document) Validate() error {
+	permissions := make(map[string]bool, len(d.Permissions))
+	for _, permission := range d.Permissions {
+		name := strings.TrimSpace(permission.Name)
+		if name == "" {
+			return fmt.Errorf("%w: permission without a name", ErrInvalidDocument)
+		}
+		if permissions[name] {
+			return fmt.Errorf("%w: permission %q is declared twice", ErrInvalidDocument, name)
+		}
+		permissions[name] = true
+	}
+
+	roles := make(map[string]bool, len(d.Roles))
+	for _, role := range d.Roles {
+		name := strings.TrimSpace(role.Name)
+		if name == "" {
+			return fmt.Errorf("%w: role without a name", ErrInvalidDocument)
+		}
+		if roles[name] {
+			return fmt.Errorf("%w: role %q is declared twice", ErrInvalidDocument, name)
+		}
+		roles[name] = true
+		for _, permission := range role.Permissions {
+			if strings.TrimSpace(permission) == "" {
+				return fmt.Errorf("%w: role %q lists an empty permission", ErrInvalidDocument, name)
+			}
+		}
+	}
+	return nil
+}
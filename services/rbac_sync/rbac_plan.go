@@ -0,0 +1,195 @@
+package rbac_sync
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionEnable  = "enable"
+	ActionDisable = "disable"
+
+	KindPermission = "permission"
+	KindRole       = "role"
+	KindMapping    = "mapping"
+)
+
+// SyncOptions controls how a document is applied.
+type SyncOptions struct {
+	// DryRun only returns the plan.
+	DryRun bool
+	// Prune disables roles missing from the document and mappings a declared role no
+	// longer lists. Permissions are never removed since the API checks them by name.
+	Prune bool
+}
+
+// Change is one step of a plan.
+//
+// swagger:model RbacChange
+type Change struct {
+	Action      string `json:"action"`
+	Kind        string `json:"kind"`
+	Role        string `json:"role,omitempty"`
+	Permission  string `json:"permission,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case KindMapping:
+		return fmt.Sprintf("%s %s %s -> %s", c.Action, c.Kind, c.Role, c.Permission)
+	case KindRole:
+		return fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Role)
+	default:
+		return fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Permission)
+	}
+}
+
+// Plan lists the changes needed to reach the document, in the order they are applied.
+//
+// swagger:model RbacPlan
+type Plan struct {
+	Changes []Change `json:"changes"`
+	DryRun  bool     `json:"dryRun"`
+	Applied bool     `json:"applied"`
+}
+
+// State is the current RBAC configuration in the database.
+type State struct {
+	Permissions []PermissionState
+	Roles       []RoleState
+	Mappings    []MappingState
+}
+
+type PermissionState struct {
+	Id          uuid.UUID
+	Name        string
+	Description string
+}
+
+type RoleState struct {
+	Id          uuid.UUID
+	Name        string
+	Description string
+	Enabled     bool
+	IsDeleted   bool
+}
+
+type MappingState struct {
+	RoleId       uuid.UUID
+	PermissionId uuid.UUID
+	Enabled      bool
+}
+
+type mappingKey struct {
+	role       string
+	permission string
+}
+
+// BuildPlan diffs the document against state. Permissions come first, then roles, then
+// mappings, so every change only depends on earlier ones.
+func BuildPlan(doc Document, state State, prune bool) (Plan, error) {
+	plan := Plan{Changes: make([]Change, 0)}
+
+	permissionsById := make(map[uuid.UUID]PermissionState, len(state.Permissions))
+	permissionsByName := make(map[string]PermissionState, len(state.Permissions))
+	for _, permission := range state.Permissions {
+		permissionsById[permission.Id] = permission
+		permissionsByName[permission.Name] = permission
+	}
+	rolesById := make(map[uuid.UUID]RoleState, len(state.Roles))
+	rolesByName := make(map[string]RoleState, len(state.Roles))
+	for _, role := range state.Roles {
+		rolesById[role.Id] = role
+		rolesByName[role.Name] = role
+	}
+	mappings := make(map[mappingKey]bool, len(state.Mappings))
+	for _, mapping := range state.Mappings {
+		role, okRole := rolesById[mapping.RoleId]
+		permission, okPermission := permissionsById[mapping.PermissionId]
+		if okRole && okPermission {
+			mappings[mappingKey{role.Name, permission.Name}] = mapping.Enabled
+		}
+	}
+
+	declared := make(map[string]bool, len(doc.Permissions))
+	for _, spec := range doc.Permissions {
+		name := strings.TrimSpace(spec.Name)
+		declared[name] = true
+		current, exists := permissionsByName[name]
+		switch {
+		case !exists:
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Kind: KindPermission, Permission: name, Description: spec.Description})
+		case spec.Description != "" && spec.Description != current.Description:
+			plan.Changes = append(plan.Changes, Change{Action: ActionUpdate, Kind: KindPermission, Permission: name, Description: spec.Description})
+		}
+	}
+
+	declaredRoles := make(map[string]bool, len(doc.Roles))
+	for _, spec := range doc.Roles {
+		name := strings.TrimSpace(spec.Name)
+		declaredRoles[name] = true
+		current, exists := rolesByName[name]
+		description := spec.Description
+		if description == "" {
+			description = current.Description
+		}
+		switch {
+		case !exists:
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Kind: KindRole, Role: name, Description: description})
+		case !current.Enabled || current.IsDeleted:
+			plan.Changes = append(plan.Changes, Change{Action: ActionEnable, Kind: KindRole, Role: name, Description: description})
+		case description != current.Description:
+			plan.Changes = append(plan.Changes, Change{Action: ActionUpdate, Kind: KindRole, Role: name, Description: description})
+		}
+	}
+
+	for _, spec := range doc.Roles {
+		role := strings.TrimSpace(spec.Name)
+		listed := make(map[string]bool, len(spec.Permissions))
+		for _, permission := range spec.Permissions {
+			permission = strings.TrimSpace(permission)
+			if listed[permission] {
+				continue
+			}
+			listed[permission] = true
+			if _, exists := permissionsByName[permission]; !exists && !declared[permission] {
+				return plan, fmt.Errorf("%w: role %q lists unknown permission %q", ErrInvalidDocument, role, permission)
+			}
+			enabled, exists := mappings[mappingKey{role, permission}]
+			switch {
+			case !exists:
+				plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Kind: KindMapping, Role: role, Permission: permission})
+			case !enabled:
+				plan.Changes = append(plan.Changes, Change{Action: ActionEnable, Kind: KindMapping, Role: role, Permission: permission})
+			}
+		}
+		if !prune {
+			continue
+		}
+		var extras []string
+		for key, enabled := range mappings {
+			if key.role == role && enabled && !listed[key.permission] {
+				extras = append(extras, key.permission)
+			}
+		}
+		slices.Sort(extras)
+		for _, permission := range extras {
+			plan.Changes = append(plan.Changes, Change{Action: ActionDisable, Kind: KindMapping, Role: role, Permission: permission})
+		}
+	}
+
+	if prune {
+		for _, role := range state.Roles {
+			if !declaredRoles[role.Name] && role.Enabled && !role.IsDeleted {
+				plan.Changes = append(plan.Changes, Change{Action: ActionDisable, Kind: KindRole, Role: role.Name})
+			}
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,63 @@
+package rbac_sync
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const maxDocumentBytes = 1 << 20
+
+// swagger:route POST /rbac/sync rbac syncRbac
+// Diff a YAML or JSON document of roles, permissions and mappings against the database and apply it in one transaction.
+// Pass dryRun=true to only see the plan, and prune=true to disable roles and mappings missing from the document.
+// responses:
+//
+//	200: RbacPlanResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func SyncRbacHandler(syncer RbacSyncer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts SyncOptions
+		for name, target := range map[string]*bool{"dryRun": &opts.DryRun, "prune": &opts.Prune} {
+			value := r.URL.Query().Get(name)
+			if value == "" {
+				continue
+			}
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocumentBytes))
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		doc, err := ParseDocument(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		plan, err := syncer.Sync(r.Context(), doc, opts)
+		switch {
+		case errors.Is(err, ErrInvalidDocument):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := RbacPlanResponse{Body: plan}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
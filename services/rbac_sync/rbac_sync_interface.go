@@ -0,0 +1,9 @@
+package rbac_sync
+
+import "context"
+
+// RbacSyncer reconciles roles, permissions and role permission mappings with a declarative
+// document.
+type RbacSyncer interface {
+	Sync(ctx context.Context, doc Document, opts SyncOptions) (Plan, error)
+}
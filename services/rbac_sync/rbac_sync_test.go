@@ -0,0 +1,96 @@
+package rbac_sync
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testDocument = `
+permissions:
+  - name: ReadHostServers
+    description: Read host servers
+  - name: SyncRbac
+roles:
+  - name: Operators
+    description: Day to day operations
+    permissions: [ReadHostServers, CreateUser]
+  - name: Auditors
+    permissions: [ReadHostServers]
+`
+
+func TestBuildPlan(t *testing.T) {
+	doc, err := ParseDocument([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readHosts, createUser, alterRole := uuid.New(), uuid.New(), uuid.New()
+	operators, auditors, legacy := uuid.New(), uuid.New(), uuid.New()
+	state := State{
+		Permissions: []PermissionState{
+			{Id: readHosts, Name: "ReadHostServers", Description: "Read host servers"},
+			{Id: createUser, Name: "CreateUser"},
+			{Id: alterRole, Name: "AlterRole"},
+		},
+		Roles: []RoleState{
+			{Id: auditors, Name: "Auditors", Enabled: false},
+			{Id: legacy, Name: "Legacy", Enabled: true},
+			{Id: operators, Name: "Operators", Description: "Ops", Enabled: true},
+		},
+		Mappings: []MappingState{
+			{RoleId: operators, PermissionId: readHosts, Enabled: true},
+			{RoleId: operators, PermissionId: createUser, Enabled: false},
+			{RoleId: operators, PermissionId: alterRole, Enabled: true},
+		},
+	}
+
+	plan, err := BuildPlan(doc, state, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, change := range plan.Changes {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"create permission SyncRbac",
+		"update role Operators",
+		"enable role Auditors",
+		"enable mapping Operators -> CreateUser",
+		"disable mapping Operators -> AlterRole",
+		"create mapping Auditors -> ReadHostServers",
+		"disable role Legacy",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("unexpected plan\n got: %q\nwant: %q", got, want)
+	}
+
+	plan, err = BuildPlan(doc, state, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range plan.Changes {
+		if change.Action == ActionDisable {
+			t.Fatalf("expected nothing to be disabled without prune, got %s", change)
+		}
+	}
+}
+
+func TestBuildPlanRejectsUnknownPermission(t *testing.T) {
+	doc := Document{Roles: []RoleSpec{{Name: "Operators", Permissions: []string{"DoesNotExist"}}}}
+	if _, err := BuildPlan(doc, State{}, false); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected an unknown permission to be rejected, got %v", err)
+	}
+}
+
+func TestParseDocumentRejectsTyposAndDuplicates(t *testing.T) {
+	if _, err := ParseDocument([]byte(`{"roles": [{"name": "Ops", "permision": ["CreateUser"]}]}`)); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected an unknown field to be rejected, got %v", err)
+	}
+	if _, err := ParseDocument([]byte("roles:\n  - name: Ops\n  - name: Ops\n")); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected a duplicate role to be rejected, got %v", err)
+	}
+}
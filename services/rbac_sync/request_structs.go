@@ -0,0 +1,23 @@
+package rbac_sync
+
+// swagger:parameters syncRbac
+type SyncRbacRequestWrapper struct {
+	// Only return the plan
+	//
+	// In: query
+	DryRun bool `json:"dryRun"`
+	// Disable roles missing from the document and mappings a declared role no longer lists
+	//
+	// In: query
+	Prune bool `json:"prune"`
+	// YAML or JSON document
+	//
+	// in: body
+	Body Document `json:"body"`
+}
+
+// swagger:response RbacPlanResponse
+type RbacPlanResponse struct {
+	// in: body
+	Body Plan `json:"plan"`
+}
@@ -0,0 +1,231 @@
+package resource_policy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RolePermissionScope is one scope on a role permission.
+//
+// swagger:model RolePermissionScope
+type RolePermissionScope struct {
+	Id             uuid.UUID `json:"id"`
+	RoleId         uuid.UUID `json:"roleId"`
+	PermissionId   uuid.UUID `json:"permissionId"`
+	PermissionName string    `json:"permissionName,omitempty"`
+	Scope          Scope     `json:"scope"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// AddRoleScopeRequest restricts a permission the role already holds.
+//
+// swagger:model AddRoleScopeRequest
+type AddRoleScopeRequest struct {
+	RoleId       uuid.UUID `json:"roleId"`
+	PermissionId uuid.UUID `json:"permissionId"`
+	// One of host_server, host_server_type, tag or external_application
+	Type string `json:"type"`
+	// A host server id, host server type id, tag or external application id
+	Value string `json:"value"`
+}
+
+type PgResourcePolicy struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgResourcePolicy(db *pgxpool.Pool) *PgResourcePolicy {
+	return &PgResourcePolicy{DbConn: db}
+}
+
+func (p *PgResourcePolicy) GrantFor(ctx context.Context, roleIds uuid.UUIDs, permissionName string) (Grant, error) {
+	var grant Grant
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetPermissionScopesForRoles(ctx, infra_db_pg.GetPermissionScopesForRolesParams{
+		RoleIds:        roleIds,
+		PermissionName: permissionName,
+	})
+	if err != nil {
+		slog.Error("Error reading permission scopes", slog.String("permission", permissionName), slog.String("error", err.Error()))
+		return grant, fmt.Errorf("error reading permission scopes: %w", err)
+	}
+	return grantFromRows(rows), nil
+}
+
+// grantFromRows combines the scopes of every role. A role whose mapping has no scope rows
+// comes back as a single row with a NULL scope and lifts all restrictions.
+func grantFromRows(rows []infra_db_pg.GetPermissionScopesForRolesRow) Grant {
+	var grant Grant
+	for _, row := range rows {
+		if !row.ScopeType.Valid {
+			return Grant{Unrestricted: true}
+		}
+		scope := Scope{Type: row.ScopeType.String, Value: row.ScopeValue.String}
+		if !slices.Contains(grant.Scopes, scope) {
+			grant.Scopes = append(grant.Scopes, scope)
+		}
+	}
+	return grant
+}
+
+func (p *PgResourcePolicy) HostServer(ctx context.Context, id uuid.UUID) (Resource, error) {
+	resources, err := p.hostServerResources(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if err != nil {
+		return Resource{}, err
+	}
+	resource, ok := resources[id]
+	if !ok {
+		return Resource{}, ErrResourceNotFound
+	}
+	return resource, nil
+}
+
+func (p *PgResourcePolicy) HostServers(ctx context.Context) (map[uuid.UUID]Resource, error) {
+	return p.hostServerResources(ctx, pgtype.UUID{})
+}
+
+func (p *PgResourcePolicy) hostServerResources(ctx context.Context, id pgtype.UUID) (map[uuid.UUID]Resource, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetHostServerScopeAttributes(ctx, id)
+	if err != nil {
+		slog.Error("Error reading host server scope attributes", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error reading host server attributes: %w", err)
+	}
+	resources := make(map[uuid.UUID]Resource, len(rows))
+	for _, row := range rows {
+		resources[row.ID] = Resource{Id: row.ID, HostServerTypeIds: row.HostServerTypeIds, Tags: row.Tags}
+	}
+	return resources, nil
+}
+
+func (p *PgResourcePolicy) GetRoleScopes(ctx context.Context, roleId uuid.UUID) ([]RolePermissionScope, error) {
+	scopes := make([]RolePermissionScope, 0)
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetRolePermissionScopesByRoleId(ctx, roleId)
+	if err != nil {
+		slog.Error("Error listing role permission scopes", slog.String("roleId", roleId.String()), slog.String("error", err.Error()))
+		return scopes, fmt.Errorf("error listing role permission scopes: %w", err)
+	}
+	for _, row := range rows {
+		scopes = append(scopes, RolePermissionScope{
+			Id:             row.ID,
+			RoleId:         row.RoleID,
+			PermissionId:   row.PermissionID,
+			PermissionName: row.PermissionName,
+			Scope:          Scope{Type: row.ScopeType, Value: row.ScopeValue},
+			CreatedAt:      row.CreatedAt.Time,
+		})
+	}
+	return scopes, nil
+}
+
+func (p *PgResourcePolicy) AddRoleScope(ctx context.Context, req AddRoleScopeRequest) (RolePermissionScope, error) {
+	var scope RolePermissionScope
+	value := strings.TrimSpace(req.Value)
+	if req.Type != ScopeTag {
+		value = strings.ToLower(value)
+	}
+	requested := Scope{Type: req.Type, Value: value}
+	if err := requested.Validate(); err != nil {
+		return scope, err
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	held, err := qry.RoleHoldsPermission(ctx, infra_db_pg.RoleHoldsPermissionParams{RoleID: req.RoleId, PermissionID: req.PermissionId})
+	if err != nil {
+		slog.Error("Error checking role permission", slog.String("roleId", req.RoleId.String()), slog.String("error", err.Error()))
+		return scope, fmt.Errorf("error checking role permission: %w", err)
+	}
+	if !held {
+		return scope, ErrPermissionNotHeld
+	}
+	row, err := qry.InsertRolePermissionScope(ctx, infra_db_pg.InsertRolePermissionScopeParams{
+		RoleID:       req.RoleId,
+		PermissionID: req.PermissionId,
+		ScopeType:    requested.Type,
+		ScopeValue:   requested.Value,
+	})
+	if err != nil {
+		slog.Error("Error adding role permission scope", slog.String("roleId", req.RoleId.String()), slog.String("error", err.Error()))
+		return scope, fmt.Errorf("error adding role permission scope: %w", err)
+	}
+	scope = RolePermissionScope{
+		Id:           row.ID,
+		RoleId:       row.RoleID,
+		PermissionId: row.PermissionID,
+		Scope:        Scope{Type: row.ScopeType, Value: row.ScopeValue},
+		CreatedAt:    row.CreatedAt.Time,
+	}
+	return scope, nil
+}
+
+func (p *PgResourcePolicy) RemoveRoleScope(ctx context.Context, roleId, scopeId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	removed, err := qry.DeleteRolePermissionScope(ctx, infra_db_pg.DeleteRolePermissionScopeParams{ID: scopeId, RoleID: roleId})
+	if err != nil {
+		slog.Error("Error removing role permission scope", slog.String("scopeId", scopeId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error removing role permission scope: %w", err)
+	}
+	if removed == 0 {
+		return ErrScopeNotFound
+	}
+	return nil
+}
+
+func (p *PgResourcePolicy) GetHostServerTags(ctx context.Context, hostServerId uuid.UUID) ([]string, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	tags, err := qry.GetHostServerTags(ctx, hostServerId)
+	if err != nil {
+		slog.Error("Error reading host server tags", slog.String("hostServerId", hostServerId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error reading host server tags: %w", err)
+	}
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	return tags, nil
+}
+
+// SetHostServerTags replaces every tag on the host server.
+func (p *PgResourcePolicy) SetHostServerTags(ctx context.Context, hostServerId uuid.UUID, tags []string) ([]string, error) {
+	if _, err := p.HostServer(ctx, hostServerId); err != nil {
+		return nil, err
+	}
+	cleaned := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(cleaned, tag) {
+			cleaned = append(cleaned, tag)
+		}
+	}
+
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qry := infra_db_pg.New(tx)
+	if err := qry.DeleteHostServerTags(ctx, hostServerId); err != nil {
+		return nil, fmt.Errorf("error clearing host server tags: %w", err)
+	}
+	if len(cleaned) > 0 {
+		err = qry.InsertHostServerTags(ctx, infra_db_pg.InsertHostServerTagsParams{HostServerID: hostServerId, Tags: cleaned})
+		if err != nil {
+			slog.Error("Error setting host server tags", slog.String("hostServerId", hostServerId.String()), slog.String("error", err.Error()))
+			return nil, fmt.Errorf("error setting host server tags: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	slices.Sort(cleaned)
+	return cleaned, nil
+}
@@ -0,0 +1,38 @@
+package resource_policy
+
+// HostServerTags is the full set of tags on a host server.
+//
+// swagger:model HostServerTags
+type HostServerTags struct {
+	Tags []string `json:"tags"`
+}
+
+// swagger:parameters addRolePermissionScope
+type AddRoleScopeRequestWrapper struct {
+	// in: body
+	Body AddRoleScopeRequest `json:"body"`
+}
+
+// swagger:parameters setHostServerTags
+type SetHostServerTagsRequestWrapper struct {
+	// in: body
+	Body HostServerTags `json:"body"`
+}
+
+// swagger:response RolePermissionScopesResponse
+type RolePermissionScopesResponse struct {
+	// in: body
+	Body []RolePermissionScope `json:"scopes"`
+}
+
+// swagger:response RolePermissionScopeResponse
+type RolePermissionScopeResponse struct {
+	// in: body
+	Body RolePermissionScope `json:"scope"`
+}
+
+// swagger:response HostServerTagsResponse
+type HostServerTagsResponse struct {
+	// in: body
+	Body HostServerTags `json:"tags"`
+}
@@ -0,0 +1,173 @@
+package resource_policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeHostServer     = "host_server"
+	ScopeHostServerType = "host_server_type"
+	ScopeTag            = "tag"
+	// Limits the external application permissions to one application.
+	ScopeExternalApplication = "external_application"
+)
+
+var (
+	ErrResourceNotFound = errors.New("resource not found")
+	ErrScopeNotFound    = errors.New("permission scope not found")
+	ErrInvalidScope     = errors.New("invalid permission scope")
+	// Scopes can only narrow a permission the role already holds.
+	ErrPermissionNotHeld = errors.New("role does not hold the permission")
+	// Returned by providers for resources the caller's grant does not reach.
+	ErrOutOfScope = errors.New("resource outside permission scope")
+)
+
+var (
+	defaultPolicyMu sync.RWMutex
+	defaultPolicy   ResourcePolicy
+)
+
+// SetDefault sets the policy used by the resource permission middleware.
+func SetDefault(p ResourcePolicy) {
+	defaultPolicyMu.Lock()
+	defer defaultPolicyMu.Unlock()
+	defaultPolicy = p
+}
+
+// Default returns the configured policy or nil, in which case permissions are not scoped.
+func Default() ResourcePolicy {
+	defaultPolicyMu.RLock()
+	defer defaultPolicyMu.RUnlock()
+	return defaultPolicy
+}
+
+// Scope limits a permission to resources with a matching attribute.
+type Scope struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (s Scope) Validate() error {
+	switch s.Type {
+	case ScopeHostServer, ScopeHostServerType, ScopeExternalApplication:
+		if _, err := uuid.Parse(s.Value); err != nil {
+			return fmt.Errorf("%w: %s scopes take an id", ErrInvalidScope, s.Type)
+		}
+	case ScopeTag:
+		if s.Value == "" {
+			return fmt.Errorf("%w: tag scopes take a tag", ErrInvalidScope)
+		}
+	default:
+		return fmt.Errorf("%w: unknown scope type %q", ErrInvalidScope, s.Type)
+	}
+	return nil
+}
+
+// Resource is the set of attributes a scope is matched against.
+type Resource struct {
+	Id                uuid.UUID
+	HostServerTypeIds []uuid.UUID
+	Tags              []string
+}
+
+// Grant is the combined reach of a permission across all of a caller's roles. A role
+// holding the permission without scopes makes the grant unrestricted, otherwise a
+// resource is allowed when it matches any scope of any role.
+type Grant struct {
+	Unrestricted bool
+	Scopes       []Scope
+}
+
+func (g Grant) Allows(resource Resource) bool {
+	if g.Unrestricted {
+		return true
+	}
+	for _, scope := range g.Scopes {
+		switch scope.Type {
+		case ScopeHostServer, ScopeExternalApplication:
+			if scope.Value == resource.Id.String() {
+				return true
+			}
+		case ScopeHostServerType:
+			for _, typeId := range resource.HostServerTypeIds {
+				if scope.Value == typeId.String() {
+					return true
+				}
+			}
+		case ScopeTag:
+			if slices.Contains(resource.Tags, scope.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type grantContextKey struct{}
+
+// WithGrant stores the grant the middleware resolved for the request.
+func WithGrant(ctx context.Context, grant Grant) context.Context {
+	return context.WithValue(ctx, grantContextKey{}, grant)
+}
+
+// GrantFromContext returns the grant resolved for the request. Requests that did not go
+// through the resource permission middleware have no grant.
+func GrantFromContext(ctx context.Context) (Grant, bool) {
+	grant, ok := ctx.Value(grantContextKey{}).(Grant)
+	return grant, ok
+}
+
+// FilterHostServerIds returns the ids the grant in ctx allows, in their original order.
+// Without a grant or policy every id is returned.
+func FilterHostServerIds(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	grant, ok := GrantFromContext(ctx)
+	policy := Default()
+	if !ok || grant.Unrestricted || policy == nil {
+		return ids, nil
+	}
+	resources, err := policy.HostServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if resource, ok := resources[id]; ok && grant.Allows(resource) {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+// AllowsHostServer reports whether the grant in ctx reaches the host server. Without a
+// grant or policy every host server is allowed, unknown ids never are.
+func AllowsHostServer(ctx context.Context, id uuid.UUID) (bool, error) {
+	grant, ok := GrantFromContext(ctx)
+	policy := Default()
+	if !ok || grant.Unrestricted || policy == nil {
+		return true, nil
+	}
+	resource, err := policy.HostServer(ctx, id)
+	if errors.Is(err, ErrResourceNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return grant.Allows(resource), nil
+}
+
+// AllowsExternalApplication reports whether the grant in ctx reaches the application.
+// Without a grant or policy every application is allowed.
+func AllowsExternalApplication(ctx context.Context, id uuid.UUID) bool {
+	grant, ok := GrantFromContext(ctx)
+	if !ok || Default() == nil {
+		return true
+	}
+	return grant.Allows(Resource{Id: id})
+}
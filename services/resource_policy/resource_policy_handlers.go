@@ -0,0 +1,181 @@
+package resource_policy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// swagger:route GET /roles/{ID}/permission-scopes roles getRolePermissionScopes
+// List the resource scopes on a role's permissions. Permissions without scopes apply to every resource.
+// responses:
+//
+//	200: RolePermissionScopesResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func GetRoleScopesHandler(manager ScopeManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roleId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid role ID", http.StatusBadRequest)
+			return
+		}
+
+		scopes, err := manager.GetRoleScopes(r.Context(), roleId)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := RolePermissionScopesResponse{Body: scopes}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// Restrict a role permission to a host server, host server type, tag or external application. The role must hold the permission. Adding the first scope turns an unrestricted permission into a scoped one.
+// Restrict a role permission to a host server, host server type or tag. Adding the first scope turns an unrestricted permission into a scoped one.
+// responses:
+//
+//	201: RolePermissionScopeResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func AddRoleScopeHandler(manager ScopeManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roleId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid role ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AddRoleScopeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.RoleId = roleId
+
+		scope, err := manager.AddRoleScope(r.Context(), req)
+		switch {
+		case errors.Is(err, ErrInvalidScope), errors.Is(err, ErrPermissionNotHeld):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := RolePermissionScopeResponse{Body: scope}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route DELETE /roles/{ID}/permission-scopes/{scopeId} roles removeRolePermissionScope
+// Remove a scope from a role permission. Removing the last scope makes the permission unrestricted again.
+// responses:
+//
+//	204: description:Scope removed
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func RemoveRoleScopeHandler(manager ScopeManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roleId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid role ID", http.StatusBadRequest)
+			return
+		}
+		scopeId, err := uuid.Parse(r.PathValue("scopeId"))
+		if err != nil {
+			http.Error(w, "Invalid scope ID", http.StatusBadRequest)
+			return
+		}
+
+		err = manager.RemoveRoleScope(r.Context(), roleId, scopeId)
+		switch {
+		case errors.Is(err, ErrScopeNotFound):
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route GET /host-servers/{ID}/tags host-servers getHostServerTags
+// List the tags on a host server.
+// responses:
+//
+//	200: HostServerTagsResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Forbidden
+//	500: description:Internal Server Error
+func GetHostServerTagsHandler(manager ScopeManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hostServerId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		tags, err := manager.GetHostServerTags(r.Context(), hostServerId)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := HostServerTagsResponse{Body: HostServerTags{Tags: tags}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route PUT /host-servers/{ID}/tags host-servers setHostServerTags
+// Replace the tags on a host server.
+// responses:
+//
+//	200: HostServerTagsResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Forbidden
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func SetHostServerTagsHandler(manager ScopeManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hostServerId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		var req HostServerTags
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tags, err := manager.SetHostServerTags(r.Context(), hostServerId, req.Tags)
+		switch {
+		case errors.Is(err, ErrResourceNotFound):
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := HostServerTagsResponse{Body: HostServerTags{Tags: tags}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
@@ -0,0 +1,24 @@
+package resource_policy
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ResourcePolicy resolves how far a permission held through a set of roles reaches, and
+// the attributes of the resources it is checked against.
+type ResourcePolicy interface {
+	GrantFor(ctx context.Context, roleIds uuid.UUIDs, permissionName string) (Grant, error)
+	HostServer(ctx context.Context, id uuid.UUID) (Resource, error)
+	HostServers(ctx context.Context) (map[uuid.UUID]Resource, error)
+}
+
+// ScopeManager edits the scopes on role permissions and the tags they can match.
+type ScopeManager interface {
+	GetRoleScopes(ctx context.Context, roleId uuid.UUID) ([]RolePermissionScope, error)
+	AddRoleScope(ctx context.Context, req AddRoleScopeRequest) (RolePermissionScope, error)
+	RemoveRoleScope(ctx context.Context, roleId, scopeId uuid.UUID) error
+	GetHostServerTags(ctx context.Context, hostServerId uuid.UUID) ([]string, error)
+	SetHostServerTags(ctx context.Context, hostServerId uuid.UUID, tags []string) ([]string, error)
+}
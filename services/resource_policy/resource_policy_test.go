@@ -0,0 +1,134 @@
+package resource_policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type fakePolicy struct {
+	resources map[uuid.UUID]Resource
+}
+
+func (f fakePolicy) GrantFor(ctx context.Context, roleIds uuid.UUIDs, permissionName string) (Grant, error) {
+	return Grant{}, nil
+}
+
+func (f fakePolicy) HostServer(ctx context.Context, id uuid.UUID) (Resource, error) {
+	return f.resources[id], nil
+}
+
+func (f fakePolicy) HostServers(ctx context.Context) (map[uuid.UUID]Resource, error) {
+	return f.resources, nil
+}
+
+func TestGrantAllowsMatchingScopes(t *testing.T) {
+	dbType, webType := uuid.New(), uuid.New()
+	server := Resource{Id: uuid.New(), HostServerTypeIds: []uuid.UUID{dbType}, Tags: []string{"prod"}}
+
+	cases := []struct {
+		name  string
+		grant Grant
+		want  bool
+	}{
+		{"unrestricted", Grant{Unrestricted: true}, true},
+		{"no scopes", Grant{}, false},
+		{"host server", Grant{Scopes: []Scope{{ScopeHostServer, server.Id.String()}}}, true},
+		{"other host server", Grant{Scopes: []Scope{{ScopeHostServer, uuid.NewString()}}}, false},
+		{"host server type", Grant{Scopes: []Scope{{ScopeHostServerType, dbType.String()}}}, true},
+		{"other host server type", Grant{Scopes: []Scope{{ScopeHostServerType, webType.String()}}}, false},
+		{"tag", Grant{Scopes: []Scope{{ScopeTag, "staging"}, {ScopeTag, "prod"}}}, true},
+		{"other tag", Grant{Scopes: []Scope{{ScopeTag, "Prod"}}}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.grant.Allows(server); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestGrantFromRowsUnscopedRoleWins(t *testing.T) {
+	scoped := infra_db_pg.GetPermissionScopesForRolesRow{
+		RoleId:     uuid.New(),
+		ScopeType:  pgtype.Text{String: ScopeTag, Valid: true},
+		ScopeValue: pgtype.Text{String: "prod", Valid: true},
+	}
+	grant := grantFromRows([]infra_db_pg.GetPermissionScopesForRolesRow{scoped, scoped})
+	if grant.Unrestricted || len(grant.Scopes) != 1 {
+		t.Fatalf("expected one deduplicated scope, got %+v", grant)
+	}
+
+	grant = grantFromRows([]infra_db_pg.GetPermissionScopesForRolesRow{scoped, {RoleId: uuid.New()}})
+	if !grant.Unrestricted {
+		t.Fatal("expected a role without scopes to make the grant unrestricted")
+	}
+}
+
+func TestFilterHostServerIds(t *testing.T) {
+	prod, dev := uuid.New(), uuid.New()
+	SetDefault(fakePolicy{resources: map[uuid.UUID]Resource{
+		prod: {Id: prod, Tags: []string{"prod"}},
+		dev:  {Id: dev, Tags: []string{"dev"}},
+	}})
+	t.Cleanup(func() { SetDefault(nil) })
+
+	ids := []uuid.UUID{prod, dev}
+	if got, err := FilterHostServerIds(context.Background(), ids); err != nil || len(got) != 2 {
+		t.Fatalf("expected no filtering without a grant, got %v: %v", got, err)
+	}
+
+	ctx := WithGrant(context.Background(), Grant{Scopes: []Scope{{ScopeTag, "dev"}}})
+	got, err := FilterHostServerIds(ctx, ids)
+	if err != nil || len(got) != 1 || got[0] != dev {
+		t.Fatalf("expected only the dev host server, got %v: %v", got, err)
+	}
+}
+
+func TestAllowsScopedResources(t *testing.T) {
+	prod, dev, app := uuid.New(), uuid.New(), uuid.New()
+	SetDefault(fakePolicy{resources: map[uuid.UUID]Resource{
+		prod: {Id: prod, Tags: []string{"prod"}},
+		dev:  {Id: dev, Tags: []string{"dev"}},
+	}})
+	t.Cleanup(func() { SetDefault(nil) })
+
+	if ok, err := AllowsHostServer(context.Background(), prod); err != nil || !ok {
+		t.Fatalf("expected no restriction without a grant, got %v: %v", ok, err)
+	}
+	if !AllowsExternalApplication(context.Background(), app) {
+		t.Fatal("expected no restriction without a grant")
+	}
+
+	ctx := WithGrant(context.Background(), Grant{Scopes: []Scope{{ScopeTag, "dev"}, {ScopeExternalApplication, app.String()}}})
+	if ok, _ := AllowsHostServer(ctx, dev); !ok {
+		t.Error("expected the dev host server to be in scope")
+	}
+	if ok, _ := AllowsHostServer(ctx, prod); ok {
+		t.Error("expected the prod host server to be out of scope")
+	}
+	if !AllowsExternalApplication(ctx, app) {
+		t.Error("expected the scoped application to be allowed")
+	}
+	if AllowsExternalApplication(ctx, uuid.New()) {
+		t.Error("expected other applications to be out of scope")
+	}
+}
+
+func TestScopeValidate(t *testing.T) {
+	if err := (Scope{ScopeHostServer, "web-01"}).Validate(); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected host server scopes to require an id, got %v", err)
+	}
+	if err := (Scope{"region", "eu"}).Validate(); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected unknown scope types to be rejected, got %v", err)
+	}
+	if err := (Scope{ScopeExternalApplication, "vault"}).Validate(); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected external application scopes to require an id, got %v", err)
+	}
+	if err := (Scope{ScopeTag, "prod"}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
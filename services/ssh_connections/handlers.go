@@ -3,6 +3,7 @@ package ssh_connections
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -12,7 +13,8 @@ import (
 	"time"
 
 	"github.com/babbage88/go-infra/api/authapi"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/google/uuid"
 )
 
@@ -54,7 +56,7 @@ func (m *SSHConnectionManager) CreateSSHConnectionHandler(w http.ResponseWriter,
 	}
 
 	// Check if user has access to this host
-	hasAccess, err := m.HasSSHAccessToHost(userID, req.HostServerID)
+	hasAccess, err := m.HasSSHAccessToHost(r.Context(), userID, req.HostServerID)
 	if err != nil {
 		slog.Error("Failed to check SSH access", "error", err)
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
@@ -66,14 +68,14 @@ func (m *SSHConnectionManager) CreateSSHConnectionHandler(w http.ResponseWriter,
 	}
 
 	// Get host server info
-	hostInfo, err := m.getHostServerInfo(req.HostServerID)
+	hostInfo, err := m.getHostServerInfo(r.Context(), req.HostServerID)
 	if err != nil {
 		http.Error(w, "Host server not found", http.StatusNotFound)
 		return
 	}
 
 	// Get SSH key for this user/host combination
-	sshKey, err := m.GetSSHKeyForHost(userID, req.HostServerID)
+	sshKey, err := m.GetSSHKeyForHost(r.Context(), userID, req.HostServerID)
 	if err != nil {
 		slog.Error("Failed to get SSH key", "error", err)
 		http.Error(w, "SSH key not found", http.StatusInternalServerError)
@@ -197,33 +199,18 @@ func (m *SSHConnectionManager) SSHWebSocketHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Inline JWT validation logic
+	// Validate the JWT against the signing keyring
 	if !strings.HasPrefix(token, "Bearer ") {
 		http.Error(w, "Unauthorized: malformed Authorization header", http.StatusUnauthorized)
 		return
 	}
 	jwtToken := strings.TrimPrefix(token, "Bearer ")
-	secret := os.Getenv("JWT_KEY")
-	if secret == "" {
-		http.Error(w, "Unauthorized: JWT_KEY not set", http.StatusUnauthorized)
-		return
-	}
-	tok, err := jwt.Parse(jwtToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
+	claims, err := authapi.ValidateAccessToken(jwtToken)
 	if err != nil {
 		slog.Error("JWT parse error", "error", err)
 		http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
 		return
 	}
-	claims, ok := tok.Claims.(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "Unauthorized: invalid token claims", http.StatusUnauthorized)
-		return
-	}
 	sub, ok := claims["sub"].(string)
 	if !ok {
 		http.Error(w, "Unauthorized: missing sub claim", http.StatusUnauthorized)
@@ -265,7 +252,27 @@ func (m *SSHConnectionManager) SSHWebSocketHandler(w http.ResponseWriter, r *htt
 			http.Error(w, "Session not found", http.StatusNotFound)
 			return
 		}
-		session, err = m.RehydrateSessionAndConnect(meta, columns, rows)
+		if meta.UserID != userID {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		// The websocket is not behind AuthMiddleware, scope the reconnect to the token's
+		// organization and SshConnect scopes here.
+		ctx := context.WithValue(r.Context(), authapi.ClaimsContextKey, claims)
+		ctx = organizations.WithActiveOrg(ctx, authapi.GetActiveOrgFromClaims(claims))
+		if policy := resource_policy.Default(); policy != nil {
+			grant, err := policy.GrantFor(ctx, authapi.GetRoleIDsFromContext(ctx), "SshConnect")
+			if err != nil {
+				http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+				return
+			}
+			ctx = resource_policy.WithGrant(ctx, grant)
+		}
+		session, err = m.RehydrateSessionAndConnect(ctx, meta, columns, rows)
+		if errors.Is(err, resource_policy.ErrOutOfScope) {
+			http.Error(w, "Access denied to this host", http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			slog.Error("Failed to rehydrate SSH session", "error", err)
 			http.Error(w, "Failed to re-establish SSH connection", http.StatusInternalServerError)
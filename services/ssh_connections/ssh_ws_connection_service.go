@@ -3,11 +3,14 @@ package ssh_connections
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/babbage88/go-infra/services/user_secrets"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -15,6 +18,9 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// ErrHostServerNotFound is returned for hosts outside the caller's active organization.
+var ErrHostServerNotFound = errors.New("host server not found")
+
 // SSH Session represents an active SSH connection
 type SSHSession struct {
 	ID           uuid.UUID
@@ -170,9 +176,16 @@ func (m *SSHConnectionManager) cleanupDatabaseSessions() {
 	}
 }
 
-// Check if user has SSH access to specific host
-func (m *SSHConnectionManager) HasSSHAccessToHost(userID, hostServerID uuid.UUID) (bool, error) {
-	mappings, err := m.db.GetSSHKeyHostMappingsByHostId(context.Background(), hostServerID)
+// Check if user has SSH access to specific host. Hosts outside the active organization or
+// the caller's SshConnect scopes in ctx are never accessible.
+func (m *SSHConnectionManager) HasSSHAccessToHost(ctx context.Context, userID, hostServerID uuid.UUID) (bool, error) {
+	if allowed, err := organizations.AllowsResource(ctx, organizations.ResourceHostServer, hostServerID); err != nil || !allowed {
+		return false, err
+	}
+	if inScope, err := resource_policy.AllowsHostServer(ctx, hostServerID); err != nil || !inScope {
+		return false, err
+	}
+	mappings, err := m.db.GetSSHKeyHostMappingsByHostId(ctx, hostServerID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check SSH access: %w", err)
 	}
@@ -186,17 +199,25 @@ func (m *SSHConnectionManager) HasSSHAccessToHost(userID, hostServerID uuid.UUID
 	return false, nil
 }
 
-// Get user's SSH key for specific host
-func (m *SSHConnectionManager) GetSSHKeyForHost(userID, hostServerID uuid.UUID) (*SSHKeyInfo, error) {
-	mappings, err := m.db.GetSSHKeyHostMappingsByHostId(context.Background(), hostServerID)
+// Get user's SSH key for specific host. Only keys of the active organization in ctx are used.
+func (m *SSHConnectionManager) GetSSHKeyForHost(ctx context.Context, userID, hostServerID uuid.UUID) (*SSHKeyInfo, error) {
+	mappings, err := m.db.GetSSHKeyHostMappingsByHostId(ctx, hostServerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get SSH key mappings: %w", err)
 	}
 
 	for _, mapping := range mappings {
 		if mapping.UserID == userID {
+			allowed, err := organizations.AllowsResource(ctx, organizations.ResourceSshKey, mapping.SshKeyID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check SSH key organization: %w", err)
+			}
+			if !allowed {
+				continue
+			}
+
 			// Get SSH key details
-			sshKey, err := m.db.GetSSHKeyById(context.Background(), mapping.SshKeyID)
+			sshKey, err := m.db.GetSSHKeyById(ctx, mapping.SshKeyID)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get SSH key: %w", err)
 			}
@@ -204,7 +225,7 @@ func (m *SSHConnectionManager) GetSSHKeyForHost(userID, hostServerID uuid.UUID)
 			// Get private key from secrets
 			var privateKey string
 			if sshKey.PrivSecretID != uuid.Nil {
-				secret, err := m.secretProvider.RetrieveSecret(sshKey.PrivSecretID)
+				secret, err := m.secretProvider.RetrieveSecretForUse(ctx, userID, sshKey.PrivSecretID)
 				if err != nil {
 					return nil, fmt.Errorf("failed to retrieve SSH key secret: %w", err)
 				}
@@ -214,7 +235,7 @@ func (m *SSHConnectionManager) GetSSHKeyForHost(userID, hostServerID uuid.UUID)
 			var passphrase string
 			// Get passphrase if key needs one from secrets
 			if sshKey.PassphraseID != nil {
-				secret, err := m.secretProvider.RetrieveSecret(*sshKey.PassphraseID)
+				secret, err := m.secretProvider.RetrieveSecretForUse(ctx, userID, *sshKey.PassphraseID)
 				if err != nil {
 					return nil, fmt.Errorf("failed to retrieve SSH key passphrase: %w", err)
 				}
@@ -235,9 +256,24 @@ func (m *SSHConnectionManager) GetSSHKeyForHost(userID, hostServerID uuid.UUID)
 	return nil, fmt.Errorf("SSH key not found for user and host")
 }
 
-// Get host server info
-func (m *SSHConnectionManager) getHostServerInfo(hostServerID uuid.UUID) (*HostServerInfo, error) {
-	server, err := m.db.GetHostServerById(context.Background(), hostServerID)
+// Get host server info. Hosts outside the active organization in ctx are reported as missing,
+// hosts outside the caller's SshConnect scopes as resource_policy.ErrOutOfScope.
+func (m *SSHConnectionManager) getHostServerInfo(ctx context.Context, hostServerID uuid.UUID) (*HostServerInfo, error) {
+	allowed, err := organizations.AllowsResource(ctx, organizations.ResourceHostServer, hostServerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check host server organization: %w", err)
+	}
+	if !allowed {
+		return nil, ErrHostServerNotFound
+	}
+	inScope, err := resource_policy.AllowsHostServer(ctx, hostServerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check host server scope: %w", err)
+	}
+	if !inScope {
+		return nil, resource_policy.ErrOutOfScope
+	}
+	server, err := m.db.GetHostServerById(ctx, hostServerID)
 	if err != nil {
 		return nil, fmt.Errorf("host server not found: %w", err)
 	}
@@ -282,12 +318,12 @@ func (m *SSHConnectionManager) updateSessionActivity(id uuid.UUID, lastActivity
 }
 
 // Rehydrate and reconnect a session from persistent store
-func (m *SSHConnectionManager) RehydrateSessionAndConnect(meta *SSHSession, columns, rows int) (*SSHSession, error) {
-	hostInfo, err := m.getHostServerInfo(meta.HostServerID)
+func (m *SSHConnectionManager) RehydrateSessionAndConnect(ctx context.Context, meta *SSHSession, columns, rows int) (*SSHSession, error) {
+	hostInfo, err := m.getHostServerInfo(ctx, meta.HostServerID)
 	if err != nil {
 		return nil, fmt.Errorf("host info not found: %w", err)
 	}
-	sshKey, err := m.GetSSHKeyForHost(meta.UserID, meta.HostServerID)
+	sshKey, err := m.GetSSHKeyForHost(ctx, meta.UserID, meta.HostServerID)
 	if err != nil {
 		return nil, fmt.Errorf("ssh key not found: %w", err)
 	}
@@ -2,12 +2,17 @@ package ssh_key_provider
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 // swagger:route POST /ssh-keys/create ssh-keys createSshKey
@@ -40,6 +45,10 @@ func CreateSshKeyHandler(provider SshKeySecretProvider) http.HandlerFunc {
 			http.Error(w, "Missing required fields", http.StatusBadRequest)
 			return
 		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expiresAt must be in the future", http.StatusBadRequest)
+			return
+		}
 
 		// Create the SSH key request
 		sshKeyReq := &NewSshKeyRequest{
@@ -51,6 +60,9 @@ func CreateSshKeyHandler(provider SshKeySecretProvider) http.HandlerFunc {
 			KeyType:     req.KeyType,
 			Passphrase:  req.Passphrase,
 		}
+		if req.ExpiresAt != nil {
+			sshKeyReq.Expiration = *req.ExpiresAt
+		}
 		slog.Info("User ID", slog.String("user_id", userID.String()))
 		if req.HostServerId != nil {
 			slog.Info("Host server ID", slog.String("host_server_id", req.HostServerId.String()))
@@ -66,11 +78,18 @@ func CreateSshKeyHandler(provider SshKeySecretProvider) http.HandlerFunc {
 			sshKeyReq.HostServerId = *req.HostServerId
 		}
 		// Create the SSH key
-		result := provider.CreateSshKey(sshKeyReq)
+		result := provider.CreateSshKey(r.Context(), sshKeyReq)
 		slog.Info("Created SSH key", slog.String("result", fmt.Sprintf("%+v", result)))
 		if result.Error != nil {
 			slog.Error("Failed to create SSH key", slog.String("error", result.Error.Error()))
-			http.Error(w, "Failed to create SSH key", http.StatusInternalServerError)
+			switch {
+			case errors.Is(result.Error, organizations.ErrNoActiveOrganization):
+				http.Error(w, result.Error.Error(), http.StatusForbidden)
+			case isNotFound(result.Error):
+				http.Error(w, "Not Found", http.StatusNotFound)
+			default:
+				http.Error(w, "Failed to create SSH key", http.StatusInternalServerError)
+			}
 			return
 		}
 
@@ -125,9 +144,13 @@ func DeleteSshKeyHandler(provider SshKeySecretProvider) http.HandlerFunc {
 		}
 
 		// Delete the SSH key
-		err = provider.DeleteSShKeyAndSecret(sshKeyId)
+		err = provider.DeleteSShKeyAndSecret(r.Context(), sshKeyId)
 		if err != nil {
 			slog.Error("Failed to delete SSH key", slog.String("error", err.Error()))
+			if isNotFound(err) {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to delete SSH key", http.StatusInternalServerError)
 			return
 		}
@@ -166,7 +189,7 @@ func GetSshKeysByUserIdHandler(provider SshKeySecretProvider) http.HandlerFunc {
 		// users can only access their own keys.
 
 		// Get SSH keys for the user
-		sshKeys, err := provider.GetSshKeysByUserId(userID)
+		sshKeys, err := provider.GetSshKeysByUserId(r.Context(), userID)
 		if err != nil {
 			slog.Error("Failed to get SSH keys by user ID", slog.String("error", err.Error()))
 			http.Error(w, "Failed to get SSH keys", http.StatusInternalServerError)
@@ -192,6 +215,7 @@ func GetSshKeysByUserIdHandler(provider SshKeySecretProvider) http.HandlerFunc {
 //	200: CreateSshKeyHostMappingResponse
 //	400: description:Invalid request
 //	401: description:Unauthorized
+//	403: description:Host server outside the caller's permission scopes
 //	500: description:Internal Server Error
 func CreateSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -226,9 +250,17 @@ func CreateSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerF
 		}
 
 		// Create the SSH key host mapping
-		result := provider.CreateSshKeyHostMapping(&fullReq)
+		result := provider.CreateSshKeyHostMapping(r.Context(), &fullReq)
 		if result.Error != nil {
 			slog.Error("Failed to create SSH key host mapping", slog.String("error", result.Error.Error()))
+			if errors.Is(result.Error, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+			if isNotFound(result.Error) {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to create SSH key host mapping", http.StatusInternalServerError)
 			return
 		}
@@ -261,6 +293,7 @@ func CreateSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerF
 //	200: GetSshKeyHostMappingByIdResponse
 //	400: description:Invalid request
 //	401: description:Unauthorized
+//	403: description:Host server outside the caller's permission scopes
 //	404: description:Not Found
 //	500: description:Internal Server Error
 func GetSshKeyHostMappingByIdHandler(provider SshKeySecretProvider) http.HandlerFunc {
@@ -284,10 +317,14 @@ func GetSshKeyHostMappingByIdHandler(provider SshKeySecretProvider) http.Handler
 			return
 		}
 
-		result, err := provider.GetSshKeyHostMappingById(id)
+		result, err := provider.GetSshKeyHostMappingById(r.Context(), id)
 		if err != nil {
 			slog.Error("Failed to get SSH key host mapping", slog.String("error", err.Error()))
-			if err.Error() == "no rows in result set" {
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+			if isNotFound(err) {
 				http.Error(w, "SSH key host mapping not found", http.StatusNotFound)
 				return
 			}
@@ -345,9 +382,13 @@ func GetSshKeyHostMappingsByHostIdHandler(provider SshKeySecretProvider) http.Ha
 			return
 		}
 
-		results, err := provider.GetSshKeyHostMappingsByHostId(hostId)
+		results, err := provider.GetSshKeyHostMappingsByHostId(r.Context(), hostId)
 		if err != nil {
 			slog.Error("Failed to get SSH key host mappings by host ID", slog.String("error", err.Error()))
+			if isNotFound(err) {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to get SSH key host mappings", http.StatusInternalServerError)
 			return
 		}
@@ -405,9 +446,13 @@ func GetSshKeyHostMappingsByKeyIdHandler(provider SshKeySecretProvider) http.Han
 			return
 		}
 
-		results, err := provider.GetSshKeyHostMappingsByKeyId(keyId)
+		results, err := provider.GetSshKeyHostMappingsByKeyId(r.Context(), keyId)
 		if err != nil {
 			slog.Error("Failed to get SSH key host mappings by key ID", slog.String("error", err.Error()))
+			if isNotFound(err) {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to get SSH key host mappings", http.StatusInternalServerError)
 			return
 		}
@@ -443,6 +488,7 @@ func GetSshKeyHostMappingsByKeyIdHandler(provider SshKeySecretProvider) http.Han
 //	200: UpdateSshKeyHostMappingResponse
 //	400: description:Invalid request
 //	401: description:Unauthorized
+//	403: description:Host server outside the caller's permission scopes
 //	404: description:Not Found
 //	500: description:Internal Server Error
 func UpdateSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerFunc {
@@ -482,10 +528,14 @@ func UpdateSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerF
 			return
 		}
 
-		result := provider.UpdateSshKeyHostMapping(&req)
+		result := provider.UpdateSshKeyHostMapping(r.Context(), &req)
 		if result.Error != nil {
 			slog.Error("Failed to update SSH key host mapping", slog.String("error", result.Error.Error()))
-			if result.Error.Error() == "no rows in result set" {
+			if errors.Is(result.Error, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+			if isNotFound(result.Error) {
 				http.Error(w, "SSH key host mapping not found", http.StatusNotFound)
 				return
 			}
@@ -521,6 +571,7 @@ func UpdateSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerF
 //	200: DeleteSshKeyHostMappingResponse
 //	400: description:Invalid request
 //	401: description:Unauthorized
+//	403: description:Host server outside the caller's permission scopes
 //	404: description:Not Found
 //	500: description:Internal Server Error
 func DeleteSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerFunc {
@@ -544,10 +595,14 @@ func DeleteSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerF
 			return
 		}
 
-		err = provider.DeleteSshKeyHostMapping(id)
+		err = provider.DeleteSshKeyHostMapping(r.Context(), id)
 		if err != nil {
 			slog.Error("Failed to delete SSH key host mapping", slog.String("error", err.Error()))
-			if err.Error() == "no rows in result set" {
+			if errors.Is(err, resource_policy.ErrOutOfScope) {
+				http.Error(w, `{"error": "Permission Denied"}`, http.StatusForbidden)
+				return
+			}
+			if isNotFound(err) {
 				http.Error(w, "SSH key host mapping not found", http.StatusNotFound)
 				return
 			}
@@ -565,7 +620,7 @@ func DeleteSshKeyHostMappingHandler(provider SshKeySecretProvider) http.HandlerF
 
 // SshKeyHostMappingByIDHandler handles GET, PUT, and DELETE operations for SSH key host mappings by ID
 func SshKeyHostMappingByIDHandler(provider SshKeySecretProvider, authService authapi.AuthService) http.Handler {
-	return authapi.AuthMiddlewareRequirePermission(authService, "ManageSshKeys", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return authapi.AuthMiddlewareRequireResourcePermission(authService, "ManageSshKeys", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			GetSshKeyHostMappingByIdHandler(provider).ServeHTTP(w, r)
@@ -608,7 +663,7 @@ func GetSshKeyHostMappingsByUserIdHandler(provider SshKeySecretProvider) http.Ha
 			return
 		}
 
-		results, err := provider.GetSshKeyHostMappingsByUserId(userId)
+		results, err := provider.GetSshKeyHostMappingsByUserId(r.Context(), userId)
 		if err != nil {
 			slog.Error("Failed to get SSH key host mappings by user ID", slog.String("error", err.Error()))
 			http.Error(w, "Failed to get SSH key host mappings", http.StatusInternalServerError)
@@ -638,3 +693,9 @@ func GetSshKeyHostMappingsByUserIdHandler(provider SshKeySecretProvider) http.Ha
 		}
 	}
 }
+
+// isNotFound reports whether err means the ssh key, host server or mapping does not exist
+// or belongs to another organization.
+func isNotFound(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) || errors.Is(err, ErrNotFound)
+}
@@ -2,10 +2,15 @@ package ssh_key_provider
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/babbage88/go-infra/services/resource_policy"
 	"github.com/babbage88/go-infra/services/user_secrets"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -22,44 +27,62 @@ func NewPgSshKeySecretStore(dbConn *pgxpool.Pool) *PgSshKeySecretStore {
 	}
 }
 
-func (p *PgSshKeySecretStore) CreateSshKey(sshKey *NewSshKeyRequest) NewSshKeyResult {
+// ErrNotFound is returned for ssh keys, host servers and mappings outside the active
+// organization, so their existence is not disclosed.
+var ErrNotFound = errors.New("ssh key or host server not found")
+
+// storeSshKeySecret stores a private key or passphrase. Keys created without an expiration
+// never expire, otherwise SSH connections would start failing once a default ran out.
+func storeSshKeySecret(ctx context.Context, secrets *user_secrets.PgUserSecretStore, value string, userId, appId uuid.UUID, expiry time.Time) (uuid.UUID, error) {
+	if expiry.IsZero() {
+		return secrets.StoreSecretWithoutExpiry(ctx, value, userId, appId)
+	}
+	return secrets.StoreSecret(ctx, value, userId, appId, expiry)
+}
+
+func (p *PgSshKeySecretStore) CreateSshKey(ctx context.Context, sshKey *NewSshKeyRequest) NewSshKeyResult {
+	if err := organizations.RequireActiveOrg(ctx); err != nil {
+		return NewSshKeyResult{Error: err}
+	}
+	if sshKey.HostServerId != uuid.Nil {
+		if err := allowResource(ctx, organizations.ResourceHostServer, sshKey.HostServerId); err != nil {
+			return NewSshKeyResult{Error: err}
+		}
+	}
+
 	// Start a transaction
-	tx, err := p.DbConn.Begin(context.Background())
+	tx, err := p.DbConn.Begin(ctx)
 	if err != nil {
 		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
 		return NewSshKeyResult{Error: err}
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
 
 	qry := infra_db_pg.New(tx)
 	txSecretProvider := user_secrets.NewPgUserSecretStore(tx)
 
 	// Get the SSH key type ID
-	keyType, err := qry.GetSSHKeyTypeByName(context.Background(), sshKey.KeyType)
+	keyType, err := qry.GetSSHKeyTypeByName(ctx, sshKey.KeyType)
 	if err != nil {
 		slog.Error("Failed to get SSH key type", slog.String("error", err.Error()))
 		return NewSshKeyResult{Error: err}
 	}
 
-	// Store the private key as a secret
-	// Use a default expiry of 1 year if not specified
-	expiry := time.Now().AddDate(1, 0, 0)
-
 	// Get the external app ID for SSH keys
-	sshAppId, err := qry.GetExternalAppIdByName(context.Background(), "ssh_keys")
+	sshAppId, err := qry.GetExternalAppIdByName(ctx, "ssh_keys")
 	if err != nil {
 		slog.Error("Failed to get SSH app ID", slog.String("error", err.Error()))
 		return NewSshKeyResult{Error: err}
 	}
 
-	sshPassphraseAppId, err := qry.GetExternalAppIdByName(context.Background(), "ssh_passphrase")
+	sshPassphraseAppId, err := qry.GetExternalAppIdByName(ctx, "ssh_passphrase")
 	if err != nil {
 		slog.Error("Failed to get SSH app ID", slog.String("error", err.Error()))
 		return NewSshKeyResult{Error: err}
 	}
 
 	// Store the private key as a secret
-	secretId, err := txSecretProvider.StoreSecret(sshKey.PrivateKey, sshKey.UserID, sshAppId, expiry)
+	secretId, err := storeSshKeySecret(ctx, txSecretProvider, sshKey.PrivateKey, sshKey.UserID, sshAppId, sshKey.Expiration)
 	if err != nil {
 		slog.Error("Failed to store SSH key secret", slog.String("error", err.Error()))
 		return NewSshKeyResult{Error: err}
@@ -69,7 +92,7 @@ func (p *PgSshKeySecretStore) CreateSshKey(sshKey *NewSshKeyRequest) NewSshKeyRe
 	slog.Info("sshKey.Passphrase", "sshKey.Passphrase", sshKey.Passphrase)
 	if sshKey.Passphrase != "" {
 		slog.Info("Storing passphrase", "sshKey.Passphrase", sshKey.Passphrase)
-		qryPassphraseId, err := txSecretProvider.StoreSecret(sshKey.Passphrase, sshKey.UserID, sshPassphraseAppId, expiry)
+		qryPassphraseId, err := storeSshKeySecret(ctx, txSecretProvider, sshKey.Passphrase, sshKey.UserID, sshPassphraseAppId, sshKey.Expiration)
 		if err != nil {
 			slog.Error("Failed to store SSH key secret", slog.String("error", err.Error()))
 			return NewSshKeyResult{Error: err}
@@ -79,7 +102,7 @@ func (p *PgSshKeySecretStore) CreateSshKey(sshKey *NewSshKeyRequest) NewSshKeyRe
 	}
 
 	// Create the SSH key record
-	sshKeyRecord, err := qry.CreateSSHKey(context.Background(), infra_db_pg.CreateSSHKeyParams{
+	sshKeyRecord, err := qry.CreateSSHKey(ctx, infra_db_pg.CreateSSHKeyParams{
 		Name:         sshKey.Name,
 		Description:  pgtype.Text{String: sshKey.Description, Valid: true},
 		PrivSecretID: secretId,
@@ -94,16 +117,17 @@ func (p *PgSshKeySecretStore) CreateSshKey(sshKey *NewSshKeyRequest) NewSshKeyRe
 	}
 
 	// If a host server was specified, create the mapping
+	var hostMapping *CreateSshKeyHostMappingResult
 	if sshKey.HostServerId != uuid.Nil {
 		// Get the default username for the host server
-		hostServer, err := qry.GetHostServerById(context.Background(), sshKey.HostServerId)
+		hostServer, err := qry.GetHostServerById(ctx, sshKey.HostServerId)
 		if err != nil {
 			slog.Error("Failed to get host server", slog.String("error", err.Error()))
 			return NewSshKeyResult{Error: err}
 		}
 
 		// Create the mapping with the hostname as the default username
-		_, err = qry.CreateSSHKeyHostMapping(context.Background(), infra_db_pg.CreateSSHKeyHostMappingParams{
+		row, err := qry.CreateSSHKeyHostMapping(ctx, infra_db_pg.CreateSSHKeyHostMappingParams{
 			SshKeyID:           sshKeyRecord.ID,
 			HostServerID:       sshKey.HostServerId,
 			UserID:             sshKey.UserID,
@@ -113,14 +137,47 @@ func (p *PgSshKeySecretStore) CreateSshKey(sshKey *NewSshKeyRequest) NewSshKeyRe
 			slog.Error("Failed to create SSH key host mapping", slog.String("error", err.Error()))
 			return NewSshKeyResult{Error: err}
 		}
+		hostMapping = &CreateSshKeyHostMappingResult{
+			ID:                 row.ID,
+			SshKeyID:           row.SshKeyID,
+			HostServerID:       row.HostServerID,
+			UserID:             row.UserID,
+			HostserverUsername: row.HostserverUsername,
+			CreatedAt:          row.CreatedAt.Time,
+			LastModified:       row.LastModified.Time,
+		}
 	}
 
 	// Commit the transaction
-	if err := tx.Commit(context.Background()); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
 		return NewSshKeyResult{Error: err}
 	}
 
+	if err := organizations.AssignToActiveOrg(ctx, organizations.ResourceSshKey, sshKeyRecord.ID); err != nil {
+		slog.Error("Failed to assign SSH key to organization", slog.String("error", err.Error()))
+		if _, delErr := p.deleteSshKeyAndSecret(ctx, sshKeyRecord.ID); delErr != nil {
+			slog.Error("Failed to remove unassigned SSH key", slog.String("error", delErr.Error()))
+		}
+		return NewSshKeyResult{Error: err}
+	}
+
+	recordSshKeyChange(ctx, audit_log.ActionCreate, sshKeyRecord.ID, nil, &SshKeyListItem{
+		ID:                 sshKeyRecord.ID,
+		Name:               sshKeyRecord.Name,
+		Description:        sshKeyRecord.Description.String,
+		PublicKey:          sshKeyRecord.PublicKey,
+		PrivateKeyId:       sshKeyRecord.PrivSecretID,
+		PassphraseSecretId: sshKeyRecord.PassphraseID,
+		KeyType:            sshKey.KeyType,
+		OwnerUserID:        sshKeyRecord.OwnerUserID,
+		CreatedAt:          sshKeyRecord.CreatedAt.Time,
+		LastModified:       sshKeyRecord.LastModified.Time,
+	})
+	if hostMapping != nil {
+		recordSshKeyHostMappingChange(ctx, audit_log.ActionCreate, hostMapping.ID, nil, hostMapping)
+	}
+
 	return NewSshKeyResult{
 		SshKeyId:           sshKeyRecord.ID,
 		PrivKeySecretId:    secretId,
@@ -130,61 +187,86 @@ func (p *PgSshKeySecretStore) CreateSshKey(sshKey *NewSshKeyRequest) NewSshKeyRe
 	}
 }
 
-func (p *PgSshKeySecretStore) DeleteSShKeyAndSecret(sshKeyId uuid.UUID) error {
+func (p *PgSshKeySecretStore) DeleteSShKeyAndSecret(ctx context.Context, sshKeyId uuid.UUID) error {
+	if err := allowResource(ctx, organizations.ResourceSshKey, sshKeyId); err != nil {
+		return err
+	}
+	deleted, err := p.deleteSshKeyAndSecret(ctx, sshKeyId)
+	if err != nil {
+		return err
+	}
+	recordSshKeyChange(ctx, audit_log.ActionDelete, sshKeyId, deleted, nil)
+	return nil
+}
+
+// deleteSshKeyAndSecret deletes the key with its mappings and passphrase and returns the
+// deleted key.
+func (p *PgSshKeySecretStore) deleteSshKeyAndSecret(ctx context.Context, sshKeyId uuid.UUID) (*SshKeyListItem, error) {
 	// Start a transaction
-	tx, err := p.DbConn.Begin(context.Background())
+	tx, err := p.DbConn.Begin(ctx)
 	if err != nil {
 		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
-		return err
+		return nil, err
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
 
 	qry := infra_db_pg.New(tx)
 	txSecretProvider := user_secrets.NewPgUserSecretStore(tx)
 
 	// First, get the SSH key to retrieve the secret ID
-	sshKey, err := qry.GetSSHKeyById(context.Background(), sshKeyId)
+	sshKey, err := qry.GetSSHKeyById(ctx, sshKeyId)
 	if err != nil {
 		slog.Error("Failed to get SSH key", slog.String("error", err.Error()))
-		return err
+		return nil, err
 	}
 
 	// Delete SSH key host mappings first (foreign key constraint)
-	err = qry.DeleteSSHKeyHostMappingsBySshKeyId(context.Background(), sshKeyId)
+	err = qry.DeleteSSHKeyHostMappingsBySshKeyId(ctx, sshKeyId)
 	if err != nil {
 		slog.Error("Failed to delete SSH key host mappings", slog.String("error", err.Error()))
-		return err
+		return nil, err
 	}
 
 	// Delete the SSH key record
-	err = qry.DeleteSSHKey(context.Background(), sshKeyId)
+	err = qry.DeleteSSHKey(ctx, sshKeyId)
 	if err != nil {
 		slog.Error("Failed to delete SSH key", slog.String("error", err.Error()))
-		return err
+		return nil, err
 	}
 
 	if sshKey.PassphraseID != nil {
 		err = txSecretProvider.DeleteSecret(*sshKey.PassphraseID)
 		if err != nil {
 			slog.Error("Failed to delete SSH key passphrase secret", slog.String("error", err.Error()))
-			return err
+			return nil, err
 		}
 	}
 
 	// Commit the transaction
-	if err := tx.Commit(context.Background()); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &SshKeyListItem{
+		ID:                 sshKey.ID,
+		Name:               sshKey.Name,
+		Description:        sshKey.Description.String,
+		PublicKey:          sshKey.PublicKey,
+		PrivateKeyId:       sshKey.PrivSecretID,
+		PassphraseSecretId: sshKey.PassphraseID,
+		KeyType:            sshKey.KeyType,
+		OwnerUserID:        sshKey.OwnerUserID,
+		CreatedAt:          sshKey.CreatedAt.Time,
+		LastModified:       sshKey.LastModified.Time,
+	}, nil
 }
 
-func (p *PgSshKeySecretStore) GetSshKeysByUserId(userId uuid.UUID) ([]SshKeyListItem, error) {
+func (p *PgSshKeySecretStore) GetSshKeysByUserId(ctx context.Context, userId uuid.UUID) ([]SshKeyListItem, error) {
 	qry := infra_db_pg.New(p.DbConn)
 
 	// Get the SSH keys by user ID
-	sshKeys, err := qry.GetSSHKeysByOwnerId(context.Background(), userId)
+	sshKeys, err := qry.GetSSHKeysByOwnerId(ctx, userId)
 	if err != nil {
 		slog.Error("Failed to get SSH keys by user ID", slog.String("error", err.Error()))
 		return nil, err
@@ -212,12 +294,16 @@ func (p *PgSshKeySecretStore) GetSshKeysByUserId(userId uuid.UUID) ([]SshKeyList
 		result = append(result, item)
 	}
 
-	return result, nil
+	return filterSshKeys(ctx, result)
 }
 
 // SSH Key Host Mapping CRUD operations
 
-func (p *PgSshKeySecretStore) CreateSshKeyHostMapping(mapping *CreateSshKeyHostMappingRequest) CreateSshKeyHostMappingResult {
+func (p *PgSshKeySecretStore) CreateSshKeyHostMapping(ctx context.Context, mapping *CreateSshKeyHostMappingRequest) CreateSshKeyHostMappingResult {
+	if err := allowMapping(ctx, mapping.SshKeyID, mapping.HostServerID); err != nil {
+		return CreateSshKeyHostMappingResult{Error: err}
+	}
+
 	qry := infra_db_pg.New(p.DbConn)
 
 	var sudoPasswordTokenID pgtype.UUID
@@ -232,7 +318,7 @@ func (p *PgSshKeySecretStore) CreateSshKeyHostMapping(mapping *CreateSshKeyHostM
 		}
 	}
 	// Create or update the SSH key host mapping
-	sshKeyHostMapping, err := qry.CreateSSHKeyHostMapping(context.Background(), infra_db_pg.CreateSSHKeyHostMappingParams{
+	sshKeyHostMapping, err := qry.CreateSSHKeyHostMapping(ctx, infra_db_pg.CreateSSHKeyHostMappingParams{
 		SshKeyID:            mapping.SshKeyID,
 		HostServerID:        mapping.HostServerID,
 		UserID:              mapping.UserID,
@@ -244,7 +330,7 @@ func (p *PgSshKeySecretStore) CreateSshKeyHostMapping(mapping *CreateSshKeyHostM
 		return CreateSshKeyHostMappingResult{Error: err}
 	}
 
-	return CreateSshKeyHostMappingResult{
+	result := CreateSshKeyHostMappingResult{
 		ID:                 sshKeyHostMapping.ID,
 		SshKeyID:           sshKeyHostMapping.SshKeyID,
 		HostServerID:       sshKeyHostMapping.HostServerID,
@@ -254,17 +340,22 @@ func (p *PgSshKeySecretStore) CreateSshKeyHostMapping(mapping *CreateSshKeyHostM
 		LastModified:       sshKeyHostMapping.LastModified.Time,
 		Error:              nil,
 	}
+	recordSshKeyHostMappingChange(ctx, audit_log.ActionCreate, result.ID, nil, &result)
+	return result
 }
 
-func (p *PgSshKeySecretStore) GetSshKeyHostMappingById(id uuid.UUID) (*CreateSshKeyHostMappingResult, error) {
+func (p *PgSshKeySecretStore) GetSshKeyHostMappingById(ctx context.Context, id uuid.UUID) (*CreateSshKeyHostMappingResult, error) {
 	qry := infra_db_pg.New(p.DbConn)
 
 	// Get the SSH key host mapping
-	sshKeyHostMapping, err := qry.GetSSHKeyHostMappingById(context.Background(), id)
+	sshKeyHostMapping, err := qry.GetSSHKeyHostMappingById(ctx, id)
 	if err != nil {
 		slog.Error("Failed to get SSH key host mapping", slog.String("error", err.Error()))
 		return nil, err
 	}
+	if err := allowMapping(ctx, sshKeyHostMapping.SshKeyID, sshKeyHostMapping.HostServerID); err != nil {
+		return nil, err
+	}
 
 	return &CreateSshKeyHostMappingResult{
 		ID:                 sshKeyHostMapping.ID,
@@ -278,11 +369,11 @@ func (p *PgSshKeySecretStore) GetSshKeyHostMappingById(id uuid.UUID) (*CreateSsh
 	}, nil
 }
 
-func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByUserId(userId uuid.UUID) ([]CreateSshKeyHostMappingResult, error) {
+func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByUserId(ctx context.Context, userId uuid.UUID) ([]CreateSshKeyHostMappingResult, error) {
 	qry := infra_db_pg.New(p.DbConn)
 
 	// Get the SSH key host mappings by user ID
-	userSshKeyMappings, err := qry.GetSSHKeyHostMappingsByUserId(context.Background(), userId)
+	userSshKeyMappings, err := qry.GetSSHKeyHostMappingsByUserId(ctx, userId)
 	if err != nil {
 		slog.Error("Failed to get SSH key host mappings by user ID", slog.String("error", err.Error()))
 		return nil, err
@@ -301,14 +392,18 @@ func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByUserId(userId uuid.UUID) ([
 		})
 	}
 
-	return result, nil
+	return filterMappings(ctx, result)
 }
 
-func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByHostId(hostId uuid.UUID) ([]CreateSshKeyHostMappingResult, error) {
+func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByHostId(ctx context.Context, hostId uuid.UUID) ([]CreateSshKeyHostMappingResult, error) {
+	if err := allowResource(ctx, organizations.ResourceHostServer, hostId); err != nil {
+		return nil, err
+	}
+
 	qry := infra_db_pg.New(p.DbConn)
 
 	// Get the SSH key host mappings by host ID
-	userSshKeyMappings, err := qry.GetSSHKeyHostMappingsByHostId(context.Background(), hostId)
+	userSshKeyMappings, err := qry.GetSSHKeyHostMappingsByHostId(ctx, hostId)
 	if err != nil {
 		slog.Error("Failed to get SSH key host mappings by host ID", slog.String("error", err.Error()))
 		return nil, err
@@ -327,14 +422,18 @@ func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByHostId(hostId uuid.UUID) ([
 		})
 	}
 
-	return result, nil
+	return filterMappings(ctx, result)
 }
 
-func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByKeyId(keyId uuid.UUID) ([]CreateSshKeyHostMappingResult, error) {
+func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByKeyId(ctx context.Context, keyId uuid.UUID) ([]CreateSshKeyHostMappingResult, error) {
+	if err := allowResource(ctx, organizations.ResourceSshKey, keyId); err != nil {
+		return nil, err
+	}
+
 	qry := infra_db_pg.New(p.DbConn)
 
 	// Get the SSH key host mappings by key ID
-	userSshKeyMappings, err := qry.GetSSHKeyHostMappingsByKeyId(context.Background(), keyId)
+	userSshKeyMappings, err := qry.GetSSHKeyHostMappingsByKeyId(ctx, keyId)
 	if err != nil {
 		slog.Error("Failed to get SSH key host mappings by key ID", slog.String("error", err.Error()))
 		return nil, err
@@ -353,22 +452,27 @@ func (p *PgSshKeySecretStore) GetSshKeyHostMappingsByKeyId(keyId uuid.UUID) ([]C
 		})
 	}
 
-	return result, nil
+	return filterMappings(ctx, result)
 }
 
-func (p *PgSshKeySecretStore) UpdateSshKeyHostMapping(mapping *UpdateSshKeyHostMappingRequest) UpdateSshKeyHostMappingResult {
+func (p *PgSshKeySecretStore) UpdateSshKeyHostMapping(ctx context.Context, mapping *UpdateSshKeyHostMappingRequest) UpdateSshKeyHostMappingResult {
+	current, err := p.GetSshKeyHostMappingById(ctx, mapping.ID)
+	if err != nil {
+		return UpdateSshKeyHostMappingResult{Error: err}
+	}
+
 	// Start a transaction
-	tx, err := p.DbConn.Begin(context.Background())
+	tx, err := p.DbConn.Begin(ctx)
 	if err != nil {
 		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
 		return UpdateSshKeyHostMappingResult{Error: err}
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
 
 	qry := infra_db_pg.New(tx)
 
 	// Update the SSH key host mapping
-	sshKeyHostMapping, err := qry.UpdateSSHKeyHostMapping(context.Background(), infra_db_pg.UpdateSSHKeyHostMappingParams{
+	sshKeyHostMapping, err := qry.UpdateSSHKeyHostMapping(ctx, infra_db_pg.UpdateSSHKeyHostMappingParams{
 		ID:                 mapping.ID,
 		HostserverUsername: mapping.HostserverUsername,
 	})
@@ -378,12 +482,12 @@ func (p *PgSshKeySecretStore) UpdateSshKeyHostMapping(mapping *UpdateSshKeyHostM
 	}
 
 	// Commit the transaction
-	if err := tx.Commit(context.Background()); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
 		return UpdateSshKeyHostMappingResult{Error: err}
 	}
 
-	return UpdateSshKeyHostMappingResult{
+	result := UpdateSshKeyHostMappingResult{
 		ID:                 sshKeyHostMapping.ID,
 		SshKeyID:           sshKeyHostMapping.SshKeyID,
 		HostServerID:       sshKeyHostMapping.HostServerID,
@@ -393,58 +497,186 @@ func (p *PgSshKeySecretStore) UpdateSshKeyHostMapping(mapping *UpdateSshKeyHostM
 		LastModified:       sshKeyHostMapping.LastModified.Time,
 		Error:              nil,
 	}
+	updated := CreateSshKeyHostMappingResult(result)
+	recordSshKeyHostMappingChange(ctx, audit_log.ActionUpdate, result.ID, current, &updated)
+	return result
 }
 
-func (p *PgSshKeySecretStore) DeleteSshKeyHostMapping(id uuid.UUID) error {
+func (p *PgSshKeySecretStore) DeleteSshKeyHostMapping(ctx context.Context, id uuid.UUID) error {
+	current, err := p.GetSshKeyHostMappingById(ctx, id)
+	if err != nil {
+		return err
+	}
+
 	// Start a transaction
-	tx, err := p.DbConn.Begin(context.Background())
+	tx, err := p.DbConn.Begin(ctx)
 	if err != nil {
 		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
 		return err
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
 
 	qry := infra_db_pg.New(tx)
 
 	// Delete the SSH key host mapping
-	err = qry.DeleteSSHKeyHostMapping(context.Background(), id)
+	err = qry.DeleteSSHKeyHostMapping(ctx, id)
 	if err != nil {
 		slog.Error("Failed to delete SSH key host mapping", slog.String("error", err.Error()))
 		return err
 	}
 
 	// Commit the transaction
-	if err := tx.Commit(context.Background()); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
 		return err
 	}
 
+	recordSshKeyHostMappingChange(ctx, audit_log.ActionDelete, id, current, nil)
 	return nil
 }
 
-func (p *PgSshKeySecretStore) DeleteSshKeyHostMappingsBySshKeyId(sshKeyId uuid.UUID) error {
+func (p *PgSshKeySecretStore) DeleteSshKeyHostMappingsBySshKeyId(ctx context.Context, sshKeyId uuid.UUID) error {
+	if err := allowResource(ctx, organizations.ResourceSshKey, sshKeyId); err != nil {
+		return err
+	}
+
 	// Start a transaction
-	tx, err := p.DbConn.Begin(context.Background())
+	tx, err := p.DbConn.Begin(ctx)
 	if err != nil {
 		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
 		return err
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
 
 	qry := infra_db_pg.New(tx)
 
+	current, err := qry.GetSSHKeyHostMappingsByKeyId(ctx, sshKeyId)
+	if err != nil {
+		slog.Error("Failed to get SSH key host mappings by key ID", slog.String("error", err.Error()))
+		return err
+	}
+
 	// Delete all SSH key host mappings for the given SSH key ID
-	err = qry.DeleteSSHKeyHostMappingsBySshKeyId(context.Background(), sshKeyId)
+	err = qry.DeleteSSHKeyHostMappingsBySshKeyId(ctx, sshKeyId)
 	if err != nil {
 		slog.Error("Failed to delete SSH key host mappings by SSH key ID", slog.String("error", err.Error()))
 		return err
 	}
 
 	// Commit the transaction
-	if err := tx.Commit(context.Background()); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
 		return err
 	}
 
+	for _, mapping := range current {
+		recordSshKeyHostMappingChange(ctx, audit_log.ActionDelete, mapping.MappingID, &CreateSshKeyHostMappingResult{
+			ID:                 mapping.MappingID,
+			SshKeyID:           mapping.SshKeyID,
+			HostServerID:       mapping.HostServerID,
+			UserID:             mapping.UserID,
+			HostserverUsername: mapping.HostserverUsername,
+			CreatedAt:          mapping.CreatedAt.Time,
+			LastModified:       mapping.LastModified.Time,
+		}, nil)
+	}
+	return nil
+}
+
+// allowResource returns ErrNotFound unless the resource belongs to the active organization
+// in ctx.
+func allowResource(ctx context.Context, resourceType string, resourceId uuid.UUID) error {
+	allowed, err := organizations.AllowsResource(ctx, resourceType, resourceId)
+	if err != nil {
+		slog.Error("Error checking resource organization", slog.String("resourceType", resourceType), slog.String("resourceId", resourceId.String()), slog.String("error", err.Error()))
+		return err
+	}
+	if !allowed {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// allowMapping requires both the key and the host of a mapping to belong to the active
+// organization in ctx, and the host to be within the caller's permission scopes.
+func allowMapping(ctx context.Context, sshKeyId uuid.UUID, hostServerId uuid.UUID) error {
+	if err := allowResource(ctx, organizations.ResourceSshKey, sshKeyId); err != nil {
+		return err
+	}
+	if err := allowResource(ctx, organizations.ResourceHostServer, hostServerId); err != nil {
+		return err
+	}
+	inScope, err := resource_policy.AllowsHostServer(ctx, hostServerId)
+	if err != nil {
+		slog.Error("Error checking host server scope", slog.String("hostServerId", hostServerId.String()), slog.String("error", err.Error()))
+		return err
+	}
+	if !inScope {
+		return resource_policy.ErrOutOfScope
+	}
 	return nil
 }
+
+// filterSshKeys keeps the keys owned by the active organization in ctx.
+func filterSshKeys(ctx context.Context, sshKeys []SshKeyListItem) ([]SshKeyListItem, error) {
+	ids := make([]uuid.UUID, 0, len(sshKeys))
+	for _, sshKey := range sshKeys {
+		ids = append(ids, sshKey.ID)
+	}
+	allowed, err := organizations.FilterIds(ctx, organizations.ResourceSshKey, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(sshKeys, func(sshKey SshKeyListItem) bool {
+		return !slices.Contains(allowed, sshKey.ID)
+	}), nil
+}
+
+// filterMappings keeps the mappings whose key belongs to the active organization in ctx
+// and whose host is within the caller's permission scopes.
+func filterMappings(ctx context.Context, mappings []CreateSshKeyHostMappingResult) ([]CreateSshKeyHostMappingResult, error) {
+	keyIds := make([]uuid.UUID, 0, len(mappings))
+	hostIds := make([]uuid.UUID, 0, len(mappings))
+	for _, mapping := range mappings {
+		keyIds = append(keyIds, mapping.SshKeyID)
+		hostIds = append(hostIds, mapping.HostServerID)
+	}
+	allowed, err := organizations.FilterIds(ctx, organizations.ResourceSshKey, keyIds)
+	if err != nil {
+		return nil, err
+	}
+	inScope, err := resource_policy.FilterHostServerIds(ctx, hostIds)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(mappings, func(mapping CreateSshKeyHostMappingResult) bool {
+		return !slices.Contains(allowed, mapping.SshKeyID) || !slices.Contains(inScope, mapping.HostServerID)
+	}), nil
+}
+
+// recordSshKeyChange audits an SSH key change with the before and after state. The key
+// material stays in its secrets, only their ids are recorded.
+func recordSshKeyChange(ctx context.Context, action string, id uuid.UUID, before, after *SshKeyListItem) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceSshKey, ResourceId: id.String()}
+	// Assign only non-nil pointers so a missing side stays a nil interface.
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
+
+// recordSshKeyHostMappingChange audits an SSH key host mapping change with the before and
+// after state.
+func recordSshKeyHostMappingChange(ctx context.Context, action string, id uuid.UUID, before, after *CreateSshKeyHostMappingResult) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceSshKeyHostMapping, ResourceId: id.String()}
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
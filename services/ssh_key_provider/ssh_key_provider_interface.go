@@ -1,6 +1,7 @@
 package ssh_key_provider
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,6 +18,7 @@ type NewSshKeyRequest struct {
 	CreatedAt    time.Time `json:"createdAt"`
 	LastModified time.Time `json:"lastModified"`
 	Passphrase   string    `json:"passphrase"`
+	Expiration   time.Time `json:"expiration"`
 }
 
 type NewSshKeyResult struct {
@@ -64,17 +66,17 @@ type UpdateSshKeyHostMappingResult struct {
 }
 
 type SshKeySecretProvider interface {
-	CreateSshKey(sshKey *NewSshKeyRequest) NewSshKeyResult
-	DeleteSShKeyAndSecret(sshKeyId uuid.UUID) error
-	GetSshKeysByUserId(userId uuid.UUID) ([]SshKeyListItem, error)
+	CreateSshKey(ctx context.Context, sshKey *NewSshKeyRequest) NewSshKeyResult
+	DeleteSShKeyAndSecret(ctx context.Context, sshKeyId uuid.UUID) error
+	GetSshKeysByUserId(ctx context.Context, userId uuid.UUID) ([]SshKeyListItem, error)
 
 	// SSH Key Host Mapping CRUD operations
-	CreateSshKeyHostMapping(mapping *CreateSshKeyHostMappingRequest) CreateSshKeyHostMappingResult
-	GetSshKeyHostMappingById(id uuid.UUID) (*CreateSshKeyHostMappingResult, error)
-	GetSshKeyHostMappingsByUserId(userId uuid.UUID) ([]CreateSshKeyHostMappingResult, error)
-	GetSshKeyHostMappingsByHostId(hostId uuid.UUID) ([]CreateSshKeyHostMappingResult, error)
-	GetSshKeyHostMappingsByKeyId(keyId uuid.UUID) ([]CreateSshKeyHostMappingResult, error)
-	UpdateSshKeyHostMapping(mapping *UpdateSshKeyHostMappingRequest) UpdateSshKeyHostMappingResult
-	DeleteSshKeyHostMapping(id uuid.UUID) error
-	DeleteSshKeyHostMappingsBySshKeyId(sshKeyId uuid.UUID) error
+	CreateSshKeyHostMapping(ctx context.Context, mapping *CreateSshKeyHostMappingRequest) CreateSshKeyHostMappingResult
+	GetSshKeyHostMappingById(ctx context.Context, id uuid.UUID) (*CreateSshKeyHostMappingResult, error)
+	GetSshKeyHostMappingsByUserId(ctx context.Context, userId uuid.UUID) ([]CreateSshKeyHostMappingResult, error)
+	GetSshKeyHostMappingsByHostId(ctx context.Context, hostId uuid.UUID) ([]CreateSshKeyHostMappingResult, error)
+	GetSshKeyHostMappingsByKeyId(ctx context.Context, keyId uuid.UUID) ([]CreateSshKeyHostMappingResult, error)
+	UpdateSshKeyHostMapping(ctx context.Context, mapping *UpdateSshKeyHostMappingRequest) UpdateSshKeyHostMappingResult
+	DeleteSshKeyHostMapping(ctx context.Context, id uuid.UUID) error
+	DeleteSshKeyHostMappingsBySshKeyId(ctx context.Context, sshKeyId uuid.UUID) error
 }
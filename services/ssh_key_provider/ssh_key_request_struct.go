@@ -1,6 +1,8 @@
 package ssh_key_provider
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -39,6 +41,10 @@ type CreateSshKeyRequest struct {
 	// Optional ssh key passphrase
 	// required: false
 	Passphrase string `json:"passphrase"`
+
+	// Optional expiry of the stored private key and passphrase, keys without one never expire
+	// required: false
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 // swagger:response CreateSshKeyResponse
@@ -0,0 +1,92 @@
+package token_denylist
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	valkey "github.com/valkey-io/valkey-go"
+)
+
+type memoryCacheEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// MemoryRevocationCache is a per process cache, revocations made on other replicas are
+// seen once the negative ttl runs out.
+type MemoryRevocationCache struct {
+	mu      sync.RWMutex
+	entries map[uuid.UUID]memoryCacheEntry
+}
+
+func NewMemoryRevocationCache() *MemoryRevocationCache {
+	return &MemoryRevocationCache{entries: make(map[uuid.UUID]memoryCacheEntry)}
+}
+
+func (m *MemoryRevocationCache) Get(ctx context.Context, jti uuid.UUID) (bool, bool) {
+	m.mu.RLock()
+	entry, ok := m.entries[jti]
+	m.mu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.revoked, true
+}
+
+func (m *MemoryRevocationCache) Set(ctx context.Context, jti uuid.UUID, revoked bool, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range m.entries {
+		if now.After(entry.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+	m.entries[jti] = memoryCacheEntry{revoked: revoked, expiresAt: now.Add(ttl)}
+}
+
+// ValkeyRevocationCache shares revocations between replicas.
+type ValkeyRevocationCache struct {
+	client valkey.Client
+}
+
+func NewValkeyRevocationCache(client valkey.Client) *ValkeyRevocationCache {
+	return &ValkeyRevocationCache{client: client}
+}
+
+func (v *ValkeyRevocationCache) jtiKey(jti uuid.UUID) string {
+	return fmt.Sprintf("token_denylist:%s", jti.String())
+}
+
+func (v *ValkeyRevocationCache) Get(ctx context.Context, jti uuid.UUID) (bool, bool) {
+	val, err := v.client.Do(ctx, v.client.B().Get().Key(v.jtiKey(jti)).Build()).ToString()
+	if err != nil {
+		if !valkey.IsValkeyNil(err) {
+			slog.Error("Error reading token denylist cache", slog.String("error", err.Error()))
+		}
+		return false, false
+	}
+	return val == "1", true
+}
+
+func (v *ValkeyRevocationCache) Set(ctx context.Context, jti uuid.UUID, revoked bool, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	val := "0"
+	if revoked {
+		val = "1"
+	}
+	err := v.client.Do(ctx, v.client.B().Set().Key(v.jtiKey(jti)).Value(val).Px(ttl).Build()).Error()
+	if err != nil {
+		slog.Error("Error writing token denylist cache", slog.String("error", err.Error()))
+	}
+}
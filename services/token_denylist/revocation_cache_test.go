@@ -0,0 +1,32 @@
+package token_denylist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryRevocationCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryRevocationCache()
+	revokedJti := uuid.New()
+	activeJti := uuid.New()
+
+	if _, found := cache.Get(ctx, revokedJti); found {
+		t.Fatal("expected empty cache miss")
+	}
+
+	cache.Set(ctx, revokedJti, true, time.Minute)
+	cache.Set(ctx, activeJti, false, time.Millisecond)
+
+	if revoked, found := cache.Get(ctx, revokedJti); !found || !revoked {
+		t.Fatal("expected revoked jti to be cached as revoked")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, found := cache.Get(ctx, activeJti); found {
+		t.Fatal("expected negative entry to expire")
+	}
+}
@@ -0,0 +1,181 @@
+package token_denylist
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	ReasonUserDisabled  = "user_disabled"
+	ReasonUserDeleted   = "user_deleted"
+	ReasonRoleChanged   = "role_changed"
+	ReasonLogout        = "logout"
+	ReasonPasswordReset = "password_reset"
+)
+
+var (
+	defaultDenylistMu sync.RWMutex
+	defaultDenylist   TokenDenylist
+)
+
+// SetDefault sets the denylist used by token validation and user management.
+func SetDefault(d TokenDenylist) {
+	defaultDenylistMu.Lock()
+	defer defaultDenylistMu.Unlock()
+	defaultDenylist = d
+}
+
+// Default returns the configured denylist or nil when none is configured.
+func Default() TokenDenylist {
+	defaultDenylistMu.RLock()
+	defer defaultDenylistMu.RUnlock()
+	return defaultDenylist
+}
+
+type PgTokenDenylist struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgTokenDenylist(db *pgxpool.Pool) *PgTokenDenylist {
+	return &PgTokenDenylist{DbConn: db}
+}
+
+func (p *PgTokenDenylist) RecordIssued(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time) error {
+	qry := infra_db_pg.New(p.DbConn)
+	err := qry.InsertIssuedAccessToken(ctx, infra_db_pg.InsertIssuedAccessTokenParams{
+		Jti:       jti,
+		UserID:    userId,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		slog.Error("Error recording issued access token", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error recording issued access token: %w", err)
+	}
+	return nil
+}
+
+func (p *PgTokenDenylist) IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	revoked, err := qry.IsAccessTokenRevoked(ctx, jti)
+	if err != nil {
+		slog.Error("Error checking access token denylist", slog.String("jti", jti.String()), slog.String("error", err.Error()))
+		return false, fmt.Errorf("error checking access token denylist: %w", err)
+	}
+	return revoked, nil
+}
+
+func (p *PgTokenDenylist) Revoke(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time, reason string) error {
+	qry := infra_db_pg.New(p.DbConn)
+	err := qry.RevokeAccessToken(ctx, infra_db_pg.RevokeAccessTokenParams{
+		Jti:       jti,
+		UserID:    userId,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		Reason:    reason,
+	})
+	if err != nil {
+		slog.Error("Error revoking access token", slog.String("jti", jti.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error revoking access token: %w", err)
+	}
+	return nil
+}
+
+func (p *PgTokenDenylist) RevokeUserTokens(ctx context.Context, userId uuid.UUID, reason string) error {
+	_, err := p.revokeUserTokens(ctx, userId, reason)
+	return err
+}
+
+func (p *PgTokenDenylist) revokeUserTokens(ctx context.Context, userId uuid.UUID, reason string) ([]infra_db_pg.RevokeAccessTokensByUserIdRow, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.RevokeAccessTokensByUserId(ctx, infra_db_pg.RevokeAccessTokensByUserIdParams{
+		UserID: userId,
+		Reason: reason,
+	})
+	if err != nil {
+		slog.Error("Error revoking user access tokens", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error revoking access tokens for user %s: %w", userId, err)
+	}
+	slog.Info("Revoked outstanding access tokens", slog.String("userId", userId.String()), slog.String("reason", reason), slog.Int("count", len(rows)))
+	return rows, nil
+}
+
+// StartCleanup periodically deletes expired issued and revoked token records.
+func (p *PgTokenDenylist) StartCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				qry := infra_db_pg.New(p.DbConn)
+				if err := qry.DeleteExpiredIssuedAccessTokens(ctx); err != nil {
+					slog.Error("Error deleting expired issued access tokens", slog.String("error", err.Error()))
+				}
+				if err := qry.DeleteExpiredRevokedAccessTokens(ctx); err != nil {
+					slog.Error("Error deleting expired revoked access tokens", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// CachedTokenDenylist answers IsRevoked from a cache before falling back to Postgres.
+type CachedTokenDenylist struct {
+	store       *PgTokenDenylist
+	cache       RevocationCache
+	negativeTtl time.Duration
+}
+
+// NewCachedTokenDenylist wraps the Postgres denylist. negativeTtl bounds how long another
+// replica may keep accepting a token after it was revoked when the cache is not shared.
+func NewCachedTokenDenylist(store *PgTokenDenylist, cache RevocationCache, negativeTtl time.Duration) *CachedTokenDenylist {
+	return &CachedTokenDenylist{store: store, cache: cache, negativeTtl: negativeTtl}
+}
+
+func (c *CachedTokenDenylist) RecordIssued(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time) error {
+	return c.store.RecordIssued(ctx, jti, userId, expiresAt)
+}
+
+func (c *CachedTokenDenylist) IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	if revoked, found := c.cache.Get(ctx, jti); found {
+		return revoked, nil
+	}
+
+	revoked, err := c.store.IsRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	if !revoked {
+		c.cache.Set(ctx, jti, false, c.negativeTtl)
+	}
+	return revoked, nil
+}
+
+func (c *CachedTokenDenylist) Revoke(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time, reason string) error {
+	if err := c.store.Revoke(ctx, jti, userId, expiresAt, reason); err != nil {
+		return err
+	}
+	c.cache.Set(ctx, jti, true, time.Until(expiresAt))
+	return nil
+}
+
+func (c *CachedTokenDenylist) RevokeUserTokens(ctx context.Context, userId uuid.UUID, reason string) error {
+	rows, err := c.store.revokeUserTokens(ctx, userId, reason)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		c.cache.Set(ctx, row.Jti, true, time.Until(row.ExpiresAt.Time))
+	}
+	return nil
+}
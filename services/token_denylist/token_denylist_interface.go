@@ -0,0 +1,24 @@
+package token_denylist
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenDenylist tracks issued access tokens by jti and the ones that were revoked before
+// they expired. Postgres is the source of truth, caches only speed up IsRevoked.
+type TokenDenylist interface {
+	RecordIssued(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error)
+	Revoke(ctx context.Context, jti uuid.UUID, userId uuid.UUID, expiresAt time.Time, reason string) error
+	RevokeUserTokens(ctx context.Context, userId uuid.UUID, reason string) error
+}
+
+// RevocationCache caches IsRevoked lookups. Revoked entries are kept until the token
+// expires, non revoked entries only for a short ttl.
+type RevocationCache interface {
+	Get(ctx context.Context, jti uuid.UUID) (revoked bool, found bool)
+	Set(ctx context.Context, jti uuid.UUID, revoked bool, ttl time.Duration)
+}
@@ -91,6 +91,16 @@ type AppPermissionDao struct {
 	PermissionDescription string    `json:"permissionDescription"`
 }
 
+// swagger:model UserRoleMappingDao
+type UserRoleMappingDao struct {
+	Id           uuid.UUID `json:"id"`
+	UserId       uuid.UUID `json:"userId"`
+	RoleId       uuid.UUID `json:"roleId"`
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastModified time.Time `json:"lastModified"`
+}
+
 // swagger:model RolePermissionMappingDao
 type RolePermissionMappingDao struct {
 	Id           uuid.UUID `json:"id"`
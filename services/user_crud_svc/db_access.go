@@ -60,6 +60,15 @@ func (ap *AppPermissionDao) ParseAppPermissionFromDb(dbRow infra_db_pg.AppPermis
 	ap.PermissionDescription = dbRow.PermissionDescription.String
 }
 
+func (urm *UserRoleMappingDao) ParseUserRoleMappingFromDb(dbRow infra_db_pg.UserRoleMapping) {
+	urm.Id = dbRow.ID
+	urm.UserId = dbRow.UserID
+	urm.RoleId = dbRow.RoleID
+	urm.Enabled = dbRow.Enabled
+	urm.CreatedAt = dbRow.CreatedAt.Time
+	urm.LastModified = dbRow.LastModified.Time
+}
+
 func (rpm *RolePermissionMappingDao) ParseRolePermissionMappingFromDb(dbRow infra_db_pg.RolePermissionMapping) {
 	rpm.Id = dbRow.ID
 	rpm.PermissionId = dbRow.PermissionID
@@ -2,11 +2,18 @@ package user_crud_svc
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
 
 	"github.com/babbage88/go-infra/database/infra_db_pg"
 	"github.com/babbage88/go-infra/internal/hashing"
+	"github.com/babbage88/go-infra/internal/password_policy"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/permission_cache"
+	"github.com/babbage88/go-infra/services/token_denylist"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -14,43 +21,62 @@ import (
 
 type UserCRUDService struct {
 	DbConn *pgxpool.Pool
+	// Lockouts clears login throttling, nil when throttling is disabled.
+	Lockouts AccountUnlocker
+	// Verification mails new users a link to confirm their address, nil to skip.
+	Verification EmailVerificationSender
+	// DefaultOrganizationId is the organization new users join, uuid.Nil when
+	// organizations are disabled.
+	DefaultOrganizationId uuid.UUID
 }
 
+// EmailVerificationSender is implemented by user_verification.PgUserVerificationService.
+type EmailVerificationSender interface {
+	SendEmailVerification(ctx context.Context, userId uuid.UUID, email string) error
+}
+
+// AccountUnlocker is implemented by login_throttle.LoginThrottle.
+type AccountUnlocker interface {
+	UnlockUser(ctx context.Context, username string, actorUserId uuid.UUID) error
+}
+
+var ErrLockoutsNotConfigured = errors.New("login throttling is not configured")
+
 type UserCRUD interface {
-	NewUser(username string, hashed_pw string, email string) (UserDao, error)
+	NewUser(ctx context.Context, username string, hashed_pw string, email string) (UserDao, error)
 	GetAllActiveUsersDao() ([]UserDao, error)
 	GetAllActiveRoles([]UserRoleDao, error)
 	GetAllAppPermissions([]AppPermissionDao, error)
 	GetUserByName(username string) (UserDao, error)
 	GetUserById(id uuid.UUID) (UserDao, error)
-	updateUserPasswordById(id uuid.UUID, password string) error
-	UpdateUserPasswordById(targetUserId uuid.UUID, newPassword string) error
-	UpdateUserEmailById(id uuid.UUID, email string)
+	updateUserPasswordById(ctx context.Context, id uuid.UUID, password string) error
+	UpdateUserPasswordById(ctx context.Context, targetUserId uuid.UUID, newPassword string) error
+	UpdateUserEmailById(ctx context.Context, id uuid.UUID, email string)
 	VerifyAlterUser(executionUserId uuid.UUID) (bool, error)
-	UpdateUserPasswordWithAuth(execUserId uuid.UUID, targetUserId uuid.UUID, newPassword string) error
-	EnableUserById(targetUserId uuid.UUID) (UserDao, error)
-	DisableUserById(targetUserId uuid.UUID) (UserDao, error)
-	SoftDeleteUserById(targetUserId uuid.UUID) (UserDao, error)
-	UpdateUserRoleMapping(targetUserId uuid.UUID, roleId uuid.UUID) error
-	DisableUserRoleMapping(targetUserId uuid.UUID, roleId uuid.UUID) error
-	CreateOrUpdateUserRole(roleName string, roleDescr string) (*UserRoleDao, error)
+	UpdateUserPasswordWithAuth(ctx context.Context, execUserId uuid.UUID, targetUserId uuid.UUID, newPassword string) error
+	EnableUserById(ctx context.Context, targetUserId uuid.UUID) (UserDao, error)
+	DisableUserById(ctx context.Context, targetUserId uuid.UUID) (UserDao, error)
+	SoftDeleteUserById(ctx context.Context, targetUserId uuid.UUID) (UserDao, error)
+	UpdateUserRoleMapping(ctx context.Context, targetUserId uuid.UUID, roleId uuid.UUID) error
+	DisableUserRoleMapping(ctx context.Context, targetUserId uuid.UUID, roleId uuid.UUID) error
+	CreateOrUpdateUserRole(ctx context.Context, roleName string, roleDescr string) (*UserRoleDao, error)
 	CreateOrUpdateAppPermission(name string, desc string) (*AppPermissionDao, error)
-	CreateOrUpdateRolePermisssionMapping(roleId uuid.UUID, permId uuid.UUID) (*RolePermissionMappingDao, error)
-	EnableRoleById(id uuid.UUID) error
-	DisableRoleById(id uuid.UUID) error
-	SoftDeleteRoleById(id uuid.UUID) error
+	CreateOrUpdateRolePermisssionMapping(ctx context.Context, roleId uuid.UUID, permId uuid.UUID) (*RolePermissionMappingDao, error)
+	EnableRoleById(ctx context.Context, id uuid.UUID) error
+	DisableRoleById(ctx context.Context, id uuid.UUID) error
+	SoftDeleteRoleById(ctx context.Context, id uuid.UUID) error
 }
 
-func (us *UserCRUDService) UpdateUserPasswordById(targetUserid uuid.UUID, newPassword string) error {
+func (us *UserCRUDService) UpdateUserPasswordById(ctx context.Context, targetUserid uuid.UUID, newPassword string) error {
 	slog.Info("attempting updating user password", slog.String("targetUser", fmt.Sprint(targetUserid)))
-	err := us.updateUserPasswordById(targetUserid, newPassword)
+	err := us.updateUserPasswordById(ctx, targetUserid, newPassword)
 	if err != nil {
 		slog.Error("error when attempting to update password", slog.String("error", err.Error()))
 	}
 	return err
 }
 
-func (us *UserCRUDService) UpdateUserPasswordWithAuth(execUserId uuid.UUID, targetUserId uuid.UUID, newPassword string) error {
+func (us *UserCRUDService) UpdateUserPasswordWithAuth(ctx context.Context, execUserId uuid.UUID, targetUserId uuid.UUID, newPassword string) error {
 	isAdmin, err := us.VerifyAlterUser(execUserId)
 	if err != nil {
 		slog.Error("Error Verifying user permissions.", slog.String("ID", fmt.Sprint(execUserId)), slog.String("Error", err.Error()))
@@ -61,7 +87,7 @@ func (us *UserCRUDService) UpdateUserPasswordWithAuth(execUserId uuid.UUID, targ
 		permErr := fmt.Errorf("execution userId %d does not have the AlterUser permission", execUserId)
 		return permErr
 	}
-	retVal := us.updateUserPasswordById(targetUserId, newPassword)
+	retVal := us.updateUserPasswordById(ctx, targetUserId, newPassword)
 	return retVal
 }
 
@@ -79,8 +105,43 @@ func (us *UserCRUDService) VerifyAlterUser(ueid uuid.UUID) (bool, error) {
 	return qry, err
 }
 
-func (us *UserCRUDService) NewUser(username string, password string, email string) (UserDao, error) {
-	hashed_pw, _ := hashing.HashPassword(password)
+func (us *UserCRUDService) NewUser(ctx context.Context, username string, password string, email string) (UserDao, error) {
+	if err := password_policy.Default().Validate(password); err != nil {
+		return UserDao{}, err
+	}
+	hashed_pw, err := hashing.HashPassword(password)
+	if err != nil {
+		return UserDao{}, err
+	}
+	newuser, err := us.createUser(ctx, username, hashed_pw, email)
+	if err != nil {
+		return newuser, err
+	}
+
+	// New users start unverified, a failed mail only delays verification
+	if us.Verification != nil && email != "" {
+		if err := us.Verification.SendEmailVerification(ctx, newuser.Id, email); err != nil {
+			slog.Error("Error sending email verification", slog.String("userId", newuser.Id.String()), slog.String("error", err.Error()))
+		}
+	}
+	return newuser, nil
+}
+
+// NewExternalUser creates a user that signs in through an identity provider. The user
+// gets a random password nobody knows, so password policy does not apply.
+func (us *UserCRUDService) NewExternalUser(ctx context.Context, username string, email string) (UserDao, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return UserDao{}, fmt.Errorf("error generating password: %w", err)
+	}
+	hashed_pw, err := hashing.HashPassword(base64.RawURLEncoding.EncodeToString(b))
+	if err != nil {
+		return UserDao{}, err
+	}
+	return us.createUser(ctx, username, hashed_pw, email)
+}
+
+func (us *UserCRUDService) createUser(ctx context.Context, username string, hashed_pw string, email string) (UserDao, error) {
 	var newuser UserDao
 	// Set up parameters for the new user
 	params := infra_db_pg.CreateUserParams{
@@ -89,10 +150,30 @@ func (us *UserCRUDService) NewUser(username string, password string, email strin
 		Email:    pgtype.Text{String: email, Valid: true},
 	}
 
-	queries := infra_db_pg.New(us.DbConn)
-	qry, err := queries.CreateUser(context.Background(), params)
+	tx, err := us.DbConn.Begin(ctx)
+	if err != nil {
+		return newuser, err
+	}
+	defer tx.Rollback(ctx)
+
+	queries := infra_db_pg.New(tx)
+	qry, err := queries.CreateUser(ctx, params)
+	if err != nil {
+		return newuser, err
+	}
+	if us.DefaultOrganizationId != uuid.Nil {
+		err = queries.AddOrganizationMember(ctx, infra_db_pg.AddOrganizationMemberParams{OrgID: us.DefaultOrganizationId, UserID: qry.ID})
+		if err != nil {
+			slog.Error("Error adding new user to the default organization", slog.String("username", username), slog.String("error", err.Error()))
+			return newuser, fmt.Errorf("error adding user to the default organization: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return newuser, err
+	}
 	newuser.ParseUserFromDb(qry)
-	return newuser, err
+	recordUserChange(ctx, audit_log.ActionCreate, newuser.Id, nil, &newuser)
+	return newuser, nil
 }
 
 func (us *UserCRUDService) GetUserByName(username string) (*UserDao, error) {
@@ -107,15 +188,78 @@ func (us *UserCRUDService) GetUserByName(username string) (*UserDao, error) {
 	return user, nil
 }
 
-func (us *UserCRUDService) updateUserPasswordById(id uuid.UUID, password string) error {
-	hashed_pw, _ := hashing.HashPassword(password)
+// updateUserPasswordById enforces the password policy and refuses the current password
+// or any of the last HistoryCount passwords. The replaced hash is added to the history.
+func (us *UserCRUDService) updateUserPasswordById(ctx context.Context, id uuid.UUID, password string) error {
+	policy := password_policy.Default()
+	if err := policy.Validate(password); err != nil {
+		return err
+	}
+
+	tx, err := us.DbConn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	queries := infra_db_pg.New(us.DbConn).WithTx(tx)
+
+	current, err := queries.GetUserPasswordHashById(ctx, id)
+	if err != nil {
+		slog.Error("Error fetching current password hash", slog.String("ID", fmt.Sprint(id)), slog.String("Error", err.Error()))
+		return fmt.Errorf("error fetching current password: %w", err)
+	}
+
+	if policy.HistoryCount > 0 {
+		previous, err := queries.GetPasswordHistoryByUserId(ctx, infra_db_pg.GetPasswordHistoryByUserIdParams{
+			UserID:       id,
+			HistoryLimit: int32(policy.HistoryCount),
+		})
+		if err != nil {
+			return fmt.Errorf("error fetching password history: %w", err)
+		}
+		if current.Valid {
+			previous = append(previous, current.String)
+		}
+		for _, hash := range previous {
+			if hashing.VerifyPassword(password, hash) {
+				return password_policy.ErrPasswordReused
+			}
+		}
+
+		if current.Valid && current.String != "" {
+			err = queries.InsertPasswordHistory(ctx, infra_db_pg.InsertPasswordHistoryParams{UserID: id, PasswordHash: current.String})
+			if err != nil {
+				return fmt.Errorf("error recording password history: %w", err)
+			}
+			err = queries.PrunePasswordHistory(ctx, infra_db_pg.PrunePasswordHistoryParams{UserID: id, HistoryLimit: int32(policy.HistoryCount)})
+			if err != nil {
+				return fmt.Errorf("error pruning password history: %w", err)
+			}
+		}
+	}
+
+	hashed_pw, err := hashing.HashPassword(password)
+	if err != nil {
+		return err
+	}
 	params := &infra_db_pg.UpdateUserPasswordByIdParams{ID: id, Password: pgtype.Text{String: hashed_pw, Valid: true}}
-	queries := infra_db_pg.New(us.DbConn)
-	err := queries.UpdateUserPasswordById(context.Background(), *params)
+	err = queries.UpdateUserPasswordById(ctx, *params)
 	if err != nil {
 		slog.Error("Error updating user password in database", slog.String("ID", fmt.Sprint(id)), slog.String("Error", err.Error()))
+		return err
 	}
-	return err
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	// Both hashes are redacted, the entry only shows that the password changed.
+	audit_log.Record(ctx, audit_log.Event{
+		Action:       audit_log.ActionUpdate,
+		ResourceType: audit_log.ResourceUser,
+		ResourceId:   id.String(),
+		Before:       map[string]string{"password": current.String},
+		After:        map[string]string{"password": hashed_pw},
+	})
+	return nil
 }
 
 func (us *UserCRUDService) GetUserById(id uuid.UUID) (*UserDao, error) {
@@ -131,17 +275,19 @@ func (us *UserCRUDService) GetUserById(id uuid.UUID) (*UserDao, error) {
 	return user, nil
 }
 
-func (us *UserCRUDService) UpdateUserEmailById(id uuid.UUID, email string) (*UserDao, error) {
+func (us *UserCRUDService) UpdateUserEmailById(ctx context.Context, id uuid.UUID, email string) (*UserDao, error) {
 	user := &UserDao{Id: id, Email: email}
 	params := infra_db_pg.UpdateUserEmailByIdParams{ID: id, Email: pgtype.Text{String: email, Valid: true}}
 
+	before := us.currentUser(id)
 	queries := infra_db_pg.New(us.DbConn)
-	dbuser, err := queries.UpdateUserEmailById(context.Background(), params)
+	dbuser, err := queries.UpdateUserEmailById(ctx, params)
 	if err != nil {
 		slog.Error("Error updating email for user.", slog.String("ID", fmt.Sprintf("%d", id)), slog.String("Error", err.Error()), slog.String("Email", email))
 		return user, err
 	}
 	user.ParseUserFromDb(dbuser)
+	recordUserChange(ctx, audit_log.ActionUpdate, id, before, us.currentUser(id))
 	return user, nil
 }
 
@@ -208,103 +354,181 @@ func (us *UserCRUDService) GetAllAppPermissions() ([]AppPermissionDao, error) {
 	return appPermissionDaos, nil
 }
 
-func (us *UserCRUDService) EnableUserById(targetUserid uuid.UUID) (*UserDao, error) {
+func (us *UserCRUDService) EnableUserById(ctx context.Context, targetUserid uuid.UUID) (*UserDao, error) {
 	user := &UserDao{Id: targetUserid}
 
+	before := us.currentUser(targetUserid)
 	params := infra_db_pg.EnableUserByIdParams{ID: targetUserid, Enabled: true}
 	queries := infra_db_pg.New(us.DbConn)
-	rows, err := queries.EnableUserById(context.Background(), params)
+	rows, err := queries.EnableUserById(ctx, params)
 	if err != nil {
 		user.ParseUserFromDb(rows)
 		slog.Error("error enabling user", slog.String("targetUser", fmt.Sprint(targetUserid)))
 		return user, err
 	}
 	user.ParseUserFromDb(rows)
+	recordUserChange(ctx, audit_log.ActionUpdate, targetUserid, before, us.currentUser(targetUserid))
 	return user, err
 }
 
-func (us *UserCRUDService) DisableUserById(targetUserid uuid.UUID) (*UserDao, error) {
+func (us *UserCRUDService) DisableUserById(ctx context.Context, targetUserid uuid.UUID) (*UserDao, error) {
 	user := &UserDao{Id: targetUserid}
 
+	before := us.currentUser(targetUserid)
 	params := infra_db_pg.DisableUserByIdParams{ID: targetUserid, Enabled: false}
 	queries := infra_db_pg.New(us.DbConn)
-	rows, err := queries.DisableUserById(context.Background(), params)
+	rows, err := queries.DisableUserById(ctx, params)
 	if err != nil {
 		user.ParseUserFromDb(rows)
 		slog.Error("error enabling user", slog.String("targetUser", fmt.Sprint(targetUserid)))
 		return user, err
 	}
 	user.ParseUserFromDb(rows)
+	recordUserChange(ctx, audit_log.ActionUpdate, targetUserid, before, us.currentUser(targetUserid))
+
+	err = us.endUserSessions(targetUserid, token_denylist.ReasonUserDisabled)
 	return user, err
 }
 
-func (us *UserCRUDService) UpdateUserRoleMapping(targetUserid uuid.UUID, roleId uuid.UUID) error {
+// ResetUserPassword sets a new password after a self-service reset and ends every
+// session of the user.
+func (us *UserCRUDService) ResetUserPassword(ctx context.Context, targetUserId uuid.UUID, newPassword string) error {
+	if err := us.updateUserPasswordById(ctx, targetUserId, newPassword); err != nil {
+		return err
+	}
+	return us.endUserSessions(targetUserId, token_denylist.ReasonPasswordReset)
+}
+
+// UnlockUserById clears the login lockout and failure counter of the target user.
+func (us *UserCRUDService) UnlockUserById(execUserId uuid.UUID, targetUserId uuid.UUID) (*UserDao, error) {
+	if us.Lockouts == nil {
+		return nil, ErrLockoutsNotConfigured
+	}
+	user, err := us.GetUserById(targetUserId)
+	if err != nil {
+		return user, err
+	}
+	if err := us.Lockouts.UnlockUser(context.Background(), user.UserName, execUserId); err != nil {
+		slog.Error("error unlocking user", slog.String("targetUser", fmt.Sprint(targetUserId)), slog.String("error", err.Error()))
+		return user, err
+	}
+	return user, nil
+}
+
+// endUserSessions revokes every refresh token and outstanding access token of the user so
+// disabled or deleted users lose access immediately.
+func (us *UserCRUDService) endUserSessions(targetUserid uuid.UUID, reason string) error {
+	queries := infra_db_pg.New(us.DbConn)
+	err := queries.RevokeRefreshTokensByUserId(context.Background(), targetUserid)
+	if err != nil {
+		slog.Error("error revoking user refresh tokens", slog.String("targetUser", fmt.Sprint(targetUserid)), slog.String("error", err.Error()))
+		return fmt.Errorf("error ending sessions for user %s: %w", targetUserid, err)
+	}
+	return us.revokeUserAccessTokens(targetUserid, reason)
+}
+
+// revokeUserAccessTokens adds the user's outstanding access tokens to the denylist.
+func (us *UserCRUDService) revokeUserAccessTokens(targetUserid uuid.UUID, reason string) error {
+	denylist := token_denylist.Default()
+	if denylist == nil {
+		denylist = token_denylist.NewPgTokenDenylist(us.DbConn)
+	}
+	return denylist.RevokeUserTokens(context.Background(), targetUserid, reason)
+}
+
+func (us *UserCRUDService) UpdateUserRoleMapping(ctx context.Context, targetUserid uuid.UUID, roleId uuid.UUID) error {
+	before := us.currentUserRoleMapping(ctx, targetUserid, roleId)
 	params := infra_db_pg.InsertOrUpdateUserRoleMappingByIdParams{UserID: targetUserid, RoleID: roleId}
 	queries := infra_db_pg.New(us.DbConn)
-	_, err := queries.InsertOrUpdateUserRoleMappingById(context.Background(), params)
+	row, err := queries.InsertOrUpdateUserRoleMappingById(ctx, params)
 	if err != nil {
 		slog.Error("error modifying user group mappings", slog.String("targetUser", fmt.Sprint(targetUserid)))
 		return err
 	}
-	return err
+	after := &UserRoleMappingDao{}
+	after.ParseUserRoleMappingFromDb(row)
+	recordUserRoleMappingChange(ctx, createOrUpdate(before != nil), after.Id, before, after)
+	return us.revokeUserAccessTokens(targetUserid, token_denylist.ReasonRoleChanged)
 }
 
-func (us *UserCRUDService) DisableUserRoleMapping(targetUserId uuid.UUID, roleId uuid.UUID) error {
+func (us *UserCRUDService) DisableUserRoleMapping(ctx context.Context, targetUserId uuid.UUID, roleId uuid.UUID) error {
+	before := us.currentUserRoleMapping(ctx, targetUserId, roleId)
 	params := infra_db_pg.DisableUserRoleMappingByIdParams{UserID: targetUserId, RoleID: roleId}
 	queries := infra_db_pg.New(us.DbConn)
-	_, err := queries.DisableUserRoleMappingById(context.Background(), params)
+	row, err := queries.DisableUserRoleMappingById(ctx, params)
 	if err != nil {
 		slog.Error("error modifying user group mappings", slog.String("targetUser", fmt.Sprint(targetUserId)))
 		return err
 	}
-	return err
+	// The mapping row is kept disabled, the diff shows it being switched off.
+	after := &UserRoleMappingDao{}
+	after.ParseUserRoleMappingFromDb(row)
+	recordUserRoleMappingChange(ctx, audit_log.ActionDelete, after.Id, before, after)
+	return us.revokeUserAccessTokens(targetUserId, token_denylist.ReasonRoleChanged)
 }
 
-func (us *UserCRUDService) CreateOrUpdateUserRole(roleName string, roleDescr string) (*UserRoleDao, error) {
+func (us *UserCRUDService) CreateOrUpdateUserRole(ctx context.Context, roleName string, roleDescr string) (*UserRoleDao, error) {
 	retVal := &UserRoleDao{RoleName: roleName, RoleDescription: roleDescr}
 	params := infra_db_pg.InsertOrUpdateUserRoleParams{RoleName: roleName, RoleDescription: pgtype.Text{String: roleDescr, Valid: true}}
 	queries := infra_db_pg.New(us.DbConn)
+	var before *UserRoleDao
+	if current, err := queries.GetUserRoleByName(ctx, roleName); err == nil {
+		before = &UserRoleDao{}
+		before.ParseUserRoleFromDb(current)
+	}
 	slog.Info("Executing InsertOrUpdateUserRole query", slog.String("roleName", roleName), slog.String("roleDesc", roleDescr))
-	row, err := queries.InsertOrUpdateUserRole(context.Background(), params)
+	row, err := queries.InsertOrUpdateUserRole(ctx, params)
 	if err != nil {
 		slog.Error("error creating or updateing role", slog.String("roleName", roleName), slog.String("error", err.Error()))
 		return retVal, err
 	}
 	retVal.ParseUserRoleFromDb(row)
+	// Updating an existing role re-enables it.
+	permission_cache.Invalidate(ctx, row.ID)
+	recordRoleChange(ctx, createOrUpdate(before != nil), row.ID, before, retVal)
 
 	return retVal, err
 }
 
-func (us *UserCRUDService) EnableRoleById(id uuid.UUID) error {
+func (us *UserCRUDService) EnableRoleById(ctx context.Context, id uuid.UUID) error {
+	before := us.currentRole(ctx, id)
 	queries := infra_db_pg.New(us.DbConn)
 	slog.Info("Executing EnableUserRoleById Query", slog.String("id", fmt.Sprint(id)))
-	err := queries.EnableUserRoleById(context.Background(), id)
+	err := queries.EnableUserRoleById(ctx, id)
 	if err != nil {
 		slog.Error("Error executing EnableUserRoleById Query", slog.String("error", err.Error()))
 		return err
 	}
+	permission_cache.Invalidate(ctx, id)
+	recordRoleChange(ctx, audit_log.ActionUpdate, id, before, us.currentRole(ctx, id))
 	return err
 }
 
-func (us *UserCRUDService) DisableRoleById(id uuid.UUID) error {
+func (us *UserCRUDService) DisableRoleById(ctx context.Context, id uuid.UUID) error {
+	before := us.currentRole(ctx, id)
 	queries := infra_db_pg.New(us.DbConn)
 	slog.Info("Executing DisableUserRoleById Query", slog.String("id", fmt.Sprint(id)))
-	err := queries.DisableUserRoleById(context.Background(), id)
+	err := queries.DisableUserRoleById(ctx, id)
 	if err != nil {
 		slog.Error("Error executing DisableUserRoleById Query", slog.String("error", err.Error()))
 		return err
 	}
+	permission_cache.Invalidate(ctx, id)
+	recordRoleChange(ctx, audit_log.ActionUpdate, id, before, us.currentRole(ctx, id))
 	return err
 }
 
-func (us *UserCRUDService) SoftDeleteRoleById(id uuid.UUID) error {
+func (us *UserCRUDService) SoftDeleteRoleById(ctx context.Context, id uuid.UUID) error {
+	before := us.currentRole(ctx, id)
 	queries := infra_db_pg.New(us.DbConn)
 	slog.Info("Executing SoftDeleteUserRoleById Query", slog.String("id", fmt.Sprint(id)))
-	err := queries.SoftDeleteUserRoleById(context.Background(), id)
+	err := queries.SoftDeleteUserRoleById(ctx, id)
 	if err != nil {
 		slog.Error("Error executing SoftDeleteUserRoleById Query", slog.String("error", err.Error()))
 		return err
 	}
+	permission_cache.Invalidate(ctx, id)
+	recordRoleChange(ctx, audit_log.ActionDelete, id, before, nil)
 	return err
 }
 
@@ -324,33 +548,132 @@ func (us *UserCRUDService) CreateOrUpdateAppPermission(name string, desc string)
 	return retVal, err
 }
 
-func (us *UserCRUDService) CreateOrUpdateRolePermisssionMapping(roleId uuid.UUID, permId uuid.UUID) (*RolePermissionMappingDao, error) {
+func (us *UserCRUDService) CreateOrUpdateRolePermisssionMapping(ctx context.Context, roleId uuid.UUID, permId uuid.UUID) (*RolePermissionMappingDao, error) {
 	retVal := &RolePermissionMappingDao{RoleId: roleId, PermissionId: permId}
 	params := infra_db_pg.InsertOrUpdateRolePermissionMappingParams{RoleID: roleId, PermissionID: permId}
 	queries := infra_db_pg.New(us.DbConn)
+	var before *RolePermissionMappingDao
+	if current, err := queries.GetRolePermissionMapping(ctx, infra_db_pg.GetRolePermissionMappingParams{RoleID: roleId, PermissionID: permId}); err == nil {
+		before = &RolePermissionMappingDao{}
+		before.ParseRolePermissionMappingFromDb(current)
+	}
 
 	slog.Info("Creating Role Permission Mapping", slog.String("RoleId", fmt.Sprint(roleId)), slog.String("PermissionId", fmt.Sprint(permId)))
-	row, err := queries.InsertOrUpdateRolePermissionMapping(context.Background(), params)
+	row, err := queries.InsertOrUpdateRolePermissionMapping(ctx, params)
 	if err != nil {
 		slog.Error("Error executing InsertOrUpdateRolePermissionMapping query", slog.String("error", err.Error()))
 		return retVal, err
 	}
+	permission_cache.Invalidate(ctx, roleId)
 	retVal.ParseRolePermissionMappingFromDb(row)
+	recordRolePermissionMappingChange(ctx, createOrUpdate(before != nil), row.ID, before, retVal)
 
 	return retVal, err
 }
 
-func (us *UserCRUDService) SoftDeleteUserById(targetUserId uuid.UUID) (*UserDao, error) {
+func (us *UserCRUDService) SoftDeleteUserById(ctx context.Context, targetUserId uuid.UUID) (*UserDao, error) {
 	retVal := &UserDao{Id: targetUserId}
+	before := us.currentUser(targetUserId)
 	queries := infra_db_pg.New(us.DbConn)
 
 	slog.Info("Executing SofDeleteUserById", slog.String("targetUserId", fmt.Sprint(targetUserId)))
-	row, err := queries.SoftDeleteUserById(context.Background(), targetUserId)
+	row, err := queries.SoftDeleteUserById(ctx, targetUserId)
 	if err != nil {
 		slog.Error("Error deleteing user", slog.String("error", err.Error()))
 		return retVal, err
 	}
 	retVal.ParseUserFromDb(row)
+	recordUserChange(ctx, audit_log.ActionDelete, targetUserId, before, nil)
 
+	err = us.endUserSessions(targetUserId, token_denylist.ReasonUserDeleted)
 	return retVal, err
 }
+
+// currentUser loads the state of a user for an audit diff, nil when it cannot be read.
+func (us *UserCRUDService) currentUser(id uuid.UUID) *UserDao {
+	user, err := us.GetUserById(id)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// currentRole loads the state of a role for an audit diff, nil when it cannot be read.
+func (us *UserCRUDService) currentRole(ctx context.Context, id uuid.UUID) *UserRoleDao {
+	row, err := infra_db_pg.New(us.DbConn).GetUserRoleById(ctx, id)
+	if err != nil {
+		return nil
+	}
+	role := &UserRoleDao{}
+	role.ParseUserRoleFromDb(row)
+	return role
+}
+
+// currentUserRoleMapping loads a user role mapping for an audit diff, nil when the user
+// never held the role.
+func (us *UserCRUDService) currentUserRoleMapping(ctx context.Context, userId uuid.UUID, roleId uuid.UUID) *UserRoleMappingDao {
+	row, err := infra_db_pg.New(us.DbConn).GetUserRoleMapping(ctx, infra_db_pg.GetUserRoleMappingParams{UserID: userId, RoleID: roleId})
+	if err != nil {
+		return nil
+	}
+	mapping := &UserRoleMappingDao{}
+	mapping.ParseUserRoleMappingFromDb(row)
+	return mapping
+}
+
+// createOrUpdate is the audit action of an upsert.
+func createOrUpdate(existed bool) string {
+	if existed {
+		return audit_log.ActionUpdate
+	}
+	return audit_log.ActionCreate
+}
+
+// recordUserChange audits a user change with the before and after state.
+func recordUserChange(ctx context.Context, action string, id uuid.UUID, before, after *UserDao) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceUser, ResourceId: id.String()}
+	// Assign only non-nil pointers so a missing side stays a nil interface.
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
+
+// recordRoleChange audits a role change with the before and after state.
+func recordRoleChange(ctx context.Context, action string, id uuid.UUID, before, after *UserRoleDao) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceRole, ResourceId: id.String()}
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
+
+// recordUserRoleMappingChange audits a change to the roles of a user.
+func recordUserRoleMappingChange(ctx context.Context, action string, id uuid.UUID, before, after *UserRoleMappingDao) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceUserRoleMapping, ResourceId: id.String()}
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
+
+// recordRolePermissionMappingChange audits a change to the permissions of a role.
+func recordRolePermissionMappingChange(ctx context.Context, action string, id uuid.UUID, before, after *RolePermissionMappingDao) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceRolePermissionMapping, ResourceId: id.String()}
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
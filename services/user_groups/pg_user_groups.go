@@ -0,0 +1,323 @@
+package user_groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/token_denylist"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PgUserGroups struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgUserGroups(db *pgxpool.Pool) *PgUserGroups {
+	return &PgUserGroups{DbConn: db}
+}
+
+// userGroupFromDb converts any of the group rows, which share the GetUserGroupByIdRow columns.
+func userGroupFromDb(row infra_db_pg.GetUserGroupByIdRow) UserGroup {
+	roleIds := row.RoleIds
+	if roleIds == nil {
+		roleIds = make([]uuid.UUID, 0)
+	}
+	return UserGroup{
+		Id:           row.ID,
+		Name:         row.Name,
+		Description:  row.Description.String,
+		RoleIds:      roleIds,
+		CreatedAt:    row.CreatedAt.Time,
+		LastModified: row.LastModified.Time,
+	}
+}
+
+// revokeAccessTokens ends the outstanding access tokens of users whose roles changed so the
+// next refresh picks up the new set.
+func (p *PgUserGroups) revokeAccessTokens(ctx context.Context, userIds ...uuid.UUID) {
+	denylist := token_denylist.Default()
+	if denylist == nil {
+		denylist = token_denylist.NewPgTokenDenylist(p.DbConn)
+	}
+	for _, userId := range userIds {
+		if err := denylist.RevokeUserTokens(ctx, userId, token_denylist.ReasonRoleChanged); err != nil {
+			slog.Error("Error revoking access tokens after group change", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (p *PgUserGroups) memberIds(ctx context.Context, groupId uuid.UUID) ([]uuid.UUID, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	memberIds, err := qry.GetUserGroupMemberIds(ctx, groupId)
+	if err != nil {
+		slog.Error("Error listing user group members", slog.String("groupId", groupId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error listing user group members: %w", err)
+	}
+	return memberIds, nil
+}
+
+func (p *PgUserGroups) GroupRoleIds(ctx context.Context, userId uuid.UUID) (uuid.UUIDs, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	roleIds, err := qry.GetGroupRoleIdsForUser(ctx, userId)
+	if err != nil {
+		slog.Error("Error reading user group roles", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error reading user group roles: %w", err)
+	}
+	return roleIds, nil
+}
+
+func (p *PgUserGroups) CreateGroup(ctx context.Context, req CreateUserGroupRequest) (UserGroup, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return UserGroup{}, fmt.Errorf("%w: name is required", ErrInvalidGroup)
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	row, err := qry.CreateUserGroup(ctx, infra_db_pg.CreateUserGroupParams{
+		Name:        name,
+		Description: pgtype.Text{String: req.Description, Valid: req.Description != ""},
+	})
+	if err != nil {
+		slog.Error("Error creating user group", slog.String("name", name), slog.String("error", err.Error()))
+		return UserGroup{}, fmt.Errorf("error creating user group: %w", err)
+	}
+	return userGroupFromDb(infra_db_pg.GetUserGroupByIdRow{
+		ID:           row.ID,
+		Name:         row.Name,
+		Description:  row.Description,
+		CreatedAt:    row.CreatedAt,
+		LastModified: row.LastModified,
+	}), nil
+}
+
+func (p *PgUserGroups) GetGroup(ctx context.Context, groupId uuid.UUID) (UserGroup, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	row, err := qry.GetUserGroupById(ctx, groupId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UserGroup{}, ErrGroupNotFound
+	}
+	if err != nil {
+		slog.Error("Error reading user group", slog.String("groupId", groupId.String()), slog.String("error", err.Error()))
+		return UserGroup{}, fmt.Errorf("error reading user group: %w", err)
+	}
+	return userGroupFromDb(row), nil
+}
+
+func (p *PgUserGroups) GetAllGroups(ctx context.Context) ([]UserGroup, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetAllUserGroups(ctx)
+	if err != nil {
+		slog.Error("Error listing user groups", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error listing user groups: %w", err)
+	}
+	groups := make([]UserGroup, 0, len(rows))
+	for _, row := range rows {
+		groups = append(groups, userGroupFromDb(infra_db_pg.GetUserGroupByIdRow(row)))
+	}
+	return groups, nil
+}
+
+func (p *PgUserGroups) GetUserGroups(ctx context.Context, userId uuid.UUID) ([]UserGroup, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetUserGroupsByUserId(ctx, userId)
+	if err != nil {
+		slog.Error("Error listing groups of user", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error listing groups of user: %w", err)
+	}
+	groups := make([]UserGroup, 0, len(rows))
+	for _, row := range rows {
+		groups = append(groups, userGroupFromDb(infra_db_pg.GetUserGroupByIdRow(row)))
+	}
+	return groups, nil
+}
+
+func (p *PgUserGroups) UpdateGroup(ctx context.Context, groupId uuid.UUID, req UpdateUserGroupRequest) (UserGroup, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return UserGroup{}, fmt.Errorf("%w: name is required", ErrInvalidGroup)
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	updated, err := qry.UpdateUserGroup(ctx, infra_db_pg.UpdateUserGroupParams{
+		ID:          groupId,
+		Name:        name,
+		Description: pgtype.Text{String: req.Description, Valid: req.Description != ""},
+	})
+	if err != nil {
+		slog.Error("Error updating user group", slog.String("groupId", groupId.String()), slog.String("error", err.Error()))
+		return UserGroup{}, fmt.Errorf("error updating user group: %w", err)
+	}
+	if updated == 0 {
+		return UserGroup{}, ErrGroupNotFound
+	}
+	return p.GetGroup(ctx, groupId)
+}
+
+// DeleteGroup removes the group. Its members lose the roles they held through it.
+func (p *PgUserGroups) DeleteGroup(ctx context.Context, groupId uuid.UUID) error {
+	memberIds, err := p.memberIds(ctx, groupId)
+	if err != nil {
+		return err
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	deleted, err := qry.DeleteUserGroup(ctx, groupId)
+	if err != nil {
+		slog.Error("Error deleting user group", slog.String("groupId", groupId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error deleting user group: %w", err)
+	}
+	if deleted == 0 {
+		return ErrGroupNotFound
+	}
+	p.revokeAccessTokens(ctx, memberIds...)
+	return nil
+}
+
+func (p *PgUserGroups) GetMembers(ctx context.Context, groupId uuid.UUID) ([]GroupMember, error) {
+	if _, err := p.GetGroup(ctx, groupId); err != nil {
+		return nil, err
+	}
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.GetUserGroupMembers(ctx, groupId)
+	if err != nil {
+		slog.Error("Error listing user group members", slog.String("groupId", groupId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error listing user group members: %w", err)
+	}
+	members := make([]GroupMember, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, GroupMember{
+			UserId:   row.UserID,
+			Username: row.Username.String,
+			Email:    row.Email.String,
+			JoinedAt: row.CreatedAt.Time,
+		})
+	}
+	return members, nil
+}
+
+func (p *PgUserGroups) AddMember(ctx context.Context, groupId, userId uuid.UUID) error {
+	if _, err := p.GetGroup(ctx, groupId); err != nil {
+		return err
+	}
+	qry := infra_db_pg.New(p.DbConn)
+	if err := qry.AddUserGroupMember(ctx, infra_db_pg.AddUserGroupMemberParams{GroupID: groupId, UserID: userId}); err != nil {
+		slog.Error("Error adding user group member", slog.String("groupId", groupId.String()), slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error adding user group member: %w", err)
+	}
+	p.revokeAccessTokens(ctx, userId)
+	return nil
+}
+
+func (p *PgUserGroups) RemoveMember(ctx context.Context, groupId, userId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	removed, err := qry.RemoveUserGroupMember(ctx, infra_db_pg.RemoveUserGroupMemberParams{GroupID: groupId, UserID: userId})
+	if err != nil {
+		slog.Error("Error removing user group member", slog.String("groupId", groupId.String()), slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error removing user group member: %w", err)
+	}
+	if removed == 0 {
+		return ErrMemberNotFound
+	}
+	p.revokeAccessTokens(ctx, userId)
+	return nil
+}
+
+func (p *PgUserGroups) AddRole(ctx context.Context, groupId, roleId uuid.UUID) error {
+	if _, err := p.GetGroup(ctx, groupId); err != nil {
+		return err
+	}
+	qry := infra_db_pg.New(p.DbConn)
+	if err := qry.AddUserGroupRole(ctx, infra_db_pg.AddUserGroupRoleParams{GroupID: groupId, RoleID: roleId}); err != nil {
+		slog.Error("Error adding user group role", slog.String("groupId", groupId.String()), slog.String("roleId", roleId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error adding user group role: %w", err)
+	}
+	memberIds, err := p.memberIds(ctx, groupId)
+	if err != nil {
+		return err
+	}
+	p.revokeAccessTokens(ctx, memberIds...)
+	return nil
+}
+
+func (p *PgUserGroups) RemoveRole(ctx context.Context, groupId, roleId uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	removed, err := qry.RemoveUserGroupRole(ctx, infra_db_pg.RemoveUserGroupRoleParams{GroupID: groupId, RoleID: roleId})
+	if err != nil {
+		slog.Error("Error removing user group role", slog.String("groupId", groupId.String()), slog.String("roleId", roleId.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("error removing user group role: %w", err)
+	}
+	if removed == 0 {
+		return ErrGroupRoleNotFound
+	}
+	memberIds, err := p.memberIds(ctx, groupId)
+	if err != nil {
+		return err
+	}
+	p.revokeAccessTokens(ctx, memberIds...)
+	return nil
+}
+
+// EffectivePermissions lists the roles the user holds directly and through groups, and the
+// permissions they grant together.
+func (p *PgUserGroups) EffectivePermissions(ctx context.Context, userId uuid.UUID) (EffectivePermissions, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	if _, err := qry.GetUserById(ctx, userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return EffectivePermissions{}, ErrUserNotFound
+		}
+		slog.Error("Error reading user", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return EffectivePermissions{}, fmt.Errorf("error reading user: %w", err)
+	}
+
+	rows, err := qry.GetEffectiveUserRoles(ctx, userId)
+	if err != nil {
+		slog.Error("Error reading effective user roles", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return EffectivePermissions{}, fmt.Errorf("error reading effective user roles: %w", err)
+	}
+
+	effective := EffectivePermissions{
+		UserId:  userId,
+		RoleIds: make([]uuid.UUID, 0, len(rows)),
+		Roles:   make([]EffectiveRole, 0, len(rows)),
+	}
+	for _, row := range rows {
+		groupIds := row.GroupIds
+		if groupIds == nil {
+			groupIds = make([]uuid.UUID, 0)
+		}
+		effective.RoleIds = append(effective.RoleIds, row.RoleID)
+		effective.Roles = append(effective.Roles, EffectiveRole{
+			RoleId:      row.RoleID,
+			RoleName:    row.RoleName,
+			Direct:      row.Direct,
+			GroupIds:    groupIds,
+			Permissions: make([]string, 0),
+		})
+	}
+
+	permissionRows, err := qry.GetPermissionNamesByRoleIds(ctx, effective.RoleIds)
+	if err != nil {
+		slog.Error("Error reading role permissions", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return EffectivePermissions{}, fmt.Errorf("error reading role permissions: %w", err)
+	}
+	for _, permissionRow := range permissionRows {
+		for i := range effective.Roles {
+			if effective.Roles[i].RoleId == permissionRow.RoleId && permissionRow.Permission.Valid {
+				effective.Roles[i].Permissions = append(effective.Roles[i].Permissions, permissionRow.Permission.String)
+			}
+		}
+	}
+	for i := range effective.Roles {
+		slices.Sort(effective.Roles[i].Permissions)
+	}
+	effective.Permissions = mergePermissions(effective.Roles)
+	return effective, nil
+}
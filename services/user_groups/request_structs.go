@@ -0,0 +1,81 @@
+package user_groups
+
+import "github.com/google/uuid"
+
+// CreateUserGroupRequest names a new group.
+//
+// swagger:model CreateUserGroupRequest
+type CreateUserGroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// UpdateUserGroupRequest replaces the name and description of a group.
+//
+// swagger:model UpdateUserGroupRequest
+type UpdateUserGroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AddGroupMemberRequest names the user to add to a group.
+//
+// swagger:model AddUserGroupMemberRequest
+type AddGroupMemberRequest struct {
+	UserId uuid.UUID `json:"userId"`
+}
+
+// AddGroupRoleRequest names the role every member of the group should hold.
+//
+// swagger:model AddUserGroupRoleRequest
+type AddGroupRoleRequest struct {
+	RoleId uuid.UUID `json:"roleId"`
+}
+
+// swagger:parameters createUserGroup
+type CreateUserGroupRequestWrapper struct {
+	// in: body
+	Body CreateUserGroupRequest `json:"body"`
+}
+
+// swagger:parameters updateUserGroup
+type UpdateUserGroupRequestWrapper struct {
+	// in: body
+	Body UpdateUserGroupRequest `json:"body"`
+}
+
+// swagger:parameters addUserGroupMember
+type AddGroupMemberRequestWrapper struct {
+	// in: body
+	Body AddGroupMemberRequest `json:"body"`
+}
+
+// swagger:parameters addUserGroupRole
+type AddGroupRoleRequestWrapper struct {
+	// in: body
+	Body AddGroupRoleRequest `json:"body"`
+}
+
+// swagger:response UserGroupsResponse
+type UserGroupsResponse struct {
+	// in: body
+	Body []UserGroup `json:"groups"`
+}
+
+// swagger:response UserGroupResponse
+type UserGroupResponse struct {
+	// in: body
+	Body UserGroup `json:"group"`
+}
+
+// swagger:response UserGroupMembersResponse
+type UserGroupMembersResponse struct {
+	// in: body
+	Body []GroupMember `json:"members"`
+}
+
+// swagger:response EffectivePermissionsResponse
+type EffectivePermissionsResponse struct {
+	// in: body
+	Body EffectivePermissions `json:"effectivePermissions"`
+}
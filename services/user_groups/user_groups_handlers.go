@@ -0,0 +1,375 @@
+package user_groups
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// writeUserGroupError maps manager errors to responses.
+func writeUserGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidGroup):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrGroupNotFound), errors.Is(err, ErrMemberNotFound),
+		errors.Is(err, ErrGroupRoleNotFound), errors.Is(err, ErrUserNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// parseGroupPath reads the group id and the id named by param of
+// /user-groups/{ID}/members/{userId} and /user-groups/{ID}/roles/{roleId}.
+func parseGroupPath(w http.ResponseWriter, r *http.Request, param string) (uuid.UUID, uuid.UUID, bool) {
+	groupId, err := uuid.Parse(r.PathValue("ID"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(r.PathValue(param))
+	if err != nil {
+		http.Error(w, "Invalid "+param, http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return groupId, id, true
+}
+
+// swagger:route GET /user-groups user-groups getAllUserGroups
+// List every user group and its roles.
+// responses:
+//
+//	200: UserGroupsResponse
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func GetAllUserGroupsHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groups, err := manager.GetAllGroups(r.Context())
+		if err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+
+		resp := UserGroupsResponse{Body: groups}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route POST /user-groups user-groups createUserGroup
+// Create a user group. It starts without members or roles.
+// responses:
+//
+//	201: UserGroupResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func CreateUserGroupHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CreateUserGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		group, err := manager.CreateGroup(r.Context(), req)
+		if err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+
+		resp := UserGroupResponse{Body: group}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route GET /user-groups/{ID} user-groups getUserGroup
+// Get a user group by ID.
+// responses:
+//
+//	200: UserGroupResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func GetUserGroupHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		group, err := manager.GetGroup(r.Context(), groupId)
+		if err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+
+		resp := UserGroupResponse{Body: group}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route PUT /user-groups/{ID} user-groups updateUserGroup
+// Rename a user group or change its description.
+// responses:
+//
+//	200: UserGroupResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func UpdateUserGroupHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		var req UpdateUserGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		group, err := manager.UpdateGroup(r.Context(), groupId, req)
+		if err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+
+		resp := UserGroupResponse{Body: group}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route DELETE /user-groups/{ID} user-groups deleteUserGroup
+// Delete a user group. Its members lose the roles they held through it.
+// responses:
+//
+//	204: description:Group deleted
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func DeleteUserGroupHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.DeleteGroup(r.Context(), groupId); err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route GET /user-groups/{ID}/members user-groups getUserGroupMembers
+// List the members of a user group.
+// responses:
+//
+//	200: UserGroupMembersResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func GetGroupMembersHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		members, err := manager.GetMembers(r.Context(), groupId)
+		if err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+
+		resp := UserGroupMembersResponse{Body: members}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route POST /user-groups/{ID}/members user-groups addUserGroupMember
+// Add a user to a group. The user's access tokens are revoked so the next refresh carries
+// the group's roles.
+// responses:
+//
+//	204: description:Member added
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func AddGroupMemberHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AddGroupMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserId == uuid.Nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.AddMember(r.Context(), groupId, req.UserId); err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route DELETE /user-groups/{ID}/members/{userId} user-groups removeUserGroupMember
+// Remove a user from a group.
+// responses:
+//
+//	204: description:Member removed
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func RemoveGroupMemberHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, userId, ok := parseGroupPath(w, r, "userId")
+		if !ok {
+			return
+		}
+
+		if err := manager.RemoveMember(r.Context(), groupId, userId); err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route POST /user-groups/{ID}/roles user-groups addUserGroupRole
+// Give every member of a group a role.
+// responses:
+//
+//	204: description:Role added
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func AddGroupRoleHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AddGroupRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RoleId == uuid.Nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.AddRole(r.Context(), groupId, req.RoleId); err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route DELETE /user-groups/{ID}/roles/{roleId} user-groups removeUserGroupRole
+// Remove a role from a group.
+// responses:
+//
+//	204: description:Role removed
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func RemoveGroupRoleHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupId, roleId, ok := parseGroupPath(w, r, "roleId")
+		if !ok {
+			return
+		}
+
+		if err := manager.RemoveRole(r.Context(), groupId, roleId); err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route GET /users/{ID}/groups user-groups getGroupsOfUser
+// List the groups a user belongs to.
+// responses:
+//
+//	200: UserGroupsResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	500: description:Internal Server Error
+func GetGroupsOfUserHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		groups, err := manager.GetUserGroups(r.Context(), userId)
+		if err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+
+		resp := UserGroupsResponse{Body: groups}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route GET /users/{ID}/effective-permissions user-groups getEffectivePermissions
+// Get the roles a user holds directly and through groups, and the permissions they grant.
+// Roles held only within an organization are applied on top of these while it is active.
+// responses:
+//
+//	200: EffectivePermissionsResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	500: description:Internal Server Error
+func GetEffectivePermissionsHandler(manager UserGroupManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		effective, err := manager.EffectivePermissions(r.Context(), userId)
+		if err != nil {
+			writeUserGroupError(w, err)
+			return
+		}
+
+		resp := EffectivePermissionsResponse{Body: effective}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
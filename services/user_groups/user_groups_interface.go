@@ -0,0 +1,28 @@
+package user_groups
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// GroupRoleResolver returns the roles a user holds through group membership. Tokens carry
+// them in role_ids next to the roles mapped to the user directly.
+type GroupRoleResolver interface {
+	GroupRoleIds(ctx context.Context, userId uuid.UUID) (uuid.UUIDs, error)
+}
+
+type UserGroupManager interface {
+	CreateGroup(ctx context.Context, req CreateUserGroupRequest) (UserGroup, error)
+	GetGroup(ctx context.Context, groupId uuid.UUID) (UserGroup, error)
+	GetAllGroups(ctx context.Context) ([]UserGroup, error)
+	GetUserGroups(ctx context.Context, userId uuid.UUID) ([]UserGroup, error)
+	UpdateGroup(ctx context.Context, groupId uuid.UUID, req UpdateUserGroupRequest) (UserGroup, error)
+	DeleteGroup(ctx context.Context, groupId uuid.UUID) error
+	GetMembers(ctx context.Context, groupId uuid.UUID) ([]GroupMember, error)
+	AddMember(ctx context.Context, groupId, userId uuid.UUID) error
+	RemoveMember(ctx context.Context, groupId, userId uuid.UUID) error
+	AddRole(ctx context.Context, groupId, roleId uuid.UUID) error
+	RemoveRole(ctx context.Context, groupId, roleId uuid.UUID) error
+	EffectivePermissions(ctx context.Context, userId uuid.UUID) (EffectivePermissions, error)
+}
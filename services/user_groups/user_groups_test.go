@@ -0,0 +1,50 @@
+package user_groups
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type fakeResolver map[uuid.UUID]uuid.UUIDs
+
+func (f fakeResolver) GroupRoleIds(ctx context.Context, userId uuid.UUID) (uuid.UUIDs, error) {
+	return f[userId], nil
+}
+
+func TestMergePermissionsIsSortedAndUnique(t *testing.T) {
+	roles := []EffectiveRole{
+		{Permissions: []string{"ReadUsers", "CreateUser"}},
+		{Permissions: []string{"ReadUsers", "AlterUser"}},
+	}
+
+	got := mergePermissions(roles)
+	if !slices.Equal(got, []string{"AlterUser", "CreateUser", "ReadUsers"}) {
+		t.Errorf("unexpected permissions %v", got)
+	}
+	if got := mergePermissions(nil); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty list, got %v", got)
+	}
+}
+
+func TestGroupRoleIdsUsesDefaultResolver(t *testing.T) {
+	t.Cleanup(func() { SetDefault(nil) })
+	userId, roleId := uuid.New(), uuid.New()
+
+	SetDefault(nil)
+	roleIds, err := GroupRoleIds(context.Background(), userId)
+	if err != nil || roleIds != nil {
+		t.Fatalf("expected no group roles without a resolver, got %v %v", roleIds, err)
+	}
+
+	SetDefault(fakeResolver{userId: {roleId}})
+	roleIds, err = GroupRoleIds(context.Background(), userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(roleIds, uuid.UUIDs{roleId}) {
+		t.Errorf("unexpected group roles %v", roleIds)
+	}
+}
@@ -0,0 +1,108 @@
+package user_mfa
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	valkey "github.com/valkey-io/valkey-go"
+)
+
+// PgChallengeStore counts the codes submitted per MFA login challenge and marks challenges
+// used in mfa_challenges, so the attempt cap and single use hold across replicas.
+type PgChallengeStore struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgChallengeStore(dbConn *pgxpool.Pool) *PgChallengeStore {
+	return &PgChallengeStore{DbConn: dbConn}
+}
+
+func (p *PgChallengeStore) RecordAttempt(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (int64, bool, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	row, err := qry.RecordMfaChallengeAttempt(ctx, infra_db_pg.RecordMfaChallengeAttemptParams{
+		Jti:       jti,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	return int64(row.Attempts), row.Completed, err
+}
+
+func (p *PgChallengeStore) Complete(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (bool, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.CompleteMfaChallenge(ctx, jti)
+	return rows > 0, err
+}
+
+// StartCleanup periodically deletes expired challenges.
+func (p *PgChallengeStore) StartCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				qry := infra_db_pg.New(p.DbConn)
+				if err := qry.DeleteExpiredMfaChallenges(ctx); err != nil {
+					slog.Error("Error deleting expired mfa challenges", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// ValkeyChallengeStore keeps challenge counters in Valkey. Keys expire with the challenge,
+// so no cleanup job is needed.
+type ValkeyChallengeStore struct {
+	client valkey.Client
+}
+
+func NewValkeyChallengeStore(client valkey.Client) *ValkeyChallengeStore {
+	return &ValkeyChallengeStore{client: client}
+}
+
+func (v *ValkeyChallengeStore) attemptsKey(jti uuid.UUID) string {
+	return fmt.Sprintf("mfa_challenge:attempts:%s", jti)
+}
+
+func (v *ValkeyChallengeStore) completedKey(jti uuid.UUID) string {
+	return fmt.Sprintf("mfa_challenge:completed:%s", jti)
+}
+
+func (v *ValkeyChallengeStore) RecordAttempt(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (int64, bool, error) {
+	k := v.attemptsKey(jti)
+	results := v.client.DoMulti(ctx,
+		v.client.B().Incr().Key(k).Build(),
+		v.client.B().Pexpireat().Key(k).MillisecondsTimestamp(expiresAt.UnixMilli()).Build(),
+		v.client.B().Exists().Key(v.completedKey(jti)).Build(),
+	)
+	for _, res := range results[1:] {
+		if err := res.Error(); err != nil {
+			return 0, false, err
+		}
+	}
+	attempts, err := results[0].AsInt64()
+	if err != nil {
+		return 0, false, err
+	}
+	completed, err := results[2].AsInt64()
+	return attempts, completed > 0, err
+}
+
+func (v *ValkeyChallengeStore) Complete(ctx context.Context, jti uuid.UUID, expiresAt time.Time) (bool, error) {
+	err := v.client.Do(ctx, v.client.B().Set().Key(v.completedKey(jti)).Value("1").
+		Nx().Pxat(expiresAt).Build()).Error()
+	if err != nil {
+		if valkey.IsValkeyNil(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
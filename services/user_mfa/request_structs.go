@@ -0,0 +1,56 @@
+package user_mfa
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// swagger:model TotpEnrollment
+type TotpEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioningUri"`
+}
+
+// swagger:model MfaStatus
+type MfaStatus struct {
+	UserId                 uuid.UUID `json:"userId"`
+	TotpEnabled            bool      `json:"totpEnabled"`
+	TotpPending            bool      `json:"totpPending"`
+	ConfirmedAt            time.Time `json:"confirmedAt,omitempty"`
+	RecoveryCodesRemaining int64     `json:"recoveryCodesRemaining"`
+}
+
+// swagger:model MfaCodeRequest
+type MfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// swagger:parameters confirmTotp disableTotp regenerateRecoveryCodes
+type MfaCodeRequestWrapper struct {
+	// in: body
+	Body MfaCodeRequest `json:"body"`
+}
+
+// swagger:response TotpEnrollmentResponse
+type TotpEnrollmentResponse struct {
+	// in: body
+	Body TotpEnrollment
+}
+
+// swagger:model RecoveryCodes
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// swagger:response RecoveryCodesResponse
+type RecoveryCodesResponse struct {
+	// in: body
+	Body RecoveryCodes
+}
+
+// swagger:response MfaStatusResponse
+type MfaStatusResponse struct {
+	// in: body
+	Body MfaStatus
+}
@@ -0,0 +1,97 @@
+package user_mfa
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/google/uuid"
+)
+
+// RFC 6238 appendix B SHA1 seed "12345678901234567890"
+const rfcTestSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCodeRfcVectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := TotpCode(rfcTestSecret, TotpStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("error computing totp code: %v", err)
+		}
+		if code != expected {
+			t.Fatalf("t=%d: expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTotpCodeSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	previous, _ := TotpCode(rfcTestSecret, TotpStep(now)-1)
+	stale, _ := TotpCode(rfcTestSecret, TotpStep(now)-3)
+
+	step, ok := ValidateTotpCode(rfcTestSecret, previous, now)
+	if !ok || step != TotpStep(now)-1 {
+		t.Fatalf("expected previous step code to be accepted, got step=%d ok=%v", step, ok)
+	}
+	if _, ok := ValidateTotpCode(rfcTestSecret, stale, now); ok {
+		t.Fatal("expected code outside the skew window to be rejected")
+	}
+	if _, ok := ValidateTotpCode(rfcTestSecret, "abc", now); ok {
+		t.Fatal("expected malformed code to be rejected")
+	}
+}
+
+func TestProvisioningUri(t *testing.T) {
+	uri := ProvisioningUri("go-infra", "user@example.com", rfcTestSecret)
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("error parsing provisioning uri: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Fatalf("unexpected provisioning uri %s", uri)
+	}
+	query := parsed.Query()
+	if query.Get("secret") != rfcTestSecret || query.Get("issuer") != "go-infra" {
+		t.Fatalf("unexpected provisioning uri params %s", parsed.RawQuery)
+	}
+}
+
+func TestRecoveryCodeNormalization(t *testing.T) {
+	code, err := generateRecoveryCode()
+	if err != nil {
+		t.Fatalf("error generating recovery code: %v", err)
+	}
+	if len(code) != recoveryCodeLength+1 {
+		t.Fatalf("unexpected recovery code format %s", code)
+	}
+	if hashRecoveryCode(normalizeRecoveryCode(code)) != hashRecoveryCode(normalizeRecoveryCode(" "+code[:5]+code[6:]+" ")) {
+		t.Fatal("expected recovery codes to match regardless of dashes and whitespace")
+	}
+}
+
+func TestSealedTotpSeedIsBoundToItsCredential(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	binding := user_secrets.SecretBinding{UserId: uuid.New(), ApplicationId: uuid.New(), SecretId: uuid.New()}
+
+	sealed, err := sealTotpSeed(rfcTestSecret, binding)
+	if err != nil {
+		t.Fatalf("error sealing seed: %v", err)
+	}
+	seed, err := openTotpSeed(sealed, binding)
+	if err != nil || seed != rfcTestSecret {
+		t.Fatalf("expected seed to round trip, got %q (%v)", seed, err)
+	}
+
+	moved := binding
+	moved.UserId = uuid.New()
+	if _, err := openTotpSeed(sealed, moved); err == nil {
+		t.Fatal("expected a seed copied to another user to be rejected")
+	}
+}
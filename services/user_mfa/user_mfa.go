@@ -0,0 +1,410 @@
+package user_mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	totpExternalAppName = "totp_mfa"
+	recoveryCodeCount   = 10
+	recoveryCodeLength  = 10
+	recoveryCodeChars   = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrMfaAlreadyEnabled = errors.New("totp is already enabled for this user")
+	ErrMfaNotEnrolled    = errors.New("totp enrollment not found for this user")
+	ErrMfaNotEnabled     = errors.New("totp is not enabled for this user")
+	ErrInvalidMfaCode    = errors.New("invalid mfa code")
+)
+
+type PgMfaProvider struct {
+	DbConn *pgxpool.Pool
+}
+
+func NewPgMfaProvider(dbConn *pgxpool.Pool) *PgMfaProvider {
+	return &PgMfaProvider{DbConn: dbConn}
+}
+
+func mfaIssuer() string {
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		return "go-infra"
+	}
+	return issuer
+}
+
+// seedBinding binds a sealed seed to its user, the totp_mfa app and the seed id, the same
+// associated data seeds carried while they were stored as user secrets.
+func seedBinding(ctx context.Context, qry *infra_db_pg.Queries, userId, seedId uuid.UUID) (user_secrets.SecretBinding, error) {
+	appId, err := qry.GetExternalAppIdByName(ctx, totpExternalAppName)
+	if err != nil {
+		slog.Error("Failed to get totp app ID", slog.String("error", err.Error()))
+		return user_secrets.SecretBinding{}, err
+	}
+	return user_secrets.SecretBinding{UserId: userId, ApplicationId: appId, SecretId: seedId}, nil
+}
+
+// sealTotpSeed encrypts the seed in the stored user secret format. It is kept on the
+// credential row rather than in external_auth_tokens so the secrets APIs can not reach it.
+func sealTotpSeed(seed string, binding user_secrets.SecretBinding) ([]byte, error) {
+	ciphertext, err := user_secrets.EncryptBound(seed, binding)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting totp secret: %w", err)
+	}
+	return json.Marshal(user_secrets.PgEncrytpedSecret{
+		UserId:        binding.UserId,
+		ApplicationId: binding.ApplicationId,
+		UserSecret:    &ciphertext,
+	})
+}
+
+func openTotpSeed(sealed []byte, binding user_secrets.SecretBinding) (string, error) {
+	var stored user_secrets.PgEncrytpedSecret
+	if err := json.Unmarshal(sealed, &stored); err != nil {
+		return "", fmt.Errorf("error reading totp secret: %w", err)
+	}
+	if stored.UserSecret == nil {
+		return "", user_secrets.ErrCiphertextTooShort
+	}
+	seed, err := stored.UserSecret.DecryptBound(binding)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting totp secret: %w", err)
+	}
+	return string(seed), nil
+}
+
+// EnrollTotp generates a new seed and stores it as a pending credential. A pending
+// enrollment is replaced, an enabled one must be disabled first.
+func (p *PgMfaProvider) EnrollTotp(userId uuid.UUID, accountName string) (*TotpEnrollment, error) {
+	ctx := context.Background()
+	qry := infra_db_pg.New(p.DbConn)
+
+	existing, err := qry.GetTotpCredentialByUserId(ctx, userId)
+	if err == nil && existing.Enabled {
+		return nil, ErrMfaAlreadyEnabled
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.Error("Error retrieving totp credential", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	txQry := infra_db_pg.New(tx)
+
+	if existing.SeedID != uuid.Nil {
+		if err := txQry.DeleteTotpCredential(ctx, userId); err != nil {
+			slog.Error("Failed to delete pending totp credential", slog.String("error", err.Error()))
+			return nil, err
+		}
+	}
+
+	seedId := uuid.New()
+	binding, err := seedBinding(ctx, txQry, userId, seedId)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealTotpSeed(secret, binding)
+	if err != nil {
+		slog.Error("Failed to seal totp secret", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	err = txQry.InsertTotpCredential(ctx, infra_db_pg.InsertTotpCredentialParams{UserID: userId, SeedID: seedId, Seed: sealed})
+	if err != nil {
+		slog.Error("Failed to store totp credential", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	return &TotpEnrollment{
+		Secret:          secret,
+		ProvisioningUri: ProvisioningUri(mfaIssuer(), accountName, secret),
+	}, nil
+}
+
+func (p *PgMfaProvider) getCredentialAndSeed(ctx context.Context, userId uuid.UUID) (infra_db_pg.UserTotpCredential, string, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	cred, err := qry.GetTotpCredentialByUserId(ctx, userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return cred, "", ErrMfaNotEnrolled
+		}
+		slog.Error("Error retrieving totp credential", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return cred, "", err
+	}
+
+	binding, err := seedBinding(ctx, qry, userId, cred.SeedID)
+	if err != nil {
+		return cred, "", err
+	}
+	seed, err := openTotpSeed(cred.Seed, binding)
+	return cred, seed, err
+}
+
+// ConfirmTotp enables a pending enrollment once the user proves their authenticator works
+// and returns the initial recovery codes.
+func (p *PgMfaProvider) ConfirmTotp(userId uuid.UUID, code string) ([]string, error) {
+	ctx := context.Background()
+	cred, seed, err := p.getCredentialAndSeed(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Enabled {
+		return nil, ErrMfaAlreadyEnabled
+	}
+
+	step, ok := ValidateTotpCode(seed, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMfaCode
+	}
+
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	txQry := infra_db_pg.New(tx)
+	if err := txQry.EnableTotpCredential(ctx, infra_db_pg.EnableTotpCredentialParams{UserID: userId, LastUsedStep: step}); err != nil {
+		slog.Error("Failed to enable totp credential", slog.String("error", err.Error()))
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, txQry, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	slog.Info("Enabled totp for user", slog.String("userId", userId.String()))
+	return codes, nil
+}
+
+// VerifyMfaCode accepts either a current TOTP code or an unused recovery code. TOTP codes
+// and recovery codes are both single use.
+func (p *PgMfaProvider) VerifyMfaCode(userId uuid.UUID, code string) (bool, error) {
+	ctx := context.Background()
+	cred, seed, err := p.getCredentialAndSeed(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	if !cred.Enabled {
+		return false, ErrMfaNotEnabled
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	if step, ok := ValidateTotpCode(seed, code, time.Now()); ok {
+		rows, err := qry.UpdateTotpLastUsedStep(ctx, infra_db_pg.UpdateTotpLastUsedStepParams{UserID: userId, LastUsedStep: step})
+		if err != nil {
+			slog.Error("Error updating totp last used step", slog.String("error", err.Error()))
+			return false, err
+		}
+		// zero rows means this code or a newer one was already used
+		return rows > 0, nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != recoveryCodeLength {
+		return false, nil
+	}
+	rows, err := qry.UseMfaRecoveryCode(ctx, infra_db_pg.UseMfaRecoveryCodeParams{UserID: userId, CodeHash: hashRecoveryCode(normalized)})
+	if err != nil {
+		slog.Error("Error using mfa recovery code", slog.String("error", err.Error()))
+		return false, err
+	}
+	if rows > 0 {
+		slog.Warn("Mfa recovery code used", slog.String("userId", userId.String()))
+	}
+	return rows > 0, nil
+}
+
+func (p *PgMfaProvider) IsMfaEnabled(userId uuid.UUID) (bool, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	cred, err := qry.GetTotpCredentialByUserId(context.Background(), userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		slog.Error("Error retrieving totp credential", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return false, err
+	}
+	return cred.Enabled, nil
+}
+
+// DisableTotp removes the credential with its seed and all recovery codes after verifying
+// a code. It is the only way to turn TOTP off.
+func (p *PgMfaProvider) DisableTotp(userId uuid.UUID, code string) error {
+	ctx := context.Background()
+	valid, err := p.VerifyMfaCode(userId, code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidMfaCode
+	}
+
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	txQry := infra_db_pg.New(tx)
+	if err := txQry.DeleteTotpCredential(ctx, userId); err != nil {
+		slog.Error("Failed to delete totp credential", slog.String("error", err.Error()))
+		return err
+	}
+	if err := txQry.DeleteMfaRecoveryCodesByUserId(ctx, userId); err != nil {
+		slog.Error("Failed to delete mfa recovery codes", slog.String("error", err.Error()))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
+		return err
+	}
+
+	slog.Info("Disabled totp for user", slog.String("userId", userId.String()))
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after verifying a code.
+func (p *PgMfaProvider) RegenerateRecoveryCodes(userId uuid.UUID, code string) ([]string, error) {
+	ctx := context.Background()
+	valid, err := p.VerifyMfaCode(userId, code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidMfaCode
+	}
+
+	tx, err := p.DbConn.Begin(ctx)
+	if err != nil {
+		slog.Error("Failed to begin transaction", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	codes, err := replaceRecoveryCodes(ctx, infra_db_pg.New(tx), userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("Failed to commit transaction", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (p *PgMfaProvider) GetMfaStatus(userId uuid.UUID) (*MfaStatus, error) {
+	ctx := context.Background()
+	status := &MfaStatus{UserId: userId}
+	qry := infra_db_pg.New(p.DbConn)
+
+	cred, err := qry.GetTotpCredentialByUserId(ctx, userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return status, nil
+		}
+		return status, err
+	}
+	status.TotpPending = !cred.Enabled
+	status.TotpEnabled = cred.Enabled
+	status.ConfirmedAt = cred.ConfirmedAt.Time
+
+	remaining, err := qry.CountUnusedMfaRecoveryCodes(ctx, userId)
+	if err != nil {
+		return status, err
+	}
+	status.RecoveryCodesRemaining = remaining
+	return status, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, qry *infra_db_pg.Queries, userId uuid.UUID) ([]string, error) {
+	if err := qry.DeleteMfaRecoveryCodesByUserId(ctx, userId); err != nil {
+		slog.Error("Failed to delete mfa recovery codes", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		err = qry.InsertMfaRecoveryCode(ctx, infra_db_pg.InsertMfaRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: hashRecoveryCode(normalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			slog.Error("Failed to store mfa recovery code", slog.String("error", err.Error()))
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx.
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating recovery code: %w", err)
+	}
+	var sb strings.Builder
+	for i, b := range raw {
+		if i == recoveryCodeLength/2 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(recoveryCodeChars[int(b)%len(recoveryCodeChars)])
+	}
+	return sb.String(), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashRecoveryCode(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,181 @@
+package user_mfa
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeMfaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidMfaCode):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, ErrMfaAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrMfaNotEnrolled), errors.Is(err, ErrMfaNotEnabled):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// swagger:route POST /mfa/totp/enroll mfa enrollTotp
+// Start TOTP enrollment and return the seed and an otpauth provisioning URI for QR codes.
+// responses:
+//
+//	200: TotpEnrollmentResponse
+//	401: description:Unauthorized
+//	409: description:TOTP already enabled
+func EnrollTotpHandler(provider MfaProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		accountName := userID.String()
+		if claims, ok := r.Context().Value(authapi.ClaimsContextKey).(jwt.MapClaims); ok {
+			if email, ok := claims["name"].(string); ok && email != "" {
+				accountName = email
+			}
+		}
+
+		enrollment, err := provider.EnrollTotp(userID, accountName)
+		if err != nil {
+			slog.Error("Failed to enroll totp", slog.String("error", err.Error()))
+			writeMfaError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(enrollment)
+	}))
+}
+
+// swagger:route POST /mfa/totp/verify mfa confirmTotp
+// Confirm a pending TOTP enrollment with a code from the authenticator. Returns the recovery codes, which are only shown once.
+// responses:
+//
+//	200: RecoveryCodesResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+func ConfirmTotpHandler(provider MfaProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req MfaCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		codes, err := provider.ConfirmTotp(userID, req.Code)
+		if err != nil {
+			slog.Error("Failed to confirm totp", slog.String("error", err.Error()))
+			writeMfaError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(RecoveryCodes{RecoveryCodes: codes})
+	}))
+}
+
+// swagger:route POST /mfa/totp/disable mfa disableTotp
+// Disable TOTP with a current TOTP or recovery code. Removes the seed and all recovery codes.
+// responses:
+//
+//	200: description:TOTP disabled
+//	400: description:Invalid request
+//	401: description:Unauthorized
+func DisableTotpHandler(provider MfaProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req MfaCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := provider.DisableTotp(userID, req.Code); err != nil {
+			slog.Error("Failed to disable totp", slog.String("error", err.Error()))
+			writeMfaError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+// swagger:route POST /mfa/recovery-codes mfa regenerateRecoveryCodes
+// Replace all recovery codes after verifying a current TOTP or recovery code.
+// responses:
+//
+//	200: RecoveryCodesResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+func RegenerateRecoveryCodesHandler(provider MfaProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req MfaCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		codes, err := provider.RegenerateRecoveryCodes(userID, req.Code)
+		if err != nil {
+			slog.Error("Failed to regenerate recovery codes", slog.String("error", err.Error()))
+			writeMfaError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(RecoveryCodes{RecoveryCodes: codes})
+	}))
+}
+
+// swagger:route GET /mfa/status mfa getMfaStatus
+// Get the MFA status of the current user.
+// responses:
+//
+//	200: MfaStatusResponse
+//	401: description:Unauthorized
+func GetMfaStatusHandler(provider MfaProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		status, err := provider.GetMfaStatus(userID)
+		if err != nil {
+			slog.Error("Failed to get mfa status", slog.String("error", err.Error()))
+			writeMfaError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}))
+}
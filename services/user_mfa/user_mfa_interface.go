@@ -0,0 +1,15 @@
+package user_mfa
+
+import (
+	"github.com/google/uuid"
+)
+
+type MfaProvider interface {
+	EnrollTotp(userId uuid.UUID, accountName string) (*TotpEnrollment, error)
+	ConfirmTotp(userId uuid.UUID, code string) ([]string, error)
+	DisableTotp(userId uuid.UUID, code string) error
+	RegenerateRecoveryCodes(userId uuid.UUID, code string) ([]string, error)
+	GetMfaStatus(userId uuid.UUID) (*MfaStatus, error)
+	IsMfaEnabled(userId uuid.UUID) (bool, error)
+	VerifyMfaCode(userId uuid.UUID, code string) (bool, error)
+}
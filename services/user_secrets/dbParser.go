@@ -57,3 +57,18 @@ func (t *UserSecretEntry) ParseExternalAppSecretMetadataFromAppName(userSecretIn
 	t.AppInfo.Name = userSecretInfo.ApplicationName
 	t.AppInfo.UrlEndpoint = userSecretInfo.EndpointUrl.String
 }
+
+func (t *UserSecretEntry) ParseSharedSecretFromDb(userSecretInfo infra_db_pg.GetUserSecretsSharedWithUserRow) {
+	t.SecretMetadata.Id = userSecretInfo.AuthTokenID
+	t.SecretMetadata.UserId = userSecretInfo.UserID
+	t.SecretMetadata.Expiration = userSecretInfo.Expiration.Time
+	t.SecretMetadata.CreatedAt = userSecretInfo.TokenCreatedAt.Time
+	t.AppInfo.Id = userSecretInfo.ApplicationID
+	t.AppInfo.Name = userSecretInfo.ApplicationName
+	t.AppInfo.UrlEndpoint = userSecretInfo.EndpointUrl.String
+	t.SharedAccess = &SharedSecretAccess{AccessLevel: userSecretInfo.AccessLevel}
+	if userSecretInfo.GrantExpiresAt.Valid {
+		expiresAt := userSecretInfo.GrantExpiresAt.Time
+		t.SharedAccess.ExpiresAt = &expiresAt
+	}
+}
@@ -1,34 +1,42 @@
 package user_secrets
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"os"
 )
 
+// EncryptedUserSecretsAES256GCM holds the sealed payload for a secret, see payload_format.go
+// for its layout. Secrets written with envelope encryption also carry the data key wrapped
+// by the KEK identified by KeyVersion. Legacy secrets have no WrappedKey and were sealed
+// directly with USER_SEC_KEY.
 type EncryptedUserSecretsAES256GCM struct {
 	UserSecret []byte `json:"userSecret"`
+	KeyVersion int    `json:"keyVersion,omitempty"`
+	WrappedKey []byte `json:"wrappedKey,omitempty"`
+}
+
+type encryptedUserSecretJSON struct {
+	UserSecret string `json:"userSecret"`
+	KeyVersion int    `json:"keyVersion,omitempty"`
+	WrappedKey string `json:"wrappedKey,omitempty"`
 }
 
 func (e *EncryptedUserSecretsAES256GCM) MarshalJSON() ([]byte, error) {
-	type alias struct {
-		UserSecret string `json:"userSecret"`
-	}
-	return json.Marshal(&alias{
+	a := encryptedUserSecretJSON{
 		UserSecret: base64.StdEncoding.EncodeToString(e.UserSecret),
-	})
+		KeyVersion: e.KeyVersion,
+	}
+	if len(e.WrappedKey) > 0 {
+		a.WrappedKey = base64.StdEncoding.EncodeToString(e.WrappedKey)
+	}
+	return json.Marshal(&a)
 }
 
 func (e *EncryptedUserSecretsAES256GCM) UnmarshalJSON(data []byte) error {
-	type alias struct {
-		UserSecret string `json:"userSecret"`
-	}
-	var a alias
+	var a encryptedUserSecretJSON
 	if err := json.Unmarshal(data, &a); err != nil {
 		return err
 	}
@@ -37,9 +45,23 @@ func (e *EncryptedUserSecretsAES256GCM) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	e.UserSecret = decoded
+	e.KeyVersion = a.KeyVersion
+	e.WrappedKey = nil
+	if a.WrappedKey != "" {
+		wrapped, err := base64.StdEncoding.DecodeString(a.WrappedKey)
+		if err != nil {
+			return err
+		}
+		e.WrappedKey = wrapped
+	}
 	return nil
 }
 
+// IsEnveloped reports whether the secret was written with envelope encryption.
+func (e *EncryptedUserSecretsAES256GCM) IsEnveloped() bool {
+	return len(e.WrappedKey) > 0
+}
+
 func (s *EncryptedUserSecretsAES256GCM) PrintSecretInfo() {
 	nonce, ciphertext := s.UserSecret[:12], s.UserSecret[12:]
 	slog.Info("EncryptedUserSecrets Info", slog.String("ciphertext", string(ciphertext)), slog.String("nonce", string(nonce)))
@@ -56,70 +78,149 @@ func (s *EncryptedUserSecretsAES256GCM) NonceString() string {
 	return string(nonce)
 }
 
+// Encrypt seals plaintext without binding it to a stored secret. Secrets persisted in
+// external_auth_tokens must use EncryptBound so they cannot be moved between rows.
 func Encrypt(plaintext string) (EncryptedUserSecretsAES256GCM, error) {
-	var encryptedSecret EncryptedUserSecretsAES256GCM
+	return EncryptBound(plaintext, SecretBinding{})
+}
 
-	secretKey := os.Getenv("USER_SEC_KEY")
+// EncryptBound seals plaintext with a fresh data key in the current payload format, using
+// the binding as AES-GCM associated data, and wraps the data key with the active KEK.
+func EncryptBound(plaintext string, binding SecretBinding) (EncryptedUserSecretsAES256GCM, error) {
+	var encryptedSecret EncryptedUserSecretsAES256GCM
 
-	aes, err := aes.NewCipher([]byte(secretKey))
+	provider, err := currentKeyProvider()
 	if err != nil {
-		slog.Error("Error creating new cipher", "error", err.Error())
+		slog.Error("Error loading key encryption key provider", "error", err.Error())
 		return encryptedSecret, err
 	}
 
-	gcm, err := cipher.NewGCM(aes)
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return encryptedSecret, fmt.Errorf("error generating data key: %w", err)
+	}
+
+	ciphertext, err := sealBoundPayload(dataKey, []byte(plaintext), binding)
 	if err != nil {
 		slog.Error("Error while attempting encrytion", "error", err.Error())
 		return encryptedSecret, err
 	}
 
-	// We need a 12-byte nonce for GCM (modifiable if you use cipher.NewGCMWithNonceSize())
-	// A nonce should always be randomly generated for every encryption.
-	nonce := make([]byte, gcm.NonceSize())
-	_, err = rand.Read(nonce)
+	version, wrappedKey, err := provider.WrapKey(dataKey)
 	if err != nil {
-		panic(err)
+		slog.Error("Error wrapping data key", "error", err.Error(), "provider", provider.Name())
+		return encryptedSecret, err
 	}
 
-	// ciphertext here is actually nonce+ciphertext
-	// So that when we decrypt, just knowing the nonce size
-	// is enough to separate it from the ciphertext.
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 	encryptedSecret.UserSecret = ciphertext
-
+	encryptedSecret.KeyVersion = version
+	encryptedSecret.WrappedKey = wrappedKey
 	return encryptedSecret, nil
 }
 
 func (s *EncryptedUserSecretsAES256GCM) Decrypt() ([]byte, error) {
-	plaintext, err := decrypt(s.String())
+	return s.DecryptBound(SecretBinding{})
+}
+
+// DecryptBound opens the secret, verifying it was sealed for binding. Payloads written
+// before associated data was introduced are still readable while legacy reads are allowed.
+func (s *EncryptedUserSecretsAES256GCM) DecryptBound(binding SecretBinding) ([]byte, error) {
+	dataKey, err := s.dataKey()
+	if err != nil {
+		slog.Error("Error decrypting secret", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	plaintext, _, err := openPayload(dataKey, s.UserSecret, binding)
 	if err != nil {
 		slog.Error("Error decrypting secret", slog.String("error", err.Error()))
-		return plaintext, err
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// Rewrap moves the secret onto the active KEK and the current payload format. Secrets
+// already in the current format only have their data key re-wrapped; older payloads are
+// decrypted and re-encrypted bound to binding. It returns false if nothing changed.
+func (s *EncryptedUserSecretsAES256GCM) Rewrap(binding SecretBinding) (bool, error) {
+	provider, err := currentKeyProvider()
+	if err != nil {
+		return false, err
+	}
+
+	dataKey, err := s.dataKey()
+	if err != nil {
+		return false, err
+	}
+	plaintext, format, err := openPayload(dataKey, s.UserSecret, binding)
+	if err != nil {
+		return false, err
+	}
+
+	if !s.IsEnveloped() || format != payloadFormatCurrent {
+		upgraded, err := EncryptBound(string(plaintext), binding)
+		if err != nil {
+			return false, err
+		}
+		*s = upgraded
+		return true, nil
+	}
+
+	activeVersion, err := provider.ActiveVersion()
+	if err != nil {
+		return false, err
+	}
+	if s.KeyVersion == activeVersion {
+		return false, nil
+	}
+
+	version, wrappedKey, err := provider.WrapKey(dataKey)
+	if err != nil {
+		return false, err
 	}
-	return plaintext, err
+	s.KeyVersion = version
+	s.WrappedKey = wrappedKey
+	return true, nil
 }
 
-func decrypt(ciphertext string) ([]byte, error) {
-	secretKey := os.Getenv("USER_SEC_KEY")
+func (s *EncryptedUserSecretsAES256GCM) dataKey() ([]byte, error) {
+	if !s.IsEnveloped() {
+		return legacyKey()
+	}
 
-	aes, err := aes.NewCipher([]byte(secretKey))
+	provider, err := currentKeyProvider()
 	if err != nil {
-		slog.Error("Error creating new cipher", "error", err.Error())
 		return nil, err
 	}
+	return provider.UnwrapKey(s.KeyVersion, s.WrappedKey)
+}
 
-	gcm, err := cipher.NewGCM(aes)
+// sealAES256GCM returns nonce+ciphertext so that knowing the nonce size is enough to split them.
+func sealAES256GCM(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
-		slog.Error("Error while attempting encrytion", "error", err.Error())
 		return nil, err
 	}
 
-	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	// A nonce should always be randomly generated for every encryption.
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
 
-	plaintext, err := gcm.Open(nil, []byte(nonce), []byte(ciphertext), nil)
+func openAES256GCM(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrCiphertextTooShort
 	}
 
-	return plaintext, err
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
 }
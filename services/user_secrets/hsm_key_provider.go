@@ -0,0 +1,169 @@
+package user_secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrHsmNotRegistered = errors.New("no PKCS#11 session opener registered, build with an HSM binding that calls RegisterHsmSessionOpener")
+
+// HsmKeyHandle is an opaque object handle, the equivalent of a PKCS#11 CK_OBJECT_HANDLE.
+type HsmKeyHandle uint
+
+// HsmSession is the subset of a PKCS#11 session needed to wrap data keys with a
+// non-extractable AES key held in an HSM. Implementations typically use CKM_AES_KEY_WRAP_PAD
+// or CKM_AES_GCM; the key material never leaves the device.
+type HsmSession interface {
+	// FindKey returns the handle of the secret key object with the given CKA_LABEL.
+	FindKey(label string) (HsmKeyHandle, error)
+	WrapKey(kek HsmKeyHandle, dataKey []byte) ([]byte, error)
+	UnwrapKey(kek HsmKeyHandle, wrappedKey []byte) ([]byte, error)
+	Close() error
+}
+
+// HsmConfig holds the values needed to open an authenticated session on a token.
+type HsmConfig struct {
+	ModulePath string
+	Slot       uint
+	Pin        string
+}
+
+// HsmSessionOpener opens a logged-in session. It is registered by the package that links
+// the vendor PKCS#11 module so this package stays free of cgo.
+type HsmSessionOpener func(config HsmConfig) (HsmSession, error)
+
+var (
+	hsmOpenerMu sync.RWMutex
+	hsmOpener   HsmSessionOpener
+)
+
+func RegisterHsmSessionOpener(opener HsmSessionOpener) {
+	hsmOpenerMu.Lock()
+	defer hsmOpenerMu.Unlock()
+	hsmOpener = opener
+}
+
+// HsmKeyProvider wraps data keys with HSM resident KEKs. Each KEK version is a separate
+// key object labelled "<KeyLabel>-v<version>", so rotation is creating a new object on
+// the token and bumping ActiveKeyVersion.
+type HsmKeyProvider struct {
+	Session          HsmSession
+	KeyLabel         string
+	ActiveKeyVersion int
+
+	mu      sync.Mutex
+	handles map[int]HsmKeyHandle
+}
+
+func NewHsmKeyProvider(session HsmSession, keyLabel string, activeVersion int) (*HsmKeyProvider, error) {
+	if session == nil || keyLabel == "" || activeVersion <= 0 {
+		return nil, fmt.Errorf("hsm key provider requires a session, key label and positive active version")
+	}
+	provider := &HsmKeyProvider{
+		Session:          session,
+		KeyLabel:         keyLabel,
+		ActiveKeyVersion: activeVersion,
+		handles:          make(map[int]HsmKeyHandle),
+	}
+	if _, err := provider.handle(activeVersion); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// NewHsmKeyProviderFromEnv reads USER_SEC_HSM_MODULE, USER_SEC_HSM_SLOT, USER_SEC_HSM_PIN or
+// USER_SEC_HSM_PIN_FILE, USER_SEC_HSM_KEY_LABEL and USER_SEC_HSM_KEY_VERSION.
+func NewHsmKeyProviderFromEnv() (*HsmKeyProvider, error) {
+	hsmOpenerMu.RLock()
+	opener := hsmOpener
+	hsmOpenerMu.RUnlock()
+	if opener == nil {
+		return nil, ErrHsmNotRegistered
+	}
+
+	config := HsmConfig{ModulePath: os.Getenv("USER_SEC_HSM_MODULE"), Pin: os.Getenv("USER_SEC_HSM_PIN")}
+	if slot, err := strconv.ParseUint(os.Getenv("USER_SEC_HSM_SLOT"), 10, 32); err == nil {
+		config.Slot = uint(slot)
+	}
+	if pinFile := os.Getenv("USER_SEC_HSM_PIN_FILE"); pinFile != "" {
+		pin, err := os.ReadFile(pinFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading USER_SEC_HSM_PIN_FILE: %w", err)
+		}
+		config.Pin = strings.TrimSpace(string(pin))
+	}
+
+	activeVersion, err := strconv.Atoi(os.Getenv("USER_SEC_HSM_KEY_VERSION"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid USER_SEC_HSM_KEY_VERSION: %w", err)
+	}
+
+	session, err := opener(config)
+	if err != nil {
+		return nil, fmt.Errorf("error opening hsm session: %w", err)
+	}
+	provider, err := NewHsmKeyProvider(session, os.Getenv("USER_SEC_HSM_KEY_LABEL"), activeVersion)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return provider, nil
+}
+
+func (h *HsmKeyProvider) Name() string {
+	return "hsm"
+}
+
+func (h *HsmKeyProvider) ActiveVersion() (int, error) {
+	return h.ActiveKeyVersion, nil
+}
+
+func (h *HsmKeyProvider) WrapKey(dataKey []byte) (int, []byte, error) {
+	kek, err := h.handle(h.ActiveKeyVersion)
+	if err != nil {
+		return 0, nil, err
+	}
+	wrapped, err := h.Session.WrapKey(kek, dataKey)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error wrapping data key in hsm: %w", err)
+	}
+	return h.ActiveKeyVersion, wrapped, nil
+}
+
+func (h *HsmKeyProvider) UnwrapKey(version int, wrappedKey []byte) ([]byte, error) {
+	kek, err := h.handle(version)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := h.Session.UnwrapKey(kek, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key in hsm: %w", err)
+	}
+	return dataKey, nil
+}
+
+func (h *HsmKeyProvider) Close() error {
+	return h.Session.Close()
+}
+
+func (h *HsmKeyProvider) handle(version int) (HsmKeyHandle, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if kek, ok := h.handles[version]; ok {
+		return kek, nil
+	}
+	if h.handles == nil {
+		h.handles = make(map[int]HsmKeyHandle)
+	}
+
+	kek, err := h.Session.FindKey(fmt.Sprintf("%s-v%d", h.KeyLabel, version))
+	if err != nil {
+		return 0, fmt.Errorf("%w: hsm key %s-v%d: %v", ErrUnknownKeyVersion, h.KeyLabel, version, err)
+	}
+	h.handles[version] = kek
+	return kek, nil
+}
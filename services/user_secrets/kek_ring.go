@@ -0,0 +1,177 @@
+package user_secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const dataKeySize = 32
+
+var (
+	ErrUnknownKeyVersion  = errors.New("secret was encrypted with an unknown key encryption key version")
+	ErrNoKeyEncryptionKey = errors.New("no key encryption key configured, set USER_SEC_KEKS or USER_SEC_KEY")
+	ErrCiphertextTooShort = errors.New("ciphertext is shorter than the nonce")
+)
+
+// KekRing holds the versioned key-encryption keys used to wrap per-secret data keys.
+// The active version wraps new data keys; older versions are kept to unwrap existing ones
+// until the re-wrap job has moved every secret onto the active version.
+type KekRing struct {
+	active int
+	keys   map[int][]byte
+}
+
+// NewKekRing builds a ring from AES keys indexed by version.
+func NewKekRing(active int, keys map[int][]byte) (*KekRing, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeyEncryptionKey
+	}
+	ring := &KekRing{active: active, keys: make(map[int][]byte, len(keys))}
+	for version, key := range keys {
+		if version <= 0 {
+			return nil, fmt.Errorf("key encryption key version must be positive, got %d", version)
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("key encryption key version %d must be 16, 24 or 32 bytes, got %d", version, len(key))
+		}
+		ring.keys[version] = key
+	}
+	if _, ok := ring.keys[active]; !ok {
+		return nil, fmt.Errorf("active key encryption key version %d is not configured: %w", active, ErrUnknownKeyVersion)
+	}
+	return ring, nil
+}
+
+// NewKekRingFromEnv reads USER_SEC_KEKS as a comma separated list of version:base64key pairs,
+// e.g. "1:AAAA...,2:BBBB...". USER_SEC_KEK_VERSION selects the active version and defaults to
+// the highest configured one. If USER_SEC_KEKS is unset, USER_SEC_KEY is used as version 1.
+func NewKekRingFromEnv() (*KekRing, error) {
+	envKeks := strings.TrimSpace(os.Getenv("USER_SEC_KEKS"))
+	if envKeks == "" {
+		legacyKey := os.Getenv("USER_SEC_KEY")
+		if legacyKey == "" {
+			return nil, ErrNoKeyEncryptionKey
+		}
+		return newKekRingWithActiveFromEnv(map[int][]byte{1: []byte(legacyKey)})
+	}
+
+	keys, err := parseKekEntries(strings.Split(envKeks, ","), "USER_SEC_KEKS")
+	if err != nil {
+		return nil, err
+	}
+	return newKekRingWithActiveFromEnv(keys)
+}
+
+// NewKekRingFromFile reads version:base64key pairs from a file, one per line, so the KEKs
+// can be mounted from a secret volume or keyring instead of the process environment.
+// Blank lines and lines starting with # are ignored.
+func NewKekRingFromFile(path string) (*KekRing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key encryption key file: %w", err)
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+
+	keys, err := parseKekEntries(entries, path)
+	if err != nil {
+		return nil, err
+	}
+	return newKekRingWithActiveFromEnv(keys)
+}
+
+func parseKekEntries(entries []string, source string) (map[int][]byte, error) {
+	keys := make(map[int][]byte)
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		versionStr, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s entry, expected version:base64key", source)
+		}
+		version, err := strconv.Atoi(strings.TrimSpace(versionStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s version %q: %w", source, versionStr, err)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s key for version %d: %w", source, version, err)
+		}
+		keys[version] = key
+	}
+	return keys, nil
+}
+
+func newKekRingWithActiveFromEnv(keys map[int][]byte) (*KekRing, error) {
+	active := 0
+	for version := range keys {
+		if version > active {
+			active = version
+		}
+	}
+	if envActive := os.Getenv("USER_SEC_KEK_VERSION"); envActive != "" {
+		version, err := strconv.Atoi(envActive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid USER_SEC_KEK_VERSION: %w", err)
+		}
+		active = version
+	}
+
+	return NewKekRing(active, keys)
+}
+
+func (r *KekRing) Name() string {
+	return "local"
+}
+
+func (r *KekRing) ActiveVersion() (int, error) {
+	return r.active, nil
+}
+
+// Versions returns the configured KEK versions in ascending order.
+func (r *KekRing) Versions() []int {
+	versions := make([]int, 0, len(r.keys))
+	for version := range r.keys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// WrapKey encrypts a data key with the active KEK.
+func (r *KekRing) WrapKey(dataKey []byte) (int, []byte, error) {
+	wrapped, err := sealAES256GCM(r.keys[r.active], dataKey)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error wrapping data key: %w", err)
+	}
+	return r.active, wrapped, nil
+}
+
+// UnwrapKey decrypts a data key that was wrapped with the given KEK version.
+func (r *KekRing) UnwrapKey(version int, wrappedKey []byte) ([]byte, error) {
+	kek, ok := r.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKeyVersion, version)
+	}
+	dataKey, err := openAES256GCM(kek, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key with version %d: %w", version, err)
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,85 @@
+package user_secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeEncryptionSurvivesKekRotation(t *testing.T) {
+	v1 := bytes.Repeat([]byte{1}, 32)
+	v2 := bytes.Repeat([]byte{2}, 32)
+	t.Setenv("USER_SEC_KEKS", "1:"+base64.StdEncoding.EncodeToString(v1))
+	t.Setenv("USER_SEC_KEK_VERSION", "")
+	SetKeyProvider(nil)
+
+	secret, err := Encrypt("rotate-me")
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	if secret.KeyVersion != 1 || !secret.IsEnveloped() {
+		t.Fatalf("expected envelope with key version 1, got version %d", secret.KeyVersion)
+	}
+	token, err := json.Marshal(PgEncrytpedSecret{UserSecret: &secret})
+	if err != nil {
+		t.Fatalf("error marshalling: %v", err)
+	}
+
+	t.Setenv("USER_SEC_KEKS", "1:"+base64.StdEncoding.EncodeToString(v1)+",2:"+base64.StdEncoding.EncodeToString(v2))
+	rotated, err := rewrapStoredToken(token, SecretBinding{})
+	if err != nil || rotated == nil {
+		t.Fatalf("expected secret to be re-wrapped, got %v", err)
+	}
+
+	var stored PgEncrytpedSecret
+	if err := json.Unmarshal(rotated, &stored); err != nil {
+		t.Fatalf("error unmarshalling: %v", err)
+	}
+	if stored.UserSecret.KeyVersion != 2 {
+		t.Fatalf("expected key version 2, got %d", stored.UserSecret.KeyVersion)
+	}
+	if !bytes.Equal(stored.UserSecret.UserSecret, secret.UserSecret) {
+		t.Fatal("re-wrap should not re-encrypt the secret payload")
+	}
+	if again, err := rewrapStoredToken(rotated, SecretBinding{}); err != nil || again != nil {
+		t.Fatalf("expected no-op for secret on active key, got %v", err)
+	}
+
+	t.Setenv("USER_SEC_KEKS", "2:"+base64.StdEncoding.EncodeToString(v2))
+	plaintext, err := stored.UserSecret.Decrypt()
+	if err != nil || string(plaintext) != "rotate-me" {
+		t.Fatalf("expected secret to decrypt after retiring version 1, got %q, %v", plaintext, err)
+	}
+	if _, err := secret.Decrypt(); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Fatalf("expected unknown key version for old wrapping, got %v", err)
+	}
+}
+
+func TestLegacySecretIsUpgradedToEnvelope(t *testing.T) {
+	legacyKey := []byte("12345678901234567890123456789012")
+	t.Setenv("USER_SEC_KEY", string(legacyKey))
+	t.Setenv("USER_SEC_KEKS", "3:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32)))
+	SetKeyProvider(nil)
+
+	sealed, err := sealAES256GCM(legacyKey, []byte("legacy"))
+	if err != nil {
+		t.Fatalf("error sealing legacy secret: %v", err)
+	}
+	legacy := EncryptedUserSecretsAES256GCM{UserSecret: sealed}
+	if plaintext, err := legacy.Decrypt(); err != nil || string(plaintext) != "legacy" {
+		t.Fatalf("expected legacy secret to decrypt, got %q, %v", plaintext, err)
+	}
+
+	changed, err := legacy.Rewrap(SecretBinding{})
+	if err != nil || !changed {
+		t.Fatalf("expected legacy secret to be upgraded, got %v", err)
+	}
+	if legacy.KeyVersion != 3 || !legacy.IsEnveloped() {
+		t.Fatalf("expected envelope with key version 3, got %d", legacy.KeyVersion)
+	}
+	if plaintext, err := legacy.Decrypt(); err != nil || string(plaintext) != "legacy" {
+		t.Fatalf("expected upgraded secret to decrypt, got %q, %v", plaintext, err)
+	}
+}
@@ -0,0 +1,86 @@
+package user_secrets
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// KeyProvider wraps and unwraps per-secret data keys with a versioned key-encryption key.
+// The KEK itself never leaves the provider for the Vault and HSM implementations.
+type KeyProvider interface {
+	// Name identifies the backend in logs.
+	Name() string
+	// ActiveVersion is the KEK version used by WrapKey.
+	ActiveVersion() (int, error)
+	// WrapKey encrypts a data key with the active KEK and returns the version used.
+	WrapKey(dataKey []byte) (int, []byte, error)
+	// UnwrapKey decrypts a data key that was wrapped with the given KEK version.
+	UnwrapKey(version int, wrappedKey []byte) ([]byte, error)
+}
+
+// NewKeyProviderFromEnv selects the KEK backend from USER_SEC_KEY_PROVIDER:
+//
+//	env   - USER_SEC_KEKS / USER_SEC_KEY (default)
+//	file  - version:base64key lines read from USER_SEC_KEK_FILE
+//	vault - HashiCorp Vault Transit, see NewVaultTransitKeyProviderFromEnv
+//	hsm   - PKCS#11 style HSM, see NewHsmKeyProviderFromEnv
+func NewKeyProviderFromEnv() (KeyProvider, error) {
+	switch provider := strings.ToLower(os.Getenv("USER_SEC_KEY_PROVIDER")); provider {
+	case "", "env":
+		return NewKekRingFromEnv()
+	case "file":
+		path := os.Getenv("USER_SEC_KEK_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("USER_SEC_KEK_FILE is required for the file key provider")
+		}
+		return NewKekRingFromFile(path)
+	case "vault":
+		return NewVaultTransitKeyProviderFromEnv()
+	case "hsm":
+		return NewHsmKeyProviderFromEnv()
+	default:
+		return nil, fmt.Errorf("unsupported USER_SEC_KEY_PROVIDER %q", provider)
+	}
+}
+
+// legacyKey returns the raw AES key that sealed secrets written before envelope
+// encryption. It is read from USER_SEC_KEY_FILE when set, otherwise USER_SEC_KEY.
+func legacyKey() ([]byte, error) {
+	if path := os.Getenv("USER_SEC_KEY_FILE"); path != "" {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading USER_SEC_KEY_FILE: %w", err)
+		}
+		return []byte(strings.TrimSpace(string(key))), nil
+	}
+	return []byte(os.Getenv("USER_SEC_KEY")), nil
+}
+
+var (
+	defaultKeyProviderMu sync.RWMutex
+	defaultKeyProvider   KeyProvider
+)
+
+// SetKeyProvider installs the provider used by Encrypt and Decrypt. Passing nil makes the
+// package fall back to reading the environment on every call.
+func SetKeyProvider(provider KeyProvider) {
+	defaultKeyProviderMu.Lock()
+	defer defaultKeyProviderMu.Unlock()
+	defaultKeyProvider = provider
+	if provider != nil {
+		slog.Debug("Set user secret key provider", slog.String("provider", provider.Name()))
+	}
+}
+
+func currentKeyProvider() (KeyProvider, error) {
+	defaultKeyProviderMu.RLock()
+	provider := defaultKeyProvider
+	defaultKeyProviderMu.RUnlock()
+	if provider != nil {
+		return provider, nil
+	}
+	return NewKeyProviderFromEnv()
+}
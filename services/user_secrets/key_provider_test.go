@@ -0,0 +1,173 @@
+package user_secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeVaultTransit mimics the encrypt, decrypt and keys endpoints of a Transit mount.
+// Ciphertexts are "vault:v<N>:" + base64(plaintext) so versions can be checked.
+func fakeVaultTransit(t *testing.T, latest *int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "dev-token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var data map[string]any
+		switch r.URL.Path {
+		case "/v1/transit/keys/user-secrets":
+			data = map[string]any{"latest_version": *latest}
+		case "/v1/transit/encrypt/user-secrets":
+			data = map[string]any{"ciphertext": fmt.Sprintf("vault:v%d:%s", *latest, req["plaintext"]), "key_version": *latest}
+		case "/v1/transit/decrypt/user-secrets":
+			parts := strings.SplitN(req["ciphertext"], ":", 3)
+			data = map[string]any{"plaintext": parts[2]}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+}
+
+func TestVaultTransitKeyProvider(t *testing.T) {
+	latest := 1
+	server := fakeVaultTransit(t, &latest)
+	defer server.Close()
+
+	t.Setenv("USER_SEC_KEY_PROVIDER", "vault")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "dev-token")
+	t.Setenv("USER_SEC_VAULT_TRANSIT_KEY", "user-secrets")
+	provider, err := NewKeyProviderFromEnv()
+	if err != nil {
+		t.Fatalf("error creating vault provider: %v", err)
+	}
+	SetKeyProvider(provider)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+
+	secret, err := Encrypt("from-vault")
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	if secret.KeyVersion != 1 || !strings.HasPrefix(string(secret.WrappedKey), "vault:v1:") {
+		t.Fatalf("expected vault v1 wrapped key, got version %d", secret.KeyVersion)
+	}
+
+	latest = 2
+	provider.(*VaultTransitKeyProvider).activeVersion = 0
+	if changed, err := secret.Rewrap(SecretBinding{}); err != nil || !changed {
+		t.Fatalf("expected re-wrap onto vault key version 2, got %v", err)
+	}
+	if secret.KeyVersion != 2 {
+		t.Fatalf("expected key version 2, got %d", secret.KeyVersion)
+	}
+	if plaintext, err := secret.Decrypt(); err != nil || string(plaintext) != "from-vault" {
+		t.Fatalf("expected decrypt through vault, got %q, %v", plaintext, err)
+	}
+
+	secret.KeyVersion = 1
+	if _, err := secret.Decrypt(); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Fatalf("expected version mismatch to be rejected, got %v", err)
+	}
+}
+
+// fakeHsmSession keeps key objects in memory and wraps with AES-GCM in software.
+type fakeHsmSession struct {
+	objects map[string]HsmKeyHandle
+	keys    map[HsmKeyHandle][]byte
+}
+
+func (f *fakeHsmSession) FindKey(label string) (HsmKeyHandle, error) {
+	handle, ok := f.objects[label]
+	if !ok {
+		return 0, errors.New("CKR_OBJECT_HANDLE_INVALID")
+	}
+	return handle, nil
+}
+
+func (f *fakeHsmSession) WrapKey(kek HsmKeyHandle, dataKey []byte) ([]byte, error) {
+	return sealAES256GCM(f.keys[kek], dataKey)
+}
+
+func (f *fakeHsmSession) UnwrapKey(kek HsmKeyHandle, wrappedKey []byte) ([]byte, error) {
+	return openAES256GCM(f.keys[kek], wrappedKey)
+}
+
+func (f *fakeHsmSession) Close() error { return nil }
+
+func TestHsmKeyProvider(t *testing.T) {
+	session := &fakeHsmSession{
+		objects: map[string]HsmKeyHandle{"user-secrets-v1": 11, "user-secrets-v2": 12},
+		keys:    map[HsmKeyHandle][]byte{11: bytes.Repeat([]byte{1}, 32), 12: bytes.Repeat([]byte{2}, 32)},
+	}
+	RegisterHsmSessionOpener(func(config HsmConfig) (HsmSession, error) {
+		if config.Pin != "1234" {
+			return nil, errors.New("CKR_PIN_INCORRECT")
+		}
+		return session, nil
+	})
+	t.Cleanup(func() { RegisterHsmSessionOpener(nil) })
+
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	if err := os.WriteFile(pinFile, []byte("1234\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("USER_SEC_KEY_PROVIDER", "hsm")
+	t.Setenv("USER_SEC_HSM_PIN_FILE", pinFile)
+	t.Setenv("USER_SEC_HSM_KEY_LABEL", "user-secrets")
+	t.Setenv("USER_SEC_HSM_KEY_VERSION", "1")
+	provider, err := NewKeyProviderFromEnv()
+	if err != nil {
+		t.Fatalf("error creating hsm provider: %v", err)
+	}
+
+	dataKey := bytes.Repeat([]byte{9}, 32)
+	version, wrapped, err := provider.WrapKey(dataKey)
+	if err != nil || version != 1 {
+		t.Fatalf("expected wrap with version 1, got %d, %v", version, err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Fatal("wrapped key contains the plaintext data key")
+	}
+	unwrapped, err := provider.UnwrapKey(1, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("expected data key round trip, got %v", err)
+	}
+	if _, err := provider.UnwrapKey(3, wrapped); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Fatalf("expected unknown version for missing hsm object, got %v", err)
+	}
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	kekFile := filepath.Join(t.TempDir(), "keks")
+	contents := "# user secret KEKs\n1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)) +
+		"\n2:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)) + "\n"
+	if err := os.WriteFile(kekFile, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("USER_SEC_KEY_PROVIDER", "file")
+	t.Setenv("USER_SEC_KEK_FILE", kekFile)
+	t.Setenv("USER_SEC_KEK_VERSION", "")
+
+	provider, err := NewKeyProviderFromEnv()
+	if err != nil {
+		t.Fatalf("error creating file provider: %v", err)
+	}
+	if version, _ := provider.ActiveVersion(); version != 2 {
+		t.Fatalf("expected highest version to be active, got %d", version)
+	}
+}
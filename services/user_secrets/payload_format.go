@@ -0,0 +1,111 @@
+package user_secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// payloadFormatLegacy is nonce||ciphertext sealed without associated data. It has no
+	// version byte and is only produced by releases before payloadFormatV1.
+	payloadFormatLegacy byte = 0x00
+	// payloadFormatV1 is 0x01||nonce||ciphertext sealed with SecretBinding as associated data.
+	payloadFormatV1 byte = 0x01
+
+	payloadFormatCurrent = payloadFormatV1
+)
+
+const secretAadDomain = "go-infra/user-secret"
+
+var ErrLegacyFormatDisabled = errors.New("secret uses the legacy ciphertext format and USER_SEC_ALLOW_LEGACY_FORMAT is false")
+
+// SecretBinding identifies the row a ciphertext belongs to. It is authenticated as AES-GCM
+// associated data, so a token copied to another user, app or secret id fails to decrypt.
+type SecretBinding struct {
+	UserId        uuid.UUID
+	ApplicationId uuid.UUID
+	SecretId      uuid.UUID
+}
+
+func (b SecretBinding) associatedData(format byte) []byte {
+	aad := make([]byte, 0, len(secretAadDomain)+1+3*16)
+	aad = append(aad, secretAadDomain...)
+	aad = append(aad, format)
+	aad = append(aad, b.UserId[:]...)
+	aad = append(aad, b.ApplicationId[:]...)
+	aad = append(aad, b.SecretId[:]...)
+	return aad
+}
+
+func sealBoundPayload(key, plaintext []byte, binding SecretBinding) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, 0, 1+len(nonce)+len(plaintext)+gcm.Overhead())
+	payload = append(payload, payloadFormatCurrent)
+	payload = append(payload, nonce...)
+	return gcm.Seal(payload, nonce, plaintext, binding.associatedData(payloadFormatCurrent)), nil
+}
+
+// openPayload decrypts a payload in any supported format and reports which format it was.
+// Legacy payloads carry no version byte, so a payload is only treated as legacy when it
+// does not authenticate as the current format.
+func openPayload(key, payload []byte, binding SecretBinding) ([]byte, byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var boundErr error
+	if len(payload) > 1+gcm.NonceSize() && payload[0] == payloadFormatV1 {
+		nonce, ciphertext := payload[1:1+gcm.NonceSize()], payload[1+gcm.NonceSize():]
+		plaintext, err := gcm.Open(nil, nonce, ciphertext, binding.associatedData(payloadFormatV1))
+		if err == nil {
+			return plaintext, payloadFormatV1, nil
+		}
+		boundErr = err
+	}
+
+	if !legacyFormatAllowed() {
+		if boundErr != nil {
+			return nil, 0, boundErr
+		}
+		return nil, 0, ErrLegacyFormatDisabled
+	}
+
+	plaintext, err := openAES256GCM(key, payload)
+	if err != nil {
+		if boundErr != nil {
+			return nil, 0, boundErr
+		}
+		return nil, 0, err
+	}
+	return plaintext, payloadFormatLegacy, nil
+}
+
+// legacyFormatAllowed can be turned off with USER_SEC_ALLOW_LEGACY_FORMAT=false once the
+// re-wrap job has upgraded every row, so unbound ciphertexts are no longer accepted.
+func legacyFormatAllowed() bool {
+	return !strings.EqualFold(os.Getenv("USER_SEC_ALLOW_LEGACY_FORMAT"), "false")
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,75 @@
+package user_secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBoundCiphertextCannotBeMovedBetweenRows(t *testing.T) {
+	t.Setenv("USER_SEC_KEKS", "1:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	SetKeyProvider(nil)
+
+	owner := SecretBinding{UserId: uuid.New(), ApplicationId: uuid.New(), SecretId: uuid.New()}
+	secret, err := EncryptBound("bound", owner)
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	if secret.UserSecret[0] != payloadFormatV1 {
+		t.Fatalf("expected format byte %d, got %d", payloadFormatV1, secret.UserSecret[0])
+	}
+	if plaintext, err := secret.DecryptBound(owner); err != nil || string(plaintext) != "bound" {
+		t.Fatalf("expected bound secret to decrypt, got %q, %v", plaintext, err)
+	}
+
+	swapped := []SecretBinding{
+		{UserId: uuid.New(), ApplicationId: owner.ApplicationId, SecretId: owner.SecretId},
+		{UserId: owner.UserId, ApplicationId: uuid.New(), SecretId: owner.SecretId},
+		{UserId: owner.UserId, ApplicationId: owner.ApplicationId, SecretId: uuid.New()},
+	}
+	for _, binding := range swapped {
+		if _, err := secret.DecryptBound(binding); err == nil {
+			t.Fatalf("expected ciphertext moved to %+v to fail", binding)
+		}
+	}
+}
+
+func TestUnboundEnvelopeIsUpgradedAndLegacyReadsCanBeDisabled(t *testing.T) {
+	kek := bytes.Repeat([]byte{1}, 32)
+	t.Setenv("USER_SEC_KEKS", "1:"+base64.StdEncoding.EncodeToString(kek))
+	SetKeyProvider(nil)
+	ring, _ := NewKekRingFromEnv()
+
+	// An envelope secret written before associated data was introduced.
+	dataKey := bytes.Repeat([]byte{7}, 32)
+	payload, err := sealAES256GCM(dataKey, []byte("unbound"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, wrapped, _ := ring.WrapKey(dataKey)
+	secret := EncryptedUserSecretsAES256GCM{UserSecret: payload, KeyVersion: version, WrappedKey: wrapped}
+
+	binding := SecretBinding{UserId: uuid.New(), ApplicationId: uuid.New(), SecretId: uuid.New()}
+	if plaintext, err := secret.DecryptBound(binding); err != nil || string(plaintext) != "unbound" {
+		t.Fatalf("expected legacy payload to decrypt, got %q, %v", plaintext, err)
+	}
+
+	t.Setenv("USER_SEC_ALLOW_LEGACY_FORMAT", "false")
+	if _, err := secret.DecryptBound(binding); err == nil {
+		t.Fatal("expected legacy payload to be refused when legacy reads are disabled")
+	}
+
+	t.Setenv("USER_SEC_ALLOW_LEGACY_FORMAT", "true")
+	if changed, err := secret.Rewrap(binding); err != nil || !changed {
+		t.Fatalf("expected legacy payload to be upgraded, got %v", err)
+	}
+	t.Setenv("USER_SEC_ALLOW_LEGACY_FORMAT", "false")
+	if plaintext, err := secret.DecryptBound(binding); err != nil || string(plaintext) != "unbound" {
+		t.Fatalf("expected upgraded payload to decrypt without legacy reads, got %q, %v", plaintext, err)
+	}
+	if changed, err := secret.Rewrap(binding); err != nil || changed {
+		t.Fatalf("expected upgraded payload to be left alone, got %v, %v", changed, err)
+	}
+}
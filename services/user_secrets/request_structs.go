@@ -41,6 +41,7 @@ type RetrievedSecretResponse struct {
 		ExternalApplication uuid.UUID `json:"external_application_id"`
 		Expiration          time.Time `json:"expiration,omitempty"`
 		Secret              string    `json:"secret"`
+		Version             int32     `json:"version,omitempty"`
 	}
 }
 
@@ -79,3 +80,158 @@ type GetUserSecretEntriesByAppNameRequest struct {
 	// In: path
 	APPNAME string
 }
+
+// swagger:parameters addUserSecretVersion
+type AddSecretVersionRequestWrapper struct {
+	// In: path
+	ID string `json:"ID"`
+	// in:body
+	Body AddSecretVersionRequest `json:"body"`
+}
+
+type AddSecretVersionRequest struct {
+	Secret string `json:"secret"`
+	// Fields replaces Secret for typed secrets
+	Fields     map[string]string `json:"fields,omitempty"`
+	Expiration time.Time         `json:"expiration"`
+}
+
+// swagger:parameters listUserSecretVersions
+type ListSecretVersionsRequest struct {
+	// In: path
+	ID string `json:"ID"`
+}
+
+// swagger:parameters getUserSecretVersion destroyUserSecretVersion
+type SecretVersionRequest struct {
+	// In: path
+	ID string `json:"ID"`
+	// In: path
+	VERSION int32 `json:"VERSION"`
+}
+
+// swagger:parameters rollbackUserSecret
+type RollbackSecretRequestWrapper struct {
+	// In: path
+	ID string `json:"ID"`
+	// in:body
+	Body RollbackSecretRequest `json:"body"`
+}
+
+type RollbackSecretRequest struct {
+	Version int32 `json:"version"`
+}
+
+// swagger:response SecretVersionResponse
+type SecretVersionResponse struct {
+	// in: body
+	Body SecretVersionMetadata `json:"secretVersion"`
+}
+
+// swagger:response SecretVersionsResponse
+type SecretVersionsResponse struct {
+	// in: body
+	Body []SecretVersionMetadata `json:"secretVersions"`
+}
+
+// swagger:parameters getExpiringUserSecrets
+type GetExpiringSecretsRequest struct {
+	// Number of days ahead to include, defaults to 14
+	//
+	// In: query
+	Days int `json:"days"`
+}
+
+// swagger:response ExpiringSecretsResponse
+type ExpiringSecretsResponse struct {
+	// in: body
+	Body []ExpiringSecretEntry `json:"expiringSecrets"`
+}
+
+// swagger:parameters createTypedUserSecret
+type CreateTypedSecretRequestWrapper struct {
+	// in:body
+	Body CreateTypedSecretRequest `json:"body"`
+}
+
+type CreateTypedSecretRequest struct {
+	ApplicationID uuid.UUID `json:"application_id"`
+	// One of the types listed by /secrets/types, e.g. basic_auth
+	Type       string            `json:"type"`
+	Fields     map[string]string `json:"fields"`
+	Expiration time.Time         `json:"expiration"`
+}
+
+// swagger:parameters getTypedUserSecret
+type GetTypedSecretRequest struct {
+	// In: path
+	ID string `json:"ID"`
+}
+
+// swagger:parameters getTypedUserSecretField
+type GetSecretFieldRequest struct {
+	// In: path
+	ID string `json:"ID"`
+	// In: path
+	FIELD string `json:"FIELD"`
+}
+
+// swagger:response TypedSecretResponse
+type TypedSecretResponse struct {
+	// in: body
+	Body struct {
+		ID     uuid.UUID         `json:"id"`
+		Type   string            `json:"type"`
+		Fields map[string]string `json:"fields"`
+	}
+}
+
+// swagger:response SecretFieldResponse
+type SecretFieldResponse struct {
+	// in: body
+	Body struct {
+		ID    uuid.UUID `json:"id"`
+		Field string    `json:"field"`
+		Value string    `json:"value"`
+	}
+}
+
+// swagger:response SecretSchemasResponse
+type SecretSchemasResponse struct {
+	// in: body
+	Body []SecretSchema `json:"secretSchemas"`
+}
+
+// swagger:parameters grantUserSecretAccess
+type GrantSecretAccessRequestWrapper struct {
+	// In: path
+	ID string `json:"ID"`
+	// in:body
+	Body NewSecretGrant `json:"body"`
+}
+
+// swagger:parameters listUserSecretGrants
+type ListSecretGrantsRequest struct {
+	// In: path
+	ID string `json:"ID"`
+}
+
+// swagger:parameters revokeUserSecretGrant
+type RevokeSecretGrantRequest struct {
+	// In: path
+	ID string `json:"ID"`
+	// In: path
+	GRANTID string `json:"GRANTID"`
+}
+
+// swagger:response SecretGrantResponse
+type SecretGrantResponse struct {
+	// in: body
+	Body SecretGrant `json:"secretGrant"`
+}
+
+// swagger:response SecretGrantsResponse
+type SecretGrantsResponse struct {
+	// in: body
+	Body []SecretGrant `json:"secretGrants"`
+}
@@ -0,0 +1,190 @@
+package user_secrets
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+)
+
+const DefaultRewrapBatchSize = 500
+
+// RewrapStats summarizes a single pass of the re-wrap job.
+type RewrapStats struct {
+	Scanned   int `json:"scanned"`
+	Rewrapped int `json:"rewrapped"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+}
+
+// RewrapSecrets walks external_auth_tokens, their versions and the TOTP seeds in id order
+// and moves every secret onto the active KEK and the current AAD bound payload format, which
+// also makes it the data migration for rows written before payload format versioning. Rows
+// are updated one at a time with a compare-and-swap on the previous ciphertext, so secrets
+// written concurrently are skipped rather than overwritten.
+func (p *PgUserSecretStore) RewrapSecrets(ctx context.Context, batchSize int32) (RewrapStats, error) {
+	var stats RewrapStats
+	if batchSize <= 0 {
+		batchSize = DefaultRewrapBatchSize
+	}
+
+	qry := infra_db_pg.New(p.db)
+	err := rewrapPages(ctx, batchSize, &stats,
+		func(lastId uuid.UUID) ([]rewrapRow, error) {
+			rows, err := qry.GetExternalAuthTokensAfterId(ctx, infra_db_pg.GetExternalAuthTokensAfterIdParams{ID: lastId, Limit: batchSize})
+			page := make([]rewrapRow, 0, len(rows))
+			for _, row := range rows {
+				binding := SecretBinding{UserId: row.UserID, ApplicationId: row.ExternalAppID, SecretId: row.ID}
+				page = append(page, rewrapRow{id: row.ID, binding: binding, token: row.Token})
+			}
+			return page, err
+		},
+		func(row rewrapRow, token []byte) (int64, error) {
+			return qry.UpdateExternalAuthTokenCiphertext(ctx, infra_db_pg.UpdateExternalAuthTokenCiphertextParams{
+				Token:         token,
+				ID:            row.id,
+				PreviousToken: row.token,
+			})
+		})
+	if err != nil {
+		return stats, err
+	}
+
+	// Version history rows are bound to the stable secret id, not the version row id.
+	err = rewrapPages(ctx, batchSize, &stats,
+		func(lastId uuid.UUID) ([]rewrapRow, error) {
+			rows, err := qry.GetExternalAuthTokenVersionsAfterId(ctx, infra_db_pg.GetExternalAuthTokenVersionsAfterIdParams{ID: lastId, Limit: batchSize})
+			page := make([]rewrapRow, 0, len(rows))
+			for _, row := range rows {
+				binding := SecretBinding{UserId: row.UserID, ApplicationId: row.ExternalAppID, SecretId: row.SecretID}
+				page = append(page, rewrapRow{id: row.ID, binding: binding, token: row.Token})
+			}
+			return page, err
+		},
+		func(row rewrapRow, token []byte) (int64, error) {
+			return qry.UpdateExternalAuthTokenVersionCiphertext(ctx, infra_db_pg.UpdateExternalAuthTokenVersionCiphertextParams{
+				Token:         token,
+				ID:            row.id,
+				PreviousToken: row.token,
+			})
+		})
+	if err != nil {
+		return stats, err
+	}
+
+	// TOTP seeds use the same sealed format but live on their credential row, paged by user.
+	err = rewrapPages(ctx, batchSize, &stats,
+		func(lastId uuid.UUID) ([]rewrapRow, error) {
+			rows, err := qry.GetTotpSeedsAfterUserId(ctx, infra_db_pg.GetTotpSeedsAfterUserIdParams{UserID: lastId, Limit: batchSize})
+			page := make([]rewrapRow, 0, len(rows))
+			for _, row := range rows {
+				binding := SecretBinding{UserId: row.UserID, ApplicationId: row.ExternalAppID, SecretId: row.SeedID}
+				page = append(page, rewrapRow{id: row.UserID, binding: binding, token: row.Seed})
+			}
+			return page, err
+		},
+		func(row rewrapRow, token []byte) (int64, error) {
+			return qry.UpdateTotpSeedCiphertext(ctx, infra_db_pg.UpdateTotpSeedCiphertextParams{
+				Seed:         token,
+				UserID:       row.id,
+				PreviousSeed: row.token,
+			})
+		})
+	return stats, err
+}
+
+type rewrapRow struct {
+	id      uuid.UUID
+	binding SecretBinding
+	token   []byte
+}
+
+// rewrapPages pages through rows in id order, re-wrapping each one and saving it with update.
+func rewrapPages(ctx context.Context, batchSize int32, stats *RewrapStats, page func(lastId uuid.UUID) ([]rewrapRow, error), update func(row rewrapRow, token []byte) (int64, error)) error {
+	lastId := uuid.Nil
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rows, err := page(lastId)
+		if err != nil {
+			slog.Error("Error loading user secrets for re-wrap", slog.String("error", err.Error()))
+			return err
+		}
+
+		for _, row := range rows {
+			stats.Scanned++
+			lastId = row.id
+
+			rewrapped, err := rewrapStoredToken(row.token, row.binding)
+			if err != nil {
+				slog.Error("Error re-wrapping user secret", slog.String("id", row.id.String()), slog.String("error", err.Error()))
+				stats.Failed++
+				continue
+			}
+			if rewrapped == nil {
+				continue
+			}
+
+			updated, err := update(row, rewrapped)
+			if err != nil {
+				slog.Error("Error saving re-wrapped user secret", slog.String("id", row.id.String()), slog.String("error", err.Error()))
+				stats.Failed++
+				continue
+			}
+			if updated == 0 {
+				stats.Skipped++
+				continue
+			}
+			stats.Rewrapped++
+		}
+
+		if len(rows) < int(batchSize) {
+			return nil
+		}
+	}
+}
+
+// StartSecretRewrap periodically re-wraps secrets still using an older KEK.
+func (p *PgUserSecretStore) StartSecretRewrap(ctx context.Context, interval time.Duration, batchSize int32) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			stats, err := p.RewrapSecrets(ctx, batchSize)
+			if err != nil {
+				slog.Error("Error running user secret re-wrap", slog.String("error", err.Error()))
+			} else if stats.Rewrapped > 0 || stats.Failed > 0 {
+				slog.Info("Re-wrapped user secrets", slog.Int("scanned", stats.Scanned), slog.Int("rewrapped", stats.Rewrapped), slog.Int("failed", stats.Failed))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// rewrapStoredToken returns the re-encoded token, or nil if it already uses the active KEK
+// and current payload format.
+func rewrapStoredToken(token []byte, binding SecretBinding) ([]byte, error) {
+	var stored PgEncrytpedSecret
+	if err := json.Unmarshal(token, &stored); err != nil {
+		return nil, err
+	}
+	if stored.UserSecret == nil {
+		return nil, ErrCiphertextTooShort
+	}
+
+	changed, err := stored.UserSecret.Rewrap(binding)
+	if err != nil || !changed {
+		return nil, err
+	}
+	return json.Marshal(stored)
+}
@@ -0,0 +1,357 @@
+package user_secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/mailer"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DefaultExpiryWarnWindow  = 14 * 24 * time.Hour
+	DefaultExpiryGracePeriod = 7 * 24 * time.Hour
+	defaultExpiryBatchSize   = 500
+)
+
+var ErrSecretExpired = errors.New("secret has expired")
+
+// SecretExpiryNotice is sent to the owner of a secret that expires within the warning window.
+type SecretExpiryNotice struct {
+	SecretId        uuid.UUID `json:"secretId"`
+	UserId          uuid.UUID `json:"userId"`
+	Email           string    `json:"email,omitempty"`
+	ApplicationId   uuid.UUID `json:"applicationId"`
+	ApplicationName string    `json:"applicationName"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// ExpiryNotifier delivers expiry warnings. A notice is recorded as sent once every
+// configured notifier accepted it, so failed deliveries are retried on the next run.
+type ExpiryNotifier interface {
+	NotifySecretExpiring(ctx context.Context, notice SecretExpiryNotice) error
+}
+
+// MailExpiryNotifier emails the owner of the secret.
+type MailExpiryNotifier struct {
+	Mailer mailer.Mailer
+}
+
+func (m *MailExpiryNotifier) NotifySecretExpiring(ctx context.Context, notice SecretExpiryNotice) error {
+	if notice.Email == "" {
+		slog.Warn("Secret owner has no email address, skipping expiry mail", slog.String("secretId", notice.SecretId.String()))
+		return nil
+	}
+	body := fmt.Sprintf("Your %s secret %s expires on %s.\n\nAdd a new version before then, it will no longer be returned once expired and is deleted after the grace period.\n",
+		notice.ApplicationName, notice.SecretId, notice.Expiration.UTC().Format(time.RFC1123))
+	return m.Mailer.Send(ctx, mailer.Message{To: notice.Email, Subject: "A secret is about to expire", Body: body})
+}
+
+// WebhookExpiryNotifier posts the notice as JSON. When SigningKey is set the body is signed
+// with HMAC-SHA256 and sent in the X-Signature-256 header as "sha256=<hex>".
+type WebhookExpiryNotifier struct {
+	Url        string
+	SigningKey []byte
+	Client     *http.Client
+}
+
+func (wh *WebhookExpiryNotifier) NotifySecretExpiring(ctx context.Context, notice SecretExpiryNotice) error {
+	payload, err := json.Marshal(struct {
+		Event string `json:"event"`
+		SecretExpiryNotice
+	}{Event: "secret.expiring", SecretExpiryNotice: notice})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.Url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(wh.SigningKey) > 0 {
+		mac := hmac.New(sha256.New, wh.SigningKey)
+		mac.Write(payload)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting secret expiry webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("secret expiry webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ExpiryStats summarizes a single run of the expiry scheduler.
+type ExpiryStats struct {
+	Warned       int   `json:"warned"`
+	NotifyFailed int   `json:"notifyFailed"`
+	Purged       int64 `json:"purged"`
+}
+
+// expiryDb is the connection pool the scheduler runs on. Begin is needed to hold the run
+// lock for the length of a run.
+type expiryDb interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// SecretExpiryScheduler warns owners before their secrets expire and deletes secrets once
+// they have been expired for longer than GracePeriod. Expired secrets are refused by the
+// store as soon as they expire, independent of this scheduler. Every replica may run it,
+// a transaction scoped advisory lock makes sure only one of them processes each run.
+type SecretExpiryScheduler struct {
+	db          expiryDb
+	Notifiers   []ExpiryNotifier
+	WarnWindow  time.Duration
+	GracePeriod time.Duration
+	BatchSize   int32
+}
+
+func NewSecretExpiryScheduler(db expiryDb, notifiers ...ExpiryNotifier) *SecretExpiryScheduler {
+	return &SecretExpiryScheduler{
+		db:          db,
+		Notifiers:   notifiers,
+		WarnWindow:  DefaultExpiryWarnWindow,
+		GracePeriod: DefaultExpiryGracePeriod,
+		BatchSize:   defaultExpiryBatchSize,
+	}
+}
+
+// ConfigureFromEnv reads USER_SEC_EXPIRY_WARN_DAYS and USER_SEC_EXPIRY_GRACE_DAYS.
+func (s *SecretExpiryScheduler) ConfigureFromEnv() {
+	if days, err := strconv.Atoi(os.Getenv("USER_SEC_EXPIRY_WARN_DAYS")); err == nil && days > 0 {
+		s.WarnWindow = time.Duration(days) * 24 * time.Hour
+	}
+	if days, err := strconv.Atoi(os.Getenv("USER_SEC_EXPIRY_GRACE_DAYS")); err == nil && days >= 0 {
+		s.GracePeriod = time.Duration(days) * 24 * time.Hour
+	}
+}
+
+// ExpiryNotifiersFromEnv builds the notifiers listed in USER_SEC_EXPIRY_NOTIFY, a comma
+// separated list of email and webhook. The webhook uses USER_SEC_EXPIRY_WEBHOOK_URL and
+// optionally USER_SEC_EXPIRY_WEBHOOK_SECRET.
+func ExpiryNotifiersFromEnv(m mailer.Mailer) ([]ExpiryNotifier, error) {
+	kinds := os.Getenv("USER_SEC_EXPIRY_NOTIFY")
+	if kinds == "" {
+		kinds = "email"
+	}
+
+	notifiers := make([]ExpiryNotifier, 0)
+	for _, kind := range strings.Split(kinds, ",") {
+		switch strings.TrimSpace(kind) {
+		case "email":
+			if m == nil {
+				return nil, errors.New("email expiry notifications require a mailer")
+			}
+			notifiers = append(notifiers, &MailExpiryNotifier{Mailer: m})
+		case "webhook":
+			url := os.Getenv("USER_SEC_EXPIRY_WEBHOOK_URL")
+			if url == "" {
+				return nil, errors.New("USER_SEC_EXPIRY_WEBHOOK_URL is required for webhook expiry notifications")
+			}
+			notifiers = append(notifiers, &WebhookExpiryNotifier{Url: url, SigningKey: []byte(os.Getenv("USER_SEC_EXPIRY_WEBHOOK_SECRET"))})
+		case "none":
+		default:
+			return nil, fmt.Errorf("unknown USER_SEC_EXPIRY_NOTIFY entry %q", kind)
+		}
+	}
+	return notifiers, nil
+}
+
+// RunOnce sends warnings for secrets entering the warning window and purges secrets past
+// the grace period. It returns without doing anything while another replica is running.
+func (s *SecretExpiryScheduler) RunOnce(ctx context.Context) (ExpiryStats, error) {
+	var stats ExpiryStats
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("error starting secret expiry run: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qry := infra_db_pg.New(tx)
+	locked, err := qry.TryLockSecretExpiryRun(ctx)
+	if err != nil {
+		slog.Error("Error locking secret expiry run", slog.String("error", err.Error()))
+		return stats, err
+	}
+	if !locked {
+		slog.Debug("Secret expiry run in progress on another replica, skipping")
+		return stats, nil
+	}
+
+	for {
+		rows, err := qry.GetExternalAuthTokensExpiringBefore(ctx, infra_db_pg.GetExternalAuthTokensExpiringBeforeParams{
+			WarnBefore: pgtype.Timestamptz{Time: time.Now().Add(s.WarnWindow), Valid: true},
+			RowLimit:   s.BatchSize,
+		})
+		if err != nil {
+			slog.Error("Error loading expiring user secrets", slog.String("error", err.Error()))
+			return stats, err
+		}
+
+		notified := 0
+		for _, row := range rows {
+			notice := SecretExpiryNotice{
+				SecretId:        row.ID,
+				UserId:          row.UserID,
+				Email:           row.Email.String,
+				ApplicationId:   row.ExternalAppID,
+				ApplicationName: row.ApplicationName,
+				Expiration:      row.Expiration.Time,
+			}
+			if err := s.notify(ctx, notice); err != nil {
+				slog.Error("Error sending secret expiry notice", slog.String("secretId", row.ID.String()), slog.String("error", err.Error()))
+				stats.NotifyFailed++
+				continue
+			}
+
+			err := qry.UpsertExternalAuthTokenExpiryNotice(ctx, infra_db_pg.UpsertExternalAuthTokenExpiryNoticeParams{
+				SecretID:   row.ID,
+				Expiration: row.Expiration,
+			})
+			if err != nil {
+				slog.Error("Error recording secret expiry notice", slog.String("secretId", row.ID.String()), slog.String("error", err.Error()))
+				return stats, err
+			}
+			notified++
+			stats.Warned++
+		}
+
+		// Failed notices stay pending, so stop once a batch made no progress.
+		if len(rows) < int(s.BatchSize) || notified == 0 {
+			break
+		}
+	}
+
+	purged, err := qry.PurgeExpiredAuthTokens(ctx, pgtype.Timestamptz{Time: time.Now().Add(-s.GracePeriod), Valid: true})
+	if err != nil {
+		slog.Error("Error purging expired user secrets", slog.String("error", err.Error()))
+		return stats, err
+	}
+	stats.Purged = purged
+	if err := tx.Commit(ctx); err != nil {
+		return stats, fmt.Errorf("error committing secret expiry run: %w", err)
+	}
+	return stats, nil
+}
+
+func (s *SecretExpiryScheduler) notify(ctx context.Context, notice SecretExpiryNotice) error {
+	var errs []error
+	for _, notifier := range s.Notifiers {
+		if err := notifier.NotifySecretExpiring(ctx, notice); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start runs the scheduler immediately and then on every interval until ctx is done.
+func (s *SecretExpiryScheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			stats, err := s.RunOnce(ctx)
+			if err != nil {
+				slog.Error("Error running user secret expiry scheduler", slog.String("error", err.Error()))
+			} else if stats.Warned > 0 || stats.NotifyFailed > 0 || stats.Purged > 0 {
+				slog.Info("Processed expiring user secrets", slog.Int("warned", stats.Warned), slog.Int("notifyFailed", stats.NotifyFailed), slog.Int64("purged", stats.Purged))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ExpiringSecretEntry describes a secret that expires within the requested window or has
+// already expired and is awaiting purge.
+//
+// swagger:model ExpiringSecretEntry
+type ExpiringSecretEntry struct {
+	SecretId        uuid.UUID  `json:"secretId"`
+	ApplicationId   uuid.UUID  `json:"applicationId"`
+	ApplicationName string     `json:"applicationName"`
+	Expiration      time.Time  `json:"expiry"`
+	Expired         bool       `json:"expired"`
+	NotifiedAt      *time.Time `json:"notifiedAt,omitempty"`
+}
+
+// GetExpiringSecretEntries lists the user's secrets expiring within the window, including
+// secrets that have already expired.
+func (p *PgUserSecretStore) GetExpiringSecretEntries(ctx context.Context, userId uuid.UUID, within time.Duration) ([]ExpiringSecretEntry, error) {
+	entries := make([]ExpiringSecretEntry, 0)
+	qry := infra_db_pg.New(p.db)
+	rows, err := qry.GetUserSecretsExpiringBefore(ctx, infra_db_pg.GetUserSecretsExpiringBeforeParams{
+		UserID:         userId,
+		ExpiringBefore: pgtype.Timestamptz{Time: time.Now().Add(within), Valid: true},
+	})
+	if err != nil {
+		slog.Error("Error retrieving expiring secrets from database", slog.String("error", err.Error()))
+		return entries, err
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		entry := ExpiringSecretEntry{
+			SecretId:        row.AuthTokenID,
+			ApplicationId:   row.ApplicationID,
+			ApplicationName: row.ApplicationName,
+			Expiration:      row.Expiration.Time,
+			Expired:         row.Expiration.Time.Before(now),
+		}
+		if row.NotifiedAt.Valid {
+			notifiedAt := row.NotifiedAt.Time
+			entry.NotifiedAt = &notifiedAt
+		}
+		entries = append(entries, entry)
+	}
+	return filterExpiringEntries(ctx, entries)
+}
+
+// filterExpiringEntries keeps the entries owned by the active organization in ctx.
+func filterExpiringEntries(ctx context.Context, entries []ExpiringSecretEntry) ([]ExpiringSecretEntry, error) {
+	ids := make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.SecretId)
+	}
+	allowed, err := organizations.FilterIds(ctx, organizations.ResourceSecret, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(entries, func(entry ExpiringSecretEntry) bool {
+		return !slices.Contains(allowed, entry.SecretId)
+	}), nil
+}
+
+func secretExpired(expiration pgtype.Timestamptz) bool {
+	return expiration.Valid && !expiration.Time.After(time.Now())
+}
@@ -0,0 +1,130 @@
+package user_secrets
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestExpiredSecretIsRefused(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	db := &fakeSecretDb{tokens: map[uuid.UUID]infra_db_pg.ExternalAuthToken{}, delegates: map[uuid.UUID]bool{}}
+	store := NewPgUserSecretStore(db)
+
+	owner := uuid.New()
+	secretId := newFakeSecret(t, db, owner, "stale-token")
+	record := db.tokens[secretId]
+	record.Expiration = pgtype.Timestamptz{Time: time.Now().Add(-time.Minute), Valid: true}
+	db.tokens[secretId] = record
+
+	if _, err := store.RetrieveSecretForUser(context.Background(), owner, secretId); !errors.Is(err, ErrSecretExpired) {
+		t.Fatalf("expected expired secret to be refused, got %v", err)
+	}
+	if _, err := store.RetrieveSecret(secretId); !errors.Is(err, ErrSecretExpired) {
+		t.Fatalf("expected expired secret to be refused for internal callers, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	writeSecretAccessError(rec, ErrSecretExpired)
+	if rec.Code != http.StatusGone {
+		t.Fatalf("expected 410 for expired secret, got %d", rec.Code)
+	}
+}
+
+func TestWebhookExpiryNotifierSignsPayload(t *testing.T) {
+	key := []byte("webhook-signing-key")
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		if r.Header.Get("X-Signature-256") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notice := SecretExpiryNotice{SecretId: uuid.New(), UserId: uuid.New(), ApplicationName: "cloudflare", Expiration: time.Now().Add(48 * time.Hour)}
+	notifier := &WebhookExpiryNotifier{Url: server.URL, SigningKey: key}
+	if err := notifier.NotifySecretExpiring(context.Background(), notice); err != nil {
+		t.Fatalf("expected webhook delivery, got %v", err)
+	}
+	if received["event"] != "secret.expiring" || received["secretId"] != notice.SecretId.String() {
+		t.Fatalf("unexpected webhook payload %v", received)
+	}
+
+	notifier.SigningKey = []byte("wrong-key")
+	if err := notifier.NotifySecretExpiring(context.Background(), notice); err == nil {
+		t.Fatal("expected rejected webhook to be reported as a failure")
+	}
+}
+
+// lockedExpiryDb hands out transactions that never get the run lock, as if another replica
+// were running.
+type lockedExpiryDb struct {
+	queries []string
+}
+
+type lockedExpiryTx struct {
+	pgx.Tx
+	db *lockedExpiryDb
+}
+
+func (d *lockedExpiryDb) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &lockedExpiryTx{db: d}, nil
+}
+
+func (tx *lockedExpiryTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	tx.db.queries = append(tx.db.queries, sql)
+	if strings.Contains(sql, "TryLockSecretExpiryRun") {
+		return fakeRow{values: []any{false}}
+	}
+	return fakeRow{err: errors.New("unexpected query")}
+}
+
+func (tx *lockedExpiryTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+type countingNotifier struct {
+	sent int
+}
+
+func (c *countingNotifier) NotifySecretExpiring(ctx context.Context, notice SecretExpiryNotice) error {
+	c.sent++
+	return nil
+}
+
+func TestSecretExpiryRunIsSkippedWhileAnotherReplicaHoldsTheLock(t *testing.T) {
+	db := &lockedExpiryDb{}
+	notifier := &countingNotifier{}
+	scheduler := NewSecretExpiryScheduler(db, notifier)
+
+	stats, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("expected a skipped run to succeed, got %v", err)
+	}
+	if stats != (ExpiryStats{}) || notifier.sent != 0 {
+		t.Fatalf("expected nothing to be warned or purged, got %+v and %d notices", stats, notifier.sent)
+	}
+	if len(db.queries) != 1 {
+		t.Fatalf("expected only the lock to be queried, got %v", db.queries)
+	}
+}
@@ -0,0 +1,289 @@
+package user_secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// SecretAccessRead lets the grantee retrieve the plaintext.
+	SecretAccessRead = "read"
+	// SecretAccessUse lets server-side features such as SSH connect decrypt the secret for the
+	// grantee without ever returning the plaintext to them.
+	SecretAccessUse = "use"
+)
+
+var (
+	ErrInvalidSecretGrant  = errors.New("a grant needs exactly one grantee user or role and an access level of read or use")
+	ErrSecretGrantNotFound = errors.New("secret grant not found")
+	// ErrSecretGranteeOutsideOrganization wraps ErrInvalidSecretGrant so it is reported as a
+	// bad request.
+	ErrSecretGranteeOutsideOrganization = fmt.Errorf("%w: the grantee does not belong to the secret's organization", ErrInvalidSecretGrant)
+)
+
+// secretAccess is the access a request needs. Owners and holders of
+// DelegatedSecretAccessPermission have every level, grantees at most read.
+type secretAccess int
+
+const (
+	secretAccessUse secretAccess = iota + 1
+	secretAccessRead
+	secretAccessManage
+)
+
+func grantAccessLevel(level string) secretAccess {
+	switch level {
+	case SecretAccessRead:
+		return secretAccessRead
+	case SecretAccessUse:
+		return secretAccessUse
+	default:
+		return 0
+	}
+}
+
+// SecretGrant shares a secret with a user or a role.
+//
+// swagger:model SecretGrant
+type SecretGrant struct {
+	Id            uuid.UUID  `json:"id"`
+	SecretId      uuid.UUID  `json:"secretId"`
+	GranteeUserId *uuid.UUID `json:"granteeUserId,omitempty"`
+	GranteeRoleId *uuid.UUID `json:"granteeRoleId,omitempty"`
+	AccessLevel   string     `json:"accessLevel"`
+	GrantedBy     *uuid.UUID `json:"grantedBy,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+func (g *SecretGrant) ParseSecretGrantFromDb(grant infra_db_pg.ExternalAuthTokenGrant) {
+	g.Id = grant.ID
+	g.SecretId = grant.SecretID
+	g.AccessLevel = grant.AccessLevel
+	g.CreatedAt = grant.CreatedAt.Time
+	if grant.GranteeUserID.Valid {
+		userId := uuid.UUID(grant.GranteeUserID.Bytes)
+		g.GranteeUserId = &userId
+	}
+	if grant.GranteeRoleID.Valid {
+		roleId := uuid.UUID(grant.GranteeRoleID.Bytes)
+		g.GranteeRoleId = &roleId
+	}
+	if grant.GrantedBy.Valid {
+		grantedBy := uuid.UUID(grant.GrantedBy.Bytes)
+		g.GrantedBy = &grantedBy
+	}
+	if grant.ExpiresAt.Valid {
+		expiresAt := grant.ExpiresAt.Time
+		g.ExpiresAt = &expiresAt
+	}
+}
+
+// NewSecretGrant describes a grant to create. A new grant replaces any active grant the
+// same grantee already holds on the secret.
+type NewSecretGrant struct {
+	GranteeUserId *uuid.UUID `json:"granteeUserId,omitempty"`
+	GranteeRoleId *uuid.UUID `json:"granteeRoleId,omitempty"`
+	AccessLevel   string     `json:"accessLevel"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (n NewSecretGrant) validate() error {
+	if (n.GranteeUserId == nil) == (n.GranteeRoleId == nil) || grantAccessLevel(n.AccessLevel) == 0 {
+		return ErrInvalidSecretGrant
+	}
+	if n.ExpiresAt != nil && !n.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expiresAt must be in the future", ErrInvalidSecretGrant)
+	}
+	return nil
+}
+
+// GrantSecretAccess shares a secret. Only the owner or a delegated administrator may grant.
+func (p *PgUserSecretStore) GrantSecretAccess(ctx context.Context, callerId, secretId uuid.UUID, grant NewSecretGrant) (SecretGrant, error) {
+	var created SecretGrant
+	if err := grant.validate(); err != nil {
+		return created, err
+	}
+	if _, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessManage); err != nil {
+		return created, err
+	}
+	allowed, err := organizations.AllowsGrantee(ctx, organizations.ResourceSecret, secretId, grant.GranteeUserId, grant.GranteeRoleId)
+	if err != nil {
+		return created, err
+	}
+	if !allowed {
+		return created, ErrSecretGranteeOutsideOrganization
+	}
+
+	granteeUser := pgtype.UUID{}
+	if grant.GranteeUserId != nil {
+		granteeUser = pgtype.UUID{Bytes: *grant.GranteeUserId, Valid: true}
+	}
+	granteeRole := pgtype.UUID{}
+	if grant.GranteeRoleId != nil {
+		granteeRole = pgtype.UUID{Bytes: *grant.GranteeRoleId, Valid: true}
+	}
+	expiresAt := pgtype.Timestamptz{}
+	if grant.ExpiresAt != nil {
+		expiresAt = pgtype.Timestamptz{Time: *grant.ExpiresAt, Valid: true}
+	}
+
+	err = p.withTx(func(qry *infra_db_pg.Queries) error {
+		err := qry.RevokeActiveExternalAuthTokenGrantsForGrantee(ctx, infra_db_pg.RevokeActiveExternalAuthTokenGrantsForGranteeParams{
+			SecretID:      secretId,
+			GranteeUserID: granteeUser,
+			GranteeRoleID: granteeRole,
+		})
+		if err != nil {
+			return err
+		}
+		inserted, err := qry.InsertExternalAuthTokenGrant(ctx, infra_db_pg.InsertExternalAuthTokenGrantParams{
+			SecretID:      secretId,
+			GranteeUserID: granteeUser,
+			GranteeRoleID: granteeRole,
+			AccessLevel:   grant.AccessLevel,
+			GrantedBy:     pgtype.UUID{Bytes: callerId, Valid: true},
+			ExpiresAt:     expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		created.ParseSecretGrantFromDb(inserted)
+		return nil
+	})
+	if err != nil {
+		slog.Error("Error granting secret access", slog.String("secretId", secretId.String()), slog.String("error", err.Error()))
+		return created, fmt.Errorf("error granting secret access: %w", err)
+	}
+	slog.Info("Granted secret access", slog.String("secretId", secretId.String()), slog.String("grantId", created.Id.String()), slog.String("accessLevel", created.AccessLevel))
+	recordSecretGrantChange(ctx, audit_log.ActionCreate, created.Id, nil, &created)
+	return created, nil
+}
+
+// ListSecretGrants returns the active grants on a secret.
+func (p *PgUserSecretStore) ListSecretGrants(ctx context.Context, callerId, secretId uuid.UUID) ([]SecretGrant, error) {
+	grants := make([]SecretGrant, 0)
+	if _, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessManage); err != nil {
+		return grants, err
+	}
+
+	qry := infra_db_pg.New(p.db)
+	records, err := qry.GetExternalAuthTokenGrants(ctx, secretId)
+	if err != nil {
+		slog.Error("Error retrieving secret grants", slog.String("secretId", secretId.String()), slog.String("error", err.Error()))
+		return grants, err
+	}
+	for _, record := range records {
+		var grant SecretGrant
+		grant.ParseSecretGrantFromDb(record)
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+// RevokeSecretGrant revokes a grant. Revocation takes effect on the grantee's next request.
+func (p *PgUserSecretStore) RevokeSecretGrant(ctx context.Context, callerId, secretId, grantId uuid.UUID) error {
+	if _, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessManage); err != nil {
+		return err
+	}
+
+	qry := infra_db_pg.New(p.db)
+	var before *SecretGrant
+	if grants, err := qry.GetExternalAuthTokenGrants(ctx, secretId); err == nil {
+		for _, grant := range grants {
+			if grant.ID == grantId {
+				before = &SecretGrant{}
+				before.ParseSecretGrantFromDb(grant)
+			}
+		}
+	}
+	revoked, err := qry.RevokeExternalAuthTokenGrant(ctx, infra_db_pg.RevokeExternalAuthTokenGrantParams{ID: grantId, SecretID: secretId})
+	if err != nil {
+		slog.Error("Error revoking secret grant", slog.String("grantId", grantId.String()), slog.String("error", err.Error()))
+		return err
+	}
+	if revoked == 0 {
+		return ErrSecretGrantNotFound
+	}
+	slog.Info("Revoked secret grant", slog.String("secretId", secretId.String()), slog.String("grantId", grantId.String()))
+	recordSecretGrantChange(ctx, audit_log.ActionDelete, grantId, before, nil)
+	return nil
+}
+
+// RetrieveSecretForUse decrypts a secret for a server-side feature acting for callerId. It
+// accepts use grants as well as read grants, so callers must never return the plaintext.
+func (p *PgUserSecretStore) RetrieveSecretForUse(ctx context.Context, callerId, secretId uuid.UUID) (*RetrievedUserSecret, error) {
+	record, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessUse)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := decryptSecretRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	audit_log.Record(ctx, audit_log.Event{
+		ActorUserId:  &callerId,
+		Action:       audit_log.ActionUse,
+		ResourceType: audit_log.ResourceSecret,
+		ResourceId:   secretId.String(),
+	})
+	return secret, nil
+}
+
+// grantedSecretAccess returns the strongest active grant callerId holds on the secret.
+func (p *PgUserSecretStore) grantedSecretAccess(callerId, secretId uuid.UUID) (secretAccess, error) {
+	qry := infra_db_pg.New(p.db)
+	level, err := qry.GetActiveExternalAuthTokenGrantLevel(context.Background(), infra_db_pg.GetActiveExternalAuthTokenGrantLevelParams{
+		SecretID: secretId,
+		UserID:   callerId,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		slog.Error("Error checking secret grants", slog.String("secretId", secretId.String()), slog.String("error", err.Error()))
+		return 0, fmt.Errorf("error checking secret grants: %w", err)
+	}
+	return grantAccessLevel(level), nil
+}
+
+// sharedSecretEntries lists secrets other users shared with userId.
+func (p *PgUserSecretStore) sharedSecretEntries(userId uuid.UUID) ([]UserSecretEntry, error) {
+	entries := make([]UserSecretEntry, 0)
+	qry := infra_db_pg.New(p.db)
+	rows, err := qry.GetUserSecretsSharedWithUser(context.Background(), userId)
+	if err != nil {
+		slog.Error("Error retrieving shared secrets from database", slog.String("error", err.Error()))
+		return entries, err
+	}
+	for _, row := range rows {
+		var entry UserSecretEntry
+		entry.ParseSharedSecretFromDb(row)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// recordSecretGrantChange audits a secret grant change with the before and after state.
+func recordSecretGrantChange(ctx context.Context, action string, id uuid.UUID, before, after *SecretGrant) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceSecretGrant, ResourceId: id.String()}
+	// Assign only non-nil pointers so a missing side stays a nil interface.
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
+}
@@ -0,0 +1,107 @@
+package user_secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/google/uuid"
+)
+
+// orgTenancy owns every secret by org and knows only its members.
+type orgTenancy struct {
+	organizations.Tenancy
+	org     uuid.UUID
+	members map[uuid.UUID]bool
+}
+
+func (o *orgTenancy) ResourceOwners(ctx context.Context, resourceType string, resourceIds []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	owners := map[uuid.UUID]uuid.UUID{}
+	for _, id := range resourceIds {
+		owners[id] = o.org
+	}
+	return owners, nil
+}
+
+func (o *orgTenancy) IsMember(ctx context.Context, orgId uuid.UUID, userId uuid.UUID) (bool, error) {
+	return orgId == o.org && o.members[userId], nil
+}
+
+func (o *orgTenancy) IsRoleHeld(ctx context.Context, orgId uuid.UUID, roleId uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func TestSecretGrantAccessLevels(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	db := &fakeSecretDb{
+		tokens:    map[uuid.UUID]infra_db_pg.ExternalAuthToken{},
+		delegates: map[uuid.UUID]bool{},
+		grants:    map[uuid.UUID]map[uuid.UUID]string{},
+	}
+	store := NewPgUserSecretStore(db)
+
+	owner, reader, user := uuid.New(), uuid.New(), uuid.New()
+	secretId := newFakeSecret(t, db, owner, "sudo-password")
+	db.grants[secretId] = map[uuid.UUID]string{reader: SecretAccessRead, user: SecretAccessUse}
+
+	if got, err := store.RetrieveSecretForUser(context.Background(), reader, secretId); err != nil || string(got.ExternalAuthToken.Token) != "sudo-password" {
+		t.Fatalf("expected read grantee to read plaintext, got %v", err)
+	}
+	if _, err := store.RetrieveSecretForUser(context.Background(), user, secretId); !errors.Is(err, ErrSecretAccessDenied) {
+		t.Fatalf("expected use grantee to be denied plaintext, got %v", err)
+	}
+	if got, err := store.RetrieveSecretForUse(context.Background(), user, secretId); err != nil || string(got.ExternalAuthToken.Token) != "sudo-password" {
+		t.Fatalf("expected use grantee to decrypt for server-side use, got %v", err)
+	}
+	if err := store.DeleteSecretForUser(context.Background(), reader, secretId); !errors.Is(err, ErrSecretAccessDenied) {
+		t.Fatalf("expected grantee to be unable to delete, got %v", err)
+	}
+	if _, err := store.RetrieveSecretForUse(context.Background(), uuid.New(), secretId); !errors.Is(err, ErrSecretAccessDenied) {
+		t.Fatalf("expected user without a grant to be denied, got %v", err)
+	}
+}
+
+func TestNewSecretGrantValidation(t *testing.T) {
+	userId, roleId := uuid.New(), uuid.New()
+	cases := []NewSecretGrant{
+		{AccessLevel: SecretAccessRead},
+		{GranteeUserId: &userId, GranteeRoleId: &roleId, AccessLevel: SecretAccessRead},
+		{GranteeRoleId: &roleId, AccessLevel: "write"},
+	}
+	for _, grant := range cases {
+		if err := grant.validate(); !errors.Is(err, ErrInvalidSecretGrant) {
+			t.Errorf("expected %+v to be rejected, got %v", grant, err)
+		}
+	}
+	if err := (NewSecretGrant{GranteeRoleId: &roleId, AccessLevel: SecretAccessUse}).validate(); err != nil {
+		t.Fatalf("expected role use grant to be valid, got %v", err)
+	}
+}
+
+func TestGrantRejectsGranteesOutsideSecretOrg(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	db := &fakeSecretDb{
+		tokens:    map[uuid.UUID]infra_db_pg.ExternalAuthToken{},
+		delegates: map[uuid.UUID]bool{},
+		grants:    map[uuid.UUID]map[uuid.UUID]string{},
+	}
+	store := NewPgUserSecretStore(db)
+	owner, outsider, roleId := uuid.New(), uuid.New(), uuid.New()
+	secretId := newFakeSecret(t, db, owner, "sudo-password")
+
+	organizations.SetDefault(&orgTenancy{org: uuid.New(), members: map[uuid.UUID]bool{owner: true}})
+	t.Cleanup(func() { organizations.SetDefault(nil) })
+
+	grants := []NewSecretGrant{
+		{GranteeUserId: &outsider, AccessLevel: SecretAccessRead},
+		{GranteeRoleId: &roleId, AccessLevel: SecretAccessUse},
+	}
+	for _, grant := range grants {
+		_, err := store.GrantSecretAccess(context.Background(), owner, secretId, grant)
+		if !errors.Is(err, ErrSecretGranteeOutsideOrganization) || !errors.Is(err, ErrInvalidSecretGrant) {
+			t.Errorf("expected %+v to be rejected as outside the organization, got %v", grant, err)
+		}
+	}
+}
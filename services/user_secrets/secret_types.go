@@ -0,0 +1,267 @@
+package user_secrets
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	SecretTypeBasicAuth      = "basic_auth"
+	SecretTypeAwsCredentials = "aws_credentials"
+	SecretTypeDbDsn          = "db_dsn"
+	SecretTypeSshKey         = "ssh_key"
+	SecretTypeAcmeAccount    = "acme_account"
+)
+
+var (
+	ErrUnknownSecretType   = errors.New("unknown secret type")
+	ErrSecretNotTyped      = errors.New("secret is a single value secret without typed fields")
+	ErrSecretFieldNotFound = errors.New("secret field not found")
+)
+
+// SecretValidationError lists every field that failed validation.
+type SecretValidationError struct {
+	SecretType string
+	Fields     map[string]string
+}
+
+func (e *SecretValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msg := fmt.Sprintf("invalid %s secret:", e.SecretType)
+	for _, name := range names {
+		msg += fmt.Sprintf(" %s %s;", name, e.Fields[name])
+	}
+	return msg
+}
+
+// SecretField describes one field of a typed secret.
+//
+// swagger:model SecretField
+type SecretField struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	// Sensitive fields should be masked by clients when displayed.
+	Sensitive bool `json:"sensitive"`
+	// Validate checks a non-empty value.
+	Validate func(value string) error `json:"-"`
+}
+
+// SecretSchema is the set of fields a typed secret carries. All fields are encrypted together
+// as one payload so they are always rotated and versioned as a unit.
+//
+// swagger:model SecretSchema
+type SecretSchema struct {
+	Type   string        `json:"type"`
+	Fields []SecretField `json:"fields"`
+}
+
+// Validate checks fields against the schema, rejecting unknown fields.
+func (s SecretSchema) Validate(fields map[string]string) error {
+	invalid := make(map[string]string)
+	known := make(map[string]bool, len(s.Fields))
+	for _, field := range s.Fields {
+		known[field.Name] = true
+		value := fields[field.Name]
+		if value == "" {
+			if field.Required {
+				invalid[field.Name] = "is required"
+			}
+			continue
+		}
+		if field.Validate != nil {
+			if err := field.Validate(value); err != nil {
+				invalid[field.Name] = err.Error()
+			}
+		}
+	}
+	for name := range fields {
+		if !known[name] {
+			invalid[name] = "is not a field of this secret type"
+		}
+	}
+	if len(invalid) > 0 {
+		return &SecretValidationError{SecretType: s.Type, Fields: invalid}
+	}
+	return nil
+}
+
+var (
+	secretSchemasMu sync.RWMutex
+	secretSchemas   = map[string]SecretSchema{}
+)
+
+// RegisterSecretSchema adds or replaces a typed secret schema.
+func RegisterSecretSchema(schema SecretSchema) {
+	secretSchemasMu.Lock()
+	defer secretSchemasMu.Unlock()
+	secretSchemas[schema.Type] = schema
+}
+
+func LookupSecretSchema(secretType string) (SecretSchema, error) {
+	secretSchemasMu.RLock()
+	defer secretSchemasMu.RUnlock()
+	schema, ok := secretSchemas[secretType]
+	if !ok {
+		return SecretSchema{}, fmt.Errorf("%w: %q", ErrUnknownSecretType, secretType)
+	}
+	return schema, nil
+}
+
+// SecretSchemas returns the registered schemas ordered by type.
+func SecretSchemas() []SecretSchema {
+	secretSchemasMu.RLock()
+	defer secretSchemasMu.RUnlock()
+	schemas := make([]SecretSchema, 0, len(secretSchemas))
+	for _, schema := range secretSchemas {
+		schemas = append(schemas, schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Type < schemas[j].Type })
+	return schemas
+}
+
+// TypedSecret is the decrypted form of a typed secret.
+type TypedSecret struct {
+	Type   string            `json:"type"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Field returns a single field value.
+func (t *TypedSecret) Field(name string) (string, error) {
+	value, ok := t.Fields[name]
+	if !ok || value == "" {
+		return "", fmt.Errorf("%w: %q", ErrSecretFieldNotFound, name)
+	}
+	return value, nil
+}
+
+// encodeTypedSecret validates fields and returns the plaintext payload that is encrypted.
+func encodeTypedSecret(secretType string, fields map[string]string) (string, error) {
+	schema, err := LookupSecretSchema(secretType)
+	if err != nil {
+		return "", err
+	}
+	if err := schema.Validate(fields); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(TypedSecret{Type: secretType, Fields: fields})
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// decodeTypedSecret parses a decrypted payload. The type stored next to the ciphertext must
+// match the authenticated type inside it.
+func decodeTypedSecret(secretType string, plaintext []byte) (*TypedSecret, error) {
+	if secretType == "" {
+		return nil, ErrSecretNotTyped
+	}
+	var typed TypedSecret
+	if err := json.Unmarshal(plaintext, &typed); err != nil {
+		return nil, fmt.Errorf("error decoding typed secret: %w", err)
+	}
+	if typed.Type != secretType {
+		return nil, fmt.Errorf("typed secret payload is %q but stored as %q", typed.Type, secretType)
+	}
+	return &typed, nil
+}
+
+var (
+	awsAccessKeyPattern = regexp.MustCompile(`^[A-Z0-9]{16,128}$`)
+	awsRegionPattern    = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d$`)
+)
+
+func validateUrl(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("must be an absolute url")
+	}
+	return nil
+}
+
+func validateEmail(value string) error {
+	if _, err := mail.ParseAddress(value); err != nil {
+		return errors.New("must be an email address")
+	}
+	return nil
+}
+
+func validatePort(value string) error {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return errors.New("must be a port between 1 and 65535")
+	}
+	return nil
+}
+
+func validatePem(value string) error {
+	if block, _ := pem.Decode([]byte(value)); block == nil {
+		return errors.New("must be PEM encoded")
+	}
+	return nil
+}
+
+func validatePattern(pattern *regexp.Regexp, message string) func(string) error {
+	return func(value string) error {
+		if !pattern.MatchString(value) {
+			return errors.New(message)
+		}
+		return nil
+	}
+}
+
+func validateOneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if value == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v", values)
+	}
+}
+
+func init() {
+	RegisterSecretSchema(SecretSchema{Type: SecretTypeBasicAuth, Fields: []SecretField{
+		{Name: "username", Required: true},
+		{Name: "password", Required: true, Sensitive: true},
+		{Name: "url", Validate: validateUrl},
+	}})
+	RegisterSecretSchema(SecretSchema{Type: SecretTypeAwsCredentials, Fields: []SecretField{
+		{Name: "access_key_id", Required: true, Validate: validatePattern(awsAccessKeyPattern, "must be an AWS access key id")},
+		{Name: "secret_access_key", Required: true, Sensitive: true},
+		{Name: "session_token", Sensitive: true},
+		{Name: "region", Validate: validatePattern(awsRegionPattern, "must be an AWS region such as us-east-1")},
+	}})
+	RegisterSecretSchema(SecretSchema{Type: SecretTypeDbDsn, Fields: []SecretField{
+		{Name: "host", Required: true},
+		{Name: "port", Validate: validatePort},
+		{Name: "username", Required: true},
+		{Name: "password", Required: true, Sensitive: true},
+		{Name: "database", Required: true},
+		{Name: "sslmode", Validate: validateOneOf("disable", "allow", "prefer", "require", "verify-ca", "verify-full")},
+	}})
+	RegisterSecretSchema(SecretSchema{Type: SecretTypeSshKey, Fields: []SecretField{
+		{Name: "private_key", Required: true, Sensitive: true, Validate: validatePem},
+		{Name: "public_key"},
+		{Name: "passphrase", Sensitive: true},
+	}})
+	RegisterSecretSchema(SecretSchema{Type: SecretTypeAcmeAccount, Fields: []SecretField{
+		{Name: "email", Required: true, Validate: validateEmail},
+		{Name: "dns_api_token", Required: true, Sensitive: true},
+		{Name: "acme_url", Validate: validateUrl},
+		{Name: "account_key", Sensitive: true, Validate: validatePem},
+	}})
+}
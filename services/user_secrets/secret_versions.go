@@ -0,0 +1,295 @@
+package user_secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrSecretVersionNotFound       = errors.New("secret version not found")
+	ErrSecretVersionDestroyed      = errors.New("secret version has been destroyed")
+	ErrCannotDestroyCurrentVersion = errors.New("the current secret version cannot be destroyed, roll back or add a new version first")
+)
+
+// SecretVersionMetadata describes one immutable version of a secret. The secret id is
+// stable across versions, so existing references always resolve to the current version.
+//
+// swagger:model SecretVersionMetadata
+type SecretVersionMetadata struct {
+	SecretId    uuid.UUID  `json:"secretId"`
+	Version     int32      `json:"version"`
+	Current     bool       `json:"current"`
+	Expiration  time.Time  `json:"expiry"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CreatedBy   uuid.UUID  `json:"createdBy,omitempty"`
+	DestroyedAt *time.Time `json:"destroyedAt,omitempty"`
+}
+
+func (m *SecretVersionMetadata) ParseSecretVersionFromDb(v infra_db_pg.ExternalAuthTokenVersion) {
+	m.SecretId = v.SecretID
+	m.Version = v.Version
+	m.Current = v.IsCurrent
+	m.Expiration = v.Expiration.Time
+	m.CreatedAt = v.CreatedAt.Time
+	if v.CreatedBy.Valid {
+		m.CreatedBy = v.CreatedBy.Bytes
+	}
+	if v.DestroyedAt.Valid {
+		destroyedAt := v.DestroyedAt.Time
+		m.DestroyedAt = &destroyedAt
+	}
+}
+
+// AddSecretVersion stores a new value under an existing secret id and makes it current.
+func (p *PgUserSecretStore) AddSecretVersion(ctx context.Context, callerId, secretId uuid.UUID, plaintextSecret string, expiry time.Time) (SecretVersionMetadata, error) {
+	var metadata SecretVersionMetadata
+	record, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessManage)
+	if err != nil {
+		return metadata, err
+	}
+
+	// Typed secrets keep their type; the new value must be a JSON object of its fields.
+	var current PgEncrytpedSecret
+	if err := json.Unmarshal(record.Token, &current); err != nil {
+		return metadata, err
+	}
+	if current.SecretType != "" {
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(plaintextSecret), &fields); err != nil {
+			return metadata, &SecretValidationError{SecretType: current.SecretType, Fields: map[string]string{"secret": "must be a JSON object of the secret's fields"}}
+		}
+		if plaintextSecret, err = encodeTypedSecret(current.SecretType, fields); err != nil {
+			return metadata, err
+		}
+	}
+
+	binding := SecretBinding{UserId: record.UserID, ApplicationId: record.ExternalAppID, SecretId: record.ID}
+	userCipherText, err := EncryptBound(plaintextSecret, binding)
+	if err != nil {
+		return metadata, err
+	}
+	token, err := json.Marshal(PgEncrytpedSecret{UserId: record.UserID, ApplicationId: record.ExternalAppID, UserSecret: &userCipherText, SecretType: current.SecretType})
+	if err != nil {
+		return metadata, err
+	}
+	if expiry.IsZero() {
+		expiry = time.Now().AddDate(0, 0, 31)
+	}
+	expiration := pgtype.Timestamptz{Time: expiry, Valid: true}
+
+	err = p.withTx(func(qry *infra_db_pg.Queries) error {
+		if _, err := qry.LockExternalAuthToken(ctx, secretId); err != nil {
+			return err
+		}
+		next, err := qry.GetNextExternalAuthTokenVersion(ctx, secretId)
+		if err != nil {
+			return err
+		}
+		if err := qry.ClearCurrentExternalAuthTokenVersion(ctx, secretId); err != nil {
+			return err
+		}
+		version, err := qry.InsertExternalAuthTokenVersion(ctx, infra_db_pg.InsertExternalAuthTokenVersionParams{
+			SecretID:   secretId,
+			Version:    next,
+			Token:      token,
+			Expiration: expiration,
+			CreatedBy:  pgtype.UUID{Bytes: callerId, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		metadata.ParseSecretVersionFromDb(version)
+		return qry.UpdateExternalAuthTokenCurrentValue(ctx, infra_db_pg.UpdateExternalAuthTokenCurrentValueParams{
+			ID:         secretId,
+			Token:      token,
+			Expiration: expiration,
+		})
+	})
+	if err != nil {
+		slog.Error("Error adding secret version", slog.String("secretId", secretId.String()), slog.String("error", err.Error()))
+		return metadata, fmt.Errorf("error adding secret version: %w", err)
+	}
+	after := newSecretAuditState(record)
+	after.Expiration = expiration.Time
+	after.Secret = token
+	recordSecretChange(ctx, audit_log.ActionUpdate, secretId, newSecretAuditState(record), after)
+	return metadata, nil
+}
+
+// RetrieveSecretVersion decrypts a specific version of a secret.
+func (p *PgUserSecretStore) RetrieveSecretVersion(ctx context.Context, callerId, secretId uuid.UUID, version int32) (*RetrievedUserSecret, error) {
+	record, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessRead)
+	if err != nil {
+		return nil, err
+	}
+
+	qry := infra_db_pg.New(p.db)
+	versionRecord, err := qry.GetExternalAuthTokenVersion(ctx, infra_db_pg.GetExternalAuthTokenVersionParams{SecretID: secretId, Version: version})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSecretVersionNotFound
+		}
+		return nil, err
+	}
+	if versionRecord.DestroyedAt.Valid || versionRecord.Token == nil {
+		return nil, ErrSecretVersionDestroyed
+	}
+
+	record.Token = versionRecord.Token
+	record.Expiration = versionRecord.Expiration
+	retrieved, err := decryptSecretRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	retrieved.Version = versionRecord.Version
+	return retrieved, nil
+}
+
+// ListSecretVersions returns the version history of a secret, newest first.
+func (p *PgUserSecretStore) ListSecretVersions(ctx context.Context, callerId, secretId uuid.UUID) ([]SecretVersionMetadata, error) {
+	versions := make([]SecretVersionMetadata, 0)
+	if _, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessRead); err != nil {
+		return versions, err
+	}
+
+	qry := infra_db_pg.New(p.db)
+	records, err := qry.GetExternalAuthTokenVersions(ctx, secretId)
+	if err != nil {
+		slog.Error("Error retrieving secret versions", slog.String("secretId", secretId.String()), slog.String("error", err.Error()))
+		return versions, err
+	}
+	for _, record := range records {
+		var metadata SecretVersionMetadata
+		metadata.ParseSecretVersionFromDb(record)
+		versions = append(versions, metadata)
+	}
+	return versions, nil
+}
+
+// RollbackSecret makes an earlier, non-destroyed version current again.
+func (p *PgUserSecretStore) RollbackSecret(ctx context.Context, callerId, secretId uuid.UUID, version int32) (SecretVersionMetadata, error) {
+	var metadata SecretVersionMetadata
+	record, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessManage)
+	if err != nil {
+		return metadata, err
+	}
+
+	after := newSecretAuditState(record)
+	err = p.withTx(func(qry *infra_db_pg.Queries) error {
+		if _, err := qry.LockExternalAuthToken(ctx, secretId); err != nil {
+			return err
+		}
+		if err := qry.ClearCurrentExternalAuthTokenVersion(ctx, secretId); err != nil {
+			return err
+		}
+		current, err := qry.SetCurrentExternalAuthTokenVersion(ctx, infra_db_pg.SetCurrentExternalAuthTokenVersionParams{SecretID: secretId, Version: version})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrSecretVersionNotFound
+			}
+			return err
+		}
+		if secretExpired(current.Expiration) {
+			return ErrSecretExpired
+		}
+		metadata.ParseSecretVersionFromDb(current)
+		after.Expiration = current.Expiration.Time
+		after.Secret = current.Token
+		return qry.UpdateExternalAuthTokenCurrentValue(ctx, infra_db_pg.UpdateExternalAuthTokenCurrentValueParams{
+			ID:         secretId,
+			Token:      current.Token,
+			Expiration: current.Expiration,
+		})
+	})
+	if err != nil {
+		slog.Error("Error rolling back secret", slog.String("secretId", secretId.String()), slog.Int("version", int(version)), slog.String("error", err.Error()))
+		return metadata, err
+	}
+	recordSecretChange(ctx, audit_log.ActionUpdate, secretId, newSecretAuditState(record), after)
+	return metadata, nil
+}
+
+// DestroySecretVersion permanently removes the ciphertext of a non-current version while
+// keeping its metadata in the history.
+func (p *PgUserSecretStore) DestroySecretVersion(ctx context.Context, callerId, secretId uuid.UUID, version int32) error {
+	if _, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessManage); err != nil {
+		return err
+	}
+
+	qry := infra_db_pg.New(p.db)
+	var before *SecretVersionMetadata
+	if current, err := qry.GetExternalAuthTokenVersion(ctx, infra_db_pg.GetExternalAuthTokenVersionParams{SecretID: secretId, Version: version}); err == nil {
+		before = &SecretVersionMetadata{}
+		before.ParseSecretVersionFromDb(current)
+	}
+	destroyed, err := qry.DestroyExternalAuthTokenVersion(ctx, infra_db_pg.DestroyExternalAuthTokenVersionParams{SecretID: secretId, Version: version})
+	if err != nil {
+		slog.Error("Error destroying secret version", slog.String("secretId", secretId.String()), slog.String("error", err.Error()))
+		return err
+	}
+	if destroyed > 0 {
+		event := audit_log.Event{
+			Action:       audit_log.ActionDelete,
+			ResourceType: audit_log.ResourceSecretVersion,
+			ResourceId:   secretId.String(),
+		}
+		// The version stays in the history, the diff shows it being destroyed.
+		if before != nil {
+			after := *before
+			destroyedAt := time.Now()
+			after.DestroyedAt = &destroyedAt
+			event.Before = before
+			event.After = &after
+		}
+		audit_log.Record(ctx, event)
+		return nil
+	}
+
+	existing, err := qry.GetExternalAuthTokenVersion(ctx, infra_db_pg.GetExternalAuthTokenVersionParams{SecretID: secretId, Version: version})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrSecretVersionNotFound
+	case err != nil:
+		return err
+	case existing.IsCurrent:
+		return ErrCannotDestroyCurrentVersion
+	default:
+		return ErrSecretVersionDestroyed
+	}
+}
+
+type txBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// withTx runs fn in a transaction when the store's connection can start one. A store built
+// on an existing pgx.Tx uses a savepoint.
+func (p *PgUserSecretStore) withTx(fn func(qry *infra_db_pg.Queries) error) error {
+	ctx := context.Background()
+	qry := infra_db_pg.New(p.db)
+	beginner, ok := p.db.(txBeginner)
+	if !ok {
+		return fn(qry)
+	}
+
+	tx, err := beginner.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(qry.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,28 @@
+package user_secrets
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteSecretVersionError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{ErrSecretVersionNotFound, http.StatusNotFound},
+		{fmt.Errorf("error adding secret version: %w", ErrSecretVersionDestroyed), http.StatusGone},
+		{ErrCannotDestroyCurrentVersion, http.StatusConflict},
+		{ErrSecretAccessDenied, http.StatusNotFound},
+		{fmt.Errorf("connection reset"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		writeSecretVersionError(rec, tc.err)
+		if rec.Code != tc.want {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.want, rec.Code)
+		}
+	}
+}
@@ -4,24 +4,61 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const (
+	// ReadSecretPlaintextPermission is required to retrieve decrypted secret values.
+	ReadSecretPlaintextPermission = "ReadSecretPlaintext"
+	// ReadSecretMetadataPermission is required to list secret metadata.
+	ReadSecretMetadataPermission = "ReadSecretMetadata"
+	// ManageSecretsPermission is required to create, change, share and delete secrets.
+	ManageSecretsPermission = "ManageSecrets"
+	// DelegatedSecretAccessPermission allows a caller to act on secrets owned by other users.
+	DelegatedSecretAccessPermission = "AccessAllUserSecrets"
+)
+
+var (
+	ErrSecretNotFound     = errors.New("secret not found")
+	ErrSecretAccessDenied = errors.New("caller is not permitted to access this secret")
+	// ErrApplicationNotFound is returned when a secret is stored for an external application
+	// the active organization cannot see.
+	ErrApplicationNotFound = errors.New("external application not found")
+)
+
 type RetrievedUserSecret struct {
 	Reader            io.Reader
 	ExternalAuthToken *ExternalApplicationAuthToken
+	// Version is set when a specific version was requested.
+	Version int32
+	// SecretType is empty for single value secrets.
+	SecretType string
 }
 
 // swagger:model UserSecretEntry
 type UserSecretEntry struct {
 	AppInfo        ExternalApplicationInfo   `json:"appInfo"`
 	SecretMetadata ExternalAppSecretMetadata `json:"secretMetadata"`
+	// SharedAccess is set for secrets owned by another user and shared through a grant.
+	SharedAccess *SharedSecretAccess `json:"sharedAccess,omitempty"`
+}
+
+// swagger:model SharedSecretAccess
+type SharedSecretAccess struct {
+	AccessLevel string     `json:"accessLevel"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
 }
 
 // swagger:model ExternalApplicationInfo
@@ -40,16 +77,32 @@ type ExternalAppSecretMetadata struct {
 }
 
 type UserSecretProvider interface {
-	StoreSecret(plaintextSecret string, userId, appId uuid.UUID, expiry time.Time) (uuid.UUID, error)
+	StoreSecret(ctx context.Context, plaintextSecret string, userId, appId uuid.UUID, expiry time.Time) (uuid.UUID, error)
 	RetrieveSecret(secretId uuid.UUID) (*RetrievedUserSecret, error)
-	GetUserSecretEntries(userId uuid.UUID) ([]UserSecretEntry, error)
-	GetUserSecretEntriesByAppId(userId uuid.UUID, appId uuid.UUID) ([]UserSecretEntry, error)
-	GetUserSecretEntriesByAppName(userId uuid.UUID, appName string) ([]UserSecretEntry, error)
+	GetUserSecretEntries(ctx context.Context, userId uuid.UUID) ([]UserSecretEntry, error)
+	GetUserSecretEntriesByAppId(ctx context.Context, userId uuid.UUID, appId uuid.UUID) ([]UserSecretEntry, error)
+	GetUserSecretEntriesByAppName(ctx context.Context, userId uuid.UUID, appName string) ([]UserSecretEntry, error)
 	DeleteSecret(secretId uuid.UUID) error
+	RetrieveSecretForUser(ctx context.Context, callerId, secretId uuid.UUID) (*RetrievedUserSecret, error)
+	DeleteSecretForUser(ctx context.Context, callerId, secretId uuid.UUID) error
+	CanAccessUserSecrets(callerId, ownerId uuid.UUID) (bool, error)
+	AddSecretVersion(ctx context.Context, callerId, secretId uuid.UUID, plaintextSecret string, expiry time.Time) (SecretVersionMetadata, error)
+	RetrieveSecretVersion(ctx context.Context, callerId, secretId uuid.UUID, version int32) (*RetrievedUserSecret, error)
+	ListSecretVersions(ctx context.Context, callerId, secretId uuid.UUID) ([]SecretVersionMetadata, error)
+	RollbackSecret(ctx context.Context, callerId, secretId uuid.UUID, version int32) (SecretVersionMetadata, error)
+	DestroySecretVersion(ctx context.Context, callerId, secretId uuid.UUID, version int32) error
+	GetExpiringSecretEntries(ctx context.Context, userId uuid.UUID, within time.Duration) ([]ExpiringSecretEntry, error)
+	GrantSecretAccess(ctx context.Context, callerId, secretId uuid.UUID, grant NewSecretGrant) (SecretGrant, error)
+	ListSecretGrants(ctx context.Context, callerId, secretId uuid.UUID) ([]SecretGrant, error)
+	RevokeSecretGrant(ctx context.Context, callerId, secretId, grantId uuid.UUID) error
+	RetrieveSecretForUse(ctx context.Context, callerId, secretId uuid.UUID) (*RetrievedUserSecret, error)
+	StoreTypedSecret(ctx context.Context, secretType string, fields map[string]string, userId, appId uuid.UUID, expiry time.Time) (uuid.UUID, error)
+	RetrieveTypedSecretForUser(ctx context.Context, callerId, secretId uuid.UUID) (*TypedSecret, error)
+	RetrieveSecretFieldForUser(ctx context.Context, callerId, secretId uuid.UUID, field string) (string, error)
 }
 
-// Implementing UserSecretProvider for scenarios where the user supplied secret has only one value that needs to be encrypted
-// such as JWT a single bearer token such as a cloudflare token
+// Implementing UserSecretProvider for single value secrets such as a cloudflare bearer token, and for
+// typed secrets (see SecretSchema) whose fields are encrypted together as one value.
 type PgUserSecretStore struct {
 	db infra_db_pg.DBTX
 }
@@ -62,10 +115,55 @@ type PgEncrytpedSecret struct {
 	UserId        uuid.UUID                      `json:"userId"`
 	ApplicationId uuid.UUID                      `json:"applicationId"`
 	UserSecret    *EncryptedUserSecretsAES256GCM `json:"userSecret"`
+	// SecretType is set for typed secrets; the encrypted payload repeats it.
+	SecretType string `json:"secretType,omitempty"`
+}
+
+func (p *PgUserSecretStore) StoreSecret(ctx context.Context, plaintextSecret string, userId, appId uuid.UUID, expiry time.Time) (uuid.UUID, error) {
+	return p.storeSecret(ctx, plaintextSecret, "", userId, appId, defaultExpiration(expiry))
+}
+
+// StoreSecretWithoutExpiry stores a secret whose expiration is NULL, so it is never refused
+// or purged as expired. It is meant for key material such as SSH keys.
+func (p *PgUserSecretStore) StoreSecretWithoutExpiry(ctx context.Context, plaintextSecret string, userId, appId uuid.UUID) (uuid.UUID, error) {
+	return p.storeSecret(ctx, plaintextSecret, "", userId, appId, pgtype.Timestamptz{})
+}
+
+// StoreTypedSecret validates fields against the schema for secretType and stores them
+// encrypted as a single unit.
+func (p *PgUserSecretStore) StoreTypedSecret(ctx context.Context, secretType string, fields map[string]string, userId, appId uuid.UUID, expiry time.Time) (uuid.UUID, error) {
+	payload, err := encodeTypedSecret(secretType, fields)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return p.storeSecret(ctx, payload, secretType, userId, appId, defaultExpiration(expiry))
 }
 
-func (p *PgUserSecretStore) StoreSecret(plaintextSecret string, userId, appId uuid.UUID, expiry time.Time) (uuid.UUID, error) {
-	userCipherText, err := Encrypt(plaintextSecret)
+// defaultExpiration expires secrets stored without an expiration after 31 days.
+func defaultExpiration(expiry time.Time) pgtype.Timestamptz {
+	if expiry.IsZero() {
+		today := time.Now()
+		expiry = today.AddDate(0, 0, 31)
+	}
+	return pgtype.Timestamptz{Time: expiry, Valid: true}
+}
+
+func (p *PgUserSecretStore) storeSecret(ctx context.Context, plaintextSecret string, secretType string, userId, appId uuid.UUID, expiration pgtype.Timestamptz) (uuid.UUID, error) {
+	if err := organizations.RequireActiveOrg(ctx); err != nil {
+		return uuid.Nil, err
+	}
+	allowed, err := organizations.AllowsResource(ctx, organizations.ResourceExternalApp, appId)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !allowed {
+		return uuid.Nil, ErrApplicationNotFound
+	}
+
+	// The id is generated up front so the ciphertext can be bound to it.
+	secretId := uuid.New()
+	binding := SecretBinding{UserId: userId, ApplicationId: appId, SecretId: secretId}
+	userCipherText, err := EncryptBound(plaintextSecret, binding)
 	if err != nil {
 		slog.Error("Error encrypting user secret", slog.String("Error", err.Error()))
 		return uuid.Nil, err
@@ -75,6 +173,7 @@ func (p *PgUserSecretStore) StoreSecret(plaintextSecret string, userId, appId uu
 		UserId:        userId,
 		ApplicationId: appId,
 		UserSecret:    &userCipherText,
+		SecretType:    secretType,
 	}
 
 	jsonData, err := json.Marshal(userSecret)
@@ -83,25 +182,41 @@ func (p *PgUserSecretStore) StoreSecret(plaintextSecret string, userId, appId uu
 		return uuid.Nil, err
 	}
 
-	if expiry.IsZero() {
-		today := time.Now()
-		expiry = today.AddDate(0, 0, 31)
-	}
-
 	qry := infra_db_pg.New(p.db)
 	params := infra_db_pg.InsertExternalAuthTokenParams{
+		ID:            secretId,
 		UserID:        userId,
 		ExternalAppID: appId,
 		Token:         jsonData,
-		Expiration:    pgtype.Timestamptz{Time: expiry, Valid: true},
+		Expiration:    expiration,
 	}
-	secretId, err := qry.InsertExternalAuthToken(context.Background(), params)
+	insertedId, err := qry.InsertExternalAuthToken(ctx, params)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	return secretId, nil
+
+	// The secret is removed again when it cannot be assigned so it does not linger without an
+	// owner.
+	if err := organizations.AssignToActiveOrg(ctx, organizations.ResourceSecret, insertedId); err != nil {
+		slog.Error("Error assigning secret to organization", slog.String("secretId", insertedId.String()), slog.String("error", err.Error()))
+		if delErr := p.DeleteSecret(insertedId); delErr != nil {
+			slog.Error("Error removing unassigned secret", slog.String("secretId", insertedId.String()), slog.String("error", delErr.Error()))
+		}
+		return uuid.Nil, err
+	}
+	recordSecretChange(ctx, audit_log.ActionCreate, insertedId, nil, &secretAuditState{
+		Id:            insertedId,
+		UserId:        userId,
+		ApplicationId: appId,
+		SecretType:    secretType,
+		Expiration:    expiration.Time,
+		Secret:        jsonData,
+	})
+	return insertedId, nil
 }
 
+// RetrieveSecret decrypts a secret without any ownership check. It is intended for
+// server-side features acting on behalf of the owner; API handlers must use RetrieveSecretForUser.
 func (p *PgUserSecretStore) RetrieveSecret(secretId uuid.UUID) (*RetrievedUserSecret, error) {
 	qry := infra_db_pg.New(p.db)
 	record, err := qry.GetExternalAuthTokenById(context.Background(), secretId)
@@ -110,14 +225,132 @@ func (p *PgUserSecretStore) RetrieveSecret(secretId uuid.UUID) (*RetrievedUserSe
 		return nil, err
 	}
 
+	return decryptSecretRecord(record)
+}
+
+// RetrieveSecretForUser decrypts a secret only if the caller owns it, holds delegated access
+// or holds a read grant.
+func (p *PgUserSecretStore) RetrieveSecretForUser(ctx context.Context, callerId, secretId uuid.UUID) (*RetrievedUserSecret, error) {
+	record, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessRead)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptSecretRecord(record)
+}
+
+// RetrieveTypedSecretForUser decrypts a typed secret the caller may access.
+func (p *PgUserSecretStore) RetrieveTypedSecretForUser(ctx context.Context, callerId, secretId uuid.UUID) (*TypedSecret, error) {
+	secret, err := p.RetrieveSecretForUser(ctx, callerId, secretId)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTypedSecret(secret.SecretType, secret.ExternalAuthToken.Token)
+}
+
+// RetrieveSecretFieldForUser returns a single field of a typed secret.
+func (p *PgUserSecretStore) RetrieveSecretFieldForUser(ctx context.Context, callerId, secretId uuid.UUID, field string) (string, error) {
+	typed, err := p.RetrieveTypedSecretForUser(ctx, callerId, secretId)
+	if err != nil {
+		return "", err
+	}
+	return typed.Field(field)
+}
+
+// DeleteSecretForUser deletes a secret only if the caller owns it or holds delegated access.
+func (p *PgUserSecretStore) DeleteSecretForUser(ctx context.Context, callerId, secretId uuid.UUID) error {
+	record, err := p.getAuthorizedSecretRecord(ctx, callerId, secretId, secretAccessManage)
+	if err != nil {
+		return err
+	}
+
+	if err := p.DeleteSecret(secretId); err != nil {
+		return err
+	}
+	recordSecretChange(ctx, audit_log.ActionDelete, secretId, newSecretAuditState(record), nil)
+	return nil
+}
+
+// CanAccessUserSecrets reports whether the caller may act on secrets owned by ownerId.
+func (p *PgUserSecretStore) CanAccessUserSecrets(callerId, ownerId uuid.UUID) (bool, error) {
+	if callerId == uuid.Nil {
+		return false, nil
+	}
+	if callerId == ownerId {
+		return true, nil
+	}
+
+	qry := infra_db_pg.New(p.db)
+	params := infra_db_pg.VerifyUserPermissionByIdParams{
+		UserId:     pgtype.UUID{Bytes: callerId, Valid: true},
+		Permission: pgtype.Text{String: DelegatedSecretAccessPermission, Valid: true},
+	}
+	delegated, err := qry.VerifyUserPermissionById(context.Background(), params)
+	if err != nil {
+		slog.Error("Error verifying delegated secret access", slog.String("callerId", callerId.String()), slog.String("error", err.Error()))
+		return false, fmt.Errorf("error verifying delegated secret access: %w", err)
+	}
+
+	return delegated, nil
+}
+
+// getAuthorizedSecretRecord loads a secret of the active organization in ctx if the caller owns
+// it, holds delegated access, or holds an active grant of at least the required access. Grants
+// never allow managing a secret.
+func (p *PgUserSecretStore) getAuthorizedSecretRecord(ctx context.Context, callerId, secretId uuid.UUID, required secretAccess) (infra_db_pg.ExternalAuthToken, error) {
+	// Secrets of other organizations are reported as missing so their existence is not disclosed.
+	inOrg, err := organizations.AllowsResource(ctx, organizations.ResourceSecret, secretId)
+	if err != nil {
+		return infra_db_pg.ExternalAuthToken{}, err
+	}
+	if !inOrg {
+		return infra_db_pg.ExternalAuthToken{}, ErrSecretNotFound
+	}
+
+	qry := infra_db_pg.New(p.db)
+	record, err := qry.GetExternalAuthTokenById(ctx, secretId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return record, ErrSecretNotFound
+		}
+		slog.Error("Error retrieving user secret from database", slog.String("error", err.Error()))
+		return record, err
+	}
+
+	allowed, err := p.CanAccessUserSecrets(callerId, record.UserID)
+	if err != nil {
+		return record, err
+	}
+	if !allowed && required != secretAccessManage && callerId != uuid.Nil {
+		granted, err := p.grantedSecretAccess(callerId, secretId)
+		if err != nil {
+			return infra_db_pg.ExternalAuthToken{}, err
+		}
+		allowed = granted >= required
+	}
+	if !allowed {
+		slog.Warn("Denied access to user secret", slog.String("callerId", callerId.String()), slog.String("secretId", secretId.String()))
+		return infra_db_pg.ExternalAuthToken{}, ErrSecretAccessDenied
+	}
+
+	return record, nil
+}
+
+func decryptSecretRecord(record infra_db_pg.ExternalAuthToken) (*RetrievedUserSecret, error) {
+	if secretExpired(record.Expiration) {
+		slog.Warn("Refusing to return expired secret", slog.String("secretId", record.ID.String()))
+		return nil, ErrSecretExpired
+	}
+
 	var stored PgEncrytpedSecret
-	err = json.Unmarshal(record.Token, &stored)
+	err := json.Unmarshal(record.Token, &stored)
 	if err != nil {
 		slog.Error("Failed to unmarshal encrypted secret", slog.String("error", err.Error()))
 		return nil, err
 	}
 
-	plaintext, err := stored.UserSecret.Decrypt()
+	binding := SecretBinding{UserId: record.UserID, ApplicationId: record.ExternalAppID, SecretId: record.ID}
+	plaintext, err := stored.UserSecret.DecryptBound(binding)
 	if err != nil {
 		slog.Error("Failed to decrypt secret", slog.String("error", err.Error()))
 		return nil, err
@@ -134,6 +367,7 @@ func (p *PgUserSecretStore) RetrieveSecret(secretId uuid.UUID) (*RetrievedUserSe
 	return &RetrievedUserSecret{
 		Reader:            bytes.NewReader(plaintext),
 		ExternalAuthToken: &daoExtSecret,
+		SecretType:        stored.SecretType,
 	}, nil
 }
 
@@ -143,10 +377,10 @@ func (p *PgUserSecretStore) DeleteSecret(secretId uuid.UUID) error {
 	return result
 }
 
-func (p *PgUserSecretStore) GetUserSecretEntries(userId uuid.UUID) ([]UserSecretEntry, error) {
+func (p *PgUserSecretStore) GetUserSecretEntries(ctx context.Context, userId uuid.UUID) ([]UserSecretEntry, error) {
 	userSecrets := make([]UserSecretEntry, 0)
 	qry := infra_db_pg.New(p.db)
-	tokens, err := qry.GetUserSecretsByUserId(context.Background(), userId)
+	tokens, err := qry.GetUserSecretsByUserId(ctx, userId)
 	if err != nil {
 		slog.Error("Error retrieving token metadata from database", slog.String("error", err.Error()))
 		return userSecrets, err
@@ -157,14 +391,18 @@ func (p *PgUserSecretStore) GetUserSecretEntries(userId uuid.UUID) ([]UserSecret
 		userSecrets = append(userSecrets, entry)
 	}
 
-	return userSecrets, nil
+	shared, err := p.sharedSecretEntries(userId)
+	if err != nil {
+		return userSecrets, err
+	}
+	return filterSecretEntries(ctx, append(userSecrets, shared...))
 }
 
-func (p *PgUserSecretStore) GetUserSecretEntriesByAppId(userId uuid.UUID, appId uuid.UUID) ([]UserSecretEntry, error) {
+func (p *PgUserSecretStore) GetUserSecretEntriesByAppId(ctx context.Context, userId uuid.UUID, appId uuid.UUID) ([]UserSecretEntry, error) {
 	userSecrets := make([]UserSecretEntry, 0)
 	qry := infra_db_pg.New(p.db)
 	params := &infra_db_pg.GetUserSecretsByAppIdParams{UserID: userId, ApplicationID: appId}
-	tokens, err := qry.GetUserSecretsByAppId(context.Background(), *params)
+	tokens, err := qry.GetUserSecretsByAppId(ctx, *params)
 	if err != nil {
 		slog.Error("Error retrieving token metadata from database", slog.String("error", err.Error()))
 		return userSecrets, err
@@ -175,14 +413,23 @@ func (p *PgUserSecretStore) GetUserSecretEntriesByAppId(userId uuid.UUID, appId
 		userSecrets = append(userSecrets, entry)
 	}
 
-	return userSecrets, nil
+	shared, err := p.sharedSecretEntries(userId)
+	if err != nil {
+		return userSecrets, err
+	}
+	for _, entry := range shared {
+		if entry.AppInfo.Id == appId {
+			userSecrets = append(userSecrets, entry)
+		}
+	}
+	return filterSecretEntries(ctx, userSecrets)
 }
 
-func (p *PgUserSecretStore) GetUserSecretEntriesByAppName(userId uuid.UUID, appName string) ([]UserSecretEntry, error) {
+func (p *PgUserSecretStore) GetUserSecretEntriesByAppName(ctx context.Context, userId uuid.UUID, appName string) ([]UserSecretEntry, error) {
 	userSecrets := make([]UserSecretEntry, 0)
 	qry := infra_db_pg.New(p.db)
 	params := &infra_db_pg.GetUserSecretsByAppNameParams{UserID: userId, ApplicationName: appName}
-	tokens, err := qry.GetUserSecretsByAppName(context.Background(), *params)
+	tokens, err := qry.GetUserSecretsByAppName(ctx, *params)
 	if err != nil {
 		slog.Error("Error retrieving token metadata from database", slog.String("error", err.Error()))
 		return userSecrets, err
@@ -193,5 +440,68 @@ func (p *PgUserSecretStore) GetUserSecretEntriesByAppName(userId uuid.UUID, appN
 		userSecrets = append(userSecrets, entry)
 	}
 
-	return userSecrets, nil
+	shared, err := p.sharedSecretEntries(userId)
+	if err != nil {
+		return userSecrets, err
+	}
+	for _, entry := range shared {
+		if entry.AppInfo.Name == appName {
+			userSecrets = append(userSecrets, entry)
+		}
+	}
+	return filterSecretEntries(ctx, userSecrets)
+}
+
+// filterSecretEntries keeps the entries owned by the active organization in ctx.
+func filterSecretEntries(ctx context.Context, entries []UserSecretEntry) ([]UserSecretEntry, error) {
+	ids := make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.SecretMetadata.Id)
+	}
+	allowed, err := organizations.FilterIds(ctx, organizations.ResourceSecret, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(entries, func(entry UserSecretEntry) bool {
+		return !slices.Contains(allowed, entry.SecretMetadata.Id)
+	}), nil
+}
+
+// secretAuditState is the state of a secret recorded in the audit log. The encrypted value
+// is kept under a sensitive key, so a new value shows up as a redacted change.
+type secretAuditState struct {
+	Id            uuid.UUID `json:"id"`
+	UserId        uuid.UUID `json:"userId"`
+	ApplicationId uuid.UUID `json:"applicationId"`
+	SecretType    string    `json:"type,omitempty"`
+	Expiration    time.Time `json:"expiry"`
+	Secret        []byte    `json:"secret"`
+}
+
+func newSecretAuditState(record infra_db_pg.ExternalAuthToken) *secretAuditState {
+	state := &secretAuditState{
+		Id:            record.ID,
+		UserId:        record.UserID,
+		ApplicationId: record.ExternalAppID,
+		Expiration:    record.Expiration.Time,
+		Secret:        record.Token,
+	}
+	var stored PgEncrytpedSecret
+	if err := json.Unmarshal(record.Token, &stored); err == nil {
+		state.SecretType = stored.SecretType
+	}
+	return state
+}
+
+// recordSecretChange audits a secret change with the before and after state.
+func recordSecretChange(ctx context.Context, action string, id uuid.UUID, before, after *secretAuditState) {
+	event := audit_log.Event{Action: action, ResourceType: audit_log.ResourceSecret, ResourceId: id.String()}
+	// Assign only non-nil pointers so a missing side stays a nil interface.
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	audit_log.Record(ctx, event)
 }
@@ -2,10 +2,15 @@ package user_secrets
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
 	"github.com/google/uuid"
 )
 
@@ -16,6 +21,7 @@ import (
 //	200: CreateSecretResponse
 //	400: description:Invalid request
 //	401: description:Unauthorized
+//	403: description:Forbidden
 func CreateSecretHandler(provider UserSecretProvider) http.Handler {
 	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req CreateSecretRequest
@@ -30,9 +36,9 @@ func CreateSecretHandler(provider UserSecretProvider) http.Handler {
 			return
 		}
 
-		secretId, err := provider.StoreSecret(req.Secret, userID, req.ApplicationID, req.Expiration)
+		secretId, err := provider.StoreSecret(r.Context(), req.Secret, userID, req.ApplicationID, req.Expiration)
 		if err != nil {
-			http.Error(w, "Failed to store secret", http.StatusInternalServerError)
+			writeSecretStoreError(w, err)
 			return
 		}
 
@@ -53,8 +59,9 @@ func CreateSecretHandler(provider UserSecretProvider) http.Handler {
 //	401: description:Unauthorized
 //	403: description:Forbidden
 //	404: description:Not Found
+//	410: description:Secret expired
 func GetSecretHandler(provider UserSecretProvider) http.Handler {
-	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		urlId := r.PathValue("ID")
 		secretId, err := uuid.Parse(urlId)
 		if err != nil {
@@ -68,16 +75,12 @@ func GetSecretHandler(provider UserSecretProvider) http.Handler {
 			return
 		}
 
-		secret, err := provider.RetrieveSecret(secretId)
+		secret, err := provider.RetrieveSecretForUser(r.Context(), userID, secretId)
 		if err != nil || secret == nil {
-			http.Error(w, "Not found", http.StatusNotFound)
-			return
-		}
-
-		if secret.ExternalAuthToken.UserID != userID {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			writeSecretAccessError(w, err)
 			return
 		}
+		recordSecretRead(r, secretId)
 
 		resp := RetrievedSecretResponse{}
 		resp.Body.ID = secret.ExternalAuthToken.Id
@@ -88,7 +91,7 @@ func GetSecretHandler(provider UserSecretProvider) http.Handler {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp.Body)
-	}))
+	})
 }
 
 // swagger:route GET /user/secrets/{USERID} secrets GetUserSecretEntries
@@ -101,7 +104,7 @@ func GetSecretHandler(provider UserSecretProvider) http.Handler {
 //	404: description:Not Found
 
 func GetUserSecretEntriesByIdHandler(provider UserSecretProvider) http.Handler {
-	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		urlId := r.PathValue("USERID")
 		urlUserId, err := uuid.Parse(urlId)
 		if err != nil {
@@ -116,12 +119,11 @@ func GetUserSecretEntriesByIdHandler(provider UserSecretProvider) http.Handler {
 			return
 		}
 
-		if urlUserId != userID {
-			http.Error(w, "unauthorized to access secrets for requested user id", http.StatusUnauthorized)
-
+		if !authorizeSecretOwner(w, provider, userID, urlUserId) {
+			return
 		}
 
-		secrets, err := provider.GetUserSecretEntries(urlUserId)
+		secrets, err := provider.GetUserSecretEntries(r.Context(), urlUserId)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
@@ -129,6 +131,7 @@ func GetUserSecretEntriesByIdHandler(provider UserSecretProvider) http.Handler {
 
 		if secrets == nil {
 			http.Error(w, "Not Found", http.StatusNotFound)
+			return
 		}
 
 		resp := GetUserSecretEntriesResponseWrapper{
@@ -137,7 +140,7 @@ func GetUserSecretEntriesByIdHandler(provider UserSecretProvider) http.Handler {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp.Body)
 
-	}))
+	})
 }
 
 // swagger:route GET /user/{APPID}/secrets/{USERID} secrets GetUserSecretEntriesByAppId
@@ -150,19 +153,21 @@ func GetUserSecretEntriesByIdHandler(provider UserSecretProvider) http.Handler {
 //	404: description:Not Found
 
 func GetUserSecretEntriesByAppIdHandler(provider UserSecretProvider) http.Handler {
-	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		urlappId := r.PathValue("APPID")
 		urlId := r.PathValue("USERID")
 		urlUserId, err := uuid.Parse(urlId)
 		if err != nil {
 			slog.Error("Error parsing USER UUID from url string")
 			http.Error(w, "Invalid USERID", http.StatusBadRequest)
+			return
 		}
 
 		urlAppId, err := uuid.Parse(urlappId)
 		if err != nil {
 			slog.Error("Error parsing APP UUID from url string")
-			http.Error(w, "Invalid USERID", http.StatusBadRequest)
+			http.Error(w, "Invalid APPID", http.StatusBadRequest)
+			return
 		}
 
 		userID, err := authapi.GetUserIDFromContext(r.Context())
@@ -171,12 +176,11 @@ func GetUserSecretEntriesByAppIdHandler(provider UserSecretProvider) http.Handle
 			return
 		}
 
-		if urlUserId != userID {
-			http.Error(w, "unauthorized to access secrets for requested user id", http.StatusUnauthorized)
-
+		if !authorizeSecretOwner(w, provider, userID, urlUserId) {
+			return
 		}
 
-		secrets, err := provider.GetUserSecretEntriesByAppId(urlUserId, urlAppId)
+		secrets, err := provider.GetUserSecretEntriesByAppId(r.Context(), urlUserId, urlAppId)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
@@ -184,6 +188,7 @@ func GetUserSecretEntriesByAppIdHandler(provider UserSecretProvider) http.Handle
 
 		if secrets == nil {
 			http.Error(w, "Not Found", http.StatusNotFound)
+			return
 		}
 
 		resp := GetUserSecretEntriesResponseWrapper{
@@ -192,7 +197,7 @@ func GetUserSecretEntriesByAppIdHandler(provider UserSecretProvider) http.Handle
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp.Body)
 
-	}))
+	})
 }
 
 // swagger:route DELETE /secrets/delete/{ID} secrets deleteUserSecretByID
@@ -219,19 +224,8 @@ func DeleteSecretHandler(provider UserSecretProvider) http.Handler {
 			return
 		}
 
-		secret, err := provider.RetrieveSecret(secretId)
-		if err != nil || secret == nil {
-			http.Error(w, "Not found", http.StatusNotFound)
-			return
-		}
-
-		if secret.ExternalAuthToken.UserID != userID {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-
-		if err := provider.DeleteSecret(secretId); err != nil {
-			http.Error(w, "Failed to delete secret", http.StatusInternalServerError)
+		if err := provider.DeleteSecretForUser(r.Context(), userID, secretId); err != nil {
+			writeSecretAccessError(w, err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -249,7 +243,7 @@ func DeleteSecretHandler(provider UserSecretProvider) http.Handler {
 //	404: description:Not Found
 //	500: description:Internal Server Error
 func GetUserSecretEntriesByAppNameHandler(provider UserSecretProvider) http.Handler {
-	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		appName := r.PathValue("APPNAME")
 		urlId := r.PathValue("USERID")
 		urlUserId, err := uuid.Parse(urlId)
@@ -265,12 +259,11 @@ func GetUserSecretEntriesByAppNameHandler(provider UserSecretProvider) http.Hand
 			return
 		}
 
-		if urlUserId != userID {
-			http.Error(w, "unauthorized to access secrets for requested user id", http.StatusUnauthorized)
+		if !authorizeSecretOwner(w, provider, userID, urlUserId) {
 			return
 		}
 
-		secrets, err := provider.GetUserSecretEntriesByAppName(urlUserId, appName)
+		secrets, err := provider.GetUserSecretEntriesByAppName(r.Context(), urlUserId, appName)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
@@ -286,5 +279,634 @@ func GetUserSecretEntriesByAppNameHandler(provider UserSecretProvider) http.Hand
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// authorizeSecretOwner writes a 403 and returns false unless the caller may access ownerId's secrets.
+func authorizeSecretOwner(w http.ResponseWriter, provider UserSecretProvider, callerId, ownerId uuid.UUID) bool {
+	allowed, err := provider.CanAccessUserSecrets(callerId, ownerId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// recordSecretRead audits a plaintext read. Reads change nothing, so the audit middleware
+// only sees them through this hook.
+func recordSecretRead(r *http.Request, secretId uuid.UUID) {
+	audit_log.Record(r.Context(), audit_log.Event{
+		Action:       audit_log.ActionRead,
+		ResourceType: audit_log.ResourceSecret,
+		ResourceId:   secretId.String(),
+	})
+}
+
+// writeSecretStoreError maps errors of storing a new secret. Applications the active
+// organization cannot see are reported as not found.
+func writeSecretStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, organizations.ErrNoActiveOrganization):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrApplicationNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to store secret", http.StatusInternalServerError)
+	}
+}
+
+// writeSecretAccessError maps provider errors to responses. Secrets the caller may not
+// access are reported as not found so their existence is not disclosed.
+func writeSecretAccessError(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil, errors.Is(err, ErrSecretNotFound), errors.Is(err, ErrSecretAccessDenied):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, organizations.ErrNoActiveOrganization):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrSecretExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// SecretVersionsHandler handles GET and POST for /secrets/versions/{ID}
+func SecretVersionsHandler(provider UserSecretProvider, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, ReadSecretMetadataPermission, ListSecretVersionsHandler(provider)).ServeHTTP(w, r)
+		case http.MethodPost:
+			authapi.AuthMiddlewareRequirePermission(authService, ManageSecretsPermission, AddSecretVersionHandler(provider)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// SecretVersionByNumberHandler handles GET and DELETE for /secrets/versions/{ID}/{VERSION}
+func SecretVersionByNumberHandler(provider UserSecretProvider, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, ReadSecretPlaintextPermission, GetSecretVersionHandler(provider)).ServeHTTP(w, r)
+		case http.MethodDelete:
+			authapi.AuthMiddlewareRequirePermission(authService, ManageSecretsPermission, DestroySecretVersionHandler(provider)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// swagger:route POST /secrets/versions/{ID} secrets addUserSecretVersion
+// Store a new value for an existing secret and make it the current version.
+// responses:
+//
+//	200: SecretVersionResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+func AddSecretVersionHandler(provider UserSecretProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AddSecretVersionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if req.Fields != nil {
+			fields, err := json.Marshal(req.Fields)
+			if err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+			req.Secret = string(fields)
+		}
+		if req.Secret == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		version, err := provider.AddSecretVersion(r.Context(), userID, secretId, req.Secret, req.Expiration)
+		if err != nil {
+			writeSecretVersionError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version)
+	}))
+}
+
+// swagger:route GET /secrets/versions/{ID} secrets listUserSecretVersions
+// List the version history of a secret, newest first.
+// responses:
+//
+//	200: SecretVersionsResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Forbidden
+//	404: description:Not Found
+func ListSecretVersionsHandler(provider UserSecretProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		versions, err := provider.ListSecretVersions(r.Context(), userID, secretId)
+		if err != nil {
+			writeSecretVersionError(w, err)
+			return
+		}
+
+		resp := SecretVersionsResponse{Body: versions}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route GET /secrets/versions/{ID}/{VERSION} secrets getUserSecretVersion
+// Retrieve a specific version of a user secret.
+// responses:
+//
+//	200: RetrievedSecretResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Forbidden
+//	404: description:Not Found
+//	410: description:Version destroyed
+func GetSecretVersionHandler(provider UserSecretProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, version, ok := parseSecretVersionPath(w, r)
+		if !ok {
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		secret, err := provider.RetrieveSecretVersion(r.Context(), userID, secretId, version)
+		if err != nil || secret == nil {
+			writeSecretVersionError(w, err)
+			return
+		}
+		recordSecretRead(r, secretId)
+
+		resp := RetrievedSecretResponse{}
+		resp.Body.ID = secret.ExternalAuthToken.Id
+		resp.Body.UserID = secret.ExternalAuthToken.UserID
+		resp.Body.ExternalApplication = secret.ExternalAuthToken.ExternalApplicationId
+		resp.Body.Expiration = secret.ExternalAuthToken.Expiration
+		resp.Body.Secret = string(secret.ExternalAuthToken.Token)
+		resp.Body.Version = secret.Version
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route DELETE /secrets/versions/{ID}/{VERSION} secrets destroyUserSecretVersion
+// Permanently destroy the value of a non-current secret version.
+// responses:
+//
+//	200: description:Secret version destroyed
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	409: description:Version is current
+//	410: description:Version already destroyed
+func DestroySecretVersionHandler(provider UserSecretProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, version, ok := parseSecretVersionPath(w, r)
+		if !ok {
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := provider.DestroySecretVersion(r.Context(), userID, secretId, version); err != nil {
+			writeSecretVersionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+// swagger:route POST /secrets/rollback/{ID} secrets rollbackUserSecret
+// Make an earlier version of a secret current again.
+// responses:
+//
+//	200: SecretVersionResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+//	410: description:Version destroyed or expired
+func RollbackSecretHandler(provider UserSecretProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		var req RollbackSecretRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version <= 0 {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		version, err := provider.RollbackSecret(r.Context(), userID, secretId, req.Version)
+		if err != nil {
+			writeSecretVersionError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version)
+	}))
+}
+
+func parseSecretVersionPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, int32, bool) {
+	secretId, err := uuid.Parse(r.PathValue("ID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return uuid.Nil, 0, false
+	}
+	version, err := strconv.ParseInt(r.PathValue("VERSION"), 10, 32)
+	if err != nil || version <= 0 {
+		http.Error(w, "Invalid VERSION", http.StatusBadRequest)
+		return uuid.Nil, 0, false
+	}
+	return secretId, int32(version), true
+}
+
+// writeSecretVersionError extends writeSecretTypeError with the version specific errors.
+func writeSecretVersionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrSecretVersionNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, ErrSecretVersionDestroyed):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, ErrCannotDestroyCurrentVersion):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeSecretTypeError(w, err)
+	}
+}
+
+// swagger:route GET /secrets/expiring secrets getExpiringUserSecrets
+// List the caller's secrets that expire within the given number of days, including expired secrets awaiting purge.
+// responses:
+//
+//	200: ExpiringSecretsResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Forbidden
+//	500: description:Internal Server Error
+func GetExpiringSecretsHandler(provider UserSecretProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		within := DefaultExpiryWarnWindow
+		if days := r.URL.Query().Get("days"); days != "" {
+			n, err := strconv.Atoi(days)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+			within = time.Duration(n) * 24 * time.Hour
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		entries, err := provider.GetExpiringSecretEntries(r.Context(), userID, within)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := ExpiringSecretsResponse{Body: entries}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route GET /secrets/types secrets getSecretSchemas
+// List the typed secret schemas and their fields.
+// responses:
+//
+//	200: SecretSchemasResponse
+//	401: description:Unauthorized
+func GetSecretSchemasHandler() http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := SecretSchemasResponse{Body: SecretSchemas()}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
 	}))
 }
+
+// swagger:route POST /secrets/typed/create secrets createTypedUserSecret
+// Create a typed secret whose fields are validated against its schema and encrypted as one unit.
+// responses:
+//
+//	200: CreateSecretResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+func CreateTypedSecretHandler(provider UserSecretProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CreateTypedSecretRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		secretId, err := provider.StoreTypedSecret(r.Context(), req.Type, req.Fields, userID, req.ApplicationID, req.Expiration)
+		if err != nil {
+			writeSecretTypeError(w, err)
+			return
+		}
+
+		resp := CreateSecretResponse{}
+		resp.Body.ID = secretId
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	}))
+}
+
+// swagger:route GET /secrets/typed/{ID} secrets getTypedUserSecret
+// Retrieve all fields of a typed secret.
+// responses:
+//
+//	200: TypedSecretResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Forbidden
+//	404: description:Not Found
+//	409: description:Secret is not typed
+//	410: description:Secret expired
+func GetTypedSecretHandler(provider UserSecretProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		typed, err := provider.RetrieveTypedSecretForUser(r.Context(), userID, secretId)
+		if err != nil {
+			writeSecretTypeError(w, err)
+			return
+		}
+		recordSecretRead(r, secretId)
+
+		resp := TypedSecretResponse{}
+		resp.Body.ID = secretId
+		resp.Body.Type = typed.Type
+		resp.Body.Fields = typed.Fields
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// swagger:route GET /secrets/typed/{ID}/{FIELD} secrets getTypedUserSecretField
+// Retrieve a single field of a typed secret.
+// responses:
+//
+//	200: SecretFieldResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	403: description:Forbidden
+//	404: description:Not Found
+//	409: description:Secret is not typed
+//	410: description:Secret expired
+func GetSecretFieldHandler(provider UserSecretProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		field := r.PathValue("FIELD")
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		value, err := provider.RetrieveSecretFieldForUser(r.Context(), userID, secretId, field)
+		if err != nil {
+			writeSecretTypeError(w, err)
+			return
+		}
+		recordSecretRead(r, secretId)
+
+		resp := SecretFieldResponse{}
+		resp.Body.ID = secretId
+		resp.Body.Field = field
+		resp.Body.Value = value
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	})
+}
+
+// writeSecretTypeError extends writeSecretAccessError with schema and field errors.
+func writeSecretTypeError(w http.ResponseWriter, err error) {
+	var validationErr *SecretValidationError
+	switch {
+	case errors.As(err, &validationErr), errors.Is(err, ErrUnknownSecretType):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrSecretFieldNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, ErrSecretNotTyped):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrApplicationNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	default:
+		writeSecretAccessError(w, err)
+	}
+}
+
+// SecretGrantsHandler handles GET and POST for /secrets/grants/{ID}
+func SecretGrantsHandler(provider UserSecretProvider, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authapi.AuthMiddlewareRequirePermission(authService, ReadSecretMetadataPermission, ListSecretGrantsHandler(provider)).ServeHTTP(w, r)
+		case http.MethodPost:
+			authapi.AuthMiddlewareRequirePermission(authService, ManageSecretsPermission, GrantSecretAccessHandler(provider)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// swagger:route POST /secrets/grants/{ID} secrets grantUserSecretAccess
+// Share a secret with a user or role. Read access returns the plaintext, use access only lets server features such as SSH connect decrypt it.
+// responses:
+//
+//	200: SecretGrantResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+func GrantSecretAccessHandler(provider UserSecretProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		var req NewSecretGrant
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		grant, err := provider.GrantSecretAccess(r.Context(), userID, secretId, req)
+		if err != nil {
+			writeSecretGrantError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grant)
+	}))
+}
+
+// swagger:route GET /secrets/grants/{ID} secrets listUserSecretGrants
+// List the active grants on a secret.
+// responses:
+//
+//	200: SecretGrantsResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+func ListSecretGrantsHandler(provider UserSecretProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		grants, err := provider.ListSecretGrants(r.Context(), userID, secretId)
+		if err != nil {
+			writeSecretGrantError(w, err)
+			return
+		}
+
+		resp := SecretGrantsResponse{Body: grants}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp.Body)
+	}))
+}
+
+// swagger:route DELETE /secrets/grants/{ID}/{GRANTID} secrets revokeUserSecretGrant
+// Revoke a grant on a secret.
+// responses:
+//
+//	200: description:Grant revoked
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	404: description:Not Found
+func RevokeSecretGrantHandler(provider UserSecretProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretId, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		grantId, err := uuid.Parse(r.PathValue("GRANTID"))
+		if err != nil {
+			http.Error(w, "Invalid GRANTID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := provider.RevokeSecretGrant(r.Context(), userID, secretId, grantId); err != nil {
+			writeSecretGrantError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func writeSecretGrantError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidSecretGrant):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrSecretGrantNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		writeSecretAccessError(w, err)
+	}
+}
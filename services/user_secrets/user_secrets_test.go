@@ -0,0 +1,242 @@
+package user_secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/organizations"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeSecretDb serves the queries the ownership and grant checks depend on.
+type fakeSecretDb struct {
+	tokens    map[uuid.UUID]infra_db_pg.ExternalAuthToken
+	delegates map[uuid.UUID]bool
+	// grants maps secret id to grantee user id to access level.
+	grants  map[uuid.UUID]map[uuid.UUID]string
+	deleted []uuid.UUID
+}
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i := range dest {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+	return nil
+}
+
+func (f *fakeSecretDb) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "DeleteExternalAuthTokenById") {
+		f.deleted = append(f.deleted, args[0].(uuid.UUID))
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (f *fakeSecretDb) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeSecretDb) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	switch {
+	case strings.Contains(sql, "GetExternalAuthTokenById"):
+		t, ok := f.tokens[args[0].(uuid.UUID)]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: []any{t.ID, t.UserID, t.ExternalAppID, t.Token, t.Expiration, t.CreatedAt, t.LastModified}}
+	case strings.Contains(sql, "VerifyUserPermissionById"):
+		userId := args[0].(pgtype.UUID)
+		permission := args[1].(pgtype.Text)
+		return fakeRow{values: []any{f.delegates[userId.Bytes] && permission.String == DelegatedSecretAccessPermission}}
+	case strings.Contains(sql, "GetActiveExternalAuthTokenGrantLevel"):
+		level, ok := f.grants[args[0].(uuid.UUID)][args[1].(uuid.UUID)]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: []any{level}}
+	}
+	return fakeRow{err: errors.New("unexpected query")}
+}
+
+func newFakeSecret(t *testing.T, db *fakeSecretDb, ownerId uuid.UUID, plaintext string) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	cipherText, err := EncryptBound(plaintext, SecretBinding{UserId: ownerId, SecretId: id})
+	if err != nil {
+		t.Fatalf("error encrypting secret: %v", err)
+	}
+	token, err := json.Marshal(PgEncrytpedSecret{UserId: ownerId, UserSecret: &cipherText})
+	if err != nil {
+		t.Fatalf("error marshalling secret: %v", err)
+	}
+	db.tokens[id] = infra_db_pg.ExternalAuthToken{
+		ID:         id,
+		UserID:     ownerId,
+		Token:      token,
+		Expiration: pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+	}
+	return id
+}
+
+func TestUserCannotReadAnotherUsersSecret(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	db := &fakeSecretDb{tokens: map[uuid.UUID]infra_db_pg.ExternalAuthToken{}, delegates: map[uuid.UUID]bool{}}
+	store := NewPgUserSecretStore(db)
+
+	owner, other, admin := uuid.New(), uuid.New(), uuid.New()
+	db.delegates[admin] = true
+	secretId := newFakeSecret(t, db, owner, "owner-token")
+
+	got, err := store.RetrieveSecretForUser(context.Background(), owner, secretId)
+	if err != nil {
+		t.Fatalf("owner should read own secret: %v", err)
+	}
+	if string(got.ExternalAuthToken.Token) != "owner-token" {
+		t.Fatalf("unexpected plaintext %q", got.ExternalAuthToken.Token)
+	}
+
+	if _, err := store.RetrieveSecretForUser(context.Background(), other, secretId); !errors.Is(err, ErrSecretAccessDenied) {
+		t.Fatalf("expected access denied for another user, got: %v", err)
+	}
+	if err := store.DeleteSecretForUser(context.Background(), other, secretId); !errors.Is(err, ErrSecretAccessDenied) {
+		t.Fatalf("expected delete by another user to be denied, got: %v", err)
+	}
+	if len(db.deleted) != 0 {
+		t.Fatal("secret was deleted by a user who does not own it")
+	}
+	if _, err := store.RetrieveSecretForUser(context.Background(), other, uuid.New()); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("expected not found for unknown secret, got: %v", err)
+	}
+
+	if _, err := store.RetrieveSecretForUser(context.Background(), admin, secretId); err != nil {
+		t.Fatalf("delegated caller should read secret: %v", err)
+	}
+	if ok, _ := store.CanAccessUserSecrets(other, owner); ok {
+		t.Fatal("another user should not be able to list the owner's secrets")
+	}
+}
+
+// Scoping lives in the store, so callers outside the HTTP handlers, such as the SSH
+// connection manager, cannot reach secrets owned by another organization either.
+func TestSecretsOutsideActiveOrgAreHidden(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	db := &fakeSecretDb{tokens: map[uuid.UUID]infra_db_pg.ExternalAuthToken{}, delegates: map[uuid.UUID]bool{}}
+	store := NewPgUserSecretStore(db)
+
+	owner := uuid.New()
+	secretId := newFakeSecret(t, db, owner, "owner-token")
+	secretOrg := uuid.New()
+	organizations.SetDefault(&orgTenancy{org: secretOrg, members: map[uuid.UUID]bool{owner: true}})
+	t.Cleanup(func() { organizations.SetDefault(nil) })
+
+	ctx := organizations.WithActiveOrg(context.Background(), secretOrg)
+	if _, err := store.RetrieveSecretForUse(ctx, owner, secretId); err != nil {
+		t.Fatalf("owner should use the secret in its organization: %v", err)
+	}
+
+	ctx = organizations.WithActiveOrg(context.Background(), uuid.New())
+	if _, err := store.RetrieveSecretForUse(ctx, owner, secretId); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("expected secret in another organization to be not found, got: %v", err)
+	}
+	if err := store.DeleteSecretForUser(ctx, owner, secretId); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("expected delete outside the organization to be not found, got: %v", err)
+	}
+}
+
+func TestSecretHandlersHideOtherUsersSecrets(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	t.Setenv("EXPIRATION_MINUTES", "5")
+	authapi.SetKeyRing(nil)
+
+	db := &fakeSecretDb{tokens: map[uuid.UUID]infra_db_pg.ExternalAuthToken{}, delegates: map[uuid.UUID]bool{}}
+	store := NewPgUserSecretStore(db)
+	owner, other := uuid.New(), uuid.New()
+	secretId := newFakeSecret(t, db, owner, "owner-token")
+
+	serve := func(h http.Handler, caller uuid.UUID, method, pattern, path string) *httptest.ResponseRecorder {
+		token, err := authapi.NewAccessToken(caller, uuid.UUIDs{uuid.New()}, "user@example.com")
+		if err != nil {
+			t.Fatalf("error creating access token: %v", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pattern, authapi.AuthMiddleware(h))
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(GetSecretHandler(store), owner, http.MethodGet, "/secrets/{ID}", "/secrets/"+secretId.String()); rec.Code != http.StatusOK {
+		t.Fatalf("owner expected 200, got %d", rec.Code)
+	}
+	rec := serve(GetSecretHandler(store), other, http.MethodGet, "/secrets/{ID}", "/secrets/"+secretId.String())
+	if rec.Code != http.StatusNotFound || strings.Contains(rec.Body.String(), "owner-token") {
+		t.Fatalf("other user expected 404 without plaintext, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(GetUserSecretEntriesByIdHandler(store), other, http.MethodGet, "/user/secrets/{USERID}", "/user/secrets/"+owner.String()); rec.Code != http.StatusForbidden {
+		t.Fatalf("other user listing expected 403, got %d", rec.Code)
+	}
+}
+
+type recordedEvents struct {
+	events []audit_log.Event
+}
+
+func (r *recordedEvents) Record(ctx context.Context, event audit_log.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestDeleteSecretRecordsRedactedDiff(t *testing.T) {
+	t.Setenv("USER_SEC_KEY", "12345678901234567890123456789012")
+	recorder := &recordedEvents{}
+	audit_log.SetDefault(recorder)
+	t.Cleanup(func() { audit_log.SetDefault(nil) })
+
+	db := &fakeSecretDb{tokens: map[uuid.UUID]infra_db_pg.ExternalAuthToken{}, delegates: map[uuid.UUID]bool{}}
+	store := NewPgUserSecretStore(db)
+	owner := uuid.New()
+	secretId := newFakeSecret(t, db, owner, "owner-token")
+
+	if err := store.DeleteSecretForUser(context.Background(), owner, secretId); err != nil {
+		t.Fatalf("owner should delete own secret: %v", err)
+	}
+	if len(recorder.events) != 1 {
+		t.Fatalf("expected one audit event, got %d", len(recorder.events))
+	}
+	event := recorder.events[0]
+	if event.Action != audit_log.ActionDelete || event.ResourceType != audit_log.ResourceSecret || event.ResourceId != secretId.String() {
+		t.Fatalf("unexpected audit event %+v", event)
+	}
+	diff, err := audit_log.Diff(event.Before, event.After)
+	if err != nil {
+		t.Fatalf("error diffing audit event: %v", err)
+	}
+	if diff["secret"].Before != audit_log.Redacted {
+		t.Fatalf("expected the encrypted value to be redacted, got %v", diff["secret"].Before)
+	}
+	if diff["userId"].Before != owner.String() {
+		t.Fatalf("expected the owner in the diff, got %v", diff["userId"].Before)
+	}
+}
@@ -0,0 +1,190 @@
+package user_secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const vaultActiveVersionTtl = time.Minute
+
+// VaultTransitKeyProvider wraps data keys with a named HashiCorp Vault Transit key.
+// The wrapped key is Vault's "vault:v<N>:..." ciphertext, so the KEK version is the
+// Transit key version and rotating the key in Vault is picked up by the re-wrap job.
+type VaultTransitKeyProvider struct {
+	Address   string
+	Mount     string
+	KeyName   string
+	Namespace string
+	// TokenFunc returns the Vault token for each request so a token file rotated by a
+	// Vault agent sidecar is re-read without restarting the API.
+	TokenFunc  func() (string, error)
+	HttpClient *http.Client
+
+	mu              sync.Mutex
+	activeVersion   int
+	activeFetchedAt time.Time
+}
+
+// NewVaultTransitKeyProviderFromEnv reads VAULT_ADDR, VAULT_NAMESPACE, VAULT_TOKEN or
+// VAULT_TOKEN_FILE, USER_SEC_VAULT_TRANSIT_MOUNT (default transit) and USER_SEC_VAULT_TRANSIT_KEY.
+func NewVaultTransitKeyProviderFromEnv() (*VaultTransitKeyProvider, error) {
+	address := os.Getenv("VAULT_ADDR")
+	keyName := os.Getenv("USER_SEC_VAULT_TRANSIT_KEY")
+	if address == "" || keyName == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and USER_SEC_VAULT_TRANSIT_KEY are required for the vault key provider")
+	}
+
+	mount := os.Getenv("USER_SEC_VAULT_TRANSIT_MOUNT")
+	if mount == "" {
+		mount = "transit"
+	}
+
+	tokenFunc := func() (string, error) { return os.Getenv("VAULT_TOKEN"), nil }
+	if tokenFile := os.Getenv("VAULT_TOKEN_FILE"); tokenFile != "" {
+		tokenFunc = func() (string, error) {
+			token, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return "", fmt.Errorf("error reading VAULT_TOKEN_FILE: %w", err)
+			}
+			return strings.TrimSpace(string(token)), nil
+		}
+	}
+
+	return &VaultTransitKeyProvider{
+		Address:    strings.TrimRight(address, "/"),
+		Mount:      strings.Trim(mount, "/"),
+		KeyName:    keyName,
+		Namespace:  os.Getenv("VAULT_NAMESPACE"),
+		TokenFunc:  tokenFunc,
+		HttpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (v *VaultTransitKeyProvider) Name() string {
+	return "vault-transit"
+}
+
+// ActiveVersion returns the latest version of the Transit key, cached for a minute.
+func (v *VaultTransitKeyProvider) ActiveVersion() (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.activeVersion > 0 && time.Since(v.activeFetchedAt) < vaultActiveVersionTtl {
+		return v.activeVersion, nil
+	}
+
+	var resp struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+		} `json:"data"`
+	}
+	if err := v.do(http.MethodGet, "keys/"+v.KeyName, nil, &resp); err != nil {
+		return 0, err
+	}
+	v.activeVersion = resp.Data.LatestVersion
+	v.activeFetchedAt = time.Now()
+	return v.activeVersion, nil
+}
+
+func (v *VaultTransitKeyProvider) WrapKey(dataKey []byte) (int, []byte, error) {
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+			KeyVersion int    `json:"key_version"`
+		} `json:"data"`
+	}
+	if err := v.do(http.MethodPost, "encrypt/"+v.KeyName, req, &resp); err != nil {
+		return 0, nil, err
+	}
+
+	version := resp.Data.KeyVersion
+	if version == 0 {
+		parsed, err := vaultCiphertextVersion(resp.Data.Ciphertext)
+		if err != nil {
+			return 0, nil, err
+		}
+		version = parsed
+	}
+	return version, []byte(resp.Data.Ciphertext), nil
+}
+
+func (v *VaultTransitKeyProvider) UnwrapKey(version int, wrappedKey []byte) ([]byte, error) {
+	ciphertextVersion, err := vaultCiphertextVersion(string(wrappedKey))
+	if err != nil {
+		return nil, err
+	}
+	if ciphertextVersion != version {
+		return nil, fmt.Errorf("%w: secret records version %d but vault ciphertext is version %d", ErrUnknownKeyVersion, version, ciphertextVersion)
+	}
+
+	req := map[string]string{"ciphertext": string(wrappedKey)}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.do(http.MethodPost, "decrypt/"+v.KeyName, req, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (v *VaultTransitKeyProvider) do(method, path string, body any, out any) error {
+	token, err := v.TokenFunc()
+	if err != nil {
+		return err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s/%s", v.Address, v.Mount, path), reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("Content-Type", "application/json")
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := v.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling vault transit: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("vault transit %s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// vaultCiphertextVersion parses the key version from a "vault:v<N>:<data>" ciphertext.
+func vaultCiphertextVersion(ciphertext string) (int, error) {
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return 0, fmt.Errorf("invalid vault transit ciphertext")
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid vault transit ciphertext version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,47 @@
+package user_verification
+
+// swagger:model ForgotPasswordRequest
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// swagger:parameters forgotPassword
+type ForgotPasswordRequestWrapper struct {
+	// in: body
+	Body ForgotPasswordRequest `json:"body"`
+}
+
+// swagger:model ResetPasswordRequest
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// swagger:parameters resetPassword
+type ResetPasswordRequestWrapper struct {
+	// in: body
+	Body ResetPasswordRequest `json:"body"`
+}
+
+// swagger:model VerifyEmailRequest
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// swagger:parameters verifyEmail
+type VerifyEmailRequestWrapper struct {
+	// in: body
+	Body VerifyEmailRequest `json:"body"`
+}
+
+// swagger:model EmailVerificationStatus
+type EmailVerificationStatus struct {
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+}
+
+// swagger:response EmailVerificationStatusResponse
+type EmailVerificationStatusResponse struct {
+	// in: body
+	Body EmailVerificationStatus
+}
@@ -0,0 +1,79 @@
+package user_verification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeEmailVerify   = "email_verify"
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid or expired token")
+)
+
+// TokenSigner creates tokens of the form base64url(purpose|id|expiry).base64url(hmac). The
+// signature lets forged or expired tokens be rejected without a database lookup, the id
+// is what makes them single use.
+type TokenSigner struct {
+	secret []byte
+}
+
+func NewTokenSigner(secret []byte) *TokenSigner {
+	return &TokenSigner{secret: secret}
+}
+
+func (s *TokenSigner) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+func (s *TokenSigner) Sign(purpose string, id uuid.UUID, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s|%s|%d", purpose, id.String(), expiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Parse verifies the signature, purpose and expiry and returns the token id.
+func (s *TokenSigner) Parse(token string, purpose string) (uuid.UUID, error) {
+	encodedPayload, encodedSig, found := strings.Cut(token, ".")
+	if !found {
+		return uuid.Nil, ErrTokenInvalid
+	}
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return uuid.Nil, ErrTokenInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return uuid.Nil, ErrTokenInvalid
+	}
+	payload := string(payloadBytes)
+	if !hmac.Equal(sig, s.mac(payload)) {
+		return uuid.Nil, ErrTokenInvalid
+	}
+
+	parts := strings.Split(payload, "|")
+	if len(parts) != 3 || parts[0] != purpose {
+		return uuid.Nil, ErrTokenInvalid
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return uuid.Nil, ErrTokenInvalid
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() >= exp {
+		return uuid.Nil, ErrTokenInvalid
+	}
+	return id, nil
+}
@@ -0,0 +1,46 @@
+package user_verification
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTokenSigner(t *testing.T) {
+	signer := NewTokenSigner([]byte("0123456789abcdef0123456789abcdef"))
+	id := uuid.New()
+
+	token := signer.Sign(PurposePasswordReset, id, time.Now().Add(time.Minute))
+	got, err := signer.Parse(token, PurposePasswordReset)
+	if err != nil || got != id {
+		t.Fatalf("expected token to parse to %s, got %s (%v)", id, got, err)
+	}
+
+	if _, err := signer.Parse(token, PurposeEmailVerify); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatal("expected a reset token to be rejected for email verification")
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	// the first character carries no base64 padding bits, so any change alters the payload
+	replacement := "A"
+	if strings.HasPrefix(payload, replacement) {
+		replacement = "B"
+	}
+	tampered := replacement + payload[1:] + "." + sig
+	if _, err := signer.Parse(tampered, PurposePasswordReset); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatal("expected a tampered token to be rejected")
+	}
+
+	other := NewTokenSigner([]byte("another-secret-another-secret-00"))
+	if _, err := other.Parse(token, PurposePasswordReset); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatal("expected a token signed with another key to be rejected")
+	}
+
+	expired := signer.Sign(PurposePasswordReset, id, time.Now().Add(-time.Second))
+	if _, err := signer.Parse(expired, PurposePasswordReset); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatal("expected an expired token to be rejected")
+	}
+}
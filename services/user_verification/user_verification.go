@@ -0,0 +1,221 @@
+package user_verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/babbage88/go-infra/internal/password_policy"
+	"github.com/babbage88/go-infra/services/mailer"
+	"github.com/babbage88/go-infra/services/user_crud_svc"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultResetTtl  = 30 * time.Minute
+	defaultVerifyTtl = 48 * time.Hour
+)
+
+type PgUserVerificationService struct {
+	DbConn      *pgxpool.Pool
+	Signer      *TokenSigner
+	Mailer      mailer.Mailer
+	UserService *user_crud_svc.UserCRUDService
+	// Links in mails are the url with the token appended, the token alone when empty.
+	ResetUrl  string
+	VerifyUrl string
+	ResetTtl  time.Duration
+	VerifyTtl time.Duration
+}
+
+// NewPgUserVerificationService reads PASSWORD_RESET_URL, EMAIL_VERIFY_URL,
+// PASSWORD_RESET_TTL_MIN and EMAIL_VERIFY_TTL_HOURS.
+func NewPgUserVerificationService(dbConn *pgxpool.Pool, signer *TokenSigner, m mailer.Mailer, userService *user_crud_svc.UserCRUDService) *PgUserVerificationService {
+	s := &PgUserVerificationService{
+		DbConn:      dbConn,
+		Signer:      signer,
+		Mailer:      m,
+		UserService: userService,
+		ResetUrl:    os.Getenv("PASSWORD_RESET_URL"),
+		VerifyUrl:   os.Getenv("EMAIL_VERIFY_URL"),
+		ResetTtl:    defaultResetTtl,
+		VerifyTtl:   defaultVerifyTtl,
+	}
+	if v, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_TTL_MIN")); err == nil && v > 0 {
+		s.ResetTtl = time.Duration(v) * time.Minute
+	}
+	if v, err := strconv.Atoi(os.Getenv("EMAIL_VERIFY_TTL_HOURS")); err == nil && v > 0 {
+		s.VerifyTtl = time.Duration(v) * time.Hour
+	}
+	return s
+}
+
+func link(baseUrl string, token string) string {
+	if baseUrl == "" {
+		return token
+	}
+	return baseUrl + token
+}
+
+// issueToken invalidates earlier tokens for the same purpose so only the newest link works.
+func (s *PgUserVerificationService) issueToken(ctx context.Context, userId uuid.UUID, purpose string, email string, ttl time.Duration) (string, error) {
+	qry := infra_db_pg.New(s.DbConn)
+	err := qry.InvalidateUserActionTokens(ctx, infra_db_pg.InvalidateUserActionTokensParams{UserID: userId, Purpose: purpose})
+	if err != nil {
+		return "", fmt.Errorf("error invalidating previous tokens: %w", err)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	id, err := qry.InsertUserActionToken(ctx, infra_db_pg.InsertUserActionTokenParams{
+		UserID:    userId,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error inserting %s token: %w", purpose, err)
+	}
+	return s.Signer.Sign(purpose, id, expiresAt), nil
+}
+
+// consumeToken checks the signature and marks the token used. A token can only be
+// consumed once, even by concurrent requests.
+func (s *PgUserVerificationService) consumeToken(ctx context.Context, token string, purpose string) (*infra_db_pg.GetUserActionTokenRow, error) {
+	id, err := s.Signer.Parse(token, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	qry := infra_db_pg.New(s.DbConn)
+	row, err := qry.GetUserActionToken(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTokenInvalid
+		}
+		return nil, fmt.Errorf("error fetching token: %w", err)
+	}
+	if row.Purpose != purpose {
+		return nil, ErrTokenInvalid
+	}
+
+	n, err := qry.ConsumeUserActionToken(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming token: %w", err)
+	}
+	if n == 0 {
+		return nil, ErrTokenInvalid
+	}
+	return &row, nil
+}
+
+// RequestPasswordReset mails a reset link. Unknown addresses are not reported so the
+// endpoint cannot be used to discover accounts.
+func (s *PgUserVerificationService) RequestPasswordReset(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+	qry := infra_db_pg.New(s.DbConn)
+	user, err := qry.GetActiveUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Info("Password reset requested for unknown email")
+			return nil
+		}
+		return fmt.Errorf("error looking up user: %w", err)
+	}
+
+	token, err := s.issueToken(ctx, user.ID, PurposePasswordReset, user.Email.String, s.ResetTtl)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("A password reset was requested for %s.\n\nUse this link within %s to choose a new password:\n%s\n\nIf you did not request this you can ignore this mail.\n",
+		user.Username.String, s.ResetTtl, link(s.ResetUrl, token))
+	if err := s.Mailer.Send(ctx, mailer.Message{To: user.Email.String, Subject: "Password reset", Body: body}); err != nil {
+		return fmt.Errorf("error sending password reset mail: %w", err)
+	}
+	slog.Info("Sent password reset mail", slog.String("userId", user.ID.String()))
+	return nil
+}
+
+// ResetPassword checks the policy before consuming the token so a rejected password does
+// not burn the link. Reuse of a recent password is only detected afterwards.
+func (s *PgUserVerificationService) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	if err := password_policy.Default().Validate(newPassword); err != nil {
+		return err
+	}
+	row, err := s.consumeToken(ctx, token, PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+	if err := s.UserService.ResetUserPassword(ctx, row.UserID, newPassword); err != nil {
+		return err
+	}
+
+	// Receiving the reset mail proves the address belongs to the user
+	qry := infra_db_pg.New(s.DbConn)
+	if err := qry.UpsertUserEmailVerification(ctx, infra_db_pg.UpsertUserEmailVerificationParams{UserID: row.UserID, Email: row.Email}); err != nil {
+		slog.Warn("Failed to mark email verified after reset", slog.String("error", err.Error()))
+	}
+	slog.Info("Password reset completed", slog.String("userId", row.UserID.String()))
+	return nil
+}
+
+func (s *PgUserVerificationService) SendEmailVerification(ctx context.Context, userId uuid.UUID, email string) error {
+	token, err := s.issueToken(ctx, userId, PurposeEmailVerify, email, s.VerifyTtl)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Please confirm your email address within %s using this link:\n%s\n", s.VerifyTtl, link(s.VerifyUrl, token))
+	if err := s.Mailer.Send(ctx, mailer.Message{To: email, Subject: "Confirm your email address", Body: body}); err != nil {
+		return fmt.Errorf("error sending verification mail: %w", err)
+	}
+	slog.Info("Sent email verification mail", slog.String("userId", userId.String()))
+	return nil
+}
+
+// VerifyEmail marks the address the token was sent to as verified. If the user changed
+// their email since, IsEmailVerified stays false for the new address.
+func (s *PgUserVerificationService) VerifyEmail(ctx context.Context, token string) error {
+	row, err := s.consumeToken(ctx, token, PurposeEmailVerify)
+	if err != nil {
+		return err
+	}
+	qry := infra_db_pg.New(s.DbConn)
+	err = qry.UpsertUserEmailVerification(ctx, infra_db_pg.UpsertUserEmailVerificationParams{UserID: row.UserID, Email: row.Email})
+	if err != nil {
+		return fmt.Errorf("error storing email verification: %w", err)
+	}
+	slog.Info("Email verified", slog.String("userId", row.UserID.String()))
+	return nil
+}
+
+func (s *PgUserVerificationService) IsEmailVerified(ctx context.Context, userId uuid.UUID) (bool, error) {
+	return infra_db_pg.New(s.DbConn).IsUserEmailVerified(ctx, userId)
+}
+
+func (s *PgUserVerificationService) StartTokenCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := infra_db_pg.New(s.DbConn).DeleteExpiredUserActionTokens(ctx); err != nil {
+					slog.Error("Error deleting expired user action tokens", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,149 @@
+package user_verification
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/internal/password_policy"
+	"github.com/babbage88/go-infra/services/user_crud_svc"
+)
+
+// swagger:route POST /password/forgot passwordReset forgotPassword
+// Request a password reset link by email. The response is the same whether or not the address is registered.
+// responses:
+//
+//	202: description:Accepted
+//	400: description:Invalid request
+func ForgotPasswordHandler(provider UserVerificationProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := provider.RequestPasswordReset(r.Context(), req.Email); err != nil {
+			slog.Error("Failed to process password reset request", slog.String("error", err.Error()))
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// swagger:route POST /password/reset passwordReset resetPassword
+// Set a new password with a reset token. Ends all sessions of the user.
+// responses:
+//
+//	204: description:Password changed
+//	400: description:Invalid or expired token, or password does not meet policy
+func ResetPasswordHandler(provider UserVerificationProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		err := provider.ResetPassword(r.Context(), req.Token, req.NewPassword)
+		if err != nil {
+			var violation *password_policy.PolicyViolationError
+			switch {
+			case errors.Is(err, ErrTokenInvalid):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.As(err, &violation):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				slog.Error("Failed to reset password", slog.String("error", err.Error()))
+				http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route POST /email/verify emailVerification verifyEmail
+// Confirm an email address with the token from the verification mail.
+// responses:
+//
+//	204: description:Email verified
+//	400: description:Invalid or expired token
+func VerifyEmailHandler(provider UserVerificationProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := provider.VerifyEmail(r.Context(), req.Token); err != nil {
+			if errors.Is(err, ErrTokenInvalid) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			slog.Error("Failed to verify email", slog.String("error", err.Error()))
+			http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// swagger:route POST /email/verify/send emailVerification sendEmailVerification
+// Send a new verification mail to the current user's address.
+// responses:
+//
+//	202: description:Accepted
+//	401: description:Unauthorized
+func SendEmailVerificationHandler(provider UserVerificationProvider, userService *user_crud_svc.UserCRUDService) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := userService.GetUserById(userID)
+		if err != nil || user.Email == "" {
+			http.Error(w, "No email address on record", http.StatusBadRequest)
+			return
+		}
+
+		if err := provider.SendEmailVerification(r.Context(), userID, user.Email); err != nil {
+			slog.Error("Failed to send email verification", slog.String("error", err.Error()))
+			http.Error(w, "Failed to send verification mail", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+// swagger:route GET /email/verify/status emailVerification getEmailVerificationStatus
+// Show whether the current user's email address is verified.
+// responses:
+//
+//	200: EmailVerificationStatusResponse
+//	401: description:Unauthorized
+func EmailVerificationStatusHandler(provider UserVerificationProvider, userService *user_crud_svc.UserCRUDService) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := userService.GetUserById(userID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+			return
+		}
+		verified, err := provider.IsEmailVerified(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve verification status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EmailVerificationStatus{Email: user.Email, Verified: verified})
+	}))
+}
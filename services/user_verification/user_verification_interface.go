@@ -0,0 +1,15 @@
+package user_verification
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type UserVerificationProvider interface {
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	SendEmailVerification(ctx context.Context, userId uuid.UUID, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	IsEmailVerified(ctx context.Context, userId uuid.UUID) (bool, error)
+}
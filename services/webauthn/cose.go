@@ -0,0 +1,121 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for credentials.
+const (
+	CoseAlgES256 int64 = -7
+	CoseAlgEdDSA int64 = -8
+	CoseAlgRS256 int64 = -257
+)
+
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// SupportedAlgorithms lists the algorithms offered in pubKeyCredParams, in order of preference.
+var SupportedAlgorithms = []int64{CoseAlgES256, CoseAlgEdDSA, CoseAlgRS256}
+
+// CredentialPublicKey is a parsed COSE_Key.
+type CredentialPublicKey struct {
+	Alg int64
+	Key crypto.PublicKey
+}
+
+func coseInt(m map[any]any, key int64) (int64, bool) {
+	v, ok := m[key].(int64)
+	return v, ok
+}
+
+func coseBytes(m map[any]any, key int64) ([]byte, bool) {
+	v, ok := m[key].([]byte)
+	return v, ok
+}
+
+// ParseCredentialPublicKey decodes a COSE_Key and returns the key and the bytes after it.
+func ParseCredentialPublicKey(data []byte) (*CredentialPublicKey, []byte, error) {
+	decoded, rest, err := cborDecode(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding credential public key: %w", err)
+	}
+	m, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, nil, errors.New("credential public key is not a map")
+	}
+
+	kty, _ := coseInt(m, 1)
+	alg, ok := coseInt(m, 3)
+	if !ok {
+		return nil, nil, errors.New("credential public key has no alg")
+	}
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == CoseAlgES256:
+		crv, _ := coseInt(m, -1)
+		x, okX := coseBytes(m, -2)
+		y, okY := coseBytes(m, -3)
+		if crv != coseCurveP256 || !okX || !okY || len(x) != 32 || len(y) != 32 {
+			return nil, nil, errors.New("invalid ES256 credential public key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, nil, errors.New("ES256 credential public key is not on the curve")
+		}
+		return &CredentialPublicKey{Alg: alg, Key: pub}, rest, nil
+	case kty == coseKeyTypeOKP && alg == CoseAlgEdDSA:
+		crv, _ := coseInt(m, -1)
+		x, ok := coseBytes(m, -2)
+		if crv != coseCurveEd25519 || !ok || len(x) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("invalid EdDSA credential public key")
+		}
+		return &CredentialPublicKey{Alg: alg, Key: ed25519.PublicKey(x)}, rest, nil
+	case kty == coseKeyTypeRSA && alg == CoseAlgRS256:
+		n, okN := coseBytes(m, -1)
+		e, okE := coseBytes(m, -2)
+		if !okN || !okE || len(n) < 256 || len(e) > 4 {
+			return nil, nil, errors.New("invalid RS256 credential public key")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return &CredentialPublicKey{Alg: alg, Key: pub}, rest, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported credential key type %d with alg %d", kty, alg)
+	}
+}
+
+// Verify checks signature over data with the credential key.
+func (k *CredentialPublicKey) Verify(data []byte, signature []byte) error {
+	switch pub := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return errors.New("invalid ES256 signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, signature) {
+			return errors.New("invalid EdDSA signature")
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid RS256 signature")
+		}
+	default:
+		return errors.New("unsupported credential public key")
+	}
+	return nil
+}
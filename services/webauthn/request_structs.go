@@ -0,0 +1,176 @@
+package webauthn
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Base64URLBytes `json:"id"`
+	Name        string         `json:"name"`
+	DisplayName string         `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string         `json:"type"`
+	ID         Base64URLBytes `json:"id"`
+	Transports []string       `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// PublicKeyCredentialCreationOptions is passed to navigator.credentials.create().
+type PublicKeyCredentialCreationOptions struct {
+	Rp                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URLBytes         `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// PublicKeyCredentialRequestOptions is passed to navigator.credentials.get().
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        Base64URLBytes         `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RpID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type AttestationResponse struct {
+	ClientDataJSON    Base64URLBytes `json:"clientDataJSON"`
+	AttestationObject Base64URLBytes `json:"attestationObject"`
+	Transports        []string       `json:"transports,omitempty"`
+}
+
+// RegistrationCredential is the JSON encoded result of navigator.credentials.create().
+type RegistrationCredential struct {
+	ID       string              `json:"id"`
+	RawID    Base64URLBytes      `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+type AssertionResponse struct {
+	ClientDataJSON    Base64URLBytes `json:"clientDataJSON"`
+	AuthenticatorData Base64URLBytes `json:"authenticatorData"`
+	Signature         Base64URLBytes `json:"signature"`
+	UserHandle        Base64URLBytes `json:"userHandle,omitempty"`
+}
+
+// AssertionCredential is the JSON encoded result of navigator.credentials.get().
+type AssertionCredential struct {
+	ID       string            `json:"id"`
+	RawID    Base64URLBytes    `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// swagger:model BeginRegistrationResponse
+type BeginRegistrationResponse struct {
+	SessionID uuid.UUID                          `json:"sessionId"`
+	PublicKey PublicKeyCredentialCreationOptions `json:"publicKey"`
+}
+
+// swagger:response BeginRegistrationResponse
+type BeginRegistrationResponseWrapper struct {
+	// in: body
+	Body BeginRegistrationResponse
+}
+
+// swagger:model FinishRegistrationRequest
+type FinishRegistrationRequest struct {
+	SessionID  uuid.UUID              `json:"sessionId"`
+	Name       string                 `json:"name"`
+	Credential RegistrationCredential `json:"credential"`
+}
+
+// swagger:parameters finishPasskeyRegistration
+type FinishRegistrationRequestWrapper struct {
+	// in: body
+	Body FinishRegistrationRequest `json:"body"`
+}
+
+// swagger:model BeginLoginRequest
+type BeginLoginRequest struct {
+	// Optional, omit to use a discoverable credential
+	UserName string `json:"userName"`
+}
+
+// swagger:parameters beginPasskeyLogin
+type BeginLoginRequestWrapper struct {
+	// in: body
+	Body BeginLoginRequest `json:"body"`
+}
+
+// swagger:model BeginLoginResponse
+type BeginLoginResponse struct {
+	SessionID uuid.UUID                         `json:"sessionId"`
+	PublicKey PublicKeyCredentialRequestOptions `json:"publicKey"`
+}
+
+// swagger:response BeginLoginResponse
+type BeginLoginResponseWrapper struct {
+	// in: body
+	Body BeginLoginResponse
+}
+
+// swagger:model FinishLoginRequest
+type FinishLoginRequest struct {
+	SessionID  uuid.UUID           `json:"sessionId"`
+	Credential AssertionCredential `json:"credential"`
+}
+
+// swagger:parameters finishPasskeyLogin
+type FinishLoginRequestWrapper struct {
+	// in: body
+	Body FinishLoginRequest `json:"body"`
+}
+
+// swagger:model WebAuthnCredential
+type WebAuthnCredentialDao struct {
+	ID           uuid.UUID      `json:"id"`
+	UserID       uuid.UUID      `json:"userId"`
+	CredentialID Base64URLBytes `json:"credentialId"`
+	Name         string         `json:"name"`
+	SignCount    int64          `json:"signCount"`
+	Transports   []string       `json:"transports"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	LastUsedAt   time.Time      `json:"lastUsedAt,omitempty"`
+}
+
+// swagger:response WebAuthnCredentialResponse
+type WebAuthnCredentialResponse struct {
+	// in: body
+	Body WebAuthnCredentialDao
+}
+
+// swagger:response WebAuthnCredentialsResponse
+type WebAuthnCredentialsResponse struct {
+	// in: body
+	Body []WebAuthnCredentialDao
+}
+
+// swagger:parameters deletePasskey
+type DeletePasskeyRequest struct {
+	// in: path
+	// required: true
+	ID string `json:"ID"`
+}
@@ -0,0 +1,340 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	flagUserPresent     byte = 0x01
+	flagUserVerified    byte = 0x04
+	flagAttestedCredata byte = 0x40
+	flagExtensionData   byte = 0x80
+
+	challengeSize = 32
+)
+
+var (
+	ErrChallengeMismatch   = errors.New("webauthn challenge does not match")
+	ErrOriginNotAllowed    = errors.New("webauthn origin is not allowed")
+	ErrSignCountRegression = errors.New("authenticator sign count did not increase, the credential may be cloned")
+)
+
+// Base64URLBytes marshals to unpadded base64url as used by the WebAuthn JSON encoding.
+type Base64URLBytes []byte
+
+func (b Base64URLBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URLBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url value: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty holds the WebAuthn relying party settings and verifies ceremony responses.
+type RelyingParty struct {
+	ID               string
+	Name             string
+	Origins          []string
+	UserVerification string
+	Timeout          time.Duration
+}
+
+// NewRelyingPartyFromEnv reads WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME, WEBAUTHN_RP_ORIGINS and
+// WEBAUTHN_USER_VERIFICATION.
+func NewRelyingPartyFromEnv() *RelyingParty {
+	rp := &RelyingParty{
+		ID:               os.Getenv("WEBAUTHN_RP_ID"),
+		Name:             os.Getenv("WEBAUTHN_RP_NAME"),
+		UserVerification: os.Getenv("WEBAUTHN_USER_VERIFICATION"),
+		Timeout:          5 * time.Minute,
+	}
+	if rp.ID == "" {
+		rp.ID = "localhost"
+	}
+	if rp.Name == "" {
+		rp.Name = "go-infra"
+	}
+	if rp.UserVerification == "" {
+		rp.UserVerification = "required"
+	}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			rp.Origins = append(rp.Origins, origin)
+		}
+	}
+	if len(rp.Origins) == 0 {
+		rp.Origins = []string{"https://" + rp.ID}
+	}
+	return rp
+}
+
+func (rp *RelyingParty) NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("error generating webauthn challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremonyType string, challenge []byte) error {
+	var clientData collectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("error parsing clientDataJSON: %w", err)
+	}
+	if clientData.Type != ceremonyType {
+		return fmt.Errorf("unexpected clientData type %q", clientData.Type)
+	}
+	received, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(clientData.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if clientData.CrossOrigin || !slices.Contains(rp.Origins, clientData.Origin) {
+		return ErrOriginNotAllowed
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    *CredentialPublicKey
+	RawPublicKey []byte
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+	authData := &authenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if authData.Flags&flagAttestedCredata != 0 {
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data is too short")
+		}
+		authData.AAGUID = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("credential id is truncated")
+		}
+		authData.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		pub, after, err := ParseCredentialPublicKey(rest)
+		if err != nil {
+			return nil, err
+		}
+		authData.PublicKey = pub
+		authData.RawPublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if authData.Flags&flagExtensionData != 0 {
+		_, after, err := cborDecode(rest)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding authenticator extensions: %w", err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("unexpected trailing bytes in authenticator data")
+	}
+	return authData, nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIdHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIdHash[:]) {
+		return errors.New("authenticator data rpIdHash does not match the relying party")
+	}
+	if authData.Flags&flagUserPresent == 0 {
+		return errors.New("user presence flag is not set")
+	}
+	if rp.UserVerification == "required" && authData.Flags&flagUserVerified == 0 {
+		return errors.New("user verification is required")
+	}
+	return nil
+}
+
+// VerifiedCredential is a credential accepted by VerifyRegistration.
+type VerifiedCredential struct {
+	CredentialID []byte
+	PublicKey    []byte
+	Alg          int64
+	SignCount    uint32
+	AAGUID       []byte
+	Transports   []string
+}
+
+// VerifyRegistration verifies a navigator.credentials.create() response against the
+// challenge issued for the registration session.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, credential *RegistrationCredential) (*VerifiedCredential, error) {
+	if credential == nil || credential.Type != "public-key" {
+		return nil, errors.New("credential type must be public-key")
+	}
+	if err := rp.verifyClientData(credential.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := cborDecode(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding attestation object: %w", err)
+	}
+	attObj, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+	format, _ := attObj["fmt"].(string)
+	attStmt, _ := attObj["attStmt"].(map[any]any)
+	rawAuthData, ok := attObj["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authData")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.PublicKey == nil {
+		return nil, errors.New("attestation has no attested credential data")
+	}
+	if !slices.Contains(SupportedAlgorithms, authData.PublicKey.Alg) {
+		return nil, fmt.Errorf("unsupported credential algorithm %d", authData.PublicKey.Alg)
+	}
+	if !bytes.Equal(authData.CredentialID, credential.RawID) {
+		return nil, errors.New("credential id does not match attested credential data")
+	}
+
+	clientDataHash := sha256.Sum256(credential.Response.ClientDataJSON)
+	if err := verifyAttestationStatement(format, attStmt, rawAuthData, clientDataHash[:], authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &VerifiedCredential{
+		CredentialID: authData.CredentialID,
+		PublicKey:    authData.RawPublicKey,
+		Alg:          authData.PublicKey.Alg,
+		SignCount:    authData.SignCount,
+		AAGUID:       authData.AAGUID,
+		Transports:   credential.Response.Transports,
+	}, nil
+}
+
+// verifyAttestationStatement supports the none and packed formats. Attestation
+// certificates are checked for a valid signature only, authenticator models are not
+// restricted.
+func verifyAttestationStatement(format string, attStmt map[any]any, rawAuthData []byte, clientDataHash []byte, credKey *CredentialPublicKey) error {
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return errors.New("none attestation must have an empty statement")
+		}
+		return nil
+	case "packed":
+		alg, _ := attStmt["alg"].(int64)
+		sig, ok := attStmt["sig"].([]byte)
+		if !ok {
+			return errors.New("packed attestation has no signature")
+		}
+		signed := append(append([]byte{}, rawAuthData...), clientDataHash...)
+
+		x5c, hasX5c := attStmt["x5c"].([]any)
+		if !hasX5c {
+			// self attestation is signed by the credential key itself
+			if alg != credKey.Alg {
+				return errors.New("packed self attestation alg does not match credential")
+			}
+			return credKey.Verify(signed, sig)
+		}
+		if len(x5c) == 0 {
+			return errors.New("packed attestation has an empty x5c")
+		}
+		leafDer, ok := x5c[0].([]byte)
+		if !ok {
+			return errors.New("invalid packed attestation certificate")
+		}
+		leaf, err := x509.ParseCertificate(leafDer)
+		if err != nil {
+			return fmt.Errorf("error parsing attestation certificate: %w", err)
+		}
+		attKey := &CredentialPublicKey{Alg: alg, Key: leaf.PublicKey}
+		return attKey.Verify(signed, sig)
+	default:
+		return fmt.Errorf("unsupported attestation format %q", format)
+	}
+}
+
+// VerifyAssertion verifies a navigator.credentials.get() response for a stored credential
+// and returns the new sign count.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, credential *AssertionCredential, publicKey []byte, storedSignCount uint32) (uint32, error) {
+	if credential == nil || credential.Type != "public-key" {
+		return 0, errors.New("credential type must be public-key")
+	}
+	if err := rp.verifyClientData(credential.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(credential.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	credKey, _, err := ParseCredentialPublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(credential.Response.ClientDataJSON)
+	signed := append(append([]byte{}, credential.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := credKey.Verify(signed, credential.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	// authenticators without a counter always report zero
+	if (authData.SignCount != 0 || storedSignCount != 0) && authData.SignCount <= storedSignCount {
+		return authData.SignCount, ErrSignCountRegression
+	}
+	return authData.SignCount, nil
+}
@@ -0,0 +1,211 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// swagger:route POST /webauthn/register/begin webauthn beginPasskeyRegistration
+// Start registering a passkey for the current user.
+// responses:
+//
+//	200: BeginRegistrationResponse
+//	401: description:Unauthorized
+func BeginRegistrationHandler(provider WebAuthnProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userName := userID.String()
+		if claims, ok := r.Context().Value(authapi.ClaimsContextKey).(jwt.MapClaims); ok {
+			if email, ok := claims["name"].(string); ok && email != "" {
+				userName = email
+			}
+		}
+
+		options, err := provider.BeginRegistration(userID, userName, userName)
+		if err != nil {
+			http.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(options)
+	}))
+}
+
+// swagger:route POST /webauthn/register/finish webauthn finishPasskeyRegistration
+// Verify the authenticator attestation and store the new passkey.
+// responses:
+//
+//	200: WebAuthnCredentialResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+//	409: description:Credential already registered
+func FinishRegistrationHandler(provider WebAuthnProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req FinishRegistrationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		cred, err := provider.FinishRegistration(userID, &req)
+		if err != nil {
+			if errors.Is(err, ErrCredentialExists) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, "Passkey registration failed", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cred)
+	}))
+}
+
+// swagger:route GET /webauthn/credentials webauthn getPasskeys
+// List the passkeys of the current user.
+// responses:
+//
+//	200: WebAuthnCredentialsResponse
+//	401: description:Unauthorized
+func GetCredentialsHandler(provider WebAuthnProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		creds, err := provider.GetCredentials(userID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve passkeys", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(creds)
+	}))
+}
+
+// swagger:route DELETE /webauthn/credentials/{ID} webauthn deletePasskey
+// Delete a passkey of the current user.
+// responses:
+//
+//	204: description:Passkey deleted
+//	401: description:Unauthorized
+//	404: description:Not Found
+func DeleteCredentialHandler(provider WebAuthnProvider) http.Handler {
+	return authapi.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("ID"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := authapi.GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := provider.DeleteCredential(userID, id); err != nil {
+			if errors.Is(err, ErrCredentialNotFound) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// swagger:route POST /login/webauthn/begin Authentication beginPasskeyLogin
+// Start a passkey login. The userName is optional, without it discoverable credentials are used.
+// responses:
+//
+//	200: BeginLoginResponse
+//	400: description:Invalid request
+func BeginLoginHandler(provider WebAuthnProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req BeginLoginRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+		}
+
+		options, err := provider.BeginLogin(req.UserName)
+		if err != nil {
+			http.Error(w, "Failed to start passkey login", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(options)
+	})
+}
+
+// swagger:route POST /login/webauthn/finish Authentication finishPasskeyLogin
+// Verify a passkey assertion and return the same tokens as a password login. A passkey
+// login with user verification satisfies MFA on its own.
+// responses:
+//
+//	200: LocalLoginResponse
+//	400: description:Invalid request
+//	401: description:Unauthorized
+func FinishLoginHandler(provider WebAuthnProvider, authService authapi.AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req FinishLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := provider.FinishLogin(&req)
+		if err != nil {
+			http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := authService.GetUserById(userID)
+		if err != nil || !user.Enabled {
+			slog.Error("Passkey login for missing or disabled user", slog.String("userId", userID.String()))
+			http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := authService.CreateAuthTokenOnLogin(user.Id, user.RoleIds, user.Email)
+		if err != nil {
+			slog.Error("Error creating auth tokens", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		response := authapi.LocalLoginResponse{UserID: user.Id,
+			Username: user.UserName, Email: user.Email,
+			Token: token.Token, RefreshToken: token.RefreshToken, Expiration: token.Expiration}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
@@ -0,0 +1,19 @@
+package webauthn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebAuthnProvider interface {
+	BeginRegistration(userId uuid.UUID, userName string, displayName string) (*BeginRegistrationResponse, error)
+	FinishRegistration(userId uuid.UUID, req *FinishRegistrationRequest) (*WebAuthnCredentialDao, error)
+	BeginLogin(userName string) (*BeginLoginResponse, error)
+	FinishLogin(req *FinishLoginRequest) (uuid.UUID, error)
+	GetCredentials(userId uuid.UUID) ([]WebAuthnCredentialDao, error)
+	DeleteCredential(userId uuid.UUID, id uuid.UUID) error
+	HasPasskeys(userId uuid.UUID) (bool, error)
+	StartSessionCleanup(ctx context.Context, interval time.Duration)
+}
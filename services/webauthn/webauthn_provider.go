@@ -0,0 +1,329 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/babbage88/go-infra/database/infra_db_pg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("webauthn session not found or expired")
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	ErrCredentialExists   = errors.New("webauthn credential is already registered")
+)
+
+type PgWebAuthnProvider struct {
+	DbConn       *pgxpool.Pool
+	RelyingParty *RelyingParty
+}
+
+func NewPgWebAuthnProvider(dbConn *pgxpool.Pool, rp *RelyingParty) *PgWebAuthnProvider {
+	return &PgWebAuthnProvider{DbConn: dbConn, RelyingParty: rp}
+}
+
+func credentialDescriptors(creds []infra_db_pg.WebauthnCredential) []CredentialDescriptor {
+	descriptors := make([]CredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		descriptors = append(descriptors, CredentialDescriptor{Type: "public-key", ID: cred.CredentialID, Transports: cred.Transports})
+	}
+	return descriptors
+}
+
+func credentialDaoFromDb(cred infra_db_pg.WebauthnCredential) WebAuthnCredentialDao {
+	return WebAuthnCredentialDao{
+		ID:           cred.ID,
+		UserID:       cred.UserID,
+		CredentialID: cred.CredentialID,
+		Name:         cred.Name,
+		SignCount:    cred.SignCount,
+		Transports:   cred.Transports,
+		CreatedAt:    cred.CreatedAt.Time,
+		LastUsedAt:   cred.LastUsedAt.Time,
+	}
+}
+
+func (p *PgWebAuthnProvider) newSession(ctx context.Context, userId pgtype.UUID, ceremony string) (uuid.UUID, []byte, error) {
+	challenge, err := p.RelyingParty.NewChallenge()
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	sessionId := uuid.New()
+	qry := infra_db_pg.New(p.DbConn)
+	err = qry.InsertWebauthnSession(ctx, infra_db_pg.InsertWebauthnSessionParams{
+		ID:        sessionId,
+		UserID:    userId,
+		Ceremony:  ceremony,
+		Challenge: challenge,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(p.RelyingParty.Timeout), Valid: true},
+	})
+	if err != nil {
+		slog.Error("Error storing webauthn session", slog.String("error", err.Error()))
+		return uuid.Nil, nil, fmt.Errorf("error storing webauthn session: %w", err)
+	}
+	return sessionId, challenge, nil
+}
+
+// consumeSession deletes the session so every challenge can only be answered once.
+func (p *PgWebAuthnProvider) consumeSession(ctx context.Context, sessionId uuid.UUID, ceremony string) (infra_db_pg.WebauthnSession, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	session, err := qry.ConsumeWebauthnSession(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return session, ErrSessionNotFound
+		}
+		return session, fmt.Errorf("error retrieving webauthn session: %w", err)
+	}
+	if session.Ceremony != ceremony || time.Now().After(session.ExpiresAt.Time) {
+		return session, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (p *PgWebAuthnProvider) BeginRegistration(userId uuid.UUID, userName string, displayName string) (*BeginRegistrationResponse, error) {
+	ctx := context.Background()
+	qry := infra_db_pg.New(p.DbConn)
+	existing, err := qry.GetWebauthnCredentialsByUserId(ctx, userId)
+	if err != nil {
+		slog.Error("Error retrieving webauthn credentials", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	sessionId, challenge, err := p.newSession(ctx, pgtype.UUID{Bytes: userId, Valid: true}, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return &BeginRegistrationResponse{
+		SessionID: sessionId,
+		PublicKey: PublicKeyCredentialCreationOptions{
+			Rp:                 RelyingPartyEntity{ID: p.RelyingParty.ID, Name: p.RelyingParty.Name},
+			User:               UserEntity{ID: userId[:], Name: userName, DisplayName: displayName},
+			Challenge:          challenge,
+			PubKeyCredParams:   params,
+			Timeout:            p.RelyingParty.Timeout.Milliseconds(),
+			ExcludeCredentials: credentialDescriptors(existing),
+			AuthenticatorSelection: AuthenticatorSelection{
+				ResidentKey:      "preferred",
+				UserVerification: p.RelyingParty.UserVerification,
+			},
+			Attestation: "none",
+		},
+	}, nil
+}
+
+func (p *PgWebAuthnProvider) FinishRegistration(userId uuid.UUID, req *FinishRegistrationRequest) (*WebAuthnCredentialDao, error) {
+	ctx := context.Background()
+	session, err := p.consumeSession(ctx, req.SessionID, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if !session.UserID.Valid || uuid.UUID(session.UserID.Bytes) != userId {
+		return nil, ErrSessionNotFound
+	}
+
+	verified, err := p.RelyingParty.VerifyRegistration(session.Challenge, &req.Credential)
+	if err != nil {
+		slog.Error("Webauthn registration failed", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	if _, err := qry.GetWebauthnCredentialByCredentialId(ctx, verified.CredentialID); err == nil {
+		return nil, ErrCredentialExists
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "passkey"
+	}
+	transports := verified.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	id, err := qry.InsertWebauthnCredential(ctx, infra_db_pg.InsertWebauthnCredentialParams{
+		UserID:       userId,
+		CredentialID: verified.CredentialID,
+		PublicKey:    verified.PublicKey,
+		Alg:          verified.Alg,
+		SignCount:    int64(verified.SignCount),
+		Aaguid:       verified.AAGUID,
+		Transports:   transports,
+		Name:         name,
+	})
+	if err != nil {
+		slog.Error("Error storing webauthn credential", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("error storing webauthn credential: %w", err)
+	}
+
+	slog.Info("Registered webauthn credential", slog.String("userId", userId.String()), slog.String("credentialId", id.String()))
+	return &WebAuthnCredentialDao{
+		ID:           id,
+		UserID:       userId,
+		CredentialID: verified.CredentialID,
+		Name:         name,
+		SignCount:    int64(verified.SignCount),
+		Transports:   transports,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// BeginLogin starts an assertion. With a user name the user's credentials are listed in
+// allowCredentials, without one the browser offers discoverable credentials. Unknown user
+// names fall back to the discoverable flow so the response does not reveal which users exist.
+func (p *PgWebAuthnProvider) BeginLogin(userName string) (*BeginLoginResponse, error) {
+	ctx := context.Background()
+	qry := infra_db_pg.New(p.DbConn)
+
+	var sessionUser pgtype.UUID
+	allow := []CredentialDescriptor{}
+	if userName != "" {
+		userId, err := qry.GetUserIdByName(ctx, pgtype.Text{String: userName, Valid: true})
+		if err == nil {
+			creds, err := qry.GetWebauthnCredentialsByUserId(ctx, userId)
+			if err != nil {
+				slog.Error("Error retrieving webauthn credentials", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+				return nil, err
+			}
+			if len(creds) > 0 {
+				sessionUser = pgtype.UUID{Bytes: userId, Valid: true}
+				allow = credentialDescriptors(creds)
+			}
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			slog.Error("Error retrieving user", slog.String("error", err.Error()))
+			return nil, err
+		}
+	}
+
+	sessionId, challenge, err := p.newSession(ctx, sessionUser, ceremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BeginLoginResponse{
+		SessionID: sessionId,
+		PublicKey: PublicKeyCredentialRequestOptions{
+			Challenge:        challenge,
+			Timeout:          p.RelyingParty.Timeout.Milliseconds(),
+			RpID:             p.RelyingParty.ID,
+			AllowCredentials: allow,
+			UserVerification: p.RelyingParty.UserVerification,
+		},
+	}, nil
+}
+
+// FinishLogin verifies the assertion and returns the ID of the authenticated user.
+func (p *PgWebAuthnProvider) FinishLogin(req *FinishLoginRequest) (uuid.UUID, error) {
+	ctx := context.Background()
+	session, err := p.consumeSession(ctx, req.SessionID, ceremonyLogin)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	qry := infra_db_pg.New(p.DbConn)
+	stored, err := qry.GetWebauthnCredentialByCredentialId(ctx, req.Credential.RawID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrCredentialNotFound
+		}
+		return uuid.Nil, fmt.Errorf("error retrieving webauthn credential: %w", err)
+	}
+	if session.UserID.Valid && uuid.UUID(session.UserID.Bytes) != stored.UserID {
+		return uuid.Nil, ErrCredentialNotFound
+	}
+	userHandle := req.Credential.Response.UserHandle
+	if len(userHandle) > 0 && !bytes.Equal(userHandle, stored.UserID[:]) {
+		return uuid.Nil, errors.New("webauthn user handle does not match credential")
+	}
+
+	signCount, err := p.RelyingParty.VerifyAssertion(session.Challenge, &req.Credential, stored.PublicKey, uint32(stored.SignCount))
+	if err != nil {
+		slog.Warn("Webauthn assertion failed",
+			slog.String("userId", stored.UserID.String()),
+			slog.String("credentialId", stored.ID.String()),
+			slog.String("error", err.Error()))
+		return uuid.Nil, err
+	}
+
+	err = qry.UpdateWebauthnCredentialSignCount(ctx, infra_db_pg.UpdateWebauthnCredentialSignCountParams{ID: stored.ID, SignCount: int64(signCount)})
+	if err != nil {
+		slog.Error("Error updating webauthn sign count", slog.String("error", err.Error()))
+		return uuid.Nil, err
+	}
+	return stored.UserID, nil
+}
+
+func (p *PgWebAuthnProvider) GetCredentials(userId uuid.UUID) ([]WebAuthnCredentialDao, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	creds, err := qry.GetWebauthnCredentialsByUserId(context.Background(), userId)
+	if err != nil {
+		slog.Error("Error retrieving webauthn credentials", slog.String("userId", userId.String()), slog.String("error", err.Error()))
+		return nil, err
+	}
+	daos := make([]WebAuthnCredentialDao, 0, len(creds))
+	for _, cred := range creds {
+		daos = append(daos, credentialDaoFromDb(cred))
+	}
+	return daos, nil
+}
+
+func (p *PgWebAuthnProvider) DeleteCredential(userId uuid.UUID, id uuid.UUID) error {
+	qry := infra_db_pg.New(p.DbConn)
+	rows, err := qry.DeleteWebauthnCredential(context.Background(), infra_db_pg.DeleteWebauthnCredentialParams{ID: id, UserID: userId})
+	if err != nil {
+		slog.Error("Error deleting webauthn credential", slog.String("error", err.Error()))
+		return err
+	}
+	if rows == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+func (p *PgWebAuthnProvider) HasPasskeys(userId uuid.UUID) (bool, error) {
+	qry := infra_db_pg.New(p.DbConn)
+	count, err := qry.CountWebauthnCredentialsByUserId(context.Background(), userId)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// StartSessionCleanup periodically deletes unanswered ceremony sessions.
+func (p *PgWebAuthnProvider) StartSessionCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				qry := infra_db_pg.New(p.DbConn)
+				if err := qry.DeleteExpiredWebauthnSessions(ctx); err != nil {
+					slog.Error("Error deleting expired webauthn sessions", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,262 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	testRpId   = "infra.example.com"
+	testOrigin = "https://infra.example.com"
+)
+
+// cborEncode covers the subset of CBOR the software authenticator needs.
+func cborEncode(v any) []byte {
+	header := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(n))
+			return b
+		default:
+			b := []byte{major<<5 | 26, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(b[1:], uint32(n))
+			return b
+		}
+	}
+
+	switch val := v.(type) {
+	case int:
+		if val < 0 {
+			return header(1, uint64(-1-val))
+		}
+		return header(0, uint64(val))
+	case int64:
+		return cborEncode(int(val))
+	case []byte:
+		return append(header(2, uint64(len(val))), val...)
+	case string:
+		return append(header(3, uint64(len(val))), val...)
+	case []any:
+		out := header(4, uint64(len(val)))
+		for _, item := range val {
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	case map[any]any:
+		out := header(5, uint64(len(val)))
+		for k, item := range val {
+			out = append(out, cborEncode(k)...)
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	}
+	panic("unsupported cbor test value")
+}
+
+// softwareAuthenticator emulates a platform authenticator holding one credential.
+type softwareAuthenticator struct {
+	rpId         string
+	credentialId []byte
+	signer       crypto.Signer
+	alg          int64
+	signCount    uint32
+	flags        byte
+}
+
+func newSoftwareAuthenticator(t *testing.T, alg int64) *softwareAuthenticator {
+	t.Helper()
+	a := &softwareAuthenticator{rpId: testRpId, credentialId: make([]byte, 16), alg: alg, flags: flagUserPresent | flagUserVerified}
+	rand.Read(a.credentialId)
+	var err error
+	switch alg {
+	case CoseAlgES256:
+		a.signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case CoseAlgEdDSA:
+		_, a.signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("error generating authenticator key: %v", err)
+	}
+	return a
+}
+
+func (a *softwareAuthenticator) coseKey() []byte {
+	switch pub := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return cborEncode(map[any]any{1: coseKeyTypeEC2, 3: int(CoseAlgES256), -1: coseCurveP256, -2: x, -3: y})
+	case ed25519.PublicKey:
+		return cborEncode(map[any]any{1: coseKeyTypeOKP, 3: int(CoseAlgEdDSA), -1: coseCurveEd25519, -2: []byte(pub)})
+	}
+	return nil
+}
+
+func (a *softwareAuthenticator) sign(data []byte) []byte {
+	var sig []byte
+	if a.alg == CoseAlgEdDSA {
+		sig, _ = a.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(data)
+		sig, _ = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return sig
+}
+
+func (a *softwareAuthenticator) authData(attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(a.rpId))
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredata
+	}
+	data := append(rpIdHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialId)))
+		data = append(data, a.credentialId...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientDataJSON(ceremonyType string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":      ceremonyType,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	return data
+}
+
+func (a *softwareAuthenticator) create(challenge []byte, origin string, format string) *RegistrationCredential {
+	clientData := clientDataJSON("webauthn.create", challenge, origin)
+	authData := a.authData(true)
+	attStmt := map[any]any{}
+	if format == "packed" {
+		clientDataHash := sha256.Sum256(clientData)
+		attStmt["alg"] = int(a.alg)
+		attStmt["sig"] = a.sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+	}
+	attObj := cborEncode(map[any]any{"fmt": format, "attStmt": attStmt, "authData": authData})
+	return &RegistrationCredential{
+		ID:       base64.RawURLEncoding.EncodeToString(a.credentialId),
+		RawID:    a.credentialId,
+		Type:     "public-key",
+		Response: AttestationResponse{ClientDataJSON: clientData, AttestationObject: attObj},
+	}
+}
+
+func (a *softwareAuthenticator) get(challenge []byte, origin string) *AssertionCredential {
+	a.signCount++
+	clientData := clientDataJSON("webauthn.get", challenge, origin)
+	authData := a.authData(false)
+	clientDataHash := sha256.Sum256(clientData)
+	return &AssertionCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialId),
+		RawID: a.credentialId,
+		Type:  "public-key",
+		Response: AssertionResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         a.sign(append(append([]byte{}, authData...), clientDataHash[:]...)),
+		},
+	}
+}
+
+func testRelyingParty() *RelyingParty {
+	return &RelyingParty{ID: testRpId, Name: "go-infra", Origins: []string{testOrigin}, UserVerification: "required", Timeout: time.Minute}
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := testRelyingParty()
+	for _, alg := range []int64{CoseAlgES256, CoseAlgEdDSA} {
+		for _, format := range []string{"none", "packed"} {
+			authenticator := newSoftwareAuthenticator(t, alg)
+
+			challenge, _ := rp.NewChallenge()
+			verified, err := rp.VerifyRegistration(challenge, authenticator.create(challenge, testOrigin, format))
+			if err != nil {
+				t.Fatalf("alg %d %s: expected registration to verify, got: %v", alg, format, err)
+			}
+			if verified.Alg != alg {
+				t.Fatalf("expected alg %d, got %d", alg, verified.Alg)
+			}
+
+			challenge, _ = rp.NewChallenge()
+			signCount, err := rp.VerifyAssertion(challenge, authenticator.get(challenge, testOrigin), verified.PublicKey, verified.SignCount)
+			if err != nil {
+				t.Fatalf("alg %d %s: expected assertion to verify, got: %v", alg, format, err)
+			}
+			if signCount != 1 {
+				t.Fatalf("expected sign count 1, got %d", signCount)
+			}
+		}
+	}
+}
+
+func TestAssertionRejectsClonedCredential(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftwareAuthenticator(t, CoseAlgES256)
+	challenge, _ := rp.NewChallenge()
+	verified, err := rp.VerifyRegistration(challenge, authenticator.create(challenge, testOrigin, "none"))
+	if err != nil {
+		t.Fatalf("expected registration to verify, got: %v", err)
+	}
+
+	challenge, _ = rp.NewChallenge()
+	if _, err := rp.VerifyAssertion(challenge, authenticator.get(challenge, testOrigin), verified.PublicKey, 5); !errors.Is(err, ErrSignCountRegression) {
+		t.Fatalf("expected sign count regression, got: %v", err)
+	}
+}
+
+func TestCeremonyRejections(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftwareAuthenticator(t, CoseAlgES256)
+	challenge, _ := rp.NewChallenge()
+	verified, err := rp.VerifyRegistration(challenge, authenticator.create(challenge, testOrigin, "none"))
+	if err != nil {
+		t.Fatalf("expected registration to verify, got: %v", err)
+	}
+
+	otherChallenge, _ := rp.NewChallenge()
+	if _, err := rp.VerifyAssertion(challenge, authenticator.get(otherChallenge, testOrigin), verified.PublicKey, 0); !errors.Is(err, ErrChallengeMismatch) {
+		t.Fatalf("expected challenge mismatch, got: %v", err)
+	}
+	if _, err := rp.VerifyAssertion(challenge, authenticator.get(challenge, "https://phish.example.net"), verified.PublicKey, 0); !errors.Is(err, ErrOriginNotAllowed) {
+		t.Fatalf("expected origin to be rejected, got: %v", err)
+	}
+
+	tampered := authenticator.get(challenge, testOrigin)
+	tampered.Response.Signature[len(tampered.Response.Signature)-1] ^= 0xff
+	if _, err := rp.VerifyAssertion(challenge, tampered, verified.PublicKey, 0); err == nil {
+		t.Fatal("expected tampered signature to be rejected")
+	}
+
+	authenticator.rpId = "evil.example.com"
+	if _, err := rp.VerifyAssertion(challenge, authenticator.get(challenge, testOrigin), verified.PublicKey, 0); err == nil {
+		t.Fatal("expected assertion for another rp id to be rejected")
+	}
+
+	authenticator.rpId = testRpId
+	authenticator.flags = flagUserPresent
+	if _, err := rp.VerifyAssertion(challenge, authenticator.get(challenge, testOrigin), verified.PublicKey, 0); err == nil {
+		t.Fatal("expected assertion without user verification to be rejected")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -13,8 +14,10 @@ import (
 	"github.com/babbage88/go-infra/internal/bumper"
 	"github.com/babbage88/go-infra/internal/embedbin"
 	"github.com/babbage88/go-infra/internal/pretty"
+	"github.com/babbage88/go-infra/services/rbac_sync"
 	"github.com/babbage88/go-infra/services/user_secrets"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
@@ -34,6 +37,10 @@ var (
 	version            bool
 	initDb             bool
 	migrationBin       string
+	rewrapSecrets      bool
+	syncRbacFile       string
+	syncRbacDryRun     bool
+	syncRbacPrune      bool
 )
 
 func testAES256GCMEncryptDecrypt() {
@@ -59,7 +66,7 @@ func testPgSecretStore() {
 	devuserUUID := uuid.MustParse(os.Getenv("DEV_USER_UUID"))
 	appUUID := uuid.MustParse("f69a0abc-d82c-4013-9b25-b8abf4e4a896")
 	secretUUID := uuid.MustParse("f7a62a3b-9680-441f-9fa2-6339bb419a47")
-	secretId, err := pgSecretStore.StoreSecret("TestPgSecretStoreExample", devuserUUID, appUUID, time.Now().AddDate(0, 0, 1))
+	secretId, err := pgSecretStore.StoreSecret(context.Background(), "TestPgSecretStoreExample", devuserUUID, appUUID, time.Now().AddDate(0, 0, 1))
 	if err != nil {
 		slog.Error("Error storing secret", "error", err.Error())
 		os.Exit(1)
@@ -82,6 +89,55 @@ func testPgSecretStore() {
 
 }
 
+// rewrapUserSecrets migrates every stored secret onto the active KEK and the AAD bound
+// ciphertext format in batches. It is safe to run while the API is serving traffic.
+func rewrapUserSecrets() {
+	provider := initializeSecretKeyProvider()
+	connPool := initPgConnPool()
+	stats, err := user_secrets.NewPgUserSecretStore(connPool).RewrapSecrets(context.Background(), rewrapBatchSizeFromEnv())
+	if err != nil {
+		slog.Error("Error re-wrapping user secrets", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	slog.Info("Re-wrapped user secrets",
+		slog.String("keyProvider", provider.Name()),
+		slog.Int("scanned", stats.Scanned),
+		slog.Int("rewrapped", stats.Rewrapped),
+		slog.Int("skipped", stats.Skipped),
+		slog.Int("failed", stats.Failed))
+	if stats.Failed > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// syncRbacPolicy reconciles the database with the --sync-rbac document and exits. It runs
+// after the audit log is initialized so applied plans are recorded.
+func syncRbacPolicy(connPool *pgxpool.Pool) {
+	doc, err := rbac_sync.ReadDocumentFile(syncRbacFile)
+	if err != nil {
+		slog.Error("Error reading rbac document", slog.String("file", syncRbacFile), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	plan, err := rbac_sync.NewPgRbacSync(connPool).Sync(context.Background(), doc, rbac_sync.SyncOptions{
+		DryRun: syncRbacDryRun,
+		Prune:  syncRbacPrune,
+	})
+	if err != nil {
+		slog.Error("Error syncing rbac document", slog.String("file", syncRbacFile), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	for _, change := range plan.Changes {
+		fmt.Println(change.String())
+	}
+	slog.Info("Synced rbac document",
+		slog.String("file", syncRbacFile),
+		slog.Int("changes", len(plan.Changes)),
+		slog.Bool("dryRun", plan.DryRun),
+		slog.Bool("applied", plan.Applied))
+	os.Exit(0)
+}
+
 func startInLocalDevelopmentMode(envFile string) {
 	slog.Info("Local Development mode configure, loading envars from env-file", slog.String("env-file", envFile))
 	err := godotenv.Load(envFile)
@@ -135,6 +191,10 @@ func parseFlags() {
 	flag.BoolVar(&testEncryption, "test-enc", false, "testing/debugging encrytion package")
 	flag.BoolVar(&initDb, "init-db", false, "Initialize the database with default schema and data")
 	flag.StringVar(&migrationBin, "migration-bin", "", "Path to the migration binary to run (optional, uses embedded binary if not specified)")
+	flag.BoolVar(&rewrapSecrets, "rewrap-secrets", false, "Re-wrap all user secrets onto the active key encryption key and current ciphertext format, then exit")
+	flag.StringVar(&syncRbacFile, "sync-rbac", "", "Apply a YAML or JSON document of roles, permissions and mappings, then exit")
+	flag.BoolVar(&syncRbacDryRun, "sync-rbac-dry-run", false, "Only print the plan for --sync-rbac")
+	flag.BoolVar(&syncRbacPrune, "sync-rbac-prune", false, "Disable roles and mappings missing from the --sync-rbac document")
 	flag.Parse()
 
 }
@@ -156,6 +216,10 @@ func configureStartupOptions() {
 		bootstrapDb()
 	}
 
+	if rewrapSecrets {
+		rewrapUserSecrets()
+	}
+
 	if initDb {
 		if err := runMigration(migrationBin); err != nil {
 			slog.Error("Error running migration", slog.String("error", err.Error()))
@@ -46,7 +46,7 @@ func TestMillionStoredSecretsHaveUniqueEncryption(t *testing.T) {
 
 	t.Logf("Storing %d secrets...", totalSecrets)
 	for i := 0; i < totalSecrets; i++ {
-		secretId, err := provider.StoreSecret(samplePlaintext, userId, appId, time.Now())
+		secretId, err := provider.StoreSecret(context.Background(), samplePlaintext, userId, appId, time.Now())
 		if err != nil {
 			t.Fatalf("failed to store secret at iteration %d: %v", i, err)
 		}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/babbage88/go-acme-cli/cloud_providers/cf_acme"
+	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/google/uuid"
 )
 
 var certPrefix string = "-----BEGIN CERTIFICATE-----\n"
@@ -50,6 +52,28 @@ type CertDnsRenewReq struct {
 	Token                string        `json:"token"`
 	RecursiveNameServers []string      `json:"recurseServers"`
 	Timeout              time.Duration `json:"timeout"`
+	// SecretId references an acme_account typed secret supplying the DNS API token and,
+	// unless set in the request, the ACME email and directory url.
+	SecretId *uuid.UUID `json:"secretId,omitempty"`
+}
+
+// ApplyAcmeAccount fills the credentials of the request from an acme_account secret.
+func (c *CertDnsRenewReq) ApplyAcmeAccount(secret *user_secrets.TypedSecret) error {
+	if secret.Type != user_secrets.SecretTypeAcmeAccount {
+		return fmt.Errorf("secret type %q cannot be used for certificate renewal, expected %q", secret.Type, user_secrets.SecretTypeAcmeAccount)
+	}
+	token, err := secret.Field("dns_api_token")
+	if err != nil {
+		return err
+	}
+	c.Token = token
+	if c.AcmeEmail == "" {
+		c.AcmeEmail, _ = secret.Field("email")
+	}
+	if c.AcmeUrl == "" {
+		c.AcmeUrl, _ = secret.Field("acme_url")
+	}
+	return nil
 }
 
 func (c *CertDnsRenewReq) InitAcmeRenewRequest() *cf_acme.CertificateRenewalRequest {
@@ -1,24 +1,36 @@
 package cert_renew
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/babbage88/go-infra/api/authapi"
+	"github.com/babbage88/go-infra/services/audit_log"
+	"github.com/babbage88/go-infra/services/user_secrets"
+	"github.com/google/uuid"
 )
 
+// TypedSecretRetriever is the part of user_secrets.UserSecretProvider used to resolve
+// renewal credentials from a typed secret.
+type TypedSecretRetriever interface {
+	RetrieveTypedSecretForUser(ctx context.Context, callerId, secretId uuid.UUID) (*user_secrets.TypedSecret, error)
+}
+
 // swagger:route POST /renew Certificates Renew
 // Request/Renew ssl certificate via cloudflare letsencrypt. Uses DNS Challenge
 // responses:
 //  200: CertificateDataRenewResponse
 //	400: description:Bad Request
-//	401: description:Unauthorized
+//	401: description:Unauthorized, or missing the ReadSecretPlaintext permission
 //	500: description:Insernal Server Error
 // produces:
 // - application/json
 // - application/zip
 
-func Renewcert_renew() http.HandlerFunc {
+func Renewcert_renew(secrets TypedSecretRetriever) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("Received POST request for Cert Renewal")
 		var req CertDnsRenewReq
@@ -28,6 +40,33 @@ func Renewcert_renew() http.HandlerFunc {
 			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		if len(req.DomainNames) == 0 {
+			http.Error(w, "Bad request: domainName is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.SecretId != nil {
+			userID, err := authapi.GetUserIDFromContext(r.Context())
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			secret, err := secrets.RetrieveTypedSecretForUser(r.Context(), userID, *req.SecretId)
+			if err != nil {
+				slog.Error("Failed to retrieve acme account secret", slog.String("secretId", req.SecretId.String()), slog.String("error", err.Error()))
+				http.Error(w, "Bad request: acme account secret is not available", http.StatusBadRequest)
+				return
+			}
+			audit_log.Record(r.Context(), audit_log.Event{
+				Action:       audit_log.ActionRead,
+				ResourceType: audit_log.ResourceSecret,
+				ResourceId:   req.SecretId.String(),
+			})
+			if err := req.ApplyAcmeAccount(secret); err != nil {
+				http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
 		slog.Info("Decoded request body", slog.String("DomainName", req.DomainNames[0]))
 